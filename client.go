@@ -3,6 +3,10 @@ package stereoscope
 import (
 	"context"
 	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
 
 	"github.com/anchore/stereoscope/internal/bus"
 	dockerClient "github.com/anchore/stereoscope/internal/docker"
@@ -10,15 +14,28 @@ import (
 	"github.com/anchore/stereoscope/internal/podman"
 	"github.com/anchore/stereoscope/pkg/file"
 	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/anchore/stereoscope/pkg/image/archive"
+	"github.com/anchore/stereoscope/pkg/image/containerd"
+	"github.com/anchore/stereoscope/pkg/image/containers"
 	"github.com/anchore/stereoscope/pkg/image/docker"
+	"github.com/anchore/stereoscope/pkg/image/httparchive"
+	"github.com/anchore/stereoscope/pkg/image/objectstore"
 	"github.com/anchore/stereoscope/pkg/image/oci"
 	"github.com/anchore/stereoscope/pkg/image/sif"
 	"github.com/anchore/stereoscope/pkg/logger"
+	"github.com/anchore/stereoscope/pkg/redact"
+	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/wagoodman/go-partybus"
 )
 
 var rootTempDirGenerator = file.NewTempDirGenerator("stereoscope")
 
+// stdinLocation is the location of an archive source that reads the image archive from stdin (e.g. "docker-archive:-").
+const stdinLocation = "-"
+
+// stdin is where image archives are read from for the stdinLocation
+var stdin io.Reader = os.Stdin
+
 func WithRegistryOptions(options image.RegistryOptions) Option {
 	return func(c *config) error {
 		c.Registry = options
@@ -33,6 +50,22 @@ func WithInsecureSkipTLSVerify() Option {
 	}
 }
 
+// WithRegistryTLS configures TLS for registry connections: the PEM encoded CA bundle to trust in addition to the system
+// CAs, the PEM encoded client certificate and key to present to registries requiring mutual TLS, and whether to skip
+// TLS verification entirely. Any file may be empty to leave that aspect unconfigured.
+func WithRegistryTLS(caFile, certFile, keyFile string, insecureSkipVerify bool) Option {
+	return func(c *config) error {
+		if (certFile == "") != (keyFile == "") {
+			return fmt.Errorf("both a client certificate and key are required for registry TLS (cert=%q key=%q)", certFile, keyFile)
+		}
+		c.Registry.CAFile = caFile
+		c.Registry.ClientCertFile = certFile
+		c.Registry.ClientKeyFile = keyFile
+		c.Registry.InsecureSkipTLSVerify = c.Registry.InsecureSkipTLSVerify || insecureSkipVerify
+		return nil
+	}
+}
+
 func WithInsecureAllowHTTP() Option {
 	return func(c *config) error {
 		c.Registry.InsecureUseHTTP = true
@@ -47,6 +80,107 @@ func WithCredentials(credentials ...image.RegistryCredentials) Option {
 	}
 }
 
+// WithRegistryCredentials uses basic auth with the given username and password when fetching images from the given
+// registry (e.g. "registry.example.com:5000").
+func WithRegistryCredentials(registry, username, password string) Option {
+	return func(c *config) error {
+		if username == "" || password == "" {
+			return fmt.Errorf("both a username and password are required for registry=%q", registry)
+		}
+		c.Registry.Credentials = append(c.Registry.Credentials, image.RegistryCredentials{
+			Authority: registry,
+			Username:  username,
+			Password:  password,
+		})
+		return nil
+	}
+}
+
+// WithBearerToken uses the given bearer token when fetching images from the given registry.
+func WithBearerToken(registry, token string) Option {
+	return func(c *config) error {
+		if token == "" {
+			return fmt.Errorf("no token provided for registry=%q", registry)
+		}
+		c.Registry.Credentials = append(c.Registry.Credentials, image.RegistryCredentials{
+			Authority: registry,
+			Token:     token,
+		})
+		return nil
+	}
+}
+
+// WithKeychain resolves registry credentials from the given keychain (e.g. a cloud provider keychain or a keychain
+// built from programmatically managed credentials) after any explicitly configured credentials. See
+// image.RegistryOptions.ResolveCredentials for the resolution order.
+func WithKeychain(keychain authn.Keychain) Option {
+	return func(c *config) error {
+		c.Registry.Keychain = keychain
+		return nil
+	}
+}
+
+// WithRegistryDialer uses the given function to establish all registry connections (see image.NewStaticHostDialer for
+// static host mappings).
+func WithRegistryDialer(dial image.DialContextFunc) Option {
+	return func(c *config) error {
+		c.Registry.DialContext = dial
+		return nil
+	}
+}
+
+// WithRegistryTransportSettings tunes the connection pooling of registry connections (e.g. max connections per host,
+// idle connection timeouts, and HTTP/2). See image.RegistryTransportSettings for details.
+func WithRegistryTransportSettings(settings image.RegistryTransportSettings) Option {
+	return func(c *config) error {
+		c.Registry.TransportSettings = settings
+		return nil
+	}
+}
+
+// WithRegistryTransportPool reuses registry connections between all image fetches sharing the same pool (see
+// image.NewRegistryTransportPool).
+func WithRegistryTransportPool(pool *image.RegistryTransportPool) Option {
+	return func(c *config) error {
+		c.Registry.TransportPool = pool
+		return nil
+	}
+}
+
+// WithDockerConfigDir sources registry credentials from the docker config.json within the given directory instead
+// of the default docker config location. See image.RegistryOptions.ResolveCredentials for the resolution order.
+func WithDockerConfigDir(dir string) Option {
+	return func(c *config) error {
+		c.Registry.DockerConfigDir = dir
+		return nil
+	}
+}
+
+// WithCredentialProvider registers a callback used to refresh registry credentials when they are rejected mid-fetch
+// (e.g. expiring short-lived tokens). See image.CredentialProvider for details.
+func WithCredentialProvider(provider image.CredentialProvider) Option {
+	return func(c *config) error {
+		c.Registry.CredentialProvider = provider
+		return nil
+	}
+}
+
+// WithBandwidthLimit limits the download rate (in bytes per second) when fetching an image from a registry.
+func WithBandwidthLimit(bytesPerSecond int64) Option {
+	return func(c *config) error {
+		c.Registry.BandwidthLimit = bytesPerSecond
+		return nil
+	}
+}
+
+// WithBandwidthLimiter limits the combined download rate for all image fetches sharing the same limiter.
+func WithBandwidthLimiter(limiter *image.BandwidthLimiter) Option {
+	return func(c *config) error {
+		c.Registry.BandwidthLimiter = limiter
+		return nil
+	}
+}
+
 func WithAdditionalMetadata(metadata ...image.AdditionalMetadata) Option {
 	return func(c *config) error {
 		c.AdditionalMetadata = append(c.AdditionalMetadata, metadata...)
@@ -65,43 +199,395 @@ func WithPlatform(platform string) Option {
 	}
 }
 
-// GetImageFromSource returns an image from the explicitly provided source.
+// WithStrictPlatform fails fetching an image whose platform differs from the requested platform (see WithPlatform), or
+// the host platform when no platform is requested. See image.WithStrictPlatform for details.
+func WithStrictPlatform() Option {
+	return func(c *config) error {
+		c.ReadOptions = append(c.ReadOptions, image.WithStrictPlatform())
+		return nil
+	}
+}
+
+// WithReadLimits enforces the given limits while reading the image, skipping (and reporting) any content that violates
+// them. See image.WithReadLimits and image.HardenedReadLimits for details.
+func WithReadLimits(limits image.ReadLimits) Option {
+	return func(c *config) error {
+		c.ReadOptions = append(c.ReadOptions, image.WithReadLimits(limits))
+		return nil
+	}
+}
+
+// WithObjectStore fetches image archives from object store URLs with the given scheme (e.g. "s3://bucket/image.tar",
+// see image.ObjectStoreSchemes) using the given client, which typically wraps the SDK for the object store. No object
+// store clients are built in, so object store URLs can only be used for schemes registered with this option. The
+// archive is downloaded to a temp dir before it is read (see objectstore.ArchiveImageProvider).
+func WithObjectStore(scheme string, client objectstore.Client) Option {
+	return func(c *config) error {
+		if client == nil {
+			return fmt.Errorf("no object store client provided for scheme=%q", scheme)
+		}
+		if c.ObjectStores == nil {
+			c.ObjectStores = make(map[string]objectstore.Client)
+		}
+		c.ObjectStores[strings.ToLower(scheme)] = client
+		return nil
+	}
+}
+
+// WithMissingLayersAllowed allows reading images where some layer blobs are not present (e.g. a partially mirrored
+// OCI layout). See image.WithMissingLayersAllowed for details.
+func WithMissingLayersAllowed() Option {
+	return func(c *config) error {
+		c.ReadOptions = append(c.ReadOptions, image.WithMissingLayersAllowed())
+		return nil
+	}
+}
+
+// WithLazyLayerContent streams layer content instead of caching uncompressed layer tars on disk, fetching file
+// contents from the source only when they are read. See image.WithLazyLayerContent for details.
+func WithLazyLayerContent() Option {
+	return func(c *config) error {
+		c.ReadOptions = append(c.ReadOptions, image.WithLazyLayerContent())
+		return nil
+	}
+}
+
+// WithDeferredSquash skips generating layer squash trees while reading the image, leaving the caller to invoke
+// Image.Squash when ready. See image.WithDeferredSquash for details.
+func WithDeferredSquash() Option {
+	return func(c *config) error {
+		c.ReadOptions = append(c.ReadOptions, image.WithDeferredSquash())
+		return nil
+	}
+}
+
+// WithSquashCache shares layer squash trees between all images fetched with the same cache (see image.SquashCache and
+// image.SquashCacheBackend).
+func WithSquashCache(cache image.SquashCacheBackend) Option {
+	return func(c *config) error {
+		c.ReadOptions = append(c.ReadOptions, image.WithSquashCache(cache))
+		return nil
+	}
+}
+
+// WithCacheDir creates all temporary files for the image (e.g. the uncompressed layer tars) within the given directory
+// instead of the system temp dir.
+func WithCacheDir(dir string) Option {
+	return func(c *config) error {
+		if dir == "" {
+			return fmt.Errorf("no cache directory given")
+		}
+		c.CacheDir = dir
+		return nil
+	}
+}
+
+// WithTempDirGenerator creates all temporary files for the image from a child of the given generator (instead of the
+// process-wide generator cleaned up by Cleanup), so embedders can bound (see file.WithTempDirQuota), monitor, and tear
+// down scratch usage themselves.
+func WithTempDirGenerator(generator *file.TempDirGenerator) Option {
+	return func(c *config) error {
+		if generator == nil {
+			return fmt.Errorf("no temp dir generator given")
+		}
+		c.TempDirGenerator = generator
+		return nil
+	}
+}
+
+// WithBlobCache reuses uncompressed layer tars persisted by digest within the given directory across reads (see
+// image.DefaultBlobCacheDir for the conventional location). See image.WithBlobCache for details.
+func WithBlobCache(dir string) Option {
+	return func(c *config) error {
+		if dir == "" {
+			return fmt.Errorf("no blob cache directory given")
+		}
+		c.ReadOptions = append(c.ReadOptions, image.WithBlobCache(dir))
+		return nil
+	}
+}
+
+// WithLayerCacheBudget bounds the on-disk size of the cached layer tars. See image.WithLayerCacheBudget for details.
+func WithLayerCacheBudget(budget *image.LayerCacheBudget) Option {
+	return func(c *config) error {
+		c.ReadOptions = append(c.ReadOptions, image.WithLayerCacheBudget(budget))
+		return nil
+	}
+}
+
+// WithFileDigests records the digest of every regular file for each of the given hash algorithms (e.g. crypto.SHA256 or
+// file.XXH64, sha256 when none are given) while reading the image. The sha256 digest is used to verify content read with
+// image.Image.FileContentsVerified. See image.WithFileDigests for details.
+func WithFileDigests(hashes ...file.DigestHash) Option {
+	return func(c *config) error {
+		c.ReadOptions = append(c.ReadOptions, image.WithFileDigests(hashes...))
+		return nil
+	}
+}
+
+// WithTypeChangeWarnings reports every path replaced by a different type of file (e.g. a directory replaced by a regular
+// file) as an image warning. See image.WithTypeChangeWarnings for details.
+func WithTypeChangeWarnings() Option {
+	return func(c *config) error {
+		c.ReadOptions = append(c.ReadOptions, image.WithTypeChangeWarnings())
+		return nil
+	}
+}
+
+// WithStrictLayerCompression fails the read when the compression of a layer blob differs from what the layer media
+// type declares (by default such layers are read as detected and reported as an image warning). See
+// image.WithStrictLayerCompression for details.
+func WithStrictLayerCompression() Option {
+	return func(c *config) error {
+		c.ReadOptions = append(c.ReadOptions, image.WithStrictLayerCompression())
+		return nil
+	}
+}
+
+// WithWindowsLayerPaths normalizes the tar entry paths of Windows container image layers (e.g. "Files\Windows" is
+// read as "/Windows"). See image.WithWindowsLayerPaths for details.
+func WithWindowsLayerPaths() Option {
+	return func(c *config) error {
+		c.ReadOptions = append(c.ReadOptions, image.WithWindowsLayerPaths())
+		return nil
+	}
+}
+
+// WithForeignLayersSkipped does not fetch foreign (non-distributable) layers, such as Windows base layers, which are
+// marked as unavailable instead. See image.WithForeignLayersSkipped for details.
+func WithForeignLayersSkipped() Option {
+	return func(c *config) error {
+		c.ReadOptions = append(c.ReadOptions, image.WithForeignLayersSkipped())
+		return nil
+	}
+}
+
+// WithDockerStorageRoot reads images for the "docker-storage:" source from the docker data root at the given path
+// (e.g. a mounted disk image of a stopped host) instead of /var/lib/docker.
+func WithDockerStorageRoot(root string) Option {
+	return func(c *config) error {
+		c.DockerStorageRoot = root
+		return nil
+	}
+}
+
+// WithContainersStorageRoot reads images for the "containers-storage:" source from the containers-storage root at the
+// given path (e.g. the rootless Podman storage within the home directory) instead of /var/lib/containers/storage.
+func WithContainersStorageRoot(root string) Option {
+	return func(c *config) error {
+		c.ContainersStorageRoot = root
+		return nil
+	}
+}
+
+// WithContainerdStore reads images for the "containerd-store:" source from the given containerd root directory and
+// namespace instead of /var/lib/containerd and the "default" namespace (either may be empty to keep the default).
+func WithContainerdStore(root, namespace string) Option {
+	return func(c *config) error {
+		c.ContainerdRoot = root
+		c.ContainerdNamespace = namespace
+		return nil
+	}
+}
+
+// WithTopLayers only fetches and catalogs the top-most n layers of the image (e.g. the layers added on top of a base
+// image). See image.WithTopLayers for details.
+func WithTopLayers(n int) Option {
+	return func(c *config) error {
+		c.ReadOptions = append(c.ReadOptions, image.WithTopLayers(n))
+		return nil
+	}
+}
+
+// WithPathIndex builds the basename and extension index of the image squash tree while reading the image. See
+// image.WithPathIndex for details.
+func WithPathIndex() Option {
+	return func(c *config) error {
+		c.ReadOptions = append(c.ReadOptions, image.WithPathIndex())
+		return nil
+	}
+}
+
+// WithMergeStrategy squashes layers with the given union semantics ("aufs", "overlayfs", or "vfs"). See
+// image.WithMergeStrategy for details.
+func WithMergeStrategy(strategy string) Option {
+	return func(c *config) error {
+		s, err := image.ParseMergeStrategy(strategy)
+		if err != nil {
+			return err
+		}
+		c.ReadOptions = append(c.ReadOptions, image.WithMergeStrategy(s))
+		return nil
+	}
+}
+
+// WithContentHooks invokes each of the given hooks with the contents of every regular file while reading the image
+// (e.g. for virus or malware scanning). See image.WithContentHooks for details.
+func WithContentHooks(hooks ...image.ContentHook) Option {
+	return func(c *config) error {
+		c.ReadOptions = append(c.ReadOptions, image.WithContentHooks(hooks...))
+		return nil
+	}
+}
+
+// WithReadAudit notifies the given auditor of every read of file contents from the image, recorded with the given caller
+// tag (e.g. to account for data access per analysis job). See image.WithReadAudit and image.ReadAuditLog for details.
+func WithReadAudit(auditor image.ReadAuditor, tag string) Option {
+	return func(c *config) error {
+		c.ReadOptions = append(c.ReadOptions, image.WithReadAudit(auditor, tag))
+		return nil
+	}
+}
+
+// WithMIMETypeDetector classifies every regular file with the given detector while reading the image (nil disables MIME
+// type detection). See image.WithMIMETypeDetector for details.
+func WithMIMETypeDetector(detector file.MIMETypeDetector, sniffSize int) Option {
+	return func(c *config) error {
+		c.ReadOptions = append(c.ReadOptions, image.WithMIMETypeDetector(detector, sniffSize))
+		return nil
+	}
+}
+
+// WithCatalogCheckpoints persists layer tars and per-layer completion markers within the given directory, so an
+// interrupted read of the same image can resume from the remaining layers. See image.WithCatalogCheckpoints for details.
+func WithCatalogCheckpoints(dir string) Option {
+	return func(c *config) error {
+		c.ReadOptions = append(c.ReadOptions, image.WithCatalogCheckpoints(dir))
+		return nil
+	}
+}
+
+// WithCacheVerification re-hashes layer caches from disk after they are written, failing the read on any
+// discrepancy. See image.WithCacheVerification for details.
+func WithCacheVerification() Option {
+	return func(c *config) error {
+		c.ReadOptions = append(c.ReadOptions, image.WithCacheVerification())
+		return nil
+	}
+}
+
+// WithMetadataOnlyChangeDetection attributes the content of files that were replaced with identical content (e.g. only
+// permissions changed) to the layer that originally introduced the content. See image.WithMetadataOnlyChangeDetection
+// for details.
+func WithMetadataOnlyChangeDetection() Option {
+	return func(c *config) error {
+		c.ReadOptions = append(c.ReadOptions, image.WithMetadataOnlyChangeDetection())
+		return nil
+	}
+}
+
+// WithLayerReadConcurrency reads up to the given number of image layers at the same time. See
+// image.WithLayerReadConcurrency for details.
+func WithLayerReadConcurrency(workers int) Option {
+	return func(c *config) error {
+		if workers < 1 {
+			return fmt.Errorf("layer read concurrency must be at least 1 (given %d)", workers)
+		}
+		c.ReadOptions = append(c.ReadOptions, image.WithLayerReadConcurrency(workers))
+		return nil
+	}
+}
+
+// GetImageFromSource returns an image from the explicitly provided source. The given context is used for all daemon
+// and registry requests as well as reading the image content, so cancelling the context (or a context deadline)
+// stops the fetch and read at any point.
 func GetImageFromSource(ctx context.Context, imgStr string, source image.Source, options ...Option) (*image.Image, error) {
+	img, err := getImageFromSource(ctx, imgStr, source, options...)
+	// errors are surfaced outside of the process, so must never include credentials (see SetRedactionAllowlist)
+	return img, redact.Error(err)
+}
+
+func getImageFromSource(ctx context.Context, imgStr string, source image.Source, options ...Option) (*image.Image, error) {
 	log.Debugf("image: source=%+v location=%+v", source, imgStr)
 
+	cfg, err := parseOptions(options...)
+	if err != nil {
+		return nil, err
+	}
+
+	provider, err := selectImageProvider(imgStr, source, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return provideImage(ctx, provider, source, cfg)
+}
+
+// GetImageFromReader returns an image from the image archive streamed from the given reader (e.g. the output of
+// "docker save" piped to stdin) without first writing the archive elsewhere. The source is the archive format (docker
+// archive, OCI archive, or Singularity image), or image.UnknownSource to determine the format from the archive
+// contents. See GetImageFromSource for how the given context is used.
+func GetImageFromReader(ctx context.Context, reader io.Reader, source image.Source, options ...Option) (*image.Image, error) {
+	log.Debugf("image: source=%+v location=(reader)", source)
+
+	cfg, err := parseOptions(options...)
+	if err != nil {
+		return nil, redact.Error(err)
+	}
+
+	provider := archive.NewProviderFromReader(reader, source, newTempDirGenerator(cfg), cfg.Platform)
+	img, err := provideImage(ctx, provider, source, cfg)
+	return img, redact.Error(err)
+}
+
+func parseOptions(options ...Option) (config, error) {
 	var cfg config
 	for _, option := range options {
 		if option == nil {
 			continue
 		}
 		if err := option(&cfg); err != nil {
-			return nil, fmt.Errorf("unable to parse option: %w", err)
+			return config{}, fmt.Errorf("unable to parse option: %w", err)
 		}
 	}
+	return cfg, nil
+}
 
-	provider, err := selectImageProvider(imgStr, source, cfg)
-	if err != nil {
-		return nil, err
-	}
-
+// provideImage fetches the image from the given provider and reads the image content.
+func provideImage(ctx context.Context, provider image.Provider, source image.Source, cfg config) (*image.Image, error) {
 	img, err := provider.Provide(ctx, cfg.AdditionalMetadata...)
 	if err != nil {
 		return nil, fmt.Errorf("unable to use %s source: %w", source, err)
 	}
 
-	err = img.Read()
+	readOptions := cfg.ReadOptions
+	if cfg.Platform != nil {
+		// the requested platform is what the image is expected to be for (instead of the host platform)
+		readOptions = append([]image.ReadOption{image.WithExpectedPlatform(*cfg.Platform)}, readOptions...)
+	}
+
+	err = img.ReadWithContext(ctx, readOptions...)
 	if err != nil {
-		return nil, fmt.Errorf("could not read image: %+v", err)
+		return nil, fmt.Errorf("could not read image: %w", err)
 	}
 
 	return img, nil
 }
 
+func newTempDirGenerator(cfg config) *file.TempDirGenerator {
+	parentTempDirGenerator := rootTempDirGenerator
+	if cfg.TempDirGenerator != nil {
+		parentTempDirGenerator = cfg.TempDirGenerator
+	}
+	if cfg.CacheDir != "" {
+		return parentTempDirGenerator.NewGeneratorIn(cfg.CacheDir)
+	}
+	return parentTempDirGenerator.NewGenerator()
+}
+
 func selectImageProvider(imgStr string, source image.Source, cfg config) (image.Provider, error) {
 	var provider image.Provider
-	tempDirGenerator := rootTempDirGenerator.NewGenerator()
+	tempDirGenerator := newTempDirGenerator(cfg)
 	platformSelectionUnsupported := fmt.Errorf("specified platform=%q however image source=%q does not support selecting platform", cfg.Platform.String(), source.String())
 
+	switch source {
+	case image.DockerTarballSource, image.OciTarballSource, image.SingularitySource:
+		if imgStr == stdinLocation {
+			// the archive is piped to stdin (e.g. "docker save ... | app docker-archive:-")
+			return archive.NewProviderFromReader(stdin, source, tempDirGenerator, cfg.Platform), nil
+		}
+	}
+
 	switch source {
 	case image.DockerTarballSource:
 		if cfg.Platform != nil {
@@ -128,22 +614,32 @@ func selectImageProvider(imgStr string, source image.Source, cfg config) (image.
 			return nil, err
 		}
 	case image.OciDirectorySource:
+		provider = oci.NewProviderFromPathWithPlatform(imgStr, tempDirGenerator, cfg.Platform)
+	case image.OciTarballSource:
+		provider = oci.NewProviderFromTarballWithPlatform(imgStr, tempDirGenerator, cfg.Platform)
+	case image.OciRegistrySource:
+		provider = oci.NewProviderFromRegistry(imgStr, tempDirGenerator, cfg.Registry, cfg.Platform)
+	case image.SingularitySource:
 		if cfg.Platform != nil {
 			return nil, platformSelectionUnsupported
 		}
-		provider = oci.NewProviderFromPath(imgStr, tempDirGenerator)
-	case image.OciTarballSource:
+		provider = sif.NewProviderFromPath(imgStr, tempDirGenerator)
+	case image.HTTPTarballSource:
+		provider = httparchive.NewProviderFromURL(imgStr, tempDirGenerator, nil, cfg.Platform)
+	case image.ObjectStoreSource:
+		provider = objectstore.NewProviderFromURL(imgStr, tempDirGenerator, cfg.ObjectStores, cfg.Platform)
+	case image.DockerStorageSource:
 		if cfg.Platform != nil {
 			return nil, platformSelectionUnsupported
 		}
-		provider = oci.NewProviderFromTarball(imgStr, tempDirGenerator)
-	case image.OciRegistrySource:
-		provider = oci.NewProviderFromRegistry(imgStr, tempDirGenerator, cfg.Registry, cfg.Platform)
-	case image.SingularitySource:
+		provider = docker.NewProviderFromStorage(imgStr, cfg.DockerStorageRoot, tempDirGenerator)
+	case image.ContainerdStoreSource:
+		provider = containerd.NewProviderFromStore(imgStr, cfg.ContainerdRoot, cfg.ContainerdNamespace, tempDirGenerator, cfg.Platform)
+	case image.ContainersStorageSource:
 		if cfg.Platform != nil {
 			return nil, platformSelectionUnsupported
 		}
-		provider = sif.NewProviderFromPath(imgStr, tempDirGenerator)
+		provider = containers.NewProviderFromStorage(imgStr, cfg.ContainersStorageRoot, tempDirGenerator)
 	default:
 		return nil, fmt.Errorf("unable determine image source")
 	}
@@ -151,23 +647,57 @@ func selectImageProvider(imgStr string, source image.Source, cfg config) (image.
 }
 
 // GetImage parses the user provided image string and provides an image object;
-// note: the source where the image should be referenced from is automatically inferred.
+// note: the source where the image should be referenced from is automatically inferred. See GetImageFromSource for
+// how the given context is used. An archive source with the location "-" (e.g. "docker-archive:-") reads the image
+// archive from stdin (see GetImageFromReader).
 func GetImage(ctx context.Context, userStr string, options ...Option) (*image.Image, error) {
 	source, imgStr, err := image.DetectSource(userStr)
 	if err != nil {
-		return nil, err
+		return nil, redact.Error(err)
 	}
 	return GetImageFromSource(ctx, imgStr, source, options...)
 }
 
+// OpenFS fetches and reads the image described by the user provided image string (see GetImage) and returns the image
+// squash tree as a read-only filesystem (see image.Image.FS), along with a function that deletes all temporary files
+// created for the image (which should be called once the filesystem is no longer needed).
+func OpenFS(ctx context.Context, userStr string, options ...Option) (fs.FS, func() error, error) {
+	img, err := GetImage(ctx, userStr, options...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return img.FS(), img.Cleanup, nil
+}
+
+// SaveAnalysis writes the trees, file catalog, and metadata of an already read image to a single file that can be
+// handed off to another process (see LoadAnalysis).
+func SaveAnalysis(img *image.Image, path string) error {
+	return image.SaveAnalysis(img, path)
+}
+
+// LoadAnalysis restores an image previously written with SaveAnalysis (without access to file contents).
+func LoadAnalysis(path string) (*image.Image, error) {
+	return image.LoadAnalysis(path)
+}
+
+// SetLogger sets the logger for all stereoscope logs. All messages are redacted before reaching the logger (see
+// SetRedactionAllowlist).
 func SetLogger(logger logger.Logger) {
-	log.Log = logger
+	log.Log = redact.Logger(logger)
 }
 
 func SetBus(b *partybus.Bus) {
 	bus.SetPublisher(b)
 }
 
+// SetRedactionAllowlist sets the URL query parameters (case-insensitive) whose values are not redacted from logs,
+// events, and errors (see redact.DefaultAllowlist for the parameters kept when no names are given). URL user info,
+// authorization headers, token fields, and any registry credentials given or resolved are always redacted, and
+// additional secret values may be registered with redact.AddValues.
+func SetRedactionAllowlist(queryParams ...string) {
+	redact.SetAllowlist(queryParams...)
+}
+
 // Cleanup deletes all directories created by stereoscope calls. Note: please use image.Image.Cleanup() over this
 // function when possible.
 func Cleanup() {
@@ -1,11 +1,21 @@
 package stereoscope
 
 import (
+	"github.com/anchore/stereoscope/pkg/file"
 	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/anchore/stereoscope/pkg/image/objectstore"
 )
 
 type config struct {
-	Registry           image.RegistryOptions
-	AdditionalMetadata []image.AdditionalMetadata
-	Platform           *image.Platform
+	Registry              image.RegistryOptions
+	AdditionalMetadata    []image.AdditionalMetadata
+	Platform              *image.Platform
+	ReadOptions           []image.ReadOption
+	ObjectStores          map[string]objectstore.Client
+	CacheDir              string
+	DockerStorageRoot     string
+	ContainerdRoot        string
+	ContainerdNamespace   string
+	ContainersStorageRoot string
+	TempDirGenerator      *file.TempDirGenerator
 }
@@ -1,6 +1,10 @@
 package bus
 
-import "github.com/wagoodman/go-partybus"
+import (
+	"github.com/wagoodman/go-partybus"
+
+	"github.com/anchore/stereoscope/pkg/redact"
+)
 
 var publisher partybus.Publisher
 var active bool
@@ -12,8 +16,24 @@ func SetPublisher(p partybus.Publisher) {
 	}
 }
 
+// Publish publishes the given event (if a publisher is set), redacting the event source, value, and error first
+// (which may describe image references or URLs that include credentials, see redact.Redact).
 func Publish(event partybus.Event) {
 	if active {
-		publisher.Publish(event)
+		publisher.Publish(redactEvent(event))
+	}
+}
+
+func redactEvent(event partybus.Event) partybus.Event {
+	if source, ok := event.Source.(string); ok {
+		event.Source = redact.Redact(source)
+	}
+	switch value := event.Value.(type) {
+	case string:
+		event.Value = redact.Redact(value)
+	case error:
+		event.Value = redact.Error(value)
 	}
+	event.Error = redact.Error(event.Error)
+	return event
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/anchore/stereoscope/internal/log"
@@ -76,11 +77,8 @@ func ClientOverUnixSocket() (*client.Client, error) {
 
 	if addr == "" { // in some cases there might not be any config file
 		// we can try guessing; podman CLI does that
-		socketPath := fmt.Sprintf("/run/user/%d/podman/podman.sock", os.Getuid())
-		log.Debugf("no socket address was found. Trying default address: %s", socketPath)
-		_, err := os.Stat(socketPath)
-		if err != nil {
-			log.Debugf("looking for socket file: %v", err)
+		socketPath := findDefaultSocket(defaultSocketPaths(os.Getenv("XDG_RUNTIME_DIR"), os.Getuid()))
+		if socketPath == "" {
 			return nil, ErrNoSocketAddress
 		}
 
@@ -101,6 +99,40 @@ func ClientOverUnixSocket() (*client.Client, error) {
 	return c, err
 }
 
+// defaultSocketPaths returns the well-known podman API socket locations in the order they should be tried. Rootless
+// podman places the socket under the user runtime dir (XDG_RUNTIME_DIR, typically /run/user/<uid>), while rootful
+// podman uses /run/podman.
+func defaultSocketPaths(runtimeDir string, uid int) []string {
+	var paths []string
+	if runtimeDir != "" {
+		paths = append(paths, filepath.Join(runtimeDir, "podman", "podman.sock"))
+	}
+
+	userPath := fmt.Sprintf("/run/user/%d/podman/podman.sock", uid)
+	if len(paths) == 0 || paths[0] != userPath {
+		paths = append(paths, userPath)
+	}
+
+	if uid == 0 {
+		paths = append(paths, "/run/podman/podman.sock")
+	}
+	return paths
+}
+
+// findDefaultSocket returns the first socket path that exists (or an empty string if none exist).
+func findDefaultSocket(paths []string) string {
+	log.Debug("no socket address was found, trying default addresses")
+	for _, socketPath := range paths {
+		log.Debugf("trying socket=%q", socketPath)
+		if _, err := os.Stat(socketPath); err != nil {
+			log.Debugf("looking for socket file: %v", err)
+			continue
+		}
+		return socketPath
+	}
+	return ""
+}
+
 func GetClient() (*client.Client, error) {
 	c, err := ClientOverUnixSocket()
 	if err == nil {
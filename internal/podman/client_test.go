@@ -0,0 +1,65 @@
+package podman
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_defaultSocketPaths(t *testing.T) {
+	tests := []struct {
+		name       string
+		runtimeDir string
+		uid        int
+		want       []string
+	}{
+		{
+			name: "rootless without runtime dir",
+			uid:  1000,
+			want: []string{
+				"/run/user/1000/podman/podman.sock",
+			},
+		},
+		{
+			name:       "rootless with runtime dir",
+			runtimeDir: "/tmp/runtime-1000",
+			uid:        1000,
+			want: []string{
+				"/tmp/runtime-1000/podman/podman.sock",
+				"/run/user/1000/podman/podman.sock",
+			},
+		},
+		{
+			name:       "runtime dir matches default user path",
+			runtimeDir: "/run/user/1000",
+			uid:        1000,
+			want: []string{
+				"/run/user/1000/podman/podman.sock",
+			},
+		},
+		{
+			name: "rootful",
+			uid:  0,
+			want: []string{
+				"/run/user/0/podman/podman.sock",
+				"/run/podman/podman.sock",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, defaultSocketPaths(tt.runtimeDir, tt.uid))
+		})
+	}
+}
+
+func Test_findDefaultSocket(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "podman.sock")
+	assert.NoError(t, os.WriteFile(existing, nil, 0600))
+
+	assert.Equal(t, existing, findDefaultSocket([]string{filepath.Join(dir, "missing.sock"), existing}))
+	assert.Equal(t, "", findDefaultSocket([]string{filepath.Join(dir, "missing.sock")}))
+}
@@ -9,4 +9,16 @@ const (
 	FetchImage      partybus.EventType = "fetch-image-event"
 	ReadImage       partybus.EventType = "read-image-event"
 	ReadLayer       partybus.EventType = "read-layer-event"
+	SquashImage     partybus.EventType = "squash-image-event"
+
+	// LayerDownloadStarted and LayerDownloadCompleted bracket fetching the content of a single layer, both carry the
+	// same byte counter (which is final upon completion).
+	LayerDownloadStarted   partybus.EventType = "layer-download-started-event"
+	LayerDownloadCompleted partybus.EventType = "layer-download-completed-event"
+
+	// TempDirCreated and TempDirRemoved describe the lifecycle of each temp dir (see file.TempDirGenerator), and
+	// TempDirQuotaExceeded is published whenever a temp dir quota is found to be exceeded. All carry a file.TempDirEvent.
+	TempDirCreated       partybus.EventType = "temp-dir-created-event"
+	TempDirRemoved       partybus.EventType = "temp-dir-removed-event"
+	TempDirQuotaExceeded partybus.EventType = "temp-dir-quota-exceeded-event"
 )
@@ -107,3 +107,37 @@ func ParseReadLayer(e partybus.Event) (*image.LayerMetadata, progress.Monitorabl
 
 	return &layerMetadata, prog, nil
 }
+
+func ParseSquashImage(e partybus.Event) (*image.Metadata, progress.Progressable, error) {
+	if err := checkEventType(e.Type, event.SquashImage); err != nil {
+		return nil, nil, err
+	}
+
+	imgMetadata, ok := e.Source.(image.Metadata)
+	if !ok {
+		return nil, nil, newPayloadErr(e.Type, "Source", e.Source)
+	}
+
+	prog, ok := e.Value.(progress.Progressable)
+	if !ok {
+		return nil, nil, newPayloadErr(e.Type, "Value", e.Value)
+	}
+
+	return &imgMetadata, prog, nil
+}
+
+// ParseLayerDownload parses either a event.LayerDownloadStarted or event.LayerDownloadCompleted event.
+func ParseLayerDownload(e partybus.Event) (*image.LayerDownload, error) {
+	if e.Type != event.LayerDownloadStarted {
+		if err := checkEventType(e.Type, event.LayerDownloadCompleted); err != nil {
+			return nil, err
+		}
+	}
+
+	download, ok := e.Value.(image.LayerDownload)
+	if !ok {
+		return nil, newPayloadErr(e.Type, "Value", e.Value)
+	}
+
+	return &download, nil
+}
@@ -0,0 +1,284 @@
+package file
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// POSIXACLAccessXattr and POSIXACLDefaultXattr are the extended attributes holding the access ACL of a file and the
+	// default ACL of a directory (inherited by new files within the directory).
+	POSIXACLAccessXattr  = "system.posix_acl_access"
+	POSIXACLDefaultXattr = "system.posix_acl_default"
+	// NFSv4ACLXattr is the extended attribute holding the NFSv4 ACL of a file.
+	NFSv4ACLXattr = "system.nfs4_acl"
+
+	posixACLVersion   = 2
+	posixACLUndefined = 0xFFFFFFFF
+)
+
+var ErrInvalidACL = errors.New("invalid ACL")
+
+// ACLTag identifies what a POSIX ACL entry applies to.
+type ACLTag string
+
+const (
+	// ACLUserObj, ACLGroupObj, and ACLOther correspond to the owner, group, and other mode bits of the file.
+	ACLUserObj  ACLTag = "user_obj"
+	ACLUser     ACLTag = "user"
+	ACLGroupObj ACLTag = "group_obj"
+	ACLGroup    ACLTag = "group"
+	// ACLMask is the upper bound of the permissions granted by all ACLUser, ACLGroupObj, and ACLGroup entries.
+	ACLMask  ACLTag = "mask"
+	ACLOther ACLTag = "other"
+)
+
+var posixACLTags = map[uint16]ACLTag{
+	0x01: ACLUserObj,
+	0x02: ACLUser,
+	0x04: ACLGroupObj,
+	0x08: ACLGroup,
+	0x10: ACLMask,
+	0x20: ACLOther,
+}
+
+// ACLEntry is a single POSIX ACL entry.
+type ACLEntry struct {
+	Tag ACLTag
+	// ID is the user or group ID for ACLUser and ACLGroup entries (-1 for all other entries)
+	ID int
+	// Perms are the granted permissions as read (4), write (2), and execute (1) bits
+	Perms uint16
+}
+
+// String returns the entry in the short text form used by getfacl (e.g. "user:1000:rw-").
+func (e ACLEntry) String() string {
+	perms := []byte("---")
+	for idx, bit := range []uint16{4, 2, 1} {
+		if e.Perms&bit != 0 {
+			perms[idx] = "rwx"[idx]
+		}
+	}
+	qualifier := ""
+	if e.ID >= 0 {
+		qualifier = strconv.Itoa(e.ID)
+	}
+	tag := strings.TrimSuffix(string(e.Tag), "_obj")
+	return tag + ":" + qualifier + ":" + string(perms)
+}
+
+// ACL is a POSIX ACL (see ParsePOSIXACL).
+type ACL []ACLEntry
+
+// String returns the ACL in the short text form used by getfacl (e.g. "user::rw-,user:1000:r--,group::r--,...").
+func (a ACL) String() string {
+	entries := make([]string, 0, len(a))
+	for _, e := range a {
+		entries = append(entries, e.String())
+	}
+	return strings.Join(entries, ",")
+}
+
+// IsExtended indicates if the ACL grants permissions beyond what is expressed by the mode bits of the file (any named
+// user or group entries).
+func (a ACL) IsExtended() bool {
+	for _, e := range a {
+		if e.Tag != ACLUserObj && e.Tag != ACLGroupObj && e.Tag != ACLOther {
+			return true
+		}
+	}
+	return false
+}
+
+// ParsePOSIXACL decodes the value of a POSIX ACL extended attribute (see POSIXACLAccessXattr and
+// POSIXACLDefaultXattr) as stored by the kernel: a little-endian version header followed by fixed-size entries.
+func ParsePOSIXACL(value []byte) (ACL, error) {
+	if len(value) < 4 || (len(value)-4)%8 != 0 {
+		return nil, fmt.Errorf("%w: unexpected POSIX ACL size=%d", ErrInvalidACL, len(value))
+	}
+	if version := binary.LittleEndian.Uint32(value); version != posixACLVersion {
+		return nil, fmt.Errorf("%w: unsupported POSIX ACL version=%d", ErrInvalidACL, version)
+	}
+
+	acl := make(ACL, 0, (len(value)-4)/8)
+	for offset := 4; offset < len(value); offset += 8 {
+		rawTag := binary.LittleEndian.Uint16(value[offset:])
+		tag, ok := posixACLTags[rawTag]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown POSIX ACL tag=%#x", ErrInvalidACL, rawTag)
+		}
+		entry := ACLEntry{
+			Tag:   tag,
+			ID:    -1,
+			Perms: binary.LittleEndian.Uint16(value[offset+2:]),
+		}
+		if id := binary.LittleEndian.Uint32(value[offset+4:]); (tag == ACLUser || tag == ACLGroup) && id != posixACLUndefined {
+			entry.ID = int(id)
+		}
+		acl = append(acl, entry)
+	}
+	return acl, nil
+}
+
+// Encode returns the ACL as the value of a POSIX ACL extended attribute (the inverse of ParsePOSIXACL).
+func (a ACL) Encode() []byte {
+	value := make([]byte, 4, 4+8*len(a))
+	binary.LittleEndian.PutUint32(value, posixACLVersion)
+	for _, e := range a {
+		var raw [8]byte
+		for tag, name := range posixACLTags {
+			if name == e.Tag {
+				binary.LittleEndian.PutUint16(raw[0:], tag)
+			}
+		}
+		binary.LittleEndian.PutUint16(raw[2:], e.Perms)
+		id := uint32(posixACLUndefined)
+		if e.ID >= 0 {
+			id = uint32(e.ID)
+		}
+		binary.LittleEndian.PutUint32(raw[4:], id)
+		value = append(value, raw[:]...)
+	}
+	return value
+}
+
+// parsePOSIXACLText decodes the text form of a POSIX ACL as found within the "SCHILY.acl.access" and
+// "SCHILY.acl.default" PAX records written by star and bsdtar (e.g. "user::rw-,user:lisa:r--:1001,group::r--"), where
+// named entries carry the numeric ID as an optional fourth field.
+func parsePOSIXACLText(text string) (ACL, error) {
+	var acl ACL
+	for _, field := range strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == '\n' }) {
+		parts := strings.Split(strings.TrimSpace(field), ":")
+		if len(parts) < 3 || len(parts[2]) != 3 {
+			return nil, fmt.Errorf("%w: unexpected POSIX ACL entry=%q", ErrInvalidACL, field)
+		}
+
+		entry := ACLEntry{ID: -1}
+		for idx, bit := range []uint16{4, 2, 1} {
+			switch parts[2][idx] {
+			case "rwx"[idx]:
+				entry.Perms |= bit
+			case '-':
+			default:
+				return nil, fmt.Errorf("%w: unexpected POSIX ACL permissions=%q", ErrInvalidACL, parts[2])
+			}
+		}
+
+		qualifier := parts[1]
+		if len(parts) > 3 {
+			qualifier = parts[3]
+		}
+		switch {
+		case parts[0] == "mask":
+			entry.Tag = ACLMask
+		case parts[0] == "other":
+			entry.Tag = ACLOther
+		case parts[0] == "user" && parts[1] == "":
+			entry.Tag = ACLUserObj
+		case parts[0] == "group" && parts[1] == "":
+			entry.Tag = ACLGroupObj
+		case parts[0] == "user" || parts[0] == "group":
+			id, err := strconv.Atoi(qualifier)
+			if err != nil || id < 0 {
+				return nil, fmt.Errorf("%w: no numeric ID for POSIX ACL entry=%q", ErrInvalidACL, field)
+			}
+			entry.Tag = ACLTag(parts[0])
+			entry.ID = id
+		default:
+			return nil, fmt.Errorf("%w: unknown POSIX ACL tag=%q", ErrInvalidACL, parts[0])
+		}
+		acl = append(acl, entry)
+	}
+	return acl, nil
+}
+
+// NFSv4ACEType is the type of an NFSv4 access control entry.
+type NFSv4ACEType string
+
+const (
+	NFSv4Allow NFSv4ACEType = "allow"
+	NFSv4Deny  NFSv4ACEType = "deny"
+	NFSv4Audit NFSv4ACEType = "audit"
+	NFSv4Alarm NFSv4ACEType = "alarm"
+)
+
+var nfsv4ACETypes = []NFSv4ACEType{NFSv4Allow, NFSv4Deny, NFSv4Audit, NFSv4Alarm}
+
+// NFSv4ACE is a single NFSv4 access control entry (see RFC 7530 section 6.2.1).
+type NFSv4ACE struct {
+	Type NFSv4ACEType
+	// Flags are the ACE flags (e.g. inheritance flags)
+	Flags uint32
+	// AccessMask are the permission bits of the ACE (e.g. 0x1 for read data)
+	AccessMask uint32
+	// Who is the principal the ACE applies to (e.g. "OWNER@", "EVERYONE@", or "user@domain")
+	Who string
+}
+
+// ParseNFSv4ACL decodes the value of the NFSv4 ACL extended attribute (see NFSv4ACLXattr), which is XDR encoded.
+func ParseNFSv4ACL(value []byte) ([]NFSv4ACE, error) {
+	r := xdrReader{buf: value}
+	count, err := r.uint32()
+	if err != nil {
+		return nil, err
+	}
+	// every entry is at least 16 bytes, which bounds the allocation for malformed values
+	if int64(count)*16 > int64(len(value)) {
+		return nil, fmt.Errorf("%w: NFSv4 ACL entry count=%d exceeds the value size", ErrInvalidACL, count)
+	}
+
+	aces := make([]NFSv4ACE, 0, count)
+	for idx := uint32(0); idx < count; idx++ {
+		var fields [3]uint32
+		for f := range fields {
+			if fields[f], err = r.uint32(); err != nil {
+				return nil, err
+			}
+		}
+		if int(fields[0]) >= len(nfsv4ACETypes) {
+			return nil, fmt.Errorf("%w: unknown NFSv4 ACE type=%d", ErrInvalidACL, fields[0])
+		}
+		who, err := r.string()
+		if err != nil {
+			return nil, err
+		}
+		aces = append(aces, NFSv4ACE{
+			Type:       nfsv4ACETypes[fields[0]],
+			Flags:      fields[1],
+			AccessMask: fields[2],
+			Who:        who,
+		})
+	}
+	return aces, nil
+}
+
+// xdrReader decodes the XDR primitives used by NFSv4 ACLs (big-endian, padded to four bytes).
+type xdrReader struct {
+	buf []byte
+}
+
+func (r *xdrReader) uint32() (uint32, error) {
+	if len(r.buf) < 4 {
+		return 0, fmt.Errorf("%w: truncated NFSv4 ACL", ErrInvalidACL)
+	}
+	v := binary.BigEndian.Uint32(r.buf)
+	r.buf = r.buf[4:]
+	return v, nil
+}
+
+func (r *xdrReader) string() (string, error) {
+	length, err := r.uint32()
+	if err != nil {
+		return "", err
+	}
+	padded := (int(length) + 3) &^ 3
+	if int(length) > len(r.buf) || padded > len(r.buf) {
+		return "", fmt.Errorf("%w: truncated NFSv4 ACL", ErrInvalidACL)
+	}
+	s := string(r.buf[:length])
+	r.buf = r.buf[padded:]
+	return s, nil
+}
@@ -0,0 +1,127 @@
+package file
+
+import (
+	"archive/tar"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// posixACLValue encodes the given (tag, perms, id) entries as a POSIX ACL extended attribute value.
+func posixACLValue(entries ...[3]uint32) []byte {
+	value := make([]byte, 4)
+	binary.LittleEndian.PutUint32(value, 2)
+	for _, e := range entries {
+		raw := make([]byte, 8)
+		binary.LittleEndian.PutUint16(raw[0:], uint16(e[0]))
+		binary.LittleEndian.PutUint16(raw[2:], uint16(e[1]))
+		binary.LittleEndian.PutUint32(raw[4:], e[2])
+		value = append(value, raw...)
+	}
+	return value
+}
+
+func TestParsePOSIXACL(t *testing.T) {
+	value := posixACLValue(
+		[3]uint32{0x01, 6, posixACLUndefined},
+		[3]uint32{0x02, 4, 1000},
+		[3]uint32{0x04, 4, posixACLUndefined},
+		[3]uint32{0x08, 7, 50},
+		[3]uint32{0x10, 5, posixACLUndefined},
+		[3]uint32{0x20, 0, posixACLUndefined},
+	)
+	acl, err := ParsePOSIXACL(value)
+	require.NoError(t, err)
+	assert.Equal(t, ACL{
+		{Tag: ACLUserObj, ID: -1, Perms: 6},
+		{Tag: ACLUser, ID: 1000, Perms: 4},
+		{Tag: ACLGroupObj, ID: -1, Perms: 4},
+		{Tag: ACLGroup, ID: 50, Perms: 7},
+		{Tag: ACLMask, ID: -1, Perms: 5},
+		{Tag: ACLOther, ID: -1, Perms: 0},
+	}, acl)
+	assert.Equal(t, "user::rw-,user:1000:r--,group::r--,group:50:rwx,mask::r-x,other::---", acl.String())
+	assert.True(t, acl.IsExtended())
+	assert.Equal(t, value, acl.Encode())
+
+	minimal, err := ParsePOSIXACL(posixACLValue([3]uint32{0x01, 6, 0}, [3]uint32{0x04, 4, 0}, [3]uint32{0x20, 4, 0}))
+	require.NoError(t, err)
+	assert.False(t, minimal.IsExtended())
+
+	for _, invalid := range [][]byte{
+		nil,
+		{2, 0, 0, 0, 1},
+		{1, 0, 0, 0},
+		posixACLValue([3]uint32{0x40, 0, 0}),
+	} {
+		_, err := ParsePOSIXACL(invalid)
+		assert.True(t, errors.Is(err, ErrInvalidACL), "value=%v err=%v", invalid, err)
+	}
+}
+
+func TestParseNFSv4ACL(t *testing.T) {
+	be := func(v uint32) []byte {
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, v)
+		return b
+	}
+	var value []byte
+	value = append(value, be(2)...)
+	value = append(value, be(0)...)
+	value = append(value, be(0x3)...)
+	value = append(value, be(0x120081)...)
+	value = append(value, be(6)...)
+	value = append(value, []byte("OWNER@\x00\x00")...)
+	value = append(value, be(1)...)
+	value = append(value, be(0)...)
+	value = append(value, be(0x2)...)
+	value = append(value, be(9)...)
+	value = append(value, []byte("EVERYONE@\x00\x00\x00")...)
+
+	aces, err := ParseNFSv4ACL(value)
+	require.NoError(t, err)
+	assert.Equal(t, []NFSv4ACE{
+		{Type: NFSv4Allow, Flags: 0x3, AccessMask: 0x120081, Who: "OWNER@"},
+		{Type: NFSv4Deny, AccessMask: 0x2, Who: "EVERYONE@"},
+	}, aces)
+
+	_, err = ParseNFSv4ACL(value[:len(value)-4])
+	assert.True(t, errors.Is(err, ErrInvalidACL))
+	_, err = ParseNFSv4ACL(be(1 << 30))
+	assert.True(t, errors.Is(err, ErrInvalidACL))
+}
+
+func TestMetadata_ACLs(t *testing.T) {
+	access := posixACLValue([3]uint32{0x01, 6, 0}, [3]uint32{0x02, 6, 1000}, [3]uint32{0x04, 4, 0}, [3]uint32{0x10, 6, 0}, [3]uint32{0x20, 0, 0})
+	header := tar.Header{
+		Name:     "etc/shadow",
+		Typeflag: tar.TypeReg,
+		Mode:     0640,
+		PAXRecords: map[string]string{
+			paxXattrPrefix + POSIXACLAccessXattr: string(access),
+			// the text form is only used when the extended attribute is not recorded
+			"SCHILY.acl.access":  "user::rwx,other::rwx",
+			"SCHILY.acl.default": "user::rwx,user:alice:r-x:1001,group::r-x,mask::r-x,other::---",
+		},
+	}
+	metadata := NewMetadata(header, 0, nil)
+
+	acl, err := metadata.AccessACL()
+	require.NoError(t, err)
+	assert.Equal(t, "user::rw-,user:1000:rw-,group::r--,mask::rw-,other::---", acl.String())
+
+	defaults, err := metadata.DefaultACL()
+	require.NoError(t, err)
+	assert.Equal(t, "user::rwx,user:1001:r-x,group::r-x,mask::r-x,other::---", defaults.String())
+
+	aces, err := metadata.NFSv4ACL()
+	require.NoError(t, err)
+	assert.Nil(t, aces)
+
+	none, err := Metadata{}.AccessACL()
+	require.NoError(t, err)
+	assert.Nil(t, none)
+}
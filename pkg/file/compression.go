@@ -0,0 +1,91 @@
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/ulikunitz/xz"
+)
+
+// Compression is the compression format of a stream (as detected from the leading magic bytes).
+type Compression string
+
+const (
+	CompressionNone Compression = "none"
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
+	CompressionXz   Compression = "xz"
+)
+
+var compressionMagic = []struct {
+	compression Compression
+	magic       []byte
+}{
+	{CompressionGzip, []byte{0x1f, 0x8b}},
+	{CompressionZstd, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{CompressionXz, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+}
+
+// compressionSniffSize is the number of leading bytes needed to detect any supported compression format.
+const compressionSniffSize = 6
+
+// DetectCompression returns the compression format indicated by the given leading bytes of a stream. Anything that is
+// not recognized is considered to be uncompressed (e.g. a plain tar).
+func DetectCompression(header []byte) Compression {
+	for _, c := range compressionMagic {
+		if bytes.HasPrefix(header, c.magic) {
+			return c.compression
+		}
+	}
+	return CompressionNone
+}
+
+// NewDecompressingReadCloser detects the compression format of the given stream (see DetectCompression) and returns a
+// reader for the decompressed stream along with the detected format. Uncompressed streams are returned as-is. Closing
+// the returned reader closes the given stream.
+func NewDecompressingReadCloser(rc io.ReadCloser) (io.ReadCloser, Compression, error) {
+	buffered := bufio.NewReader(rc)
+	// short streams (e.g. an empty layer) are reported as io.EOF, which are simply not compressed
+	header, peekErr := buffered.Peek(compressionSniffSize)
+	if peekErr != nil && peekErr != io.EOF {
+		_ = rc.Close()
+		return nil, "", fmt.Errorf("unable to detect compression: %w", peekErr)
+	}
+
+	compression := DetectCompression(header)
+	var reader io.Reader
+	var err error
+	switch compression {
+	case CompressionGzip:
+		reader, err = gzip.NewReader(buffered)
+	case CompressionZstd:
+		reader, err = NewZstdReadCloser(ioutil.NopCloser(buffered))
+	case CompressionXz:
+		reader, err = xz.NewReader(buffered)
+	default:
+		reader = buffered
+	}
+	if err != nil {
+		_ = rc.Close()
+		return nil, "", fmt.Errorf("unable to create %s reader: %w", compression, err)
+	}
+	return &decompressingReadCloser{Reader: reader, compressed: rc}, compression, nil
+}
+
+// decompressingReadCloser reads a decompressed stream, closing the decompressor (if needed) and the underlying
+// compressed stream when closed.
+type decompressingReadCloser struct {
+	io.Reader
+	compressed io.ReadCloser
+}
+
+func (d *decompressingReadCloser) Close() error {
+	if closer, ok := d.Reader.(io.Closer); ok {
+		_ = closer.Close()
+	}
+	return d.compressed.Close()
+}
@@ -0,0 +1,73 @@
+package file
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ulikunitz/xz"
+)
+
+func compressTestContent(t *testing.T, compression Compression, content []byte) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	var w io.WriteCloser
+	var err error
+	switch compression {
+	case CompressionGzip:
+		w = gzip.NewWriter(buf)
+	case CompressionZstd:
+		w, err = zstd.NewWriter(buf)
+	case CompressionXz:
+		w, err = xz.NewWriter(buf)
+	default:
+		return content
+	}
+	require.NoError(t, err)
+	_, err = w.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestNewDecompressingReadCloser(t *testing.T) {
+	content := bytes.Repeat([]byte("layer content "), 100)
+	tests := []struct {
+		compression Compression
+		content     []byte
+	}{
+		{compression: CompressionNone, content: content},
+		{compression: CompressionGzip, content: content},
+		{compression: CompressionZstd, content: content},
+		{compression: CompressionXz, content: content},
+		// shorter than the magic bytes of any format
+		{compression: CompressionNone, content: []byte("tar")},
+		{compression: CompressionNone, content: []byte{}},
+	}
+	for _, test := range tests {
+		t.Run(string(test.compression), func(t *testing.T) {
+			blob := compressTestContent(t, test.compression, test.content)
+			assert.Equal(t, test.compression, DetectCompression(blob))
+
+			reader, detected, err := NewDecompressingReadCloser(ioutil.NopCloser(bytes.NewReader(blob)))
+			require.NoError(t, err)
+			defer reader.Close()
+			assert.Equal(t, test.compression, detected)
+
+			actual, err := ioutil.ReadAll(reader)
+			require.NoError(t, err)
+			assert.Equal(t, test.content, actual)
+		})
+	}
+}
+
+func TestNewDecompressingReadCloser_Corrupt(t *testing.T) {
+	// gzip magic bytes followed by an invalid header
+	_, _, err := NewDecompressingReadCloser(ioutil.NopCloser(bytes.NewReader([]byte{0x1f, 0x8b, 0x00, 0x00})))
+	assert.Error(t, err)
+}
@@ -0,0 +1,191 @@
+package file
+
+import (
+	"crypto"
+	// register the hashes most commonly used for file digests (see NewMultiDigester)
+	_ "crypto/md5"
+	_ "crypto/sha1"
+	"crypto/sha256"
+	_ "crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrDigestMismatch indicates that content does not match the expected digest.
+var ErrDigestMismatch = fmt.Errorf("digest mismatch")
+
+const sha256DigestPrefix = "sha256:"
+
+// VerifyDigest checks that the file at the given path matches the given digest (e.g. "sha256:abc..."). Only sha256
+// digests can be verified, any other algorithm is assumed to match.
+func VerifyDigest(path, digest string) error {
+	if !strings.HasPrefix(digest, sha256DigestPrefix) {
+		return nil
+	}
+
+	fh, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, fh); err != nil {
+		return fmt.Errorf("unable to read path=%q: %w", path, err)
+	}
+
+	if actual := fmt.Sprintf("%s%x", sha256DigestPrefix, hasher.Sum(nil)); actual != digest {
+		return fmt.Errorf("%w: path=%q expected=%q actual=%q", ErrDigestMismatch, path, digest, actual)
+	}
+	return nil
+}
+
+// WriteVerified writes the given content to the destination path only if the content matches the given digest. The
+// content is first written to a uniquely named, process-scoped partial file next to the destination, which is then
+// atomically renamed into place. This way no reader of the destination path ever observes partially written or
+// corrupt content, even when multiple processes share the same directory.
+func WriteVerified(dst, digest string, content io.Reader) (err error) {
+	dir, name := filepath.Split(dst)
+	partial, err := os.CreateTemp(dir, fmt.Sprintf("%s.%d-*.partial", name, os.Getpid()))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = partial.Close()
+			_ = os.Remove(partial.Name())
+		}
+	}()
+
+	hasher := sha256.New()
+	if _, err = io.Copy(io.MultiWriter(partial, hasher), content); err != nil {
+		return err
+	}
+
+	if err = partial.Close(); err != nil {
+		return err
+	}
+
+	if strings.HasPrefix(digest, sha256DigestPrefix) {
+		if actual := fmt.Sprintf("%s%x", sha256DigestPrefix, hasher.Sum(nil)); actual != digest {
+			return fmt.Errorf("%w: expected=%q actual=%q", ErrDigestMismatch, digest, actual)
+		}
+	}
+
+	return os.Rename(partial.Name(), dst)
+}
+
+// Digest returns the sha256 digest (e.g. "sha256:abc...") of all content from the given reader.
+func Digest(reader io.Reader) (string, error) {
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, reader); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s%x", sha256DigestPrefix, hasher.Sum(nil)), nil
+}
+
+// DigestHash is a hash algorithm used for file digests. Every crypto.Hash is a DigestHash, as is XXH64 (which has no
+// crypto.Hash value).
+type DigestHash interface {
+	// Available reports whether the algorithm is linked into the binary.
+	Available() bool
+	// New returns a new hash.Hash calculating the digest.
+	New() hash.Hash
+	// String returns the name of the algorithm (e.g. "SHA-256").
+	String() string
+}
+
+var _ DigestHash = crypto.SHA256
+
+// DigestAlgorithm returns the name of the given hash algorithm as used within digests (e.g. "sha256" for
+// crypto.SHA256, as in "sha256:abc...", or "xxh64" for XXH64).
+func DigestAlgorithm(h DigestHash) string {
+	return strings.ToLower(strings.ReplaceAll(h.String(), "-", ""))
+}
+
+// MultiDigester computes digests for multiple hash algorithms in a single pass over all content written to it.
+type MultiDigester struct {
+	hashes  []DigestHash
+	hashers []hash.Hash
+	writer  io.Writer
+}
+
+// NewMultiDigester returns a MultiDigester for the given hash algorithms (duplicates are ignored). An error is returned
+// for any algorithm that is not linked into the binary (md5, sha1, sha256, sha512 variants, and XXH64 always are).
+func NewMultiDigester(hashes ...DigestHash) (*MultiDigester, error) {
+	d := &MultiDigester{}
+	seen := make(map[DigestHash]struct{})
+	var writers []io.Writer
+	for _, h := range hashes {
+		if _, ok := seen[h]; ok {
+			continue
+		}
+		seen[h] = struct{}{}
+		if !h.Available() {
+			return nil, fmt.Errorf("unavailable digest algorithm: %s", h)
+		}
+		hasher := h.New()
+		d.hashes = append(d.hashes, h)
+		d.hashers = append(d.hashers, hasher)
+		writers = append(writers, hasher)
+	}
+	d.writer = io.MultiWriter(writers...)
+	return d, nil
+}
+
+func (d *MultiDigester) Write(p []byte) (int, error) {
+	return d.writer.Write(p)
+}
+
+// Digests returns the digest (e.g. "sha256:abc...") of all content written so far, keyed by algorithm name (see
+// DigestAlgorithm).
+func (d *MultiDigester) Digests() map[string]string {
+	digests := make(map[string]string, len(d.hashes))
+	for i, h := range d.hashes {
+		algorithm := DigestAlgorithm(h)
+		digests[algorithm] = fmt.Sprintf("%s:%x", algorithm, d.hashers[i].Sum(nil))
+	}
+	return digests
+}
+
+// digestVerifyingReadCloser verifies the digest of all content read once the underlying reader is exhausted.
+type digestVerifyingReadCloser struct {
+	reader io.ReadCloser
+	digest string
+	hasher hash.Hash
+}
+
+// NewDigestVerifyingReadCloser returns a ReadCloser that verifies all content read from the given ReadCloser against
+// the given digest (e.g. "sha256:abc..."). Once the content has been read in full, an error wrapping ErrDigestMismatch
+// is returned instead of io.EOF if the content does not match. Only sha256 digests can be verified, any other
+// algorithm results in the unmodified ReadCloser.
+func NewDigestVerifyingReadCloser(reader io.ReadCloser, digest string) io.ReadCloser {
+	if !strings.HasPrefix(digest, sha256DigestPrefix) {
+		return reader
+	}
+	return &digestVerifyingReadCloser{
+		reader: reader,
+		digest: digest,
+		hasher: sha256.New(),
+	}
+}
+
+func (d *digestVerifyingReadCloser) Read(p []byte) (int, error) {
+	n, err := d.reader.Read(p)
+	d.hasher.Write(p[:n])
+	if errors.Is(err, io.EOF) {
+		if actual := fmt.Sprintf("%s%x", sha256DigestPrefix, d.hasher.Sum(nil)); actual != d.digest {
+			return n, fmt.Errorf("%w: expected=%q actual=%q", ErrDigestMismatch, d.digest, actual)
+		}
+	}
+	return n, err
+}
+
+func (d *digestVerifyingReadCloser) Close() error {
+	return d.reader.Close()
+}
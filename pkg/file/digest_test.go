@@ -0,0 +1,190 @@
+package file
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sha256Digest(content string) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(content)))
+}
+
+func TestWriteVerified(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		digest  string
+		wantErr require.ErrorAssertionFunc
+	}{
+		{
+			name:    "matching digest",
+			content: "layer content",
+			digest:  sha256Digest("layer content"),
+			wantErr: require.NoError,
+		},
+		{
+			name:    "unverifiable digest algorithm",
+			content: "layer content",
+			digest:  "sha512:abc",
+			wantErr: require.NoError,
+		},
+		{
+			name:    "mismatched digest",
+			content: "corrupt content",
+			digest:  sha256Digest("layer content"),
+			wantErr: func(t require.TestingT, err error, _ ...interface{}) {
+				require.ErrorIs(t, err, ErrDigestMismatch)
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			dst := filepath.Join(dir, "layer.tar")
+
+			writeErr := WriteVerified(dst, test.digest, strings.NewReader(test.content))
+			test.wantErr(t, writeErr)
+
+			// no partial files should remain, regardless of the outcome
+			entries, err := os.ReadDir(dir)
+			require.NoError(t, err)
+			for _, entry := range entries {
+				assert.NotContains(t, entry.Name(), ".partial")
+			}
+
+			if writeErr != nil {
+				assert.NoFileExists(t, dst)
+				return
+			}
+			contents, err := os.ReadFile(dst)
+			require.NoError(t, err)
+			assert.Equal(t, test.content, string(contents))
+			assert.NoError(t, VerifyDigest(dst, test.digest))
+		})
+	}
+}
+
+func TestVerifyDigest(t *testing.T) {
+	dst := filepath.Join(t.TempDir(), "layer.tar")
+	require.NoError(t, os.WriteFile(dst, []byte("partial"), 0600))
+
+	assert.NoError(t, VerifyDigest(dst, sha256Digest("partial")))
+	assert.ErrorIs(t, VerifyDigest(dst, sha256Digest("partial but complete")), ErrDigestMismatch)
+	assert.Error(t, VerifyDigest(filepath.Join(t.TempDir(), "missing.tar"), sha256Digest("partial")))
+}
+
+func TestNewDigestVerifyingReadCloser(t *testing.T) {
+	content := []byte("some content")
+	tests := []struct {
+		name    string
+		digest  string
+		wantErr bool
+	}{
+		{
+			name:   "matching content",
+			digest: sha256Digest(string(content)),
+		},
+		{
+			name:    "mismatched content",
+			digest:  sha256Digest("other content"),
+			wantErr: true,
+		},
+		{
+			name:   "unsupported algorithm",
+			digest: "sha512:abc",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reader := NewDigestVerifyingReadCloser(ioutil.NopCloser(bytes.NewReader(content)), test.digest)
+			actual, err := ioutil.ReadAll(reader)
+			require.NoError(t, reader.Close())
+			if test.wantErr {
+				assert.ErrorIs(t, err, ErrDigestMismatch)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, content, actual)
+		})
+	}
+}
+
+func TestMultiDigester(t *testing.T) {
+	d, err := NewMultiDigester(crypto.SHA256, crypto.SHA1, crypto.MD5, crypto.SHA256)
+	require.NoError(t, err)
+	_, err = io.Copy(d, strings.NewReader("content"))
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{
+		"sha256": sha256Digest("content"),
+		"sha1":   fmt.Sprintf("sha1:%x", sha1.Sum([]byte("content"))),
+		"md5":    fmt.Sprintf("md5:%x", md5.Sum([]byte("content"))),
+	}, d.Digests())
+
+	_, err = NewMultiDigester(crypto.BLAKE2b_256)
+	assert.Error(t, err)
+}
+
+func TestMultiDigester_XXH64(t *testing.T) {
+	d, err := NewMultiDigester(XXH64, crypto.SHA256, XXH64)
+	require.NoError(t, err)
+	_, err = io.Copy(d, strings.NewReader("hello world"))
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{
+		"sha256": sha256Digest("hello world"),
+		"xxh64":  "xxh64:45ab6734b21e6968",
+	}, d.Digests())
+}
+
+func TestXXH64(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected uint64
+	}{
+		{input: "", expected: 0xef46db3751d8e999},
+		{input: "a", expected: 0xd24ec4f1a98c6e5b},
+		{input: "abc", expected: 0x44bc2cf5ad770999},
+		{input: "hello world", expected: 0x45ab6734b21e6968},
+		// longer than a single 32 byte stripe
+		{input: "Nobody inspects the spammish repetition", expected: 0xfbcea83c8a378bf1},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			h := newXXH64()
+			_, err := h.Write([]byte(test.input))
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, h.Sum64())
+			assert.Equal(t, fmt.Sprintf("%016x", test.expected), fmt.Sprintf("%x", h.Sum(nil)))
+
+			// the result does not depend on how the content is split across writes
+			h.Reset()
+			for i := 0; i < len(test.input); i++ {
+				_, err = h.Write([]byte{test.input[i]})
+				require.NoError(t, err)
+			}
+			assert.Equal(t, test.expected, h.Sum64())
+		})
+	}
+}
+
+func TestDigestAlgorithm(t *testing.T) {
+	assert.Equal(t, "sha256", DigestAlgorithm(crypto.SHA256))
+	assert.Equal(t, "sha1", DigestAlgorithm(crypto.SHA1))
+	assert.Equal(t, "md5", DigestAlgorithm(crypto.MD5))
+	assert.Equal(t, "sha512/256", DigestAlgorithm(crypto.SHA512_256))
+	assert.Equal(t, "xxh64", DigestAlgorithm(XXH64))
+}
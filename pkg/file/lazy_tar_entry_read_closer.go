@@ -0,0 +1,82 @@
+package file
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var _ io.ReadCloser = (*LazyTarEntryReadCloser)(nil)
+
+// LazyTarEntryReadCloser is a "lazy" read closer for a single entry within a tar stream. The stream is only opened
+// (and advanced to the entry) upon the first Read() call, which allows for deferring expensive fetches (e.g. from a
+// remote registry) until the content is actually needed.
+type LazyTarEntryReadCloser struct {
+	// open provides a fresh tar stream each time it is called
+	open func() (io.ReadCloser, error)
+	// sequence is the nth header in the tar stream to read the contents of
+	sequence int64
+	// stream is the active tar stream
+	stream io.ReadCloser
+	// reader is the tar reader positioned at the entry contents
+	reader io.Reader
+}
+
+// NewLazyTarEntryReadCloser creates a new LazyTarEntryReadCloser for the nth tar header (the sequence) in the stream
+// provided by the given function.
+func NewLazyTarEntryReadCloser(open func() (io.ReadCloser, error), sequence int64) *LazyTarEntryReadCloser {
+	return &LazyTarEntryReadCloser{
+		open:     open,
+		sequence: sequence,
+	}
+}
+
+// Read implements the io.Reader interface for the tar entry, opening the tar stream upon the first invocation.
+func (d *LazyTarEntryReadCloser) Read(b []byte) (int, error) {
+	if err := d.openEntry(); err != nil {
+		return 0, err
+	}
+	return d.reader.Read(b)
+}
+
+// Close implements the io.Closer interface for the underlying tar stream.
+func (d *LazyTarEntryReadCloser) Close() error {
+	if d.stream == nil {
+		return nil
+	}
+	err := d.stream.Close()
+	d.stream = nil
+	d.reader = nil
+	return err
+}
+
+func (d *LazyTarEntryReadCloser) openEntry() error {
+	if d.reader != nil {
+		return nil
+	}
+
+	stream, err := d.open()
+	if err != nil {
+		return fmt.Errorf("unable to open tar stream: %w", err)
+	}
+
+	tarReader := tar.NewReader(stream)
+	var sequence int64 = -1
+	for sequence < d.sequence {
+		sequence++
+		_, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			_ = stream.Close()
+			return fmt.Errorf("tar entry sequence=%d not found", d.sequence)
+		}
+		if err != nil {
+			_ = stream.Close()
+			return err
+		}
+	}
+
+	d.stream = stream
+	d.reader = tarReader
+	return nil
+}
@@ -0,0 +1,54 @@
+package file
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLazyTarEntryReadCloser(t *testing.T) {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, entry := range []struct {
+		name     string
+		contents string
+	}{
+		{"a.txt", "first"},
+		{"b.txt", "second"},
+	} {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: entry.name, Size: int64(len(entry.contents)), Mode: 0644, Typeflag: tar.TypeReg}))
+		_, err := tw.Write([]byte(entry.contents))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+
+	var opened int
+	open := func() (io.ReadCloser, error) {
+		opened++
+		return ioutil.NopCloser(bytes.NewReader(buf.Bytes())), nil
+	}
+
+	first := NewLazyTarEntryReadCloser(open, 0)
+	second := NewLazyTarEntryReadCloser(open, 1)
+	missing := NewLazyTarEntryReadCloser(open, 5)
+	assert.Equal(t, 0, opened, "stream should not be opened until the first read")
+
+	contents, err := ioutil.ReadAll(second)
+	require.NoError(t, err)
+	assert.Equal(t, "second", string(contents))
+	require.NoError(t, second.Close())
+
+	contents, err = ioutil.ReadAll(first)
+	require.NoError(t, err)
+	assert.Equal(t, "first", string(contents))
+	require.NoError(t, first.Close())
+
+	_, err = ioutil.ReadAll(missing)
+	assert.Error(t, err)
+	assert.Equal(t, 3, opened)
+}
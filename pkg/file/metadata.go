@@ -2,11 +2,12 @@ package file
 
 import (
 	"archive/tar"
+	"fmt"
 	"io"
 	"os"
-	"path"
 	"path/filepath"
 
+	"github.com/anchore/stereoscope/pkg/file/tarutil"
 	"github.com/sylabs/squashfs"
 )
 
@@ -29,11 +30,24 @@ type Metadata struct {
 	IsDir    bool
 	Mode     os.FileMode
 	MIMEType string
+	// Xattrs are the extended attributes for the file (e.g. "security.capability", "security.selinux", or "user.*")
+	Xattrs map[string][]byte
+	// Devmajor and Devminor are the device numbers of character and block devices
+	Devmajor int64
+	Devminor int64
+	// Digest is the sha256 digest of the file contents (e.g. "sha256:abc..."), which is only populated for regular
+	// files when digests have been requested or computed (empty otherwise)
+	Digest string
+	// Digests are the digests of the file contents for every requested algorithm (e.g. "sha1" -> "sha1:abc..."), keyed
+	// by algorithm name (see DigestAlgorithm). This is only populated for regular files when digests have been requested.
+	Digests map[string]string
+	// Windows is the Windows specific metadata of entries within Windows layer tars (nil otherwise)
+	Windows *WindowsMetadata
 }
 
 func NewMetadata(header tar.Header, sequence int64, content io.Reader) Metadata {
 	return Metadata{
-		Path:          path.Clean(DirSeparator + header.Name),
+		Path:          tarutil.CleanPath(header.Name),
 		TarHeaderName: header.Name,
 		TarSequence:   sequence,
 		TypeFlag:      header.Typeflag,
@@ -44,9 +58,50 @@ func NewMetadata(header tar.Header, sequence int64, content io.Reader) Metadata
 		GroupID:       header.Gid,
 		IsDir:         header.FileInfo().IsDir(),
 		MIMEType:      MIMEType(content),
+		Xattrs:        XattrsFromHeader(header),
+		Devmajor:      header.Devmajor,
+		Devminor:      header.Devminor,
+		Windows:       WindowsMetadataFromHeader(header),
 	}
 }
 
+// AccessACL returns the decoded POSIX access ACL of the file (nil if the file has no access ACL). Note that the mode
+// bits alone may understate the effective permissions of files with an extended ACL (see ACL.IsExtended).
+func (m Metadata) AccessACL() (ACL, error) {
+	return m.posixACL(POSIXACLAccessXattr)
+}
+
+// DefaultACL returns the decoded POSIX default ACL of the directory (nil if the directory has no default ACL), which
+// is inherited by all files created within the directory.
+func (m Metadata) DefaultACL() (ACL, error) {
+	return m.posixACL(POSIXACLDefaultXattr)
+}
+
+// NFSv4ACL returns the decoded NFSv4 ACL of the file (nil if the file has no NFSv4 ACL).
+func (m Metadata) NFSv4ACL() ([]NFSv4ACE, error) {
+	value, ok := m.Xattrs[NFSv4ACLXattr]
+	if !ok {
+		return nil, nil
+	}
+	aces, err := ParseNFSv4ACL(value)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode %s for path=%q: %w", NFSv4ACLXattr, m.Path, err)
+	}
+	return aces, nil
+}
+
+func (m Metadata) posixACL(xattr string) (ACL, error) {
+	value, ok := m.Xattrs[xattr]
+	if !ok {
+		return nil, nil
+	}
+	acl, err := ParsePOSIXACL(value)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode %s for path=%q: %w", xattr, m.Path, err)
+	}
+	return acl, nil
+}
+
 // NewMetadataFromSquashFSFile populates Metadata for the entry at path, with details from f.
 func NewMetadataFromSquashFSFile(path string, f *squashfs.File) (Metadata, error) {
 	fi, err := f.Stat()
@@ -4,6 +4,7 @@
 package file
 
 import (
+	"archive/tar"
 	"io"
 	"os"
 	"strings"
@@ -43,3 +44,31 @@ func TestFileMetadataFromTar(t *testing.T) {
 		t.Errorf("diff: %s", d)
 	}
 }
+
+func TestNewMetadata_Xattrs(t *testing.T) {
+	header := tar.Header{
+		Name:     "usr/bin/ping",
+		Typeflag: tar.TypeReg,
+		Format:   tar.FormatPAX,
+		PAXRecords: map[string]string{
+			"SCHILY.xattr.security.capability": "\x01\x00\x00\x02\x00\x20\x00\x00",
+			"SCHILY.xattr.security.selinux":    "system_u:object_r:ping_exec_t:s0",
+			"SCHILY.xattr.user.comment":        "hello",
+			"LIBARCHIVE.creationtime":          "1",
+		},
+	}
+
+	metadata := NewMetadata(header, 0, nil)
+	expected := map[string][]byte{
+		"security.capability": []byte("\x01\x00\x00\x02\x00\x20\x00\x00"),
+		"security.selinux":    []byte("system_u:object_r:ping_exec_t:s0"),
+		"user.comment":        []byte("hello"),
+	}
+	for _, d := range deep.Equal(expected, metadata.Xattrs) {
+		t.Errorf("diff: %s", d)
+	}
+
+	if without := NewMetadata(tar.Header{Name: "etc/hosts", Typeflag: tar.TypeReg}, 0, nil); without.Xattrs != nil {
+		t.Errorf("expected no xattrs, got %+v", without.Xattrs)
+	}
+}
@@ -7,38 +7,62 @@ import (
 	"github.com/gabriel-vasile/mimetype"
 )
 
+// DefaultMIMETypeSniffSize is the number of leading bytes of a file that are used to detect the MIME type by default.
+const DefaultMIMETypeSniffSize = 3072
+
+// MIMETypeDetector classifies file contents by MIME type given the leading bytes of a file (the prefix may be the
+// entire file for small files). An empty string should be returned when the MIME type is unknown.
+type MIMETypeDetector interface {
+	DetectMIMEType(prefix []byte) string
+}
+
+// MIMETypeDetectorFunc is an adapter to allow the use of an ordinary function as a MIMETypeDetector.
+type MIMETypeDetectorFunc func(prefix []byte) string
+
+// DetectMIMEType calls f(prefix).
+func (f MIMETypeDetectorFunc) DetectMIMEType(prefix []byte) string {
+	return f(prefix)
+}
+
+// DefaultMIMETypeDetector is the MIMETypeDetector used unless another detector is configured, which recognizes a broad
+// set of binary and text formats (e.g. "application/x-executable" or "text/plain"). If the MIME type could not be
+// determined then a MIME type of "application/octet-stream" is returned.
+var DefaultMIMETypeDetector MIMETypeDetector = mimetypeDetector{}
+
+type mimetypeDetector struct{}
+
+func (mimetypeDetector) DetectMIMEType(prefix []byte) string {
+	// extract the string mimetype and ignore aux information (e.g. 'text/plain; charset=utf-8' -> 'text/plain')
+	return strings.Split(mimetype.Detect(prefix).String(), ";")[0]
+}
+
 // MIMEType attempts to guess at the MIME type of a file given the contents. If there is no contents, then an empty
 // string is returned. If the MIME type could not be determined and the contents are not empty, then a MIME type
 // of "application/octet-stream" is returned.
 func MIMEType(reader io.Reader) string {
-	if reader == nil {
+	return DetectMIMEType(reader, DefaultMIMETypeDetector, DefaultMIMETypeSniffSize)
+}
+
+// DetectMIMEType reads up to sniffSize bytes from the given reader (DefaultMIMETypeSniffSize if not positive) and
+// classifies them with the given detector. If there is no contents, then an empty string is returned.
+func DetectMIMEType(reader io.Reader, detector MIMETypeDetector, sniffSize int) string {
+	if reader == nil || detector == nil {
 		return ""
 	}
+	if sniffSize <= 0 {
+		sniffSize = DefaultMIMETypeSniffSize
+	}
 
-	s := sizer{reader: reader}
-
-	var mTypeStr string
-	mType, err := mimetype.DetectReader(&s)
-	if err == nil {
-		// extract the string mimetype and ignore aux information (e.g. 'text/plain; charset=utf-8' -> 'text/plain')
-		mTypeStr = strings.Split(mType.String(), ";")[0]
+	prefix := make([]byte, sniffSize)
+	n, err := io.ReadFull(reader, prefix)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return ""
 	}
 
 	// we may have a reader that is not nil but the observed contents was empty
-	if s.size == 0 {
+	if n == 0 {
 		return ""
 	}
 
-	return mTypeStr
-}
-
-type sizer struct {
-	reader io.Reader
-	size   int64
-}
-
-func (s *sizer) Read(p []byte) (int, error) {
-	n, err := s.reader.Read(p)
-	s.size += int64(n)
-	return n, err
+	return detector.DetectMIMEType(prefix[:n])
 }
@@ -49,3 +49,62 @@ func Test_MIMEType(t *testing.T) {
 		})
 	}
 }
+
+func Test_DetectMIMEType(t *testing.T) {
+	var observed []byte
+	detector := MIMETypeDetectorFunc(func(prefix []byte) string {
+		observed = prefix
+		return "application/x-custom"
+	})
+
+	tests := []struct {
+		name      string
+		fixture   io.Reader
+		detector  MIMETypeDetector
+		sniffSize int
+		expected  string
+		observed  string
+	}{
+		{
+			name:      "sniff size bounds the prefix",
+			fixture:   strings.NewReader("#!/bin/sh\necho hello"),
+			detector:  detector,
+			sniffSize: 4,
+			expected:  "application/x-custom",
+			observed:  "#!/b",
+		},
+		{
+			name:      "short contents",
+			fixture:   strings.NewReader("hi"),
+			detector:  detector,
+			sniffSize: 4,
+			expected:  "application/x-custom",
+			observed:  "hi",
+		},
+		{
+			name:     "no contents",
+			fixture:  strings.NewReader(""),
+			detector: detector,
+			expected: "",
+		},
+		{
+			name:     "no detector",
+			fixture:  strings.NewReader("hello"),
+			expected: "",
+		},
+		{
+			name:     "default detector",
+			fixture:  strings.NewReader("hello world"),
+			detector: DefaultMIMETypeDetector,
+			expected: "text/plain",
+			observed: "",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			observed = nil
+			assert.Equal(t, test.expected, DetectMIMEType(test.fixture, test.detector, test.sniffSize))
+			assert.Equal(t, test.observed, string(observed))
+		})
+	}
+}
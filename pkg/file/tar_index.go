@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+
+	"github.com/anchore/stereoscope/pkg/file/tarutil"
 )
 
 type TarIndexVisitor func(TarIndexEntry) error
@@ -11,12 +13,15 @@ type TarIndexVisitor func(TarIndexEntry) error
 // TarIndex is a tar reader capable of O(1) fetching of entry contents after the first read.
 type TarIndex struct {
 	indexByName map[string][]TarIndexEntry
+	indexByPath map[string][]TarIndexEntry
+	entries     []TarIndexEntry
 }
 
 // NewTarIndex creates a new TarIndex that is already indexed.
 func NewTarIndex(tarFilePath string, onIndex TarIndexVisitor) (*TarIndex, error) {
 	t := &TarIndex{
 		indexByName: make(map[string][]TarIndexEntry),
+		indexByPath: make(map[string][]TarIndexEntry),
 	}
 	tarFileHandle, err := os.Open(tarFilePath)
 	if err != nil {
@@ -40,7 +45,7 @@ func NewTarIndex(tarFilePath string, onIndex TarIndexVisitor) (*TarIndex, error)
 			header:       entry.Header,
 			seekPosition: entrySeekPosition,
 		}
-		t.indexByName[entry.Header.Name] = append(t.indexByName[entry.Header.Name], indexEntry)
+		t.add(indexEntry)
 
 		// run though the visitors
 		if onIndex != nil {
@@ -55,6 +60,26 @@ func NewTarIndex(tarFilePath string, onIndex TarIndexVisitor) (*TarIndex, error)
 	return t, IterateTar(tarFileHandle, visitor)
 }
 
+// NewTarIndexFromEntries creates a TarIndex from entries that have already been indexed (e.g. a persisted index, see
+// NewTarIndexEntry) without reading the tar again. Entries are expected to be in the order they appear within the tar.
+func NewTarIndexFromEntries(entries []TarIndexEntry) *TarIndex {
+	t := &TarIndex{
+		indexByName: make(map[string][]TarIndexEntry),
+		indexByPath: make(map[string][]TarIndexEntry),
+	}
+	for _, entry := range entries {
+		t.add(entry)
+	}
+	return t
+}
+
+func (t *TarIndex) add(entry TarIndexEntry) {
+	t.indexByName[entry.header.Name] = append(t.indexByName[entry.header.Name], entry)
+	cleanPath := tarutil.CleanPath(entry.header.Name)
+	t.indexByPath[cleanPath] = append(t.indexByPath[cleanPath], entry)
+	t.entries = append(t.entries, entry)
+}
+
 // EntriesByName fetches all TarFileEntries for the given tar header name.
 func (t *TarIndex) EntriesByName(name string) ([]TarFileEntry, error) {
 	if indexes, exists := t.indexByName[name]; exists {
@@ -66,3 +91,21 @@ func (t *TarIndex) EntriesByName(name string) ([]TarFileEntry, error) {
 	}
 	return nil, nil
 }
+
+// EntriesByPath fetches all TarFileEntries for the given absolute path. Unlike EntriesByName, this matches regardless
+// of how the tar header name was written (e.g. "./etc/passwd", "etc/passwd", and "/etc/passwd" are all "/etc/passwd").
+func (t *TarIndex) EntriesByPath(p string) ([]TarFileEntry, error) {
+	if indexes, exists := t.indexByPath[tarutil.CleanPath(p)]; exists {
+		entries := make([]TarFileEntry, len(indexes))
+		for i, index := range indexes {
+			entries[i] = index.ToTarFileEntry()
+		}
+		return entries, nil
+	}
+	return nil, nil
+}
+
+// Entries returns all index entries in the order they were found within the tar.
+func (t *TarIndex) Entries() []TarIndexEntry {
+	return t.entries
+}
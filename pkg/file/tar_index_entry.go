@@ -5,6 +5,7 @@ import (
 	"io"
 )
 
+// TarIndexEntry is the location of a single tar entry's contents within a tar file.
 type TarIndexEntry struct {
 	path         string
 	sequence     int64
@@ -12,6 +13,17 @@ type TarIndexEntry struct {
 	seekPosition int64
 }
 
+// NewTarIndexEntry returns the entry for previously indexed tar content (see TarIndexEntry.Offset), where the entry
+// contents are the header.Size bytes at the given offset within the tar file at the given path.
+func NewTarIndexEntry(tarFilePath string, sequence int64, header tar.Header, offset int64) TarIndexEntry {
+	return TarIndexEntry{
+		path:         tarFilePath,
+		sequence:     sequence,
+		header:       header,
+		seekPosition: offset,
+	}
+}
+
 func (t *TarIndexEntry) ToTarFileEntry() TarFileEntry {
 	return TarFileEntry{
 		Sequence: t.sequence,
@@ -23,3 +35,23 @@ func (t *TarIndexEntry) ToTarFileEntry() TarFileEntry {
 func (t *TarIndexEntry) Open() io.ReadCloser {
 	return newLazyBoundedReadCloser(t.path, t.seekPosition, t.header.Size)
 }
+
+// Header returns the tar header for the entry.
+func (t *TarIndexEntry) Header() tar.Header {
+	return t.header
+}
+
+// Sequence returns the nth header position of the entry within the tar.
+func (t *TarIndexEntry) Sequence() int64 {
+	return t.sequence
+}
+
+// Offset returns the byte offset of the entry contents from the start of the tar file.
+func (t *TarIndexEntry) Offset() int64 {
+	return t.seekPosition
+}
+
+// Size returns the size of the entry contents in bytes.
+func (t *TarIndexEntry) Size() int64 {
+	return t.header.Size
+}
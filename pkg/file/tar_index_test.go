@@ -11,6 +11,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/anchore/stereoscope/pkg/file/tarutil"
 )
 
 var ti *TarIndex
@@ -107,6 +109,71 @@ func TestIndexedTarReader_DuplicateEntries(t *testing.T) {
 
 }
 
+func TestTarIndex_EntriesByPath(t *testing.T) {
+	tempFile, err := ioutil.TempFile(t.TempDir(), "stereoscope-tar-index-path-fixture-XXXXXX")
+	if err != nil {
+		t.Fatalf("could not create tempfile: %+v", err)
+	}
+	tarWriter := tar.NewWriter(tempFile)
+	addFileToTarWriter(t, "./etc/passwd", "root:x:0:0", tarWriter)
+	addFileToTarWriter(t, "etc/group", "root:x:0:", tarWriter)
+	tarWriter.Close()
+	tempFile.Close()
+
+	index, err := NewTarIndex(tempFile.Name(), nil)
+	if err != nil {
+		t.Fatal("could not index tar:", err)
+	}
+
+	expected := map[string]string{
+		"/etc/passwd":  "root:x:0:0",
+		"etc/passwd":   "root:x:0:0",
+		"./etc/passwd": "root:x:0:0",
+		"/etc/group":   "root:x:0:",
+	}
+	for p, expectedContents := range expected {
+		entries, err := index.EntriesByPath(p)
+		if err != nil || len(entries) != 1 {
+			t.Fatalf("unexpected entries for path=%q: %+v (err=%+v)", p, entries, err)
+		}
+		actualContents, err := ioutil.ReadAll(entries[0].Reader)
+		if err != nil {
+			t.Fatalf("could not read from file reader: %+v", err)
+		}
+		if string(actualContents) != expectedContents {
+			t.Errorf("unexpected contents for path=%q: '%s'", p, string(actualContents))
+		}
+	}
+
+	if entries, _ := index.EntriesByPath("/etc/shadow"); len(entries) != 0 {
+		t.Errorf("unexpected entries for missing path: %+v", entries)
+	}
+
+	// the offsets should allow for reading the contents directly from the tar
+	fh, err := os.Open(tempFile.Name())
+	if err != nil {
+		t.Fatalf("could not open tar: %+v", err)
+	}
+	defer fh.Close()
+
+	indexEntries := index.Entries()
+	if len(indexEntries) != 2 {
+		t.Fatalf("unexpected number of entries: %d", len(indexEntries))
+	}
+	for idx, entry := range indexEntries {
+		if entry.Sequence() != int64(idx) {
+			t.Errorf("unexpected sequence for %q: %d", entry.Header().Name, entry.Sequence())
+		}
+		contents := make([]byte, entry.Size())
+		if _, err := fh.ReadAt(contents, entry.Offset()); err != nil {
+			t.Fatalf("could not read at offset: %+v", err)
+		}
+		if expected[tarutil.CleanPath(entry.Header().Name)] != string(contents) {
+			t.Errorf("unexpected contents at offset for %q: '%s'", entry.Header().Name, string(contents))
+		}
+	}
+}
+
 func duplicateEntryTarballFixture(t *testing.T) *os.File {
 	tempFile, err := ioutil.TempFile("", "stereoscope-dup-tar-entry-fixture-XXXXXX")
 	if err != nil {
@@ -149,3 +216,43 @@ func addFileToTarWriter(t *testing.T, path, contents string, tarWriter *tar.Writ
 		t.Fatalf("failed to write contents for file=%q: %+v", path, err)
 	}
 }
+
+func TestNewTarIndexFromEntries(t *testing.T) {
+	fixture, err := ioutil.TempFile(t.TempDir(), "stereoscope-tar-index-entries-fixture-XXXXXX")
+	if err != nil {
+		t.Fatalf("could not create tempfile: %+v", err)
+	}
+	tarWriter := tar.NewWriter(fixture)
+	addFileToTarWriter(t, "path/file-1.txt", "first file\n", tarWriter)
+	addFileToTarWriter(t, "path/branch/two/file-2.txt", "second file\n", tarWriter)
+	tarWriter.Close()
+	fixture.Close()
+
+	original, err := NewTarIndex(fixture.Name(), nil)
+	if err != nil {
+		t.Fatal("could not index tar:", err)
+	}
+
+	// rebuild the index from only the persisted details of each entry
+	var entries []TarIndexEntry
+	for _, entry := range original.Entries() {
+		entries = append(entries, NewTarIndexEntry(fixture.Name(), entry.Sequence(), entry.Header(), entry.Offset()))
+	}
+	restored := NewTarIndexFromEntries(entries)
+
+	if len(restored.Entries()) != len(original.Entries()) {
+		t.Fatalf("unexpected number of entries: %d != %d", len(restored.Entries()), len(original.Entries()))
+	}
+
+	entry, err := restored.EntriesByPath("/path/branch/two/file-2.txt")
+	if err != nil || len(entry) != 1 {
+		t.Fatalf("unexpected entries: %+v (err=%+v)", entry, err)
+	}
+	actualContents, err := ioutil.ReadAll(entry[0].Reader)
+	if err != nil {
+		t.Fatalf("could not read from file reader: %+v", err)
+	}
+	if string(actualContents) != "second file\n" {
+		t.Errorf("unexpected contents: '%s'", string(actualContents))
+	}
+}
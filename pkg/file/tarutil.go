@@ -2,18 +2,20 @@ package file
 
 import (
 	"archive/tar"
+	"context"
+	"crypto/sha256"
 	"fmt"
 	"io"
 	"os"
-	"path/filepath"
 
 	"github.com/anchore/stereoscope/internal/log"
+	"github.com/anchore/stereoscope/pkg/file/tarutil"
 	"github.com/pkg/errors"
 )
 
 const perFileReadLimit = 2 * GB
 
-var ErrTarStopIteration = fmt.Errorf("halt iterating tar")
+var ErrTarStopIteration = tarutil.ErrStopIteration
 
 // tarFile is a ReadCloser of a tar file on disk.
 type tarFile struct {
@@ -22,14 +24,10 @@ type tarFile struct {
 }
 
 // TarFileEntry represents the header, contents, and list position of an entry within a tar file.
-type TarFileEntry struct {
-	Sequence int64
-	Header   tar.Header
-	Reader   io.Reader
-}
+type TarFileEntry = tarutil.Entry
 
 // TarFileVisitor is a visitor function meant to be used in conjunction with the IterateTar.
-type TarFileVisitor func(TarFileEntry) error
+type TarFileVisitor = tarutil.Visitor
 
 // ErrFileNotFound returned from ReaderFromTar if a file is not found in the given archive.
 type ErrFileNotFound struct {
@@ -42,36 +40,15 @@ func (e *ErrFileNotFound) Error() string {
 
 // IterateTar is a function that reads across a tar and invokes a visitor function for each entry discovered. The iterator
 // stops when there are no more entries to read, if there is an error in the underlying reader or visitor function,
-// or if the visitor function returns a ErrTarStopIteration sentinel error.
+// or if the visitor function returns a ErrTarStopIteration sentinel error (see tarutil.Iterate).
 func IterateTar(reader io.Reader, visitor TarFileVisitor) error {
-	tarReader := tar.NewReader(reader)
-	var sequence int64 = -1
-	for {
-		sequence++
-
-		hdr, err := tarReader.Next()
-		if errors.Is(err, io.EOF) {
-			break
-		}
-		if err != nil {
-			return err
-		}
-		if hdr == nil {
-			continue
-		}
+	return tarutil.Iterate(reader, visitor)
+}
 
-		if err := visitor(TarFileEntry{
-			Sequence: sequence,
-			Header:   *hdr,
-			Reader:   tarReader,
-		}); err != nil {
-			if errors.Is(err, ErrTarStopIteration) {
-				return nil
-			}
-			return fmt.Errorf("failed to visit tar entry=%q : %w", hdr.Name, err)
-		}
-	}
-	return nil
+// IterateTarWithContext is the same as IterateTar, however, iteration stops (returning the context error) once the
+// given context is done.
+func IterateTarWithContext(ctx context.Context, reader io.Reader, visitor TarFileVisitor) error {
+	return tarutil.IterateWithContext(ctx, reader, visitor)
 }
 
 // ReaderFromTar returns a io.ReadCloser for the Path within a tar file.
@@ -125,8 +102,34 @@ func MetadataFromTar(reader io.ReadCloser, tarPath string) (Metadata, error) {
 
 // UntarToDirectory writes the contents of the given tar reader to the given destination
 func UntarToDirectory(reader io.Reader, dst string) error {
+	_, err := UntarToDirectoryWithOptions(reader, dst, UntarOptions{})
+	return err
+}
+
+// UntarToDirectoryWithOptions writes the contents of the given tar reader to the given destination, additionally
+// applying any file metadata requested by the given options. Metadata that cannot be applied (e.g. xattrs on a
+// filesystem without xattr support, or ownership when running unprivileged) is recorded on the returned report
+// instead of failing the extraction, unless the options indicate to be strict.
+func UntarToDirectoryWithOptions(reader io.Reader, dst string, options UntarOptions) (*UntarReport, error) {
+	report := &UntarReport{}
+	collisions := newCaseCollisionTracker(options.CaseCollisions)
+	// files are the paths on disk of the regular files written so far, by cleaned entry name (for hardlinks)
+	files := make(map[string]string)
+	var dirs []untarDir
 	visitor := func(entry TarFileEntry) error {
-		target := filepath.Join(dst, entry.Header.Name)
+		target := tarutil.SafeJoin(dst, entry.Header.Name)
+		if untarWrites(entry.Header, options) {
+			name, ok, err := collisions.resolve(entry.Header.Name, report)
+			if err != nil || !ok {
+				return err
+			}
+			target = tarutil.SafeJoin(dst, name)
+		}
+		if options.Symlinks != SymlinksIgnored {
+			if err := ensureWithinRoot(dst, target); err != nil {
+				return err
+			}
+		}
 
 		switch entry.Header.Typeflag {
 		case tar.TypeDir:
@@ -135,15 +138,30 @@ func UntarToDirectory(reader io.Reader, dst string) error {
 					return err
 				}
 			}
+			if options.PreservePermissions {
+				dirs = append(dirs, untarDir{target: target, mode: untarPermissions(entry.Header)})
+			}
 
 		case tar.TypeReg:
+			if options.Symlinks != SymlinksIgnored {
+				// an existing symlink is replaced by the entry, it is never written through
+				if err := removeSymlink(target); err != nil {
+					return err
+				}
+			}
 			f, err := os.OpenFile(target, os.O_CREATE|os.O_RDWR, os.FileMode(entry.Header.Mode))
 			if err != nil {
 				return err
 			}
 
+			var w io.Writer = f
+			hasher := sha256.New()
+			if options.Verify {
+				w = io.MultiWriter(f, hasher)
+			}
+
 			// limit the reader on each file read to prevent decompression bomb attacks
-			numBytes, err := io.Copy(f, io.LimitReader(entry.Reader, perFileReadLimit))
+			numBytes, err := io.Copy(w, io.LimitReader(entry.Reader, perFileReadLimit))
 			if numBytes >= perFileReadLimit || errors.Is(err, io.EOF) {
 				return fmt.Errorf("zip read limit hit (potential decompression bomb attack)")
 			}
@@ -154,9 +172,48 @@ func UntarToDirectory(reader io.Reader, dst string) error {
 			if err = f.Close(); err != nil {
 				log.Errorf("failed to close file during untar of path=%q: %w", f.Name(), err)
 			}
+
+			if options.Verify {
+				digest := fmt.Sprintf("%s%x", sha256DigestPrefix, hasher.Sum(nil))
+				if err := verifyUntarredFile(target, digest, options, report); err != nil {
+					return err
+				}
+			}
+			files[tarutil.CleanPath(entry.Header.Name)] = target
+		case tar.TypeLink:
+			if !options.Hardlinks {
+				return nil
+			}
+			// metadata is not applied to hardlinks, since the metadata is shared with the linked file
+			return untarHardlink(target, entry.Header, files, report)
+		case tar.TypeSymlink:
+			if options.Symlinks == SymlinksIgnored {
+				return nil
+			}
+			// metadata is not applied to symlinks, since applying xattrs would follow the link
+			return untarSymlink(target, entry.Header, options, report)
+		default:
+			return nil
 		}
-		return nil
+
+		return applyUntarMetadata(target, entry.Header, options, report)
 	}
 
-	return IterateTar(reader, visitor)
+	if err := IterateTar(reader, visitor); err != nil {
+		return report, err
+	}
+	return report, applyUntarDirPermissions(dirs, options, report)
+}
+
+// untarWrites indicates if the given tar entry is written to disk when extracting with the given options.
+func untarWrites(header tar.Header, options UntarOptions) bool {
+	switch header.Typeflag {
+	case tar.TypeDir, tar.TypeReg:
+		return true
+	case tar.TypeSymlink:
+		return options.Symlinks != SymlinksIgnored
+	case tar.TypeLink:
+		return options.Hardlinks
+	}
+	return false
 }
@@ -0,0 +1,109 @@
+package tarutil
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrStopIteration may be returned from a Visitor to stop iterating the tar without an error.
+var ErrStopIteration = fmt.Errorf("halt iterating tar")
+
+// Entry represents the header, contents, and list position of an entry within a tar file.
+type Entry struct {
+	Sequence int64
+	Header   tar.Header
+	// Reader is the entry contents, which is only valid until the visitor returns
+	Reader io.Reader
+}
+
+// Visitor is a visitor function meant to be used in conjunction with Iterate.
+type Visitor func(Entry) error
+
+// Limits describes upper bounds enforced while iterating a tar (see IterateWithLimits). A zero value for any field
+// means that there is no limit.
+type Limits struct {
+	// MaxEntries is the maximum number of headers that may be read
+	MaxEntries int64
+	// MaxEntrySize is the maximum size in bytes a single entry may claim in its header
+	MaxEntrySize int64
+	// MaxTotalSize is the maximum sum of all entry sizes in bytes
+	MaxTotalSize int64
+}
+
+// ErrLimitExceeded is returned from IterateWithLimits when the tar exceeds one of the configured limits.
+type ErrLimitExceeded struct {
+	Limit string
+	Value int64
+	Max   int64
+}
+
+func (e *ErrLimitExceeded) Error() string {
+	return fmt.Sprintf("tar limit exceeded (%s=%d, max=%d)", e.Limit, e.Value, e.Max)
+}
+
+// Iterate reads across a tar and invokes the visitor function for each entry discovered. The iterator stops when there
+// are no more entries to read, if there is an error in the underlying reader or visitor function, or if the visitor
+// function returns the ErrStopIteration sentinel error.
+func Iterate(reader io.Reader, visitor Visitor) error {
+	return IterateWithContext(context.Background(), reader, visitor)
+}
+
+// IterateWithContext is the same as Iterate, however, iteration stops (returning the context error) once the given
+// context is done.
+func IterateWithContext(ctx context.Context, reader io.Reader, visitor Visitor) error {
+	tarReader := tar.NewReader(reader)
+	var sequence int64 = -1
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		sequence++
+
+		hdr, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if hdr == nil {
+			continue
+		}
+
+		if err := visitor(Entry{
+			Sequence: sequence,
+			Header:   *hdr,
+			Reader:   tarReader,
+		}); err != nil {
+			if errors.Is(err, ErrStopIteration) {
+				return nil
+			}
+			return fmt.Errorf("failed to visit tar entry=%q : %w", hdr.Name, err)
+		}
+	}
+	return nil
+}
+
+// IterateWithLimits is the same as Iterate, but stops with a ErrLimitExceeded error as soon as any of the given limits
+// are exceeded (before the offending entry is visited).
+func IterateWithLimits(reader io.Reader, limits Limits, visitor Visitor) error {
+	var entries, totalSize int64
+	return Iterate(reader, func(entry Entry) error {
+		entries++
+		totalSize += entry.Header.Size
+
+		switch {
+		case limits.MaxEntries > 0 && entries > limits.MaxEntries:
+			return &ErrLimitExceeded{Limit: "entries", Value: entries, Max: limits.MaxEntries}
+		case limits.MaxEntrySize > 0 && entry.Header.Size > limits.MaxEntrySize:
+			return &ErrLimitExceeded{Limit: "entry-size", Value: entry.Header.Size, Max: limits.MaxEntrySize}
+		case limits.MaxTotalSize > 0 && totalSize > limits.MaxTotalSize:
+			return &ErrLimitExceeded{Limit: "total-size", Value: totalSize, Max: limits.MaxTotalSize}
+		}
+
+		return visitor(entry)
+	})
+}
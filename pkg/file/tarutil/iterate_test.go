@@ -0,0 +1,117 @@
+package tarutil
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestTar(t *testing.T, entries map[string]string) *bytes.Reader {
+	t.Helper()
+	var names []string
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, name := range names {
+		contents := entries[name]
+		if err := tw.WriteHeader(&tar.Header{Name: name, Size: int64(len(contents)), Mode: 0644, Typeflag: tar.TypeReg}); err != nil {
+			t.Fatalf("unable to write header: %+v", err)
+		}
+		if _, err := tw.Write([]byte(contents)); err != nil {
+			t.Fatalf("unable to write contents: %+v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("unable to close tar: %+v", err)
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+func TestIterateWithLimits(t *testing.T) {
+	entries := map[string]string{
+		"a.txt": "12345",
+		"b.txt": "1234567890",
+	}
+
+	tests := []struct {
+		name      string
+		limits    Limits
+		wantLimit string
+		wantSeen  int
+	}{
+		{
+			name:     "no limits",
+			wantSeen: 2,
+		},
+		{
+			name:      "max entries",
+			limits:    Limits{MaxEntries: 1},
+			wantLimit: "entries",
+			wantSeen:  1,
+		},
+		{
+			name:      "max entry size",
+			limits:    Limits{MaxEntrySize: 8},
+			wantLimit: "entry-size",
+			wantSeen:  1,
+		},
+		{
+			name:      "max total size",
+			limits:    Limits{MaxTotalSize: 12},
+			wantLimit: "total-size",
+			wantSeen:  1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var seen int
+			err := IterateWithLimits(newTestTar(t, entries), test.limits, func(Entry) error {
+				seen++
+				return nil
+			})
+
+			assert.Equal(t, test.wantSeen, seen)
+			if test.wantLimit == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var limitErr *ErrLimitExceeded
+			if assert.True(t, errors.As(err, &limitErr)) {
+				assert.Equal(t, test.wantLimit, limitErr.Limit)
+			}
+		})
+	}
+}
+
+func TestIterateWithContext(t *testing.T) {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Typeflag: tar.TypeReg}))
+	}
+	require.NoError(t, tw.Close())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var visited []string
+	err := IterateWithContext(ctx, bytes.NewReader(buf.Bytes()), func(entry Entry) error {
+		visited = append(visited, entry.Header.Name)
+		if entry.Header.Name == "b.txt" {
+			cancel()
+		}
+		return nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, []string{"a.txt", "b.txt"}, visited)
+}
@@ -0,0 +1,21 @@
+package tarutil
+
+import (
+	"path"
+	"path/filepath"
+)
+
+// CleanPath normalizes a tar header name into an absolute, cleaned path (e.g. "./a/../b/" becomes "/b"). Relative
+// elements can never resolve above the root (e.g. "../../etc/passwd" becomes "/etc/passwd").
+func CleanPath(name string) string {
+	return path.Clean("/" + name)
+}
+
+// SafeJoin joins the given tar header name to the destination directory, such that the result is always within the
+// destination directory: the name is cleaned first (see CleanPath), so absolute names and "../" traversal are clamped
+// to the destination directory instead of escaping it (e.g. "../../etc/passwd" joined to "/dst" is "/dst/etc/passwd").
+// Note: symlinks already on disk are not considered, so the result may still resolve outside of the destination
+// directory when written through an existing symlink.
+func SafeJoin(dst, name string) string {
+	return filepath.Join(dst, filepath.FromSlash(CleanPath(name)))
+}
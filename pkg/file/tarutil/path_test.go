@@ -0,0 +1,35 @@
+//go:build !windows
+// +build !windows
+
+package tarutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSafeJoin(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry string
+		want  string
+	}{
+		{name: "relative entry", entry: "a/b.txt", want: "/dst/a/b.txt"},
+		{name: "absolute entry", entry: "/a/b.txt", want: "/dst/a/b.txt"},
+		{name: "traversal is contained", entry: "../../etc/passwd", want: "/dst/etc/passwd"},
+		{name: "root entry", entry: "./", want: "/dst"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, SafeJoin("/dst", test.entry))
+		})
+	}
+}
+
+func TestCleanPath(t *testing.T) {
+	assert.Equal(t, "/b", CleanPath("./a/../b/"))
+	assert.Equal(t, "/", CleanPath("../.."))
+	assert.Equal(t, "/usr/bin", CleanPath("usr/bin"))
+	assert.Equal(t, "/etc/passwd", CleanPath("../../etc/passwd"))
+}
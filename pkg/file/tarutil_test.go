@@ -4,6 +4,8 @@
 package file
 
 import (
+	"archive/tar"
+	"bytes"
 	"crypto/sha256"
 	"fmt"
 	"io"
@@ -15,6 +17,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const (
@@ -179,3 +182,70 @@ func fileExists(t testing.TB, filename string) bool {
 	}
 	return !info.IsDir()
 }
+
+func TestUntarToDirectoryWithOptions_Verify(t *testing.T) {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "file.txt", Size: 8, Mode: 0644, Typeflag: tar.TypeReg}))
+	_, err := tw.Write([]byte("contents"))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+
+	dst := t.TempDir()
+	report, err := UntarToDirectoryWithOptions(buf, dst, UntarOptions{Verify: true})
+	require.NoError(t, err)
+	assert.False(t, report.HasDiscrepancies())
+
+	contents, err := ioutil.ReadFile(filepath.Join(dst, "file.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "contents", string(contents))
+}
+
+func TestVerifyUntarredFile(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "file.txt")
+	require.NoError(t, ioutil.WriteFile(target, []byte("corrupted"), 0644))
+	expected := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("contents")))
+
+	tests := []struct {
+		name    string
+		digest  string
+		options UntarOptions
+		wantErr bool
+		want    int
+	}{
+		{
+			name:   "matching content",
+			digest: fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("corrupted"))),
+		},
+		{
+			name:   "discrepancies are reported",
+			digest: expected,
+			want:   1,
+		},
+		{
+			name:    "discrepancies fail in strict mode",
+			digest:  expected,
+			options: UntarOptions{Strict: true},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			report := &UntarReport{}
+			err := verifyUntarredFile(target, test.digest, test.options, report)
+			if test.wantErr {
+				var discrepancy ExtractionDiscrepancy
+				require.ErrorAs(t, err, &discrepancy)
+				assert.ErrorIs(t, err, ErrDigestMismatch)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, report.Discrepancies, test.want)
+			for _, d := range report.Discrepancies {
+				assert.Equal(t, target, d.Path)
+				assert.Equal(t, test.digest, d.Expected)
+				assert.ErrorIs(t, d, ErrDigestMismatch)
+			}
+		})
+	}
+}
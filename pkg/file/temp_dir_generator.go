@@ -1,65 +1,285 @@
 package file
 
 import (
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/hashicorp/go-multierror"
+	"github.com/wagoodman/go-partybus"
+
+	"github.com/anchore/stereoscope/internal/bus"
+	"github.com/anchore/stereoscope/pkg/event"
 )
 
+// ErrTempDirQuotaExceeded indicates that the contents of the temp dirs exceed the quota of a generator (see
+// WithTempDirQuota).
+var ErrTempDirQuotaExceeded = errors.New("temp dir quota exceeded")
+
+// TempDirGenerator creates (and later deletes) scratch directories, both directly and through child generators, all
+// of which are nested within a single root temp dir per generator. Generators may optionally bound the contents of
+// all of their temp dirs (see WithTempDirQuota), and publish lifecycle events for every temp dir created or removed
+// (see event.TempDirCreated, event.TempDirRemoved, and event.TempDirQuotaExceeded).
 type TempDirGenerator struct {
-	rootPrefix   string
+	lock       sync.Mutex
+	rootPrefix string
+	// parentDir is where the root temp dir is created (the system temp dir when empty)
+	parentDir    string
 	rootLocation string
-	children     []*TempDirGenerator
+	// directories are the temp dirs created within the root temp dir (in creation order)
+	directories []string
+	parent      *TempDirGenerator
+	children    []*TempDirGenerator
+	quota       TempDirQuota
+}
+
+// TempDirQuota bounds the contents of all temp dirs of a generator (including the temp dirs of all child generators).
+// A zero value for either limit means that aspect is unbounded.
+type TempDirQuota struct {
+	// MaxBytes is the maximum combined size of all files
+	MaxBytes int64
+	// MaxFiles is the maximum number of files (and directories) within the temp dirs
+	MaxFiles int
+}
+
+// TempDirUsage describes the contents of all temp dirs of a generator.
+type TempDirUsage struct {
+	Bytes int64
+	Files int
+}
+
+// TempDirEvent is the payload for the event.TempDirCreated, event.TempDirRemoved, and event.TempDirQuotaExceeded
+// events.
+type TempDirEvent struct {
+	// Prefix is the name of the generator the temp dir belongs to
+	Prefix string
+	// Path is the temp dir created or removed (or the root temp dir for quota events)
+	Path string
+	// Usage is the usage at the time the quota was exceeded (only for quota events)
+	Usage TempDirUsage
+	// Err is the reason the temp dir could not be removed or the quota violation (if any)
+	Err error
 }
 
-func NewTempDirGenerator(name string) *TempDirGenerator {
-	return &TempDirGenerator{
+// TempDirGeneratorOption configures a TempDirGenerator.
+type TempDirGeneratorOption func(*TempDirGenerator)
+
+// WithTempDirQuota bounds the contents of all temp dirs of the generator (and all of its child generators). New temp
+// dirs are not created while the quota is exceeded (see TempDirGenerator.CheckQuota).
+func WithTempDirQuota(quota TempDirQuota) TempDirGeneratorOption {
+	return func(t *TempDirGenerator) {
+		t.quota = quota
+	}
+}
+
+func NewTempDirGenerator(name string, options ...TempDirGeneratorOption) *TempDirGenerator {
+	gen := &TempDirGenerator{
 		rootPrefix: name,
 	}
+	for _, option := range options {
+		if option != nil {
+			option(gen)
+		}
+	}
+	return gen
 }
 
 func (t *TempDirGenerator) getOrCreateRootLocation() (string, error) {
 	if t.rootLocation == "" {
-		location, err := os.MkdirTemp("", t.rootPrefix+"-")
+		if t.parentDir != "" {
+			if err := os.MkdirAll(t.parentDir, 0755); err != nil {
+				return "", fmt.Errorf("unable to create temp dir parent=%q: %w", t.parentDir, err)
+			}
+		}
+		// the process ID is included to make it clear which process owns the temp dir (e.g. when cleaning up after a crash)
+		location, err := os.MkdirTemp(t.parentDir, fmt.Sprintf("%s-%d-", t.rootPrefix, os.Getpid()))
 		if err != nil {
 			return "", err
 		}
 
 		t.rootLocation = location
+		t.publish(event.TempDirCreated, TempDirEvent{Path: location})
 	}
 	return t.rootLocation, nil
 }
 
-// NewGenerator creates a child generator capable of making sibling temp directories.
-func (t *TempDirGenerator) NewGenerator() *TempDirGenerator {
-	gen := NewTempDirGenerator(t.rootPrefix)
+// NewGenerator creates a child generator capable of making sibling temp directories. The child is bound by the quota
+// of this generator in addition to any quota given.
+func (t *TempDirGenerator) NewGenerator(options ...TempDirGeneratorOption) *TempDirGenerator {
+	gen := NewTempDirGenerator(t.rootPrefix, options...)
+	gen.parent = t
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
 	t.children = append(t.children, gen)
 	return gen
 }
 
-// NewDirectory creates a new temp dir within the generators prefix temp dir.
+// NewGeneratorIn creates a child generator (see NewGenerator) whose temp directories are created within the given
+// directory instead of the system temp dir (e.g. to keep large layer caches off of a small /tmp). The given directory
+// is created if it does not exist, however, only the temp directories within it are removed on Cleanup.
+func (t *TempDirGenerator) NewGeneratorIn(dir string, options ...TempDirGeneratorOption) *TempDirGenerator {
+	gen := t.NewGenerator(options...)
+	gen.parentDir = dir
+	return gen
+}
+
+// NewDirectory creates a new temp dir within the generators prefix temp dir. An error wrapping ErrTempDirQuotaExceeded
+// is returned if the quota of this generator (or any parent generator) is already exceeded.
 func (t *TempDirGenerator) NewDirectory(name ...string) (string, error) {
+	if err := t.CheckQuota(); err != nil {
+		return "", err
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
 	location, err := t.getOrCreateRootLocation()
 	if err != nil {
 		return "", err
 	}
 
-	return os.MkdirTemp(location, strings.Join(name, "-")+"-")
+	dir, err := os.MkdirTemp(location, strings.Join(name, "-")+"-")
+	if err != nil {
+		return "", err
+	}
+	t.directories = append(t.directories, dir)
+	t.publish(event.TempDirCreated, TempDirEvent{Path: dir})
+	return dir, nil
 }
 
-// Cleanup deletes all temp dirs created by this generator and any child generator.
+// Usage returns the combined contents of all temp dirs of this generator and all child generators.
+func (t *TempDirGenerator) Usage() (TempDirUsage, error) {
+	t.lock.Lock()
+	root := t.rootLocation
+	children := append([]*TempDirGenerator(nil), t.children...)
+	t.lock.Unlock()
+
+	var usage TempDirUsage
+	if root != "" {
+		err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			if p == root {
+				return nil
+			}
+			usage.Files++
+			if d.Type().IsRegular() {
+				info, err := d.Info()
+				if err != nil {
+					if errors.Is(err, fs.ErrNotExist) {
+						return nil
+					}
+					return err
+				}
+				usage.Bytes += info.Size()
+			}
+			return nil
+		})
+		if err != nil {
+			return usage, fmt.Errorf("unable to measure temp dir=%q: %w", root, err)
+		}
+	}
+
+	for _, child := range children {
+		childUsage, err := child.Usage()
+		if err != nil {
+			return usage, err
+		}
+		usage.Bytes += childUsage.Bytes
+		usage.Files += childUsage.Files
+	}
+	return usage, nil
+}
+
+// CheckQuota returns an error wrapping ErrTempDirQuotaExceeded if the contents of the temp dirs exceed the quota of
+// this generator or any parent generator (publishing an event.TempDirQuotaExceeded event for the violated quota).
+// Embedders writing into temp dirs may call this periodically to bound scratch usage.
+func (t *TempDirGenerator) CheckQuota() error {
+	for gen := t; gen != nil; gen = gen.parent {
+		if err := gen.checkOwnQuota(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *TempDirGenerator) checkOwnQuota() error {
+	if t.quota.MaxBytes <= 0 && t.quota.MaxFiles <= 0 {
+		return nil
+	}
+	usage, err := t.Usage()
+	if err != nil {
+		return err
+	}
+
+	var violation error
+	switch {
+	case t.quota.MaxBytes > 0 && usage.Bytes > t.quota.MaxBytes:
+		violation = fmt.Errorf("%w: %d bytes in use (max=%d)", ErrTempDirQuotaExceeded, usage.Bytes, t.quota.MaxBytes)
+	case t.quota.MaxFiles > 0 && usage.Files > t.quota.MaxFiles:
+		violation = fmt.Errorf("%w: %d files in use (max=%d)", ErrTempDirQuotaExceeded, usage.Files, t.quota.MaxFiles)
+	default:
+		return nil
+	}
+
+	t.lock.Lock()
+	root := t.rootLocation
+	t.lock.Unlock()
+	t.publish(event.TempDirQuotaExceeded, TempDirEvent{Path: root, Usage: usage, Err: violation})
+	return violation
+}
+
+// Cleanup deletes all temp dirs created by this generator and any child generator. Teardown is deterministic: child
+// generators are cleaned up first (the most recently created first), followed by the temp dirs of this generator
+// (the most recently created first), and lastly the root temp dir. The generator may be used again afterwards.
 func (t *TempDirGenerator) Cleanup() error {
+	t.lock.Lock()
+	children := append([]*TempDirGenerator(nil), t.children...)
+	directories := t.directories
+	root := t.rootLocation
+	t.directories = nil
+	t.rootLocation = ""
+	t.lock.Unlock()
+
 	var allErrs error
-	for _, gen := range t.children {
-		if err := gen.Cleanup(); err != nil {
+	for i := len(children) - 1; i >= 0; i-- {
+		if err := children[i].Cleanup(); err != nil {
 			allErrs = multierror.Append(allErrs, err)
 		}
 	}
-	if t.rootLocation != "" {
-		if err := os.RemoveAll(t.rootLocation); err != nil {
+	for i := len(directories) - 1; i >= 0; i-- {
+		if err := t.remove(directories[i]); err != nil {
+			allErrs = multierror.Append(allErrs, err)
+		}
+	}
+	if root != "" {
+		if err := t.remove(root); err != nil {
 			allErrs = multierror.Append(allErrs, err)
 		}
 	}
 	return allErrs
 }
+
+func (t *TempDirGenerator) remove(dir string) error {
+	err := os.RemoveAll(dir)
+	t.publish(event.TempDirRemoved, TempDirEvent{Path: dir, Err: err})
+	return err
+}
+
+func (t *TempDirGenerator) publish(eventType partybus.EventType, payload TempDirEvent) {
+	payload.Prefix = t.rootPrefix
+	bus.Publish(partybus.Event{
+		Type:   eventType,
+		Source: payload.Path,
+		Value:  payload,
+	})
+}
@@ -1,12 +1,21 @@
 package file
 
 import (
+	"errors"
+	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wagoodman/go-partybus"
+
+	"github.com/anchore/stereoscope/internal/bus"
+	"github.com/anchore/stereoscope/pkg/event"
 )
 
 func TestTempDirGenerator(t *testing.T) {
@@ -89,3 +98,120 @@ func doesGlobExist(t *testing.T, pattern string) bool {
 	}
 	return false
 }
+
+func TestTempDirGenerator_NewGeneratorIn(t *testing.T) {
+	parent := filepath.Join(t.TempDir(), "cache", "root")
+	root := NewTempDirGenerator("stereoscope-in-test")
+	gen := root.NewGeneratorIn(parent)
+
+	d, err := gen.NewDirectory("layers")
+	assert.NoError(t, err)
+	assert.True(t, doesGlobExist(t, d), "sub-temp dir does not exist")
+	assert.Equal(t, parent, filepath.Dir(gen.rootLocation))
+	assert.Contains(t, d, gen.rootLocation)
+
+	// cleaning up the root generator removes the temp dirs, but not the given parent directory
+	assert.NoError(t, root.Cleanup())
+	assert.False(t, doesGlobExist(t, d), "cleanup did not remove temp dir")
+	assert.True(t, doesGlobExist(t, parent), "cleanup removed the parent dir")
+}
+
+func TestTempDirGenerator_Quota(t *testing.T) {
+	tests := []struct {
+		name  string
+		quota TempDirQuota
+		write func(t *testing.T, dir string)
+	}{
+		{
+			name:  "max bytes",
+			quota: TempDirQuota{MaxBytes: 10},
+			write: func(t *testing.T, dir string) {
+				require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "large"), []byte(strings.Repeat("x", 11)), 0600))
+			},
+		},
+		{
+			name:  "max files",
+			quota: TempDirQuota{MaxFiles: 3},
+			write: func(t *testing.T, dir string) {
+				for _, name := range []string{"a", "b", "c"} {
+					require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), nil, 0600))
+				}
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root := NewTempDirGenerator("stereoscope-quota-test", WithTempDirQuota(test.quota))
+			t.Cleanup(func() { _ = root.Cleanup() })
+			// the quota of the parent applies to all child generators
+			child := root.NewGenerator()
+
+			dir, err := child.NewDirectory("scratch")
+			require.NoError(t, err)
+			assert.NoError(t, root.CheckQuota())
+
+			test.write(t, dir)
+			err = child.CheckQuota()
+			assert.True(t, errors.Is(err, ErrTempDirQuotaExceeded), "unexpected error: %v", err)
+			_, err = child.NewDirectory("more")
+			assert.True(t, errors.Is(err, ErrTempDirQuotaExceeded), "unexpected error: %v", err)
+			_, err = root.NewDirectory("more")
+			assert.True(t, errors.Is(err, ErrTempDirQuotaExceeded), "unexpected error: %v", err)
+
+			// cleaning up frees the quota
+			require.NoError(t, child.Cleanup())
+			usage, err := root.Usage()
+			require.NoError(t, err)
+			assert.Equal(t, TempDirUsage{}, usage)
+			_, err = child.NewDirectory("again")
+			assert.NoError(t, err)
+		})
+	}
+}
+
+type recordingPublisher struct {
+	lock   sync.Mutex
+	events []partybus.Event
+}
+
+func (p *recordingPublisher) Publish(e partybus.Event) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.events = append(p.events, e)
+}
+
+func TestTempDirGenerator_Events(t *testing.T) {
+	publisher := &recordingPublisher{}
+	bus.SetPublisher(publisher)
+	t.Cleanup(func() { bus.SetPublisher(&recordingPublisher{}) })
+
+	root := NewTempDirGenerator("stereoscope-events-test")
+	first := root.NewGenerator()
+	second := root.NewGenerator()
+
+	a, err := first.NewDirectory("a")
+	require.NoError(t, err)
+	b, err := second.NewDirectory("b")
+	require.NoError(t, err)
+	c, err := second.NewDirectory("c")
+	require.NoError(t, err)
+	require.NoError(t, root.Cleanup())
+
+	var created, removed []string
+	for _, e := range publisher.events {
+		payload, ok := e.Value.(TempDirEvent)
+		require.True(t, ok)
+		assert.Equal(t, "stereoscope-events-test", payload.Prefix)
+		switch e.Type {
+		case event.TempDirCreated:
+			created = append(created, payload.Path)
+		case event.TempDirRemoved:
+			assert.NoError(t, payload.Err)
+			removed = append(removed, payload.Path)
+		}
+	}
+	firstRoot, secondRoot := filepath.Dir(a), filepath.Dir(b)
+	assert.Equal(t, []string{firstRoot, a, secondRoot, b, c}, created)
+	// teardown is the reverse of creation (children first, most recent first)
+	assert.Equal(t, []string{c, b, secondRoot, a, firstRoot}, removed)
+}
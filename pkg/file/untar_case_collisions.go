@@ -0,0 +1,172 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/anchore/stereoscope/pkg/file/tarutil"
+)
+
+// ErrCaseCollision is returned when extracting a tar with CaseCollisionsRejected and two entries collide.
+var ErrCaseCollision = errors.New("paths collide on a case-insensitive filesystem")
+
+// CaseCollisionPolicy describes how tar entries are written when their paths collide with a previously written path
+// under case-insensitive comparison (e.g. "/etc/Foo" and "/etc/foo"), which refer to the same file on the default
+// filesystems of macOS and Windows (see UntarOptions).
+type CaseCollisionPolicy int
+
+const (
+	// CaseCollisionsIgnored writes all entries as-is (the default), so on a case-insensitive filesystem the later entry
+	// replaces (or, for directories, merges with) the earlier one.
+	CaseCollisionsIgnored CaseCollisionPolicy = iota
+	// CaseCollisionsSkipped keeps the first entry written and skips every colliding entry (and all entries below a
+	// colliding directory).
+	CaseCollisionsSkipped
+	// CaseCollisionsRenamed writes colliding entries with a "~N" suffix appended to the colliding path element (e.g.
+	// "/etc/foo~1"), and all entries below a colliding directory within the renamed directory. Symlink targets are not
+	// rewritten.
+	CaseCollisionsRenamed
+	// CaseCollisionsRejected fails the extraction with ErrCaseCollision on the first colliding entry.
+	CaseCollisionsRejected
+)
+
+// CaseCollision describes a path that collides with a previously extracted path under case-insensitive comparison
+// (see UntarReport.CaseCollisions).
+type CaseCollision struct {
+	// Path is the colliding path (which may be a parent directory of the tar entry)
+	Path string
+	// CollidesWith is the previously extracted path that differs only by case
+	CollidesWith string
+	// WrittenAs is the path that was written instead (only with CaseCollisionsRenamed)
+	WrittenAs string
+}
+
+func (c CaseCollision) Error() string {
+	return fmt.Sprintf("path=%q collides with path=%q", c.Path, c.CollidesWith)
+}
+
+// FindCaseCollisions returns every set of the given (unique) paths that collide under case-insensitive comparison,
+// such that only one path of each set can exist on a case-insensitive filesystem. The paths within each set and the
+// sets themselves are sorted.
+func FindCaseCollisions(paths []Path) [][]Path {
+	groups := make(map[string][]Path)
+	var keys []string
+	for _, p := range paths {
+		key := caseFoldKey(string(p))
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], p)
+	}
+
+	var collisions [][]Path
+	for _, key := range keys {
+		group := groups[key]
+		if len(group) < 2 {
+			continue
+		}
+		sort.Sort(Paths(group))
+		collisions = append(collisions, group)
+	}
+	sort.Slice(collisions, func(i, j int) bool {
+		return collisions[i][0] < collisions[j][0]
+	})
+	return collisions
+}
+
+// caseFoldKey returns the given string with every rune replaced by the smallest rune that is equivalent under simple
+// case folding, so two strings have the same key exactly when strings.EqualFold reports them as equal.
+func caseFoldKey(s string) string {
+	return strings.Map(func(r rune) rune {
+		smallest := r
+		for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+			if f < smallest {
+				smallest = f
+			}
+		}
+		return smallest
+	}, s)
+}
+
+// caseCollisionTracker tracks the paths written during extraction in order to apply a CaseCollisionPolicy.
+type caseCollisionTracker struct {
+	policy CaseCollisionPolicy
+	// written are the paths written so far (including implicitly created parent directories), keyed by caseFoldKey
+	written map[string]string
+	// renamed maps each colliding path to the path written instead (with CaseCollisionsRenamed)
+	renamed map[string]string
+	// reported are the colliding paths already recorded on the report
+	reported map[string]struct{}
+}
+
+func newCaseCollisionTracker(policy CaseCollisionPolicy) *caseCollisionTracker {
+	return &caseCollisionTracker{
+		policy:   policy,
+		written:  make(map[string]string),
+		renamed:  make(map[string]string),
+		reported: make(map[string]struct{}),
+	}
+}
+
+// resolve returns the path to write the given tar entry name to according to the policy (false if the entry should
+// not be written), recording any collisions on the given report.
+func (c *caseCollisionTracker) resolve(name string, report *UntarReport) (string, bool, error) {
+	resolved := "/"
+	for _, element := range strings.Split(strings.TrimPrefix(tarutil.CleanPath(name), "/"), "/") {
+		if element == "" {
+			continue
+		}
+		resolved = path.Join(resolved, element)
+		if renamed, ok := c.renamed[resolved]; ok {
+			resolved = renamed
+			continue
+		}
+
+		key := caseFoldKey(resolved)
+		existing, ok := c.written[key]
+		if !ok {
+			c.written[key] = resolved
+			continue
+		}
+		if existing == resolved {
+			continue
+		}
+
+		collision := CaseCollision{Path: resolved, CollidesWith: existing}
+		switch c.policy {
+		case CaseCollisionsRejected:
+			return "", false, fmt.Errorf("%w: %v", ErrCaseCollision, collision)
+		case CaseCollisionsRenamed:
+			collision.WrittenAs = c.rename(resolved)
+			c.renamed[resolved] = collision.WrittenAs
+		}
+		if _, ok := c.reported[resolved]; !ok {
+			c.reported[resolved] = struct{}{}
+			report.CaseCollisions = append(report.CaseCollisions, collision)
+		}
+		switch c.policy {
+		case CaseCollisionsSkipped:
+			return "", false, nil
+		case CaseCollisionsRenamed:
+			resolved = collision.WrittenAs
+		}
+	}
+	return resolved, true, nil
+}
+
+// rename returns the first "~N" suffixed variant of the given path that does not collide with any written path,
+// which is then considered written.
+func (c *caseCollisionTracker) rename(p string) string {
+	for n := 1; ; n++ {
+		candidate := fmt.Sprintf("%s~%d", p, n)
+		key := caseFoldKey(candidate)
+		if _, ok := c.written[key]; !ok {
+			c.written[key] = candidate
+			return candidate
+		}
+	}
+}
@@ -0,0 +1,115 @@
+//go:build !windows
+// +build !windows
+
+package file
+
+import (
+	"archive/tar"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindCaseCollisions(t *testing.T) {
+	paths := []Path{"/etc", "/etc/foo", "/etc/Foo", "/etc/FOO", "/etc/bar", "/usr/Straße", "/usr/STRASSE", "/Etc"}
+	expected := [][]Path{
+		{"/Etc", "/etc"},
+		{"/etc/FOO", "/etc/Foo", "/etc/foo"},
+	}
+	assert.Equal(t, expected, FindCaseCollisions(paths))
+	assert.Empty(t, FindCaseCollisions([]Path{"/a", "/b"}))
+}
+
+func TestUntarToDirectoryWithOptions_CaseCollisions(t *testing.T) {
+	headers := []tar.Header{
+		{Name: "etc/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "etc/foo", Typeflag: tar.TypeReg, Size: 1},
+		{Name: "etc/Foo", Typeflag: tar.TypeReg, Size: 2},
+		{Name: "Etc/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "Etc/bar", Typeflag: tar.TypeReg, Size: 3},
+		{Name: "etc/foo", Typeflag: tar.TypeReg, Size: 4},
+	}
+
+	tests := []struct {
+		name       string
+		policy     CaseCollisionPolicy
+		want       map[string]int64
+		collisions []CaseCollision
+		wantErr    error
+	}{
+		{
+			name:   "ignored",
+			policy: CaseCollisionsIgnored,
+			want:   map[string]int64{"etc/foo": 4, "etc/Foo": 2, "Etc/bar": 3},
+			collisions: []CaseCollision{
+				{Path: "/etc/Foo", CollidesWith: "/etc/foo"},
+				{Path: "/Etc", CollidesWith: "/etc"},
+			},
+		},
+		{
+			name:   "skipped",
+			policy: CaseCollisionsSkipped,
+			want:   map[string]int64{"etc/foo": 4},
+			collisions: []CaseCollision{
+				{Path: "/etc/Foo", CollidesWith: "/etc/foo"},
+				{Path: "/Etc", CollidesWith: "/etc"},
+			},
+		},
+		{
+			name:   "renamed",
+			policy: CaseCollisionsRenamed,
+			want:   map[string]int64{"etc/foo": 4, "etc/Foo~1": 2, "Etc~1/bar": 3},
+			collisions: []CaseCollision{
+				{Path: "/etc/Foo", CollidesWith: "/etc/foo", WrittenAs: "/etc/Foo~1"},
+				{Path: "/Etc", CollidesWith: "/etc", WrittenAs: "/Etc~1"},
+			},
+		},
+		{
+			name:    "rejected",
+			policy:  CaseCollisionsRejected,
+			wantErr: ErrCaseCollision,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dst := t.TempDir()
+			report, err := UntarToDirectoryWithOptions(symlinkTestTar(t, headers...), dst, UntarOptions{CaseCollisions: test.policy})
+			if test.wantErr != nil {
+				assert.True(t, errors.Is(err, test.wantErr), "unexpected error: %v", err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.collisions, report.CaseCollisions)
+
+			got := make(map[string]int64)
+			require.NoError(t, filepath.Walk(dst, func(p string, info os.FileInfo, err error) error {
+				if err != nil || info.IsDir() {
+					return err
+				}
+				rel, err := filepath.Rel(dst, p)
+				got[filepath.ToSlash(rel)] = info.Size()
+				return err
+			}))
+			if test.policy == CaseCollisionsIgnored && isCaseInsensitive(t, dst) {
+				t.Skip("the destination filesystem is case-insensitive")
+			}
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+// isCaseInsensitive indicates if the filesystem of the given directory is case-insensitive.
+func isCaseInsensitive(t *testing.T, dir string) bool {
+	t.Helper()
+	probe := filepath.Join(dir, "case-probe")
+	require.NoError(t, ioutil.WriteFile(probe, nil, 0600))
+	defer os.Remove(probe)
+	_, err := os.Stat(strings.ToUpper(probe))
+	return err == nil
+}
@@ -0,0 +1,26 @@
+package file
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+
+	"github.com/anchore/stereoscope/pkg/file/tarutil"
+)
+
+// untarHardlink writes the given hardlink entry to the given target path on disk as a hardlink to the previously
+// written regular file (replacing any existing file), given the paths on disk of the regular files written so far.
+func untarHardlink(target string, header tar.Header, files map[string]string, report *UntarReport) error {
+	linked, ok := files[tarutil.CleanPath(header.Linkname)]
+	if !ok {
+		report.DroppedHardlinks = append(report.DroppedHardlinks, target)
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Link(linked, target)
+}
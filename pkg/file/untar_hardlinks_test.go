@@ -0,0 +1,87 @@
+//go:build !windows
+// +build !windows
+
+package file
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUntarToDirectoryWithOptions_Hardlinks(t *testing.T) {
+	headers := []tar.Header{
+		{Name: "bin/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "bin/tool", Typeflag: tar.TypeReg, Size: 4},
+		{Name: "bin/alias", Typeflag: tar.TypeLink, Linkname: "bin/tool"},
+		{Name: "sbin/alias", Typeflag: tar.TypeLink, Linkname: "./bin/tool"},
+		{Name: "bin/dangling", Typeflag: tar.TypeLink, Linkname: "bin/missing"},
+	}
+
+	t.Run("ignored", func(t *testing.T) {
+		dst := t.TempDir()
+		_, err := UntarToDirectoryWithOptions(symlinkTestTar(t, headers...), dst, UntarOptions{})
+		require.NoError(t, err)
+		_, err = os.Lstat(filepath.Join(dst, "bin", "alias"))
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("written", func(t *testing.T) {
+		dst := t.TempDir()
+		report, err := UntarToDirectoryWithOptions(symlinkTestTar(t, headers...), dst, UntarOptions{Hardlinks: true})
+		require.NoError(t, err)
+
+		original, err := os.Stat(filepath.Join(dst, "bin", "tool"))
+		require.NoError(t, err)
+		for _, name := range []string{"bin/alias", "sbin/alias"} {
+			linked, err := os.Stat(filepath.Join(dst, filepath.FromSlash(name)))
+			require.NoError(t, err, name)
+			assert.True(t, os.SameFile(original, linked), name)
+
+			contents, err := ioutil.ReadFile(filepath.Join(dst, filepath.FromSlash(name)))
+			require.NoError(t, err, name)
+			assert.Equal(t, "xxxx", string(contents), name)
+		}
+		assert.Equal(t, []string{filepath.Join(dst, "bin", "dangling")}, report.DroppedHardlinks)
+	})
+}
+
+func TestUntarToDirectoryWithOptions_PreservePermissions(t *testing.T) {
+	headers := []tar.Header{
+		{Name: "ro/", Typeflag: tar.TypeDir, Mode: 0555},
+		{Name: "ro/file", Typeflag: tar.TypeReg, Size: 4, Mode: 0600},
+		{Name: "tmp/", Typeflag: tar.TypeDir, Mode: 01777},
+		{Name: "bin/", Typeflag: tar.TypeDir, Mode: 0700},
+		{Name: "bin/suid", Typeflag: tar.TypeReg, Size: 4, Mode: 04755},
+		{Name: "bin/exec", Typeflag: tar.TypeReg, Size: 4, Mode: 0777},
+	}
+
+	dst := t.TempDir()
+	report, err := UntarToDirectoryWithOptions(symlinkTestTar(t, headers...), dst, UntarOptions{PreservePermissions: true})
+	require.NoError(t, err)
+	assert.False(t, report.HasUnapplied())
+	t.Cleanup(func() {
+		// allow the temp dir to be removed
+		_ = os.Chmod(filepath.Join(dst, "ro"), 0755)
+	})
+
+	expected := map[string]os.FileMode{
+		"ro":       os.ModeDir | 0555,
+		"ro/file":  0600,
+		"tmp":      os.ModeDir | os.ModeSticky | 0777,
+		"bin":      os.ModeDir | 0700,
+		"bin/suid": os.ModeSetuid | 0755,
+		// not subject to the umask
+		"bin/exec": 0777,
+	}
+	for name, mode := range expected {
+		fi, err := os.Lstat(filepath.Join(dst, filepath.FromSlash(name)))
+		require.NoError(t, err, name)
+		assert.Equal(t, mode, fi.Mode(), name)
+	}
+}
@@ -0,0 +1,233 @@
+package file
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/anchore/stereoscope/internal/log"
+)
+
+// paxXattrPrefix is the PAX record prefix used to store extended attributes within tar headers.
+const paxXattrPrefix = "SCHILY.xattr."
+
+// paxACLRecords are the PAX records holding the text form of POSIX ACLs (as written by star and bsdtar), keyed by the
+// extended attribute the ACL is otherwise stored in.
+var paxACLRecords = map[string]string{
+	POSIXACLAccessXattr:  "SCHILY.acl.access",
+	POSIXACLDefaultXattr: "SCHILY.acl.default",
+}
+
+// ErrXattrsUnsupported is returned when extended attributes cannot be applied on the current platform.
+var ErrXattrsUnsupported = errors.New("extended attributes are not supported on this platform")
+
+// UntarOptions describes which file metadata should be applied when extracting a tar to a directory.
+type UntarOptions struct {
+	// PreserveOwnership attempts to apply the uid/gid from each tar header (typically requires privileges)
+	PreserveOwnership bool
+	// PreserveXattrs attempts to apply extended attributes (including POSIX ACLs) from PAX records
+	PreserveXattrs bool
+	// Verify re-reads each regular file after it has been written and compares it against the digest of the content
+	// from the archive, recording any discrepancies on the UntarReport (e.g. from disk-level corruption)
+	Verify bool
+	// Strict causes the extraction to fail on the first piece of metadata that cannot be applied or the first
+	// verification discrepancy (instead of recording it on the UntarReport)
+	Strict bool
+	// Symlinks describes how symlinks (and in particular symlinks with absolute targets) are written, by default no
+	// symlinks are written. When symlinks are written, no entry is ever written through a symlink that resolves outside
+	// of the destination.
+	Symlinks SymlinkPolicy
+	// CaseCollisions describes how entries are written when their paths collide with a previously written path under
+	// case-insensitive comparison (e.g. when extracting onto macOS or Windows), by default all entries are written
+	// as-is. Collisions are always recorded on the UntarReport.
+	CaseCollisions CaseCollisionPolicy
+	// PreservePermissions applies the permission bits (including the setuid, setgid, and sticky bits) from each tar
+	// header to regular files and directories regardless of the umask, by default files are created with the umask
+	// applied and directories are always created with 0755. Directory permissions are applied once all entries have
+	// been written, so read-only directories do not prevent writing the entries within them.
+	PreservePermissions bool
+	// Hardlinks writes hardlink entries as hardlinks to the previously written regular file, by default no hardlinks
+	// are written. Hardlinks to a file that was not written (e.g. due to the case collision policy) are recorded on
+	// UntarReport.DroppedHardlinks.
+	Hardlinks bool
+}
+
+// UnappliedMetadata describes a single piece of file metadata that could not be applied during extraction.
+type UnappliedMetadata struct {
+	// Path is the path on disk of the extracted file
+	Path string
+	// Kind is the type of metadata (e.g. "xattr" or "ownership")
+	Kind string
+	// Name further describes the metadata (e.g. the xattr name)
+	Name string
+	Err  error
+}
+
+func (u UnappliedMetadata) Error() string {
+	if u.Name != "" {
+		return fmt.Sprintf("unable to apply %s=%q to %q: %v", u.Kind, u.Name, u.Path, u.Err)
+	}
+	return fmt.Sprintf("unable to apply %s to %q: %v", u.Kind, u.Path, u.Err)
+}
+
+func (u UnappliedMetadata) Unwrap() error {
+	return u.Err
+}
+
+// ExtractionDiscrepancy describes a written file whose content on disk does not match the content from the archive.
+type ExtractionDiscrepancy struct {
+	// Path is the path on disk of the extracted file
+	Path string
+	// Expected is the digest of the file content from the archive
+	Expected string
+	Err      error
+}
+
+func (d ExtractionDiscrepancy) Error() string {
+	return fmt.Sprintf("extracted file %q does not match the archive content: %v", d.Path, d.Err)
+}
+
+func (d ExtractionDiscrepancy) Unwrap() error {
+	return d.Err
+}
+
+// UntarReport captures all file metadata that could not be applied and all files that did not verify during an
+// extraction.
+type UntarReport struct {
+	Unapplied     []UnappliedMetadata
+	Discrepancies []ExtractionDiscrepancy
+	// DroppedSymlinks are the paths on disk of symlinks that were not written due to the symlink policy
+	DroppedSymlinks []string
+	// DroppedHardlinks are the paths on disk of hardlinks that were not written since the linked file was not written
+	DroppedHardlinks []string
+	// CaseCollisions are the entry paths (relative to the destination) that collided with a previously written path
+	// under case-insensitive comparison (see UntarOptions.CaseCollisions)
+	CaseCollisions []CaseCollision
+}
+
+// HasUnapplied indicates if any metadata could not be applied.
+func (r *UntarReport) HasUnapplied() bool {
+	return r != nil && len(r.Unapplied) > 0
+}
+
+// HasDiscrepancies indicates if any extracted file did not match the archive content upon verification.
+func (r *UntarReport) HasDiscrepancies() bool {
+	return r != nil && len(r.Discrepancies) > 0
+}
+
+// XattrsFromHeader returns all extended attributes recorded within the PAX records of the given header. POSIX ACLs
+// recorded in text form (see paxACLRecords) are returned as the equivalent ACL extended attribute, unless the header
+// records the extended attribute as well.
+func XattrsFromHeader(header tar.Header) map[string][]byte {
+	var xattrs map[string][]byte
+	for key, value := range header.PAXRecords {
+		if !strings.HasPrefix(key, paxXattrPrefix) {
+			continue
+		}
+		if xattrs == nil {
+			xattrs = make(map[string][]byte)
+		}
+		xattrs[strings.TrimPrefix(key, paxXattrPrefix)] = []byte(value)
+	}
+
+	for xattr, record := range paxACLRecords {
+		text, ok := header.PAXRecords[record]
+		if !ok {
+			continue
+		}
+		if _, exists := xattrs[xattr]; exists {
+			continue
+		}
+		acl, err := parsePOSIXACLText(text)
+		if err != nil {
+			log.Debugf("ignoring %s record for path=%q: %+v", record, header.Name, err)
+			continue
+		}
+		if xattrs == nil {
+			xattrs = make(map[string][]byte)
+		}
+		xattrs[xattr] = acl.Encode()
+	}
+	return xattrs
+}
+
+func applyUntarMetadata(target string, header tar.Header, options UntarOptions, report *UntarReport) error {
+	var unapplied []UnappliedMetadata
+
+	if options.PreserveOwnership {
+		if err := os.Lchown(target, header.Uid, header.Gid); err != nil {
+			unapplied = append(unapplied, UnappliedMetadata{Path: target, Kind: "ownership", Err: err})
+		}
+	}
+
+	if options.PreserveXattrs {
+		xattrs := XattrsFromHeader(header)
+		names := make([]string, 0, len(xattrs))
+		for name := range xattrs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			if err := setXattr(target, name, xattrs[name]); err != nil {
+				unapplied = append(unapplied, UnappliedMetadata{Path: target, Kind: "xattr", Name: name, Err: err})
+			}
+		}
+	}
+
+	// permissions are applied last, since changing the ownership clears the setuid and setgid bits
+	if options.PreservePermissions && header.Typeflag != tar.TypeDir {
+		if err := os.Chmod(target, untarPermissions(header)); err != nil {
+			unapplied = append(unapplied, UnappliedMetadata{Path: target, Kind: "permissions", Err: err})
+		}
+	}
+
+	if len(unapplied) > 0 && options.Strict {
+		return unapplied[0]
+	}
+
+	report.Unapplied = append(report.Unapplied, unapplied...)
+	return nil
+}
+
+// untarPermissions returns the permission bits (including the setuid, setgid, and sticky bits) of the given header.
+func untarPermissions(header tar.Header) os.FileMode {
+	return header.FileInfo().Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+}
+
+// applyUntarDirPermissions applies the permissions of the given directory entries (see
+// UntarOptions.PreservePermissions), deepest directories first.
+func applyUntarDirPermissions(dirs []untarDir, options UntarOptions, report *UntarReport) error {
+	for idx := len(dirs) - 1; idx >= 0; idx-- {
+		if err := os.Chmod(dirs[idx].target, dirs[idx].mode); err != nil {
+			unapplied := UnappliedMetadata{Path: dirs[idx].target, Kind: "permissions", Err: err}
+			if options.Strict {
+				return unapplied
+			}
+			report.Unapplied = append(report.Unapplied, unapplied)
+		}
+	}
+	return nil
+}
+
+// untarDir is an extracted directory with the permissions to apply once extraction completes.
+type untarDir struct {
+	target string
+	mode   os.FileMode
+}
+
+func verifyUntarredFile(target, digest string, options UntarOptions, report *UntarReport) error {
+	err := VerifyDigest(target, digest)
+	if err == nil {
+		return nil
+	}
+	discrepancy := ExtractionDiscrepancy{Path: target, Expected: digest, Err: err}
+	if options.Strict {
+		return discrepancy
+	}
+	report.Discrepancies = append(report.Discrepancies, discrepancy)
+	return nil
+}
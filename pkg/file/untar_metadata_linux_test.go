@@ -0,0 +1,93 @@
+package file
+
+import (
+	"archive/tar"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newXattrTestTar(t *testing.T, xattrs map[string]string) *bytes.Reader {
+	t.Helper()
+	records := make(map[string]string)
+	for name, value := range xattrs {
+		records[paxXattrPrefix+name] = value
+	}
+
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	contents := "contents"
+	require.NoError(t, tw.WriteHeader(&tar.Header{
+		Name:       "file.txt",
+		Size:       int64(len(contents)),
+		Mode:       0644,
+		Typeflag:   tar.TypeReg,
+		Format:     tar.FormatPAX,
+		PAXRecords: records,
+	}))
+	_, err := tw.Write([]byte(contents))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	return bytes.NewReader(buf.Bytes())
+}
+
+func TestUntarToDirectoryWithOptions_UnsupportedXattrs(t *testing.T) {
+	tests := []struct {
+		name    string
+		options UntarOptions
+		wantErr bool
+		want    []string
+	}{
+		{
+			name:    "xattrs are ignored by default",
+			options: UntarOptions{},
+		},
+		{
+			name:    "unsupported xattrs are reported",
+			options: UntarOptions{PreserveXattrs: true},
+			want:    []string{"bogus.attr"},
+		},
+		{
+			name:    "unsupported xattrs fail in strict mode",
+			options: UntarOptions{PreserveXattrs: true, Strict: true},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dst := t.TempDir()
+			// the "bogus" namespace is never supported by the kernel, regardless of the backing filesystem
+			report, err := UntarToDirectoryWithOptions(newXattrTestTar(t, map[string]string{"bogus.attr": "value"}), dst, test.options)
+			if test.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.FileExists(t, dst+"/file.txt")
+
+			var got []string
+			for _, u := range report.Unapplied {
+				assert.Equal(t, "xattr", u.Kind)
+				got = append(got, u.Name)
+			}
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestXattrsFromHeader(t *testing.T) {
+	header := tar.Header{
+		PAXRecords: map[string]string{
+			"SCHILY.xattr.user.key":                "value",
+			"SCHILY.xattr.system.posix_acl_access": "acl",
+			"mtime":                                "1",
+		},
+	}
+	assert.Equal(t, map[string][]byte{
+		"user.key":                []byte("value"),
+		"system.posix_acl_access": []byte("acl"),
+	}, XattrsFromHeader(header))
+	assert.Nil(t, XattrsFromHeader(tar.Header{}))
+}
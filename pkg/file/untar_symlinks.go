@@ -0,0 +1,131 @@
+package file
+
+import (
+	"archive/tar"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/anchore/stereoscope/pkg/file/tarutil"
+)
+
+// SymlinkPolicy describes how symlinks are materialized when extracting a tar to a directory (see UntarOptions).
+type SymlinkPolicy int
+
+const (
+	// SymlinksIgnored does not write any symlinks (the default).
+	SymlinksIgnored SymlinkPolicy = iota
+	// SymlinksRootRelative writes all symlinks, rewriting absolute targets (and relative targets that would climb above
+	// the root) to be relative to the extraction root, so the extracted tree never points into the host filesystem.
+	SymlinksRootRelative
+	// SymlinksPreserved writes all symlinks with their targets as-is. Note: absolute targets resolve against the host
+	// filesystem, not the extraction root.
+	SymlinksPreserved
+	// SymlinksAbsoluteDropped writes symlinks with relative targets as-is and skips all symlinks with absolute targets
+	// (recorded on UntarReport.DroppedSymlinks).
+	SymlinksAbsoluteDropped
+)
+
+// symlinkTarget returns the target to write for the given symlink entry according to the given policy (false if the
+// symlink should not be written).
+func symlinkTarget(header tar.Header, policy SymlinkPolicy) (string, bool) {
+	target := header.Linkname
+	switch policy {
+	case SymlinksPreserved:
+		return target, true
+	case SymlinksAbsoluteDropped:
+		return target, !path.IsAbs(target)
+	case SymlinksRootRelative:
+		linkDir := path.Dir(tarutil.CleanPath(header.Name))
+		if !path.IsAbs(target) && !climbsAboveRoot(linkDir, target) {
+			return target, true
+		}
+		// resolve the target within the image root (where ".." at the root is the root itself)
+		resolved := target
+		if !path.IsAbs(target) {
+			resolved = path.Join(linkDir, target)
+		}
+		rel, err := filepath.Rel(linkDir, path.Clean(DirSeparator+resolved))
+		if err != nil {
+			return "", false
+		}
+		return filepath.ToSlash(rel), true
+	default:
+		return "", false
+	}
+}
+
+// climbsAboveRoot indicates if the relative link target climbs above the root when resolved from the given directory.
+func climbsAboveRoot(dir, target string) bool {
+	depth := len(strings.Split(strings.Trim(dir, DirSeparator), DirSeparator))
+	if dir == DirSeparator {
+		depth = 0
+	}
+	for _, element := range strings.Split(target, DirSeparator) {
+		switch element {
+		case "", ".":
+		case "..":
+			depth--
+			if depth < 0 {
+				return true
+			}
+		default:
+			depth++
+		}
+	}
+	return false
+}
+
+// untarSymlink writes the given symlink entry to the given target path on disk (replacing any existing file).
+func untarSymlink(target string, header tar.Header, options UntarOptions, report *UntarReport) error {
+	linkTarget, ok := symlinkTarget(header, options.Symlinks)
+	if !ok {
+		report.DroppedSymlinks = append(report.DroppedSymlinks, target)
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Symlink(filepath.FromSlash(linkTarget), target)
+}
+
+// removeSymlink removes the given path only if it is a symlink.
+func removeSymlink(p string) error {
+	fi, err := os.Lstat(p)
+	if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		return nil
+	}
+	return os.Remove(p)
+}
+
+// ensureWithinRoot guards against writing through an already extracted symlink that resolves outside of the root
+// (e.g. an entry "lib/x" after a symlink "lib" -> "/usr/lib" was written as-is).
+func ensureWithinRoot(root, target string) error {
+	resolvedRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+	for dir := filepath.Dir(target); ; dir = filepath.Dir(dir) {
+		resolved, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				return err
+			}
+			if dir == root || dir == filepath.Dir(dir) {
+				return nil
+			}
+			// the nearest existing ancestor is what any new directories would be created within
+			continue
+		}
+		rel, err := filepath.Rel(resolvedRoot, resolved)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("path=%q resolves outside of destination=%q through a symlink", target, root)
+		}
+		return nil
+	}
+}
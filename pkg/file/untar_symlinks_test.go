@@ -0,0 +1,171 @@
+//go:build !windows
+// +build !windows
+
+package file
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func symlinkTestTar(t *testing.T, headers ...tar.Header) *bytes.Buffer {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, header := range headers {
+		header := header
+		if header.Mode == 0 {
+			header.Mode = 0644
+		}
+		require.NoError(t, tw.WriteHeader(&header))
+		if header.Size > 0 {
+			_, err := tw.Write(bytes.Repeat([]byte("x"), int(header.Size)))
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, tw.Close())
+	return buf
+}
+
+func TestUntarToDirectoryWithOptions_Symlinks(t *testing.T) {
+	headers := []tar.Header{
+		{Name: "usr/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "usr/bin/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "usr/bin/tool", Typeflag: tar.TypeReg, Size: 4},
+		{Name: "bin/absolute", Typeflag: tar.TypeSymlink, Linkname: "/usr/bin/tool"},
+		{Name: "bin/relative", Typeflag: tar.TypeSymlink, Linkname: "../usr/bin/tool"},
+		{Name: "bin/escaping", Typeflag: tar.TypeSymlink, Linkname: "../../../etc/passwd"},
+		{Name: "root", Typeflag: tar.TypeSymlink, Linkname: "/"},
+	}
+
+	tests := []struct {
+		name    string
+		policy  SymlinkPolicy
+		want    map[string]string
+		dropped []string
+	}{
+		{
+			name:   "ignored",
+			policy: SymlinksIgnored,
+			want:   map[string]string{},
+		},
+		{
+			name:   "root relative",
+			policy: SymlinksRootRelative,
+			want: map[string]string{
+				"bin/absolute": "../usr/bin/tool",
+				"bin/relative": "../usr/bin/tool",
+				"bin/escaping": "../etc/passwd",
+				"root":         ".",
+			},
+		},
+		{
+			name:   "preserved",
+			policy: SymlinksPreserved,
+			want: map[string]string{
+				"bin/absolute": "/usr/bin/tool",
+				"bin/relative": "../usr/bin/tool",
+				"bin/escaping": "../../../etc/passwd",
+				"root":         "/",
+			},
+		},
+		{
+			name:   "absolute dropped",
+			policy: SymlinksAbsoluteDropped,
+			want: map[string]string{
+				"bin/relative": "../usr/bin/tool",
+				"bin/escaping": "../../../etc/passwd",
+			},
+			dropped: []string{"bin/absolute", "root"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dst := t.TempDir()
+			report, err := UntarToDirectoryWithOptions(symlinkTestTar(t, headers...), dst, UntarOptions{Symlinks: test.policy})
+			require.NoError(t, err)
+
+			for _, name := range []string{"bin/absolute", "bin/relative", "bin/escaping", "root"} {
+				expected, ok := test.want[name]
+				actual, err := os.Readlink(filepath.Join(dst, name))
+				if !ok {
+					assert.Error(t, err, name)
+					continue
+				}
+				require.NoError(t, err, name)
+				assert.Equal(t, expected, actual, name)
+			}
+
+			var dropped []string
+			for _, p := range report.DroppedSymlinks {
+				rel, err := filepath.Rel(dst, p)
+				require.NoError(t, err)
+				dropped = append(dropped, rel)
+			}
+			assert.Equal(t, test.dropped, dropped)
+		})
+	}
+}
+
+func TestUntarToDirectoryWithOptions_NoWritesThroughEscapingSymlinks(t *testing.T) {
+	outside := t.TempDir()
+
+	tests := []struct {
+		name    string
+		headers []tar.Header
+	}{
+		{
+			name: "write below symlinked directory",
+			headers: []tar.Header{
+				{Name: "lib", Typeflag: tar.TypeSymlink, Linkname: outside},
+				{Name: "lib/evil.txt", Typeflag: tar.TypeReg, Size: 4},
+			},
+		},
+		{
+			name: "write below nested directory of symlinked directory",
+			headers: []tar.Header{
+				{Name: "lib", Typeflag: tar.TypeSymlink, Linkname: outside},
+				{Name: "lib/nested/evil.txt", Typeflag: tar.TypeReg, Size: 4},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dst := t.TempDir()
+			_, err := UntarToDirectoryWithOptions(symlinkTestTar(t, test.headers...), dst, UntarOptions{Symlinks: SymlinksPreserved})
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "resolves outside of destination")
+
+			entries, err := ioutil.ReadDir(outside)
+			require.NoError(t, err)
+			assert.Empty(t, entries)
+		})
+	}
+
+	t.Run("file replaces symlink", func(t *testing.T) {
+		dst := t.TempDir()
+		target := filepath.Join(outside, "target.txt")
+		require.NoError(t, ioutil.WriteFile(target, []byte("original"), 0600))
+
+		_, err := UntarToDirectoryWithOptions(symlinkTestTar(t,
+			tar.Header{Name: "file.txt", Typeflag: tar.TypeSymlink, Linkname: target},
+			tar.Header{Name: "file.txt", Typeflag: tar.TypeReg, Size: 4},
+		), dst, UntarOptions{Symlinks: SymlinksPreserved})
+		require.NoError(t, err)
+
+		contents, err := ioutil.ReadFile(target)
+		require.NoError(t, err)
+		assert.Equal(t, "original", string(contents))
+
+		contents, err = ioutil.ReadFile(filepath.Join(dst, "file.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "xxxx", string(contents))
+	})
+}
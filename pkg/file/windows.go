@@ -0,0 +1,72 @@
+package file
+
+import (
+	"archive/tar"
+	"encoding/base64"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/anchore/stereoscope/pkg/file/tarutil"
+)
+
+const (
+	// windowsFilesDir is the top-level directory of a Windows layer tar that holds the container filesystem (other
+	// top-level directories, such as "Hives" and "UtilityVM", hold the registry hives and the utility VM image).
+	windowsFilesDir = "Files"
+
+	// Windows specific PAX records written by the Windows container tooling (see github.com/Microsoft/hcsshim)
+	winSecurityDescriptorPAXRecord = "MSWINDOWS.rawsd"
+	winFileAttributesPAXRecord     = "MSWINDOWS.fileattr"
+)
+
+// WindowsMetadata is the Windows specific file metadata recorded within the PAX records of a Windows layer tar entry.
+type WindowsMetadata struct {
+	// SecurityDescriptor is the raw (self-relative) security descriptor of the file, which describes the owner and ACLs
+	SecurityDescriptor []byte
+	// FileAttributes are the Windows file attributes (e.g. 0x10 for a directory or 0x400 for a reparse point)
+	FileAttributes uint32
+}
+
+// WindowsMetadataFromHeader returns the Windows specific metadata within the PAX records of the given header (nil if
+// the header has no Windows specific records, or the records are malformed).
+func WindowsMetadataFromHeader(header tar.Header) *WindowsMetadata {
+	rawSD, hasSD := header.PAXRecords[winSecurityDescriptorPAXRecord]
+	rawAttrs, hasAttrs := header.PAXRecords[winFileAttributesPAXRecord]
+	if !hasSD && !hasAttrs {
+		return nil
+	}
+
+	var m WindowsMetadata
+	if hasSD {
+		sd, err := base64.StdEncoding.DecodeString(rawSD)
+		if err != nil {
+			return nil
+		}
+		m.SecurityDescriptor = sd
+	}
+	if hasAttrs {
+		attrs, err := strconv.ParseUint(rawAttrs, 10, 32)
+		if err != nil {
+			return nil
+		}
+		m.FileAttributes = uint32(attrs)
+	}
+	return &m
+}
+
+// NormalizeWindowsLayerPath returns the cleaned absolute path for the given Windows layer tar entry name (or hardlink
+// target): backslash separators are converted to forward slashes, and paths within the top-level "Files" directory are
+// relative to the root of the container filesystem (e.g. "Files\Windows\System32" becomes "/Windows/System32"). Paths
+// outside of the "Files" directory are kept as-is.
+func NormalizeWindowsLayerPath(name string) string {
+	cleaned := tarutil.CleanPath(strings.ReplaceAll(name, `\`, "/"))
+	elements := strings.SplitN(strings.TrimPrefix(cleaned, "/"), "/", 2)
+	if !strings.EqualFold(elements[0], windowsFilesDir) {
+		return cleaned
+	}
+	if len(elements) == 1 {
+		return "/"
+	}
+	return path.Clean("/" + elements[1])
+}
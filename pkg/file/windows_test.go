@@ -0,0 +1,71 @@
+package file
+
+import (
+	"archive/tar"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeWindowsLayerPath(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{name: `Files\Windows\System32\cmd.exe`, expected: "/Windows/System32/cmd.exe"},
+		{name: "Files/Program Files/app/", expected: "/Program Files/app"},
+		{name: "files/Users", expected: "/Users"},
+		{name: "Files", expected: "/"},
+		{name: `Files\`, expected: "/"},
+		{name: `Hives\Software_Delta`, expected: "/Hives/Software_Delta"},
+		{name: `UtilityVM\Files\EFI`, expected: "/UtilityVM/Files/EFI"},
+		{name: `Files\..\..\escape`, expected: "/escape"},
+		{name: "Filesystem/a", expected: "/Filesystem/a"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, NormalizeWindowsLayerPath(test.name))
+		})
+	}
+}
+
+func TestWindowsMetadataFromHeader(t *testing.T) {
+	sd := []byte{0x01, 0x00, 0x04, 0x80}
+	tests := []struct {
+		name     string
+		records  map[string]string
+		expected *WindowsMetadata
+	}{
+		{
+			name:     "no windows records",
+			records:  map[string]string{"SCHILY.xattr.user.a": "b"},
+			expected: nil,
+		},
+		{
+			name: "security descriptor and attributes",
+			records: map[string]string{
+				"MSWINDOWS.rawsd":    base64.StdEncoding.EncodeToString(sd),
+				"MSWINDOWS.fileattr": "32",
+			},
+			expected: &WindowsMetadata{SecurityDescriptor: sd, FileAttributes: 32},
+		},
+		{
+			name:     "attributes only",
+			records:  map[string]string{"MSWINDOWS.fileattr": "16"},
+			expected: &WindowsMetadata{FileAttributes: 16},
+		},
+		{
+			name:     "malformed security descriptor",
+			records:  map[string]string{"MSWINDOWS.rawsd": "!!!"},
+			expected: nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			header := tar.Header{Name: "Files/a", PAXRecords: test.records}
+			assert.Equal(t, test.expected, WindowsMetadataFromHeader(header))
+			assert.Equal(t, test.expected, NewMetadata(header, 0, nil).Windows)
+		})
+	}
+}
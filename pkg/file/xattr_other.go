@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package file
+
+// setXattr is not supported on this platform.
+func setXattr(string, string, []byte) error {
+	return ErrXattrsUnsupported
+}
@@ -0,0 +1,11 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package file
+
+import "golang.org/x/sys/unix"
+
+// setXattr applies a single extended attribute to the given path (without following symlinks).
+func setXattr(path, name string, value []byte) error {
+	return unix.Lsetxattr(path, name, value, 0)
+}
@@ -0,0 +1,154 @@
+package file
+
+import (
+	"encoding/binary"
+	"hash"
+	"math/bits"
+)
+
+// XXH64 is the 64-bit xxHash algorithm (with a zero seed), a fast non-cryptographic hash commonly used to identify
+// file contents. It has no crypto.Hash value, but can be used anywhere a DigestHash is accepted (e.g. "xxh64:abc...").
+var XXH64 DigestHash = xxh64Algorithm{}
+
+type xxh64Algorithm struct{}
+
+func (xxh64Algorithm) Available() bool {
+	return true
+}
+
+func (xxh64Algorithm) New() hash.Hash {
+	return newXXH64()
+}
+
+func (xxh64Algorithm) String() string {
+	return "XXH64"
+}
+
+const (
+	xxh64Prime1 uint64 = 11400714785074694791
+	xxh64Prime2 uint64 = 14029467366897019727
+	xxh64Prime3 uint64 = 1609587929392839161
+	xxh64Prime4 uint64 = 9650029242287828579
+	xxh64Prime5 uint64 = 2870177450012600261
+)
+
+// xxh64 is a streaming implementation of XXH64 (see https://github.com/Cyan4973/xxHash/blob/dev/doc/xxhash_spec.md).
+type xxh64 struct {
+	v1, v2, v3, v4 uint64
+	total          uint64
+	buf            [32]byte
+	n              int
+}
+
+var _ hash.Hash64 = (*xxh64)(nil)
+
+func newXXH64() *xxh64 {
+	x := &xxh64{}
+	x.Reset()
+	return x
+}
+
+func (x *xxh64) Reset() {
+	// the accumulators wrap on overflow, which is not allowed for constant expressions
+	p1, p2 := xxh64Prime1, xxh64Prime2
+	x.v1 = p1 + p2
+	x.v2 = p2
+	x.v3 = 0
+	x.v4 = -p1
+	x.total = 0
+	x.n = 0
+}
+
+func (x *xxh64) Size() int {
+	return 8
+}
+
+func (x *xxh64) BlockSize() int {
+	return 32
+}
+
+func (x *xxh64) Write(p []byte) (int, error) {
+	length := len(p)
+	x.total += uint64(length)
+
+	if x.n+len(p) < 32 {
+		// not enough for a full stripe yet
+		x.n += copy(x.buf[x.n:], p)
+		return length, nil
+	}
+
+	if x.n > 0 {
+		c := copy(x.buf[x.n:], p)
+		x.stripe(x.buf[:])
+		p = p[c:]
+		x.n = 0
+	}
+
+	for ; len(p) >= 32; p = p[32:] {
+		x.stripe(p)
+	}
+	x.n = copy(x.buf[:], p)
+	return length, nil
+}
+
+func (x *xxh64) stripe(b []byte) {
+	x.v1 = xxh64Round(x.v1, binary.LittleEndian.Uint64(b[0:8]))
+	x.v2 = xxh64Round(x.v2, binary.LittleEndian.Uint64(b[8:16]))
+	x.v3 = xxh64Round(x.v3, binary.LittleEndian.Uint64(b[16:24]))
+	x.v4 = xxh64Round(x.v4, binary.LittleEndian.Uint64(b[24:32]))
+}
+
+func (x *xxh64) Sum(b []byte) []byte {
+	var sum [8]byte
+	binary.BigEndian.PutUint64(sum[:], x.Sum64())
+	return append(b, sum[:]...)
+}
+
+func (x *xxh64) Sum64() uint64 {
+	var h uint64
+	if x.total >= 32 {
+		h = bits.RotateLeft64(x.v1, 1) + bits.RotateLeft64(x.v2, 7) + bits.RotateLeft64(x.v3, 12) + bits.RotateLeft64(x.v4, 18)
+		h = xxh64MergeRound(h, x.v1)
+		h = xxh64MergeRound(h, x.v2)
+		h = xxh64MergeRound(h, x.v3)
+		h = xxh64MergeRound(h, x.v4)
+	} else {
+		h = x.v3 + xxh64Prime5
+	}
+	h += x.total
+
+	// the remaining (buffered) input is consumed in 8, 4, and then 1 byte lanes
+	b := x.buf[:x.n]
+	for ; len(b) >= 8; b = b[8:] {
+		h ^= xxh64Round(0, binary.LittleEndian.Uint64(b[:8]))
+		h = bits.RotateLeft64(h, 27)*xxh64Prime1 + xxh64Prime4
+	}
+	if len(b) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(b[:4])) * xxh64Prime1
+		h = bits.RotateLeft64(h, 23)*xxh64Prime2 + xxh64Prime3
+		b = b[4:]
+	}
+	for _, c := range b {
+		h ^= uint64(c) * xxh64Prime5
+		h = bits.RotateLeft64(h, 11) * xxh64Prime1
+	}
+
+	// final avalanche
+	h ^= h >> 33
+	h *= xxh64Prime2
+	h ^= h >> 29
+	h *= xxh64Prime3
+	h ^= h >> 32
+	return h
+}
+
+func xxh64Round(acc, input uint64) uint64 {
+	acc += input * xxh64Prime2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * xxh64Prime1
+}
+
+func xxh64MergeRound(acc, val uint64) uint64 {
+	acc ^= xxh64Round(0, val)
+	return acc*xxh64Prime1 + xxh64Prime4
+}
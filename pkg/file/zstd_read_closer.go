@@ -0,0 +1,40 @@
+package file
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var _ io.ReadCloser = (*ZstdReadCloser)(nil)
+
+// ZstdReadCloser decompresses a zstd stream, closing the underlying compressed stream when closed.
+type ZstdReadCloser struct {
+	decoder    *zstd.Decoder
+	compressed io.ReadCloser
+}
+
+// NewZstdReadCloser creates a new ZstdReadCloser that decompresses the given zstd compressed stream.
+func NewZstdReadCloser(compressed io.ReadCloser) (*ZstdReadCloser, error) {
+	decoder, err := zstd.NewReader(compressed)
+	if err != nil {
+		_ = compressed.Close()
+		return nil, fmt.Errorf("unable to create zstd reader: %w", err)
+	}
+	return &ZstdReadCloser{
+		decoder:    decoder,
+		compressed: compressed,
+	}, nil
+}
+
+// Read implements the io.Reader interface for the decompressed stream.
+func (z *ZstdReadCloser) Read(p []byte) (int, error) {
+	return z.decoder.Read(p)
+}
+
+// Close releases the decoder and closes the underlying compressed stream.
+func (z *ZstdReadCloser) Close() error {
+	z.decoder.Close()
+	return z.compressed.Close()
+}
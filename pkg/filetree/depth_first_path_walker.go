@@ -15,8 +15,14 @@ import (
 // This is an arbitrarily large number (but not "too" large).
 const maxDirDepth = 500
 
+// maxVirtualPathDepth is the maximum number of path elements of the virtual paths returned by FileTree.AllPaths.
+const maxVirtualPathDepth = 128
+
 var ErrMaxTraversalDepth = errors.New("max allowable directory traversal depth reached (maybe a link cycle?)")
 
+// ErrMaxVisitedNodes is returned when a walk would visit more nodes than allowed by WalkConditions.MaxVisitedNodes.
+var ErrMaxVisitedNodes = errors.New("max allowable number of visited nodes reached")
+
 type FileNodeVisitor func(file.Path, filenode.FileNode) error
 
 type WalkConditions struct {
@@ -31,6 +37,41 @@ type WalkConditions struct {
 	// Whether we should consider children of this Node to be included in the traversal path.
 	// Return true to traverse children of this Node.
 	ShouldContinueBranch func(file.Path, filenode.FileNode) bool
+
+	// MaxDepth is the maximum number of path elements below the walk starting path that will be traversed; nodes
+	// deeper than this are neither visited nor traversed (0 means no limit beyond the link cycle protection).
+	MaxDepth int
+
+	// MaxVisitedNodes is the maximum number of nodes the walk will visit; the walk stops with ErrMaxVisitedNodes when
+	// another node would be visited (0 means no limit).
+	MaxVisitedNodes int
+
+	// SkipPathPrefixes are paths whose entire subtree (including the path itself) are neither visited nor traversed
+	// (e.g. "/usr/lib/node_modules"). Prefixes are matched on whole path elements.
+	SkipPathPrefixes []file.Path
+
+	// SkipPseudoDirectories prevents visiting directories that were implicitly added as the parent of another path
+	// (they have no file reference). Children of these directories are still traversed.
+	SkipPseudoDirectories bool
+}
+
+// skipPath indicates if the given (normalized) path is within any subtree that should be skipped.
+func (c WalkConditions) skipPath(p file.Path) bool {
+	for _, prefix := range c.SkipPathPrefixes {
+		prefix = prefix.Normalize()
+		if prefix == "/" || p == prefix || strings.HasPrefix(string(p), string(prefix)+file.DirSeparator) {
+			return true
+		}
+	}
+	return false
+}
+
+// shouldVisit indicates if the visitor should be called for the given node.
+func (c WalkConditions) shouldVisit(p file.Path, fn filenode.FileNode) bool {
+	if c.SkipPseudoDirectories && fn.FileType == file.TypeDir && fn.Reference == nil {
+		return false
+	}
+	return c.ShouldVisit == nil || c.ShouldVisit(p, fn)
 }
 
 // DepthFirstPathWalker implements stateful depth-first Tree traversal.
@@ -39,6 +80,7 @@ type DepthFirstPathWalker struct {
 	tree         *FileTree
 	pathStack    file.PathStack
 	visitedPaths file.PathSet
+	visitCount   int
 	conditions   WalkConditions
 }
 
@@ -57,6 +99,7 @@ func NewDepthFirstPathWalker(tree *FileTree, visitor FileNodeVisitor, conditions
 // nolint:gocognit
 func (w *DepthFirstPathWalker) Walk(from file.Path) (file.Path, *filenode.FileNode, error) {
 	w.pathStack.Push(from)
+	fromDepth := pathDepth(from.Normalize())
 
 	var currentPath file.Path
 	var currentNode *filenode.FileNode
@@ -86,20 +129,33 @@ func (w *DepthFirstPathWalker) Walk(from file.Path) (file.Path, *filenode.FileNo
 		}
 		currentPath = currentPath.Normalize()
 
+		depth := pathDepth(currentPath) - fromDepth
+		if w.conditions.MaxDepth > 0 && depth > w.conditions.MaxDepth || w.conditions.skipPath(currentPath) {
+			continue
+		}
+
 		// visit
 		if w.visitor != nil && !w.visitedPaths.Contains(currentPath) {
-			if w.conditions.ShouldVisit == nil || w.conditions.ShouldVisit != nil && w.conditions.ShouldVisit(currentPath, *currentNode) {
+			if w.conditions.shouldVisit(currentPath, *currentNode) {
+				if w.conditions.MaxVisitedNodes > 0 && w.visitCount >= w.conditions.MaxVisitedNodes {
+					return currentPath, currentNode, ErrMaxVisitedNodes
+				}
 				err := w.visitor(currentPath, *currentNode)
 				if err != nil {
 					return currentPath, currentNode, err
 				}
 				w.visitedPaths.Add(currentPath)
+				w.visitCount++
 			}
 		}
 
 		if w.conditions.ShouldContinueBranch != nil && !w.conditions.ShouldContinueBranch(currentPath, *currentNode) {
 			continue
 		}
+		if w.conditions.MaxDepth > 0 && depth >= w.conditions.MaxDepth {
+			// children would be beyond the max depth, there is no need to list them
+			continue
+		}
 
 		// enqueue child paths
 		childPaths, err := w.tree.ListPaths(currentPath)
@@ -123,3 +179,16 @@ func (w *DepthFirstPathWalker) WalkAll() error {
 func (w *DepthFirstPathWalker) Visited(p file.Path) bool {
 	return w.visitedPaths.Contains(p)
 }
+
+// VisitCount returns the number of nodes visited so far.
+func (w *DepthFirstPathWalker) VisitCount() int {
+	return w.visitCount
+}
+
+// pathDepth returns the number of path elements within the given normalized path ("/" has a depth of 0).
+func pathDepth(p file.Path) int {
+	if p == "/" {
+		return 0
+	}
+	return strings.Count(string(p), file.DirSeparator)
+}
@@ -278,6 +278,135 @@ func TestDFS_WalkAll_MaxDirDepthTerminatesTraversal(t *testing.T) {
 
 }
 
+func TestDFS_WalkAll_MaxDepth(t *testing.T) {
+	tr, possiblePaths := dfsTestTree(t)
+
+	// delete paths we aren't expecting
+	for p := range possiblePaths {
+		if p != "/" && strings.Count(p, file.DirSeparator) > 2 {
+			delete(possiblePaths, p)
+		}
+	}
+
+	actualPaths := make(map[string]*file.Reference, 0)
+	visitor := func(path file.Path, node filenode.FileNode) error {
+		actualPaths[string(path)] = node.Reference
+		return nil
+	}
+
+	walker := NewDepthFirstPathWalker(tr, visitor, &WalkConditions{MaxDepth: 2})
+	if err := walker.WalkAll(); err != nil {
+		t.Fatalf("could not walk: %+v", err)
+	}
+
+	assertExpectedTraversal(t, possiblePaths, actualPaths)
+}
+
+func TestDFS_Walk_MaxDepthIsRelativeToStart(t *testing.T) {
+	tr, _ := dfsTestTree(t)
+
+	var actualPaths []file.Path
+	visitor := func(path file.Path, node filenode.FileNode) error {
+		actualPaths = append(actualPaths, path)
+		return nil
+	}
+
+	walker := NewDepthFirstPathWalker(tr, visitor, &WalkConditions{MaxDepth: 1})
+	if _, _, err := walker.Walk("/home/wagoodman"); err != nil {
+		t.Fatalf("could not walk: %+v", err)
+	}
+
+	expected := []file.Path{
+		"/home/wagoodman",
+		"/home/wagoodman/awesome",
+		"/home/wagoodman/b-file.txt",
+		"/home/wagoodman/file.txt",
+		"/home/wagoodman/some",
+	}
+	for _, d := range deep.Equal(expected, actualPaths) {
+		t.Errorf("   diff: %s", d)
+	}
+}
+
+func TestDFS_WalkAll_MaxVisitedNodes(t *testing.T) {
+	tr, _ := dfsTestTree(t)
+
+	var visited int
+	visitor := func(path file.Path, node filenode.FileNode) error {
+		visited++
+		return nil
+	}
+
+	walker := NewDepthFirstPathWalker(tr, visitor, &WalkConditions{MaxVisitedNodes: 5})
+	if err := walker.WalkAll(); !errors.Is(err, ErrMaxVisitedNodes) {
+		t.Fatalf("expected max visited nodes error, but got: %+v", err)
+	}
+	if visited != 5 || walker.VisitCount() != 5 {
+		t.Fatalf("expected 5 visits, got %d (count=%d)", visited, walker.VisitCount())
+	}
+
+	// a limit that is not exceeded is not an error
+	walker = NewDepthFirstPathWalker(tr, nil, &WalkConditions{MaxVisitedNodes: 1000})
+	if err := walker.WalkAll(); err != nil {
+		t.Fatalf("could not walk: %+v", err)
+	}
+}
+
+func TestDFS_WalkAll_SkipPathPrefixes(t *testing.T) {
+	tr, possiblePaths := dfsTestTree(t)
+
+	// delete paths we aren't expecting
+	for p := range possiblePaths {
+		if strings.HasPrefix(p, "/home/wagoodman") || strings.HasPrefix(p, "/place") {
+			delete(possiblePaths, p)
+		}
+	}
+
+	actualPaths := make(map[string]*file.Reference, 0)
+	visitor := func(path file.Path, node filenode.FileNode) error {
+		actualPaths[string(path)] = node.Reference
+		return nil
+	}
+
+	walker := NewDepthFirstPathWalker(tr, visitor, &WalkConditions{
+		// "/pla" must not match "/place", only whole path elements are matched
+		SkipPathPrefixes: []file.Path{"/home/wagoodman/", "/place", "/pla"},
+	})
+	if err := walker.WalkAll(); err != nil {
+		t.Fatalf("could not walk: %+v", err)
+	}
+
+	assertExpectedTraversal(t, possiblePaths, actualPaths)
+}
+
+func TestDFS_WalkAll_SkipPseudoDirectories(t *testing.T) {
+	tr := NewFileTree()
+	for _, p := range []file.Path{"/a/b/file.txt", "/a/c/file.txt"} {
+		if _, err := tr.AddFile(p); err != nil {
+			t.Fatalf("failed to add path ('%s'): %+v", p, err)
+		}
+	}
+	if _, err := tr.AddDir("/a/c"); err != nil {
+		t.Fatalf("failed to add dir: %+v", err)
+	}
+
+	var actualPaths []file.Path
+	visitor := func(path file.Path, node filenode.FileNode) error {
+		actualPaths = append(actualPaths, path)
+		return nil
+	}
+
+	walker := NewDepthFirstPathWalker(tr, visitor, &WalkConditions{SkipPseudoDirectories: true})
+	if err := walker.WalkAll(); err != nil {
+		t.Fatalf("could not walk: %+v", err)
+	}
+
+	expected := []file.Path{"/a/b/file.txt", "/a/c", "/a/c/file.txt"}
+	for _, d := range deep.Equal(expected, actualPaths) {
+		t.Errorf("   diff: %s", d)
+	}
+}
+
 func assertExpectedTraversal(t *testing.T, expected, actual map[string]*file.Reference) {
 	t.Helper()
 	if len(expected) != len(actual) {
@@ -0,0 +1,88 @@
+package filetree
+
+import (
+	"sort"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree/filenode"
+)
+
+// ChangeType describes how a single path differs between two trees.
+type ChangeType string
+
+const (
+	// Added indicates the path exists only in the upper tree.
+	Added ChangeType = "added"
+	// Removed indicates the path exists only in the lower tree.
+	Removed ChangeType = "removed"
+	// Modified indicates the path has the same file type in both trees, but refers to a different file (or link path).
+	Modified ChangeType = "modified"
+	// TypeChanged indicates the path has a different file type in each tree (e.g. a file replaced by a symlink).
+	TypeChanged ChangeType = "type-changed"
+)
+
+// Change is a single path difference between two trees.
+type Change struct {
+	Path file.Path
+	Type ChangeType
+	// Old is the reference to the path within the lower tree (nil if the path was added or has no reference)
+	Old *file.Reference
+	// New is the reference to the path within the upper tree (nil if the path was removed or has no reference)
+	New *file.Reference
+}
+
+// Diff returns all structural changes needed to go from the lower tree to the upper tree, sorted by path. No link
+// resolution is performed. Paths are considered modified when they refer to a different file reference (e.g. the path
+// was rewritten by a layer) or a different link path; implicitly added directories (without a reference) are only
+// reported when they are added, removed, or change type. A nil tree is treated as an empty tree.
+func Diff(lower, upper *FileTree) []Change {
+	lowerNodes := diffNodes(lower)
+	upperNodes := diffNodes(upper)
+
+	var changes []Change
+	for p, old := range lowerNodes {
+		current, ok := upperNodes[p]
+		if !ok {
+			changes = append(changes, Change{Path: p, Type: Removed, Old: old.Reference})
+			continue
+		}
+		switch {
+		case old.FileType != current.FileType:
+			changes = append(changes, Change{Path: p, Type: TypeChanged, Old: old.Reference, New: current.Reference})
+		case !sameReference(old.Reference, current.Reference) || old.LinkPath != current.LinkPath:
+			changes = append(changes, Change{Path: p, Type: Modified, Old: old.Reference, New: current.Reference})
+		}
+	}
+	for p, current := range upperNodes {
+		if _, ok := lowerNodes[p]; !ok {
+			changes = append(changes, Change{Path: p, Type: Added, New: current.Reference})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes
+}
+
+func diffNodes(t *FileTree) map[file.Path]*filenode.FileNode {
+	nodes := make(map[file.Path]*filenode.FileNode)
+	if t == nil {
+		return nodes
+	}
+	for _, n := range t.tree.Nodes() {
+		fn, ok := n.(*filenode.FileNode)
+		if !ok {
+			continue
+		}
+		nodes[fn.RealPath] = fn
+	}
+	return nodes
+}
+
+func sameReference(a, b *file.Reference) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.ID() == b.ID()
+}
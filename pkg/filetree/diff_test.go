@@ -0,0 +1,63 @@
+package filetree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	lower := NewFileTree()
+	unchanged, err := lower.AddFile("/etc/hostname")
+	require.NoError(t, err)
+	removed, err := lower.AddFile("/etc/removed")
+	require.NoError(t, err)
+	overwritten, err := lower.AddFile("/etc/passwd")
+	require.NoError(t, err)
+	retyped, err := lower.AddFile("/bin/sh")
+	require.NoError(t, err)
+	relinked, err := lower.AddSymLink("/lib", "/usr/lib")
+	require.NoError(t, err)
+
+	upper, err := lower.Copy()
+	require.NoError(t, err)
+	require.NoError(t, upper.RemovePath("/etc/removed"))
+	require.NoError(t, upper.RemovePath("/etc/passwd"))
+	replaced, err := upper.AddFile("/etc/passwd")
+	require.NoError(t, err)
+	require.NoError(t, upper.RemovePath("/bin/sh"))
+	symlink, err := upper.AddSymLink("/bin/sh", "/bin/busybox")
+	require.NoError(t, err)
+	require.NoError(t, upper.RemovePath("/lib"))
+	newLink, err := upper.AddSymLink("/lib", "/lib64")
+	require.NoError(t, err)
+	added, err := upper.AddFile("/opt/app/run")
+	require.NoError(t, err)
+
+	expected := []Change{
+		{Path: "/bin/sh", Type: TypeChanged, Old: retyped, New: symlink},
+		{Path: "/etc/passwd", Type: Modified, Old: overwritten, New: replaced},
+		{Path: "/etc/removed", Type: Removed, Old: removed},
+		{Path: "/lib", Type: Modified, Old: relinked, New: newLink},
+		{Path: "/opt", Type: Added},
+		{Path: "/opt/app", Type: Added},
+		{Path: "/opt/app/run", Type: Added, New: added},
+	}
+	assert.Equal(t, expected, Diff(lower, upper))
+
+	_, ref, err := upper.File("/etc/hostname")
+	require.NoError(t, err)
+	assert.Equal(t, unchanged.ID(), ref.ID())
+}
+
+func TestDiff_NilTrees(t *testing.T) {
+	tr := NewFileTree()
+	ref, err := tr.AddFile("/a")
+	require.NoError(t, err)
+
+	assert.Empty(t, Diff(nil, nil))
+	assert.Equal(t, []Change{{Path: "/", Type: Added}, {Path: "/a", Type: Added, New: ref}}, Diff(nil, tr))
+	assert.Equal(t, []Change{{Path: "/", Type: Removed}, {Path: "/a", Type: Removed, Old: ref}}, Diff(tr, nil))
+	assert.Empty(t, Diff(tr, tr))
+}
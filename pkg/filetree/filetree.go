@@ -3,9 +3,13 @@ package filetree
 import (
 	"errors"
 	"fmt"
+	"io/fs"
 	"path"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/anchore/stereoscope/internal"
 	"github.com/anchore/stereoscope/pkg/file"
@@ -18,9 +22,15 @@ import (
 var ErrRemovingRoot = errors.New("cannot remove the root path (`/`) from the FileTree")
 var ErrLinkCycleDetected = errors.New("cycle during symlink resolution")
 
+// ErrStopGlob may be returned by the function given to FilesByGlobFunc to stop the traversal early (without error).
+var ErrStopGlob = errors.New("stop glob")
+
 // FileTree represents a file/directory Tree
 type FileTree struct {
 	tree *tree.Tree
+	// index is built on first use (see Index) and maintained as paths are added and removed thereafter
+	index     *Index
+	indexLock sync.Mutex
 }
 
 // NewFileTree creates a new FileTree instance.
@@ -35,10 +45,54 @@ func NewFileTree() *FileTree {
 	}
 }
 
-// Copy returns a Copy of the current FileTree.
+// Copy returns a Copy of the current FileTree in constant time. The copy shares all structure with the original tree
+// (copy-on-write), so only the paths modified within either tree afterwards are cloned. The Index is not copied (it is
+// built again on first use of the copy).
 func (t *FileTree) Copy() (*FileTree, error) {
-	ct := NewFileTree()
-	ct.tree = t.tree.Copy()
+	return &FileTree{
+		tree: t.tree.Copy(),
+	}, nil
+}
+
+// Index returns the basename and extension Index of the FileTree, building it on first use. Once built, the index is
+// kept up to date as paths are added to or removed from the FileTree.
+func (t *FileTree) Index() *Index {
+	t.indexLock.Lock()
+	defer t.indexLock.Unlock()
+	if t.index == nil {
+		t.index = newIndex(t)
+	}
+	return t.index
+}
+
+// unindex removes the given nodes from the Index (if it has been built).
+func (t *FileTree) unindex(nodes node.Nodes) {
+	if t.index == nil {
+		return
+	}
+	for _, n := range nodes {
+		t.index.remove(n.(*filenode.FileNode).RealPath)
+	}
+}
+
+// CopyWithReferences returns a copy of the FileTree where every file.Reference has been replaced with the result of
+// the given function (given the original node).
+func (t *FileTree) CopyWithReferences(replace func(filenode.FileNode) *file.Reference) (*FileTree, error) {
+	ct, err := t.Copy()
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range ct.tree.Nodes() {
+		fn := n.(*filenode.FileNode)
+		if fn.Reference == nil {
+			continue
+		}
+		replacement := fn.Copy().(*filenode.FileNode)
+		replacement.Reference = replace(*fn)
+		if err := ct.tree.Replace(fn, replacement); err != nil {
+			return nil, fmt.Errorf("unable to replace reference for path=%q: %w", fn.RealPath, err)
+		}
+	}
 	return ct, nil
 }
 
@@ -74,6 +128,61 @@ func (t *FileTree) AllRealPaths() []file.Path {
 	return files
 }
 
+// AllPaths returns all virtual paths within the tree (sorted), that is all real paths in addition to every path
+// reachable through symlinked (or hardlinked) ancestor directories (e.g. "/bin/ls" when "/bin -> /usr/bin"). Links
+// are not followed into a directory that was already traversed along the same path (a link cycle), and no paths
+// deeper than maxVirtualPathDepth path elements are returned.
+func (t *FileTree) AllPaths() ([]file.Path, error) {
+	// the real path of every directory visited so far, keyed by the virtual path
+	realDirs := make(map[file.Path]file.Path)
+	var paths []file.Path
+
+	visitor := func(p file.Path, f filenode.FileNode) error {
+		paths = append(paths, p)
+		if f.FileType == file.TypeDir {
+			realDirs[p] = f.RealPath
+		}
+		return nil
+	}
+
+	conditions := WalkConditions{
+		MaxDepth: maxVirtualPathDepth,
+		ShouldContinueBranch: func(p file.Path, f filenode.FileNode) bool {
+			if f.RealPath == p {
+				return true
+			}
+			for ancestor := file.Path(path.Dir(string(p))); ; ancestor = file.Path(path.Dir(string(ancestor))) {
+				if realDirs[ancestor] == f.RealPath {
+					return false
+				}
+				if ancestor == "/" {
+					return true
+				}
+			}
+		},
+	}
+
+	if err := t.Walk(visitor, &conditions); err != nil {
+		return nil, err
+	}
+
+	sort.Sort(file.Paths(paths))
+	return paths, nil
+}
+
+// CaseCollisions returns every set of real paths within the tree that collide under case-insensitive comparison (e.g.
+// "/etc/Foo" and "/etc/foo"), such that the tree cannot be faithfully extracted onto a case-insensitive filesystem
+// (see file.FindCaseCollisions).
+func (t *FileTree) CaseCollisions() [][]file.Path {
+	var paths []file.Path
+	for _, p := range t.AllRealPaths() {
+		if !p.IsWhiteout() {
+			paths = append(paths, p)
+		}
+	}
+	return file.FindCaseCollisions(paths)
+}
+
 func (t *FileTree) ListPaths(dir file.Path) ([]file.Path, error) {
 	n, err := t.node(dir, linkResolutionStrategy{
 		FollowAncestorLinks: true,
@@ -113,7 +222,19 @@ func (t *FileTree) ListPaths(dir file.Path) ([]file.Path, error) {
 
 // File fetches a file.Reference for the given path. Returns nil if the path does not exist in the FileTree.
 func (t *FileTree) File(path file.Path, options ...LinkResolutionOption) (bool, *file.Reference, error) {
+	return t.file(path, newLinkResolutionStrategy(options...))
+}
+
+// FileWithTrace fetches a file.Reference for the given path (the same as File), additionally returning every step taken
+// to resolve the path (nodes visited, links followed and fallbacks taken).
+func (t *FileTree) FileWithTrace(path file.Path, options ...LinkResolutionOption) (bool, *file.Reference, *ResolutionTrace, error) {
 	userStrategy := newLinkResolutionStrategy(options...)
+	userStrategy.trace = &ResolutionTrace{}
+	exists, ref, err := t.file(path, userStrategy)
+	return exists, ref, userStrategy.trace, err
+}
+
+func (t *FileTree) file(path file.Path, userStrategy linkResolutionStrategy) (bool, *file.Reference, error) {
 	// For:             /some/path/here
 	// Where:           /some/path -> /other/place
 	// And resolves to: /other/place/here
@@ -132,13 +253,16 @@ func (t *FileTree) File(path file.Path, options ...LinkResolutionOption) (bool,
 	// Therefore we can safely lookup the path first without worrying about symlink resolution yet... if there is a
 	// hit, return it! If not, fallback to symlink resolution.
 
-	currentNode, err := t.node(path, linkResolutionStrategy{})
+	currentNode, err := t.node(path, linkResolutionStrategy{trace: userStrategy.trace})
 	if err != nil {
 		return false, nil, err
 	}
-	if currentNode != nil && (!currentNode.IsLink() || currentNode.IsLink() && !userStrategy.FollowBasenameLinks) {
+	if currentNode != nil && (!currentNode.IsLink() || currentNode.IsLink() && !userStrategy.FollowBasenameLinks || currentNode.FileType == file.TypeHardLink && userStrategy.DoNotFollowHardLinks) {
 		return true, currentNode.Reference, nil
 	}
+	if currentNode != nil {
+		userStrategy.trace.fallback(path, "the path is a link, resolving links")
+	}
 
 	// symlink resolution!... within the context of container images (which is outside of the responsibility of this object)
 	// the only really valid resolution of symlinks is in squash trees (both for an image and a layer --NOT for trees
@@ -147,6 +271,8 @@ func (t *FileTree) File(path file.Path, options ...LinkResolutionOption) (bool,
 		FollowAncestorLinks:          true,
 		FollowBasenameLinks:          userStrategy.FollowBasenameLinks,
 		DoNotFollowDeadBasenameLinks: userStrategy.DoNotFollowDeadBasenameLinks,
+		DoNotFollowHardLinks:         userStrategy.DoNotFollowHardLinks,
+		trace:                        userStrategy.trace,
 	})
 	if currentNode != nil {
 		return true, currentNode.Reference, err
@@ -160,15 +286,18 @@ func (t *FileTree) node(p file.Path, strategy linkResolutionStrategy) (*filenode
 	if !strategy.FollowLinks() {
 		n := t.tree.Node(nodeID)
 		if n == nil {
+			strategy.trace.visit(normalizedPath, nil)
 			return nil, nil
 		}
-		return n.(*filenode.FileNode), nil
+		fn := n.(*filenode.FileNode)
+		strategy.trace.visit(normalizedPath, fn)
+		return fn, nil
 	}
 
 	var currentNode *filenode.FileNode
 	var err error
 	if strategy.FollowAncestorLinks {
-		currentNode, err = t.resolveAncestorLinks(normalizedPath)
+		currentNode, err = t.resolveAncestorLinks(normalizedPath, strategy.trace)
 		if err != nil {
 			return currentNode, err
 		}
@@ -177,6 +306,7 @@ func (t *FileTree) node(p file.Path, strategy linkResolutionStrategy) (*filenode
 		if n != nil {
 			currentNode = n.(*filenode.FileNode)
 		}
+		strategy.trace.visit(normalizedPath, currentNode)
 	}
 
 	// link resolution has come up with nothing, return what we have so far
@@ -185,23 +315,24 @@ func (t *FileTree) node(p file.Path, strategy linkResolutionStrategy) (*filenode
 	}
 
 	if strategy.FollowBasenameLinks {
-		currentNode, err = t.resolveNodeLinks(currentNode, !strategy.DoNotFollowDeadBasenameLinks)
+		currentNode, err = t.resolveNodeLinks(currentNode, !strategy.DoNotFollowDeadBasenameLinks, !strategy.DoNotFollowHardLinks, strategy.trace)
 	}
 	return currentNode, err
 }
 
 // return FileNode of the basename in the given path (no resolution is done at or past the basename). Note: it is
-// assumed that the given path has already been normalized.
-func (t *FileTree) resolveAncestorLinks(path file.Path) (*filenode.FileNode, error) {
+// assumed that the given path has already been normalized. All steps taken are recorded on the given trace (if any).
+func (t *FileTree) resolveAncestorLinks(path file.Path, trace *ResolutionTrace) (*filenode.FileNode, error) {
 	// performance optimization... see if there is a node at the path (as if it is a real path). If so,
 	// use it, otherwise, continue with ancestor resolution
-	currentNode, err := t.node(path, linkResolutionStrategy{})
+	currentNode, err := t.node(path, linkResolutionStrategy{trace: trace})
 	if err != nil {
 		return nil, err
 	}
 	if currentNode != nil {
 		return currentNode, nil
 	}
+	trace.fallback(path, "no node at the path, resolving links within the ancestor paths")
 
 	var pathParts = strings.Split(string(path), file.DirSeparator)
 	var currentPathStr string
@@ -219,7 +350,7 @@ func (t *FileTree) resolveAncestorLinks(path file.Path) (*filenode.FileNode, err
 		currentPathStr = string(currentPath)
 
 		// fetch the Node with NO link resolution strategy
-		currentNode, err = t.node(currentPath, linkResolutionStrategy{})
+		currentNode, err = t.node(currentPath, linkResolutionStrategy{trace: trace})
 		if err != nil {
 			// should never occur
 			return nil, err
@@ -248,7 +379,7 @@ func (t *FileTree) resolveAncestorLinks(path file.Path) (*filenode.FileNode, err
 		// links until the next Node is resolved (or not).
 		isLastPart := idx == len(pathParts)-1
 		if !isLastPart && currentNode.IsLink() {
-			currentNode, err = t.resolveNodeLinks(currentNode, true)
+			currentNode, err = t.resolveNodeLinks(currentNode, true, true, trace)
 			if err != nil {
 				// only expected to happen on cycles
 				return currentNode, err
@@ -265,8 +396,9 @@ func (t *FileTree) resolveAncestorLinks(path file.Path) (*filenode.FileNode, err
 }
 
 // followNode takes the given FileNode and resolves all links at the base of the real path for the node (this implies
-// that NO ancestors are considered).
-func (t *FileTree) resolveNodeLinks(n *filenode.FileNode, followDeadBasenameLinks bool) (*filenode.FileNode, error) {
+// that NO ancestors are considered). When hardlinks are not followed, resolution stops at the first hardlink found. All
+// steps taken are recorded on the given trace (if any).
+func (t *FileTree) resolveNodeLinks(n *filenode.FileNode, followDeadBasenameLinks, followHardLinks bool, trace *ResolutionTrace) (*filenode.FileNode, error) {
 	if n == nil {
 		return nil, fmt.Errorf("cannot resolve links with nil Node given")
 	}
@@ -286,6 +418,7 @@ func (t *FileTree) resolveNodeLinks(n *filenode.FileNode, followDeadBasenameLink
 		}
 
 		if alreadySeen.Contains(string(currentNode.RealPath)) {
+			trace.fallback(currentNode.RealPath, "link cycle detected")
 			return nil, ErrLinkCycleDetected
 		}
 
@@ -295,6 +428,11 @@ func (t *FileTree) resolveNodeLinks(n *filenode.FileNode, followDeadBasenameLink
 			break
 		}
 
+		if !followHardLinks && currentNode.FileType == file.TypeHardLink {
+			trace.fallback(currentNode.RealPath, "hardlinks are not followed, stopping at the hardlink")
+			break
+		}
+
 		// prepare for the next iteration
 		alreadySeen.Add(string(currentNode.RealPath))
 
@@ -319,7 +457,8 @@ func (t *FileTree) resolveNodeLinks(n *filenode.FileNode, followDeadBasenameLink
 		lastNode = currentNode
 
 		// get the next Node (based on the next path)
-		currentNode, err = t.resolveAncestorLinks(nextPath)
+		trace.follow(currentNode.RealPath, nextPath)
+		currentNode, err = t.resolveAncestorLinks(nextPath, trace)
 		if err != nil {
 			// only expected to occur upon cycle detection
 			return currentNode, err
@@ -327,16 +466,179 @@ func (t *FileTree) resolveNodeLinks(n *filenode.FileNode, followDeadBasenameLink
 	}
 
 	if currentNode == nil && !followDeadBasenameLinks {
+		if lastNode != nil {
+			trace.fallback(lastNode.RealPath, "dead link, returning the last link that resolved")
+		}
 		return lastNode, nil
 	}
 
 	return currentNode, nil
 }
 
-// FilesByGlob fetches zero to many file.References for the given glob pattern (considers symlinks).
+// FilesByGlob fetches zero to many file.References for the given glob pattern (considers symlinks). Beyond the
+// doublestar syntax ("**" and brace alternation such as "{a,b}"), bracket expressions support POSIX character classes
+// (e.g. "[[:alpha:]_]") and a leading literal "]" (e.g. "[]a]"), unless the LegacyGlobSyntax option is given.
 func (t *FileTree) FilesByGlob(query string, options ...LinkResolutionOption) ([]GlobResult, error) {
+	q, err := t.newGlobQuery(query, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	matches, err := doublestar.Glob(q.fs, q.pattern)
+	if err != nil {
+		return nil, err
+	}
+
 	results := make([]GlobResult, 0)
+	for _, match := range matches {
+		result, err := q.result(match)
+		if err != nil {
+			return nil, err
+		}
+		if result != nil {
+			results = append(results, *result)
+		}
+	}
+
+	return results, nil
+}
+
+// FilesByGlobFunc calls the given function for every match of the given glob pattern as the FileTree is traversed
+// (with the same semantics as FilesByGlob), without collecting all matches first. If the function returns an error then
+// the traversal stops and the error is returned, unless the error is ErrStopGlob (which stops the traversal without
+// error). Note: unlike FilesByGlob, matches are given in traversal order (which is not necessarily sorted).
+func (t *FileTree) FilesByGlobFunc(query string, fn func(GlobResult) error, options ...LinkResolutionOption) error {
+	q, err := t.newGlobQuery(query, options...)
+	if err != nil {
+		return err
+	}
+
+	err = doublestar.GlobWalk(q.fs, q.pattern, func(match string, _ fs.DirEntry) error {
+		result, err := q.result(match)
+		if err != nil {
+			return err
+		}
+		if result == nil {
+			return nil
+		}
+		return fn(*result)
+	})
+	if errors.Is(err, ErrStopGlob) {
+		return nil
+	}
+	return err
+}
+
+// FilesByGlobs fetches the matches of all of the given glob patterns (with the same semantics as FilesByGlob) in a
+// single traversal of the FileTree, which is much cheaper than calling FilesByGlob for each pattern. Results are keyed
+// by the pattern as given (every pattern has an entry, even without matches), and are ordered by the match path.
+func (t *FileTree) FilesByGlobs(patterns []string, options ...LinkResolutionOption) (map[string][]GlobResult, error) {
+	results := make(map[string][]GlobResult, len(patterns))
+	queries := make(map[string]*globQuery, len(patterns))
+	for _, pattern := range patterns {
+		q, err := t.newGlobQuery(pattern, options...)
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob pattern=%q: %w", pattern, err)
+		}
+		if !doublestar.ValidatePattern(q.pattern) {
+			return nil, fmt.Errorf("invalid glob pattern=%q: %w", pattern, doublestar.ErrBadPattern)
+		}
+		queries[pattern] = q
+		results[pattern] = make([]GlobResult, 0)
+	}
+	if len(queries) == 0 {
+		return results, nil
+	}
+
+	// only branches that could contain a match of any pattern are traversed (based on the leading path elements of
+	// each pattern without any glob syntax)
+	var bases []string
+	for _, q := range queries {
+		base, _ := doublestar.SplitPattern(q.pattern)
+		bases = append(bases, strings.TrimSuffix(base, file.DirSeparator)+file.DirSeparator)
+	}
+	couldMatch := func(p file.Path) bool {
+		dir := strings.TrimSuffix(string(p), file.DirSeparator) + file.DirSeparator
+		for _, base := range bases {
+			if strings.HasPrefix(dir, base) || strings.HasPrefix(base, dir) {
+				return true
+			}
+		}
+		return false
+	}
 
+	visitor := func(matchPath file.Path, _ filenode.FileNode) error {
+		var result *GlobResult
+		resolved := false
+		for pattern, q := range queries {
+			matched, err := doublestar.Match(q.pattern, string(matchPath))
+			if err != nil {
+				return fmt.Errorf("invalid glob pattern=%q: %w", pattern, err)
+			}
+			if !matched {
+				continue
+			}
+			if !resolved {
+				// all patterns share the same link resolution options, so each path is only resolved once
+				if result, err = q.result(string(matchPath)); err != nil {
+					return err
+				}
+				resolved = true
+			}
+			if result != nil {
+				results[pattern] = append(results[pattern], *result)
+			}
+		}
+		return nil
+	}
+
+	var walkErr error
+	conditions := WalkConditions{
+		ShouldContinueBranch: func(p file.Path, f filenode.FileNode) bool {
+			if !couldMatch(p) {
+				return false
+			}
+			if f.RealPath == p {
+				// no links were followed to get here, so there cannot be a cycle
+				return true
+			}
+			// follow link cycles exactly as far as the glob matcher does (see osAdapter)
+			inLoop, err := isInPathResolutionLoop(string(p), t)
+			if err != nil {
+				walkErr = err
+				return false
+			}
+			return !inLoop
+		},
+	}
+
+	if err := t.Walk(visitor, &conditions); err != nil {
+		return nil, err
+	}
+	if walkErr != nil {
+		return nil, walkErr
+	}
+
+	for pattern := range results {
+		matches := results[pattern]
+		sort.Slice(matches, func(i, j int) bool {
+			return matches[i].MatchPath < matches[j].MatchPath
+		})
+	}
+	return results, nil
+}
+
+// globQuery is a glob pattern (ready to be given to the glob matcher) along with the options to resolve matches with.
+type globQuery struct {
+	tree    *FileTree
+	fs      *osAdapter
+	pattern string
+	// strategy is the link resolution strategy for each match (excluding the trace)
+	strategy linkResolutionStrategy
+	tracing  bool
+}
+
+func (t *FileTree) newGlobQuery(query string, options ...LinkResolutionOption) (*globQuery, error) {
 	if len(query) == 0 {
 		return nil, fmt.Errorf("no glob pattern given")
 	}
@@ -347,53 +649,223 @@ func (t *FileTree) FilesByGlob(query string, options ...LinkResolutionOption) ([
 	}
 
 	doNotFollowDeadBasenameLinks := false
+	legacySyntax := false
+	tracing := false
 	for _, o := range options {
-		if o == DoNotFollowDeadBasenameLinks {
+		switch o {
+		case DoNotFollowDeadBasenameLinks:
 			doNotFollowDeadBasenameLinks = true
+		case LegacyGlobSyntax:
+			legacySyntax = true
+		case TraceLinkResolution:
+			tracing = true
+		}
+	}
+
+	if !legacySyntax {
+		translated, err := translateGlobPattern(query)
+		if err != nil {
+			return nil, err
 		}
+		query = translated
 	}
 
-	matches, err := doublestar.Glob(&osAdapter{
-		filetree:                     t,
-		doNotFollowDeadBasenameLinks: doNotFollowDeadBasenameLinks,
-	}, query)
+	return &globQuery{
+		tree: t,
+		fs: &osAdapter{
+			filetree:                     t,
+			doNotFollowDeadBasenameLinks: doNotFollowDeadBasenameLinks,
+		},
+		pattern: query,
+		strategy: linkResolutionStrategy{
+			FollowAncestorLinks:          true,
+			FollowBasenameLinks:          true,
+			DoNotFollowDeadBasenameLinks: doNotFollowDeadBasenameLinks,
+		},
+		tracing: tracing,
+	}, nil
+}
+
+// result resolves the given glob match, returning nil if the match does not resolve to a (non-directory) file.
+func (q *globQuery) result(match string) (*GlobResult, error) {
+	// consumers need to understand that these are absolute paths and not relative
+	// ex: directory resolver should stop at the dir input and not traverse up the filetree
+	matchPath := file.Path(match)
+	if !path.IsAbs(match) {
+		matchPath = file.Path(path.Join("/", match))
+	}
+	strategy := q.strategy
+	strategy.trace = newResolutionTrace(q.tracing)
+	fn, err := q.tree.node(matchPath, strategy)
 	if err != nil {
 		return nil, err
 	}
+	// the Node must exist and should not be a directory
+	if fn == nil || fn.FileType == file.TypeDir {
+		return nil, nil
+	}
+	result := GlobResult{
+		MatchPath: matchPath,
+		RealPath:  fn.RealPath,
+		// we should not be given a link Node UNLESS it is dead
+		IsDeadLink: fn.IsLink(),
+		Trace:      strategy.trace,
+	}
+	if fn.Reference != nil {
+		result.Reference = *fn.Reference
+	}
+	return &result, nil
+}
 
-	for _, match := range matches {
-		// consumers need to understand that these are absolute paths and not relative
-		// ex: directory resolver should stop at the dir input and not traverse up the filetree
-		matchPath := file.Path(match)
-		if !path.IsAbs(match) {
-			matchPath = file.Path(path.Join("/", match))
+// FilesByRegex fetches non-directory paths from the FileTree where either the virtual path (the path as requested,
+// possibly traversing symlinked directories) or the real path matches the given regular expression. The tree is
+// walked once and symlinks are resolved with the same semantics as FilesByGlob.
+func (t *FileTree) FilesByRegex(pattern string, options ...LinkResolutionOption) ([]GlobResult, error) {
+	if len(pattern) == 0 {
+		return nil, fmt.Errorf("no regex pattern given")
+	}
+
+	expr, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("unable to compile regex pattern=%q: %w", pattern, err)
+	}
+
+	doNotFollowDeadBasenameLinks := false
+	tracing := false
+	for _, o := range options {
+		switch o {
+		case DoNotFollowDeadBasenameLinks:
+			doNotFollowDeadBasenameLinks = true
+		case TraceLinkResolution:
+			tracing = true
 		}
+	}
+
+	results := make([]GlobResult, 0)
+	visitor := func(matchPath file.Path, _ filenode.FileNode) error {
+		trace := newResolutionTrace(tracing)
 		fn, err := t.node(matchPath, linkResolutionStrategy{
 			FollowAncestorLinks:          true,
 			FollowBasenameLinks:          true,
 			DoNotFollowDeadBasenameLinks: doNotFollowDeadBasenameLinks,
+			trace:                        trace,
 		})
 		if err != nil {
-			return nil, err
+			return err
 		}
 		// the Node must exist and should not be a directory
-		if fn != nil && fn.FileType != file.TypeDir {
-			result := GlobResult{
-				MatchPath: matchPath,
-				RealPath:  fn.RealPath,
-				// we should not be given a link Node UNLESS it is dead
-				IsDeadLink: fn.IsLink(),
+		if fn == nil || fn.FileType == file.TypeDir {
+			return nil
+		}
+		if !expr.MatchString(string(matchPath)) && !expr.MatchString(string(fn.RealPath)) {
+			return nil
+		}
+		result := GlobResult{
+			MatchPath: matchPath,
+			RealPath:  fn.RealPath,
+			// we should not be given a link Node UNLESS it is dead
+			IsDeadLink: fn.IsLink(),
+			Trace:      trace,
+		}
+		if fn.Reference != nil {
+			result.Reference = *fn.Reference
+		}
+		results = append(results, result)
+		return nil
+	}
+
+	var walkErr error
+	conditions := WalkConditions{
+		ShouldContinueBranch: func(p file.Path, f filenode.FileNode) bool {
+			if f.RealPath == p {
+				// no links were followed to get here, so there cannot be a cycle
+				return true
 			}
-			if fn.Reference != nil {
-				result.Reference = *fn.Reference
+			// follow link cycles exactly as far as the glob matcher does (see FilesByGlobs)
+			inLoop, err := isInPathResolutionLoop(string(p), t)
+			if err != nil {
+				walkErr = err
+				return false
 			}
-			results = append(results, result)
-		}
+			return !inLoop
+		},
+	}
+
+	if err := t.Walk(visitor, &conditions); err != nil {
+		return nil, err
+	}
+	if walkErr != nil {
+		return nil, walkErr
 	}
 
 	return results, nil
 }
 
+// LinksTo returns the real paths of all symlinks and hardlinks within the Tree that resolve (directly or through
+// other links) to the given path. If the given path is itself a link then all other links that resolve to the same
+// final destination are returned.
+func (t *FileTree) LinksTo(realPath file.Path) []file.Path {
+	strategy := linkResolutionStrategy{
+		FollowAncestorLinks: true,
+		FollowBasenameLinks: true,
+	}
+
+	target, err := t.node(realPath, strategy)
+	if err != nil || target == nil {
+		return nil
+	}
+
+	var links []file.Path
+	for _, n := range t.tree.Nodes() {
+		fn := n.(*filenode.FileNode)
+		if !fn.IsLink() || fn.RealPath == realPath.Normalize() {
+			continue
+		}
+		resolved, err := t.node(fn.RealPath, strategy)
+		if err != nil {
+			// links within a cycle cannot resolve to anything
+			continue
+		}
+		if resolved != nil && resolved.RealPath == target.RealPath {
+			links = append(links, fn.RealPath)
+		}
+	}
+
+	sort.Sort(file.Paths(links))
+	return links
+}
+
+// LinkAliases returns a mapping of canonical real paths to the real paths of all symlinks and hardlinks within the Tree
+// that resolve (directly or through other links) to the canonical path, collapsing symlink farms (such as
+// /etc/alternatives) so that paths can be normalized to a single canonical location. Dead links and links within a
+// cycle are not included. Note: paths below a linked directory are not listed individually, only the directory link
+// itself is an alias of the canonical directory.
+func (t *FileTree) LinkAliases() map[file.Path][]file.Path {
+	strategy := linkResolutionStrategy{
+		FollowAncestorLinks: true,
+		FollowBasenameLinks: true,
+	}
+
+	aliases := make(map[file.Path][]file.Path)
+	for _, n := range t.tree.Nodes() {
+		fn := n.(*filenode.FileNode)
+		if !fn.IsLink() {
+			continue
+		}
+		resolved, err := t.node(fn.RealPath, strategy)
+		if err != nil || resolved == nil || resolved.IsLink() {
+			// links within a cycle and dead links have no canonical path
+			continue
+		}
+		aliases[resolved.RealPath] = append(aliases[resolved.RealPath], fn.RealPath)
+	}
+
+	for _, links := range aliases {
+		sort.Sort(file.Paths(links))
+	}
+	return aliases
+}
+
 // AddFile adds a new path representing a REGULAR file to the Tree. It also adds any ancestors of the path that are not already
 // present in the Tree. The resulting file.Reference of the new (leaf) addition is returned. Note: NO symlink or
 // hardlink resolution is performed on the given path --which implies that the given path MUST be a real path (have no
@@ -409,10 +881,7 @@ func (t *FileTree) AddFile(realPath file.Path) (*file.Reference, error) {
 			return nil, fmt.Errorf("path=%q already exists but is NOT a regular file", realPath)
 		}
 		// this is a regular file, provide a new or existing file.Reference
-		if fn.Reference == nil {
-			fn.Reference = file.NewFileReference(realPath)
-		}
-		return fn.Reference, nil
+		return t.ensureReference(fn)
 	}
 
 	// this is a new path... add the new Node + parents
@@ -437,10 +906,7 @@ func (t *FileTree) AddSymLink(realPath file.Path, linkPath file.Path) (*file.Ref
 			return nil, fmt.Errorf("path=%q already exists but is NOT a symlink file", realPath)
 		}
 		// this is a symlink file, provide a new or existing file.Reference
-		if fn.Reference == nil {
-			fn.Reference = file.NewFileReference(realPath)
-		}
-		return fn.Reference, nil
+		return t.ensureReference(fn)
 	}
 
 	// this is a new path... add the new Node + parents
@@ -465,10 +931,7 @@ func (t *FileTree) AddHardLink(realPath file.Path, linkPath file.Path) (*file.Re
 			return nil, fmt.Errorf("path=%q already exists but is NOT a symlink file", realPath)
 		}
 		// this is a symlink file, provide a new or existing file.Reference
-		if fn.Reference == nil {
-			fn.Reference = file.NewFileReference(realPath)
-		}
-		return fn.Reference, nil
+		return t.ensureReference(fn)
 	}
 
 	// this is a new path... add the new Node + parents
@@ -496,10 +959,7 @@ func (t *FileTree) AddDir(realPath file.Path) (*file.Reference, error) {
 			return nil, fmt.Errorf("path=%q already exists but is NOT a symlink file", realPath)
 		}
 		// this is a symlink file, provide a new or existing file.Reference
-		if fn.Reference == nil {
-			fn.Reference = file.NewFileReference(realPath)
-		}
-		return fn.Reference, nil
+		return t.ensureReference(fn)
 	}
 
 	// this is a new path... add the new Node + parents
@@ -511,6 +971,34 @@ func (t *FileTree) AddDir(realPath file.Path) (*file.Reference, error) {
 	return newFn.Reference, t.setFileNode(newFn)
 }
 
+// ensureReference returns the file.Reference of the given node within the tree, adding a new file.Reference if the
+// node has none. The node is replaced instead of modified in place, since nodes may be shared with copies of the tree.
+func (t *FileTree) ensureReference(fn *filenode.FileNode) (*file.Reference, error) {
+	if fn.Reference != nil {
+		return fn.Reference, nil
+	}
+	replacement := fn.Copy().(*filenode.FileNode)
+	replacement.Reference = file.NewFileReference(fn.RealPath)
+	if err := t.tree.Replace(fn, replacement); err != nil {
+		return nil, err
+	}
+	return replacement.Reference, nil
+}
+
+// AddFileNode adds a copy of the given node (keeping the existing file.Reference) to the Tree, replacing any existing
+// node at the same path. Any missing ancestors are added without a file.Reference. This is useful for rebuilding a
+// Tree from the nodes of other Trees (e.g. a cached squash tree). Note: NO symlink or hardlink resolution is performed
+// on the given path --which implies that the given path MUST be a real path (have no links in constituent paths)
+func (t *FileTree) AddFileNode(fn filenode.FileNode) error {
+	n := fn.Copy().(*filenode.FileNode)
+	if n.RealPath != file.DirSeparator {
+		if err := t.addParentPaths(n.RealPath); err != nil {
+			return err
+		}
+	}
+	return t.setFileNode(n)
+}
+
 // addParentPaths adds paths into the Tree for all constituent paths, but does NOT attach a file.Reference for each new path.
 // if the parent already exists, nothing is done and the function returns with no error. Note: NO symlink or hardlink
 // resolution is performed on the given path --which implies that the given path MUST be a real path (have no
@@ -577,7 +1065,13 @@ func (t *FileTree) setFileNode(fn *filenode.FileNode) error {
 		return fmt.Errorf("unable to find parent path=%q while adding path=%q", parentPath, fn.RealPath)
 	}
 
-	return t.tree.AddChild(parentNode, fn)
+	if err := t.tree.AddChild(parentNode, fn); err != nil {
+		return err
+	}
+	if t.index != nil {
+		t.index.add(fn.RealPath)
+	}
+	return nil
 }
 
 // RemovePath deletes the file.Reference from the FileTree by the given path. If the basename of the given path
@@ -599,10 +1093,11 @@ func (t *FileTree) RemovePath(path file.Path) error {
 		return nil
 	}
 
-	_, err = t.tree.RemoveNode(fn)
+	removed, err := t.tree.RemoveNode(fn)
 	if err != nil {
 		return err
 	}
+	t.unindex(removed)
 	return nil
 }
 
@@ -622,10 +1117,11 @@ func (t *FileTree) RemoveChildPaths(path file.Path) error {
 		return nil
 	}
 	for _, child := range t.tree.Children(fn) {
-		_, err := t.tree.RemoveNode(child)
+		removed, err := t.tree.RemoveNode(child)
 		if err != nil {
 			return err
 		}
+		t.unindex(removed)
 	}
 	return nil
 }
@@ -692,14 +1188,24 @@ func (t *FileTree) Walk(fn func(path file.Path, f filenode.FileNode) error, cond
 // given Tree is the top Tree).
 // nolint:gocognit,funlen
 func (t *FileTree) merge(upper *FileTree) error {
+	return t.mergeWithStrategy(upper, AUFSMergeStrategy())
+}
+
+// mergeWithStrategy merges the given upper tree onto this tree, interpreting whiteouts and opaque directories within
+// the upper tree with the given strategy.
+func (t *FileTree) mergeWithStrategy(upper *FileTree, strategy MergeStrategy) error {
 	conditions := tree.WalkConditions{
 		ShouldContinueBranch: func(n node.Node) bool {
-			p := file.Path(n.ID())
-			return !p.IsWhiteout()
+			fn, ok := n.(*filenode.FileNode)
+			if !ok {
+				return true
+			}
+			_, whiteout := strategy.Whiteout(upper, fn)
+			return !whiteout && !strategy.Marker(upper, fn)
 		},
 		ShouldVisit: func(n node.Node) bool {
-			p := file.Path(n.ID())
-			return !p.IsDirWhiteout()
+			fn, ok := n.(*filenode.FileNode)
+			return !ok || !strategy.Marker(upper, fn)
 		},
 	}
 
@@ -709,20 +1215,15 @@ func (t *FileTree) merge(upper *FileTree) error {
 		}
 		upperNode := n.(*filenode.FileNode)
 		// opaque directories must be processed first
-		if upper.hasOpaqueDirectory(upperNode.RealPath) {
+		if upperNode.FileType == file.TypeDir && strategy.Opaque(upper, upperNode) {
 			err := t.RemoveChildPaths(upperNode.RealPath)
 			if err != nil {
 				return fmt.Errorf("filetree merge failed to remove child paths (upperPath=%s): %w", upperNode.RealPath, err)
 			}
 		}
 
-		if upperNode.RealPath.IsWhiteout() {
-			lowerPath, err := upperNode.RealPath.UnWhiteoutPath()
-			if err != nil {
-				return fmt.Errorf("filetree merge failed to find original upperPath for whiteout (upperPath=%s): %w", upperNode.RealPath, err)
-			}
-
-			err = t.RemovePath(lowerPath)
+		if lowerPath, ok := strategy.Whiteout(upper, upperNode); ok {
+			err := t.RemovePath(lowerPath)
 			if err != nil {
 				return fmt.Errorf("filetree merge failed to remove upperPath (upperPath=%s): %w", lowerPath, err)
 			}
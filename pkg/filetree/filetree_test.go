@@ -9,6 +9,7 @@ import (
 	"github.com/anchore/stereoscope/pkg/file"
 	"github.com/anchore/stereoscope/pkg/filetree/filenode"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestFileTree_AddPath(t *testing.T) {
@@ -325,6 +326,560 @@ func TestFileTree_FilesByGlob(t *testing.T) {
 
 }
 
+func TestFileTree_FilesByGlob_Syntax(t *testing.T) {
+	tr := NewFileTree()
+	for _, p := range []string{
+		"/usr/lib/libc.so.6",
+		"/usr/lib64/libm.so.6",
+		"/usr/lib/os-release",
+		"/etc/os-release",
+		"/etc/rc1.d",
+		"/etc/rcS.d",
+		"/etc/rc_.d",
+		"/etc/]",
+	} {
+		_, err := tr.AddFile(file.Path(p))
+		require.NoError(t, err)
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		options []LinkResolutionOption
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:  "alternation",
+			query: "/usr/{lib,lib64}/*.so.[[:digit:]]",
+			want:  []string{"/usr/lib/libc.so.6", "/usr/lib64/libm.so.6"},
+		},
+		{
+			name:  "alternation across directories",
+			query: "{/etc,/usr/lib}/os-release",
+			want:  []string{"/etc/os-release", "/usr/lib/os-release"},
+		},
+		{
+			name:  "nested alternation with character classes",
+			query: "/etc/rc{[[:digit:]],[[:upper:]]}.d",
+			want:  []string{"/etc/rc1.d", "/etc/rcS.d"},
+		},
+		{
+			name:  "negated character class",
+			query: "/etc/rc[![:alnum:]].d",
+			want:  []string{"/etc/rc_.d"},
+		},
+		{
+			name:  "leading literal bracket",
+			query: "/etc/[]]",
+			want:  []string{"/etc/]"},
+		},
+		{
+			name:    "unknown character class",
+			query:   "/etc/rc[[:bogus:]].d",
+			wantErr: true,
+		},
+		{
+			name:    "legacy syntax",
+			query:   "/etc/rc[[:digit:]].d",
+			options: []LinkResolutionOption{LegacyGlobSyntax},
+			want:    []string{},
+		},
+		{
+			name:    "legacy syntax alternation",
+			query:   "/usr/{lib,lib64}/*.so.6",
+			options: []LinkResolutionOption{LegacyGlobSyntax},
+			want:    []string{"/usr/lib/libc.so.6", "/usr/lib64/libm.so.6"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			results, err := tr.FilesByGlob(test.query, test.options...)
+			if test.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			got := []string{}
+			for _, r := range results {
+				got = append(got, string(r.MatchPath))
+			}
+			assert.ElementsMatch(t, test.want, got)
+		})
+	}
+}
+
+func TestFileTree_FilesByGlobFunc(t *testing.T) {
+	tr := NewFileTree()
+	for _, p := range []string{
+		"/usr/lib/libc.so.6",
+		"/usr/lib/x86_64/libz.so",
+		"/usr/lib64/libm.so",
+		"/opt/app/lib/libapp.so",
+		"/etc/os-release",
+	} {
+		_, err := tr.AddFile(file.Path(p))
+		require.NoError(t, err)
+	}
+	_, err := tr.AddSymLink("/lib", "/usr/lib")
+	require.NoError(t, err)
+	_, err = tr.AddDir("/usr/lib/dir.so")
+	require.NoError(t, err)
+
+	for _, pattern := range []string{"**/*.so", "/usr/{lib,lib64}/*", "**/lib[[:alpha:]].so*", "/etc/os-release"} {
+		t.Run(pattern, func(t *testing.T) {
+			expected, err := tr.FilesByGlob(pattern)
+			require.NoError(t, err)
+
+			var actual []GlobResult
+			err = tr.FilesByGlobFunc(pattern, func(result GlobResult) error {
+				actual = append(actual, result)
+				return nil
+			})
+			require.NoError(t, err)
+			assert.ElementsMatch(t, expected, actual)
+		})
+	}
+
+	t.Run("stop early", func(t *testing.T) {
+		var actual []GlobResult
+		err := tr.FilesByGlobFunc("**/*.so", func(result GlobResult) error {
+			actual = append(actual, result)
+			return ErrStopGlob
+		})
+		require.NoError(t, err)
+		assert.Len(t, actual, 1)
+	})
+
+	t.Run("callback error", func(t *testing.T) {
+		expected := errors.New("bail")
+		calls := 0
+		err := tr.FilesByGlobFunc("**/*.so", func(GlobResult) error {
+			calls++
+			return expected
+		})
+		assert.ErrorIs(t, err, expected)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("no pattern", func(t *testing.T) {
+		err := tr.FilesByGlobFunc("", func(GlobResult) error {
+			return nil
+		})
+		assert.Error(t, err)
+	})
+}
+
+func TestFileTree_FilesByGlobs(t *testing.T) {
+	tr := NewFileTree()
+	for _, p := range []string{
+		"/usr/lib/libc.so.6",
+		"/usr/lib/x86_64/libz.so",
+		"/usr/lib64/libm.so",
+		"/usr/share/doc/README.txt",
+		"/opt/app/lib/libapp.so",
+		"/etc/os-release",
+		"/etc/rc1.d",
+	} {
+		_, err := tr.AddFile(file.Path(p))
+		require.NoError(t, err)
+	}
+	_, err := tr.AddSymLink("/lib", "/usr/lib")
+	require.NoError(t, err)
+	_, err = tr.AddSymLink("/usr/lib/libc.so", "libc.so.6")
+	require.NoError(t, err)
+	_, err = tr.AddSymLink("/etc/dead.so", "/nowhere.so")
+	require.NoError(t, err)
+	// a directory link cycle
+	_, err = tr.AddSymLink("/usr/lib/x86_64/loop", "..")
+	require.NoError(t, err)
+
+	patterns := []string{
+		"**/*.so",
+		"**/lib*.so*",
+		"/usr/{lib,lib64}/*",
+		"/lib/*.so",
+		"usr/share/**/*.txt",
+		"/etc/rc[[:digit:]].d",
+		"/etc/os-release",
+		"/missing/**",
+	}
+
+	for _, options := range [][]LinkResolutionOption{nil, {DoNotFollowDeadBasenameLinks}} {
+		actual, err := tr.FilesByGlobs(patterns, options...)
+		require.NoError(t, err)
+		require.Len(t, actual, len(patterns))
+
+		for _, pattern := range patterns {
+			expected, err := tr.FilesByGlob(pattern, options...)
+			require.NoError(t, err)
+			assert.ElementsMatch(t, expected, actual[pattern], "pattern=%q options=%v", pattern, options)
+		}
+	}
+
+	_, err = tr.FilesByGlobs([]string{"**/*.so", ""})
+	assert.Error(t, err)
+}
+
+func TestFileTree_AllPaths(t *testing.T) {
+	tr := NewFileTree()
+	_, err := tr.AddFile("/usr/bin/ls")
+	require.NoError(t, err)
+	_, err = tr.AddFile("/usr/lib/libc.so")
+	require.NoError(t, err)
+	_, err = tr.AddSymLink("/bin", "usr/bin")
+	require.NoError(t, err)
+	// a link back to an ancestor
+	_, err = tr.AddSymLink("/usr/lib/usr", "/usr")
+	require.NoError(t, err)
+	// a link cycle spanning two links
+	_, err = tr.AddSymLink("/a", "/b")
+	require.NoError(t, err)
+	_, err = tr.AddDir("/b")
+	require.NoError(t, err)
+	_, err = tr.AddSymLink("/b/c", "/a")
+	require.NoError(t, err)
+
+	paths, err := tr.AllPaths()
+	require.NoError(t, err)
+
+	assert.Equal(t, []file.Path{
+		"/",
+		"/a",
+		"/a/c",
+		"/b",
+		"/b/c",
+		"/bin",
+		"/bin/ls",
+		"/usr",
+		"/usr/bin",
+		"/usr/bin/ls",
+		"/usr/lib",
+		"/usr/lib/libc.so",
+		"/usr/lib/usr",
+	}, paths)
+
+	// all real paths are virtual paths as well
+	assert.Subset(t, paths, tr.AllRealPaths())
+}
+
+func TestFileTree_CaseCollisions(t *testing.T) {
+	tr := NewFileTree()
+	for _, p := range []file.Path{"/etc/hosts", "/etc/HOSTS", "/usr/Lib/Foo", "/usr/lib/foo", "/usr/bin/ls", "/etc/.wh.Hosts"} {
+		_, err := tr.AddFile(p)
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, [][]file.Path{
+		{"/etc/HOSTS", "/etc/hosts"},
+		{"/usr/Lib", "/usr/lib"},
+		{"/usr/Lib/Foo", "/usr/lib/foo"},
+	}, tr.CaseCollisions())
+}
+
+func TestFileTree_Copy(t *testing.T) {
+	original := NewFileTree()
+	_, err := original.AddFile("/etc/hosts")
+	require.NoError(t, err)
+	// an implicit directory (without a file.Reference)
+	_, err = original.AddFile("/usr/bin/ls")
+	require.NoError(t, err)
+
+	cp, err := original.Copy()
+	require.NoError(t, err)
+	assert.True(t, original.Equal(cp))
+
+	// changes to the copy do not affect the original
+	_, err = cp.AddFile("/etc/passwd")
+	require.NoError(t, err)
+	require.NoError(t, cp.RemovePath("/usr/bin"))
+	ref, err := cp.AddDir("/usr")
+	require.NoError(t, err)
+	require.NotNil(t, ref)
+
+	assert.True(t, original.HasPath("/usr/bin/ls"))
+	assert.False(t, original.HasPath("/etc/passwd"))
+	n, ok := original.Reader().Node(filenode.IDByPath("/usr")).(*filenode.FileNode)
+	require.True(t, ok)
+	assert.Nil(t, n.Reference)
+
+	assert.False(t, cp.HasPath("/usr/bin/ls"))
+	assert.True(t, cp.HasPath("/etc/passwd"))
+
+	// changes to the original do not affect the copy
+	require.NoError(t, original.RemovePath("/etc/hosts"))
+	assert.True(t, cp.HasPath("/etc/hosts"))
+	assert.False(t, original.HasPath("/etc/hosts"))
+}
+
+func TestFileTree_FilesByRegex(t *testing.T) {
+	tr := NewFileTree()
+
+	for _, p := range []string{
+		"/home/wagoodman/file.txt",
+		"/home/wagoodman/b-file.txt",
+		"/home/wagoodman/some/nested/spot/file.go",
+		"/place/example.gif",
+		"/sym-linked-dest/another/a-.gif",
+	} {
+		_, err := tr.AddFile(file.Path(p))
+		require.NoError(t, err)
+	}
+
+	_, err := tr.AddSymLink("/home/elsewhere/symlink", "/sym-linked-dest")
+	require.NoError(t, err)
+
+	_, err = tr.AddSymLink("/home/again/link.txt", "/home/wagoodman/file.txt")
+	require.NoError(t, err)
+
+	_, err = tr.AddSymLink("/home/again/dead.jpg", "../ialsojustdontexist")
+	require.NoError(t, err)
+
+	// link cycle
+	_, err = tr.AddSymLink("/home/wagoodman/home", "/home")
+	require.NoError(t, err)
+
+	tests := []struct {
+		pattern  string
+		options  []LinkResolutionOption
+		expected []string
+		err      bool
+	}{
+		{
+			pattern: `\.txt$`,
+			expected: []string{
+				"/home/wagoodman/file.txt",
+				"/home/wagoodman/b-file.txt",
+				"/home/again/link.txt",
+				// the first iteration of the link cycle is followed (the same as FilesByGlob)
+				"/home/wagoodman/home/again/link.txt",
+			},
+		},
+		{
+			// the link path does not match, but the real path does
+			pattern: `^/home/wagoodman/file\.txt$`,
+			expected: []string{
+				"/home/wagoodman/file.txt",
+				"/home/again/link.txt",
+				"/home/wagoodman/home/again/link.txt",
+			},
+		},
+		{
+			// virtual paths through linked directories are matched
+			pattern: `^/home/elsewhere/`,
+			expected: []string{
+				"/home/elsewhere/symlink/another/a-.gif",
+			},
+		},
+		{
+			pattern: `\.gif$`,
+			expected: []string{
+				"/place/example.gif",
+				"/sym-linked-dest/another/a-.gif",
+				"/home/elsewhere/symlink/another/a-.gif",
+				"/home/wagoodman/home/elsewhere/symlink/another/a-.gif",
+			},
+		},
+		{
+			// dead basename links are followed (to nothing) by default
+			pattern: `dead`,
+		},
+		{
+			pattern: `dead`,
+			options: []LinkResolutionOption{DoNotFollowDeadBasenameLinks},
+			expected: []string{
+				"/home/again/dead.jpg",
+				"/home/wagoodman/home/again/dead.jpg",
+			},
+		},
+		{
+			// directories are never matched
+			pattern: `^/home/wagoodman/some$`,
+		},
+		{
+			pattern: `[`,
+			err:     true,
+		},
+		{
+			pattern: ``,
+			err:     true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.pattern, func(t *testing.T) {
+			actual, err := tr.FilesByRegex(test.pattern, test.options...)
+			if test.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			var actualPaths []string
+			for _, r := range actual {
+				actualPaths = append(actualPaths, string(r.MatchPath))
+			}
+			assert.ElementsMatch(t, test.expected, actualPaths)
+		})
+	}
+}
+
+func TestFileTree_FilesByRegex_CrossLinkCycle(t *testing.T) {
+	tr := NewFileTree()
+
+	_, err := tr.AddFile("/b/f")
+	require.NoError(t, err)
+
+	// neither link points at its own ancestor, but together they form a cycle: /a -> /b, /b/c -> /a
+	_, err = tr.AddSymLink("/a", "/b")
+	require.NoError(t, err)
+	_, err = tr.AddSymLink("/b/c", "/a")
+	require.NoError(t, err)
+
+	regexResults, err := tr.FilesByRegex(`.*f$`)
+	require.NoError(t, err)
+
+	globResults, err := tr.FilesByGlob("**/f")
+	require.NoError(t, err)
+
+	var regexPaths, globPaths []string
+	for _, r := range regexResults {
+		regexPaths = append(regexPaths, string(r.MatchPath))
+	}
+	for _, r := range globResults {
+		globPaths = append(globPaths, string(r.MatchPath))
+	}
+
+	assert.ElementsMatch(t, []string{"/b/f", "/b/c/f", "/a/f", "/a/c/f"}, regexPaths)
+	assert.ElementsMatch(t, globPaths, regexPaths)
+}
+
+func TestFileTree_LinksTo(t *testing.T) {
+	tr := NewFileTree()
+
+	_, err := tr.AddFile("/usr/bin/busybox")
+	require.NoError(t, err)
+	_, err = tr.AddFile("/usr/bin/other")
+	require.NoError(t, err)
+	_, err = tr.AddFile("/etc/passwd")
+	require.NoError(t, err)
+
+	// direct links
+	_, err = tr.AddSymLink("/bin/sh", "/usr/bin/busybox")
+	require.NoError(t, err)
+	_, err = tr.AddSymLink("/usr/bin/ash", "busybox")
+	require.NoError(t, err)
+	_, err = tr.AddHardLink("/usr/bin/ls", "/usr/bin/busybox")
+	require.NoError(t, err)
+
+	// transitive link
+	_, err = tr.AddSymLink("/usr/local/bin/sh", "/bin/sh")
+	require.NoError(t, err)
+
+	// link through a linked directory
+	_, err = tr.AddSymLink("/sbin", "/usr/bin")
+	require.NoError(t, err)
+	_, err = tr.AddSymLink("/usr/local/bin/via-dir", "/sbin/busybox")
+	require.NoError(t, err)
+
+	// unrelated, dead, and cyclic links
+	_, err = tr.AddSymLink("/bin/other", "/usr/bin/other")
+	require.NoError(t, err)
+	_, err = tr.AddSymLink("/bin/dead", "/nowhere")
+	require.NoError(t, err)
+	_, err = tr.AddSymLink("/cycle/a", "/cycle/b")
+	require.NoError(t, err)
+	_, err = tr.AddSymLink("/cycle/b", "/cycle/a")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		path     file.Path
+		expected []file.Path
+	}{
+		{
+			name: "all links to a file",
+			path: "/usr/bin/busybox",
+			expected: []file.Path{
+				"/bin/sh",
+				"/usr/bin/ash",
+				"/usr/bin/ls",
+				"/usr/local/bin/sh",
+				"/usr/local/bin/via-dir",
+			},
+		},
+		{
+			name: "links to a link",
+			path: "/bin/sh",
+			expected: []file.Path{
+				"/usr/bin/ash",
+				"/usr/bin/ls",
+				"/usr/local/bin/sh",
+				"/usr/local/bin/via-dir",
+			},
+		},
+		{
+			name:     "links to a directory",
+			path:     "/usr/bin",
+			expected: []file.Path{"/sbin"},
+		},
+		{
+			name: "no links",
+			path: "/etc/passwd",
+		},
+		{
+			name: "missing path",
+			path: "/nowhere",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, tr.LinksTo(test.path))
+		})
+	}
+}
+
+func TestFileTree_LinkAliases(t *testing.T) {
+	tr := NewFileTree()
+
+	_, err := tr.AddFile("/usr/lib/jvm/java-11/bin/java")
+	require.NoError(t, err)
+	_, err = tr.AddFile("/usr/bin/busybox")
+	require.NoError(t, err)
+	_, err = tr.AddFile("/usr/bin/unaliased")
+	require.NoError(t, err)
+
+	// alternatives style symlink farm
+	_, err = tr.AddSymLink("/etc/alternatives/java", "/usr/lib/jvm/java-11/bin/java")
+	require.NoError(t, err)
+	_, err = tr.AddSymLink("/usr/bin/java", "/etc/alternatives/java")
+	require.NoError(t, err)
+
+	// relative, hardlink, and directory links
+	_, err = tr.AddSymLink("/usr/bin/ash", "busybox")
+	require.NoError(t, err)
+	_, err = tr.AddHardLink("/usr/bin/ls", "/usr/bin/busybox")
+	require.NoError(t, err)
+	_, err = tr.AddSymLink("/bin", "/usr/bin")
+	require.NoError(t, err)
+
+	// dead and cyclic links
+	_, err = tr.AddSymLink("/bin-dead", "/nowhere")
+	require.NoError(t, err)
+	_, err = tr.AddSymLink("/cycle/a", "/cycle/b")
+	require.NoError(t, err)
+	_, err = tr.AddSymLink("/cycle/b", "/cycle/a")
+	require.NoError(t, err)
+
+	expected := map[file.Path][]file.Path{
+		"/usr/lib/jvm/java-11/bin/java": {"/etc/alternatives/java", "/usr/bin/java"},
+		"/usr/bin/busybox":              {"/usr/bin/ash", "/usr/bin/ls"},
+		"/usr/bin":                      {"/bin"},
+	}
+	assert.Equal(t, expected, tr.LinkAliases())
+}
+
 func TestFileTree_Merge(t *testing.T) {
 	tr1 := NewFileTree()
 	tr1.AddFile("/home/wagoodman/awesome/file-1.txt")
@@ -877,3 +1432,130 @@ func TestFileTree_AllFiles(t *testing.T) {
 	}
 
 }
+
+func TestFileTree_File_DoNotFollowHardLinks(t *testing.T) {
+	tr := NewFileTree()
+	target, err := tr.AddFile("/usr/bin/tool")
+	require.NoError(t, err)
+	hardlink, err := tr.AddHardLink("/opt/tool", "/usr/bin/tool")
+	require.NoError(t, err)
+	_, err = tr.AddSymLink("/bin/tool", "/opt/tool")
+	require.NoError(t, err)
+
+	_, ref, err := tr.File("/bin/tool", FollowBasenameLinks)
+	require.NoError(t, err)
+	assert.Equal(t, target.ID(), ref.ID())
+
+	// the symlink is still followed, but resolution stops at the hardlink
+	_, ref, err = tr.File("/bin/tool", FollowBasenameLinks, DoNotFollowHardLinks)
+	require.NoError(t, err)
+	assert.Equal(t, hardlink.ID(), ref.ID())
+
+	_, ref, err = tr.File("/opt/tool", FollowBasenameLinks, DoNotFollowHardLinks)
+	require.NoError(t, err)
+	assert.Equal(t, hardlink.ID(), ref.ID())
+}
+
+func TestFileTree_FileWithTrace(t *testing.T) {
+	tr := NewFileTree()
+	target, err := tr.AddFile("/usr/lib/libc.so.6")
+	require.NoError(t, err)
+	_, err = tr.AddSymLink("/lib", "/usr/lib")
+	require.NoError(t, err)
+	_, err = tr.AddSymLink("/usr/lib/libc.so", "libc.so.6")
+	require.NoError(t, err)
+
+	exists, ref, trace, err := tr.FileWithTrace("/lib/libc.so", FollowBasenameLinks)
+	require.NoError(t, err)
+	require.True(t, exists)
+	assert.Equal(t, target.ID(), ref.ID())
+
+	expected := []ResolutionStep{
+		{Kind: NodeMissing, Path: "/lib/libc.so"},
+		{Kind: FallbackTaken, Path: "/lib/libc.so", Reason: "no node at the path, resolving links within the ancestor paths"},
+		{Kind: NodeVisited, Path: "/lib", Target: "/lib"},
+		{Kind: LinkFollowed, Path: "/lib", Target: "/usr/lib"},
+		{Kind: NodeVisited, Path: "/usr/lib", Target: "/usr/lib"},
+		{Kind: NodeVisited, Path: "/usr/lib/libc.so", Target: "/usr/lib/libc.so"},
+		{Kind: LinkFollowed, Path: "/usr/lib/libc.so", Target: "/usr/lib/libc.so.6"},
+		{Kind: NodeVisited, Path: "/usr/lib/libc.so.6", Target: "/usr/lib/libc.so.6"},
+	}
+	assert.Equal(t, expected, trace.Steps)
+
+	// the trace does not change the result
+	_, untraced, err := tr.File("/lib/libc.so", FollowBasenameLinks)
+	require.NoError(t, err)
+	assert.Equal(t, ref, untraced)
+}
+
+func TestFileTree_FileWithTrace_DeadLink(t *testing.T) {
+	tr := NewFileTree()
+	link, err := tr.AddSymLink("/etc/localtime", "/usr/share/zoneinfo/UTC")
+	require.NoError(t, err)
+
+	exists, ref, trace, err := tr.FileWithTrace("/etc/localtime", FollowBasenameLinks, DoNotFollowDeadBasenameLinks)
+	require.NoError(t, err)
+	require.True(t, exists)
+	assert.Equal(t, link.ID(), ref.ID())
+
+	last := trace.Steps[len(trace.Steps)-1]
+	assert.Equal(t, ResolutionStep{Kind: FallbackTaken, Path: "/etc/localtime", Reason: "dead link, returning the last link that resolved"}, last)
+	assert.Contains(t, trace.String(), "followed /etc/localtime -> /usr/share/zoneinfo/UTC")
+	assert.Contains(t, trace.String(), "missing /usr/share/zoneinfo/UTC")
+}
+
+func TestFileTree_FilesByGlob_TraceLinkResolution(t *testing.T) {
+	tr := NewFileTree()
+	_, err := tr.AddFile("/usr/lib/libc.so.6")
+	require.NoError(t, err)
+	_, err = tr.AddSymLink("/usr/lib/libc.so", "libc.so.6")
+	require.NoError(t, err)
+
+	results, err := tr.FilesByGlob("/usr/lib/libc.so")
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Nil(t, results[0].Trace)
+
+	results, err = tr.FilesByGlob("/usr/lib/libc.so", TraceLinkResolution)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, file.Path("/usr/lib/libc.so.6"), results[0].RealPath)
+	require.NotNil(t, results[0].Trace)
+	assert.Contains(t, results[0].Trace.Steps, ResolutionStep{Kind: LinkFollowed, Path: "/usr/lib/libc.so", Target: "/usr/lib/libc.so.6"})
+
+	results, err = tr.FilesByRegex("libc\\.so$", TraceLinkResolution)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.NotNil(t, results[0].Trace)
+	assert.Contains(t, results[0].Trace.Steps, ResolutionStep{Kind: LinkFollowed, Path: "/usr/lib/libc.so", Target: "/usr/lib/libc.so.6"})
+}
+
+func TestFileTree_AddFileNode(t *testing.T) {
+	source := NewFileTree()
+	ref, err := source.AddSymLink("/usr/lib/libc.so", "libc.so.6")
+	require.NoError(t, err)
+
+	srcNode, err := source.node("/usr/lib/libc.so", linkResolutionStrategy{})
+	require.NoError(t, err)
+
+	tr := NewFileTree()
+	require.NoError(t, tr.AddFileNode(*srcNode))
+
+	_, got, err := tr.File("/usr/lib/libc.so")
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	assert.Equal(t, ref.ID(), got.ID())
+	assert.True(t, tr.HasPath("/usr/lib"))
+
+	// replaces the implicit parent directory with a referenced one
+	dirRef, err := source.AddDir("/usr")
+	require.NoError(t, err)
+	dirNode, err := source.node("/usr", linkResolutionStrategy{})
+	require.NoError(t, err)
+	require.NoError(t, tr.AddFileNode(*dirNode))
+	_, got, err = tr.File("/usr")
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	assert.Equal(t, dirRef.ID(), got.ID())
+	assert.True(t, tr.HasPath("/usr/lib/libc.so"))
+}
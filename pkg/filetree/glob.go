@@ -24,6 +24,8 @@ type GlobResult struct {
 	RealPath   file.Path
 	IsDeadLink bool
 	Reference  file.Reference
+	// Trace is every step taken to resolve the match (only with the TraceLinkResolution option)
+	Trace *ResolutionTrace
 }
 
 // fileAdapter is an object meant to implement the doublestar.File for getting Lstat results for an entire directory.
@@ -59,6 +61,10 @@ func isInPathResolutionLoop(path string, ft *FileTree) (bool, error) {
 		if err != nil {
 			return false, err
 		}
+		if fn == nil {
+			// the path does not resolve (e.g. a dead link), so cannot double back on itself
+			return false, nil
+		}
 		allPathSet.Add(file.Path(fn.ID()))
 	}
 	// we want to allow for getting children out of the first iteration of a infinite path, but NOT allowing
@@ -0,0 +1,115 @@
+package filetree
+
+import (
+	"fmt"
+	"strings"
+)
+
+// posixCharacterClasses are the ranges matched by each POSIX bracket expression character class (e.g. "[:alpha:]"),
+// using the ASCII ("C" locale) definitions. The "word" class is not POSIX, however, it is commonly supported as well.
+var posixCharacterClasses = map[string][][2]rune{
+	"alnum":  {{'0', '9'}, {'A', 'Z'}, {'a', 'z'}},
+	"alpha":  {{'A', 'Z'}, {'a', 'z'}},
+	"blank":  {{' ', ' '}, {'\t', '\t'}},
+	"cntrl":  {{0x00, 0x1f}, {0x7f, 0x7f}},
+	"digit":  {{'0', '9'}},
+	"graph":  {{'!', '~'}},
+	"lower":  {{'a', 'z'}},
+	"print":  {{' ', '~'}},
+	"punct":  {{'!', '/'}, {':', '@'}, {'[', '`'}, {'{', '~'}},
+	"space":  {{'\t', '\r'}, {' ', ' '}},
+	"upper":  {{'A', 'Z'}},
+	"word":   {{'0', '9'}, {'A', 'Z'}, {'_', '_'}, {'a', 'z'}},
+	"xdigit": {{'0', '9'}, {'A', 'F'}, {'a', 'f'}},
+}
+
+// translateGlobPattern rewrites the given glob pattern into the syntax understood by the glob matcher: POSIX character
+// classes within bracket expressions (e.g. "[[:digit:]]") are replaced with the equivalent character ranges, and a
+// "]" immediately following the opening of a bracket expression (e.g. "[]a]") is treated as a literal, as with POSIX
+// shells. Brace alternation (e.g. "{a,b}") is natively supported by the matcher and is left as-is.
+func translateGlobPattern(pattern string) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			sb.WriteByte('\\')
+			if i+1 < len(pattern) {
+				i++
+				sb.WriteByte(pattern[i])
+			}
+		case '[':
+			end, expr, err := translateBracketExpression(pattern, i)
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(expr)
+			i = end
+		default:
+			sb.WriteByte(pattern[i])
+		}
+	}
+	return sb.String(), nil
+}
+
+// translateBracketExpression translates the bracket expression starting at the given index of the pattern, returning
+// the index of the closing "]" with the translated expression. Unterminated expressions are returned as-is (which the
+// matcher reports as a bad pattern).
+func translateBracketExpression(pattern string, start int) (int, string, error) {
+	var sb strings.Builder
+	sb.WriteByte('[')
+
+	i := start + 1
+	if i < len(pattern) && (pattern[i] == '!' || pattern[i] == '^') {
+		sb.WriteByte(pattern[i])
+		i++
+	}
+	if i < len(pattern) && pattern[i] == ']' {
+		sb.WriteString(`\]`)
+		i++
+	}
+
+	for ; i < len(pattern); i++ {
+		switch {
+		case pattern[i] == ']':
+			sb.WriteByte(']')
+			return i, sb.String(), nil
+		case pattern[i] == '\\':
+			sb.WriteByte('\\')
+			if i+1 < len(pattern) {
+				i++
+				sb.WriteByte(pattern[i])
+			}
+		case strings.HasPrefix(pattern[i:], "[:"):
+			end := strings.Index(pattern[i+2:], ":]")
+			if end < 0 {
+				sb.WriteByte('[')
+				continue
+			}
+			name := pattern[i+2 : i+2+end]
+			ranges, ok := posixCharacterClasses[name]
+			if !ok {
+				return 0, "", fmt.Errorf("unknown character class %q in glob pattern=%q", name, pattern)
+			}
+			for _, r := range ranges {
+				sb.WriteString(escapeGlobClassRune(r[0]))
+				if r[0] != r[1] {
+					sb.WriteByte('-')
+					sb.WriteString(escapeGlobClassRune(r[1]))
+				}
+			}
+			i += end + len("[::]") - 1
+		default:
+			sb.WriteByte(pattern[i])
+		}
+	}
+	return len(pattern) - 1, pattern[start:], nil
+}
+
+// escapeGlobClassRune escapes the given rune for use within a bracket expression (including any characters that are
+// significant to brace alternation, since the expression may be within an alternative).
+func escapeGlobClassRune(r rune) string {
+	if strings.ContainsRune(`\]-[^!{},`, r) {
+		return `\` + string(r)
+	}
+	return string(r)
+}
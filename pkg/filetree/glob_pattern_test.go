@@ -0,0 +1,37 @@
+package filetree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_translateGlobPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+		wantErr bool
+	}{
+		{pattern: "/usr/{lib,lib64}/*.so", want: "/usr/{lib,lib64}/*.so"},
+		{pattern: "/etc/[[:digit:]]", want: "/etc/[0-9]"},
+		{pattern: "/etc/[![:alpha:]_]*", want: "/etc/[!A-Za-z_]*"},
+		{pattern: "/etc/[[:xdigit:][:space:]]", want: "/etc/[0-9A-Fa-f\t-\r ]"},
+		{pattern: "/etc/{x,[[:punct:]]}", want: "/etc/{x,[\\!-/:-@\\[-`\\{-~]}"},
+		{pattern: "/etc/[]a]", want: "/etc/[\\]a]"},
+		{pattern: "/etc/\\[[:alpha:]]", want: "/etc/\\[[:alpha:]]"},
+		{pattern: "/etc/[[:alpha:]", want: "/etc/[[:alpha:]"},
+		{pattern: "/etc/[[:bogus:]]", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.pattern, func(t *testing.T) {
+			got, err := translateGlobPattern(test.pattern)
+			if test.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
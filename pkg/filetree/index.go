@@ -0,0 +1,104 @@
+package filetree
+
+import (
+	"path"
+	"sort"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree/filenode"
+)
+
+// Index maps the basenames and file extensions of all paths within a FileTree to those paths, such that the most
+// common queries (e.g. all "package.json" files, or all ".jar" files) do not need to walk the tree (see FileTree.Index).
+// Only real paths are indexed (not paths that traverse links), and the index is kept up to date as the tree is
+// modified.
+type Index struct {
+	tree        *FileTree
+	byBasename  map[string]file.PathSet
+	byExtension map[string]file.PathSet
+}
+
+func newIndex(t *FileTree) *Index {
+	idx := &Index{
+		tree:        t,
+		byBasename:  make(map[string]file.PathSet),
+		byExtension: make(map[string]file.PathSet),
+	}
+	for _, n := range t.tree.Nodes() {
+		idx.add(n.(*filenode.FileNode).RealPath)
+	}
+	return idx
+}
+
+// ByBasename returns the file.References of all paths with the given basename (e.g. "package.json"), sorted by path.
+// Paths without a file.Reference (e.g. directories that are only implied by the paths of their children) are not
+// included.
+func (i *Index) ByBasename(basename string) []file.Reference {
+	return i.references(i.byBasename[basename])
+}
+
+// ByExtension returns the file.References of all paths with the given extension including the leading dot (e.g.
+// ".jar"), sorted by path. The extension is the suffix of the basename beginning at the final dot (see path.Ext), so
+// "archive.tar.gz" has the extension ".gz". Paths without a file.Reference are not included.
+func (i *Index) ByExtension(ext string) []file.Reference {
+	return i.references(i.byExtension[ext])
+}
+
+func (i *Index) references(paths file.PathSet) []file.Reference {
+	sorted := make([]file.Path, 0, len(paths))
+	for p := range paths {
+		sorted = append(sorted, p)
+	}
+	sort.Sort(file.Paths(sorted))
+
+	refs := make([]file.Reference, 0, len(sorted))
+	for _, p := range sorted {
+		n := i.tree.tree.Node(filenode.IDByPath(p))
+		if n == nil {
+			continue
+		}
+		if ref := n.(*filenode.FileNode).Reference; ref != nil {
+			refs = append(refs, *ref)
+		}
+	}
+	return refs
+}
+
+func (i *Index) add(p file.Path) {
+	if p == file.DirSeparator {
+		return
+	}
+	basename := p.Basename()
+	addIndexPath(i.byBasename, basename, p)
+	if ext := path.Ext(basename); ext != "" {
+		addIndexPath(i.byExtension, ext, p)
+	}
+}
+
+func (i *Index) remove(p file.Path) {
+	basename := p.Basename()
+	removeIndexPath(i.byBasename, basename, p)
+	if ext := path.Ext(basename); ext != "" {
+		removeIndexPath(i.byExtension, ext, p)
+	}
+}
+
+func addIndexPath(index map[string]file.PathSet, key string, p file.Path) {
+	paths, ok := index[key]
+	if !ok {
+		paths = file.NewPathSet()
+		index[key] = paths
+	}
+	paths.Add(p)
+}
+
+func removeIndexPath(index map[string]file.PathSet, key string, p file.Path) {
+	paths, ok := index[key]
+	if !ok {
+		return
+	}
+	paths.Remove(p)
+	if len(paths) == 0 {
+		delete(index, key)
+	}
+}
@@ -0,0 +1,81 @@
+package filetree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+func indexPaths(refs []file.Reference) []file.Path {
+	paths := make([]file.Path, 0, len(refs))
+	for _, ref := range refs {
+		paths = append(paths, ref.RealPath)
+	}
+	return paths
+}
+
+func TestFileTree_Index(t *testing.T) {
+	tr := NewFileTree()
+	for _, p := range []string{
+		"/app/package.json",
+		"/app/node_modules/left-pad/package.json",
+		"/opt/lib/app.jar",
+		"/opt/lib/dep.jar",
+		"/opt/lib/archive.tar.gz",
+	} {
+		_, err := tr.AddFile(file.Path(p))
+		require.NoError(t, err)
+	}
+	_, err := tr.AddSymLink("/srv/app.jar", "/opt/lib/app.jar")
+	require.NoError(t, err)
+
+	idx := tr.Index()
+	assert.Equal(t, []file.Path{"/app/node_modules/left-pad/package.json", "/app/package.json"}, indexPaths(idx.ByBasename("package.json")))
+	assert.Equal(t, []file.Path{"/opt/lib/app.jar", "/opt/lib/dep.jar", "/srv/app.jar"}, indexPaths(idx.ByExtension(".jar")))
+	assert.Equal(t, []file.Path{"/opt/lib/archive.tar.gz"}, indexPaths(idx.ByExtension(".gz")))
+	assert.Empty(t, idx.ByExtension(".tar"))
+	// implied parent directories have no reference
+	assert.Empty(t, idx.ByBasename("lib"))
+	assert.Empty(t, idx.ByBasename("missing"))
+
+	// the index is maintained as the tree is modified
+	_, err = tr.AddFile("/usr/share/java/extra.jar")
+	require.NoError(t, err)
+	require.NoError(t, tr.RemovePath("/opt/lib/dep.jar"))
+	require.NoError(t, tr.RemoveChildPaths("/app/node_modules"))
+	assert.Equal(t, []file.Path{"/opt/lib/app.jar", "/srv/app.jar", "/usr/share/java/extra.jar"}, indexPaths(idx.ByExtension(".jar")))
+	assert.Equal(t, []file.Path{"/app/package.json"}, indexPaths(idx.ByBasename("package.json")))
+
+	// a directory that was implied by its children is indexed once it has a reference
+	_, err = tr.AddDir("/usr/share/java")
+	require.NoError(t, err)
+	assert.Equal(t, []file.Path{"/usr/share/java"}, indexPaths(idx.ByBasename("java")))
+
+	// copies are indexed independently
+	cp, err := tr.Copy()
+	require.NoError(t, err)
+	require.NoError(t, cp.RemovePath("/opt/lib/app.jar"))
+	assert.Equal(t, []file.Path{"/srv/app.jar", "/usr/share/java/extra.jar"}, indexPaths(cp.Index().ByExtension(".jar")))
+	assert.Equal(t, []file.Path{"/opt/lib/app.jar", "/srv/app.jar", "/usr/share/java/extra.jar"}, indexPaths(idx.ByExtension(".jar")))
+}
+
+func TestFileTree_Index_Merge(t *testing.T) {
+	lower := NewFileTree()
+	_, err := lower.AddFile("/opt/lib/old.jar")
+	require.NoError(t, err)
+	_, err = lower.AddFile("/opt/lib/keep.jar")
+	require.NoError(t, err)
+	idx := lower.Index()
+
+	upper := NewFileTree()
+	_, err = upper.AddFile("/opt/lib/.wh.old.jar")
+	require.NoError(t, err)
+	_, err = upper.AddFile("/opt/lib/new.jar")
+	require.NoError(t, err)
+
+	require.NoError(t, lower.merge(upper))
+	assert.Equal(t, []file.Path{"/opt/lib/keep.jar", "/opt/lib/new.jar"}, indexPaths(idx.ByExtension(".jar")))
+}
@@ -13,6 +13,22 @@ const (
 	// the non-existing path. This is useful when the caller wants to do custom link resolution (e.g. for container
 	// images: the link is dead in this layer squash, but does it resolve in a higher layer?).
 	DoNotFollowDeadBasenameLinks
+
+	// DoNotFollowHardLinks stops basename link resolution at hardlinks (symlinks are still followed). Unlike symlinks,
+	// a hardlink refers to the content of the file it was linked to when the link was created, not to whatever
+	// currently exists at the link path, so callers that bind hardlinks to content (e.g. container image squash trees)
+	// should not resolve hardlinks by path.
+	DoNotFollowHardLinks
+
+	// LegacyGlobSyntax only applies to FilesByGlob: the pattern is given to the glob matcher as-is, retaining the
+	// pattern semantics of earlier releases (bracket expressions do not support POSIX character classes such as
+	// "[[:digit:]]", and "]" may not be the first character within a bracket expression).
+	LegacyGlobSyntax
+
+	// TraceLinkResolution only applies to FilesByGlob and FilesByRegex: every step taken to resolve each match (nodes
+	// visited, links followed and fallbacks taken) is recorded on the Trace of the GlobResult (see
+	// FileTree.FileWithTrace for the equivalent of File).
+	TraceLinkResolution
 )
 
 // LinkResolutionOption is a single link resolution rule.
@@ -23,6 +39,9 @@ type linkResolutionStrategy struct {
 	FollowAncestorLinks          bool
 	FollowBasenameLinks          bool
 	DoNotFollowDeadBasenameLinks bool
+	DoNotFollowHardLinks         bool
+	// trace records all resolution steps taken (when not nil)
+	trace *ResolutionTrace
 }
 
 // newLinkResolutionStrategy creates a new linkResolutionStrategy for the given set of LinkResolutionOptions.
@@ -34,6 +53,8 @@ func newLinkResolutionStrategy(options ...LinkResolutionOption) linkResolutionSt
 			s.FollowBasenameLinks = true
 		case DoNotFollowDeadBasenameLinks:
 			s.DoNotFollowDeadBasenameLinks = true
+		case DoNotFollowHardLinks:
+			s.DoNotFollowHardLinks = true
 		case followAncestorLinks:
 			s.FollowAncestorLinks = true
 		}
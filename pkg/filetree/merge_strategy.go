@@ -0,0 +1,69 @@
+package filetree
+
+import (
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree/filenode"
+)
+
+// MergeStrategy describes the union semantics used when merging (squashing) an upper tree onto a lower tree: which
+// upper nodes delete lower paths (whiteouts) and which upper directories hide all lower contents (opaque directories).
+// Different storage drivers represent deletions differently, so the strategy should match how the trees were produced.
+type MergeStrategy interface {
+	// Whiteout returns the lower path deleted by the given upper node (false if the node does not delete anything).
+	// Whiteout nodes are not merged into the lower tree.
+	Whiteout(upper *FileTree, n *filenode.FileNode) (file.Path, bool)
+	// Opaque indicates that all lower contents of the given upper directory node are hidden.
+	Opaque(upper *FileTree, n *filenode.FileNode) bool
+	// Marker indicates that the given upper node only describes another node (e.g. an opaque directory marker) and is
+	// not merged into the lower tree.
+	Marker(upper *FileTree, n *filenode.FileNode) bool
+}
+
+// AUFSMergeStrategy returns the union semantics used by the OCI image spec (and docker image tars): a ".wh.<name>"
+// file deletes "<name>" from lower trees, and a ".wh..wh..opq" file hides all lower contents of its parent directory.
+// This is the default strategy when squashing.
+func AUFSMergeStrategy() MergeStrategy {
+	return aufsMergeStrategy{}
+}
+
+// CopyUpMergeStrategy returns plain copy-up union semantics (as with the vfs storage driver, where every layer is a
+// full copy of the filesystem): upper nodes replace lower nodes at the same path and nothing is ever deleted, so
+// whiteout files are merged as regular files.
+func CopyUpMergeStrategy() MergeStrategy {
+	return copyUpMergeStrategy{}
+}
+
+type aufsMergeStrategy struct{}
+
+func (aufsMergeStrategy) Whiteout(_ *FileTree, n *filenode.FileNode) (file.Path, bool) {
+	if !n.RealPath.IsWhiteout() || n.RealPath.IsDirWhiteout() {
+		return "", false
+	}
+	lowerPath, err := n.RealPath.UnWhiteoutPath()
+	if err != nil {
+		return "", false
+	}
+	return lowerPath, true
+}
+
+func (aufsMergeStrategy) Opaque(upper *FileTree, n *filenode.FileNode) bool {
+	return upper.hasOpaqueDirectory(n.RealPath)
+}
+
+func (aufsMergeStrategy) Marker(_ *FileTree, n *filenode.FileNode) bool {
+	return n.RealPath.IsDirWhiteout()
+}
+
+type copyUpMergeStrategy struct{}
+
+func (copyUpMergeStrategy) Whiteout(*FileTree, *filenode.FileNode) (file.Path, bool) {
+	return "", false
+}
+
+func (copyUpMergeStrategy) Opaque(*FileTree, *filenode.FileNode) bool {
+	return false
+}
+
+func (copyUpMergeStrategy) Marker(*FileTree, *filenode.FileNode) bool {
+	return false
+}
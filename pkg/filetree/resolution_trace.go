@@ -0,0 +1,113 @@
+package filetree
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree/filenode"
+)
+
+// ResolutionStepKind describes a single kind of step taken while resolving a path within a FileTree.
+type ResolutionStepKind string
+
+const (
+	// NodeVisited indicates a node was found at the path (Target is the real path of the node).
+	NodeVisited ResolutionStepKind = "visited"
+	// NodeMissing indicates there is no node at the path.
+	NodeMissing ResolutionStepKind = "missing"
+	// LinkFollowed indicates the link at the path was followed to the target path.
+	LinkFollowed ResolutionStepKind = "followed"
+	// FallbackTaken indicates resolution could not continue as-is and fell back to another approach (see Reason).
+	FallbackTaken ResolutionStepKind = "fallback"
+)
+
+// ResolutionStep is a single step taken while resolving a path within a FileTree.
+type ResolutionStep struct {
+	Kind ResolutionStepKind
+	// Path is the path that was looked up (or the real path of the link that was followed)
+	Path file.Path
+	// Target is the real path of the node found (or the path the link was followed to)
+	Target file.Path
+	// Reason describes why a fallback was taken
+	Reason string
+}
+
+func (s ResolutionStep) String() string {
+	switch s.Kind {
+	case NodeVisited:
+		if s.Target != s.Path {
+			return fmt.Sprintf("visited %s (real path %s)", s.Path, s.Target)
+		}
+		return fmt.Sprintf("visited %s", s.Path)
+	case NodeMissing:
+		return fmt.Sprintf("missing %s", s.Path)
+	case LinkFollowed:
+		return fmt.Sprintf("followed %s -> %s", s.Path, s.Target)
+	default:
+		return fmt.Sprintf("fallback at %s: %s", s.Path, s.Reason)
+	}
+}
+
+// ResolutionTrace is every step taken while resolving a single path within a FileTree, in order. This is meant for
+// debugging why a path resolved where it did (see FileTree.FileWithTrace and the TraceLinkResolution option).
+type ResolutionTrace struct {
+	Steps []ResolutionStep
+}
+
+// String returns the steps of the trace, one per line.
+func (r *ResolutionTrace) String() string {
+	if r == nil {
+		return ""
+	}
+	lines := make([]string, len(r.Steps))
+	for i, s := range r.Steps {
+		lines[i] = s.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// newResolutionTrace returns an empty trace when tracing, otherwise nil (which records nothing).
+func newResolutionTrace(tracing bool) *ResolutionTrace {
+	if !tracing {
+		return nil
+	}
+	return &ResolutionTrace{}
+}
+
+// visit records the result of looking up the given path (a nil trace records nothing).
+func (r *ResolutionTrace) visit(p file.Path, fn *filenode.FileNode) {
+	if r == nil {
+		return
+	}
+	if fn == nil {
+		r.add(ResolutionStep{Kind: NodeMissing, Path: p})
+		return
+	}
+	r.add(ResolutionStep{Kind: NodeVisited, Path: p, Target: fn.RealPath})
+}
+
+// follow records that the link at the given path was followed to the given target (a nil trace records nothing).
+func (r *ResolutionTrace) follow(link, target file.Path) {
+	if r == nil {
+		return
+	}
+	r.add(ResolutionStep{Kind: LinkFollowed, Path: link, Target: target})
+}
+
+// fallback records that resolution of the given path fell back for the given reason (a nil trace records nothing).
+func (r *ResolutionTrace) fallback(p file.Path, reason string) {
+	if r == nil {
+		return
+	}
+	r.add(ResolutionStep{Kind: FallbackTaken, Path: p, Reason: reason})
+}
+
+// add records the given step, unless it repeats the last step (the same lookup may be done more than once while
+// falling back, which adds nothing to the trace).
+func (r *ResolutionTrace) add(step ResolutionStep) {
+	if n := len(r.Steps); n > 0 && r.Steps[n-1] == step {
+		return
+	}
+	r.Steps = append(r.Steps, step)
+}
@@ -3,12 +3,23 @@ package filetree
 import "fmt"
 
 type UnionFileTree struct {
-	trees []*FileTree
+	trees    []*FileTree
+	strategy MergeStrategy
 }
 
 func NewUnionFileTree() *UnionFileTree {
+	return NewUnionFileTreeWithStrategy(AUFSMergeStrategy())
+}
+
+// NewUnionFileTreeWithStrategy creates a union of trees that are squashed with the given merge strategy (see
+// MergeStrategy).
+func NewUnionFileTreeWithStrategy(strategy MergeStrategy) *UnionFileTree {
+	if strategy == nil {
+		strategy = AUFSMergeStrategy()
+	}
 	return &UnionFileTree{
-		trees: make([]*FileTree, 0),
+		trees:    make([]*FileTree, 0),
+		strategy: strategy,
 	}
 }
 
@@ -35,7 +46,7 @@ func (u *UnionFileTree) Squash() (*FileTree, error) {
 			continue
 		}
 
-		if err = squashedTree.merge(refTree); err != nil {
+		if err = squashedTree.mergeWithStrategy(refTree, u.strategy); err != nil {
 			return nil, fmt.Errorf("unable to squash layer=%d : %w", layerIdx, err)
 		}
 	}
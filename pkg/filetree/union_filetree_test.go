@@ -1,9 +1,14 @@
 package filetree
 
 import (
+	"strings"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
 	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree/filenode"
 )
 
 func TestUnionFileTree_Squash(t *testing.T) {
@@ -142,3 +147,79 @@ func TestUnionFileTree_Squash_whiteout(t *testing.T) {
 	}
 
 }
+
+// suffixMergeStrategy deletes lower paths with upper "<name>.deleted" files and treats upper directories named
+// "*.opaque" as opaque.
+type suffixMergeStrategy struct{}
+
+func (suffixMergeStrategy) Whiteout(_ *FileTree, n *filenode.FileNode) (file.Path, bool) {
+	if strings.HasSuffix(string(n.RealPath), ".deleted") {
+		return file.Path(strings.TrimSuffix(string(n.RealPath), ".deleted")), true
+	}
+	return "", false
+}
+
+func (suffixMergeStrategy) Opaque(_ *FileTree, n *filenode.FileNode) bool {
+	return strings.HasSuffix(string(n.RealPath), ".opaque")
+}
+
+func (suffixMergeStrategy) Marker(*FileTree, *filenode.FileNode) bool {
+	return false
+}
+
+func TestUnionFileTree_SquashWithStrategy(t *testing.T) {
+	newTrees := func(t *testing.T) (*FileTree, *FileTree) {
+		base := NewFileTree()
+		for _, p := range []file.Path{"/etc/removed", "/etc/kept", "/var/lib.opaque/old", "/opt/app/old"} {
+			_, err := base.AddFile(p)
+			require.NoError(t, err)
+		}
+		top := NewFileTree()
+		for _, p := range []file.Path{"/etc/.wh.kept", "/etc/removed.deleted", "/var/lib.opaque/new", "/opt/app/.wh..wh..opq"} {
+			_, err := top.AddFile(p)
+			require.NoError(t, err)
+		}
+		return base, top
+	}
+
+	tests := []struct {
+		name     string
+		strategy MergeStrategy
+		present  []file.Path
+		absent   []file.Path
+	}{
+		{
+			name:     "aufs",
+			strategy: AUFSMergeStrategy(),
+			present:  []file.Path{"/etc/removed", "/etc/removed.deleted", "/var/lib.opaque/old", "/var/lib.opaque/new", "/opt/app"},
+			absent:   []file.Path{"/etc/kept", "/etc/.wh.kept", "/opt/app/old", "/opt/app/.wh..wh..opq"},
+		},
+		{
+			name:     "copy-up",
+			strategy: CopyUpMergeStrategy(),
+			present:  []file.Path{"/etc/removed", "/etc/kept", "/etc/.wh.kept", "/etc/removed.deleted", "/var/lib.opaque/old", "/opt/app/old", "/opt/app/.wh..wh..opq"},
+		},
+		{
+			name:     "custom",
+			strategy: suffixMergeStrategy{},
+			present:  []file.Path{"/etc/kept", "/etc/.wh.kept", "/var/lib.opaque/new", "/opt/app/old", "/opt/app/.wh..wh..opq"},
+			absent:   []file.Path{"/etc/removed", "/etc/removed.deleted", "/var/lib.opaque/old"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			base, top := newTrees(t)
+			ut := NewUnionFileTreeWithStrategy(test.strategy)
+			ut.PushTree(base)
+			ut.PushTree(top)
+			squashed, err := ut.Squash()
+			require.NoError(t, err)
+			for _, p := range test.present {
+				assert.True(t, squashed.HasPath(p), "expected %q", p)
+			}
+			for _, p := range test.absent {
+				assert.False(t, squashed.HasPath(p), "unexpected %q", p)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package fuse
+
+import (
+	"fmt"
+
+	fusefs "github.com/hanwen/go-fuse/v2/fs"
+	gofuse "github.com/hanwen/go-fuse/v2/fuse"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+)
+
+// Server is a mounted image filesystem, which is served until unmounted.
+type Server struct {
+	dir    string
+	server *gofuse.Server
+}
+
+// Mount mounts the squashed filesystem of the given (already read) image read-only at the given existing directory.
+// File contents are fetched from the layer contents when first read (nothing is extracted up front), so host tools
+// (e.g. grep or find) can be run against the image as-is. Symlinks and hardlinks are presented as they are within the
+// image, and file ownership and permissions are presented as recorded (they are not enforced for the mounting user).
+// The image must not be cleaned up until the filesystem is unmounted (see Server.Unmount).
+func Mount(img *image.Image, dir string, opts ...MountOption) (*Server, error) {
+	cfg := newMountConfig(opts...)
+
+	if len(img.Layers) == 0 {
+		return nil, fmt.Errorf("image has no layers (has it been read?)")
+	}
+	tree, err := img.FilesystemAt(len(img.Layers) - 1)
+	if err != nil {
+		return nil, fmt.Errorf("unable to mount image: %w", err)
+	}
+
+	root := &node{
+		fs: &imageFS{
+			img:  img,
+			tree: tree,
+		},
+		path: file.DirSeparator,
+	}
+	server, err := fusefs.Mount(dir, root, &fusefs.Options{
+		MountOptions: gofuse.MountOptions{
+			AllowOther:  cfg.allowOther,
+			DirectMount: cfg.directMount,
+			FsName:      cfg.fsName,
+			Name:        "stereoscope",
+			Debug:       cfg.debug,
+			Options:     []string{"ro"},
+		},
+		// permissions are presented as recorded, even when they are not set
+		NullPermissions: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to mount image at dir=%q: %w", dir, err)
+	}
+	return &Server{
+		dir:    dir,
+		server: server,
+	}, nil
+}
+
+// Dir returns the directory the image filesystem is mounted at.
+func (s *Server) Dir() string {
+	return s.dir
+}
+
+// Wait blocks until the filesystem is unmounted (e.g. with Unmount or "fusermount -u").
+func (s *Server) Wait() {
+	s.server.Wait()
+}
+
+// Unmount unmounts the filesystem, which fails if any file within the mount is still in use.
+func (s *Server) Unmount() error {
+	if err := s.server.Unmount(); err != nil {
+		return fmt.Errorf("unable to unmount image at dir=%q: %w", s.dir, err)
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+//go:build linux
+// +build linux
+
+package fuse
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anchore/stereoscope/pkg/image"
+)
+
+// newTestImage returns the read image with a layer for each of the given sets of tar headers (regular files are
+// filled with the size in the header).
+func newTestImage(t *testing.T, layers ...[]tar.Header) *image.Image {
+	t.Helper()
+	img := image.NewImage(newTestV1Image(t, layers...), t.TempDir())
+	require.NoError(t, img.Read())
+	return img
+}
+
+// newTestV1Image returns an image with a layer for each of the given sets of tar headers (see newTestImage).
+func newTestV1Image(t *testing.T, layers ...[]tar.Header) v1.Image {
+	t.Helper()
+	var v1Layers []v1.Layer
+	for _, headers := range layers {
+		buf := &bytes.Buffer{}
+		tw := tar.NewWriter(buf)
+		for _, header := range headers {
+			header := header
+			if header.Mode == 0 {
+				header.Mode = 0644
+			}
+			require.NoError(t, tw.WriteHeader(&header))
+			_, err := tw.Write(bytes.Repeat([]byte("x"), int(header.Size)))
+			require.NoError(t, err)
+		}
+		require.NoError(t, tw.Close())
+		content := buf.Bytes()
+		layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(content)), nil
+		})
+		require.NoError(t, err)
+		v1Layers = append(v1Layers, layer)
+	}
+	v1Image, err := mutate.AppendLayers(empty.Image, v1Layers...)
+	require.NoError(t, err)
+	return v1Image
+}
+
+func TestMount(t *testing.T) {
+	img := newTestImage(t,
+		[]tar.Header{
+			{Name: "bin/", Typeflag: tar.TypeDir, Mode: 0755},
+			{Name: "bin/tool", Typeflag: tar.TypeReg, Size: 4, Mode: 04755, Uid: 1000, Gid: 1001},
+			{Name: "bin/alias", Typeflag: tar.TypeLink, Linkname: "bin/tool"},
+			{Name: "bin/sh", Typeflag: tar.TypeSymlink, Linkname: "/bin/tool"},
+			{Name: "etc/", Typeflag: tar.TypeDir, Mode: 0755},
+			{Name: "etc/removed", Typeflag: tar.TypeReg, Size: 2},
+		},
+		[]tar.Header{
+			{Name: "etc/.wh.removed", Typeflag: tar.TypeReg},
+			{Name: "usr/share/large", Typeflag: tar.TypeReg, Size: 1 << 20},
+		},
+	)
+
+	dir := t.TempDir()
+	server, err := Mount(img, dir, WithDirectMount())
+	if err != nil {
+		t.Skipf("unable to mount FUSE filesystem (requires /dev/fuse and privileges): %v", err)
+	}
+	t.Cleanup(func() {
+		require.NoError(t, server.Unmount())
+	})
+	assert.Equal(t, dir, server.Dir())
+
+	names := func(p string) []string {
+		infos, err := ioutil.ReadDir(filepath.Join(dir, p))
+		require.NoError(t, err)
+		var result []string
+		for _, info := range infos {
+			result = append(result, info.Name())
+		}
+		sort.Strings(result)
+		return result
+	}
+	assert.Equal(t, []string{"bin", "etc", "usr"}, names("/"))
+	assert.Equal(t, []string{"alias", "sh", "tool"}, names("bin"))
+	// whiteouts are applied
+	assert.Empty(t, names("etc"))
+
+	// metadata is presented as recorded
+	tool, err := os.Lstat(filepath.Join(dir, "bin", "tool"))
+	require.NoError(t, err)
+	assert.Equal(t, os.ModeSetuid|0755, tool.Mode())
+	assert.Equal(t, int64(4), tool.Size())
+	stat, ok := tool.Sys().(*syscall.Stat_t)
+	require.True(t, ok)
+	assert.Equal(t, uint32(1000), stat.Uid)
+	assert.Equal(t, uint32(1001), stat.Gid)
+
+	// hardlinks are the same file
+	alias, err := os.Lstat(filepath.Join(dir, "bin", "alias"))
+	require.NoError(t, err)
+	assert.True(t, os.SameFile(tool, alias))
+
+	// symlinks are resolved by the kernel
+	target, err := os.Readlink(filepath.Join(dir, "bin", "sh"))
+	require.NoError(t, err)
+	assert.Equal(t, "/bin/tool", target)
+
+	contents, err := ioutil.ReadFile(filepath.Join(dir, "bin", "alias"))
+	require.NoError(t, err)
+	assert.Equal(t, "xxxx", string(contents))
+
+	large, err := ioutil.ReadFile(filepath.Join(dir, "usr", "share", "large"))
+	require.NoError(t, err)
+	assert.Equal(t, bytes.Repeat([]byte("x"), 1<<20), large)
+
+	// the mount is read-only
+	_, err = os.OpenFile(filepath.Join(dir, "bin", "tool"), os.O_WRONLY, 0)
+	assert.Error(t, err)
+	err = ioutil.WriteFile(filepath.Join(dir, "new"), []byte("new"), 0644)
+	assert.Error(t, err)
+
+	_, err = os.Lstat(filepath.Join(dir, "missing"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestMount_SquashFailure(t *testing.T) {
+	// the top layer whites out the root directory, which cannot be squashed
+	img := image.NewImage(newTestV1Image(t,
+		[]tar.Header{{Name: "etc/hello.txt", Typeflag: tar.TypeReg, Size: 5}},
+		[]tar.Header{{Name: ".wh..", Typeflag: tar.TypeReg}},
+	), t.TempDir())
+	require.NoError(t, img.Read(image.WithDeferredSquash()))
+
+	// the image is never mounted
+	_, err := Mount(img, t.TempDir())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unable to squash layers")
+
+	_, err = Mount(image.NewImage(empty.Image, t.TempDir()), t.TempDir())
+	require.Error(t, err)
+}
+
+func TestHandle_Read(t *testing.T) {
+	contents := []byte("0123456789")
+	opens := 0
+	h := &handle{
+		open: func() (io.ReadCloser, error) {
+			opens++
+			return ioutil.NopCloser(bytes.NewReader(contents)), nil
+		},
+	}
+	read := func(off int64, size int) string {
+		result, errno := h.Read(context.Background(), make([]byte, size), off)
+		require.Zero(t, errno)
+		data, status := result.Bytes(nil)
+		require.True(t, status.Ok())
+		return string(data)
+	}
+
+	// sequential reads use a single reader
+	assert.Equal(t, "0123", read(0, 4))
+	assert.Equal(t, "4567", read(4, 4))
+	assert.Equal(t, 1, opens)
+
+	// reads ahead skip within the same reader
+	assert.Equal(t, "9", read(9, 4))
+	assert.Equal(t, 1, opens)
+
+	// reads beyond the end are empty
+	assert.Equal(t, "", read(20, 4))
+
+	// reads behind re-open the contents
+	assert.Equal(t, "23", read(2, 2))
+	assert.Equal(t, 2, opens)
+
+	assert.Zero(t, h.Release(context.Background()))
+	assert.Nil(t, h.reader)
+}
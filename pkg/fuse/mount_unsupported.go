@@ -0,0 +1,31 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package fuse
+
+import (
+	"github.com/anchore/stereoscope/pkg/image"
+)
+
+// Server is a mounted image filesystem, which is served until unmounted.
+type Server struct {
+	dir string
+}
+
+// Mount always returns ErrUnsupported, since FUSE is only available on linux and darwin.
+func Mount(_ *image.Image, _ string, _ ...MountOption) (*Server, error) {
+	return nil, ErrUnsupported
+}
+
+// Dir returns the directory the image filesystem is mounted at.
+func (s *Server) Dir() string {
+	return s.dir
+}
+
+// Wait blocks until the filesystem is unmounted.
+func (s *Server) Wait() {}
+
+// Unmount unmounts the filesystem.
+func (s *Server) Unmount() error {
+	return ErrUnsupported
+}
@@ -0,0 +1,281 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package fuse
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"syscall"
+
+	fusefs "github.com/hanwen/go-fuse/v2/fs"
+	gofuse "github.com/hanwen/go-fuse/v2/fuse"
+	"golang.org/x/sys/unix"
+
+	"github.com/anchore/stereoscope/internal/log"
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree"
+	"github.com/anchore/stereoscope/pkg/image"
+)
+
+// basic interface assertions
+var _ fusefs.NodeLookuper = (*node)(nil)
+var _ fusefs.NodeGetattrer = (*node)(nil)
+var _ fusefs.NodeReaddirer = (*node)(nil)
+var _ fusefs.NodeReadlinker = (*node)(nil)
+var _ fusefs.NodeOpener = (*node)(nil)
+var _ fusefs.FileReader = (*handle)(nil)
+var _ fusefs.FileReleaser = (*handle)(nil)
+
+// imageFS is the image squash tree being served, where file metadata and contents are read from the file catalog.
+type imageFS struct {
+	img  *image.Image
+	tree *filetree.FileTree
+}
+
+// entry is a resolved path within the squash tree.
+type entry struct {
+	// ref is the file presented at the path (nil for directories implied by the layer tars), which for hardlinks is the
+	// file the link shares content with
+	ref      *file.Reference
+	metadata file.Metadata
+}
+
+// resolve returns the entry at the given path without following symlinks (the kernel resolves symlinks itself).
+func (f *imageFS) resolve(p file.Path) (*entry, error) {
+	ref, metadata, err := f.img.Lstat(p)
+	if err != nil {
+		return nil, err
+	}
+	return &entry{
+		ref:      ref,
+		metadata: metadata,
+	}, nil
+}
+
+// ino returns the inode number of the entry (zero for implied directories, which are numbered automatically).
+func (e *entry) ino() uint64 {
+	if e.ref == nil {
+		return 0
+	}
+	return uint64(e.ref.ID()) + 1
+}
+
+// mode returns the file type and permission bits of the entry as a stat mode.
+func (e *entry) mode() uint32 {
+	mode := uint32(e.metadata.Mode.Perm())
+	if e.metadata.Mode&os.ModeSetuid != 0 {
+		mode |= syscall.S_ISUID
+	}
+	if e.metadata.Mode&os.ModeSetgid != 0 {
+		mode |= syscall.S_ISGID
+	}
+	if e.metadata.Mode&os.ModeSticky != 0 {
+		mode |= syscall.S_ISVTX
+	}
+
+	switch {
+	case e.metadata.IsDir || file.Type(e.metadata.TypeFlag) == file.TypeDir:
+		mode |= syscall.S_IFDIR
+	case file.Type(e.metadata.TypeFlag) == file.TypeSymlink:
+		mode |= syscall.S_IFLNK
+	case file.Type(e.metadata.TypeFlag) == file.TypeCharacterDevice:
+		mode |= syscall.S_IFCHR
+	case file.Type(e.metadata.TypeFlag) == file.TypeBlockDevice:
+		mode |= syscall.S_IFBLK
+	case file.Type(e.metadata.TypeFlag) == file.TypeFifo:
+		mode |= syscall.S_IFIFO
+	default:
+		mode |= syscall.S_IFREG
+	}
+	return mode
+}
+
+// fill sets the attributes of the entry.
+func (e *entry) fill(out *gofuse.Attr) {
+	out.Ino = e.ino()
+	out.Mode = e.mode()
+	out.Nlink = 1
+	out.Owner = gofuse.Owner{
+		Uid: uint32(e.metadata.UserID),
+		Gid: uint32(e.metadata.GroupID),
+	}
+	switch out.Mode & syscall.S_IFMT {
+	case syscall.S_IFREG:
+		out.Size = uint64(e.metadata.Size)
+	case syscall.S_IFLNK:
+		out.Size = uint64(len(e.metadata.Linkname))
+	case syscall.S_IFCHR, syscall.S_IFBLK:
+		out.Rdev = uint32(unix.Mkdev(uint32(e.metadata.Devmajor), uint32(e.metadata.Devminor)))
+	}
+	out.Blocks = (out.Size + 511) / 512
+}
+
+// node is a path within the served squash tree.
+type node struct {
+	fusefs.Inode
+	fs   *imageFS
+	path file.Path
+}
+
+func (n *node) Lookup(ctx context.Context, name string, out *gofuse.EntryOut) (*fusefs.Inode, syscall.Errno) {
+	p := file.Path(path.Join(string(n.path), name))
+	e, err := n.fs.resolve(p)
+	if err != nil {
+		return nil, errno(err)
+	}
+	e.fill(&out.Attr)
+	child := &node{
+		fs:   n.fs,
+		path: p,
+	}
+	return n.NewInode(ctx, child, fusefs.StableAttr{Mode: e.mode() & syscall.S_IFMT, Ino: e.ino()}), fusefs.OK
+}
+
+func (n *node) Getattr(_ context.Context, _ fusefs.FileHandle, out *gofuse.AttrOut) syscall.Errno {
+	e, err := n.fs.resolve(n.path)
+	if err != nil {
+		return errno(err)
+	}
+	e.fill(&out.Attr)
+	return fusefs.OK
+}
+
+func (n *node) Readdir(_ context.Context) (fusefs.DirStream, syscall.Errno) {
+	children, err := n.fs.tree.ListPaths(n.path)
+	if err != nil {
+		return nil, errno(err)
+	}
+	entries := make([]gofuse.DirEntry, 0, len(children))
+	for _, child := range children {
+		if child.IsWhiteout() {
+			continue
+		}
+		e, err := n.fs.resolve(child)
+		if err != nil {
+			log.Debugf("skipping path=%q within FUSE mount: %+v", child, err)
+			continue
+		}
+		entries = append(entries, gofuse.DirEntry{
+			Name: child.Basename(),
+			Mode: e.mode(),
+			Ino:  e.ino(),
+		})
+	}
+	return fusefs.NewListDirStream(entries), fusefs.OK
+}
+
+func (n *node) Readlink(_ context.Context) ([]byte, syscall.Errno) {
+	e, err := n.fs.resolve(n.path)
+	if err != nil {
+		return nil, errno(err)
+	}
+	if file.Type(e.metadata.TypeFlag) != file.TypeSymlink {
+		return nil, syscall.EINVAL
+	}
+	return []byte(e.metadata.Linkname), fusefs.OK
+}
+
+func (n *node) Open(_ context.Context, flags uint32) (fusefs.FileHandle, uint32, syscall.Errno) {
+	if flags&(syscall.O_WRONLY|syscall.O_RDWR|syscall.O_APPEND|syscall.O_TRUNC) != 0 {
+		return nil, 0, syscall.EROFS
+	}
+	e, err := n.fs.resolve(n.path)
+	if err != nil {
+		return nil, 0, errno(err)
+	}
+	switch e.mode() & syscall.S_IFMT {
+	case syscall.S_IFREG:
+	case syscall.S_IFDIR:
+		return nil, 0, syscall.EISDIR
+	default:
+		// device files and named pipes have no contents within the image
+		return nil, 0, syscall.EINVAL
+	}
+	ref := *e.ref
+	h := &handle{
+		open: func() (io.ReadCloser, error) {
+			return n.fs.img.FileContentsByRef(ref)
+		},
+	}
+	// image contents never change, so cached pages are kept between opens
+	return h, gofuse.FOPEN_KEEP_CACHE, fusefs.OK
+}
+
+// handle is an open file within the mount. File contents are streamed from the layer contents (opened on the first
+// read), where reads before the current offset re-open the contents and reads beyond it skip ahead, so sequential
+// reads (the common case) never buffer the file in memory.
+type handle struct {
+	mu     sync.Mutex
+	open   func() (io.ReadCloser, error)
+	reader io.ReadCloser
+	// offset is the number of bytes read from the reader
+	offset int64
+}
+
+func (h *handle) Read(_ context.Context, dest []byte, off int64) (gofuse.ReadResult, syscall.Errno) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.reader != nil && off < h.offset {
+		_ = h.reader.Close()
+		h.reader = nil
+	}
+	if h.reader == nil {
+		reader, err := h.open()
+		if err != nil {
+			return nil, errno(err)
+		}
+		h.reader = reader
+		h.offset = 0
+	}
+	if off > h.offset {
+		skipped, err := io.CopyN(ioutil.Discard, h.reader, off-h.offset)
+		h.offset += skipped
+		if errors.Is(err, io.EOF) {
+			return gofuse.ReadResultData(nil), fusefs.OK
+		}
+		if err != nil {
+			return nil, errno(err)
+		}
+	}
+
+	n, err := io.ReadFull(h.reader, dest)
+	h.offset += int64(n)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, errno(err)
+	}
+	return gofuse.ReadResultData(dest[:n]), fusefs.OK
+}
+
+func (h *handle) Release(_ context.Context) syscall.Errno {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.reader == nil {
+		return fusefs.OK
+	}
+	err := h.reader.Close()
+	h.reader = nil
+	if err != nil {
+		return errno(err)
+	}
+	return fusefs.OK
+}
+
+// errno returns the error number to report for the given error (see image.FileContentsError).
+func errno(err error) syscall.Errno {
+	switch {
+	case errors.Is(err, image.ErrFileNotFound), errors.Is(err, image.ErrDeadLink), errors.Is(err, os.ErrNotExist):
+		return syscall.ENOENT
+	case errors.Is(err, image.ErrIsDirectory):
+		return syscall.EISDIR
+	}
+	log.Debugf("FUSE request failed: %+v", err)
+	return syscall.EIO
+}
@@ -0,0 +1,62 @@
+package fuse
+
+import "errors"
+
+// ErrUnsupported is returned when mounting on a platform without FUSE support.
+var ErrUnsupported = errors.New("FUSE mounts are not supported on this platform")
+
+// MountOption is a configuration option that controls how the image filesystem is mounted (see Mount).
+type MountOption func(*mountConfig)
+
+// mountConfig is the collection of all mount options that have been applied.
+type mountConfig struct {
+	// allowOther indicates that users other than the mounting user may access the mount.
+	allowOther bool
+	// directMount indicates that the mount syscall should be invoked directly instead of through fusermount.
+	directMount bool
+	// fsName is the name of the mounted filesystem (as shown by mount and df).
+	fsName string
+	// debug indicates that all FUSE requests should be logged.
+	debug bool
+}
+
+func newMountConfig(opts ...MountOption) mountConfig {
+	cfg := mountConfig{
+		fsName: "stereoscope",
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// WithAllowOther allows users other than the mounting user to access the mount (requires "user_allow_other" within
+// /etc/fuse.conf when mounting unprivileged).
+func WithAllowOther() MountOption {
+	return func(c *mountConfig) {
+		c.allowOther = true
+	}
+}
+
+// WithDirectMount mounts with the mount syscall directly instead of through the fusermount helper, which requires
+// privileges, however, allows mounting where fusermount is not installed (e.g. within a container).
+func WithDirectMount() MountOption {
+	return func(c *mountConfig) {
+		c.directMount = true
+	}
+}
+
+// WithFSName sets the name of the mounted filesystem as shown by mount and df (e.g. the image reference), by default
+// "stereoscope".
+func WithFSName(name string) MountOption {
+	return func(c *mountConfig) {
+		c.fsName = name
+	}
+}
+
+// WithDebug logs every FUSE request and response.
+func WithDebug() MountOption {
+	return func(c *mountConfig) {
+		c.debug = true
+	}
+}
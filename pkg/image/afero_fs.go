@@ -0,0 +1,176 @@
+package image
+
+import (
+	"io/fs"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/spf13/afero"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+// basic interface assertions
+var _ afero.Fs = (*imageAferoFS)(nil)
+var _ afero.Lstater = (*imageAferoFS)(nil)
+var _ afero.LinkReader = (*imageAferoFS)(nil)
+var _ afero.File = (*imageAferoFile)(nil)
+
+// imageAferoFS is a read-only afero.Fs view of an image squash tree (see Image.AferoFS).
+type imageAferoFS struct {
+	fsys *imageFS
+}
+
+// AferoFS returns the image squash tree as a read-only afero.Fs, with the same semantics as FS. Paths may be absolute
+// or relative to the image root (e.g. "/etc/os-release" or "etc/os-release"). All modifications fail with EPERM (the
+// same as afero.ReadOnlyFs).
+func (i *Image) AferoFS() afero.Fs {
+	return &imageAferoFS{
+		fsys: i.FS().(*imageFS),
+	}
+}
+
+func (a *imageAferoFS) Name() string {
+	return "ImageFS"
+}
+
+func (a *imageAferoFS) Open(name string) (afero.File, error) {
+	f, err := a.fsys.Open(imageFSName(name))
+	if err != nil {
+		return nil, err
+	}
+	return &imageAferoFile{imageFSFile: f.(*imageFSFile), name: name}, nil
+}
+
+func (a *imageAferoFS) OpenFile(name string, flag int, _ os.FileMode) (afero.File, error) {
+	if isWriteFlag(flag) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: syscall.EPERM}
+	}
+	return a.Open(name)
+}
+
+func (a *imageAferoFS) Stat(name string) (os.FileInfo, error) {
+	return a.fsys.Stat(imageFSName(name))
+}
+
+// LstatIfPossible returns a FileInfo describing the named file (without following symlinks).
+func (a *imageAferoFS) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	fsName := imageFSName(name)
+	_, metadata, err := a.fsys.resolve("lstat", fsName, false)
+	if err != nil {
+		return nil, true, err
+	}
+	return newImageFSFileInfo(fsName, metadata), true, nil
+}
+
+// ReadlinkIfPossible returns the destination of the named symlink.
+func (a *imageAferoFS) ReadlinkIfPossible(name string) (string, error) {
+	_, metadata, err := a.fsys.resolve("readlink", imageFSName(name), false)
+	if err != nil {
+		return "", err
+	}
+	if file.Type(metadata.TypeFlag) != file.TypeSymlink {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: syscall.EINVAL}
+	}
+	return metadata.Linkname, nil
+}
+
+func (a *imageAferoFS) Create(name string) (afero.File, error) {
+	return nil, &fs.PathError{Op: "create", Path: name, Err: syscall.EPERM}
+}
+
+func (a *imageAferoFS) Mkdir(name string, _ os.FileMode) error {
+	return &fs.PathError{Op: "mkdir", Path: name, Err: syscall.EPERM}
+}
+
+func (a *imageAferoFS) MkdirAll(name string, _ os.FileMode) error {
+	return &fs.PathError{Op: "mkdir", Path: name, Err: syscall.EPERM}
+}
+
+func (a *imageAferoFS) Remove(name string) error {
+	return &fs.PathError{Op: "remove", Path: name, Err: syscall.EPERM}
+}
+
+func (a *imageAferoFS) RemoveAll(name string) error {
+	return &fs.PathError{Op: "remove", Path: name, Err: syscall.EPERM}
+}
+
+func (a *imageAferoFS) Rename(oldname, newname string) error {
+	return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.EPERM}
+}
+
+func (a *imageAferoFS) Chmod(name string, _ os.FileMode) error {
+	return &fs.PathError{Op: "chmod", Path: name, Err: syscall.EPERM}
+}
+
+func (a *imageAferoFS) Chown(name string, _, _ int) error {
+	return &fs.PathError{Op: "chown", Path: name, Err: syscall.EPERM}
+}
+
+func (a *imageAferoFS) Chtimes(name string, _, _ time.Time) error {
+	return &fs.PathError{Op: "chtimes", Path: name, Err: syscall.EPERM}
+}
+
+// imageAferoFile is an open (read-only) file within an imageAferoFS.
+type imageAferoFile struct {
+	*imageFSFile
+	// name is the path as given when opened
+	name string
+}
+
+func (f *imageAferoFile) Name() string {
+	return f.name
+}
+
+// Readdir reads the contents of the directory, following the os.File semantics (at most n entries for n > 0,
+// returning io.EOF at the end of the directory, otherwise all remaining entries).
+func (f *imageAferoFile) Readdir(n int) ([]os.FileInfo, error) {
+	entries, err := f.ReadDir(n)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// Readdirnames reads the names of the directory entries, with the same semantics as Readdir.
+func (f *imageAferoFile) Readdirnames(n int) ([]string, error) {
+	entries, err := f.ReadDir(n)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names, nil
+}
+
+func (f *imageAferoFile) Write([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "write", Path: f.name, Err: syscall.EPERM}
+}
+
+func (f *imageAferoFile) WriteAt([]byte, int64) (int, error) {
+	return 0, &fs.PathError{Op: "write", Path: f.name, Err: syscall.EPERM}
+}
+
+func (f *imageAferoFile) WriteString(string) (int, error) {
+	return 0, &fs.PathError{Op: "write", Path: f.name, Err: syscall.EPERM}
+}
+
+func (f *imageAferoFile) Truncate(int64) error {
+	return &fs.PathError{Op: "truncate", Path: f.name, Err: syscall.EPERM}
+}
+
+// Sync is a nop since nothing can be written.
+func (f *imageAferoFile) Sync() error {
+	return nil
+}
@@ -0,0 +1,86 @@
+package image
+
+import (
+	"archive/tar"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAdapterImage(t *testing.T) *Image {
+	t.Helper()
+	return newTestImageFromLayers(t, []v1.Layer{
+		newTestTarLayer(t,
+			testTarEntry{name: "etc/", typeflag: tar.TypeDir, mode: 0755},
+			testTarEntry{name: "etc/os-release", contents: "ID=test"},
+			testTarEntry{name: "etc/shadow", contents: "root:*", mode: 0600},
+			testTarEntry{name: "usr/lib/os-release", linkname: "../../etc/os-release", typeflag: tar.TypeSymlink},
+		),
+		newTestTarLayer(t,
+			testTarEntry{name: "etc/.wh.shadow"},
+			testTarEntry{name: "etc/hostname", contents: "upper"},
+		),
+	})
+}
+
+func TestImage_AferoFS(t *testing.T) {
+	fsys := newTestAdapterImage(t).AferoFS()
+
+	for _, name := range []string{"/usr/lib/os-release", "usr/lib/os-release", "/usr/../etc/os-release"} {
+		contents, err := afero.ReadFile(fsys, name)
+		require.NoError(t, err, name)
+		assert.Equal(t, "ID=test", string(contents))
+	}
+
+	_, err := fsys.Open("/etc/shadow")
+	assert.True(t, os.IsNotExist(err), "expected a not exist error: %v", err)
+
+	var walked []string
+	require.NoError(t, afero.Walk(fsys, "/", func(p string, _ os.FileInfo, err error) error {
+		walked = append(walked, filepath.ToSlash(p))
+		return err
+	}))
+	assert.Equal(t, []string{"/", "/etc", "/etc/hostname", "/etc/os-release", "/usr", "/usr/lib", "/usr/lib/os-release"}, walked)
+
+	info, lstatCalled, err := fsys.(afero.Lstater).LstatIfPossible("/usr/lib/os-release")
+	require.NoError(t, err)
+	assert.True(t, lstatCalled)
+	assert.NotZero(t, info.Mode()&os.ModeSymlink)
+	target, err := fsys.(afero.LinkReader).ReadlinkIfPossible("/usr/lib/os-release")
+	require.NoError(t, err)
+	assert.Equal(t, "../../etc/os-release", target)
+
+	f, err := fsys.Open("/etc/hostname")
+	require.NoError(t, err)
+	defer f.Close()
+	assert.Equal(t, "/etc/hostname", f.Name())
+	buf := make([]byte, 2)
+	_, err = f.Read(buf)
+	require.NoError(t, err)
+	_, err = f.ReadAt(buf, 3)
+	require.NoError(t, err)
+	assert.Equal(t, "er", string(buf))
+	// random access does not change the offset of sequential reads
+	rest, err := io.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, "per", string(rest))
+	_, err = f.Seek(0, io.SeekStart)
+	require.NoError(t, err)
+	all, err := io.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, "upper", string(all))
+
+	_, err = f.WriteString("nope")
+	assert.True(t, errors.Is(err, syscall.EPERM))
+	assert.True(t, errors.Is(fsys.Remove("/etc/hostname"), syscall.EPERM))
+	_, err = fsys.OpenFile("/etc/hostname", os.O_RDWR, 0)
+	assert.True(t, errors.Is(err, syscall.EPERM))
+}
@@ -0,0 +1,291 @@
+package image
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/anchore/stereoscope/internal/log"
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree"
+	"github.com/anchore/stereoscope/pkg/filetree/filenode"
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// ErrNoImageContent indicates that an operation requires the image content (e.g. layer blobs or file contents), however,
+// the image only has the analysis of the content (e.g. the image was restored with LoadAnalysis).
+var ErrNoImageContent = errors.New("no image content available")
+
+// analysisBundleVersion is the schema version of the analysis bundle, incremented on any breaking change.
+const analysisBundleVersion = 1
+
+// analysisBundle is the serialized form of a completed image analysis (image metadata, layer trees, and the file catalog).
+type analysisBundle struct {
+	Version int             `json:"version"`
+	ImageID string          `json:"imageID"`
+	Tags    []string        `json:"tags,omitempty"`
+	Image   Metadata        `json:"image"`
+	Layers  []analysisLayer `json:"layers"`
+	// MergeStrategy is the union semantics the image was squashed with (the default when empty)
+	MergeStrategy MergeStrategy `json:"mergeStrategy,omitempty"`
+}
+
+// analysisLayer is the serialized form of a single layer tree and the file catalog entries for that layer.
+type analysisLayer struct {
+	Metadata    LayerMetadata   `json:"metadata"`
+	Unavailable bool            `json:"unavailable,omitempty"`
+	Entries     []analysisEntry `json:"entries"`
+}
+
+// analysisEntry is the serialized form of a single file catalog entry.
+type analysisEntry struct {
+	FileType file.Type     `json:"fileType"`
+	LinkPath file.Path     `json:"linkPath,omitempty"`
+	Metadata file.Metadata `json:"metadata"`
+	// ContentOrigin is the index of the layer that introduced the content of a metadata-only change (see
+	// FileCatalogEntry.ContentOrigin)
+	ContentOrigin *int `json:"contentOrigin,omitempty"`
+	// HardlinkTarget is the file that a hardlink entry is bound to (see FileCatalogEntry.HardlinkTarget)
+	HardlinkTarget *analysisFile `json:"hardlinkTarget,omitempty"`
+}
+
+// analysisFile identifies a single file catalog entry within the bundle by layer and path.
+type analysisFile struct {
+	Layer int       `json:"layer"`
+	Path  file.Path `json:"path"`
+}
+
+// SaveAnalysis writes all analysis for the given (already read) image to a single gzipped JSON file at the given path.
+// The bundle is keyed by the image ID and can be restored within another process with LoadAnalysis. Note: file
+// contents are not included in the bundle.
+func SaveAnalysis(img *Image, path string) error {
+	bundle, err := newAnalysisBundle(img)
+	if err != nil {
+		return err
+	}
+
+	fh, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("unable to create analysis bundle=%q: %w", path, err)
+	}
+	defer fh.Close()
+
+	gw := gzip.NewWriter(fh)
+	if err := json.NewEncoder(gw).Encode(bundle); err != nil {
+		return fmt.Errorf("unable to encode analysis bundle=%q: %w", path, err)
+	}
+	if err := gw.Close(); err != nil {
+		return fmt.Errorf("unable to write analysis bundle=%q: %w", path, err)
+	}
+	return fh.Close()
+}
+
+// LoadAnalysis restores an image from an analysis bundle previously written with SaveAnalysis. The returned image has
+// all metadata, layer trees, squash trees, and file catalog entries, however, no file contents are available and any
+// operation that requires the image content (e.g. Extract, Diff, or Flatten) returns ErrNoImageContent.
+func LoadAnalysis(path string) (*Image, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open analysis bundle=%q: %w", path, err)
+	}
+	defer fh.Close()
+
+	gr, err := gzip.NewReader(fh)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read analysis bundle=%q: %w", path, err)
+	}
+	defer gr.Close()
+
+	var bundle analysisBundle
+	if err := json.NewDecoder(gr).Decode(&bundle); err != nil {
+		return nil, fmt.Errorf("unable to decode analysis bundle=%q: %w", path, err)
+	}
+
+	img, err := bundle.image()
+	if err != nil {
+		return nil, fmt.Errorf("unable to restore analysis bundle=%q: %w", path, err)
+	}
+	return img, nil
+}
+
+func newAnalysisBundle(img *Image) (*analysisBundle, error) {
+	if img.Metadata.ID == "" {
+		return nil, fmt.Errorf("image has not been read")
+	}
+
+	bundle := &analysisBundle{
+		Version:       analysisBundleVersion,
+		ImageID:       img.Metadata.ID,
+		Image:         img.Metadata,
+		MergeStrategy: img.mergeStrategy,
+	}
+	// tags are not JSON serializable, so are captured separately
+	bundle.Image.Tags = nil
+	for _, t := range img.Metadata.Tags {
+		bundle.Tags = append(bundle.Tags, t.String())
+	}
+
+	layerIndexes := make(map[*Layer]int, len(img.Layers))
+	for idx, layer := range img.Layers {
+		layerIndexes[layer] = idx
+	}
+	for _, layer := range img.Layers {
+		bundle.Layers = append(bundle.Layers, analysisLayer{
+			Metadata:    layer.Metadata,
+			Unavailable: layer.Unavailable,
+			Entries:     layerAnalysisEntries(layer, &img.FileCatalog, layerIndexes),
+		})
+	}
+	return bundle, nil
+}
+
+func layerAnalysisEntries(layer *Layer, catalog *FileCatalog, layerIndexes map[*Layer]int) []analysisEntry {
+	var entries []analysisEntry
+	if layer.Tree == nil {
+		return nil
+	}
+	for _, n := range layer.Tree.Reader().Nodes() {
+		fn, ok := n.(*filenode.FileNode)
+		if !ok || fn.Reference == nil {
+			continue
+		}
+		catalogEntry, err := catalog.Get(*fn.Reference)
+		if err != nil {
+			// implicitly added parent directories have no catalog entry, these will be recreated upon load
+			continue
+		}
+		entry := analysisEntry{
+			FileType: fn.FileType,
+			LinkPath: fn.LinkPath,
+			Metadata: catalogEntry.Metadata,
+		}
+		if idx, ok := layerIndexes[catalogEntry.ContentOrigin]; ok {
+			entry.ContentOrigin = &idx
+		}
+		if catalogEntry.HardlinkTarget != nil {
+			if target, err := catalog.Get(*catalogEntry.HardlinkTarget); err == nil {
+				if idx, ok := layerIndexes[target.Layer]; ok {
+					entry.HardlinkTarget = &analysisFile{Layer: idx, Path: catalogEntry.HardlinkTarget.RealPath}
+				}
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	// keep the bundle stable and replay entries in the same order they were originally found
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Metadata.TarSequence != entries[j].Metadata.TarSequence {
+			return entries[i].Metadata.TarSequence < entries[j].Metadata.TarSequence
+		}
+		return entries[i].Metadata.Path < entries[j].Metadata.Path
+	})
+	return entries
+}
+
+func (b analysisBundle) image() (*Image, error) {
+	if b.Version != analysisBundleVersion {
+		return nil, fmt.Errorf("unsupported analysis bundle version: %d", b.Version)
+	}
+	if b.ImageID != b.Image.ID {
+		return nil, fmt.Errorf("analysis bundle is keyed by image=%q but contains image=%q", b.ImageID, b.Image.ID)
+	}
+	if len(b.Image.RawConfig) > 0 {
+		if id := fmt.Sprintf("sha256:%x", sha256.Sum256(b.Image.RawConfig)); id != b.ImageID {
+			return nil, fmt.Errorf("analysis bundle image config digest=%q does not match image=%q", id, b.ImageID)
+		}
+	}
+
+	img := &Image{
+		Metadata:      b.Image,
+		FileCatalog:   NewFileCatalog(),
+		mergeStrategy: b.MergeStrategy,
+	}
+	for _, t := range b.Tags {
+		tag, err := name.NewTag(t)
+		if err != nil {
+			log.Warnf("unable to parse image tag from analysis bundle %q: %+v", t, err)
+			continue
+		}
+		img.Metadata.Tags = append(img.Metadata.Tags, tag)
+	}
+
+	// the references of every entry by layer, so origins and hardlink bindings can be restored once all layers are added
+	refs := make([]map[file.Path]file.Reference, len(b.Layers))
+	for layerIdx, la := range b.Layers {
+		refs[layerIdx] = make(map[file.Path]file.Reference, len(la.Entries))
+		layer := &Layer{
+			Metadata:      la.Metadata,
+			Tree:          filetree.NewFileTree(),
+			fileCatalog:   &img.FileCatalog,
+			Unavailable:   la.Unavailable,
+			mergeStrategy: b.MergeStrategy,
+		}
+		for _, entry := range la.Entries {
+			ref, err := addTreePath(layer.Tree, entry.FileType, file.Path(entry.Metadata.Path), entry.LinkPath)
+			if err != nil {
+				return nil, err
+			}
+			if ref == nil {
+				return nil, fmt.Errorf("could not add path=%q link=%q from analysis bundle", entry.Metadata.Path, entry.LinkPath)
+			}
+			layer.trackHardlink(entry.Metadata)
+			layer.trackWhiteout(entry.Metadata)
+			img.FileCatalog.Add(*ref, entry.Metadata, layer, nil)
+			refs[layerIdx][file.Path(entry.Metadata.Path)] = *ref
+		}
+		img.Layers = append(img.Layers, layer)
+	}
+	img.bindSquashTrees()
+
+	if err := b.restoreEntryLinks(img, refs); err != nil {
+		return nil, err
+	}
+
+	if err := img.Squash(context.Background()); err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// restoreEntryLinks restores the content origin and hardlink binding of every entry that refers to another layer or
+// file within the bundle (given the references of every entry by layer).
+func (b analysisBundle) restoreEntryLinks(img *Image, refs []map[file.Path]file.Reference) error {
+	for layerIdx, la := range b.Layers {
+		for _, entry := range la.Entries {
+			if entry.ContentOrigin == nil && entry.HardlinkTarget == nil {
+				continue
+			}
+			ref := refs[layerIdx][file.Path(entry.Metadata.Path)]
+			if origin := entry.ContentOrigin; origin != nil {
+				if *origin < 0 || *origin >= len(img.Layers) {
+					return fmt.Errorf("invalid content origin layer=%d for path=%q from analysis bundle", *origin, entry.Metadata.Path)
+				}
+				img.FileCatalog.setContentOrigin(ref, img.Layers[*origin])
+			}
+			if target := entry.HardlinkTarget; target != nil {
+				if target.Layer < 0 || target.Layer >= len(refs) {
+					return fmt.Errorf("invalid hardlink target layer=%d for path=%q from analysis bundle", target.Layer, entry.Metadata.Path)
+				}
+				targetRef, ok := refs[target.Layer][target.Path]
+				if !ok {
+					return fmt.Errorf("hardlink target=%q for path=%q not found in analysis bundle", target.Path, entry.Metadata.Path)
+				}
+				img.FileCatalog.bindHardlink(ref, targetRef)
+			}
+		}
+	}
+	return nil
+}
+
+// requireImageContent returns ErrNoImageContent if the image has no underlying image content to read from.
+func (i *Image) requireImageContent() error {
+	if i.image == nil {
+		return ErrNoImageContent
+	}
+	return nil
+}
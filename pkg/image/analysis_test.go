@@ -0,0 +1,183 @@
+package image
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree"
+)
+
+func TestSaveAnalysis_LoadAnalysis(t *testing.T) {
+	randomImage, err := random.Image(64, 3)
+	require.NoError(t, err)
+
+	img := NewImage(randomImage, t.TempDir(), WithTags("anchore/example:latest"))
+	require.NoError(t, img.Read())
+
+	bundlePath := filepath.Join(t.TempDir(), "analysis.json.gz")
+	require.NoError(t, SaveAnalysis(img, bundlePath))
+
+	loaded, err := LoadAnalysis(bundlePath)
+	require.NoError(t, err)
+
+	assert.Equal(t, img.Metadata.ID, loaded.Metadata.ID)
+	assert.Equal(t, img.Metadata.Size, loaded.Metadata.Size)
+	assert.Equal(t, img.Metadata.RawConfig, loaded.Metadata.RawConfig)
+	assert.Equal(t, img.Metadata.Config.RootFS, loaded.Metadata.Config.RootFS)
+	assert.Equal(t, img.IDs(), loaded.IDs())
+	require.Len(t, loaded.Layers, len(img.Layers))
+
+	for idx, layer := range img.Layers {
+		assert.Equal(t, layer.Metadata, loaded.Layers[idx].Metadata)
+		assert.True(t, layer.Tree.Equal(loaded.Layers[idx].Tree), "layer %d tree differs", idx)
+		assert.True(t, layer.SquashedTree.Equal(loaded.Layers[idx].SquashedTree), "layer %d squash tree differs", idx)
+	}
+
+	for _, ref := range loaded.SquashedTree().AllFiles(file.AllTypes...) {
+		entry, err := loaded.FileCatalog.Get(ref)
+		require.NoError(t, err)
+
+		_, originalRef, err := img.SquashedTree().File(ref.RealPath)
+		require.NoError(t, err)
+		originalEntry, err := img.FileCatalog.Get(*originalRef)
+		require.NoError(t, err)
+		assert.Equal(t, originalEntry.Metadata, entry.Metadata)
+
+		// file contents are not part of the bundle
+		_, err = loaded.FileContentsFromSquash(ref.RealPath)
+		assert.Error(t, err)
+	}
+}
+
+func TestLoadAnalysis_Mismatch(t *testing.T) {
+	randomImage, err := random.Image(64, 1)
+	require.NoError(t, err)
+
+	img := NewImage(randomImage, t.TempDir())
+	require.NoError(t, img.Read())
+
+	bundle, err := newAnalysisBundle(img)
+	require.NoError(t, err)
+	bundle.ImageID = "sha256:0000"
+
+	bundlePath := filepath.Join(t.TempDir(), "analysis.json.gz")
+	fh, err := os.Create(bundlePath)
+	require.NoError(t, err)
+	gw := gzip.NewWriter(fh)
+	require.NoError(t, json.NewEncoder(gw).Encode(bundle))
+	require.NoError(t, gw.Close())
+	require.NoError(t, fh.Close())
+
+	_, err = LoadAnalysis(bundlePath)
+	assert.Error(t, err)
+}
+
+func TestSaveAnalysis_Unread(t *testing.T) {
+	randomImage, err := random.Image(64, 1)
+	require.NoError(t, err)
+
+	err = SaveAnalysis(NewImage(randomImage, t.TempDir()), filepath.Join(t.TempDir(), "analysis.json.gz"))
+	assert.Error(t, err)
+}
+
+func TestSaveAnalysis_LoadAnalysis_EntryLinks(t *testing.T) {
+	img := newTestImageFromLayers(t, []v1.Layer{
+		newTestTarLayer(t, testTarEntry{name: "etc/base", contents: "base"}),
+		newTestTarLayer(t,
+			testTarEntry{name: "etc/base", contents: "base", mode: 0600},
+			testTarEntry{name: "etc/link", typeflag: tar.TypeLink, linkname: "etc/base"},
+		),
+		// the original file is removed, however, the hardlink remains bound to the content
+		newTestTarLayer(t, testTarEntry{name: "etc/.wh.base"}, testTarEntry{name: "etc/lower-link", typeflag: tar.TypeLink, linkname: "etc/link"}),
+	}, WithMetadataOnlyChangeDetection())
+
+	bundlePath := filepath.Join(t.TempDir(), "analysis.json.gz")
+	require.NoError(t, SaveAnalysis(img, bundlePath))
+	loaded, err := LoadAnalysis(bundlePath)
+	require.NoError(t, err)
+
+	for idx, layer := range img.Layers {
+		for _, ref := range layer.Tree.AllFiles(file.AllTypes...) {
+			original, err := img.FileCatalog.Get(ref)
+			require.NoError(t, err)
+			_, loadedRef, err := loaded.Layers[idx].Tree.File(ref.RealPath)
+			require.NoError(t, err)
+			require.NotNil(t, loadedRef)
+			entry, err := loaded.FileCatalog.Get(*loadedRef)
+			require.NoError(t, err)
+
+			if original.ContentOrigin == nil {
+				assert.Nil(t, entry.ContentOrigin, "layer=%d path=%q", idx, ref.RealPath)
+			} else {
+				assert.Equal(t, original.ContentOrigin.Metadata.Index, entry.ContentLayer().Metadata.Index, "layer=%d path=%q", idx, ref.RealPath)
+			}
+
+			if original.HardlinkTarget == nil {
+				assert.Nil(t, entry.HardlinkTarget, "layer=%d path=%q", idx, ref.RealPath)
+				continue
+			}
+			require.NotNil(t, entry.HardlinkTarget, "layer=%d path=%q", idx, ref.RealPath)
+			originalTarget, err := img.FileCatalog.Get(*original.HardlinkTarget)
+			require.NoError(t, err)
+			target, err := loaded.FileCatalog.Get(*entry.HardlinkTarget)
+			require.NoError(t, err)
+			assert.Equal(t, originalTarget.Metadata, target.Metadata)
+			assert.Equal(t, originalTarget.Layer.Metadata.Index, target.Layer.Metadata.Index)
+		}
+	}
+
+	// the metadata-only change is attributed to the first layer, and the hardlinks are bound to that content
+	_, ref, err := loaded.Layers[1].Tree.File("/etc/base")
+	require.NoError(t, err)
+	entry, err := loaded.FileCatalog.Get(*ref)
+	require.NoError(t, err)
+	assert.Equal(t, loaded.Layers[0], entry.ContentLayer())
+	_, ref, err = loaded.SquashedTree().File("/etc/lower-link", filetree.DoNotFollowHardLinks)
+	require.NoError(t, err)
+	require.NotNil(t, ref)
+	entry, err = loaded.FileCatalog.Get(*ref)
+	require.NoError(t, err)
+	assert.NotNil(t, entry.HardlinkTarget)
+}
+
+func TestLoadAnalysis_NoImageContent(t *testing.T) {
+	randomImage, err := random.Image(64, 2)
+	require.NoError(t, err)
+	img := NewImage(randomImage, t.TempDir())
+	require.NoError(t, img.Read())
+
+	bundlePath := filepath.Join(t.TempDir(), "analysis.json.gz")
+	require.NoError(t, SaveAnalysis(img, bundlePath))
+	loaded, err := LoadAnalysis(bundlePath)
+	require.NoError(t, err)
+
+	// the config is part of the analysis
+	assert.Equal(t, img.Env(), loaded.Env())
+	assert.Equal(t, img.Cmd(), loaded.Cmd())
+	assert.Equal(t, img.Labels(), loaded.Labels())
+	assert.Len(t, loaded.History(), len(img.History()))
+
+	_, err = Flatten(loaded)
+	assert.ErrorIs(t, err, ErrNoImageContent)
+	assert.ErrorIs(t, loaded.WriteFlattenedTar(ioutil.Discard), ErrNoImageContent)
+	_, err = loaded.Extract(t.TempDir())
+	assert.ErrorIs(t, err, ErrNoImageContent)
+	_, err = Diff(img, loaded)
+	assert.ErrorIs(t, err, ErrNoImageContent)
+	_, err = Diff(loaded, img)
+	assert.ErrorIs(t, err, ErrNoImageContent)
+	assert.ErrorIs(t, loaded.WriteDockerArchive(ioutil.Discard), ErrNoImageContent)
+	assert.ErrorIs(t, loaded.WriteOCILayout(t.TempDir()), ErrNoImageContent)
+	assert.ErrorIs(t, loaded.Read(), ErrNoImageContent)
+}
@@ -0,0 +1,57 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/anchore/stereoscope/pkg/image/docker"
+	"github.com/anchore/stereoscope/pkg/image/oci"
+	"github.com/anchore/stereoscope/pkg/image/sif"
+)
+
+// ImageProvider is an image.Provider for an image archive on disk of any supported format (docker archive, OCI
+// archive, or Singularity image), where the format is determined from the archive contents. This is most useful for
+// archives fetched from a location that does not describe the format (e.g. an HTTP URL or object store key).
+type ImageProvider struct {
+	path      string
+	tmpDirGen *file.TempDirGenerator
+	platform  *image.Platform
+}
+
+// NewProviderFromPath creates a new provider instance for the image archive at the given path.
+func NewProviderFromPath(path string, tmpDirGen *file.TempDirGenerator, platform *image.Platform) *ImageProvider {
+	return &ImageProvider{
+		path:      path,
+		tmpDirGen: tmpDirGen,
+		platform:  platform,
+	}
+}
+
+// Provide an image object that represents the image archive at the configured path.
+func (p *ImageProvider) Provide(ctx context.Context, metadata ...image.AdditionalMetadata) (*image.Image, error) {
+	source, err := image.DetectSourceFromPath(p.path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to detect archive format: %w", err)
+	}
+
+	var provider image.Provider
+	switch source {
+	case image.DockerTarballSource:
+		if p.platform != nil {
+			return nil, fmt.Errorf("specified platform=%q however docker archives do not support selecting platform", p.platform.String())
+		}
+		provider = docker.NewProviderFromTarball(p.path, p.tmpDirGen)
+	case image.OciTarballSource:
+		provider = oci.NewProviderFromTarballWithPlatform(p.path, p.tmpDirGen, p.platform)
+	case image.SingularitySource:
+		if p.platform != nil {
+			return nil, fmt.Errorf("specified platform=%q however singularity images do not support selecting platform", p.platform.String())
+		}
+		provider = sif.NewProviderFromPath(p.path, p.tmpDirGen)
+	default:
+		return nil, fmt.Errorf("not a supported image archive")
+	}
+	return provider.Provide(ctx, metadata...)
+}
@@ -0,0 +1,103 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/anchore/stereoscope/pkg/image/docker"
+	"github.com/anchore/stereoscope/pkg/image/oci"
+	"github.com/anchore/stereoscope/pkg/image/sif"
+)
+
+// ReaderImageProvider is an image.Provider for an image archive streamed from a reader (e.g. the output of
+// "docker save" piped to stdin). Image archives require random access, so the stream is spooled into the temp dir of
+// the provider (which is removed along with all other image content on cleanup) and then provided as the given source
+// format (or any supported format, see ImageProvider, when the source is unknown).
+type ReaderImageProvider struct {
+	reader    io.Reader
+	source    image.Source
+	tmpDirGen *file.TempDirGenerator
+	platform  *image.Platform
+}
+
+// NewProviderFromReader creates a new provider instance for the image archive streamed from the given reader. The
+// source must be an archive format (docker archive, OCI archive, or Singularity image) or image.UnknownSource to
+// determine the format from the archive contents.
+func NewProviderFromReader(reader io.Reader, source image.Source, tmpDirGen *file.TempDirGenerator, platform *image.Platform) *ReaderImageProvider {
+	return &ReaderImageProvider{
+		reader:    reader,
+		source:    source,
+		tmpDirGen: tmpDirGen,
+		platform:  platform,
+	}
+}
+
+// Provide an image object that represents the image archive read from the configured reader. The reader is consumed
+// entirely, so the provider can only be used once.
+func (p *ReaderImageProvider) Provide(ctx context.Context, metadata ...image.AdditionalMetadata) (*image.Image, error) {
+	switch p.source {
+	case image.UnknownSource, image.DockerTarballSource, image.OciTarballSource, image.SingularitySource:
+	default:
+		return nil, fmt.Errorf("image source=%q cannot be read from a stream", p.source)
+	}
+
+	tempDir, err := p.tmpDirGen.NewDirectory("stream-archive")
+	if err != nil {
+		return nil, err
+	}
+
+	archivePath := filepath.Join(tempDir, "archive")
+	if err := spool(ctx, p.reader, archivePath); err != nil {
+		return nil, fmt.Errorf("unable to read image archive stream: %w", err)
+	}
+
+	var provider image.Provider
+	switch p.source {
+	case image.DockerTarballSource:
+		if p.platform != nil {
+			return nil, fmt.Errorf("specified platform=%q however docker archives do not support selecting platform", p.platform.String())
+		}
+		provider = docker.NewProviderFromTarball(archivePath, p.tmpDirGen)
+	case image.OciTarballSource:
+		provider = oci.NewProviderFromTarballWithPlatform(archivePath, p.tmpDirGen, p.platform)
+	case image.SingularitySource:
+		if p.platform != nil {
+			return nil, fmt.Errorf("specified platform=%q however singularity images do not support selecting platform", p.platform.String())
+		}
+		provider = sif.NewProviderFromPath(archivePath, p.tmpDirGen)
+	default:
+		provider = NewProviderFromPath(archivePath, p.tmpDirGen, p.platform)
+	}
+	return provider.Provide(ctx, metadata...)
+}
+
+func spool(ctx context.Context, reader io.Reader, dest string) error {
+	fh, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	if _, err := io.Copy(fh, contextReader{ctx: ctx, reader: reader}); err != nil {
+		return err
+	}
+	return fh.Close()
+}
+
+// contextReader stops reading once the context is done (a blocked read, e.g. on stdin, is not interrupted).
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.reader.Read(p)
+}
@@ -0,0 +1,67 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+)
+
+func TestReaderImageProvider_Provide(t *testing.T) {
+	img, err := random.Image(1024, 2)
+	require.NoError(t, err)
+	tag, err := name.NewTag("example.com/repo:latest")
+	require.NoError(t, err)
+	archive := &bytes.Buffer{}
+	require.NoError(t, tarball.Write(tag, img, archive))
+	content := archive.Bytes()
+
+	expectedID, err := img.ConfigName()
+	require.NoError(t, err)
+
+	for _, source := range []image.Source{image.DockerTarballSource, image.UnknownSource} {
+		t.Run(source.String(), func(t *testing.T) {
+			generator := file.NewTempDirGenerator("stereoscope-reader-archive-test")
+			defer generator.Cleanup()
+
+			provided, err := NewProviderFromReader(bytes.NewReader(content), source, generator, nil).Provide(context.Background())
+			require.NoError(t, err)
+			require.NoError(t, provided.Read())
+
+			assert.Equal(t, expectedID.String(), provided.Metadata.ID)
+			assert.Len(t, provided.Layers, 2)
+			require.Len(t, provided.Metadata.Tags, 1)
+			assert.Equal(t, tag.String(), provided.Metadata.Tags[0].String())
+		})
+	}
+}
+
+func TestReaderImageProvider_Provide_Errors(t *testing.T) {
+	generator := file.NewTempDirGenerator("stereoscope-reader-archive-test")
+	defer generator.Cleanup()
+
+	t.Run("not an archive source", func(t *testing.T) {
+		_, err := NewProviderFromReader(bytes.NewReader(nil), image.OciRegistrySource, generator, nil).Provide(context.Background())
+		assert.Error(t, err)
+	})
+
+	t.Run("not an image archive", func(t *testing.T) {
+		_, err := NewProviderFromReader(bytes.NewReader([]byte("not an archive")), image.UnknownSource, generator, nil).Provide(context.Background())
+		assert.Error(t, err)
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := NewProviderFromReader(bytes.NewReader([]byte("content")), image.DockerTarballSource, generator, nil).Provide(ctx)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
@@ -0,0 +1,124 @@
+package image
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// BandwidthLimiter limits the combined rate (in bytes per second) at which response bodies are read for all
+// transports sharing the limiter. A single limiter may be shared across many image fetches to enforce a global
+// (or per-session) limit.
+type BandwidthLimiter struct {
+	lock           sync.Mutex
+	bytesPerSecond float64
+	burst          float64
+	tokens         float64
+	last           time.Time
+	now            func() time.Time
+}
+
+// NewBandwidthLimiter creates a limiter allowing the given number of bytes per second (with a burst of up to one
+// second worth of bytes). A non-positive rate disables limiting (nil is returned).
+func NewBandwidthLimiter(bytesPerSecond int64) *BandwidthLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	return &BandwidthLimiter{
+		bytesPerSecond: float64(bytesPerSecond),
+		burst:          float64(bytesPerSecond),
+		tokens:         float64(bytesPerSecond),
+		now:            time.Now,
+	}
+}
+
+// reserve takes n bytes from the budget, returning how long the caller must wait before the bytes may be used.
+func (b *BandwidthLimiter) reserve(n int) time.Duration {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	now := b.now()
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.bytesPerSecond
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.bytesPerSecond * float64(time.Second))
+}
+
+func (b *BandwidthLimiter) wait(ctx context.Context, n int) error {
+	delay := b.reserve(n)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Transport wraps the given round tripper such that all response bodies are read no faster than the limiter allows.
+func (b *BandwidthLimiter) Transport(base http.RoundTripper) http.RoundTripper {
+	if b == nil {
+		return base
+	}
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &limitedTransport{base: base, limiter: b}
+}
+
+type limitedTransport struct {
+	base    http.RoundTripper
+	limiter *BandwidthLimiter
+}
+
+func (t *limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.Body == nil {
+		return resp, err
+	}
+	resp.Body = &limitedReadCloser{
+		ctx:     req.Context(),
+		reader:  resp.Body,
+		limiter: t.limiter,
+	}
+	return resp, nil
+}
+
+type limitedReadCloser struct {
+	ctx     context.Context
+	reader  io.ReadCloser
+	limiter *BandwidthLimiter
+}
+
+func (r *limitedReadCloser) Read(p []byte) (int, error) {
+	// never read more than the burst size at once, otherwise a single read could exceed the limit
+	if burst := int(r.limiter.burst); len(p) > burst {
+		p = p[:burst]
+	}
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		if waitErr := r.limiter.wait(r.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+func (r *limitedReadCloser) Close() error {
+	return r.reader.Close()
+}
@@ -0,0 +1,62 @@
+package image
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBandwidthLimiter_reserve(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := NewBandwidthLimiter(100)
+	limiter.now = func() time.Time { return now }
+
+	// the first second worth of bytes is available immediately
+	assert.Equal(t, time.Duration(0), limiter.reserve(100))
+	// anything further must wait for the budget to recover
+	assert.Equal(t, 500*time.Millisecond, limiter.reserve(50))
+
+	now = now.Add(time.Second)
+	assert.Equal(t, time.Duration(0), limiter.reserve(50))
+
+	// the budget never recovers beyond the burst size
+	now = now.Add(time.Hour)
+	assert.Equal(t, time.Duration(0), limiter.reserve(100))
+	assert.Equal(t, time.Second, limiter.reserve(100))
+}
+
+func TestNewBandwidthLimiter_Disabled(t *testing.T) {
+	assert.Nil(t, NewBandwidthLimiter(0))
+	assert.Nil(t, NewBandwidthLimiter(-1))
+
+	var limiter *BandwidthLimiter
+	assert.Equal(t, http.DefaultTransport, limiter.Transport(http.DefaultTransport))
+}
+
+func TestBandwidthLimiter_Transport(t *testing.T) {
+	payload := bytes.Repeat([]byte("a"), 100*1024)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(payload)
+	}))
+	t.Cleanup(server.Close)
+
+	// half of the payload is available as burst, the remaining half should take ~1 second
+	opts := RegistryOptions{BandwidthLimit: 50 * 1024}
+	client := &http.Client{Transport: opts.Transport(http.DefaultTransport)}
+
+	start := time.Now()
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+
+	assert.Equal(t, payload, body)
+	assert.GreaterOrEqual(t, time.Since(start), 900*time.Millisecond)
+}
@@ -0,0 +1,201 @@
+package image
+
+import (
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// BaseImageEvidence describes how a base image was detected.
+type BaseImageEvidence string
+
+const (
+	// BaseImageFromLayers indicates that the layers of a known base image (see BaseImageCandidate) are the lowest
+	// layers of the image.
+	BaseImageFromLayers BaseImageEvidence = "layers"
+	// BaseImageFromAnnotations indicates that the image is annotated with the base image name or digest (see
+	// AnnotationBaseImageName and AnnotationBaseImageDigest).
+	BaseImageFromAnnotations BaseImageEvidence = "annotations"
+	// BaseImageFromHistory indicates that the config history shows where the build of the base image ended (the last
+	// CMD or ENTRYPOINT instruction followed by more layers).
+	BaseImageFromHistory BaseImageEvidence = "history"
+)
+
+// BaseImageCandidate is a known base image that the lowest layers of an image are compared against.
+type BaseImageCandidate struct {
+	// Name is the reference of the base image (e.g. "docker.io/library/alpine:3.14")
+	Name string
+	// Digest is the manifest digest of the base image (optional)
+	Digest string
+	// LayerDigests are the digests of the uncompressed layers (diff IDs) of the base image, lowest layer first
+	LayerDigests []string
+}
+
+// NewBaseImageCandidate describes the given (read) image as a base image candidate with the given name.
+func NewBaseImageCandidate(name string, img *Image) BaseImageCandidate {
+	candidate := BaseImageCandidate{
+		Name:   name,
+		Digest: img.Metadata.ManifestDigest,
+	}
+	for _, diffID := range img.Metadata.Config.RootFS.DiffIDs {
+		candidate.LayerDigests = append(candidate.LayerDigests, diffID.String())
+	}
+	return candidate
+}
+
+// BaseImage describes the base image that the lowest layers of an image likely came from (see DetectBaseImage).
+type BaseImage struct {
+	// Name is the reference of the base image (empty when only the history shows a base image)
+	Name string
+	// Digest is the manifest digest of the base image (empty when not known)
+	Digest string
+	// Layers is the number of lowest layers of the image that came from the base image (zero when the base image is
+	// named by annotations, however, neither the candidates nor the history show which layers it contributed)
+	Layers int
+	// Evidence is every way the base image was detected, strongest evidence first
+	Evidence []BaseImageEvidence
+}
+
+// DetectBaseImage reports which prefix of the image layers likely came from a base image, or nil if there is no
+// evidence of a base image. The strongest evidence is a layer match against the given candidates (the candidate with
+// the most layers wins when several match), followed by the OCI base image annotations on the manifest (or on the
+// layer descriptors), followed by the config history. Annotations that contradict a layer match are ignored. Only the
+// image metadata is used, so the layer contents do not need to be available.
+func (i *Image) DetectBaseImage(candidates ...BaseImageCandidate) *BaseImage {
+	var base *BaseImage
+
+	if candidate := i.matchBaseImageCandidate(candidates); candidate != nil {
+		base = &BaseImage{
+			Name:     candidate.Name,
+			Digest:   candidate.Digest,
+			Layers:   len(candidate.LayerDigests),
+			Evidence: []BaseImageEvidence{BaseImageFromLayers},
+		}
+	}
+
+	if annotatedName, annotatedDigest := i.baseImageAnnotations(); annotatedName != "" || annotatedDigest != "" {
+		switch {
+		case base == nil:
+			base = &BaseImage{
+				Name:     annotatedName,
+				Digest:   annotatedDigest,
+				Evidence: []BaseImageEvidence{BaseImageFromAnnotations},
+			}
+		case sameBaseImage(*base, annotatedName, annotatedDigest):
+			base.Evidence = append(base.Evidence, BaseImageFromAnnotations)
+			if base.Digest == "" {
+				base.Digest = annotatedDigest
+			}
+		}
+	}
+
+	if layers := i.historyBaseLayers(); layers > 0 {
+		switch {
+		case base == nil:
+			base = &BaseImage{
+				Layers:   layers,
+				Evidence: []BaseImageEvidence{BaseImageFromHistory},
+			}
+		case base.Layers == 0:
+			base.Layers = layers
+			base.Evidence = append(base.Evidence, BaseImageFromHistory)
+		case base.Layers == layers:
+			base.Evidence = append(base.Evidence, BaseImageFromHistory)
+		}
+	}
+
+	return base
+}
+
+// matchBaseImageCandidate returns the candidate with the most layers where all layers are the lowest layers of the
+// image (nil if none match).
+func (i *Image) matchBaseImageCandidate(candidates []BaseImageCandidate) *BaseImageCandidate {
+	diffIDs := i.Metadata.Config.RootFS.DiffIDs
+	var best *BaseImageCandidate
+	for idx, candidate := range candidates {
+		if len(candidate.LayerDigests) == 0 || len(candidate.LayerDigests) > len(diffIDs) {
+			continue
+		}
+		matches := true
+		for pos, digest := range candidate.LayerDigests {
+			if diffIDs[pos].String() != digest {
+				matches = false
+				break
+			}
+		}
+		if matches && (best == nil || len(candidate.LayerDigests) > len(best.LayerDigests)) {
+			best = &candidates[idx]
+		}
+	}
+	return best
+}
+
+// baseImageAnnotations returns the base image name and digest annotated on the manifest, or otherwise on any layer
+// descriptor.
+func (i *Image) baseImageAnnotations() (string, string) {
+	baseName, baseDigest := i.Metadata.Annotations[AnnotationBaseImageName], i.Metadata.Annotations[AnnotationBaseImageDigest]
+	for _, layer := range i.Layers {
+		if baseName == "" {
+			baseName = layer.Metadata.Annotations[AnnotationBaseImageName]
+		}
+		if baseDigest == "" {
+			baseDigest = layer.Metadata.Annotations[AnnotationBaseImageDigest]
+		}
+	}
+	return baseName, baseDigest
+}
+
+// sameBaseImage indicates if the given annotated name or digest describe the given base image (names are compared
+// after normalization, so "alpine" is "docker.io/library/alpine:latest").
+func sameBaseImage(base BaseImage, annotatedName, annotatedDigest string) bool {
+	if annotatedDigest != "" && base.Digest != "" {
+		return annotatedDigest == base.Digest
+	}
+	if annotatedName == "" || base.Name == "" {
+		return false
+	}
+	a, err := name.ParseReference(annotatedName, name.WeakValidation)
+	if err != nil {
+		return false
+	}
+	b, err := name.ParseReference(base.Name, name.WeakValidation)
+	if err != nil {
+		return false
+	}
+	return a.Name() == b.Name()
+}
+
+// historyBaseLayers returns the number of layers produced up to (and including) the last CMD or ENTRYPOINT history
+// entry that is followed by more layers, since these instructions typically end the build of a base image. Zero is
+// returned when the history shows no such boundary.
+func (i *Image) historyBaseLayers() int {
+	// boundary is the number of layers at the last CMD or ENTRYPOINT entry, which is only taken as the base once more
+	// layers follow (otherwise the instruction ends the build of this image)
+	layers, boundary, baseLayers := 0, 0, 0
+	for _, entry := range i.History() {
+		if !entry.History.EmptyLayer {
+			layers++
+			baseLayers = boundary
+			continue
+		}
+		switch historyInstruction(entry.CreatedBy()) {
+		case "CMD", "ENTRYPOINT":
+			boundary = layers
+		}
+	}
+	return baseLayers
+}
+
+// historyInstruction returns the Dockerfile instruction of a history entry, as recorded by both the classic builder
+// (e.g. "/bin/sh -c #(nop)  CMD [\"sh\"]") and buildkit (e.g. "CMD [\"sh\"]").
+func historyInstruction(createdBy string) string {
+	createdBy = strings.TrimSpace(createdBy)
+	if idx := strings.Index(createdBy, "#(nop)"); idx >= 0 {
+		createdBy = strings.TrimSpace(createdBy[idx+len("#(nop)"):])
+	}
+	fields := strings.Fields(createdBy)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToUpper(fields[0])
+}
@@ -0,0 +1,199 @@
+package image
+
+import (
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImage_DetectBaseImage_Layers(t *testing.T) {
+	layer := func(name string) v1.Layer {
+		return newTestTarLayer(t, testTarEntry{name: name, contents: name + " contents"})
+	}
+	os1, os2, runtime, app := layer("os-1"), layer("os-2"), layer("runtime"), layer("app")
+
+	osImg := newTestImageFromLayers(t, []v1.Layer{os1, os2})
+	runtimeImg := newTestImageFromLayers(t, []v1.Layer{os1, os2, runtime})
+	appImg := newTestImageFromLayers(t, []v1.Layer{os1, os2, runtime, app})
+	otherImg := newTestImageFromLayers(t, []v1.Layer{runtime, app})
+
+	candidates := []BaseImageCandidate{
+		NewBaseImageCandidate("example.com/os:1", osImg),
+		NewBaseImageCandidate("example.com/runtime:1", runtimeImg),
+		NewBaseImageCandidate("example.com/other:1", otherImg),
+	}
+
+	base := appImg.DetectBaseImage(candidates...)
+	require.NotNil(t, base)
+	// the candidate with the most matching layers wins
+	assert.Equal(t, "example.com/runtime:1", base.Name)
+	assert.Equal(t, 3, base.Layers)
+	assert.Equal(t, []BaseImageEvidence{BaseImageFromLayers}, base.Evidence)
+
+	// an image is not its own base image when it has more layers than the candidate
+	base = osImg.DetectBaseImage(candidates[1:]...)
+	assert.Nil(t, base)
+}
+
+func TestImage_DetectBaseImage_Annotations(t *testing.T) {
+	diffIDs := []v1.Hash{
+		{Algorithm: "sha256", Hex: "aaaa"},
+		{Algorithm: "sha256", Hex: "bbbb"},
+		{Algorithm: "sha256", Hex: "cccc"},
+	}
+	newImage := func(manifestAnnotations, layerAnnotations map[string]string) *Image {
+		img := &Image{
+			Metadata: Metadata{
+				Annotations: manifestAnnotations,
+				Config:      v1.ConfigFile{RootFS: v1.RootFS{DiffIDs: diffIDs}},
+			},
+		}
+		for range diffIDs {
+			img.Layers = append(img.Layers, &Layer{Metadata: LayerMetadata{Annotations: layerAnnotations}})
+		}
+		return img
+	}
+	alpine := BaseImageCandidate{
+		Name:         "docker.io/library/alpine:3.14",
+		LayerDigests: []string{"sha256:aaaa"},
+	}
+
+	tests := []struct {
+		name        string
+		img         *Image
+		candidates  []BaseImageCandidate
+		expected    *BaseImage
+		expectedNil bool
+	}{
+		{
+			name: "manifest annotations only",
+			img: newImage(map[string]string{
+				AnnotationBaseImageName:   "alpine:3.14",
+				AnnotationBaseImageDigest: "sha256:1234",
+			}, nil),
+			expected: &BaseImage{
+				Name:     "alpine:3.14",
+				Digest:   "sha256:1234",
+				Evidence: []BaseImageEvidence{BaseImageFromAnnotations},
+			},
+		},
+		{
+			name: "layer annotations only",
+			img: newImage(nil, map[string]string{
+				AnnotationBaseImageName: "alpine:3.14",
+			}),
+			expected: &BaseImage{
+				Name:     "alpine:3.14",
+				Evidence: []BaseImageEvidence{BaseImageFromAnnotations},
+			},
+		},
+		{
+			name: "annotations agree with layer match",
+			img: newImage(map[string]string{
+				AnnotationBaseImageName:   "alpine:3.14",
+				AnnotationBaseImageDigest: "sha256:1234",
+			}, nil),
+			candidates: []BaseImageCandidate{alpine},
+			expected: &BaseImage{
+				Name:     "docker.io/library/alpine:3.14",
+				Digest:   "sha256:1234",
+				Layers:   1,
+				Evidence: []BaseImageEvidence{BaseImageFromLayers, BaseImageFromAnnotations},
+			},
+		},
+		{
+			name: "annotations contradict layer match",
+			img: newImage(map[string]string{
+				AnnotationBaseImageName: "debian:11",
+			}, nil),
+			candidates: []BaseImageCandidate{alpine},
+			expected: &BaseImage{
+				Name:     "docker.io/library/alpine:3.14",
+				Layers:   1,
+				Evidence: []BaseImageEvidence{BaseImageFromLayers},
+			},
+		},
+		{
+			name:        "no evidence",
+			img:         newImage(nil, nil),
+			expectedNil: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			base := test.img.DetectBaseImage(test.candidates...)
+			if test.expectedNil {
+				assert.Nil(t, base)
+				return
+			}
+			assert.Equal(t, test.expected, base)
+		})
+	}
+}
+
+func TestImage_DetectBaseImage_History(t *testing.T) {
+	newImage := func(history ...v1.History) *Image {
+		return &Image{Metadata: Metadata{Config: v1.ConfigFile{History: history}}}
+	}
+	tests := []struct {
+		name     string
+		img      *Image
+		expected int
+	}{
+		{
+			name: "classic builder",
+			img: newImage(
+				v1.History{CreatedBy: "/bin/sh -c #(nop) ADD file:1234 in / "},
+				v1.History{CreatedBy: "/bin/sh -c #(nop)  CMD [\"/bin/sh\"]", EmptyLayer: true},
+				v1.History{CreatedBy: "/bin/sh -c apk add curl"},
+				v1.History{CreatedBy: "/bin/sh -c #(nop) COPY file:5678 in /app "},
+				v1.History{CreatedBy: "/bin/sh -c #(nop)  ENTRYPOINT [\"/app\"]", EmptyLayer: true},
+			),
+			expected: 1,
+		},
+		{
+			name: "buildkit with a base image of a base image",
+			img: newImage(
+				v1.History{CreatedBy: "/bin/sh -c #(nop) ADD file:1234 in / "},
+				v1.History{CreatedBy: "/bin/sh -c #(nop)  CMD [\"bash\"]", EmptyLayer: true},
+				v1.History{CreatedBy: "RUN /bin/sh -c apt-get install -y python3 # buildkit"},
+				v1.History{CreatedBy: "ENV LANG=C.UTF-8", EmptyLayer: true},
+				v1.History{CreatedBy: "CMD [\"python3\"]", EmptyLayer: true},
+				v1.History{CreatedBy: "COPY . /app # buildkit"},
+			),
+			expected: 2,
+		},
+		{
+			name: "no boundary followed by layers",
+			img: newImage(
+				v1.History{CreatedBy: "/bin/sh -c #(nop) ADD file:1234 in / "},
+				v1.History{CreatedBy: "/bin/sh -c #(nop)  CMD [\"/bin/sh\"]", EmptyLayer: true},
+			),
+			expected: 0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			base := test.img.DetectBaseImage()
+			if test.expected == 0 {
+				assert.Nil(t, base)
+				return
+			}
+			require.NotNil(t, base)
+			assert.Equal(t, test.expected, base.Layers)
+			assert.Equal(t, []BaseImageEvidence{BaseImageFromHistory}, base.Evidence)
+		})
+	}
+}
+
+func TestHistoryInstruction(t *testing.T) {
+	assert.Equal(t, "CMD", historyInstruction("/bin/sh -c #(nop)  CMD [\"/bin/sh\"]"))
+	assert.Equal(t, "ENTRYPOINT", historyInstruction("ENTRYPOINT [\"/app\"]"))
+	assert.Equal(t, "RUN", historyInstruction("RUN /bin/sh -c make # buildkit"))
+	assert.Equal(t, "/BIN/SH", historyInstruction("/bin/sh -c make"))
+	assert.Equal(t, "", historyInstruction("  "))
+}
@@ -0,0 +1,159 @@
+package image
+
+import (
+	"io/fs"
+	"os"
+	"path"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/helper/chroot"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+// basic interface assertions
+var _ billy.Filesystem = (*imageBillyFS)(nil)
+var _ billy.Capable = (*imageBillyFS)(nil)
+var _ billy.File = (*imageBillyFile)(nil)
+
+// imageBillyFS is a read-only billy.Filesystem view of an image squash tree (see Image.BillyFS).
+type imageBillyFS struct {
+	fsys *imageFS
+}
+
+// BillyFS returns the image squash tree as a read-only billy.Filesystem (e.g. for use with go-git), with the same
+// semantics as FS. Paths may be absolute or relative to the image root (e.g. "/etc/os-release" or "etc/os-release").
+// All modifications fail with billy.ErrReadOnly. Note: symlinks are always resolved relative to the image root, even
+// within a Chroot of the filesystem.
+func (i *Image) BillyFS() billy.Filesystem {
+	return &imageBillyFS{
+		fsys: i.FS().(*imageFS),
+	}
+}
+
+// Capabilities indicates the filesystem can only be read (see billy.Capable).
+func (b *imageBillyFS) Capabilities() billy.Capability {
+	return billy.ReadCapability | billy.SeekCapability
+}
+
+func (b *imageBillyFS) Open(filename string) (billy.File, error) {
+	f, err := b.fsys.Open(imageFSName(filename))
+	if err != nil {
+		return nil, err
+	}
+	return &imageBillyFile{imageFSFile: f.(*imageFSFile), name: filename}, nil
+}
+
+func (b *imageBillyFS) OpenFile(filename string, flag int, _ os.FileMode) (billy.File, error) {
+	if isWriteFlag(flag) {
+		return nil, billy.ErrReadOnly
+	}
+	return b.Open(filename)
+}
+
+func (b *imageBillyFS) Stat(filename string) (os.FileInfo, error) {
+	return b.fsys.Stat(imageFSName(filename))
+}
+
+func (b *imageBillyFS) Lstat(filename string) (os.FileInfo, error) {
+	fsName := imageFSName(filename)
+	_, metadata, err := b.fsys.resolve("lstat", fsName, false)
+	if err != nil {
+		return nil, err
+	}
+	return newImageFSFileInfo(fsName, metadata), nil
+}
+
+func (b *imageBillyFS) Readlink(link string) (string, error) {
+	_, metadata, err := b.fsys.resolve("readlink", imageFSName(link), false)
+	if err != nil {
+		return "", err
+	}
+	if file.Type(metadata.TypeFlag) != file.TypeSymlink {
+		return "", &fs.PathError{Op: "readlink", Path: link, Err: fs.ErrInvalid}
+	}
+	return metadata.Linkname, nil
+}
+
+// ReadDir reads the named directory, returning all entries sorted by filename (entries for links describe the link).
+func (b *imageBillyFS) ReadDir(p string) ([]os.FileInfo, error) {
+	entries, err := b.fsys.ReadDir(imageFSName(p))
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func (b *imageBillyFS) Join(elem ...string) string {
+	return path.Join(elem...)
+}
+
+// Chroot returns a view of the given directory within the filesystem.
+func (b *imageBillyFS) Chroot(p string) (billy.Filesystem, error) {
+	return chroot.New(b, b.Join(b.Root(), p)), nil
+}
+
+func (b *imageBillyFS) Root() string {
+	return file.DirSeparator
+}
+
+func (b *imageBillyFS) Create(string) (billy.File, error) {
+	return nil, billy.ErrReadOnly
+}
+
+func (b *imageBillyFS) Rename(string, string) error {
+	return billy.ErrReadOnly
+}
+
+func (b *imageBillyFS) Remove(string) error {
+	return billy.ErrReadOnly
+}
+
+func (b *imageBillyFS) TempFile(string, string) (billy.File, error) {
+	return nil, billy.ErrReadOnly
+}
+
+func (b *imageBillyFS) MkdirAll(string, os.FileMode) error {
+	return billy.ErrReadOnly
+}
+
+func (b *imageBillyFS) Symlink(string, string) error {
+	return billy.ErrReadOnly
+}
+
+// imageBillyFile is an open (read-only) file within an imageBillyFS.
+type imageBillyFile struct {
+	*imageFSFile
+	// name is the path as given when opened
+	name string
+}
+
+func (f *imageBillyFile) Name() string {
+	return f.name
+}
+
+func (f *imageBillyFile) Write([]byte) (int, error) {
+	return 0, billy.ErrReadOnly
+}
+
+func (f *imageBillyFile) Truncate(int64) error {
+	return billy.ErrReadOnly
+}
+
+// Lock is a nop since nothing can be written.
+func (f *imageBillyFile) Lock() error {
+	return nil
+}
+
+// Unlock is a nop since nothing can be written.
+func (f *imageBillyFile) Unlock() error {
+	return nil
+}
@@ -0,0 +1,60 @@
+package image
+
+import (
+	"io"
+	"os"
+	"testing"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImage_BillyFS(t *testing.T) {
+	fsys := newTestAdapterImage(t).BillyFS()
+
+	contents, err := util.ReadFile(fsys, "/usr/lib/os-release")
+	require.NoError(t, err)
+	assert.Equal(t, "ID=test", string(contents))
+
+	_, err = fsys.Stat("/etc/shadow")
+	assert.True(t, os.IsNotExist(err), "expected a not exist error: %v", err)
+
+	infos, err := fsys.ReadDir("/etc")
+	require.NoError(t, err)
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	assert.Equal(t, []string{"hostname", "os-release"}, names)
+
+	info, err := fsys.Lstat("usr/lib/os-release")
+	require.NoError(t, err)
+	assert.NotZero(t, info.Mode()&os.ModeSymlink)
+	target, err := fsys.Readlink("usr/lib/os-release")
+	require.NoError(t, err)
+	assert.Equal(t, "../../etc/os-release", target)
+
+	etc, err := fsys.Chroot("/etc")
+	require.NoError(t, err)
+	contents, err = util.ReadFile(etc, "hostname")
+	require.NoError(t, err)
+	assert.Equal(t, "upper", string(contents))
+
+	f, err := fsys.Open("/etc/os-release")
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = f.Seek(3, io.SeekStart)
+	require.NoError(t, err)
+	rest, err := io.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, "test", string(rest))
+
+	assert.Equal(t, billy.ReadCapability|billy.SeekCapability, billy.Capabilities(fsys))
+	_, err = f.Write([]byte("nope"))
+	assert.Equal(t, billy.ErrReadOnly, err)
+	_, err = fsys.Create("/etc/new")
+	assert.Equal(t, billy.ErrReadOnly, err)
+	assert.Equal(t, billy.ErrReadOnly, fsys.MkdirAll("/opt", 0755))
+}
@@ -0,0 +1,47 @@
+package image
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultBlobCacheDir returns the conventional location of the persistent layer blob cache (see WithBlobCache) within
+// the user cache directory (e.g. ~/.cache/stereoscope/blobs on linux).
+func DefaultBlobCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to find user cache directory: %w", err)
+	}
+	return filepath.Join(dir, "stereoscope", "blobs"), nil
+}
+
+// blobCachePath returns the location of the uncompressed layer tar with the given digest (diff ID) within the blob
+// cache directory, laid out by algorithm (e.g. "<dir>/sha256/<hex>"). The algorithm directory is created if needed.
+func blobCachePath(dir, digest string) (string, error) {
+	algorithm, hex := splitBlobDigest(digest)
+	if algorithm == "" {
+		return "", fmt.Errorf("invalid layer digest=%q for blob cache", digest)
+	}
+	algorithmDir := filepath.Join(dir, algorithm)
+	if err := os.MkdirAll(algorithmDir, 0755); err != nil {
+		return "", fmt.Errorf("unable to create blob cache directory=%q: %w", algorithmDir, err)
+	}
+	return filepath.Join(algorithmDir, hex), nil
+}
+
+// splitBlobDigest returns the algorithm and hex portions of the given digest (empty if the digest cannot safely be
+// used as a path within the blob cache).
+func splitBlobDigest(digest string) (string, string) {
+	fields := strings.SplitN(digest, ":", 2)
+	if len(fields) != 2 || fields[0] == "" || fields[1] == "" {
+		return "", ""
+	}
+	for _, field := range fields {
+		if strings.ContainsAny(field, `/\.`) {
+			return "", ""
+		}
+	}
+	return fields[0], fields[1]
+}
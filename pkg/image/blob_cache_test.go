@@ -0,0 +1,105 @@
+package image
+
+import (
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fetchCountingLayer is a v1.Layer that counts how many times the layer content is fetched.
+type fetchCountingLayer struct {
+	v1.Layer
+	fetches int32
+}
+
+func (l *fetchCountingLayer) Uncompressed() (io.ReadCloser, error) {
+	atomic.AddInt32(&l.fetches, 1)
+	return l.Layer.Uncompressed()
+}
+
+func (l *fetchCountingLayer) Compressed() (io.ReadCloser, error) {
+	atomic.AddInt32(&l.fetches, 1)
+	return l.Layer.Compressed()
+}
+
+func readBlobCacheTestImage(t *testing.T, layer v1.Layer, options ...ReadOption) *Image {
+	t.Helper()
+	v1Image, err := mutate.AppendLayers(empty.Image, layer)
+	require.NoError(t, err)
+	img := NewImage(v1Image, t.TempDir())
+	require.NoError(t, img.Read(options...))
+	t.Cleanup(func() { _ = img.Cleanup() })
+	return img
+}
+
+func TestImage_Read_BlobCache(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "blobs")
+	shared := newTestTarLayer(t, testTarEntry{name: "etc/shared", contents: "shared"})
+
+	first := readBlobCacheTestImage(t, &fetchCountingLayer{Layer: shared}, WithBlobCache(dir))
+	digest := first.Layers[0].Metadata.Digest
+	blob, err := blobCachePath(dir, digest)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "sha256", digest[len("sha256:"):]), blob)
+	assert.FileExists(t, blob)
+
+	// the persisted layer tar outlives the image
+	require.NoError(t, first.Cleanup())
+	assert.FileExists(t, blob)
+
+	// a later read (e.g. another run) of an image sharing the layer does not fetch the layer content again
+	reused := &fetchCountingLayer{Layer: shared}
+	second := readBlobCacheTestImage(t, reused, WithBlobCache(dir))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&reused.fetches))
+	contents, err := second.FileContentsFromSquash("/etc/shared")
+	require.NoError(t, err)
+	b, err := ioutil.ReadAll(contents)
+	require.NoError(t, err)
+	assert.Equal(t, "shared", string(b))
+	require.NoError(t, second.Cleanup())
+
+	// corrupted layer tars are detected and fetched again
+	require.NoError(t, ioutil.WriteFile(blob, []byte("corrupted"), 0600))
+	refetched := &fetchCountingLayer{Layer: shared}
+	third := readBlobCacheTestImage(t, refetched, WithBlobCache(dir))
+	assert.Greater(t, atomic.LoadInt32(&refetched.fetches), int32(0))
+	var kinds []WarningKind
+	for _, w := range third.Warnings() {
+		kinds = append(kinds, w.Kind)
+	}
+	assert.Contains(t, kinds, WarningInvalidCache)
+	contents, err = third.FileContentsFromSquash("/etc/shared")
+	require.NoError(t, err)
+	b, err = ioutil.ReadAll(contents)
+	require.NoError(t, err)
+	assert.Equal(t, "shared", string(b))
+}
+
+func Test_splitBlobDigest(t *testing.T) {
+	tests := []struct {
+		digest        string
+		wantAlgorithm string
+		wantHex       string
+	}{
+		{digest: "sha256:abc", wantAlgorithm: "sha256", wantHex: "abc"},
+		{digest: "sha256"},
+		{digest: "sha256:"},
+		{digest: "sha256:../../etc/passwd"},
+		{digest: "../sha256:abc"},
+	}
+	for _, test := range tests {
+		t.Run(test.digest, func(t *testing.T) {
+			algorithm, hex := splitBlobDigest(test.digest)
+			assert.Equal(t, test.wantAlgorithm, algorithm)
+			assert.Equal(t, test.wantHex, hex)
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package image
+
+import (
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree/filenode"
+)
+
+// CaseCollision is a set of paths within the squashed image filesystem that collide under case-insensitive comparison,
+// of which only one can exist when the image is extracted onto a case-insensitive filesystem (e.g. the default
+// filesystems of macOS and Windows).
+type CaseCollision struct {
+	// Paths are the colliding paths (sorted)
+	Paths []file.Path
+	// Layers are the indexes of the layers that provide each path, in the same order as Paths (-1 for directories that
+	// are only implied by the paths below them)
+	Layers []int
+}
+
+// CaseCollisions reports every set of paths within the squash tree that collide under case-insensitive comparison
+// (e.g. "/etc/Foo" and "/etc/foo"), along with the layer each path comes from. Use file.UntarOptions.CaseCollisions to
+// decide how colliding paths are written when extracting.
+func (i *Image) CaseCollisions() []CaseCollision {
+	tree := i.SquashedTree()
+
+	var collisions []CaseCollision
+	for _, paths := range tree.CaseCollisions() {
+		collision := CaseCollision{Paths: paths}
+		for _, p := range paths {
+			layer := -1
+			if n, ok := tree.Reader().Node(filenode.IDByPath(p)).(*filenode.FileNode); ok && n != nil && n.Reference != nil {
+				if entry, err := i.FileCatalog.Get(*n.Reference); err == nil && entry.Layer != nil {
+					layer = int(entry.Layer.Metadata.Index)
+				}
+			}
+			collision.Layers = append(collision.Layers, layer)
+		}
+		collisions = append(collisions, collision)
+	}
+	return collisions
+}
@@ -0,0 +1,32 @@
+package image
+
+import (
+	"archive/tar"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImage_CaseCollisions(t *testing.T) {
+	img := newTestImageFromLayers(t, []v1.Layer{
+		newTestTarLayer(t,
+			testTarEntry{name: "etc/", typeflag: tar.TypeDir},
+			testTarEntry{name: "etc/Makefile", contents: "lower"},
+			testTarEntry{name: "etc/readme"},
+		),
+		newTestTarLayer(t,
+			testTarEntry{name: "etc/", typeflag: tar.TypeDir},
+			testTarEntry{name: "etc/makefile", contents: "upper"},
+			testTarEntry{name: "etc/README", linkname: "readme", typeflag: tar.TypeSymlink},
+		),
+	})
+
+	assert.Equal(t, []CaseCollision{
+		{Paths: []file.Path{"/etc/Makefile", "/etc/makefile"}, Layers: []int{0, 1}},
+		{Paths: []file.Path{"/etc/README", "/etc/readme"}, Layers: []int{1, 0}},
+	}, img.CaseCollisions())
+
+	assert.Empty(t, newTestImageFromLayers(t, []v1.Layer{newTestTarLayer(t, testTarEntry{name: "etc/hosts"})}).CaseCollisions())
+}
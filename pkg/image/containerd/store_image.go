@@ -0,0 +1,78 @@
+package containerd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// storeImage is an image with the manifest, config, and layers read from a content store.
+type storeImage struct {
+	store       blobStore
+	rawManifest []byte
+	manifest    *v1.Manifest
+}
+
+func newStoreImage(store blobStore, rawManifest []byte) (v1.Image, error) {
+	manifest, err := v1.ParseManifest(bytes.NewReader(rawManifest))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse image manifest: %w", err)
+	}
+	return partial.CompressedToImage(&storeImage{
+		store:       store,
+		rawManifest: rawManifest,
+		manifest:    manifest,
+	})
+}
+
+func (i *storeImage) RawConfigFile() ([]byte, error) {
+	return i.store.bytes(i.manifest.Config.Digest)
+}
+
+func (i *storeImage) MediaType() (types.MediaType, error) {
+	if i.manifest.MediaType != "" {
+		return i.manifest.MediaType, nil
+	}
+	return types.OCIManifestSchema1, nil
+}
+
+func (i *storeImage) RawManifest() ([]byte, error) {
+	return i.rawManifest, nil
+}
+
+func (i *storeImage) LayerByDigest(h v1.Hash) (partial.CompressedLayer, error) {
+	for _, desc := range i.manifest.Layers {
+		if desc.Digest == h {
+			return &storeLayer{store: i.store, desc: desc}, nil
+		}
+	}
+	return nil, fmt.Errorf("no layer with digest=%q within image manifest", h)
+}
+
+// storeLayer is a layer blob within a content store. Note: the blob may be absent (e.g. garbage collected or never
+// fetched), in which case reading the layer fails with os.ErrNotExist.
+type storeLayer struct {
+	store blobStore
+	desc  v1.Descriptor
+}
+
+func (l *storeLayer) Digest() (v1.Hash, error) {
+	return l.desc.Digest, nil
+}
+
+func (l *storeLayer) Compressed() (io.ReadCloser, error) {
+	return os.Open(l.store.path(l.desc.Digest))
+}
+
+func (l *storeLayer) Size() (int64, error) {
+	return l.desc.Size, nil
+}
+
+func (l *storeLayer) MediaType() (types.MediaType, error) {
+	return l.desc.MediaType, nil
+}
@@ -0,0 +1,268 @@
+package containerd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/anchore/stereoscope/internal/log"
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+)
+
+const (
+	// DefaultStoreRoot is the default containerd root directory (see the "root" setting of the containerd config).
+	DefaultStoreRoot = "/var/lib/containerd"
+	// DefaultNamespace is the containerd namespace used by the containerd CLIs ("moby" is used by docker with the
+	// containerd image store and "k8s.io" by the kubernetes CRI plugin).
+	DefaultNamespace = "default"
+
+	// metadataDB is the bolt database (relative to the root) describing all images within each namespace
+	metadataDB = "io.containerd.metadata.v1.bolt/meta.db"
+	// contentStore is the directory (relative to the root) with all content blobs (laid out like an OCI layout)
+	contentStore = "io.containerd.content.v1.content"
+)
+
+// StoreImageProvider is an image.Provider for an image within the on-disk content store of containerd, read directly
+// from the metadata database and content blobs without a running containerd. This is most useful for forensic analysis
+// of stopped hosts or offline disk images (e.g. a kubernetes node volume snapshot).
+type StoreImageProvider struct {
+	imageStr  string
+	root      string
+	namespace string
+	tmpDirGen *file.TempDirGenerator
+	platform  *image.Platform
+}
+
+// NewProviderFromStore creates a new provider instance for the given image (a reference, such as "nginx:latest", or
+// the digest of the image manifest or index) within the given namespace of the containerd root at the given path
+// (DefaultStoreRoot and DefaultNamespace when empty). If the image is a multi-platform index then the image for the
+// given platform (or the host platform) is selected from the images available within the content store.
+func NewProviderFromStore(imgStr, root, namespace string, tmpDirGen *file.TempDirGenerator, platform *image.Platform) *StoreImageProvider {
+	if root == "" {
+		root = DefaultStoreRoot
+	}
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+	return &StoreImageProvider{
+		imageStr:  imgStr,
+		root:      root,
+		namespace: namespace,
+		tmpDirGen: tmpDirGen,
+		platform:  platform,
+	}
+}
+
+// Provide an image object that represents the image within the configured containerd content store.
+func (p *StoreImageProvider) Provide(_ context.Context, userMetadata ...image.AdditionalMetadata) (*image.Image, error) {
+	store := blobStore(filepath.Join(p.root, contentStore))
+
+	var metadata []image.AdditionalMetadata
+	target, err := v1.NewHash(p.imageStr)
+	if err != nil {
+		// not a digest, so the image is resolved by name from the metadata database
+		ref, err := name.ParseReference(p.imageStr, name.WeakValidation)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse image reference=%q: %w", p.imageStr, err)
+		}
+		imageName, digest, err := p.resolveImage(ref)
+		if err != nil {
+			return nil, err
+		}
+		target = digest
+		if _, ok := ref.(name.Tag); ok {
+			metadata = append(metadata, image.WithTags(imageName))
+		}
+		metadata = append(metadata, image.WithRepoDigests(fmt.Sprintf("%s@%s", ref.Context().Name(), digest)))
+	}
+	log.Debugf("resolved image=%q to digest=%q within containerd root=%q namespace=%q", p.imageStr, target, p.root, p.namespace)
+
+	manifestDigest, rawManifest, err := p.selectManifest(store, target)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := newStoreImage(store, rawManifest)
+	if err != nil {
+		return nil, fmt.Errorf("unable to provide image from containerd content store: %w", err)
+	}
+
+	metadata = append(metadata,
+		image.WithManifest(rawManifest),
+		image.WithManifestDigest(manifestDigest.String()),
+	)
+
+	// apply user-supplied metadata last to override any default behavior
+	metadata = append(metadata, userMetadata...)
+
+	contentTempDir, err := p.tmpDirGen.NewDirectory("containerd-store-image")
+	if err != nil {
+		return nil, err
+	}
+
+	return image.NewImage(img, contentTempDir, metadata...), nil
+}
+
+// resolveImage finds the image with the given reference within the metadata database (compared after normalization,
+// so "nginx" matches "docker.io/library/nginx:latest"), returning the name and target digest of the image.
+func (p *StoreImageProvider) resolveImage(ref name.Reference) (string, v1.Hash, error) {
+	dbPath := filepath.Join(p.root, metadataDB)
+	if _, err := os.Stat(dbPath); err != nil {
+		return "", v1.Hash{}, fmt.Errorf("unable to find containerd metadata database within root=%q: %w", p.root, err)
+	}
+	db, err := bolt.Open(dbPath, 0400, &bolt.Options{ReadOnly: true, Timeout: 5 * time.Second})
+	if err != nil {
+		return "", v1.Hash{}, fmt.Errorf("unable to open containerd metadata database=%q: %w", dbPath, err)
+	}
+	defer db.Close()
+
+	var imageName, digest string
+	err = db.View(func(tx *bolt.Tx) error {
+		images := nestedBucket(tx, "v1", p.namespace, "images")
+		if images == nil {
+			return fmt.Errorf("no images within containerd namespace=%q", p.namespace)
+		}
+		return images.ForEach(func(k, _ []byte) error {
+			candidate, err := name.ParseReference(string(k), name.WeakValidation)
+			if err != nil || candidate.Name() != ref.Name() {
+				return nil
+			}
+			target := images.Bucket(k).Bucket([]byte("target"))
+			if target == nil {
+				return nil
+			}
+			imageName, digest = string(k), string(target.Get([]byte("digest")))
+			return nil
+		})
+	})
+	if err != nil {
+		return "", v1.Hash{}, err
+	}
+	if imageName == "" {
+		return "", v1.Hash{}, fmt.Errorf("unable to find image=%q within containerd namespace=%q", p.imageStr, p.namespace)
+	}
+	hash, err := v1.NewHash(digest)
+	if err != nil {
+		return "", v1.Hash{}, fmt.Errorf("invalid target digest for image=%q: %w", imageName, err)
+	}
+	return imageName, hash, nil
+}
+
+// selectManifest returns the image manifest for the given target, which is either an image manifest or an index (in
+// which case the manifest for the requested platform is selected from the manifests available within the store).
+func (p *StoreImageProvider) selectManifest(store blobStore, target v1.Hash) (v1.Hash, []byte, error) {
+	raw, err := store.bytes(target)
+	if err != nil {
+		return v1.Hash{}, nil, fmt.Errorf("unable to read image=%q from containerd content store: %w", p.imageStr, err)
+	}
+	mediaType, err := contentMediaType(raw)
+	if err != nil {
+		return v1.Hash{}, nil, err
+	}
+	if !mediaType.IsIndex() {
+		return target, raw, nil
+	}
+
+	index, err := v1.ParseIndexManifest(bytes.NewReader(raw))
+	if err != nil {
+		return v1.Hash{}, nil, fmt.Errorf("unable to parse image index=%q: %w", target, err)
+	}
+	platform := p.platform
+	if platform == nil {
+		host := image.HostPlatform()
+		platform = &host
+	}
+
+	var available []v1.Descriptor
+	for _, desc := range index.Manifests {
+		if !desc.MediaType.IsImage() || !store.exists(desc.Digest) {
+			// only the content for some platforms is typically pulled
+			continue
+		}
+		available = append(available, desc)
+		if platformMatches(desc.Platform, platform) {
+			raw, err := store.bytes(desc.Digest)
+			return desc.Digest, raw, err
+		}
+	}
+	if p.platform == nil && len(available) == 1 {
+		// the only image within the store is used, regardless of the host platform
+		raw, err := store.bytes(available[0].Digest)
+		return available[0].Digest, raw, err
+	}
+	return v1.Hash{}, nil, fmt.Errorf("no image found within containerd content store for platform=%q (found %d of %d images in index=%q)", platform.String(), len(available), len(index.Manifests), target)
+}
+
+// platformMatches indicates if the platform described on an index descriptor satisfies the requested platform. The
+// variant is only considered when one is requested.
+func platformMatches(candidate *v1.Platform, requested *image.Platform) bool {
+	if candidate == nil {
+		return false
+	}
+	if candidate.OS != requested.OS || candidate.Architecture != requested.Architecture {
+		return false
+	}
+	return requested.Variant == "" || candidate.Variant == requested.Variant
+}
+
+// contentMediaType returns the media type of the given manifest or index (which may be absent for OCI content, in
+// which case the presence of manifests distinguishes an index).
+func contentMediaType(raw []byte) (types.MediaType, error) {
+	var content struct {
+		MediaType types.MediaType   `json:"mediaType"`
+		Manifests []json.RawMessage `json:"manifests"`
+	}
+	if err := json.Unmarshal(raw, &content); err != nil {
+		return "", fmt.Errorf("unable to parse image manifest: %w", err)
+	}
+	switch {
+	case content.MediaType != "":
+		return content.MediaType, nil
+	case content.Manifests != nil:
+		return types.OCIImageIndex, nil
+	}
+	return types.OCIManifestSchema1, nil
+}
+
+func nestedBucket(tx *bolt.Tx, keys ...string) *bolt.Bucket {
+	bucket := tx.Bucket([]byte(keys[0]))
+	for _, key := range keys[1:] {
+		if bucket == nil {
+			return nil
+		}
+		bucket = bucket.Bucket([]byte(key))
+	}
+	return bucket
+}
+
+// blobStore is the directory with all content blobs, by digest (e.g. "blobs/sha256/<hex>").
+type blobStore string
+
+func (s blobStore) path(h v1.Hash) string {
+	return filepath.Join(string(s), "blobs", h.Algorithm, h.Hex)
+}
+
+func (s blobStore) exists(h v1.Hash) bool {
+	_, err := os.Stat(s.path(h))
+	return err == nil
+}
+
+func (s blobStore) bytes(h v1.Hash) ([]byte, error) {
+	contents, err := ioutil.ReadFile(s.path(h))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("blob=%q is not within the content store: %w", h, err)
+	}
+	return contents, err
+}
@@ -0,0 +1,168 @@
+package containerd
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+)
+
+func writeTestBlob(t *testing.T, root string, digest v1.Hash, contents []byte) {
+	t.Helper()
+	dir := filepath.Join(root, contentStore, "blobs", digest.Algorithm)
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, digest.Hex), contents, 0644))
+}
+
+// writeTestImage writes the manifest, config, and layers of the given image as blobs within the content store.
+func writeTestImage(t *testing.T, root string, img v1.Image) {
+	t.Helper()
+	digest, err := img.Digest()
+	require.NoError(t, err)
+	rawManifest, err := img.RawManifest()
+	require.NoError(t, err)
+	writeTestBlob(t, root, digest, rawManifest)
+
+	configName, err := img.ConfigName()
+	require.NoError(t, err)
+	rawConfig, err := img.RawConfigFile()
+	require.NoError(t, err)
+	writeTestBlob(t, root, configName, rawConfig)
+
+	layers, err := img.Layers()
+	require.NoError(t, err)
+	for _, layer := range layers {
+		layerDigest, err := layer.Digest()
+		require.NoError(t, err)
+		reader, err := layer.Compressed()
+		require.NoError(t, err)
+		contents, err := ioutil.ReadAll(reader)
+		require.NoError(t, err)
+		require.NoError(t, reader.Close())
+		writeTestBlob(t, root, layerDigest, contents)
+	}
+}
+
+// writeTestMetadata records the given image names (and their target digests) within the metadata database.
+func writeTestMetadata(t *testing.T, root, namespace string, images map[string]v1.Hash) {
+	t.Helper()
+	dbPath := filepath.Join(root, metadataDB)
+	require.NoError(t, os.MkdirAll(filepath.Dir(dbPath), 0755))
+	db, err := bolt.Open(dbPath, 0600, nil)
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte("v1"))
+		if err != nil {
+			return err
+		}
+		for _, key := range []string{namespace, "images"} {
+			if bucket, err = bucket.CreateBucketIfNotExists([]byte(key)); err != nil {
+				return err
+			}
+		}
+		for imageName, digest := range images {
+			imageBucket, err := bucket.CreateBucket([]byte(imageName))
+			if err != nil {
+				return err
+			}
+			target, err := imageBucket.CreateBucket([]byte("target"))
+			if err != nil {
+				return err
+			}
+			if err := target.Put([]byte("digest"), []byte(digest.String())); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
+
+func TestStoreImageProvider_Provide(t *testing.T) {
+	root := t.TempDir()
+
+	img, err := random.Image(256, 2)
+	require.NoError(t, err)
+	writeTestImage(t, root, img)
+	imgDigest, err := img.Digest()
+	require.NoError(t, err)
+
+	// only the content for one platform of the index is within the store
+	other, err := random.Image(256, 1)
+	require.NoError(t, err)
+	index := mutate.AppendManifests(empty.Index,
+		mutate.IndexAddendum{Add: other, Descriptor: v1.Descriptor{MediaType: types.DockerManifestSchema2, Platform: &v1.Platform{OS: "linux", Architecture: "s390x"}}},
+		mutate.IndexAddendum{Add: img, Descriptor: v1.Descriptor{MediaType: types.DockerManifestSchema2, Platform: &v1.Platform{OS: "linux", Architecture: "riscv64"}}},
+	)
+	indexDigest, err := index.Digest()
+	require.NoError(t, err)
+	rawIndex, err := index.RawManifest()
+	require.NoError(t, err)
+	writeTestBlob(t, root, indexDigest, rawIndex)
+
+	writeTestMetadata(t, root, "k8s.io", map[string]v1.Hash{
+		"docker.io/library/app:latest":     imgDigest,
+		"registry.example.com/app:indexed": indexDigest,
+	})
+
+	expectedID, err := img.ConfigName()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		imageStr string
+		platform *image.Platform
+	}{
+		{name: "normalized name", imageStr: "app"},
+		{name: "manifest digest", imageStr: imgDigest.String()},
+		{name: "index with a single available image", imageStr: "registry.example.com/app:indexed"},
+		{name: "index with a platform", imageStr: "registry.example.com/app:indexed", platform: &image.Platform{OS: "linux", Architecture: "riscv64"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			generator := file.NewTempDirGenerator("stereoscope-containerd-store-test")
+			defer generator.Cleanup()
+
+			provided, err := NewProviderFromStore(test.imageStr, root, "k8s.io", generator, test.platform).Provide(context.Background())
+			require.NoError(t, err)
+			require.NoError(t, provided.Read())
+
+			assert.Equal(t, expectedID.String(), provided.Metadata.ID)
+			assert.Equal(t, imgDigest.String(), provided.Metadata.ManifestDigest)
+			assert.Len(t, provided.Layers, 2)
+		})
+	}
+
+	t.Run("no image for the requested platform", func(t *testing.T) {
+		generator := file.NewTempDirGenerator("stereoscope-containerd-store-test")
+		defer generator.Cleanup()
+
+		platform := &image.Platform{OS: "linux", Architecture: "s390x"}
+		_, err := NewProviderFromStore("registry.example.com/app:indexed", root, "k8s.io", generator, platform).Provide(context.Background())
+		assert.Error(t, err)
+	})
+
+	t.Run("unknown image", func(t *testing.T) {
+		generator := file.NewTempDirGenerator("stereoscope-containerd-store-test")
+		defer generator.Cleanup()
+
+		_, err := NewProviderFromStore("app:other", root, "k8s.io", generator, nil).Provide(context.Background())
+		assert.Error(t, err)
+		_, err = NewProviderFromStore("app", root, "", generator, nil).Provide(context.Background())
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,248 @@
+package containers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+
+	"github.com/anchore/stereoscope/internal/log"
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/anchore/stereoscope/pkg/image/overlay"
+)
+
+// DefaultStorageRoot is the default (rootful) containers-storage root used by CRI-O and Podman (see the "graphroot"
+// setting of storage.conf). Rootless Podman uses "$HOME/.local/share/containers/storage" instead.
+const DefaultStorageRoot = "/var/lib/containers/storage"
+
+// storageDriver is the only storage driver that can be read (images stored by other drivers are not supported).
+const storageDriver = "overlay"
+
+// manifestKey is the name of the big data item holding the image manifest.
+const manifestKey = "manifest"
+
+// StorageImageProvider is an image.Provider for an image within the on-disk storage of the containers/storage library
+// (used by CRI-O and Podman), read directly from the image and layer metadata and the overlay layer directories. This
+// allows node-level scanners (e.g. on a kubernetes node running CRI-O) to analyze images already present on the node
+// without pulling them again.
+type StorageImageProvider struct {
+	imageStr  string
+	root      string
+	tmpDirGen *file.TempDirGenerator
+}
+
+// NewProviderFromStorage creates a new provider instance for the given image (a reference, such as "nginx:latest", or a
+// full or unique prefix of an image ID) within the containers-storage root at the given path (DefaultStorageRoot when
+// empty).
+func NewProviderFromStorage(imgStr, root string, tmpDirGen *file.TempDirGenerator) *StorageImageProvider {
+	if root == "" {
+		root = DefaultStorageRoot
+	}
+	return &StorageImageProvider{
+		imageStr:  imgStr,
+		root:      root,
+		tmpDirGen: tmpDirGen,
+	}
+}
+
+// storageImage is an entry of "overlay-images/images.json".
+type storageImage struct {
+	ID string `json:"id"`
+	// Digest is the digest of the image manifest
+	Digest string `json:"digest,omitempty"`
+	// Names are the references (tags and repo digests) of the image
+	Names []string `json:"names,omitempty"`
+	// TopLayer is the ID of the top-most layer of the image
+	TopLayer string `json:"layer,omitempty"`
+}
+
+// storageLayer is an entry of "overlay-layers/layers.json".
+type storageLayer struct {
+	ID     string `json:"id"`
+	Parent string `json:"parent,omitempty"`
+	// DiffDigest is the digest of the uncompressed layer tar (the diff ID)
+	DiffDigest string `json:"diff-digest,omitempty"`
+}
+
+// Provide an image object that represents the image within the configured containers-storage root.
+func (p *StorageImageProvider) Provide(_ context.Context, userMetadata ...image.AdditionalMetadata) (*image.Image, error) {
+	imagesDir := filepath.Join(p.root, storageDriver+"-images")
+	if _, err := os.Stat(imagesDir); err != nil {
+		return nil, fmt.Errorf("unable to find %s image metadata within containers-storage root=%q (only the %s storage driver is supported): %w", storageDriver, p.root, storageDriver, err)
+	}
+
+	var images []storageImage
+	if err := readStorageJSON(filepath.Join(imagesDir, "images.json"), &images); err != nil {
+		return nil, err
+	}
+	img, err := p.resolveImage(images)
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("resolved image=%q to id=%q within containers-storage root=%q", p.imageStr, img.ID, p.root)
+
+	// the image ID is the digest of the image config, which is stored as a big data item keyed by the config digest
+	rawConfig, err := ioutil.ReadFile(filepath.Join(imagesDir, img.ID, bigDataFilename("sha256:"+img.ID)))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read image config for id=%q: %w", img.ID, err)
+	}
+
+	layerDirs, err := p.layerDirs(img.TopLayer)
+	if err != nil {
+		return nil, err
+	}
+
+	v1Image, err := overlay.NewImage(rawConfig, layerDirs)
+	if err != nil {
+		return nil, fmt.Errorf("unable to provide image from containers-storage root: %w", err)
+	}
+
+	tags, repoDigests := img.references()
+	metadata := []image.AdditionalMetadata{
+		image.WithTags(tags...),
+		image.WithRepoDigests(repoDigests...),
+	}
+	if rawManifest, err := ioutil.ReadFile(filepath.Join(imagesDir, img.ID, bigDataFilename(manifestKey))); err == nil {
+		metadata = append(metadata, image.WithManifest(rawManifest))
+		if img.Digest != "" {
+			metadata = append(metadata, image.WithManifestDigest(img.Digest))
+		}
+	}
+
+	// apply user-supplied metadata last to override any default behavior
+	metadata = append(metadata, userMetadata...)
+
+	contentTempDir, err := p.tmpDirGen.NewDirectory("containers-storage-image")
+	if err != nil {
+		return nil, err
+	}
+
+	return image.NewImage(v1Image, contentTempDir, metadata...), nil
+}
+
+// resolveImage finds the configured image, either by reference (compared after normalization, so "nginx" matches
+// "docker.io/library/nginx:latest") or by a full or unique prefix of the image ID.
+func (p *StorageImageProvider) resolveImage(images []storageImage) (*storageImage, error) {
+	if ref, err := name.ParseReference(p.imageStr, name.WeakValidation); err == nil {
+		for idx, img := range images {
+			for _, candidate := range img.Names {
+				candidateRef, err := name.ParseReference(candidate, name.WeakValidation)
+				if err == nil && candidateRef.Name() == ref.Name() {
+					return &images[idx], nil
+				}
+			}
+		}
+	}
+
+	prefix := strings.TrimPrefix(p.imageStr, "sha256:")
+	var matches []*storageImage
+	for idx, img := range images {
+		if prefix != "" && strings.HasPrefix(img.ID, prefix) {
+			matches = append(matches, &images[idx])
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("unable to find image=%q within containers-storage root=%q", p.imageStr, p.root)
+	case 1:
+		return matches[0], nil
+	}
+	return nil, fmt.Errorf("image ID prefix=%q is ambiguous within containers-storage root=%q (matches %d images)", p.imageStr, p.root, len(matches))
+}
+
+// layerDirs returns the overlay layer directory of each layer of the image with the given top layer (lowest layer
+// first), following the parent of each layer within the layer metadata.
+func (p *StorageImageProvider) layerDirs(topLayer string) ([]string, error) {
+	var layers []storageLayer
+	if err := readStorageJSON(filepath.Join(p.root, storageDriver+"-layers", "layers.json"), &layers); err != nil {
+		return nil, err
+	}
+	byID := make(map[string]storageLayer, len(layers))
+	for _, layer := range layers {
+		byID[layer.ID] = layer
+	}
+
+	var dirs []string
+	for id := topLayer; id != ""; {
+		layer, ok := byID[id]
+		if !ok {
+			return nil, fmt.Errorf("unable to find layer=%q within containers-storage root=%q", id, p.root)
+		}
+		if len(dirs) > len(layers) {
+			return nil, fmt.Errorf("layer=%q has a cyclic parent chain", topLayer)
+		}
+		dir := filepath.Join(p.root, storageDriver, layer.ID, "diff")
+		if _, err := os.Stat(dir); err != nil {
+			return nil, fmt.Errorf("unable to find layer directory for layer=%q: %w", layer.ID, err)
+		}
+		dirs = append([]string{dir}, dirs...)
+		id = layer.Parent
+	}
+	return dirs, nil
+}
+
+// references returns all tags and repo digests of the image (sorted). Repo digests are recorded for every repository
+// of the image, since the manifest digest is the same within each repository.
+func (i storageImage) references() ([]string, []string) {
+	var tags, repoDigests []string
+	seen := make(map[string]struct{})
+	addRepoDigest := func(repoDigest string) {
+		if _, ok := seen[repoDigest]; ok {
+			return
+		}
+		seen[repoDigest] = struct{}{}
+		repoDigests = append(repoDigests, repoDigest)
+	}
+	for _, n := range i.Names {
+		ref, err := name.ParseReference(n, name.WeakValidation)
+		if err != nil {
+			continue
+		}
+		if _, ok := ref.(name.Digest); ok {
+			addRepoDigest(n)
+			continue
+		}
+		tags = append(tags, n)
+		if i.Digest != "" {
+			addRepoDigest(fmt.Sprintf("%s@%s", ref.Context().Name(), i.Digest))
+		}
+	}
+	sort.Strings(tags)
+	sort.Strings(repoDigests)
+	return tags, repoDigests
+}
+
+func readStorageJSON(path string, v interface{}) error {
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		// nothing has been stored yet
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read containers-storage metadata: %w", err)
+	}
+	if err := json.Unmarshal(contents, v); err != nil {
+		return fmt.Errorf("unable to parse containers-storage metadata=%q: %w", path, err)
+	}
+	return nil
+}
+
+// bigDataFilename returns the name of the file holding the big data item (e.g. the manifest or config) with the given
+// key within an image directory: keys made only of lowercase letters, digits, and periods are used as-is, all other
+// keys are base64 encoded (with a "=" prefix).
+func bigDataFilename(key string) string {
+	for _, ch := range key {
+		if ch != '.' && !(ch >= '0' && ch <= '9') && !(ch >= 'a' && ch <= 'z') {
+			return "=" + base64.StdEncoding.EncodeToString([]byte(key))
+		}
+	}
+	return key
+}
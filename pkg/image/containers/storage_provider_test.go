@@ -0,0 +1,145 @@
+package containers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+)
+
+// newTestStorageRoot lays out the given image within a new containers-storage root (as the overlay storage driver
+// would), with the given names.
+func newTestStorageRoot(t *testing.T, img v1.Image, names ...string) (string, v1.Hash) {
+	t.Helper()
+	root := t.TempDir()
+
+	id, err := img.ConfigName()
+	require.NoError(t, err)
+	digest, err := img.Digest()
+	require.NoError(t, err)
+	rawConfig, err := img.RawConfigFile()
+	require.NoError(t, err)
+	rawManifest, err := img.RawManifest()
+	require.NoError(t, err)
+
+	imageDir := filepath.Join(root, "overlay-images", id.Hex)
+	require.NoError(t, os.MkdirAll(imageDir, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(imageDir, bigDataFilename(id.String())), rawConfig, 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(imageDir, bigDataFilename(manifestKey)), rawManifest, 0644))
+
+	layers, err := img.Layers()
+	require.NoError(t, err)
+	var storageLayers []storageLayer
+	var parent string
+	for idx, layer := range layers {
+		diffID, err := layer.DiffID()
+		require.NoError(t, err)
+		layerID := fmt.Sprintf("layer%d", idx)
+		storageLayers = append(storageLayers, storageLayer{ID: layerID, Parent: parent, DiffDigest: diffID.String()})
+		parent = layerID
+
+		diffDir := filepath.Join(root, storageDriver, layerID, "diff")
+		require.NoError(t, os.MkdirAll(diffDir, 0755))
+		reader, err := layer.Uncompressed()
+		require.NoError(t, err)
+		require.NoError(t, file.UntarToDirectory(reader, diffDir))
+		require.NoError(t, reader.Close())
+	}
+
+	writeJSON := func(path string, v interface{}) {
+		contents, err := json.Marshal(v)
+		require.NoError(t, err)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, contents, 0644))
+	}
+	writeJSON(filepath.Join(root, "overlay-layers", "layers.json"), storageLayers)
+	writeJSON(filepath.Join(root, "overlay-images", "images.json"), []storageImage{
+		{ID: id.Hex, Digest: digest.String(), Names: names, TopLayer: parent},
+	})
+	return root, id
+}
+
+func TestStorageImageProvider_Provide(t *testing.T) {
+	img, err := random.Image(256, 3)
+	require.NoError(t, err)
+	root, id := newTestStorageRoot(t, img, "quay.io/example/repo:v1", "docker.io/library/nginx:latest")
+	digest, err := img.Digest()
+	require.NoError(t, err)
+
+	expected := image.NewImage(img, t.TempDir())
+	require.NoError(t, expected.Read())
+
+	tests := []struct {
+		name     string
+		imageStr string
+	}{
+		{name: "tag", imageStr: "quay.io/example/repo:v1"},
+		{name: "normalized docker hub reference", imageStr: "nginx"},
+		{name: "full ID", imageStr: id.String()},
+		{name: "ID prefix", imageStr: id.Hex[:12]},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			generator := file.NewTempDirGenerator("stereoscope-containers-storage-test")
+			defer generator.Cleanup()
+
+			provided, err := NewProviderFromStorage(test.imageStr, root, generator).Provide(context.Background())
+			require.NoError(t, err)
+			require.NoError(t, provided.Read())
+
+			assert.Equal(t, id.String(), provided.Metadata.ID)
+			assert.Equal(t, digest.String(), provided.Metadata.ManifestDigest)
+			require.Len(t, provided.Layers, 3)
+			for idx, layer := range provided.Layers {
+				assert.Equal(t, expected.Layers[idx].Metadata.Digest, layer.Metadata.Digest)
+			}
+			assert.ElementsMatch(t, expected.SquashedTree().AllRealPaths(), provided.SquashedTree().AllRealPaths())
+			assert.Len(t, provided.Metadata.Tags, 2)
+			assert.ElementsMatch(t, []string{
+				"index.docker.io/library/nginx@" + digest.String(),
+				"quay.io/example/repo@" + digest.String(),
+			}, provided.Metadata.RepoDigests)
+		})
+	}
+}
+
+func TestStorageImageProvider_Provide_Errors(t *testing.T) {
+	img, err := random.Image(64, 1)
+	require.NoError(t, err)
+	root, _ := newTestStorageRoot(t, img, "quay.io/example/repo:v1")
+
+	generator := file.NewTempDirGenerator("stereoscope-containers-storage-test")
+	defer generator.Cleanup()
+
+	tests := []struct {
+		name     string
+		imageStr string
+		root     string
+	}{
+		{name: "unknown image", imageStr: "quay.io/example/repo:v2", root: root},
+		{name: "unknown image ID", imageStr: "sha256:0000000000000000000000000000000000000000000000000000000000000000", root: root},
+		{name: "no overlay metadata", imageStr: "quay.io/example/repo:v1", root: t.TempDir()},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewProviderFromStorage(test.imageStr, test.root, generator).Provide(context.Background())
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestBigDataFilename(t *testing.T) {
+	assert.Equal(t, "manifest", bigDataFilename("manifest"))
+	assert.Equal(t, "=c2hhMjU2OmFiYw==", bigDataFilename("sha256:abc"))
+}
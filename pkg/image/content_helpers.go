@@ -1,6 +1,7 @@
 package image
 
 import (
+	"errors"
 	"fmt"
 	"io"
 
@@ -9,23 +10,63 @@ import (
 )
 
 // fetchFileContentsByPath is a common helper function for resolving the file contents for a path from the file
-// catalog relative to the given tree.
+// catalog relative to the given tree. All errors are a *FileContentsError for the given path.
 func fetchFileContentsByPath(ft *filetree.FileTree, fileCatalog *FileCatalog, path file.Path) (io.ReadCloser, error) {
-	exists, fileReference, err := ft.File(path, filetree.FollowBasenameLinks)
+	// hardlinks are bound to the content of the file they were linked to (which may no longer exist at the link path),
+	// so only symlinks are resolved by path
+	exists, fileReference, err := ft.File(path, filetree.FollowBasenameLinks, filetree.DoNotFollowHardLinks)
 	if err != nil {
-		return nil, err
+		return nil, newFileContentsError(path, err)
+	}
+	if fileReference != nil {
+		if entry, err := fileCatalog.Get(*fileReference); err == nil && file.Type(entry.Metadata.TypeFlag) == file.TypeHardLink && entry.HardlinkTarget == nil {
+			// the hardlink could not be bound to any content, fallback to resolving the link path
+			exists, fileReference, err = ft.File(path, filetree.FollowBasenameLinks)
+			if err != nil {
+				return nil, newFileContentsError(path, err)
+			}
+		}
 	}
-	if !exists && fileReference == nil {
-		return nil, fmt.Errorf("could not find file path in Tree: %s", path)
+	if fileReference == nil {
+		switch {
+		case exists:
+			// parent directories that are implied by the layer tars have no entry of their own
+			return nil, newFileContentsError(path, ErrIsDirectory)
+		case isLinkPath(ft, fileCatalog, path):
+			return nil, newFileContentsError(path, ErrDeadLink)
+		}
+		return nil, newFileContentsError(path, ErrFileNotFound)
 	}
 
 	reader, err := fileCatalog.FileContents(*fileReference)
 	if err != nil {
-		return nil, err
+		var contentsErr *FileContentsError
+		if errors.As(err, &contentsErr) {
+			// report the requested path instead of the path the link resolved to
+			return nil, newFileContentsError(path, contentsErr.Err)
+		}
+		return nil, newFileContentsError(path, err)
 	}
 	return reader, nil
 }
 
+// isLinkPath indicates if there is a link (that may not resolve) at the given path within the tree.
+func isLinkPath(ft *filetree.FileTree, fileCatalog *FileCatalog, path file.Path) bool {
+	exists, ref, err := ft.File(path)
+	if err != nil || !exists || ref == nil {
+		return false
+	}
+	entry, err := fileCatalog.Get(*ref)
+	if err != nil {
+		return false
+	}
+	switch file.Type(entry.Metadata.TypeFlag) {
+	case file.TypeSymlink, file.TypeHardLink:
+		return true
+	}
+	return false
+}
+
 // fetchFileContentsByPath is a common helper function for resolving file references for a MIME type from the file
 // catalog relative to the given tree.
 func fetchFilesByMIMEType(ft *filetree.FileTree, fileCatalog *FileCatalog, mType string) ([]file.Reference, error) {
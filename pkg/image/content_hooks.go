@@ -0,0 +1,88 @@
+package image
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+// ContentHook is invoked once for every regular file while the layer contents are indexed, with the layer containing
+// the file, the file metadata (as described by the layer, the MIME type and digests are not yet known), and a reader of
+// the complete file contents. Hooks allow content inspection (e.g. virus or malware scanning) to share the single pass
+// over the layer contents instead of reading every layer again.
+//
+// Each hook receives its own reader, which is fed as the contents are indexed, so a hook must not retain the reader
+// after returning. Any contents not read by the hook are discarded. Hooks may be invoked concurrently for files within
+// different layers (see WithLayerReadConcurrency). Returning an error fails the read of the layer.
+type ContentHook func(layer LayerMetadata, metadata file.Metadata, contents io.Reader) error
+
+// contentHookRun is the set of hooks consuming the contents of a single file.
+type contentHookRun struct {
+	writers []*io.PipeWriter
+	errs    chan error
+	path    string
+}
+
+// startContentHooks starts each of the given hooks with a reader of the contents written to the returned run.
+func startContentHooks(hooks []ContentHook, layer LayerMetadata, metadata file.Metadata) *contentHookRun {
+	run := &contentHookRun{
+		errs: make(chan error, len(hooks)),
+		path: metadata.Path,
+	}
+	for _, hook := range hooks {
+		reader, writer := io.Pipe()
+		run.writers = append(run.writers, writer)
+		go func(hook ContentHook) {
+			err := hook(layer, metadata, reader)
+			// drain the remaining contents so the other hooks (and indexing) are not blocked by this hook
+			_, _ = io.Copy(io.Discard, reader)
+			run.errs <- err
+		}(hook)
+	}
+	return run
+}
+
+// Write feeds the given contents to every hook.
+func (r *contentHookRun) Write(p []byte) (int, error) {
+	for _, writer := range r.writers {
+		if _, err := writer.Write(p); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// finish signals the end of the contents to every hook (or the given error while reading the contents), waiting for
+// all hooks to return. The first error returned by any hook is returned.
+func (r *contentHookRun) finish(readErr error) error {
+	for _, writer := range r.writers {
+		_ = writer.CloseWithError(readErr)
+	}
+	var hookErr error
+	for range r.writers {
+		if err := <-r.errs; err != nil && hookErr == nil {
+			hookErr = err
+		}
+	}
+	if hookErr != nil {
+		return fmt.Errorf("content hook failed for path=%q: %w", r.path, hookErr)
+	}
+	return nil
+}
+
+// runContentHooks invokes the layer content hooks (if any) with the complete contents from the given reader.
+func (l *Layer) runContentHooks(metadata file.Metadata, contents io.Reader) error {
+	if len(l.contentHooks) == 0 {
+		return nil
+	}
+	run := startContentHooks(l.contentHooks, l.Metadata, metadata)
+	_, err := io.Copy(run, contents)
+	if hookErr := run.finish(err); hookErr != nil {
+		return hookErr
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read path=%q: %w", metadata.Path, err)
+	}
+	return nil
+}
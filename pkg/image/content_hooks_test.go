@@ -0,0 +1,132 @@
+package image
+
+import (
+	"archive/tar"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+func TestImage_ContentHooks(t *testing.T) {
+	large := strings.Repeat("x", 100000)
+	v1Image, err := mutate.AppendLayers(empty.Image,
+		newTestTarLayer(t,
+			testTarEntry{name: "etc/", typeflag: tar.TypeDir, mode: 0755},
+			testTarEntry{name: "etc/os-release", contents: "ID=test"},
+			testTarEntry{name: "usr/lib/large", contents: large},
+			testTarEntry{name: "usr/lib/link", linkname: "usr/lib/large", typeflag: tar.TypeLink},
+			testTarEntry{name: "usr/lib/symlink", linkname: "large", typeflag: tar.TypeSymlink},
+		),
+		newTestTarLayer(t,
+			testTarEntry{name: "etc/hostname", contents: "upper"},
+		),
+	)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		options []ReadOption
+	}{
+		{
+			name: "cached layer content",
+		},
+		{
+			name:    "lazy layer content",
+			options: []ReadOption{WithLazyLayerContent()},
+		},
+		{
+			name:    "with file digests",
+			options: []ReadOption{WithFileDigests()},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var lock sync.Mutex
+			contents := make(map[string]string)
+			layers := make(map[string]uint)
+			var prefixes []string
+
+			scanner := func(layer LayerMetadata, metadata file.Metadata, reader io.Reader) error {
+				b, err := ioutil.ReadAll(reader)
+				if err != nil {
+					return err
+				}
+				lock.Lock()
+				defer lock.Unlock()
+				contents[metadata.Path] = string(b)
+				layers[metadata.Path] = layer.Index
+				return nil
+			}
+			// a hook that stops reading early does not affect other hooks
+			sniffer := func(layer LayerMetadata, metadata file.Metadata, reader io.Reader) error {
+				b := make([]byte, 2)
+				if _, err := io.ReadFull(reader, b); err != nil {
+					return err
+				}
+				lock.Lock()
+				defer lock.Unlock()
+				prefixes = append(prefixes, string(b))
+				return nil
+			}
+
+			img := NewImage(v1Image, t.TempDir())
+			require.NoError(t, img.Read(append(test.options, WithContentHooks(scanner, nil), WithContentHooks(sniffer))...))
+
+			assert.Equal(t, map[string]string{
+				"/etc/os-release": "ID=test",
+				"/usr/lib/large":  large,
+				"/etc/hostname":   "upper",
+			}, contents)
+			assert.Equal(t, map[string]uint{
+				"/etc/os-release": 0,
+				"/usr/lib/large":  0,
+				"/etc/hostname":   1,
+			}, layers)
+			assert.ElementsMatch(t, []string{"ID", "xx", "up"}, prefixes)
+
+			// indexing is unaffected by the hooks
+			entry, err := img.FileCatalog.Get(img.Layers[0].Tree.AllFiles(file.TypeReg)[0])
+			require.NoError(t, err)
+			assert.NotEmpty(t, entry.Metadata.MIMEType)
+			reader, err := img.FileContentsFromSquash("/usr/lib/large")
+			require.NoError(t, err)
+			b, err := ioutil.ReadAll(reader)
+			require.NoError(t, err)
+			assert.Equal(t, large, string(b))
+		})
+	}
+}
+
+func TestImage_ContentHooks_Error(t *testing.T) {
+	infected := errors.New("infected")
+	v1Image, err := mutate.AppendLayers(empty.Image, newTestTarLayer(t,
+		testTarEntry{name: "etc/os-release", contents: "ID=test"},
+		testTarEntry{name: "tmp/eicar", contents: "EICAR-STANDARD-ANTIVIRUS-TEST-FILE"},
+	))
+	require.NoError(t, err)
+	img := NewImage(v1Image, t.TempDir())
+
+	err = img.Read(WithContentHooks(func(_ LayerMetadata, metadata file.Metadata, reader io.Reader) error {
+		b, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+		if strings.Contains(string(b), "EICAR") {
+			return infected
+		}
+		return nil
+	}))
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, infected))
+	assert.Contains(t, err.Error(), "/tmp/eicar")
+}
@@ -0,0 +1,96 @@
+package image
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree"
+	"github.com/anchore/stereoscope/pkg/filetree/filenode"
+	"github.com/anchore/stereoscope/pkg/tree"
+)
+
+// ContentTreeDigest returns a Merkle-style digest (e.g. "sha256:abc...") of the effective filesystem of the image (the
+// squash tree). Each directory is digested from the name, type, and digest of every entry within it, regular files
+// by their contents, and links by their link path. The result is a stable fingerprint of the filesystem that does not
+// depend on how the content is packed into layers (or on any image or layer metadata).
+func (i *Image) ContentTreeDigest() (string, error) {
+	squash, err := i.imageSquashTree()
+	if err != nil {
+		return "", fmt.Errorf("unable to digest the content tree: %w", err)
+	}
+	return contentTreeDigest(squash, &i.FileCatalog)
+}
+
+func contentTreeDigest(t *filetree.FileTree, catalog *FileCatalog) (string, error) {
+	reader := t.Reader()
+	roots := reader.Roots()
+	if len(roots) == 0 {
+		return emptyDirectoryDigest(), nil
+	}
+
+	root, ok := roots[0].(*filenode.FileNode)
+	if !ok {
+		return "", fmt.Errorf("unexpected root node type: %T", roots[0])
+	}
+	return nodeContentDigest(reader, catalog, root)
+}
+
+func emptyDirectoryDigest() string {
+	return digestString(sha256.New())
+}
+
+func digestString(h hash.Hash) string {
+	return fmt.Sprintf("sha256:%x", h.Sum(nil))
+}
+
+func nodeContentDigest(reader tree.Reader, catalog *FileCatalog, n *filenode.FileNode) (string, error) {
+	hasher := sha256.New()
+	switch n.FileType {
+	case file.TypeDir:
+		children := reader.Children(n)
+		entries := make([]*filenode.FileNode, 0, len(children))
+		for _, child := range children {
+			fn, ok := child.(*filenode.FileNode)
+			if !ok {
+				return "", fmt.Errorf("unexpected node type: %T", child)
+			}
+			entries = append(entries, fn)
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].RealPath.Basename() < entries[j].RealPath.Basename()
+		})
+
+		for _, entry := range entries {
+			digest, err := nodeContentDigest(reader, catalog, entry)
+			if err != nil {
+				return "", err
+			}
+			// null separated fields cannot be confused with one another since paths may not contain null bytes
+			if _, err := fmt.Fprintf(hasher, "%c\x00%s\x00%s\x00", entry.FileType, entry.RealPath.Basename(), digest); err != nil {
+				return "", err
+			}
+		}
+	case file.TypeSymlink, file.TypeHardLink:
+		if _, err := io.WriteString(hasher, string(n.LinkPath)); err != nil {
+			return "", err
+		}
+	case file.TypeReg:
+		if n.Reference == nil {
+			return "", fmt.Errorf("no file reference for path=%q", n.RealPath)
+		}
+		contents, err := catalog.FileContents(*n.Reference)
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(hasher, contents)
+		_ = contents.Close()
+		if err != nil {
+			return "", fmt.Errorf("unable to read path=%q: %w", n.RealPath, err)
+		}
+	}
+	return digestString(hasher), nil
+}
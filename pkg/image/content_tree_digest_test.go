@@ -0,0 +1,76 @@
+package image
+
+import (
+	"archive/tar"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImage_ContentTreeDigest(t *testing.T) {
+	hello := testTarEntry{name: "etc/hello.txt", contents: "hello"}
+	world := testTarEntry{name: "usr/share/world.txt", contents: "world"}
+	link := testTarEntry{name: "usr/local/hello", linkname: "/etc/hello.txt", typeflag: tar.TypeSymlink}
+
+	singleLayer := newTestImageFromLayers(t, []v1.Layer{newTestTarLayer(t, hello, world, link)})
+	expected, err := singleLayer.ContentTreeDigest()
+	require.NoError(t, err)
+	assert.Regexp(t, "^sha256:[a-f0-9]{64}$", expected)
+
+	tests := []struct {
+		name   string
+		layers []v1.Layer
+		same   bool
+	}{
+		{
+			name:   "same content in a different order",
+			layers: []v1.Layer{newTestTarLayer(t, link, world, hello)},
+			same:   true,
+		},
+		{
+			name:   "same content split across layers",
+			layers: []v1.Layer{newTestTarLayer(t, hello), newTestTarLayer(t, world, link)},
+			same:   true,
+		},
+		{
+			name: "overwritten content ends up the same",
+			layers: []v1.Layer{
+				newTestTarLayer(t, testTarEntry{name: "etc/hello.txt", contents: "goodbye"}, world),
+				newTestTarLayer(t, hello, link),
+			},
+			same: true,
+		},
+		{
+			name:   "different file content",
+			layers: []v1.Layer{newTestTarLayer(t, testTarEntry{name: "etc/hello.txt", contents: "HELLO"}, world, link)},
+		},
+		{
+			name:   "different link path",
+			layers: []v1.Layer{newTestTarLayer(t, hello, world, testTarEntry{name: "usr/local/hello", linkname: "/usr/share/world.txt", typeflag: tar.TypeSymlink})},
+		},
+		{
+			name:   "missing file",
+			layers: []v1.Layer{newTestTarLayer(t, hello, link)},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			img := newTestImageFromLayers(t, test.layers)
+			actual, err := img.ContentTreeDigest()
+			require.NoError(t, err)
+			if test.same {
+				assert.Equal(t, expected, actual)
+			} else {
+				assert.NotEqual(t, expected, actual)
+			}
+		})
+	}
+}
+
+func TestImage_ContentTreeDigest_SquashFailure(t *testing.T) {
+	_, err := newTestUnsquashableImage(t).ContentTreeDigest()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unable to squash layers")
+}
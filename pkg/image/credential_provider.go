@@ -0,0 +1,91 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/anchore/stereoscope/internal/log"
+	"github.com/google/go-containerregistry/pkg/authn"
+)
+
+// CredentialProvider returns (fresh) credentials for the given registry. The provider is invoked if no credentials
+// could be resolved for the registry (see RegistryOptions.ResolveCredentials), and again whenever the registry rejects the current credentials (e.g. a
+// short-lived token expired in the middle of pulling a very large image), allowing the fetch to continue.
+type CredentialProvider func(ctx context.Context, registry string) (RegistryCredentials, error)
+
+// refreshingAuthenticator is an authn.Authenticator that sources credentials from a CredentialProvider once the
+// current credentials have been rejected by the registry. Rejections are observed by the transport returned from
+// refreshingAuthenticator.transport, which must sit below the registry authentication transport.
+type refreshingAuthenticator struct {
+	ctx      context.Context
+	registry string
+	provider CredentialProvider
+	lock     sync.Mutex
+	current  authn.Authenticator
+	stale    bool
+}
+
+func newRefreshingAuthenticator(ctx context.Context, registry string, initial authn.Authenticator, provider CredentialProvider) *refreshingAuthenticator {
+	return &refreshingAuthenticator{
+		ctx:      ctx,
+		registry: registry,
+		provider: provider,
+		current:  initial,
+	}
+}
+
+// Authorization implements authn.Authenticator.
+func (a *refreshingAuthenticator) Authorization() (*authn.AuthConfig, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.current == nil || a.stale {
+		credentials, err := a.provider(a.ctx, a.registry)
+		if err != nil {
+			return nil, fmt.Errorf("unable to refresh credentials for registry=%q: %w", a.registry, err)
+		}
+		log.Debugf("refreshed credentials for registry %q", a.registry)
+		a.current = credentials.authenticator()
+		if a.current == nil {
+			a.current = authn.Anonymous
+		}
+		a.stale = false
+	}
+	return a.current.Authorization()
+}
+
+// invalidate marks the current credentials as rejected, so the next authorization will invoke the provider.
+func (a *refreshingAuthenticator) invalidate() {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.stale = true
+}
+
+// transport wraps the given round tripper such that any authenticated request rejected with 401 invalidates the
+// current credentials. Note that unauthenticated requests (e.g. the initial registry ping) are expected to be rejected
+// and do not cause a refresh.
+func (a *refreshingAuthenticator) transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &credentialRefreshTransport{base: base, authenticator: a}
+}
+
+type credentialRefreshTransport struct {
+	base          http.RoundTripper
+	authenticator *refreshingAuthenticator
+}
+
+func (t *credentialRefreshTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized && req.Header.Get("Authorization") != "" {
+		log.Debugf("registry %q rejected credentials for %q", t.authenticator.registry, req.URL.Path)
+		t.authenticator.invalidate()
+	}
+	return resp, nil
+}
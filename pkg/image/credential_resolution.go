@@ -0,0 +1,184 @@
+package image
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/anchore/stereoscope/internal/log"
+	"github.com/anchore/stereoscope/pkg/redact"
+	"github.com/docker/cli/cli/config"
+	"github.com/docker/cli/cli/config/types"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// Environment variables that may provide registry credentials (see RegistryOptions.ResolveCredentials).
+const (
+	RegistryAuthorityEnv = "STEREOSCOPE_REGISTRY_AUTH_AUTHORITY"
+	RegistryUsernameEnv  = "STEREOSCOPE_REGISTRY_AUTH_USERNAME"
+	RegistryPasswordEnv  = "STEREOSCOPE_REGISTRY_AUTH_PASSWORD"
+	RegistryTokenEnv     = "STEREOSCOPE_REGISTRY_AUTH_TOKEN"
+)
+
+// CredentialSource describes where the credentials for a registry were found.
+type CredentialSource string
+
+const (
+	// CredentialSourceOptions indicates credentials from RegistryOptions.Credentials
+	CredentialSourceOptions CredentialSource = "options"
+	// CredentialSourceKeychain indicates credentials from RegistryOptions.Keychain
+	CredentialSourceKeychain CredentialSource = "keychain"
+	// CredentialSourceEnvironment indicates credentials from the STEREOSCOPE_REGISTRY_AUTH_* environment variables
+	CredentialSourceEnvironment CredentialSource = "environment"
+	// CredentialSourceDockerConfig indicates credentials from a docker config.json file (or a credential helper
+	// configured within the file)
+	CredentialSourceDockerConfig CredentialSource = "docker-config"
+	// CredentialSourceAnonymous indicates that no credentials were found and the registry is accessed anonymously
+	CredentialSourceAnonymous CredentialSource = "anonymous"
+)
+
+// CredentialResolution is the result of resolving credentials for a single registry.
+type CredentialResolution struct {
+	Registry string
+	Source   CredentialSource
+	// Detail further describes the source (e.g. the credentials index or the docker config file path)
+	Detail        string
+	Authenticator authn.Authenticator
+}
+
+// lookupEnv is used to read credential environment variables (overridable for testing).
+var lookupEnv = os.LookupEnv
+
+// dockerConfigLock serializes docker config reads (credential helpers may not be safe for concurrent use).
+var dockerConfigLock sync.Mutex
+
+// ResolveCredentials finds the credentials to use for the given registry, trying each source in the following order:
+//  1. explicitly configured credentials (RegistryOptions.Credentials)
+//  2. the configured keychain (RegistryOptions.Keychain)
+//  3. the STEREOSCOPE_REGISTRY_AUTH_* environment variables (the authority variable optionally restricts the
+//     credentials to a single registry)
+//  4. the docker config.json file within RegistryOptions.DockerConfigDir (or the default docker config location,
+//     honoring DOCKER_CONFIG), including any configured credential helpers or credential store
+//
+// If no source has credentials for the registry then the registry is accessed anonymously.
+func (r RegistryOptions) ResolveCredentials(registry string) (CredentialResolution, error) {
+	resolution := CredentialResolution{Registry: registry}
+
+	for idx, credentials := range r.Credentials {
+		if !credentials.canBeUsedWithRegistry(registry) {
+			continue
+		}
+		if authenticator := credentials.authenticator(); authenticator != nil {
+			resolution.Source = CredentialSourceOptions
+			resolution.Detail = fmt.Sprintf("credentials index %d", idx)
+			resolution.Authenticator = authenticator
+			return resolution, nil
+		}
+	}
+
+	if r.Keychain != nil {
+		authenticator, err := authenticatorFromKeychain(r.Keychain, registry)
+		if err != nil {
+			return resolution, fmt.Errorf("unable to resolve keychain credentials for registry=%q: %w", registry, err)
+		}
+		if authenticator != nil {
+			resolution.Source = CredentialSourceKeychain
+			resolution.Authenticator = authenticator
+			return resolution, nil
+		}
+	}
+
+	if credentials, ok := credentialsFromEnvironment(); ok && credentials.canBeUsedWithRegistry(registry) {
+		if authenticator := credentials.authenticator(); authenticator != nil {
+			resolution.Source = CredentialSourceEnvironment
+			resolution.Authenticator = authenticator
+			return resolution, nil
+		}
+	}
+
+	authenticator, configFile, err := authenticatorFromDockerConfig(r.DockerConfigDir, registry)
+	if err != nil {
+		return resolution, fmt.Errorf("unable to read docker config for registry=%q: %w", registry, err)
+	}
+	if authenticator != nil {
+		resolution.Source = CredentialSourceDockerConfig
+		resolution.Detail = configFile
+		resolution.Authenticator = authenticator
+		return resolution, nil
+	}
+
+	resolution.Source = CredentialSourceAnonymous
+	resolution.Authenticator = authn.Anonymous
+	return resolution, nil
+}
+
+func credentialsFromEnvironment() (RegistryCredentials, bool) {
+	var credentials RegistryCredentials
+	var found bool
+	for env, value := range map[string]*string{
+		RegistryAuthorityEnv: &credentials.Authority,
+		RegistryUsernameEnv:  &credentials.Username,
+		RegistryPasswordEnv:  &credentials.Password,
+		RegistryTokenEnv:     &credentials.Token,
+	} {
+		if v, ok := lookupEnv(env); ok && v != "" {
+			*value = v
+			found = true
+		}
+	}
+	return credentials, found
+}
+
+// authenticatorFromKeychain returns the authenticator the given keychain resolves for the registry, or nil if the
+// keychain has no credentials for the registry (resolves to anonymous).
+func authenticatorFromKeychain(keychain authn.Keychain, registry string) (authn.Authenticator, error) {
+	target, err := name.NewRegistry(registry)
+	if err != nil {
+		return nil, err
+	}
+	authenticator, err := keychain.Resolve(target)
+	if err != nil {
+		return nil, err
+	}
+	if authenticator == nil || authenticator == authn.Anonymous {
+		return nil, nil
+	}
+	return authenticator, nil
+}
+
+// authenticatorFromDockerConfig returns an authenticator from the docker config file within the given directory
+// (the default docker config directory when empty), or nil if the config has no credentials for the registry.
+func authenticatorFromDockerConfig(dir, registry string) (authn.Authenticator, string, error) {
+	dockerConfigLock.Lock()
+	defer dockerConfigLock.Unlock()
+
+	cf, err := config.Load(dir)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// docker hub credentials are stored under a legacy key
+	key := registry
+	if key == name.DefaultRegistry {
+		key = authn.DefaultAuthKey
+	}
+
+	cfg, err := cf.GetAuthConfig(key)
+	if err != nil {
+		return nil, cf.Filename, err
+	}
+	if cfg == (types.AuthConfig{}) {
+		log.Debugf("no credentials for registry %q in docker config %q", registry, cf.Filename)
+		return nil, cf.Filename, nil
+	}
+
+	redact.AddValues(cfg.Password, cfg.Auth, cfg.IdentityToken, cfg.RegistryToken)
+	return authn.FromConfig(authn.AuthConfig{
+		Username:      cfg.Username,
+		Password:      cfg.Password,
+		Auth:          cfg.Auth,
+		IdentityToken: cfg.IdentityToken,
+		RegistryToken: cfg.RegistryToken,
+	}), cf.Filename, nil
+}
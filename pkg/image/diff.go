@@ -0,0 +1,204 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree"
+	"github.com/anchore/stereoscope/pkg/filetree/filenode"
+)
+
+// diffEntry is a single tar entry of a derived layer: either the path within the upper squash tree, or a whiteout for
+// the path within the lower squash tree.
+type diffEntry struct {
+	path     file.Path
+	whiteout bool
+}
+
+// Diff returns a tar stream of the layer that, when applied on top of the squash tree of image a, results in the
+// squash tree of image b (e.g. for image minimization or patch distribution): all added or changed paths within image
+// b are written (in path order, in the same format as Image.WriteFlattenedTar), and every path deleted from image a is
+// written as a ".wh.<name>" whiteout (only the topmost deleted directory is written for deleted subtrees).
+//
+// Paths are considered changed when the file metadata (type, mode, ownership, link, device numbers, or extended
+// attributes) differ, or when the digest of the file content differs, so the images do not need to share layers. The
+// changes are determined before returning, and the stream is written as it is read (the returned reader must be
+// closed).
+func Diff(a, b *Image) (io.ReadCloser, error) {
+	if a == nil || b == nil {
+		return nil, fmt.Errorf("two images are required")
+	}
+	for _, img := range []*Image{a, b} {
+		if err := img.requireImageContent(); err != nil {
+			return nil, fmt.Errorf("unable to diff images: %w", err)
+		}
+	}
+	lower, err := a.imageSquashTree()
+	if err != nil {
+		return nil, fmt.Errorf("unable to diff images: %w", err)
+	}
+	upper, err := b.imageSquashTree()
+	if err != nil {
+		return nil, fmt.Errorf("unable to diff images: %w", err)
+	}
+
+	entries, err := diffEntries(a, b, lower, upper)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(writeDiff(writer, b, upper, entries))
+	}()
+	return reader, nil
+}
+
+// diffEntries returns the tar entries needed to go from the lower squash tree (of image a) to the upper squash tree
+// (of image b), sorted by path.
+func diffEntries(a, b *Image, lower, upper *filetree.FileTree) ([]diffEntry, error) {
+	// paths already deleted or replaced by a different type of file, which implies all paths below them
+	replaced := file.NewPathSet()
+	isReplaced := func(p file.Path) bool {
+		for parent := file.Path(path.Dir(string(p))); parent != "/"; parent = file.Path(path.Dir(string(parent))) {
+			if replaced.Contains(parent) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var entries []diffEntry
+	for _, change := range filetree.Diff(lower, upper) {
+		switch change.Type {
+		case filetree.Added:
+			entries = append(entries, diffEntry{path: change.Path})
+		case filetree.TypeChanged:
+			replaced.Add(change.Path)
+			entries = append(entries, diffEntry{path: change.Path})
+		case filetree.Modified:
+			same, err := sameFile(a, b, change.Old, change.New)
+			if err != nil {
+				return nil, fmt.Errorf("unable to compare path=%q: %w", change.Path, err)
+			}
+			if !same {
+				entries = append(entries, diffEntry{path: change.Path})
+			}
+		case filetree.Removed:
+			if isReplaced(change.Path) {
+				continue
+			}
+			replaced.Add(change.Path)
+			entries = append(entries, diffEntry{path: change.Path, whiteout: true})
+		}
+	}
+	return entries, nil
+}
+
+// sameFile indicates if the given references (from the catalogs of image a and b respectively) describe the same file
+// metadata and content.
+func sameFile(a, b *Image, oldRef, newRef *file.Reference) (bool, error) {
+	if oldRef == nil || newRef == nil {
+		return oldRef == newRef, nil
+	}
+	oldEntry, err := a.FileCatalog.Get(*oldRef)
+	if err != nil {
+		return false, err
+	}
+	newEntry, err := b.FileCatalog.Get(*newRef)
+	if err != nil {
+		return false, err
+	}
+	if !sameFileMetadata(oldEntry.Metadata, newEntry.Metadata) {
+		return false, nil
+	}
+
+	switch file.Type(newEntry.Metadata.TypeFlag) {
+	case file.TypeReg:
+		return sameFileContent(a, b, *oldRef, *newRef, oldEntry, newEntry)
+	case file.TypeHardLink:
+		// the link shares content with the file it was bound to, which may have changed even if the link path did not
+		if oldEntry.HardlinkTarget == nil || newEntry.HardlinkTarget == nil {
+			return oldEntry.HardlinkTarget == nil && newEntry.HardlinkTarget == nil, nil
+		}
+		oldTarget, err := a.FileCatalog.Get(*oldEntry.HardlinkTarget)
+		if err != nil {
+			return false, err
+		}
+		newTarget, err := b.FileCatalog.Get(*newEntry.HardlinkTarget)
+		if err != nil {
+			return false, err
+		}
+		return sameFileContent(a, b, *oldEntry.HardlinkTarget, *newEntry.HardlinkTarget, oldTarget, newTarget)
+	}
+	return true, nil
+}
+
+func sameFileMetadata(x, y file.Metadata) bool {
+	if x.TypeFlag != y.TypeFlag || x.Mode != y.Mode || x.UserID != y.UserID || x.GroupID != y.GroupID ||
+		x.Linkname != y.Linkname || x.Size != y.Size || x.Devmajor != y.Devmajor || x.Devminor != y.Devminor {
+		return false
+	}
+	if len(x.Xattrs) != len(y.Xattrs) {
+		return false
+	}
+	for key, value := range x.Xattrs {
+		if other, ok := y.Xattrs[key]; !ok || !bytes.Equal(value, other) {
+			return false
+		}
+	}
+	return true
+}
+
+func sameFileContent(a, b *Image, oldRef, newRef file.Reference, oldEntry, newEntry FileCatalogEntry) (bool, error) {
+	oldDigest, err := a.fileDigest(oldRef, oldEntry)
+	if err != nil {
+		return false, err
+	}
+	newDigest, err := b.fileDigest(newRef, newEntry)
+	if err != nil {
+		return false, err
+	}
+	return oldDigest == newDigest, nil
+}
+
+// writeDiff writes the given entries as a tar to the given writer, sourcing all non-whiteout entries (and content)
+// from the upper squash tree of image b.
+func writeDiff(w io.Writer, b *Image, upper *filetree.FileTree, entries []diffEntry) error {
+	f := flattener{
+		tree:    upper,
+		reader:  upper.Reader(),
+		catalog: &b.FileCatalog,
+		writer:  tar.NewWriter(w),
+		written: make(map[file.ID]string),
+	}
+	for _, entry := range entries {
+		name := strings.TrimPrefix(string(entry.path), file.DirSeparator)
+		if entry.whiteout {
+			parent, basename := path.Split(name)
+			err := f.writer.WriteHeader(&tar.Header{
+				Name:     parent + file.WhiteoutPrefix + basename,
+				Typeflag: tar.TypeReg,
+				Mode:     0644,
+			})
+			if err != nil {
+				return fmt.Errorf("unable to write whiteout for path=%q: %w", entry.path, err)
+			}
+			continue
+		}
+
+		n, ok := f.reader.Node(filenode.IDByPath(entry.path)).(*filenode.FileNode)
+		if !ok || n == nil || n.RealPath.IsWhiteout() {
+			continue
+		}
+		if err := f.writeEntry(n); err != nil {
+			return fmt.Errorf("unable to write path=%q: %w", entry.path, err)
+		}
+	}
+	return f.writer.Close()
+}
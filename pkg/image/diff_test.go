@@ -0,0 +1,97 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	base := newTestTarLayer(t,
+		testTarEntry{name: "etc/unchanged", contents: "same"},
+		testTarEntry{name: "etc/config", contents: "old"},
+		testTarEntry{name: "etc/mode", contents: "mode"},
+		testTarEntry{name: "var/cache/a", contents: "a"},
+		testTarEntry{name: "var/cache/b", contents: "b"},
+		testTarEntry{name: "usr/bin/tool", contents: "tool"},
+	)
+	a := newTestImageFromLayers(t, []v1.Layer{base})
+	// b is built independently (sharing no layers), so files are compared by metadata and content
+	b := newTestImageFromLayers(t, []v1.Layer{newTestTarLayer(t,
+		testTarEntry{name: "etc/unchanged", contents: "same"},
+		testTarEntry{name: "etc/config", contents: "new"},
+		testTarEntry{name: "etc/mode", contents: "mode", mode: 0755},
+		testTarEntry{name: "etc/added", contents: "added"},
+		testTarEntry{name: "usr/bin/tool", linkname: "/etc/added", typeflag: tar.TypeSymlink},
+	)})
+
+	reader, err := Diff(a, b)
+	require.NoError(t, err)
+	content, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+
+	var names []string
+	contents := make(map[string]string)
+	tr := tar.NewReader(bytes.NewReader(content))
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, header.Name)
+		data, err := ioutil.ReadAll(tr)
+		require.NoError(t, err)
+		contents[header.Name] = string(data)
+	}
+	assert.Equal(t, []string{
+		"etc/added",
+		"etc/config",
+		"etc/mode",
+		"usr/bin/tool",
+		".wh.var",
+	}, names)
+	assert.Equal(t, "new", contents["etc/config"])
+	assert.Equal(t, "added", contents["etc/added"])
+
+	// applying the derived layer on top of image a results in the filesystem of image b
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(content)), nil
+	})
+	require.NoError(t, err)
+	v1Image, err := mutate.AppendLayers(empty.Image, base, layer)
+	require.NoError(t, err)
+	patched := NewImage(v1Image, t.TempDir())
+	require.NoError(t, patched.Read())
+	t.Cleanup(func() { _ = patched.Cleanup() })
+	assert.ElementsMatch(t, b.SquashedTree().AllRealPaths(), patched.SquashedTree().AllRealPaths())
+
+	// identical images have no differences
+	reader, err = Diff(b, b)
+	require.NoError(t, err)
+	content, err = ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	header, err := tar.NewReader(bytes.NewReader(content)).Next()
+	assert.Equal(t, io.EOF, err, "unexpected entry: %+v", header)
+}
+
+func TestDiff_SquashFailure(t *testing.T) {
+	img := newTestImageFromLayers(t, []v1.Layer{newTestTarLayer(t, testTarEntry{name: "etc/hello.txt", contents: "hello"})})
+	unsquashable := newTestUnsquashableImage(t)
+
+	for _, pair := range [][2]*Image{{unsquashable, img}, {img, unsquashable}} {
+		_, err := Diff(pair[0], pair[1])
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unable to squash layers")
+	}
+}
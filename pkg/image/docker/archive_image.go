@@ -0,0 +1,298 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/file/tarutil"
+	"github.com/anchore/stereoscope/pkg/image"
+)
+
+// maxArchiveLinks is the maximum number of links followed when resolving an archive entry.
+const maxArchiveLinks = 16
+
+// archiveEntries are the entries of a docker archive, by cleaned path (so "./<id>.tar" and "<id>.tar" are the same).
+type archiveEntries map[string]file.TarIndexEntry
+
+func indexArchive(tarPath string) (archiveEntries, error) {
+	index, err := file.NewTarIndex(tarPath, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to index docker archive: %w", err)
+	}
+	entries := make(archiveEntries)
+	for _, entry := range index.Entries() {
+		// later entries replace earlier entries with the same path (as they would when extracting the archive)
+		entries[tarutil.CleanPath(entry.Header().Name)] = entry
+	}
+	return entries, nil
+}
+
+// resolve returns the regular file entry for the given path as referenced by manifest.json, following any links.
+func (a archiveEntries) resolve(name string) (file.TarIndexEntry, error) {
+	p := tarutil.CleanPath(name)
+	for i := 0; i < maxArchiveLinks; i++ {
+		entry, ok := a[p]
+		if !ok {
+			return file.TarIndexEntry{}, &file.ErrFileNotFound{Path: name}
+		}
+		header := entry.Header()
+		switch header.Typeflag {
+		case tar.TypeReg, tar.TypeRegA:
+			return entry, nil
+		case tar.TypeSymlink:
+			p = tarutil.CleanPath(path.Join(path.Dir(p), header.Linkname))
+		case tar.TypeLink:
+			p = tarutil.CleanPath(header.Linkname)
+		default:
+			return file.TarIndexEntry{}, fmt.Errorf("archive entry=%q is not a file", name)
+		}
+	}
+	return file.TarIndexEntry{}, fmt.Errorf("too many links while resolving archive entry=%q", name)
+}
+
+// entryCompression detects the compression of the entry contents from the leading magic bytes.
+func entryCompression(entry file.TarIndexEntry) (file.Compression, error) {
+	reader := entry.Open()
+	defer reader.Close()
+
+	header := make([]byte, 8)
+	n, err := io.ReadFull(reader, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	return file.DetectCompression(header[:n]), nil
+}
+
+// newArchiveImageIfNeeded returns an image read directly from the archive entries when the GCR lib cannot read the
+// archive faithfully, otherwise nil. This is the case when the entries are not named exactly as referenced by
+// manifest.json (e.g. "./<id>.tar") or when the layer blobs are not all gzip compressed or all uncompressed (e.g.
+// zstd compressed layers written by "podman save"), since the GCR lib detects the compression of all layers from the
+// first layer only (and only recognizes gzip).
+func newArchiveImageIfNeeded(tarPath string, manifest *dockerManifest) (v1.Image, error) {
+	if len(manifest.parsed) != 1 {
+		return nil, nil
+	}
+	descriptor := manifest.parsed[0]
+
+	entries, err := indexArchive(tarPath)
+	if err != nil {
+		return nil, err
+	}
+
+	needed := false
+	resolve := func(name string) (file.TarIndexEntry, error) {
+		if entry, ok := entries[tarutil.CleanPath(name)]; ok && entry.Header().Name != name {
+			needed = true
+		}
+		return entries.resolve(name)
+	}
+
+	configEntry, err := resolve(descriptor.Config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find docker config: %w", err)
+	}
+
+	layerEntries := make([]file.TarIndexEntry, len(descriptor.Layers))
+	compressions := make([]file.Compression, len(descriptor.Layers))
+	for idx, layerPath := range descriptor.Layers {
+		if layerEntries[idx], err = resolve(layerPath); err != nil {
+			return nil, fmt.Errorf("unable to find layer tar: %w", err)
+		}
+		if compressions[idx], err = entryCompression(layerEntries[idx]); err != nil {
+			return nil, fmt.Errorf("unable to detect compression of layer=%q: %w", layerPath, err)
+		}
+		if compressions[idx] != compressions[0] || (compressions[idx] != file.CompressionGzip && compressions[idx] != file.CompressionNone) {
+			needed = true
+		}
+	}
+	if !needed {
+		return nil, nil
+	}
+
+	return newArchiveImage(configEntry, layerEntries, compressions)
+}
+
+// archiveImage is a docker archive image with layers read directly from the archive entries, where each layer blob is
+// described with the media type for the compression of the blob and decompressed accordingly.
+type archiveImage struct {
+	v1.Image
+	rawConfig   []byte
+	rawManifest []byte
+	layers      map[v1.Hash]*archiveLayer
+}
+
+func newArchiveImage(configEntry file.TarIndexEntry, layerEntries []file.TarIndexEntry, compressions []file.Compression) (*archiveImage, error) {
+	configReader := configEntry.Open()
+	rawConfig, err := ioutil.ReadAll(configReader)
+	_ = configReader.Close()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read docker config: %w", err)
+	}
+	configDigest, configSize, err := v1.SHA256(bytes.NewReader(rawConfig))
+	if err != nil {
+		return nil, err
+	}
+	config, err := v1.ParseConfigFile(bytes.NewReader(rawConfig))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse docker config: %w", err)
+	}
+	if len(config.RootFS.DiffIDs) != len(layerEntries) {
+		return nil, fmt.Errorf("docker config describes %d layers, however, manifest.json references %d layers", len(config.RootFS.DiffIDs), len(layerEntries))
+	}
+
+	manifest := v1.Manifest{
+		SchemaVersion: 2,
+		MediaType:     types.OCIManifestSchema1,
+		Config: v1.Descriptor{
+			MediaType: types.OCIConfigJSON,
+			Size:      configSize,
+			Digest:    configDigest,
+		},
+	}
+	img := &archiveImage{
+		rawConfig: rawConfig,
+		layers:    make(map[v1.Hash]*archiveLayer),
+	}
+	for idx, entry := range layerEntries {
+		reader := entry.Open()
+		digest, size, err := v1.SHA256(reader)
+		_ = reader.Close()
+		if err != nil {
+			return nil, fmt.Errorf("unable to digest layer=%q: %w", entry.Header().Name, err)
+		}
+		layer := &archiveLayer{
+			entry:     entry,
+			digest:    digest,
+			diffID:    config.RootFS.DiffIDs[idx],
+			size:      size,
+			mediaType: archiveLayerMediaType(compressions[idx]),
+		}
+		img.layers[digest] = layer
+		manifest.Layers = append(manifest.Layers, v1.Descriptor{
+			MediaType: layer.mediaType,
+			Size:      size,
+			Digest:    digest,
+		})
+	}
+
+	if img.rawManifest, err = json.Marshal(manifest); err != nil {
+		return nil, err
+	}
+	if img.Image, err = partial.CompressedToImage(archiveImageCore{img}); err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// archiveLayerMediaType returns the OCI layer media type for a layer blob with the given compression (compressions
+// without a media type are described as uncompressed, which is reported as a compression mismatch when read).
+func archiveLayerMediaType(compression file.Compression) types.MediaType {
+	switch compression {
+	case file.CompressionGzip:
+		return types.OCILayer
+	case file.CompressionZstd:
+		return image.OCILayerZstd
+	}
+	return types.OCIUncompressedLayer
+}
+
+func (i *archiveImage) Layers() ([]v1.Layer, error) {
+	m, err := i.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	layers := make([]v1.Layer, 0, len(m.Layers))
+	for _, desc := range m.Layers {
+		layer, err := i.LayerByDigest(desc.Digest)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, layer)
+	}
+	return layers, nil
+}
+
+func (i *archiveImage) LayerByDigest(h v1.Hash) (v1.Layer, error) {
+	layer, ok := i.layers[h]
+	if !ok {
+		return nil, fmt.Errorf("no layer with digest=%q within docker archive", h)
+	}
+	return layer, nil
+}
+
+func (i *archiveImage) LayerByDiffID(h v1.Hash) (v1.Layer, error) {
+	digest, err := partial.DiffIDToBlob(i, h)
+	if err != nil {
+		return nil, err
+	}
+	return i.LayerByDigest(digest)
+}
+
+// archiveImageCore is the minimal (compressed) image core for the GCR lib to fill in the remaining image methods.
+type archiveImageCore struct {
+	img *archiveImage
+}
+
+func (c archiveImageCore) RawConfigFile() ([]byte, error) {
+	return c.img.rawConfig, nil
+}
+
+func (c archiveImageCore) MediaType() (types.MediaType, error) {
+	return types.OCIManifestSchema1, nil
+}
+
+func (c archiveImageCore) RawManifest() ([]byte, error) {
+	return c.img.rawManifest, nil
+}
+
+func (c archiveImageCore) LayerByDigest(h v1.Hash) (partial.CompressedLayer, error) {
+	layer, ok := c.img.layers[h]
+	if !ok {
+		return nil, fmt.Errorf("no layer with digest=%q within docker archive", h)
+	}
+	return layer, nil
+}
+
+// archiveLayer is a layer blob within a docker archive, which is decompressed according to the detected compression.
+type archiveLayer struct {
+	entry     file.TarIndexEntry
+	digest    v1.Hash
+	diffID    v1.Hash
+	size      int64
+	mediaType types.MediaType
+}
+
+func (l *archiveLayer) Digest() (v1.Hash, error) {
+	return l.digest, nil
+}
+
+func (l *archiveLayer) DiffID() (v1.Hash, error) {
+	return l.diffID, nil
+}
+
+func (l *archiveLayer) Compressed() (io.ReadCloser, error) {
+	return l.entry.Open(), nil
+}
+
+func (l *archiveLayer) Uncompressed() (io.ReadCloser, error) {
+	reader, _, err := file.NewDecompressingReadCloser(l.entry.Open())
+	return reader, err
+}
+
+func (l *archiveLayer) Size() (int64, error) {
+	return l.size, nil
+}
+
+func (l *archiveLayer) MediaType() (types.MediaType, error) {
+	return l.mediaType, nil
+}
@@ -0,0 +1,203 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+)
+
+type testArchiveEntry struct {
+	name     string
+	contents []byte
+	linkname string
+}
+
+func newTestTar(t *testing.T, entries ...testArchiveEntry) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Mode: 0644, Size: int64(len(entry.contents)), Typeflag: tar.TypeReg}
+		if entry.linkname != "" {
+			header.Typeflag, header.Linkname, header.Size = tar.TypeSymlink, entry.linkname, 0
+		}
+		require.NoError(t, tw.WriteHeader(header))
+		_, err := tw.Write(entry.contents)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+func compressTestBlob(t *testing.T, compression file.Compression, contents []byte) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	switch compression {
+	case file.CompressionGzip:
+		w := gzip.NewWriter(buf)
+		_, err := w.Write(contents)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+	case file.CompressionZstd:
+		w, err := zstd.NewWriter(buf)
+		require.NoError(t, err)
+		_, err = w.Write(contents)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+	default:
+		return contents
+	}
+	return buf.Bytes()
+}
+
+// newTestArchive writes a docker archive with one layer per compression (each layer with a single file), where the
+// archive entry names are given the prefix (e.g. "./" as written by some tools) while manifest.json does not.
+func newTestArchive(t *testing.T, prefix string, compressions ...file.Compression) string {
+	t.Helper()
+	var diffIDs, layerPaths []string
+	var entries []testArchiveEntry
+	for idx, compression := range compressions {
+		layerTar := newTestTar(t, testArchiveEntry{name: fmt.Sprintf("file-%d", idx), contents: []byte(fmt.Sprintf("contents %d", idx))})
+		diffIDs = append(diffIDs, fmt.Sprintf("sha256:%x", sha256.Sum256(layerTar)))
+		blob := compressTestBlob(t, compression, layerTar)
+		// podman names layer blobs by digest with a ".tar" extension regardless of compression
+		layerPath := fmt.Sprintf("%x.tar", sha256.Sum256(blob))
+		layerPaths = append(layerPaths, layerPath)
+		entries = append(entries, testArchiveEntry{name: prefix + layerPath, contents: blob})
+	}
+
+	rawConfig, err := json.Marshal(map[string]interface{}{
+		"architecture": "amd64",
+		"os":           "linux",
+		"rootfs":       map[string]interface{}{"type": "layers", "diff_ids": diffIDs},
+	})
+	require.NoError(t, err)
+	configPath := fmt.Sprintf("%x.json", sha256.Sum256(rawConfig))
+	rawManifest, err := json.Marshal([]map[string]interface{}{
+		{"Config": configPath, "RepoTags": []string{"localhost/podman:latest"}, "Layers": layerPaths},
+	})
+	require.NoError(t, err)
+	entries = append(entries,
+		testArchiveEntry{name: prefix + configPath, contents: rawConfig},
+		testArchiveEntry{name: "manifest.json", contents: rawManifest},
+	)
+
+	archivePath := filepath.Join(t.TempDir(), "image.tar")
+	require.NoError(t, ioutil.WriteFile(archivePath, newTestTar(t, entries...), 0644))
+	return archivePath
+}
+
+func TestTarballImageProvider_Provide_CompressedLayers(t *testing.T) {
+	tests := []struct {
+		name          string
+		prefix        string
+		compressions  []file.Compression
+		expectArchive bool
+	}{
+		{
+			name:         "uncompressed layers",
+			compressions: []file.Compression{file.CompressionNone, file.CompressionNone},
+		},
+		{
+			name:         "gzip compressed layers",
+			compressions: []file.Compression{file.CompressionGzip, file.CompressionGzip},
+		},
+		{
+			name:          "zstd compressed layers",
+			compressions:  []file.Compression{file.CompressionZstd, file.CompressionZstd},
+			expectArchive: true,
+		},
+		{
+			name:          "mixed compression",
+			compressions:  []file.Compression{file.CompressionNone, file.CompressionGzip, file.CompressionZstd},
+			expectArchive: true,
+		},
+		{
+			name:          "entry names that differ from manifest.json",
+			prefix:        "./",
+			compressions:  []file.Compression{file.CompressionGzip},
+			expectArchive: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			archivePath := newTestArchive(t, test.prefix, test.compressions...)
+			generator := file.NewTempDirGenerator("stereoscope-docker-archive-test")
+			defer generator.Cleanup()
+
+			img, err := NewProviderFromTarball(archivePath, generator).Provide(context.Background())
+			require.NoError(t, err)
+			require.NoError(t, img.Read())
+
+			require.Len(t, img.Layers, len(test.compressions))
+			var expectedPaths []file.Path
+			for idx := range test.compressions {
+				expectedPaths = append(expectedPaths, file.Path(fmt.Sprintf("/file-%d", idx)))
+			}
+			assert.Subset(t, img.SquashedTree().AllRealPaths(), expectedPaths)
+
+			reader, err := img.FileContentsFromSquash("/file-0")
+			require.NoError(t, err)
+			contents, err := ioutil.ReadAll(reader)
+			require.NoError(t, err)
+			require.NoError(t, reader.Close())
+			assert.Equal(t, "contents 0", string(contents))
+
+			for _, w := range img.Warnings() {
+				assert.NotEqual(t, image.WarningCompressionMismatch, w.Kind, "unexpected warning: %s", w.Message)
+			}
+			assert.Equal(t, []string{"localhost/podman:latest"}, tagStrings(img))
+
+			manifest, err := extractManifest(archivePath)
+			require.NoError(t, err)
+			archiveImg, err := newArchiveImageIfNeeded(archivePath, manifest)
+			require.NoError(t, err)
+			assert.Equal(t, test.expectArchive, archiveImg != nil)
+		})
+	}
+}
+
+func TestArchiveEntries_Resolve(t *testing.T) {
+	archivePath := filepath.Join(t.TempDir(), "image.tar")
+	require.NoError(t, ioutil.WriteFile(archivePath, newTestTar(t,
+		testArchiveEntry{name: "./blobs/layer.tar", contents: []byte("layer")},
+		testArchiveEntry{name: "layer/layer.tar", linkname: "../blobs/layer.tar"},
+		testArchiveEntry{name: "loop.tar", linkname: "loop.tar"},
+	), 0644))
+
+	entries, err := indexArchive(archivePath)
+	require.NoError(t, err)
+
+	for _, name := range []string{"blobs/layer.tar", "/blobs/layer.tar", "layer/layer.tar"} {
+		entry, err := entries.resolve(name)
+		require.NoError(t, err, name)
+		assert.Equal(t, "./blobs/layer.tar", entry.Header().Name)
+	}
+
+	_, err = entries.resolve("missing.tar")
+	assert.Error(t, err)
+	_, err = entries.resolve("loop.tar")
+	assert.Error(t, err)
+}
+
+func tagStrings(img *image.Image) []string {
+	var tags []string
+	for _, tag := range img.Metadata.Tags {
+		tags = append(tags, tag.String())
+	}
+	return tags
+}
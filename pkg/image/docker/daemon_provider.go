@@ -19,6 +19,7 @@ import (
 	"github.com/anchore/stereoscope/pkg/event"
 	"github.com/anchore/stereoscope/pkg/file"
 	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/anchore/stereoscope/pkg/redact"
 	"github.com/docker/cli/cli/config"
 	configTypes "github.com/docker/cli/cli/config/types"
 	"github.com/docker/docker/api/types"
@@ -30,24 +31,40 @@ import (
 
 // DaemonImageProvider is a image.Provider capable of fetching and representing a docker image from the docker daemon API.
 type DaemonImageProvider struct {
-	imageStr  string
+	imageStr string
+	// pullStr is the reference used to pull the image when it is missing (empty if the image cannot be pulled, e.g.
+	// when referenced by image ID)
+	pullStr   string
 	tmpDirGen *file.TempDirGenerator
 	client    client.APIClient
 	platform  *image.Platform
 }
 
-// NewProviderFromDaemon creates a new provider instance for a specific image that will later be cached to the given directory.
+// NewProviderFromDaemon creates a new provider instance for a specific image that will later be cached to the given
+// directory. Images may also be referenced by image ID (the config digest, with or without the "sha256:" prefix) or a
+// unique prefix of the ID (e.g. the truncated ID shown by "docker images"), which are resolved by the daemon the same
+// way the docker and podman CLIs do. Images referenced by a full image ID are never pulled.
 func NewProviderFromDaemon(imgStr string, tmpDirGen *file.TempDirGenerator, c client.APIClient, platform *image.Platform) (*DaemonImageProvider, error) {
-	ref, err := name.ParseReference(imgStr, name.WithDefaultRegistry(""))
-	if err != nil {
-		return nil, err
-	}
-	tag, ok := ref.(name.Tag)
-	if ok {
-		imgStr = tag.Name()
+	var pullStr string
+	if !isFullImageID(imgStr) {
+		ref, err := name.ParseReference(imgStr, name.WithDefaultRegistry(""))
+		if err != nil {
+			return nil, err
+		}
+		pullStr = imgStr
+		tag, ok := ref.(name.Tag)
+		if ok {
+			pullStr = tag.Name()
+		}
+		if !isImageIDCandidate(imgStr) {
+			imgStr = pullStr
+		}
+		// note: potential image ID prefixes are given to the daemon as-is, since the daemon will consider these as both
+		// a name and an ID prefix (normalizing these to a tag would prevent ID resolution)
 	}
 	return &DaemonImageProvider{
 		imageStr:  imgStr,
+		pullStr:   pullStr,
 		tmpDirGen: tmpDirGen,
 		client:    c,
 		platform:  platform,
@@ -60,9 +77,9 @@ type daemonProvideProgress struct {
 	Stage        *progress.Stage
 }
 
-func (p *DaemonImageProvider) trackSaveProgress() (*daemonProvideProgress, error) {
+func (p *DaemonImageProvider) trackSaveProgress(ctx context.Context) (*daemonProvideProgress, error) {
 	// fetch the expected image size to estimate and measure progress
-	inspect, _, err := p.client.ImageInspectWithRaw(context.Background(), p.imageStr)
+	inspect, _, err := p.client.ImageInspectWithRaw(ctx, p.imageStr)
 	if err != nil {
 		return nil, fmt.Errorf("unable to inspect image: %w", err)
 	}
@@ -104,7 +121,10 @@ func (p *DaemonImageProvider) trackSaveProgress() (*daemonProvideProgress, error
 
 // pull a docker image
 func (p *DaemonImageProvider) pull(ctx context.Context) error {
-	log.Debugf("pulling docker image=%q", p.imageStr)
+	if p.pullStr == "" {
+		return fmt.Errorf("image ID %q not found in the daemon (images referenced by ID cannot be pulled)", p.imageStr)
+	}
+	log.Debugf("pulling docker image=%q", p.pullStr)
 
 	var status = newPullStatus()
 	defer func() {
@@ -114,7 +134,7 @@ func (p *DaemonImageProvider) pull(ctx context.Context) error {
 	// publish a pull event on the bus, allowing for read-only consumption of status
 	bus.Publish(partybus.Event{
 		Type:   event.PullDockerImage,
-		Source: p.imageStr,
+		Source: p.pullStr,
 		Value:  status,
 	})
 
@@ -123,7 +143,7 @@ func (p *DaemonImageProvider) pull(ctx context.Context) error {
 		return err
 	}
 
-	resp, err := p.client.ImagePull(ctx, p.imageStr, options)
+	resp, err := p.client.ImagePull(ctx, p.pullStr, options)
 	if err != nil {
 		return fmt.Errorf("pull failed: %w", err)
 	}
@@ -163,9 +183,9 @@ func (p *DaemonImageProvider) pullOptions() (types.ImagePullOptions, error) {
 	log.Debugf("using docker config=%q", cfg.Filename)
 
 	// get a URL that works with docker credential helpers
-	url, err := authURL(p.imageStr, true)
+	url, err := authURL(p.pullStr, true)
 	if err != nil {
-		log.Warnf("failed to determine auth url from image=%q: %+v", p.imageStr, err)
+		log.Warnf("failed to determine auth url from image=%q: %+v", p.pullStr, err)
 		return options, nil
 	}
 
@@ -181,9 +201,9 @@ func (p *DaemonImageProvider) pullOptions() (types.ImagePullOptions, error) {
 		// docker credential helper was unnecessary (since the user isn't using a credential helper). For this reason
 		// lets try this auth config lookup again, but this time for a url that doesn't consider the dockerhub
 		// workaround for the credential helper.
-		url, err = authURL(p.imageStr, false)
+		url, err = authURL(p.pullStr, false)
 		if err != nil {
-			log.Warnf("failed to determine auth url from image=%q: %+v", p.imageStr, err)
+			log.Warnf("failed to determine auth url from image=%q: %+v", p.pullStr, err)
 			return options, nil
 		}
 
@@ -195,11 +215,13 @@ func (p *DaemonImageProvider) pullOptions() (types.ImagePullOptions, error) {
 	}
 
 	log.Debugf("using docker credentials for %q", url)
+	redact.AddValues(authConfig.Password, authConfig.Auth, authConfig.IdentityToken, authConfig.RegistryToken)
 
 	options.RegistryAuth, err = encodeCredentials(authConfig)
 	if err != nil {
 		log.Warnf("failed to encode registry auth (url=%s): %+v", url, err)
 	}
+	redact.AddValues(options.RegistryAuth)
 
 	return options, nil
 }
@@ -250,7 +272,7 @@ func (p *DaemonImageProvider) Provide(ctx context.Context, userMetadata ...image
 
 func (p *DaemonImageProvider) saveImage(ctx context.Context) (string, error) {
 	// save the image from the docker daemon to a tar file
-	providerProgress, err := p.trackSaveProgress()
+	providerProgress, err := p.trackSaveProgress(ctx)
 	if err != nil {
 		return "", fmt.Errorf("unable to trace image save progress: %w", err)
 	}
@@ -323,8 +345,9 @@ func (p *DaemonImageProvider) pullImageIfMissing(ctx context.Context) error {
 		}
 	} else {
 		// looks like the image exists, but if the platform doesn't match what the user specified, we may need to
-		// pull the image again with the correct platofmr specifier, which will override the local tag.
-		if err := p.validatePlatform(inspectResult); err != nil {
+		// pull the image again with the correct platofmr specifier, which will override the local tag. Images found
+		// by ID will never change by pulling, so the platform mismatch is reported later instead.
+		if err := p.validatePlatform(inspectResult); err != nil && !p.isResolvedByID(inspectResult) {
 			if err = p.pull(ctx); err != nil {
 				return err
 			}
@@ -333,6 +356,14 @@ func (p *DaemonImageProvider) pullImageIfMissing(ctx context.Context) error {
 	return nil
 }
 
+// isResolvedByID indicates if the daemon resolved the image reference as an image ID (or ID prefix) instead of a name.
+func (p *DaemonImageProvider) isResolvedByID(i types.ImageInspect) bool {
+	if !isImageIDCandidate(p.imageStr) {
+		return false
+	}
+	return strings.HasPrefix(strings.TrimPrefix(i.ID, "sha256:"), strings.TrimPrefix(p.imageStr, "sha256:"))
+}
+
 func (p *DaemonImageProvider) validatePlatform(i types.ImageInspect) error {
 	if p.platform == nil {
 		// the user did not specify a platform
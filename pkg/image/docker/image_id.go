@@ -0,0 +1,24 @@
+package docker
+
+import (
+	"regexp"
+	"strings"
+)
+
+// imageIDPattern matches full (optionally "sha256:" prefixed) and truncated image IDs (config digests), as shown by
+// "docker images" or "podman images".
+var imageIDPattern = regexp.MustCompile(`^(sha256:)?[a-f0-9]{1,64}$`)
+
+// isImageIDCandidate indicates if the given reference could refer to an image by ID (or a unique ID prefix). Note that
+// short hex strings are also valid image names, so the daemon must be allowed to resolve these either way.
+func isImageIDCandidate(imgStr string) bool {
+	return imageIDPattern.MatchString(imgStr)
+}
+
+// isFullImageID indicates if the given reference can only refer to an image by ID (it can never be pulled).
+func isFullImageID(imgStr string) bool {
+	if !isImageIDCandidate(imgStr) {
+		return false
+	}
+	return strings.HasPrefix(imgStr, "sha256:") || len(imgStr) == 64
+}
@@ -0,0 +1,100 @@
+package docker
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testImageID = "sha256:4a8a2b6b1f0a6b8f2ee1a0d4a8e07c9e4a8c9e9a4e1d8b3c3c2c2f7f0f2d1a11"
+
+func Test_isImageIDCandidate(t *testing.T) {
+	tests := []struct {
+		imgStr    string
+		candidate bool
+		full      bool
+	}{
+		{imgStr: testImageID, candidate: true, full: true},
+		{imgStr: testImageID[len("sha256:"):], candidate: true, full: true},
+		{imgStr: testImageID[len("sha256:") : len("sha256:")+12], candidate: true},
+		{imgStr: "sha256:4a8a2b6b1f0a", candidate: true, full: true},
+		{imgStr: "alpine:latest"},
+		{imgStr: "alpine"},
+		{imgStr: "4A8A2B6B1F0A"},
+		{imgStr: "docker.io/library/alpine@" + testImageID},
+	}
+	for _, test := range tests {
+		t.Run(test.imgStr, func(t *testing.T) {
+			assert.Equal(t, test.candidate, isImageIDCandidate(test.imgStr))
+			assert.Equal(t, test.full, isFullImageID(test.imgStr))
+		})
+	}
+}
+
+func TestNewProviderFromDaemon_ImageIDs(t *testing.T) {
+	tests := []struct {
+		imgStr       string
+		wantImageStr string
+		wantPullStr  string
+	}{
+		{imgStr: testImageID, wantImageStr: testImageID},
+		{imgStr: "4a8a2b6b1f0a", wantImageStr: "4a8a2b6b1f0a", wantPullStr: "4a8a2b6b1f0a:latest"},
+		{imgStr: "alpine", wantImageStr: "alpine:latest", wantPullStr: "alpine:latest"},
+	}
+	for _, test := range tests {
+		t.Run(test.imgStr, func(t *testing.T) {
+			p, err := NewProviderFromDaemon(test.imgStr, nil, nil, nil)
+			require.NoError(t, err)
+			assert.Equal(t, test.wantImageStr, p.imageStr)
+			assert.Equal(t, test.wantPullStr, p.pullStr)
+		})
+	}
+}
+
+// fakeDaemonClient is a minimal docker client where only image inspection and pulls are implemented.
+type fakeDaemonClient struct {
+	client.APIClient
+	images []types.ImageInspect
+	pulled []string
+}
+
+func (c *fakeDaemonClient) ImageInspectWithRaw(_ context.Context, ref string) (types.ImageInspect, []byte, error) {
+	for _, img := range c.images {
+		if strings.HasPrefix(strings.TrimPrefix(img.ID, "sha256:"), strings.TrimPrefix(ref, "sha256:")) {
+			return img, nil, nil
+		}
+	}
+	return types.ImageInspect{}, nil, errdefs.NotFound(assert.AnError)
+}
+
+func (c *fakeDaemonClient) ImagePull(_ context.Context, ref string, _ types.ImagePullOptions) (io.ReadCloser, error) {
+	c.pulled = append(c.pulled, ref)
+	return nil, assert.AnError
+}
+
+func TestDaemonImageProvider_pullImageIfMissing_ImageIDs(t *testing.T) {
+	c := &fakeDaemonClient{images: []types.ImageInspect{{ID: testImageID, Os: "linux", Architecture: "amd64"}}}
+
+	// found by full and truncated ID, no pulls
+	for _, imgStr := range []string{testImageID, "4a8a2b6b1f0a"} {
+		p, err := NewProviderFromDaemon(imgStr, nil, c, nil)
+		require.NoError(t, err)
+		require.NoError(t, p.pullImageIfMissing(context.Background()))
+	}
+	assert.Empty(t, c.pulled)
+
+	// a missing full ID is never pulled
+	p, err := NewProviderFromDaemon("sha256:0000000000000000000000000000000000000000000000000000000000000000", nil, c, nil)
+	require.NoError(t, err)
+	err = p.pullImageIfMissing(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot be pulled")
+	assert.Empty(t, c.pulled)
+}
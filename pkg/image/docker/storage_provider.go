@@ -0,0 +1,221 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"github.com/anchore/stereoscope/internal/log"
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/anchore/stereoscope/pkg/image/overlay"
+)
+
+// DefaultStorageRoot is the default docker data root (see "dockerd --data-root").
+const DefaultStorageRoot = "/var/lib/docker"
+
+// storageDriver is the only storage driver that can be read (images stored by other drivers, or by the containerd
+// image store, are not supported).
+const storageDriver = "overlay2"
+
+// StorageImageProvider is an image.Provider for an image within the on-disk storage of a docker daemon (the docker data
+// root), read directly from the image metadata and overlay2 layer directories without a running daemon. This is most
+// useful for forensic analysis of stopped hosts or offline disk images (e.g. a mounted volume snapshot).
+type StorageImageProvider struct {
+	imageStr  string
+	root      string
+	tmpDirGen *file.TempDirGenerator
+}
+
+// NewProviderFromStorage creates a new provider instance for the given image (a reference, such as "nginx:latest", or a
+// full or unique prefix of an image ID) within the docker data root at the given path (DefaultStorageRoot when empty).
+func NewProviderFromStorage(imgStr, root string, tmpDirGen *file.TempDirGenerator) *StorageImageProvider {
+	if root == "" {
+		root = DefaultStorageRoot
+	}
+	return &StorageImageProvider{
+		imageStr:  imgStr,
+		root:      root,
+		tmpDirGen: tmpDirGen,
+	}
+}
+
+// storageRepositories is the content of "image/overlay2/repositories.json", which maps every tag and repo digest to
+// the ID of the image it refers to for each repository.
+type storageRepositories struct {
+	Repositories map[string]map[string]string
+}
+
+// Provide an image object that represents the image within the configured docker data root.
+func (p *StorageImageProvider) Provide(_ context.Context, userMetadata ...image.AdditionalMetadata) (*image.Image, error) {
+	imageDir := filepath.Join(p.root, "image", storageDriver)
+	if _, err := os.Stat(imageDir); err != nil {
+		return nil, fmt.Errorf("unable to find %s image metadata within docker data root=%q (only the %s storage driver is supported): %w", storageDriver, p.root, storageDriver, err)
+	}
+
+	repositories, err := readStorageRepositories(filepath.Join(imageDir, "repositories.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := p.resolveImageID(imageDir, repositories)
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("resolved image=%q to id=%q within docker data root=%q", p.imageStr, id, p.root)
+
+	rawConfig, err := ioutil.ReadFile(filepath.Join(imageDir, "imagedb", "content", id.Algorithm, id.Hex))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read image config for id=%q: %w", id, err)
+	}
+	config, err := v1.ParseConfigFile(bytes.NewReader(rawConfig))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse image config for id=%q: %w", id, err)
+	}
+
+	var layerDirs []string
+	for _, chainID := range storageChainIDs(config.RootFS.DiffIDs) {
+		dir, err := p.layerDir(imageDir, chainID)
+		if err != nil {
+			return nil, err
+		}
+		layerDirs = append(layerDirs, dir)
+	}
+
+	img, err := overlay.NewImage(rawConfig, layerDirs)
+	if err != nil {
+		return nil, fmt.Errorf("unable to provide image from docker data root: %w", err)
+	}
+
+	tags, repoDigests := repositories.references(id)
+	metadata := []image.AdditionalMetadata{
+		image.WithTags(tags...),
+		image.WithRepoDigests(repoDigests...),
+	}
+
+	// apply user-supplied metadata last to override any default behavior
+	metadata = append(metadata, userMetadata...)
+
+	contentTempDir, err := p.tmpDirGen.NewDirectory("docker-storage-image")
+	if err != nil {
+		return nil, err
+	}
+
+	return image.NewImage(img, contentTempDir, metadata...), nil
+}
+
+func readStorageRepositories(path string) (*storageRepositories, error) {
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		// no image has ever been tagged
+		return &storageRepositories{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read docker repositories: %w", err)
+	}
+	var repositories storageRepositories
+	if err := json.Unmarshal(contents, &repositories); err != nil {
+		return nil, fmt.Errorf("unable to parse docker repositories=%q: %w", path, err)
+	}
+	return &repositories, nil
+}
+
+// resolveImageID finds the ID of the configured image, either by reference (compared after normalization, so "nginx"
+// matches "docker.io/library/nginx:latest") or by a full or unique prefix of the image ID.
+func (p *StorageImageProvider) resolveImageID(imageDir string, repositories *storageRepositories) (v1.Hash, error) {
+	if ref, err := name.ParseReference(p.imageStr, name.WeakValidation); err == nil {
+		for _, refs := range repositories.Repositories {
+			for candidate, id := range refs {
+				candidateRef, err := name.ParseReference(candidate, name.WeakValidation)
+				if err != nil || candidateRef.Name() != ref.Name() {
+					continue
+				}
+				return v1.NewHash(id)
+			}
+		}
+	}
+
+	if !isImageIDCandidate(p.imageStr) {
+		return v1.Hash{}, fmt.Errorf("unable to find image=%q within docker data root=%q", p.imageStr, p.root)
+	}
+
+	prefix := strings.TrimPrefix(p.imageStr, "sha256:")
+	entries, err := ioutil.ReadDir(filepath.Join(imageDir, "imagedb", "content", "sha256"))
+	if err != nil {
+		return v1.Hash{}, fmt.Errorf("unable to read docker image database: %w", err)
+	}
+	var matches []string
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), prefix) {
+			matches = append(matches, entry.Name())
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return v1.Hash{}, fmt.Errorf("unable to find image=%q within docker data root=%q", p.imageStr, p.root)
+	case 1:
+		return v1.NewHash("sha256:" + matches[0])
+	}
+	return v1.Hash{}, fmt.Errorf("image ID prefix=%q is ambiguous within docker data root=%q (matches %d images)", p.imageStr, p.root, len(matches))
+}
+
+// layerDir returns the overlay2 layer directory for the layer with the given chain ID.
+func (p *StorageImageProvider) layerDir(imageDir, chainID string) (string, error) {
+	hex := strings.TrimPrefix(chainID, "sha256:")
+	cacheID, err := ioutil.ReadFile(filepath.Join(imageDir, "layerdb", "sha256", hex, "cache-id"))
+	if err != nil {
+		return "", fmt.Errorf("unable to find layer with chain ID=%q: %w", chainID, err)
+	}
+	dir := filepath.Join(p.root, storageDriver, strings.TrimSpace(string(cacheID)), "diff")
+	if _, err := os.Stat(dir); err != nil {
+		return "", fmt.Errorf("unable to find layer directory for chain ID=%q: %w", chainID, err)
+	}
+	return dir, nil
+}
+
+// references returns all tags and repo digests referring to the given image ID (sorted).
+func (r *storageRepositories) references(id v1.Hash) ([]string, []string) {
+	var tags, repoDigests []string
+	for _, refs := range r.Repositories {
+		for ref, refID := range refs {
+			if refID != id.String() {
+				continue
+			}
+			if strings.Contains(ref, "@") {
+				repoDigests = append(repoDigests, ref)
+			} else {
+				tags = append(tags, ref)
+			}
+		}
+	}
+	sort.Strings(tags)
+	sort.Strings(repoDigests)
+	return tags, repoDigests
+}
+
+// storageChainIDs returns the chain ID of each layer (which identifies the layer within the layer database), as
+// described by the OCI image spec: the chain ID of a layer is the digest of the chain ID of the layer below it
+// followed by a space and the diff ID of the layer.
+func storageChainIDs(diffIDs []v1.Hash) []string {
+	ids := make([]string, len(diffIDs))
+	var last string
+	for idx, diffID := range diffIDs {
+		if idx == 0 {
+			last = diffID.String()
+		} else {
+			last = fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(last+" "+diffID.String())))
+		}
+		ids[idx] = last
+	}
+	return ids
+}
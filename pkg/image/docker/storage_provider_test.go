@@ -0,0 +1,124 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+)
+
+// newTestStorageRoot lays out the given image within a new docker data root (as the overlay2 storage driver would),
+// tagged with the given references.
+func newTestStorageRoot(t *testing.T, img v1.Image, refs ...string) (string, v1.Hash) {
+	t.Helper()
+	root := t.TempDir()
+	imageDir := filepath.Join(root, "image", storageDriver)
+
+	id, err := img.ConfigName()
+	require.NoError(t, err)
+	rawConfig, err := img.RawConfigFile()
+	require.NoError(t, err)
+	configDir := filepath.Join(imageDir, "imagedb", "content", "sha256")
+	require.NoError(t, os.MkdirAll(configDir, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(configDir, id.Hex), rawConfig, 0644))
+
+	layers, err := img.Layers()
+	require.NoError(t, err)
+	config, err := img.ConfigFile()
+	require.NoError(t, err)
+	for idx, chainID := range storageChainIDs(config.RootFS.DiffIDs) {
+		cacheID := fmt.Sprintf("cache%d", idx)
+		layerDir := filepath.Join(imageDir, "layerdb", "sha256", chainID[len("sha256:"):])
+		require.NoError(t, os.MkdirAll(layerDir, 0755))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(layerDir, "cache-id"), []byte(cacheID), 0644))
+
+		diffDir := filepath.Join(root, storageDriver, cacheID, "diff")
+		require.NoError(t, os.MkdirAll(diffDir, 0755))
+		reader, err := layers[idx].Uncompressed()
+		require.NoError(t, err)
+		require.NoError(t, file.UntarToDirectory(reader, diffDir))
+		require.NoError(t, reader.Close())
+	}
+
+	repositories := storageRepositories{Repositories: make(map[string]map[string]string)}
+	for _, ref := range refs {
+		repositories.Repositories[ref] = map[string]string{ref: id.String()}
+	}
+	contents, err := json.Marshal(repositories)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(imageDir, "repositories.json"), contents, 0644))
+	return root, id
+}
+
+func TestStorageImageProvider_Provide(t *testing.T) {
+	img, err := random.Image(256, 3)
+	require.NoError(t, err)
+	root, id := newTestStorageRoot(t, img, "example.com/repo:v1", "nginx:latest")
+
+	expected := image.NewImage(img, t.TempDir())
+	require.NoError(t, expected.Read())
+
+	tests := []struct {
+		name     string
+		imageStr string
+	}{
+		{name: "tag", imageStr: "example.com/repo:v1"},
+		{name: "normalized docker hub reference", imageStr: "docker.io/library/nginx"},
+		{name: "full ID", imageStr: id.String()},
+		{name: "ID prefix", imageStr: id.Hex[:12]},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			generator := file.NewTempDirGenerator("stereoscope-docker-storage-test")
+			defer generator.Cleanup()
+
+			provided, err := NewProviderFromStorage(test.imageStr, root, generator).Provide(context.Background())
+			require.NoError(t, err)
+			require.NoError(t, provided.Read())
+
+			assert.Equal(t, id.String(), provided.Metadata.ID)
+			require.Len(t, provided.Layers, 3)
+			for idx, layer := range provided.Layers {
+				assert.Equal(t, expected.Layers[idx].Metadata.Digest, layer.Metadata.Digest)
+			}
+			assert.ElementsMatch(t, expected.SquashedTree().AllRealPaths(), provided.SquashedTree().AllRealPaths())
+			assert.Len(t, provided.Metadata.Tags, 2)
+		})
+	}
+}
+
+func TestStorageImageProvider_Provide_Errors(t *testing.T) {
+	img, err := random.Image(64, 1)
+	require.NoError(t, err)
+	root, _ := newTestStorageRoot(t, img, "example.com/repo:v1")
+
+	generator := file.NewTempDirGenerator("stereoscope-docker-storage-test")
+	defer generator.Cleanup()
+
+	tests := []struct {
+		name     string
+		imageStr string
+		root     string
+	}{
+		{name: "unknown image", imageStr: "example.com/repo:v2", root: root},
+		{name: "unknown image ID", imageStr: "sha256:0000000000000000000000000000000000000000000000000000000000000000", root: root},
+		{name: "no overlay2 metadata", imageStr: "example.com/repo:v1", root: t.TempDir()},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewProviderFromStorage(test.imageStr, test.root, generator).Provide(context.Background())
+			assert.Error(t, err)
+		})
+	}
+}
@@ -30,15 +30,6 @@ func NewProviderFromTarball(path string, tmpDirGen *file.TempDirGenerator) *Tarb
 
 // Provide an image object that represents the docker image tar at the configured location on disk.
 func (p *TarballImageProvider) Provide(_ context.Context, userMetadata ...image.AdditionalMetadata) (*image.Image, error) {
-	img, err := tarball.ImageFromPath(p.path, nil)
-	if err != nil {
-		// raise a more controlled error for when there are multiple images within the given tar (from https://github.com/anchore/grype/issues/215)
-		if err.Error() == "tarball must contain only a single image to be used with tarball.Image" {
-			return nil, ErrMultipleManifests
-		}
-		return nil, fmt.Errorf("unable to provide image from tarball: %w", err)
-	}
-
 	// make a best-effort to generate an OCI manifest and gets tags, but ultimately this should be considered optional
 	var rawOCIManifest []byte
 	var rawConfig []byte
@@ -50,13 +41,24 @@ func (p *TarballImageProvider) Provide(_ context.Context, userMetadata ...image.
 		log.Warnf("could not extract manifest: %+v", err)
 	}
 
+	img, err := p.image(theManifest)
+	if err != nil {
+		return nil, err
+	}
+
 	if theManifest != nil {
 		// given that we have a manifest, continue processing to get the tags and OCI manifest
 		metadata = append(metadata, image.WithTags(theManifest.allTags()...))
 
-		ociManifest, rawConfig, err = generateOCIManifest(p.path, theManifest)
-		if err != nil {
-			log.Warnf("failed to generate OCI manifest from docker archive: %+v", err)
+		if archiveImg, ok := img.(*archiveImage); ok {
+			// the manifest of the archive image describes the actual layer blobs
+			metadata = append(metadata, image.WithManifest(archiveImg.rawManifest))
+			rawConfig = archiveImg.rawConfig
+		} else {
+			ociManifest, rawConfig, err = generateOCIManifest(p.path, theManifest)
+			if err != nil {
+				log.Warnf("failed to generate OCI manifest from docker archive: %+v", err)
+			}
 		}
 
 		// we may have the config available, use it
@@ -84,3 +86,28 @@ func (p *TarballImageProvider) Provide(_ context.Context, userMetadata ...image.
 
 	return image.NewImage(img, contentTempDir, metadata...), nil
 }
+
+// image reads the docker image tar with the GCR lib, unless the archive cannot be read faithfully by the GCR lib (see
+// newArchiveImageIfNeeded), such as archives written by "podman save" with compressed layers.
+func (p *TarballImageProvider) image(theManifest *dockerManifest) (v1.Image, error) {
+	if theManifest != nil {
+		img, err := newArchiveImageIfNeeded(p.path, theManifest)
+		if err != nil {
+			return nil, fmt.Errorf("unable to provide image from tarball: %w", err)
+		}
+		if img != nil {
+			log.Debugf("reading docker archive=%q layers directly from the archive entries", p.path)
+			return img, nil
+		}
+	}
+
+	img, err := tarball.ImageFromPath(p.path, nil)
+	if err != nil {
+		// raise a more controlled error for when there are multiple images within the given tar (from https://github.com/anchore/grype/issues/215)
+		if err.Error() == "tarball must contain only a single image to be used with tarball.Image" {
+			return nil, ErrMultipleManifests
+		}
+		return nil, fmt.Errorf("unable to provide image from tarball: %w", err)
+	}
+	return img, nil
+}
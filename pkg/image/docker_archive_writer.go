@@ -0,0 +1,45 @@
+package image
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+// untaggedArchiveRepository is the (arbitrary) repository used to reference an untagged image within a docker archive.
+const untaggedArchiveRepository = "stereoscope"
+
+// WriteDockerArchive serializes the image to the given writer in the `docker save` tarball format (a manifest.json,
+// the image config, and each layer tar), which can be re-imported with `docker load`. Each image tag is recorded in
+// the archive manifest, an image without tags is loaded untagged.
+func (i *Image) WriteDockerArchive(w io.Writer) error {
+	if err := i.requireImageContent(); err != nil {
+		return fmt.Errorf("unable to write image: %w", err)
+	}
+
+	refToImage := make(map[name.Reference]v1.Image)
+	for _, tag := range i.Metadata.Tags {
+		refToImage[tag] = i.image
+	}
+
+	if len(refToImage) == 0 {
+		digest, err := i.image.Digest()
+		if err != nil {
+			return fmt.Errorf("unable to get image digest: %w", err)
+		}
+		// a digest reference is not recorded as a repo tag, however, it is still needed to include the image
+		ref, err := name.NewDigest(fmt.Sprintf("%s@%s", untaggedArchiveRepository, digest))
+		if err != nil {
+			return fmt.Errorf("unable to create image reference: %w", err)
+		}
+		refToImage[ref] = i.image
+	}
+
+	if err := tarball.MultiRefWrite(refToImage, w); err != nil {
+		return fmt.Errorf("unable to write docker archive: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package image
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImage_WriteDockerArchive(t *testing.T) {
+	tests := []struct {
+		name     string
+		tags     []string
+		wantTags []string
+	}{
+		{
+			name:     "tagged image",
+			tags:     []string{"anchore/example:1.0", "anchore/example:latest"},
+			wantTags: []string{"anchore/example:1.0", "anchore/example:latest"},
+		},
+		{
+			name: "untagged image",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			randomImage, err := random.Image(64, 2)
+			require.NoError(t, err)
+
+			img := NewImage(randomImage, t.TempDir(), WithTags(test.tags...))
+			require.NoError(t, img.Read())
+
+			buf := &bytes.Buffer{}
+			require.NoError(t, img.WriteDockerArchive(buf))
+
+			opener := func() (io.ReadCloser, error) {
+				return ioutil.NopCloser(bytes.NewReader(buf.Bytes())), nil
+			}
+
+			manifest, err := tarball.LoadManifest(opener)
+			require.NoError(t, err)
+			require.Len(t, manifest, 1)
+			assert.ElementsMatch(t, test.wantTags, manifest[0].RepoTags)
+
+			var tag *name.Tag
+			if len(test.tags) > 0 {
+				parsed, err := name.NewTag(test.tags[0])
+				require.NoError(t, err)
+				tag = &parsed
+			}
+			written, err := tarball.Image(opener, tag)
+			require.NoError(t, err)
+
+			roundTrip := NewImage(written, t.TempDir())
+			require.NoError(t, roundTrip.Read())
+			assert.Equal(t, img.Metadata.ID, roundTrip.Metadata.ID)
+			assert.True(t, img.SquashedTree().Equal(roundTrip.SquashedTree()))
+		})
+	}
+}
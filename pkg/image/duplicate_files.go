@@ -0,0 +1,91 @@
+package image
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree/filenode"
+)
+
+// DuplicateFileSet is a group of regular files within the squash tree that all have the same content.
+type DuplicateFileSet struct {
+	// Digest is the content digest shared by all files in the set (e.g. "sha256:abc...")
+	Digest string
+	// Size is the size in bytes of the content of a single file in the set
+	Size int64
+	// Paths are the paths of all files in the set, sorted by path
+	Paths []file.Path
+	// WastedBytes is the number of bytes that could be saved by storing the content only once
+	WastedBytes int64
+}
+
+// DuplicateFileReport summarizes all duplicate content found within the squash tree.
+type DuplicateFileReport struct {
+	// Sets are all groups of files with the same content, ordered by the most wasted bytes first
+	Sets []DuplicateFileSet
+	// WastedBytes is the total wasted bytes over all sets
+	WastedBytes int64
+}
+
+// DuplicateFiles groups all non-empty regular files within the squash tree by content digest and reports every group
+// with more than one file. Hardlinks share the content of the file they refer to, so are not considered duplicates.
+// Digests recorded while indexing (see WithFileDigests) are used when available, otherwise file contents are read
+// and the resulting digest is recorded in the file catalog.
+func (i *Image) DuplicateFiles() (*DuplicateFileReport, error) {
+	squash, err := i.imageSquashTree()
+	if err != nil {
+		return nil, fmt.Errorf("unable to find duplicate files: %w", err)
+	}
+
+	sets := make(map[string]*DuplicateFileSet)
+	for _, n := range squash.Reader().Nodes() {
+		fn, ok := n.(*filenode.FileNode)
+		if !ok || fn.Reference == nil {
+			continue
+		}
+		entry, err := i.FileCatalog.Get(*fn.Reference)
+		if err != nil {
+			// implicitly added parent directories have no catalog entry
+			continue
+		}
+		if file.Type(entry.Metadata.TypeFlag) != file.TypeReg || entry.Metadata.Size == 0 {
+			continue
+		}
+
+		digest, err := i.fileDigest(*fn.Reference, entry)
+		if err != nil {
+			return nil, err
+		}
+
+		set, ok := sets[digest]
+		if !ok {
+			set = &DuplicateFileSet{
+				Digest: digest,
+				Size:   entry.Metadata.Size,
+			}
+			sets[digest] = set
+		}
+		set.Paths = append(set.Paths, fn.RealPath)
+	}
+
+	report := &DuplicateFileReport{}
+	for _, set := range sets {
+		if len(set.Paths) < 2 {
+			continue
+		}
+		sort.Slice(set.Paths, func(a, b int) bool {
+			return set.Paths[a] < set.Paths[b]
+		})
+		set.WastedBytes = set.Size * int64(len(set.Paths)-1)
+		report.WastedBytes += set.WastedBytes
+		report.Sets = append(report.Sets, *set)
+	}
+	sort.Slice(report.Sets, func(a, b int) bool {
+		if report.Sets[a].WastedBytes != report.Sets[b].WastedBytes {
+			return report.Sets[a].WastedBytes > report.Sets[b].WastedBytes
+		}
+		return report.Sets[a].Digest < report.Sets[b].Digest
+	})
+	return report, nil
+}
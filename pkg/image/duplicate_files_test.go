@@ -0,0 +1,53 @@
+package image
+
+import (
+	"archive/tar"
+	"strings"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImage_DuplicateFiles(t *testing.T) {
+	img := newTestImageFromLayers(t, []v1.Layer{
+		newTestTarLayer(t,
+			testTarEntry{name: "a/one.txt", contents: "duplicate content"},
+			testTarEntry{name: "a/two.txt", contents: "duplicate content"},
+			testTarEntry{name: "a/unique.txt", contents: "unique"},
+			testTarEntry{name: "a/empty1"},
+			testTarEntry{name: "a/empty2"},
+			testTarEntry{name: "a/hardlink", linkname: "a/unique.txt", typeflag: tar.TypeLink},
+			testTarEntry{name: "b/x", contents: "xx"},
+			testTarEntry{name: "b/removed", contents: "xx"},
+		),
+		newTestTarLayer(t,
+			testTarEntry{name: "b/.wh.removed"},
+			testTarEntry{name: "c/three.txt", contents: "duplicate content"},
+			testTarEntry{name: "c/x", contents: "xx"},
+		),
+	})
+
+	report, err := img.DuplicateFiles()
+	require.NoError(t, err)
+
+	require.Len(t, report.Sets, 2)
+	assert.Equal(t, []file.Path{"/a/one.txt", "/a/two.txt", "/c/three.txt"}, report.Sets[0].Paths)
+	assert.Equal(t, int64(len("duplicate content")), report.Sets[0].Size)
+	assert.Equal(t, int64(2*len("duplicate content")), report.Sets[0].WastedBytes)
+	assert.Equal(t, []file.Path{"/b/x", "/c/x"}, report.Sets[1].Paths)
+	assert.Equal(t, int64(2), report.Sets[1].WastedBytes)
+	assert.Equal(t, int64(2*len("duplicate content")+2), report.WastedBytes)
+
+	expected, err := file.Digest(strings.NewReader("xx"))
+	require.NoError(t, err)
+	assert.Equal(t, expected, report.Sets[1].Digest)
+}
+
+func TestImage_DuplicateFiles_SquashFailure(t *testing.T) {
+	_, err := newTestUnsquashableImage(t).DuplicateFiles()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unable to squash layers")
+}
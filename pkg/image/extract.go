@@ -0,0 +1,161 @@
+package image
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree"
+)
+
+// ExtractOption is a configuration option that controls how the image filesystem is written to disk (see
+// Image.Extract).
+type ExtractOption func(*extractConfig)
+
+// extractConfig is the collection of all extract options that have been applied.
+type extractConfig struct {
+	// paths are the glob patterns selecting what is extracted (everything when empty).
+	paths []string
+	// ownership indicates that the uid/gid of each file should be applied (after ownershipMap, when not nil).
+	ownership    bool
+	ownershipMap func(uid, gid int) (int, int)
+	// untar are the options for writing the squashed filesystem (as a tar) to disk.
+	untar file.UntarOptions
+}
+
+func newExtractConfig(opts ...ExtractOption) extractConfig {
+	cfg := extractConfig{
+		untar: file.UntarOptions{
+			Symlinks:            file.SymlinksRootRelative,
+			PreservePermissions: true,
+			Hardlinks:           true,
+		},
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	cfg.untar.PreserveOwnership = cfg.ownership
+	return cfg
+}
+
+// WithExtractPaths only extracts the files matching any of the given glob patterns (as with filetree.FilesByGlob, so
+// directories are not matched themselves, e.g. use "/etc/**" for all files below "/etc"), the files that matching
+// symlinks resolve to, and the parent directories of all of these files.
+func WithExtractPaths(patterns ...string) ExtractOption {
+	return func(c *extractConfig) {
+		c.paths = append(c.paths, patterns...)
+	}
+}
+
+// WithExtractSymlinks describes how symlinks are written (file.SymlinksRootRelative by default, so no extracted
+// symlink resolves into the host filesystem).
+func WithExtractSymlinks(policy file.SymlinkPolicy) ExtractOption {
+	return func(c *extractConfig) {
+		c.untar.Symlinks = policy
+	}
+}
+
+// WithExtractCaseCollisions describes how paths colliding under case-insensitive comparison are written (e.g. when
+// extracting onto macOS or Windows), by default all paths are written as-is.
+func WithExtractCaseCollisions(policy file.CaseCollisionPolicy) ExtractOption {
+	return func(c *extractConfig) {
+		c.untar.CaseCollisions = policy
+	}
+}
+
+// WithExtractOwnership applies the uid/gid of each file (typically requires privileges), mapped by the given function
+// when not nil (e.g. to shift the IDs into the range of a user namespace). By default files are owned by the current
+// user.
+func WithExtractOwnership(mapping func(uid, gid int) (int, int)) ExtractOption {
+	return func(c *extractConfig) {
+		c.ownership = true
+		c.ownershipMap = mapping
+	}
+}
+
+// WithExtractXattrs applies the extended attributes (including POSIX ACLs) of each file.
+func WithExtractXattrs() ExtractOption {
+	return func(c *extractConfig) {
+		c.untar.PreserveXattrs = true
+	}
+}
+
+// WithExtractStrict fails the extraction on the first piece of file metadata that cannot be applied (instead of
+// recording it on the returned report).
+func WithExtractStrict() ExtractOption {
+	return func(c *extractConfig) {
+		c.untar.Strict = true
+	}
+}
+
+// Extract writes the squashed filesystem of the (already read) image to the given directory (a programmatic
+// `crane export`), with the permissions of each file, symlinks, and hardlinks. All metadata that could not be applied
+// (e.g. ownership when running unprivileged) and all links that were not written are recorded on the returned report.
+// Whiteouts are already applied, and device files and named pipes are not written.
+func (i *Image) Extract(destDir string, opts ...ExtractOption) (*file.UntarReport, error) {
+	cfg := newExtractConfig(opts...)
+	if err := i.requireImageContent(); err != nil {
+		return nil, fmt.Errorf("unable to extract image: %w", err)
+	}
+
+	squash, err := i.imageSquashTree()
+	if err != nil {
+		return nil, fmt.Errorf("unable to extract image: %w", err)
+	}
+
+	include, err := extractPathFilter(squash, cfg.paths)
+	if err != nil {
+		return nil, err
+	}
+
+	var mapHeader func(*tar.Header)
+	if cfg.ownershipMap != nil {
+		mapHeader = func(header *tar.Header) {
+			header.Uid, header.Gid = cfg.ownershipMap(header.Uid, header.Gid)
+		}
+	}
+
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return nil, fmt.Errorf("unable to create extraction destination=%q: %w", destDir, err)
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(i.writeFlattenedTar(writer, include, mapHeader))
+	}()
+	defer reader.Close()
+
+	report, err := file.UntarToDirectoryWithOptions(reader, destDir, cfg.untar)
+	if err != nil {
+		return report, fmt.Errorf("unable to extract image to destination=%q: %w", destDir, err)
+	}
+	return report, nil
+}
+
+// extractPathFilter returns a function selecting the tree paths matching the given glob patterns, the paths that the
+// matches resolve to, and all of their parent directories (nil when there are no patterns).
+func extractPathFilter(tree *filetree.FileTree, patterns []string) (func(file.Path) bool, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+
+	selected := make(map[file.Path]struct{})
+	for _, pattern := range patterns {
+		results, err := tree.FilesByGlob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("unable to match extraction pattern=%q: %w", pattern, err)
+		}
+		for _, result := range results {
+			for _, p := range append(result.MatchPath.AllPaths(), result.RealPath.AllPaths()...) {
+				selected[p] = struct{}{}
+			}
+		}
+	}
+
+	return func(p file.Path) bool {
+		_, ok := selected[p]
+		return ok
+	}, nil
+}
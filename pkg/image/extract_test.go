@@ -0,0 +1,167 @@
+//go:build !windows
+// +build !windows
+
+package image
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestExtractImage(t *testing.T) *Image {
+	return newTestImageFromLayers(t, []v1.Layer{
+		newTestTarLayer(t,
+			testTarEntry{name: "bin/", typeflag: tar.TypeDir, mode: 0755},
+			testTarEntry{name: "bin/tool", contents: "tool", mode: 04755},
+			testTarEntry{name: "bin/alias", typeflag: tar.TypeLink, linkname: "bin/tool"},
+			testTarEntry{name: "bin/sh", typeflag: tar.TypeSymlink, linkname: "/bin/tool"},
+			testTarEntry{name: "etc/", typeflag: tar.TypeDir, mode: 0755},
+			testTarEntry{name: "etc/shadow", contents: "secret", mode: 0600},
+			testTarEntry{name: "etc/removed", contents: "removed"},
+			testTarEntry{name: "tmp/", typeflag: tar.TypeDir, mode: 01777},
+		),
+		newTestTarLayer(t,
+			testTarEntry{name: "etc/.wh.removed"},
+			testTarEntry{name: "usr/share/doc/readme", contents: "readme"},
+		),
+	})
+}
+
+func TestImage_Extract(t *testing.T) {
+	img := newTestExtractImage(t)
+
+	dst := t.TempDir()
+	report, err := img.Extract(dst)
+	require.NoError(t, err)
+	assert.Empty(t, report.DroppedSymlinks)
+	assert.Empty(t, report.DroppedHardlinks)
+
+	expectedModes := map[string]os.FileMode{
+		"bin":        os.ModeDir | 0755,
+		"bin/tool":   os.ModeSetuid | 0755,
+		"etc":        os.ModeDir | 0755,
+		"etc/shadow": 0600,
+		"tmp":        os.ModeDir | os.ModeSticky | 0777,
+		// implied by the layer tar
+		"usr/share/doc": os.ModeDir | 0755,
+	}
+	for name, mode := range expectedModes {
+		fi, err := os.Lstat(filepath.Join(dst, filepath.FromSlash(name)))
+		require.NoError(t, err, name)
+		assert.Equal(t, mode, fi.Mode(), name)
+	}
+
+	contents, err := ioutil.ReadFile(filepath.Join(dst, "usr", "share", "doc", "readme"))
+	require.NoError(t, err)
+	assert.Equal(t, "readme", string(contents))
+
+	// whiteouts are applied
+	_, err = os.Lstat(filepath.Join(dst, "etc", "removed"))
+	assert.True(t, os.IsNotExist(err))
+
+	// hardlinks share the file
+	tool, err := os.Stat(filepath.Join(dst, "bin", "tool"))
+	require.NoError(t, err)
+	alias, err := os.Stat(filepath.Join(dst, "bin", "alias"))
+	require.NoError(t, err)
+	assert.True(t, os.SameFile(tool, alias))
+
+	// symlinks resolve within the destination
+	target, err := os.Readlink(filepath.Join(dst, "bin", "sh"))
+	require.NoError(t, err)
+	assert.Equal(t, "tool", target)
+}
+
+func TestImage_Extract_SquashFailure(t *testing.T) {
+	img := newTestUnsquashableImage(t)
+
+	dst := t.TempDir()
+	_, err := img.Extract(dst)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unable to squash layers")
+
+	// nothing is written for an image that cannot be squashed
+	entries, err := ioutil.ReadDir(dst)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestImage_Extract_Paths(t *testing.T) {
+	img := newTestExtractImage(t)
+
+	tests := []struct {
+		name     string
+		patterns []string
+		expected []string
+	}{
+		{
+			name:     "files",
+			patterns: []string{"/etc/*"},
+			expected: []string{"etc", "etc/shadow"},
+		},
+		{
+			name:     "directory",
+			patterns: []string{"/usr/share/**"},
+			expected: []string{"usr", "usr/share", "usr/share/doc", "usr/share/doc/readme"},
+		},
+		{
+			name:     "directories are not matched",
+			patterns: []string{"/usr/share"},
+		},
+		{
+			name:     "symlink and multiple patterns",
+			patterns: []string{"/bin/sh", "/etc/shadow"},
+			expected: []string{"bin", "bin/sh", "bin/tool", "etc", "etc/shadow"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dst := t.TempDir()
+			_, err := img.Extract(dst, WithExtractPaths(test.patterns...))
+			require.NoError(t, err)
+
+			var actual []string
+			require.NoError(t, filepath.Walk(dst, func(p string, _ os.FileInfo, err error) error {
+				if err != nil || p == dst {
+					return err
+				}
+				rel, err := filepath.Rel(dst, p)
+				actual = append(actual, filepath.ToSlash(rel))
+				return err
+			}))
+			assert.ElementsMatch(t, test.expected, actual)
+		})
+	}
+}
+
+func TestImage_Extract_Ownership(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("applying ownership requires privileges")
+	}
+	img := newTestExtractImage(t)
+
+	dst := t.TempDir()
+	report, err := img.Extract(dst, WithExtractOwnership(func(uid, gid int) (int, int) {
+		return uid + 100000, gid + 200000
+	}))
+	require.NoError(t, err)
+	assert.False(t, report.HasUnapplied())
+
+	fi, err := os.Lstat(filepath.Join(dst, "bin", "tool"))
+	require.NoError(t, err)
+	stat, ok := fi.Sys().(*syscall.Stat_t)
+	require.True(t, ok)
+	assert.Equal(t, uint32(100000), stat.Uid)
+	assert.Equal(t, uint32(200000), stat.Gid)
+	// the setuid bit survives the ownership change
+	assert.Equal(t, os.ModeSetuid|0755, fi.Mode())
+}
@@ -1,21 +1,60 @@
 package image
 
 import (
-	"fmt"
 	"io"
+	"os"
+	"sort"
 	"sync"
 
 	"github.com/anchore/stereoscope/pkg/file"
 )
 
-var ErrFileNotFound = fmt.Errorf("could not find file")
-
 // FileCatalog represents all file metadata and source tracing for all files contained within the image layer
 // blobs (i.e. everything except for the image index/manifest/metadata files).
+//
+// Entries are stored in columnar form: each entry is a row shared by a set of parallel columns, and all indexes refer
+// to rows (not entries). Compared to a map of entries this avoids per-entry allocations, and since the indexes only hold
+// row numbers (and the integer columns hold no pointers) most of the catalog is never scanned by the garbage collector,
+// which matters for images with millions of files. The reference and metadata columns still hold pointers (paths,
+// strings, and maps). Rarely set fields (content origins and hardlink targets) are stored sparsely.
 type FileCatalog struct {
 	sync.RWMutex
-	catalog    map[file.ID]FileCatalogEntry
-	byMIMEType map[string][]file.ID
+	// rows maps each file ID to the row of the entry within the columns
+	rows map[file.ID]int32
+	// columns, one value per row
+	refs     []file.Reference
+	metadata []file.Metadata
+	layers   []uint32
+	contents []file.Opener
+	// nextByPath chains rows with the same path (in the order added, -1 terminates the chain), which avoids an
+	// allocation per path for the path index (the vast majority of paths only have a single entry)
+	nextByPath []int32
+	// added is the sequence in which each row was last added (see sortedEntries)
+	added    []uint64
+	addCount uint64
+	// sparse columns
+	contentOrigins  map[int32]*Layer
+	hardlinkTargets map[int32]file.Reference
+	// layerTable holds every distinct layer referenced by an entry (the layers column refers to this table)
+	layerTable   []*Layer
+	layerIndexes map[*Layer]uint32
+	// indexes (byPath refers to the first row of each path chain), the rows of all other indexes are not kept in order
+	// (see removeRow)
+	byPath     map[string]int32
+	byDigest   map[string][]int32
+	byMIMEType map[string][]int32
+	byUserID   map[int][]int32
+	byGroupID  map[int][]int32
+	byLayer    [][]int32
+	// positions of each row within the rows of each index (-1 when not indexed), so replacing an entry is constant time
+	// regardless of how many entries share the same key (e.g. all files owned by root)
+	digestPositions   []int32
+	mimeTypePositions []int32
+	userIDPositions   []int32
+	groupIDPositions  []int32
+	layerPositions    []int32
+	// readAudit is notified of every content read (see WithReadAudit)
+	readAudit *readAudit
 }
 
 // FileCatalogEntry represents all stored metadata for a single file reference.
@@ -24,13 +63,35 @@ type FileCatalogEntry struct {
 	Metadata file.Metadata
 	Layer    *Layer
 	Contents file.Opener
+	// ContentOrigin is the lower layer that originally introduced the same content for this path, set only when the
+	// file differs from the file it replaced by metadata alone (see WithMetadataOnlyChangeDetection).
+	ContentOrigin *Layer
+	// HardlinkTarget is the file that a hardlink entry shares content with (nil for all other entries or when the
+	// hardlink could not be resolved). Contents for a resolved hardlink entry are the contents of this file.
+	HardlinkTarget *file.Reference
+}
+
+// ContentLayer returns the layer the file contents should be attributed to: the layer that originally introduced the
+// content if the entry is a metadata-only change, otherwise the layer containing the entry.
+func (e FileCatalogEntry) ContentLayer() *Layer {
+	if e.ContentOrigin != nil {
+		return e.ContentOrigin
+	}
+	return e.Layer
 }
 
 // NewFileCatalog returns an empty FileCatalog.
 func NewFileCatalog() FileCatalog {
 	return FileCatalog{
-		catalog:    make(map[file.ID]FileCatalogEntry),
-		byMIMEType: make(map[string][]file.ID),
+		rows:            make(map[file.ID]int32),
+		contentOrigins:  make(map[int32]*Layer),
+		hardlinkTargets: make(map[int32]file.Reference),
+		layerIndexes:    make(map[*Layer]uint32),
+		byPath:          make(map[string]int32),
+		byDigest:        make(map[string][]int32),
+		byMIMEType:      make(map[string][]int32),
+		byUserID:        make(map[int][]int32),
+		byGroupID:       make(map[int][]int32),
 	}
 }
 
@@ -39,24 +100,303 @@ func NewFileCatalog() FileCatalog {
 func (c *FileCatalog) Add(f file.Reference, m file.Metadata, l *Layer, opener file.Opener) {
 	c.Lock()
 	defer c.Unlock()
+
+	layerIdx := c.layerIndex(l)
+	row, exists := c.rows[f.ID()]
+	if exists {
+		c.unindex(row)
+		c.refs[row] = f
+		c.metadata[row] = m
+		c.layers[row] = layerIdx
+		c.contents[row] = opener
+		delete(c.contentOrigins, row)
+		delete(c.hardlinkTargets, row)
+		c.added[row] = c.addCount
+	} else {
+		row = int32(len(c.refs))
+		c.rows[f.ID()] = row
+		c.refs = append(c.refs, f)
+		c.metadata = append(c.metadata, m)
+		c.layers = append(c.layers, layerIdx)
+		c.contents = append(c.contents, opener)
+		c.nextByPath = append(c.nextByPath, -1)
+		c.added = append(c.added, c.addCount)
+		c.digestPositions = append(c.digestPositions, -1)
+		c.mimeTypePositions = append(c.mimeTypePositions, -1)
+		c.userIDPositions = append(c.userIDPositions, -1)
+		c.groupIDPositions = append(c.groupIDPositions, -1)
+		c.layerPositions = append(c.layerPositions, -1)
+	}
+	c.addCount++
+	c.index(row)
+}
+
+// layerIndex returns the index of the given layer within the layer table, adding the layer if needed.
+func (c *FileCatalog) layerIndex(l *Layer) uint32 {
+	if idx, ok := c.layerIndexes[l]; ok {
+		return idx
+	}
+	idx := uint32(len(c.layerTable))
+	c.layerTable = append(c.layerTable, l)
+	c.layerIndexes[l] = idx
+	c.byLayer = append(c.byLayer, nil)
+	return idx
+}
+
+// index adds the given row to all indexes.
+func (c *FileCatalog) index(row int32) {
+	m := &c.metadata[row]
+	c.indexPath(row)
 	if m.MIMEType != "" {
 		// an empty MIME type means that we didn't have the contents of the file to determine the MIME type. If we have
 		// the contents and the MIME type could not be determined then the default value is application/octet-stream.
-		c.byMIMEType[m.MIMEType] = append(c.byMIMEType[m.MIMEType], f.ID())
+		c.byMIMEType[m.MIMEType] = appendRow(c.byMIMEType[m.MIMEType], row, c.mimeTypePositions)
+	}
+	c.indexDigest(row)
+	c.byUserID[m.UserID] = appendRow(c.byUserID[m.UserID], row, c.userIDPositions)
+	c.byGroupID[m.GroupID] = appendRow(c.byGroupID[m.GroupID], row, c.groupIDPositions)
+	c.byLayer[c.layers[row]] = appendRow(c.byLayer[c.layers[row]], row, c.layerPositions)
+}
+
+// indexDigest adds the given row to the digest index (if the entry has a digest).
+func (c *FileCatalog) indexDigest(row int32) {
+	if digest := c.metadata[row].Digest; digest != "" {
+		c.byDigest[digest] = appendRow(c.byDigest[digest], row, c.digestPositions)
+	}
+}
+
+// unindex removes the given row from all indexes.
+func (c *FileCatalog) unindex(row int32) {
+	m := &c.metadata[row]
+	c.unindexPath(row)
+	removeIndexRow(c.byMIMEType, m.MIMEType, row, c.mimeTypePositions)
+	removeIndexRow(c.byDigest, m.Digest, row, c.digestPositions)
+	removeOwnerIndexRow(c.byUserID, m.UserID, row, c.userIDPositions)
+	removeOwnerIndexRow(c.byGroupID, m.GroupID, row, c.groupIDPositions)
+	c.byLayer[c.layers[row]] = removeRow(c.byLayer[c.layers[row]], row, c.layerPositions)
+}
+
+// indexPath appends the given row to the chain of rows for the same path.
+func (c *FileCatalog) indexPath(row int32) {
+	p := string(c.refs[row].RealPath)
+	c.nextByPath[row] = -1
+	last, ok := c.byPath[p]
+	if !ok {
+		c.byPath[p] = row
+		return
+	}
+	for c.nextByPath[last] >= 0 {
+		last = c.nextByPath[last]
+	}
+	c.nextByPath[last] = row
+}
+
+// unindexPath removes the given row from the chain of rows for the same path.
+func (c *FileCatalog) unindexPath(row int32) {
+	p := string(c.refs[row].RealPath)
+	first, ok := c.byPath[p]
+	if !ok {
+		return
+	}
+	if first == row {
+		if next := c.nextByPath[row]; next >= 0 {
+			c.byPath[p] = next
+		} else {
+			delete(c.byPath, p)
+		}
+		return
 	}
-	c.catalog[f.ID()] = FileCatalogEntry{
-		File:     f,
-		Metadata: m,
-		Layer:    l,
-		Contents: opener,
+	for prev := first; c.nextByPath[prev] >= 0; prev = c.nextByPath[prev] {
+		if c.nextByPath[prev] == row {
+			c.nextByPath[prev] = c.nextByPath[row]
+			return
+		}
 	}
 }
 
+func removeIndexRow(index map[string][]int32, key string, row int32, positions []int32) {
+	rows, ok := index[key]
+	if !ok {
+		return
+	}
+	if rows = removeRow(rows, row, positions); len(rows) == 0 {
+		delete(index, key)
+	} else {
+		index[key] = rows
+	}
+}
+
+func removeOwnerIndexRow(index map[int][]int32, id int, row int32, positions []int32) {
+	rows, ok := index[id]
+	if !ok {
+		return
+	}
+	if rows = removeRow(rows, row, positions); len(rows) == 0 {
+		delete(index, id)
+	} else {
+		index[id] = rows
+	}
+}
+
+// appendRow adds the row to the given index rows, recording the position of the row.
+func appendRow(rows []int32, row int32, positions []int32) []int32 {
+	positions[row] = int32(len(rows))
+	return append(rows, row)
+}
+
+// removeRow removes the row from the given index rows in constant time, by moving the last row into the position of
+// the removed row (so index rows are not in the order the entries were added, see sortedEntries).
+func removeRow(rows []int32, row int32, positions []int32) []int32 {
+	pos := positions[row]
+	if pos < 0 || int(pos) >= len(rows) || rows[pos] != row {
+		return rows
+	}
+	last := rows[len(rows)-1]
+	rows[pos] = last
+	positions[last] = pos
+	positions[row] = -1
+	return rows[:len(rows)-1]
+}
+
+// entry assembles the FileCatalogEntry for the given row.
+func (c *FileCatalog) entry(row int32) FileCatalogEntry {
+	entry := FileCatalogEntry{
+		File:          c.refs[row],
+		Metadata:      c.metadata[row],
+		Layer:         c.layerTable[c.layers[row]],
+		Contents:      c.contents[row],
+		ContentOrigin: c.contentOrigins[row],
+	}
+	if target, ok := c.hardlinkTargets[row]; ok {
+		entry.HardlinkTarget = &target
+	}
+	return entry
+}
+
+// sortedEntries assembles the FileCatalogEntry for each of the given index rows, in the order the entries were added
+// (where overwriting an entry adds the entry again).
+func (c *FileCatalog) sortedEntries(rows []int32) []FileCatalogEntry {
+	sorted := append([]int32(nil), rows...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return c.added[sorted[i]] < c.added[sorted[j]]
+	})
+	return c.entries(sorted)
+}
+
+// entries assembles the FileCatalogEntry for each of the given rows.
+func (c *FileCatalog) entries(rows []int32) []FileCatalogEntry {
+	if len(rows) == 0 {
+		return nil
+	}
+	entries := make([]FileCatalogEntry, 0, len(rows))
+	for _, row := range rows {
+		entries = append(entries, c.entry(row))
+	}
+	return entries
+}
+
+// setDigest records the content digest for an existing catalog entry.
+func (c *FileCatalog) setDigest(f file.Reference, digest string) {
+	c.Lock()
+	defer c.Unlock()
+	row, ok := c.rows[f.ID()]
+	if !ok {
+		return
+	}
+	removeIndexRow(c.byDigest, c.metadata[row].Digest, row, c.digestPositions)
+	c.metadata[row].Digest = digest
+	c.indexDigest(row)
+}
+
+// setReadAudit sets the auditor notified of every content read (nil disables auditing).
+func (c *FileCatalog) setReadAudit(audit *readAudit) {
+	c.Lock()
+	defer c.Unlock()
+	c.readAudit = audit
+}
+
+// setContentOrigin records the layer that originally introduced the content for an existing catalog entry.
+func (c *FileCatalog) setContentOrigin(f file.Reference, l *Layer) {
+	c.Lock()
+	defer c.Unlock()
+	row, ok := c.rows[f.ID()]
+	if !ok {
+		return
+	}
+	if l == nil {
+		delete(c.contentOrigins, row)
+		return
+	}
+	c.contentOrigins[row] = l
+}
+
+// bindHardlink shares the contents (and digest) of the target entry with the given hardlink entry. If the target is
+// itself a resolved hardlink, the link is bound to the original file instead.
+func (c *FileCatalog) bindHardlink(link, target file.Reference) {
+	c.Lock()
+	defer c.Unlock()
+	row, ok := c.rows[link.ID()]
+	if !ok {
+		return
+	}
+	targetRow, ok := c.rows[target.ID()]
+	if !ok {
+		return
+	}
+	if original, ok := c.hardlinkTargets[targetRow]; ok {
+		target = original
+	}
+	c.hardlinkTargets[row] = target
+	c.contents[row] = c.contents[targetRow]
+
+	removeIndexRow(c.byDigest, c.metadata[row].Digest, row, c.digestPositions)
+	c.metadata[row].Digest = c.metadata[targetRow].Digest
+	c.indexDigest(row)
+}
+
+// addSubsetTo adds the entries belonging to the given layers (the keys of the given mapping) to the given catalog, with
+// each entry attributed to the layer it maps to. File contents are shared with this catalog. Content origins and
+// hardlink targets outside of the given layers are dropped. Reads are audited the same as this catalog.
+func (c *FileCatalog) addSubsetTo(subset *FileCatalog, layers map[*Layer]*Layer) {
+	c.RLock()
+	defer c.RUnlock()
+
+	subset.readAudit = c.readAudit
+	for row, ref := range c.refs {
+		l, ok := layers[c.layerTable[c.layers[row]]]
+		if !ok {
+			continue
+		}
+		subset.Add(ref, c.metadata[row], l, c.contents[row])
+	}
+	for row, origin := range c.contentOrigins {
+		if l, ok := layers[origin]; ok {
+			subset.setContentOrigin(c.refs[row], l)
+		}
+	}
+	for row, target := range c.hardlinkTargets {
+		linkRow, ok := subset.rows[c.refs[row].ID()]
+		if !ok {
+			continue
+		}
+		if _, ok := subset.rows[target.ID()]; ok {
+			subset.hardlinkTargets[linkRow] = target
+		}
+	}
+}
+
+// Len returns the number of entries within the catalog.
+func (c *FileCatalog) Len() int {
+	c.RLock()
+	defer c.RUnlock()
+	return len(c.rows)
+}
+
 // Exists indicates if the given file reference exists in the catalog.
 func (c *FileCatalog) Exists(f file.Reference) bool {
 	c.RLock()
 	defer c.RUnlock()
-	_, ok := c.catalog[f.ID()]
+	_, ok := c.rows[f.ID()]
 	return ok
 }
 
@@ -65,45 +405,167 @@ func (c *FileCatalog) Exists(f file.Reference) bool {
 func (c *FileCatalog) Get(f file.Reference) (FileCatalogEntry, error) {
 	c.RLock()
 	defer c.RUnlock()
-	value, ok := c.catalog[f.ID()]
+	row, ok := c.rows[f.ID()]
 	if !ok {
 		return FileCatalogEntry{}, ErrFileNotFound
 	}
-	return value, nil
+	return c.entry(row), nil
 }
 
 func (c *FileCatalog) GetByMIMEType(mType string) ([]FileCatalogEntry, error) {
 	c.RLock()
 	defer c.RUnlock()
-	fileIDs, ok := c.byMIMEType[mType]
+	return c.sortedEntries(c.byMIMEType[mType]), nil
+}
+
+// GetByPath returns all entries for the given path across all layers, in the order the entries were added.
+func (c *FileCatalog) GetByPath(p file.Path) []FileCatalogEntry {
+	c.RLock()
+	defer c.RUnlock()
+	row, ok := c.byPath[string(p)]
 	if !ok {
-		return nil, nil
+		return nil
 	}
 	var entries []FileCatalogEntry
-	for _, id := range fileIDs {
-		entry, ok := c.catalog[id]
-		if !ok {
-			return nil, fmt.Errorf("could not find file: %+v", id)
+	for ; row >= 0; row = c.nextByPath[row] {
+		entries = append(entries, c.entry(row))
+	}
+	return entries
+}
+
+// GetByDigest returns all entries with the given content digest (only available for entries with a recorded digest,
+// see WithFileDigests), in the order the entries were added.
+func (c *FileCatalog) GetByDigest(digest string) []FileCatalogEntry {
+	c.RLock()
+	defer c.RUnlock()
+	return c.sortedEntries(c.byDigest[digest])
+}
+
+// GetByLayer returns all entries from the given layer, in the order the entries were added.
+func (c *FileCatalog) GetByLayer(l *Layer) []FileCatalogEntry {
+	c.RLock()
+	defer c.RUnlock()
+	idx, ok := c.layerIndexes[l]
+	if !ok {
+		return nil
+	}
+	return c.sortedEntries(c.byLayer[idx])
+}
+
+// Find returns all entries whose metadata satisfies the given predicate, in the order the entries were added. Note:
+// entries from all layers are considered (including entries replaced or deleted by upper layers), use the squashed tree
+// to find which entries are visible within the image.
+func (c *FileCatalog) Find(predicate func(file.Metadata) bool) []FileCatalogEntry {
+	c.RLock()
+	defer c.RUnlock()
+	var rows []int32
+	for row := range c.metadata {
+		if predicate(c.metadata[row]) {
+			rows = append(rows, int32(row))
 		}
-		entries = append(entries, entry)
 	}
+	return c.entries(rows)
+}
 
-	return entries, nil
+// FindByMode returns all entries with all of the given mode bits set (e.g. os.ModeSetuid for all setuid files, or
+// 0o002 for all world-writable files), in the order the entries were added.
+func (c *FileCatalog) FindByMode(mode os.FileMode) []FileCatalogEntry {
+	return c.Find(func(m file.Metadata) bool {
+		return m.Mode&mode == mode
+	})
+}
+
+// FindBySizeRange returns all entries with a size between the given minimum and maximum (inclusive), in the order the
+// entries were added. A negative maximum means there is no upper bound.
+func (c *FileCatalog) FindBySizeRange(min, max int64) []FileCatalogEntry {
+	return c.Find(func(m file.Metadata) bool {
+		return m.Size >= min && (max < 0 || m.Size <= max)
+	})
+}
+
+// FindByOwner returns all entries owned by the given user and group IDs (a negative ID matches any owner), in the
+// order the entries were added. This is the same as FilesByOwner.
+func (c *FileCatalog) FindByOwner(uid, gid int) []FileCatalogEntry {
+	return c.FilesByOwner(uid, gid)
+}
+
+// FilesByOwner returns all entries owned by the given user and group IDs (a negative ID matches any owner), in the
+// order the entries were added. Entries are indexed by both IDs, so answering policy checks such as "which files are
+// owned by root" (FilesByOwner(0, -1)) does not require iterating the whole catalog.
+func (c *FileCatalog) FilesByOwner(uid, gid int) []FileCatalogEntry {
+	c.RLock()
+	defer c.RUnlock()
+	var rows []int32
+	switch {
+	case uid < 0 && gid < 0:
+		rows = make([]int32, len(c.refs))
+		for row := range rows {
+			rows[row] = int32(row)
+		}
+	case gid < 0:
+		rows = append(rows, c.byUserID[uid]...)
+	case uid < 0:
+		rows = append(rows, c.byGroupID[gid]...)
+	default:
+		// filter the smaller of the two index lists by the other ID
+		candidates := c.byUserID[uid]
+		if groupRows := c.byGroupID[gid]; len(groupRows) < len(candidates) {
+			candidates = groupRows
+		}
+		for _, row := range candidates {
+			if m := &c.metadata[row]; m.UserID == uid && m.GroupID == gid {
+				rows = append(rows, row)
+			}
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i] < rows[j]
+	})
+	return c.entries(rows)
+}
+
+// FindByMIMEType returns all entries with any of the given MIME types, in the order the entries were added.
+func (c *FileCatalog) FindByMIMEType(mimeTypes ...string) []FileCatalogEntry {
+	c.RLock()
+	defer c.RUnlock()
+	var rows []int32
+	seen := make(map[string]struct{})
+	for _, mType := range mimeTypes {
+		if _, ok := seen[mType]; ok {
+			continue
+		}
+		seen[mType] = struct{}{}
+		rows = append(rows, c.byMIMEType[mType]...)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i] < rows[j]
+	})
+	return c.entries(rows)
 }
 
 // FetchContents reads the file contents for the given file reference from the underlying image/layer blob. An error
-// is returned if there is no file at the given path and layer or the read operation cannot continue.
+// is returned if there is no file at the given path and layer or the read operation cannot continue (see
+// FileContentsError).
 func (c *FileCatalog) FileContents(f file.Reference) (io.ReadCloser, error) {
 	c.RLock()
-	defer c.RUnlock()
-	catalogEntry, ok := c.catalog[f.ID()]
+	row, ok := c.rows[f.ID()]
 	if !ok {
-		return nil, fmt.Errorf("could not find file: %+v", f.RealPath)
+		c.RUnlock()
+		return nil, newFileContentsError(f.RealPath, ErrFileNotFound)
 	}
+	isDir := c.metadata[row].IsDir || file.Type(c.metadata[row].TypeFlag) == file.TypeDir
+	opener, layer, audit := c.contents[row], c.layerTable[c.layers[row]], c.readAudit
+	// the opener is invoked without holding the lock, since it may use the catalog itself
+	c.RUnlock()
 
-	if catalogEntry.Contents == nil {
-		return nil, fmt.Errorf("no contents available for file: %+v", f.RealPath)
+	if isDir {
+		return nil, newFileContentsError(f.RealPath, ErrIsDirectory)
 	}
-
-	return catalogEntry.Contents(), nil
+	if opener == nil {
+		return nil, newFileContentsError(f.RealPath, ErrContentUnavailable)
+	}
+	if audit != nil {
+		return audit.open(f, layer, opener)
+	}
+	return opener(), nil
 }
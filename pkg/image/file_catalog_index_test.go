@@ -0,0 +1,248 @@
+package image
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+func catalogPaths(entries []FileCatalogEntry) []string {
+	var paths []string
+	for _, entry := range entries {
+		paths = append(paths, entry.Metadata.Path)
+	}
+	return paths
+}
+
+func TestFileCatalog_Indexes(t *testing.T) {
+	lower := &Layer{Metadata: LayerMetadata{Index: 0}}
+	upper := &Layer{Metadata: LayerMetadata{Index: 1}}
+
+	lowerHello := file.NewFileReference("/etc/hello")
+	lowerWorld := file.NewFileReference("/etc/world")
+	upperHello := file.NewFileReference("/etc/hello")
+
+	catalog := NewFileCatalog()
+	catalog.Add(*lowerHello, file.Metadata{Path: "/etc/hello", MIMEType: "text/plain", Digest: "sha256:a"}, lower, nil)
+	catalog.Add(*lowerWorld, file.Metadata{Path: "/etc/world", MIMEType: "text/plain", Digest: "sha256:b"}, lower, nil)
+	catalog.Add(*upperHello, file.Metadata{Path: "/etc/hello", Digest: "sha256:b"}, upper, nil)
+
+	assert.Equal(t, 3, catalog.Len())
+
+	byPath := catalog.GetByPath("/etc/hello")
+	require.Len(t, byPath, 2)
+	assert.Equal(t, lower, byPath[0].Layer)
+	assert.Equal(t, upper, byPath[1].Layer)
+	assert.Empty(t, catalog.GetByPath("/missing"))
+
+	assert.Equal(t, []string{"/etc/world", "/etc/hello"}, catalogPaths(catalog.GetByDigest("sha256:b")))
+	assert.Equal(t, []string{"/etc/hello", "/etc/world"}, catalogPaths(catalog.GetByLayer(lower)))
+	assert.Equal(t, []string{"/etc/hello"}, catalogPaths(catalog.GetByLayer(upper)))
+	assert.Empty(t, catalog.GetByLayer(&Layer{}))
+
+	byMIMEType, err := catalog.GetByMIMEType("text/plain")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/etc/hello", "/etc/world"}, catalogPaths(byMIMEType))
+
+	// overwriting an entry replaces the entry within all indexes
+	catalog.Add(*lowerWorld, file.Metadata{Path: "/etc/world", MIMEType: "application/json", Digest: "sha256:c"}, upper, nil)
+	assert.Equal(t, 3, catalog.Len())
+	assert.Equal(t, []string{"/etc/hello"}, catalogPaths(catalog.GetByDigest("sha256:b")))
+	assert.Equal(t, []string{"/etc/world"}, catalogPaths(catalog.GetByDigest("sha256:c")))
+	assert.Equal(t, []string{"/etc/hello"}, catalogPaths(catalog.GetByLayer(lower)))
+	assert.Equal(t, []string{"/etc/hello", "/etc/world"}, catalogPaths(catalog.GetByLayer(upper)))
+	byMIMEType, err = catalog.GetByMIMEType("text/plain")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/etc/hello"}, catalogPaths(byMIMEType))
+
+	// recorded digests are indexed
+	catalog.setDigest(*lowerHello, "sha256:d")
+	assert.Equal(t, []string{"/etc/hello"}, catalogPaths(catalog.GetByDigest("sha256:d")))
+	assert.Empty(t, catalog.GetByDigest("sha256:a"))
+
+	// overwriting the first entry for a path moves the entry to the end of the path index
+	catalog.Add(*lowerHello, file.Metadata{Path: "/etc/hello"}, lower, nil)
+	byPath = catalog.GetByPath("/etc/hello")
+	require.Len(t, byPath, 2)
+	assert.Equal(t, upperHello.ID(), byPath[0].File.ID())
+	assert.Equal(t, lowerHello.ID(), byPath[1].File.ID())
+}
+
+func TestFileCatalog_SparseFields(t *testing.T) {
+	lower := &Layer{Metadata: LayerMetadata{Index: 0}}
+	upper := &Layer{Metadata: LayerMetadata{Index: 1}}
+	target := file.NewFileReference("/bin/busybox")
+	link := file.NewFileReference("/bin/sh")
+
+	catalog := NewFileCatalog()
+	catalog.Add(*target, file.Metadata{Path: "/bin/busybox", Digest: "sha256:a"}, lower, nil)
+	catalog.Add(*link, file.Metadata{Path: "/bin/sh"}, upper, nil)
+
+	catalog.bindHardlink(*link, *target)
+	catalog.setContentOrigin(*target, upper)
+
+	entry, err := catalog.Get(*link)
+	require.NoError(t, err)
+	require.NotNil(t, entry.HardlinkTarget)
+	assert.Equal(t, target.ID(), entry.HardlinkTarget.ID())
+	assert.Equal(t, "sha256:a", entry.Metadata.Digest)
+	assert.Nil(t, entry.ContentOrigin)
+	assert.Equal(t, []string{"/bin/busybox", "/bin/sh"}, catalogPaths(catalog.GetByDigest("sha256:a")))
+
+	entry, err = catalog.Get(*target)
+	require.NoError(t, err)
+	assert.Nil(t, entry.HardlinkTarget)
+	assert.Equal(t, upper, entry.ContentLayer())
+
+	// re-adding an entry clears the sparse fields
+	catalog.Add(*link, file.Metadata{Path: "/bin/sh"}, upper, nil)
+	entry, err = catalog.Get(*link)
+	require.NoError(t, err)
+	assert.Nil(t, entry.HardlinkTarget)
+}
+
+func TestFileCatalog_Find(t *testing.T) {
+	layer := &Layer{}
+	catalog := NewFileCatalog()
+	for _, m := range []file.Metadata{
+		{Path: "/bin/su", Mode: os.ModeSetuid | 0755, Size: 60000, UserID: 0, GroupID: 0, MIMEType: "application/x-elf"},
+		{Path: "/bin/ls", Mode: 0755, Size: 140000, UserID: 0, GroupID: 0, MIMEType: "application/x-elf"},
+		{Path: "/etc/passwd", Mode: 0644, Size: 1200, UserID: 0, GroupID: 0, MIMEType: "text/plain"},
+		{Path: "/home/app/run.sh", Mode: os.ModeSetuid | os.ModeSetgid | 0777, Size: 40, UserID: 1000, GroupID: 1000, MIMEType: "text/x-shellscript"},
+		{Path: "/home/app/data.json", Mode: 0600, Size: 0, UserID: 1000, GroupID: 0, MIMEType: "application/json"},
+	} {
+		catalog.Add(*file.NewFileReference(file.Path(m.Path)), m, layer, nil)
+	}
+
+	assert.Equal(t, []string{"/bin/su", "/home/app/run.sh"}, catalogPaths(catalog.FindByMode(os.ModeSetuid)))
+	assert.Equal(t, []string{"/home/app/run.sh"}, catalogPaths(catalog.FindByMode(os.ModeSetuid|os.ModeSetgid)))
+	assert.Equal(t, []string{"/home/app/run.sh"}, catalogPaths(catalog.FindByMode(0002)))
+	assert.Empty(t, catalog.FindByMode(os.ModeSticky))
+
+	assert.Equal(t, []string{"/etc/passwd", "/home/app/run.sh", "/home/app/data.json"}, catalogPaths(catalog.FindBySizeRange(0, 1200)))
+	assert.Equal(t, []string{"/bin/su", "/bin/ls"}, catalogPaths(catalog.FindBySizeRange(1201, -1)))
+	assert.Empty(t, catalog.FindBySizeRange(1, 39))
+
+	assert.Equal(t, []string{"/home/app/run.sh", "/home/app/data.json"}, catalogPaths(catalog.FindByOwner(1000, -1)))
+	assert.Equal(t, []string{"/home/app/run.sh"}, catalogPaths(catalog.FindByOwner(1000, 1000)))
+	assert.Equal(t, []string{"/bin/su", "/bin/ls", "/etc/passwd", "/home/app/data.json"}, catalogPaths(catalog.FindByOwner(-1, 0)))
+
+	assert.Equal(t, []string{"/bin/su", "/bin/ls", "/home/app/run.sh"}, catalogPaths(catalog.FindByMIMEType("text/x-shellscript", "application/x-elf", "text/x-shellscript")))
+	assert.Empty(t, catalog.FindByMIMEType("image/png"))
+	assert.Empty(t, catalog.FindByMIMEType())
+
+	// predicates compose attribute queries, e.g. setuid executables owned by root
+	assert.Equal(t, []string{"/bin/su"}, catalogPaths(catalog.Find(func(m file.Metadata) bool {
+		return m.Mode&os.ModeSetuid != 0 && m.UserID == 0 && m.MIMEType == "application/x-elf"
+	})))
+}
+
+func TestFileCatalog_FilesByOwner(t *testing.T) {
+	layer := &Layer{}
+	passwd := file.NewFileReference("/etc/passwd")
+	run := file.NewFileReference("/home/app/run.sh")
+	data := file.NewFileReference("/home/app/data.json")
+
+	catalog := NewFileCatalog()
+	catalog.Add(*passwd, file.Metadata{Path: "/etc/passwd"}, layer, nil)
+	catalog.Add(*run, file.Metadata{Path: "/home/app/run.sh", UserID: 1000, GroupID: 1000}, layer, nil)
+	catalog.Add(*data, file.Metadata{Path: "/home/app/data.json", UserID: 1000}, layer, nil)
+
+	assert.Equal(t, []string{"/etc/passwd"}, catalogPaths(catalog.FilesByOwner(0, -1)))
+	assert.Equal(t, []string{"/home/app/run.sh", "/home/app/data.json"}, catalogPaths(catalog.FilesByOwner(1000, -1)))
+	assert.Equal(t, []string{"/etc/passwd", "/home/app/data.json"}, catalogPaths(catalog.FilesByOwner(-1, 0)))
+	assert.Equal(t, []string{"/home/app/data.json"}, catalogPaths(catalog.FilesByOwner(1000, 0)))
+	assert.Equal(t, []string{"/etc/passwd", "/home/app/run.sh", "/home/app/data.json"}, catalogPaths(catalog.FilesByOwner(-1, -1)))
+	assert.Empty(t, catalog.FilesByOwner(0, 1000))
+	assert.Empty(t, catalog.FilesByOwner(65534, -1))
+
+	// overwriting an entry moves the entry to the new owner (keeping the order entries were added)
+	catalog.Add(*passwd, file.Metadata{Path: "/etc/passwd", UserID: 1000}, layer, nil)
+	assert.Empty(t, catalog.FilesByOwner(0, -1))
+	assert.Equal(t, []string{"/etc/passwd", "/home/app/run.sh", "/home/app/data.json"}, catalogPaths(catalog.FilesByOwner(1000, -1)))
+	assert.Equal(t, []string{"/etc/passwd", "/home/app/data.json"}, catalogPaths(catalog.FilesByOwner(1000, 0)))
+}
+
+func BenchmarkFileCatalog_Add(b *testing.B) {
+	layer := &Layer{}
+	refs := make([]*file.Reference, 100000)
+	for i := range refs {
+		refs[i] = file.NewFileReference(file.Path(fmt.Sprintf("/usr/share/doc/package-%d/copyright", i)))
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		catalog := NewFileCatalog()
+		for _, ref := range refs {
+			catalog.Add(*ref, file.Metadata{Path: string(ref.RealPath), MIMEType: "text/plain"}, layer, nil)
+		}
+	}
+}
+
+func TestFileCatalog_ReplaceEntries(t *testing.T) {
+	lower := &Layer{Metadata: LayerMetadata{Index: 0}}
+	upper := &Layer{Metadata: LayerMetadata{Index: 1}}
+	refs := make([]*file.Reference, 1000)
+	catalog := NewFileCatalog()
+	for i := range refs {
+		refs[i] = file.NewFileReference(file.Path(fmt.Sprintf("/usr/share/doc/package-%d/copyright", i)))
+		catalog.Add(*refs[i], file.Metadata{Path: string(refs[i].RealPath), MIMEType: "text/plain", Digest: "sha256:a"}, lower, nil)
+	}
+
+	// replace every other entry (out of order), which moves rows around within the shared index lists
+	var replaced, kept []string
+	for i := len(refs) - 1; i >= 0; i-- {
+		if i%2 == 0 {
+			continue
+		}
+		catalog.Add(*refs[i], file.Metadata{Path: string(refs[i].RealPath), MIMEType: "application/json", Digest: "sha256:b", UserID: 1000}, upper, nil)
+		replaced = append(replaced, string(refs[i].RealPath))
+	}
+	for i := 0; i < len(refs); i += 2 {
+		kept = append(kept, string(refs[i].RealPath))
+	}
+
+	assert.Equal(t, len(refs), catalog.Len())
+	assert.Equal(t, kept, catalogPaths(catalog.GetByDigest("sha256:a")))
+	assert.Equal(t, replaced, catalogPaths(catalog.GetByDigest("sha256:b")))
+	assert.Equal(t, kept, catalogPaths(catalog.GetByLayer(lower)))
+	assert.Equal(t, replaced, catalogPaths(catalog.GetByLayer(upper)))
+	byMIMEType, err := catalog.GetByMIMEType("text/plain")
+	require.NoError(t, err)
+	assert.Equal(t, kept, catalogPaths(byMIMEType))
+	assert.Len(t, catalog.FilesByOwner(0, -1), len(kept))
+	assert.Len(t, catalog.FilesByOwner(1000, -1), len(replaced))
+}
+
+func TestFileCatalog_FileContents_OpenerUsesCatalog(t *testing.T) {
+	layer := &Layer{}
+	ref := file.NewFileReference("/etc/hello")
+	catalog := NewFileCatalog()
+	catalog.Add(*ref, file.Metadata{Path: "/etc/hello"}, layer, func() io.ReadCloser {
+		// a pending writer blocks new readers, so the opener would deadlock if invoked while holding the catalog lock
+		added := make(chan struct{})
+		go func() {
+			catalog.Add(*file.NewFileReference("/etc/world"), file.Metadata{Path: "/etc/world"}, layer, nil)
+			close(added)
+		}()
+		<-added
+		_, err := catalog.Get(*ref)
+		require.NoError(t, err)
+		return ioutil.NopCloser(strings.NewReader("hello"))
+	})
+
+	reader, err := catalog.FileContents(*ref)
+	require.NoError(t, err)
+	contents, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(contents))
+	assert.Equal(t, 2, catalog.Len())
+}
@@ -0,0 +1,48 @@
+package image
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+// ErrFileNotFound indicates that there is no file at the given path (or for the given file reference).
+var ErrFileNotFound = fmt.Errorf("could not find file")
+
+// ErrIsDirectory indicates that the contents of a directory were requested.
+var ErrIsDirectory = errors.New("path is a directory")
+
+// ErrDeadLink indicates that the given path is a link that does not resolve to a file.
+var ErrDeadLink = errors.New("link does not resolve to a file")
+
+// ErrContentUnavailable indicates that the file exists, however, no contents are available for it (e.g. the file catalog
+// was loaded from a saved analysis without the layer contents).
+var ErrContentUnavailable = errors.New("file contents are unavailable")
+
+// FileContentsError describes a failed attempt to fetch the contents of a file. Err is one of ErrFileNotFound,
+// ErrIsDirectory, ErrDeadLink, or ErrContentUnavailable (or the underlying error for any other failure), so callers can
+// use errors.Is and errors.As instead of matching on the message. Missing files and dead links are also reported as
+// fs.ErrNotExist.
+type FileContentsError struct {
+	Path file.Path
+	Err  error
+}
+
+func (e *FileContentsError) Error() string {
+	return fmt.Sprintf("unable to fetch contents for path=%q: %v", e.Path, e.Err)
+}
+
+func (e *FileContentsError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports missing files and dead links as fs.ErrNotExist (in addition to the wrapped error).
+func (e *FileContentsError) Is(target error) bool {
+	return target == fs.ErrNotExist && (errors.Is(e.Err, ErrFileNotFound) || errors.Is(e.Err, ErrDeadLink))
+}
+
+func newFileContentsError(path file.Path, err error) error {
+	return &FileContentsError{Path: path, Err: err}
+}
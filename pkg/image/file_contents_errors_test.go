@@ -0,0 +1,82 @@
+package image
+
+import (
+	"archive/tar"
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+func TestImage_FileContentsErrors(t *testing.T) {
+	img := newTestImageFromLayers(t, []v1.Layer{newTestTarLayer(t,
+		testTarEntry{name: "etc/", typeflag: tar.TypeDir, mode: 0755},
+		testTarEntry{name: "etc/os-release", contents: "ID=test"},
+		testTarEntry{name: "etc/release", typeflag: tar.TypeSymlink, linkname: "os-release"},
+		testTarEntry{name: "etc/dead", typeflag: tar.TypeSymlink, linkname: "missing"},
+		testTarEntry{name: "dev/null", typeflag: tar.TypeChar, devmajor: 1, devminor: 3},
+	)})
+
+	tests := []struct {
+		path     file.Path
+		expected error
+		notExist bool
+	}{
+		{path: "/missing", expected: ErrFileNotFound, notExist: true},
+		{path: "/etc/dead", expected: ErrDeadLink, notExist: true},
+		{path: "/etc", expected: ErrIsDirectory},
+		// implied by the layer tar (there is no entry of its own)
+		{path: "/dev", expected: ErrIsDirectory},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.path), func(t *testing.T) {
+			for name, fetch := range map[string]func(file.Path) error{
+				"image": func(p file.Path) error {
+					_, err := img.FileContentsFromSquash(p)
+					return err
+				},
+				"layer": func(p file.Path) error {
+					_, err := img.Layers[0].FileContents(p)
+					return err
+				},
+			} {
+				err := fetch(test.path)
+				require.Error(t, err, name)
+				assert.True(t, errors.Is(err, test.expected), "%s: unexpected error: %v", name, err)
+				assert.Equal(t, test.notExist, errors.Is(err, fs.ErrNotExist), "%s: unexpected error: %v", name, err)
+
+				var contentsErr *FileContentsError
+				require.True(t, errors.As(err, &contentsErr), name)
+				assert.Equal(t, test.path, contentsErr.Path, name)
+			}
+		})
+	}
+
+	// links are reported by the requested path
+	reader, err := img.FileContentsFromSquash("/etc/release")
+	require.NoError(t, err)
+	contents, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "ID=test", string(contents))
+}
+
+func TestFileCatalog_FileContentsErrors(t *testing.T) {
+	catalog := NewFileCatalog()
+	_, err := catalog.FileContents(*file.NewFileReference("/missing"))
+	assert.True(t, errors.Is(err, ErrFileNotFound), "unexpected error: %v", err)
+	assert.True(t, errors.Is(err, fs.ErrNotExist), "unexpected error: %v", err)
+
+	// e.g. loaded from a saved analysis
+	ref := file.NewFileReference("/etc/os-release")
+	catalog.Add(*ref, file.Metadata{Path: "/etc/os-release", TypeFlag: tar.TypeReg}, nil, nil)
+	_, err = catalog.FileContents(*ref)
+	assert.True(t, errors.Is(err, ErrContentUnavailable), "unexpected error: %v", err)
+	assert.False(t, errors.Is(err, fs.ErrNotExist), "unexpected error: %v", err)
+}
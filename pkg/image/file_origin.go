@@ -0,0 +1,34 @@
+package image
+
+import (
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree/filenode"
+)
+
+// FileOrigin returns the index (see LayerMetadata.Index) and digest of the layer that contributed the given file reference (e.g. as resolved
+// from the squash tree), which is the layer whose tar contains the winning copy of the file. Note that the file
+// contents may be attributed to a lower layer for metadata-only changes (see FileCatalogEntry.ContentLayer). An index
+// of -1 (and an empty digest) is returned if the reference does not belong to any layer of the image.
+func (i *Image) FileOrigin(ref file.Reference) (layerIndex int, layerDigest string) {
+	entry, err := i.FileCatalog.Get(ref)
+	if err != nil || entry.Layer == nil {
+		return -1, ""
+	}
+
+	// layers with the same digest share their file references with the lowest copy of the layer, in which case the
+	// highest copy containing the reference contributed the file to the squash
+	for idx := len(i.Layers) - 1; idx >= 0; idx-- {
+		layer := i.Layers[idx]
+		if layer != entry.Layer && layer.duplicateOf != entry.Layer {
+			continue
+		}
+		if layer.Tree == nil {
+			continue
+		}
+		n, ok := layer.Tree.Reader().Node(filenode.IDByPath(ref.RealPath)).(*filenode.FileNode)
+		if ok && n != nil && n.Reference != nil && n.Reference.ID() == ref.ID() {
+			return int(layer.Metadata.Index), layer.Metadata.Digest
+		}
+	}
+	return int(entry.Layer.Metadata.Index), entry.Layer.Metadata.Digest
+}
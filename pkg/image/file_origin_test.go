@@ -0,0 +1,63 @@
+package image
+
+import (
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+func TestImage_FileOrigin(t *testing.T) {
+	base := newTestTarLayer(t,
+		testTarEntry{name: "etc/base", contents: "base"},
+		testTarEntry{name: "etc/replaced", contents: "original"},
+	)
+	img := newTestImageFromLayers(t, []v1.Layer{
+		base,
+		newTestTarLayer(t,
+			testTarEntry{name: "etc/replaced", contents: "replaced"},
+			testTarEntry{name: "etc/upper", contents: "upper"},
+		),
+	})
+	// the same layer content again (sharing file references with the first layer)
+	withDuplicate := newTestImageFromLayers(t, []v1.Layer{
+		base,
+		newTestTarLayer(t, testTarEntry{name: "etc/upper", contents: "upper"}),
+		base,
+	})
+
+	squashRef := func(t *testing.T, img *Image, p file.Path) file.Reference {
+		t.Helper()
+		_, ref, err := img.SquashedTree().File(p)
+		require.NoError(t, err)
+		require.NotNil(t, ref)
+		return *ref
+	}
+
+	tests := []struct {
+		name      string
+		img       *Image
+		path      file.Path
+		wantLayer int
+	}{
+		{name: "only in the base layer", img: img, path: "/etc/base", wantLayer: 0},
+		{name: "replaced by an upper layer", img: img, path: "/etc/replaced", wantLayer: 1},
+		{name: "only in an upper layer", img: img, path: "/etc/upper", wantLayer: 1},
+		{name: "duplicate layer", img: withDuplicate, path: "/etc/base", wantLayer: 2},
+		{name: "below a duplicate layer", img: withDuplicate, path: "/etc/upper", wantLayer: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			idx, digest := test.img.FileOrigin(squashRef(t, test.img, test.path))
+			assert.Equal(t, test.wantLayer, idx)
+			assert.Equal(t, test.img.Layers[test.wantLayer].Metadata.Digest, digest)
+		})
+	}
+
+	idx, digest := img.FileOrigin(*file.NewFileReference("/etc/unknown"))
+	assert.Equal(t, -1, idx)
+	assert.Empty(t, digest)
+}
@@ -0,0 +1,115 @@
+package image
+
+import (
+	"io/ioutil"
+	"sync"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImage_FilesystemAt(t *testing.T) {
+	v1Image, err := mutate.AppendLayers(empty.Image,
+		newTestTarLayer(t, testTarEntry{name: "etc/base", contents: "base"}),
+		newTestTarLayer(t, testTarEntry{name: "etc/middle", contents: "middle"}, testTarEntry{name: "etc/.wh.base"}),
+		newTestTarLayer(t, testTarEntry{name: "etc/top", contents: "top"}),
+	)
+	require.NoError(t, err)
+	img := NewImage(v1Image, t.TempDir())
+	require.NoError(t, img.Read(WithDeferredSquash()))
+	t.Cleanup(func() { _ = img.Cleanup() })
+	require.False(t, img.IsSquashed())
+
+	tests := []struct {
+		layer   int
+		present []string
+		absent  []string
+	}{
+		{layer: 1, present: []string{"/etc/middle"}, absent: []string{"/etc/base", "/etc/top"}},
+		{layer: 0, present: []string{"/etc/base"}, absent: []string{"/etc/middle", "/etc/top"}},
+		{layer: 2, present: []string{"/etc/middle", "/etc/top"}, absent: []string{"/etc/base"}},
+	}
+	for _, test := range tests {
+		tree, err := img.FilesystemAt(test.layer)
+		require.NoError(t, err)
+		for _, p := range test.present {
+			assert.True(t, tree.HasPath(file.Path(p)), "layer=%d should have %q", test.layer, p)
+		}
+		for _, p := range test.absent {
+			assert.False(t, tree.HasPath(file.Path(p)), "layer=%d should not have %q", test.layer, p)
+		}
+
+		// the squash tree is generated only for the layers requested so far and kept for later calls
+		assert.Same(t, tree, img.Layers[test.layer].SquashedTree)
+		if test.layer < 2 {
+			assert.Nil(t, img.Layers[2].SquashedTree)
+		}
+		again, err := img.FilesystemAt(test.layer)
+		require.NoError(t, err)
+		assert.Same(t, tree, again)
+	}
+	assert.True(t, img.IsSquashed())
+	assert.Same(t, img.Layers[2].SquashedTree, img.SquashedTree())
+
+	_, err = img.FilesystemAt(3)
+	assert.Error(t, err)
+	_, err = img.FilesystemAt(-1)
+	assert.Error(t, err)
+}
+
+func TestImage_DeferredSquash_LinkAndLayerAccess(t *testing.T) {
+	v1Image, err := mutate.AppendLayers(empty.Image,
+		newTestTarLayer(t, testTarEntry{name: "etc/base", contents: "base"}),
+		newTestTarLayer(t, testTarEntry{name: "etc/top", contents: "top"}),
+	)
+	require.NoError(t, err)
+	img := NewImage(v1Image, t.TempDir())
+	require.NoError(t, img.Read(WithDeferredSquash()))
+	t.Cleanup(func() { _ = img.Cleanup() })
+
+	// squash trees are generated on demand by every accessor (and concurrently requested only once)
+	var wg sync.WaitGroup
+	trees := make([]*filetree.FileTree, 4)
+	for idx := range trees {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			trees[idx] = img.SquashedTree()
+		}(idx)
+	}
+	wg.Wait()
+	for _, tree := range trees {
+		assert.Same(t, trees[0], tree)
+	}
+
+	img = NewImage(v1Image, t.TempDir())
+	require.NoError(t, img.Read(WithDeferredSquash()))
+	t.Cleanup(func() { _ = img.Cleanup() })
+
+	_, ref, err := img.Layers[1].Tree.File("/etc/top")
+	require.NoError(t, err)
+	resolved, err := img.ResolveLinkByImageSquash(*ref)
+	require.NoError(t, err)
+	assert.Equal(t, ref.ID(), resolved.ID())
+
+	_, ref, err = img.Layers[0].Tree.File("/etc/base")
+	require.NoError(t, err)
+	resolved, err = img.ResolveLinkByLayerSquash(*ref, 0)
+	require.NoError(t, err)
+	assert.Equal(t, ref.ID(), resolved.ID())
+
+	reader, err := img.Layers[1].FileContentsFromSquash("/etc/base")
+	require.NoError(t, err)
+	contents, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	assert.Equal(t, "base", string(contents))
+
+	_, err = img.Layers[1].FilesByMIMETypeFromSquash("text/plain")
+	require.NoError(t, err)
+}
@@ -0,0 +1,267 @@
+package image
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+
+	"github.com/anchore/stereoscope/internal/log"
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree"
+	"github.com/anchore/stereoscope/pkg/filetree/filenode"
+	"github.com/anchore/stereoscope/pkg/tree"
+)
+
+// flattenedCreatedBy is recorded as the history of the single layer within a flattened image.
+const flattenedCreatedBy = "stereoscope flatten"
+
+// Flatten returns a new single-layer image with the config of the given (already read and squashed) image, where the
+// only layer is the squash tree written as a tar (see WriteFlattenedTar). This is the same as `docker export` followed
+// by an import with the original config, and the result can be written with any go-containerregistry writer (e.g.
+// tarball.Write or remote.Write). The layer contents are read from the given image each time the layer is opened, so
+// the given image must not be cleaned up while the flattened image is in use.
+func Flatten(img *Image) (v1.Image, error) {
+	if err := img.requireImageContent(); err != nil {
+		return nil, fmt.Errorf("unable to flatten image: %w", err)
+	}
+	// fail early when the squash tree cannot be generated, rather than each time the layer is opened
+	if _, err := img.imageSquashTree(); err != nil {
+		return nil, fmt.Errorf("unable to flatten image: %w", err)
+	}
+
+	cfg, err := img.image.ConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read image config: %w", err)
+	}
+	cfg = cfg.DeepCopy()
+	cfg.RootFS.DiffIDs = nil
+	cfg.History = nil
+
+	base, err := mutate.ConfigFile(empty.Image, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create flattened image config: %w", err)
+	}
+
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		reader, writer := io.Pipe()
+		go func() {
+			writer.CloseWithError(img.WriteFlattenedTar(writer))
+		}()
+		return reader, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to create flattened layer: %w", err)
+	}
+
+	flattened, err := mutate.Append(base, mutate.Addendum{
+		Layer: layer,
+		History: v1.History{
+			Created:   cfg.Created,
+			CreatedBy: flattenedCreatedBy,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to create flattened image: %w", err)
+	}
+	return flattened, nil
+}
+
+// WriteFlattenedTar writes the squash tree of the image as a single tar to the given writer (the `docker export`
+// format). Entries are written in path order with whiteouts already applied, directories implied by the layer tars are
+// written with default metadata, and all names that share content (hardlinks, including the original file) are
+// preserved as hardlinks to the first of those names within the tar. Note: mod times and device numbers are not
+// captured when reading layers and are not written.
+func (i *Image) WriteFlattenedTar(w io.Writer) error {
+	return i.writeFlattenedTar(w, nil, nil)
+}
+
+// writeFlattenedTar writes the squash tree as a single tar (see WriteFlattenedTar), only writing the paths selected by
+// the given include function (all paths when nil) and passing every header to the given function before it is written
+// (when not nil).
+func (i *Image) writeFlattenedTar(w io.Writer, include func(file.Path) bool, mapHeader func(*tar.Header)) error {
+	if err := i.requireImageContent(); err != nil {
+		return err
+	}
+	squash, err := i.imageSquashTree()
+	if err != nil {
+		return err
+	}
+
+	f := flattener{
+		tree:      squash,
+		reader:    squash.Reader(),
+		catalog:   &i.FileCatalog,
+		writer:    tar.NewWriter(w),
+		written:   make(map[file.ID]string),
+		include:   include,
+		mapHeader: mapHeader,
+	}
+	for _, root := range f.reader.Roots() {
+		n, ok := root.(*filenode.FileNode)
+		if !ok {
+			return fmt.Errorf("unexpected root node type: %T", root)
+		}
+		if err := f.writeNode(n); err != nil {
+			return err
+		}
+	}
+	return f.writer.Close()
+}
+
+type flattener struct {
+	tree    *filetree.FileTree
+	reader  tree.Reader
+	catalog *FileCatalog
+	writer  *tar.Writer
+	// written is the first tar entry name for the content of every regular file written so far (by reference ID)
+	written map[file.ID]string
+	// include selects the paths to write (all paths when nil)
+	include func(file.Path) bool
+	// mapHeader is given every header before it is written (when not nil)
+	mapHeader func(*tar.Header)
+}
+
+// writeNode writes the given node and (for directories) all nodes below it, sorted by name.
+func (f *flattener) writeNode(n *filenode.FileNode) error {
+	if n.RealPath.IsWhiteout() {
+		// whiteouts within the lowest layer have nothing to remove and are not part of the squashed filesystem
+		return nil
+	}
+	if n.RealPath != file.DirSeparator && (f.include == nil || f.include(n.RealPath)) {
+		if err := f.writeEntry(n); err != nil {
+			return fmt.Errorf("unable to write path=%q: %w", n.RealPath, err)
+		}
+	}
+	if n.FileType != file.TypeDir {
+		return nil
+	}
+
+	children := f.reader.Children(n)
+	nodes := make([]*filenode.FileNode, 0, len(children))
+	for _, child := range children {
+		fn, ok := child.(*filenode.FileNode)
+		if !ok {
+			return fmt.Errorf("unexpected node type: %T", child)
+		}
+		nodes = append(nodes, fn)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].RealPath.Basename() < nodes[j].RealPath.Basename()
+	})
+	for _, child := range nodes {
+		if err := f.writeNode(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *flattener) writeEntry(n *filenode.FileNode) error {
+	name := strings.TrimPrefix(string(n.RealPath), file.DirSeparator)
+	if n.Reference == nil {
+		if n.FileType != file.TypeDir {
+			log.Debugf("skipping path=%q without a file reference while flattening", n.RealPath)
+			return nil
+		}
+		// parent directories that are implied by the layer tars have no entry of their own
+		return f.writeHeader(&tar.Header{
+			Name:     name + file.DirSeparator,
+			Typeflag: tar.TypeDir,
+			Mode:     0755,
+		})
+	}
+
+	entry, err := f.catalog.Get(*n.Reference)
+	if err != nil {
+		return err
+	}
+	ref := *n.Reference
+	if file.Type(entry.Metadata.TypeFlag) == file.TypeHardLink {
+		target := f.hardlinkTarget(n, entry)
+		if target == nil {
+			log.Debugf("skipping unresolved hardlink=%q while flattening", n.RealPath)
+			return nil
+		}
+		// the link is written as the file it shares content with (or a link to the first name of that file)
+		if entry, err = f.catalog.Get(*target); err != nil {
+			return err
+		}
+		ref = *target
+	}
+
+	header, err := flattenedTarHeader(name, entry.Metadata)
+	if err != nil {
+		return err
+	}
+	if header.Typeflag != tar.TypeReg {
+		return f.writeHeader(header)
+	}
+
+	if original, ok := f.written[ref.ID()]; ok {
+		header.Typeflag = tar.TypeLink
+		header.Linkname = original
+		header.Size = 0
+		return f.writeHeader(header)
+	}
+	f.written[ref.ID()] = name
+
+	if err := f.writeHeader(header); err != nil {
+		return err
+	}
+	contents, err := f.catalog.FileContents(ref)
+	if err != nil {
+		return err
+	}
+	defer contents.Close()
+	_, err = io.Copy(f.writer, contents)
+	return err
+}
+
+func (f *flattener) writeHeader(header *tar.Header) error {
+	if f.mapHeader != nil {
+		f.mapHeader(header)
+	}
+	return f.writer.WriteHeader(header)
+}
+
+// hardlinkTarget returns the file that the given hardlink shares content with, preferring the file it was bound to
+// while squashing, otherwise falling back to resolving the link path within the squash tree.
+func (f *flattener) hardlinkTarget(n *filenode.FileNode, entry FileCatalogEntry) *file.Reference {
+	if entry.HardlinkTarget != nil {
+		return entry.HardlinkTarget
+	}
+	_, ref, err := f.tree.File(n.RealPath, filetree.FollowBasenameLinks)
+	if err != nil || ref == nil || ref.ID() == n.Reference.ID() {
+		return nil
+	}
+	return ref
+}
+
+// flattenedTarHeader returns the tar header for the given file metadata under the given (relative) tar entry name.
+func flattenedTarHeader(name string, metadata file.Metadata) (*tar.Header, error) {
+	header, err := tar.FileInfoHeader(newImageFSFileInfo(name, metadata), metadata.Linkname)
+	if err != nil {
+		return nil, err
+	}
+	header.Name = name
+	if header.Typeflag == tar.TypeDir {
+		header.Name += file.DirSeparator
+	}
+	header.Uid = metadata.UserID
+	header.Gid = metadata.GroupID
+	header.Format = tar.FormatPAX
+	for key, value := range metadata.Xattrs {
+		if header.PAXRecords == nil {
+			header.PAXRecords = make(map[string]string)
+		}
+		header.PAXRecords["SCHILY.xattr."+key] = string(value)
+	}
+	return header, nil
+}
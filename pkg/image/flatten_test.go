@@ -0,0 +1,159 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImage_WriteFlattenedTar(t *testing.T) {
+	img := newTestImageFromLayers(t, []v1.Layer{
+		newTestTarLayer(t,
+			testTarEntry{name: "bin/", typeflag: tar.TypeDir, mode: 0755},
+			testTarEntry{name: "bin/busybox", contents: "busybox", mode: 04755},
+			testTarEntry{name: "bin/sh", linkname: "bin/busybox", typeflag: tar.TypeLink},
+			testTarEntry{name: "etc/shadow", contents: "root:*", mode: 0600},
+			testTarEntry{name: "tmp/cache/stale", contents: "stale"},
+			testTarEntry{name: "usr/lib/orig", contents: "lib"},
+			testTarEntry{name: "usr/lib/alias", linkname: "usr/lib/orig", typeflag: tar.TypeLink},
+		),
+		newTestTarLayer(t,
+			testTarEntry{name: "etc/.wh.shadow"},
+			testTarEntry{name: "etc/hostname", contents: "upper", xattrs: map[string]string{"user.test": "value"}},
+			testTarEntry{name: "tmp/cache/.wh..wh..opq"},
+			testTarEntry{name: "tmp/cache/fresh", contents: "fresh"},
+			testTarEntry{name: "usr/lib/.wh.orig"},
+			testTarEntry{name: "usr/lib/os-release", linkname: "../../etc/hostname", typeflag: tar.TypeSymlink},
+		),
+	})
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, img.WriteFlattenedTar(buf))
+
+	type entry struct {
+		typeflag byte
+		linkname string
+		contents string
+	}
+	actual := make(map[string]entry)
+	var names []string
+	headers := make(map[string]*tar.Header)
+	tr := tar.NewReader(buf)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		contents, err := ioutil.ReadAll(tr)
+		require.NoError(t, err)
+		names = append(names, header.Name)
+		headers[header.Name] = header
+		actual[header.Name] = entry{typeflag: header.Typeflag, linkname: header.Linkname, contents: string(contents)}
+	}
+
+	assert.Equal(t, []string{
+		"bin/",
+		"bin/busybox",
+		"bin/sh",
+		"etc/",
+		"etc/hostname",
+		"tmp/",
+		"tmp/cache/",
+		"tmp/cache/fresh",
+		"usr/",
+		"usr/lib/",
+		"usr/lib/alias",
+		"usr/lib/os-release",
+	}, names)
+
+	assert.Equal(t, entry{typeflag: tar.TypeReg, contents: "busybox"}, actual["bin/busybox"])
+	assert.Equal(t, int64(04755), headers["bin/busybox"].Mode)
+	// hardlinks are preserved
+	assert.Equal(t, entry{typeflag: tar.TypeLink, linkname: "bin/busybox"}, actual["bin/sh"])
+	// the original file was removed, but the hardlink keeps the content
+	assert.Equal(t, entry{typeflag: tar.TypeReg, contents: "lib"}, actual["usr/lib/alias"])
+	assert.Equal(t, entry{typeflag: tar.TypeSymlink, linkname: "../../etc/hostname"}, actual["usr/lib/os-release"])
+	assert.Equal(t, "value", headers["etc/hostname"].PAXRecords["SCHILY.xattr.user.test"])
+	assert.Equal(t, byte(tar.TypeDir), actual["usr/"].typeflag)
+}
+
+func TestFlatten(t *testing.T) {
+	img := newTestImageFromLayers(t, []v1.Layer{
+		newTestTarLayer(t,
+			testTarEntry{name: "etc/os-release", contents: "ID=test"},
+			testTarEntry{name: "etc/shadow", contents: "root:*"},
+			testTarEntry{name: "bin/busybox", contents: "busybox"},
+			testTarEntry{name: "bin/sh", linkname: "bin/busybox", typeflag: tar.TypeLink},
+		),
+		newTestTarLayer(t,
+			testTarEntry{name: "etc/.wh.shadow"},
+			testTarEntry{name: "etc/hostname", contents: "upper"},
+		),
+	})
+
+	flattened, err := Flatten(img)
+	require.NoError(t, err)
+
+	layers, err := flattened.Layers()
+	require.NoError(t, err)
+	require.Len(t, layers, 1)
+
+	cfg, err := flattened.ConfigFile()
+	require.NoError(t, err)
+	require.Len(t, cfg.RootFS.DiffIDs, 1)
+	diffID, err := layers[0].DiffID()
+	require.NoError(t, err)
+	assert.Equal(t, diffID, cfg.RootFS.DiffIDs[0])
+	require.Len(t, cfg.History, 1)
+	assert.Equal(t, flattenedCreatedBy, cfg.History[0].CreatedBy)
+
+	// the flattened image has the same effective filesystem
+	flattenedImg := NewImage(flattened, t.TempDir())
+	require.NoError(t, flattenedImg.Read())
+	expected, err := img.ContentTreeDigest()
+	require.NoError(t, err)
+	actual, err := flattenedImg.ContentTreeDigest()
+	require.NoError(t, err)
+	assert.Equal(t, expected, actual)
+
+	contents, err := flattenedImg.FileContentsFromSquash("/bin/sh")
+	require.NoError(t, err)
+	b, err := ioutil.ReadAll(contents)
+	require.NoError(t, err)
+	assert.Equal(t, "busybox", string(b))
+
+	// the layer is written the same way every time it is opened
+	digest, err := layers[0].Digest()
+	require.NoError(t, err)
+	again, err := Flatten(img)
+	require.NoError(t, err)
+	againLayers, err := again.Layers()
+	require.NoError(t, err)
+	againDigest, err := againLayers[0].Digest()
+	require.NoError(t, err)
+	assert.Equal(t, digest, againDigest)
+}
+
+func TestFlatten_Unread(t *testing.T) {
+	_, err := Flatten(&Image{})
+	require.Error(t, err)
+}
+
+func TestFlatten_SquashFailure(t *testing.T) {
+	img := newTestUnsquashableImage(t)
+
+	_, err := Flatten(img)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unable to squash layers")
+
+	err = img.WriteFlattenedTar(ioutil.Discard)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unable to squash layers")
+}
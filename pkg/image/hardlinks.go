@@ -0,0 +1,179 @@
+package image
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/anchore/stereoscope/internal/log"
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/file/tarutil"
+	"github.com/anchore/stereoscope/pkg/filetree"
+)
+
+// FileIdentity is an inode-like identity for a file within a single layer. All names of a hardlink group share the
+// same identity, so file content is only accounted for once.
+type FileIdentity struct {
+	// ID is shared by all names of the same underlying file (the reference ID of the original, non-hardlink entry)
+	ID file.ID
+	// LinkCount is the number of names referring to the underlying file within the layer (1 for files without hardlinks)
+	LinkCount int
+}
+
+// HardlinkGroup is the set of all names within a layer that refer to the same underlying file.
+type HardlinkGroup struct {
+	FileIdentity
+	// Paths are all names of the file, starting with the original (non-hardlink) entry, then each hardlink in tar order
+	Paths []file.Path
+}
+
+// trackHardlink records the given entry (if it is a hardlink) as an additional name of the file it links to.
+func (l *Layer) trackHardlink(metadata file.Metadata) {
+	if file.Type(metadata.TypeFlag) != file.TypeHardLink {
+		return
+	}
+	target := file.Path(tarutil.CleanPath(metadata.Linkname))
+	// hardlinks should always refer to the original name, but in case of a chain, point to the original
+	if original, ok := l.hardlinks[target]; ok {
+		target = original
+	}
+	if l.hardlinks == nil {
+		l.hardlinks = make(map[file.Path]file.Path)
+	}
+	l.hardlinks[file.Path(metadata.Path)] = target
+}
+
+// bindHardlinks resolves every unresolved hardlink within the layer tree to the file it shares content with, first
+// within the layer itself, then within the given squash tree of all lower layers (nil for the first layer). Once bound,
+// the hardlink content no longer depends on what exists at the link path in any squash tree (e.g. the original file
+// may be removed or replaced in an upper layer without affecting the hardlink).
+func (l *Layer) bindHardlinks(lowerSquashTree *filetree.FileTree) {
+	if l.Tree == nil || l.fileCatalog == nil {
+		return
+	}
+	for _, ref := range l.Tree.AllFiles(file.TypeHardLink) {
+		entry, err := l.fileCatalog.Get(ref)
+		if err != nil || entry.HardlinkTarget != nil {
+			continue
+		}
+		original, ok := l.hardlinks[ref.RealPath]
+		if !ok {
+			continue
+		}
+		target := l.hardlinkTarget(l.Tree, original)
+		if target == nil && lowerSquashTree != nil {
+			target = l.hardlinkTarget(lowerSquashTree, original)
+		}
+		if target == nil {
+			log.Debugf("unable to resolve hardlink=%q to %q in layer=%d", ref.RealPath, original, l.Metadata.Index)
+			continue
+		}
+		l.fileCatalog.bindHardlink(ref, *target)
+	}
+}
+
+// hardlinkTarget returns the reference at the given path (within the given tree) that a hardlink may share content
+// with: any file that is not a directory, or another hardlink that has already been resolved.
+func (l *Layer) hardlinkTarget(t *filetree.FileTree, p file.Path) *file.Reference {
+	_, ref, err := t.File(p)
+	if err != nil || ref == nil {
+		return nil
+	}
+	entry, err := l.fileCatalog.Get(*ref)
+	if err != nil {
+		return nil
+	}
+	switch file.Type(entry.Metadata.TypeFlag) {
+	case file.TypeDir:
+		return nil
+	case file.TypeHardLink:
+		return entry.HardlinkTarget
+	}
+	return ref
+}
+
+// hardlinkNames returns all names (the original followed by all hardlinks) for the file with the given original name.
+func (l *Layer) hardlinkNames(original file.Path) []file.Path {
+	var links []file.Path
+	for name, target := range l.hardlinks {
+		if target == original {
+			links = append(links, name)
+		}
+	}
+	l.sortByTarSequence(links)
+	return append([]file.Path{original}, links...)
+}
+
+func (l *Layer) sortByTarSequence(paths []file.Path) {
+	sequence := func(p file.Path) int64 {
+		_, ref, err := l.Tree.File(p)
+		if err != nil || ref == nil {
+			return -1
+		}
+		entry, err := l.fileCatalog.Get(*ref)
+		if err != nil {
+			return -1
+		}
+		return entry.Metadata.TarSequence
+	}
+	sort.SliceStable(paths, func(i, j int) bool {
+		si, sj := sequence(paths[i]), sequence(paths[j])
+		if si != sj {
+			return si < sj
+		}
+		return paths[i] < paths[j]
+	})
+}
+
+// FileIdentity returns the inode-like identity for the given path within the layer tree (no link resolution is
+// performed, however, hardlinks share the identity of the file they refer to).
+func (l *Layer) FileIdentity(p file.Path) (FileIdentity, error) {
+	if l.Tree == nil {
+		return FileIdentity{}, fmt.Errorf("layer has not been read")
+	}
+	original := p
+	if target, ok := l.hardlinks[p]; ok {
+		original = target
+	}
+
+	_, ref, err := l.Tree.File(original)
+	if err != nil {
+		return FileIdentity{}, err
+	}
+	if ref == nil {
+		if original != p {
+			return FileIdentity{}, fmt.Errorf("hardlink=%q refers to a file not in the layer: %q", p, original)
+		}
+		return FileIdentity{}, fmt.Errorf("%w: %q", ErrFileNotFound, p)
+	}
+
+	return FileIdentity{
+		ID:        ref.ID(),
+		LinkCount: len(l.hardlinkNames(original)),
+	}, nil
+}
+
+// HardlinkGroups returns all groups of names within the layer that refer to the same underlying file (only files
+// with at least one hardlink are included), ordered by the original name.
+func (l *Layer) HardlinkGroups() []HardlinkGroup {
+	originals := make(map[file.Path]struct{})
+	for _, target := range l.hardlinks {
+		originals[target] = struct{}{}
+	}
+
+	var groups []HardlinkGroup
+	for original := range originals {
+		identity, err := l.FileIdentity(original)
+		if err != nil {
+			// the original is missing from this layer (e.g. a malformed tar), so there is no meaningful identity
+			continue
+		}
+		groups = append(groups, HardlinkGroup{
+			FileIdentity: identity,
+			Paths:        l.hardlinkNames(original),
+		})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Paths[0] < groups[j].Paths[0]
+	})
+	return groups
+}
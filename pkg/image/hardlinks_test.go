@@ -0,0 +1,125 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newHardlinkTestLayer(t *testing.T) (*Layer, Metadata) {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	writeFile := func(name, contents string) {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Size: int64(len(contents)), Mode: 0755, Typeflag: tar.TypeReg}))
+		_, err := tw.Write([]byte(contents))
+		require.NoError(t, err)
+	}
+	writeLink := func(name, target string) {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Linkname: target, Mode: 0755, Typeflag: tar.TypeLink}))
+	}
+	writeFile("usr/bin/git", "git binary")
+	writeLink("usr/bin/git-upload-pack", "usr/bin/git")
+	writeLink("usr/libexec/git-core/git", "usr/bin/git")
+	writeFile("usr/bin/other", "other")
+	require.NoError(t, tw.Close())
+
+	content := buf.Bytes()
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(content)), nil
+	})
+	require.NoError(t, err)
+	diffID, err := layer.DiffID()
+	require.NoError(t, err)
+
+	return NewLayer(layer), Metadata{
+		Config: v1.ConfigFile{RootFS: v1.RootFS{DiffIDs: []v1.Hash{diffID}}},
+	}
+}
+
+func TestLayer_FileIdentity(t *testing.T) {
+	l, imgMetadata := newHardlinkTestLayer(t)
+	catalog := NewFileCatalog()
+	require.NoError(t, l.Read(&catalog, imgMetadata, 0, t.TempDir()))
+
+	// hardlinked content is only counted once
+	assert.Equal(t, int64(len("git binary")+len("other")), l.Metadata.Size)
+
+	git, err := l.FileIdentity("/usr/bin/git")
+	require.NoError(t, err)
+	assert.Equal(t, 3, git.LinkCount)
+
+	for _, p := range []file.Path{"/usr/bin/git-upload-pack", "/usr/libexec/git-core/git"} {
+		identity, err := l.FileIdentity(p)
+		require.NoError(t, err)
+		assert.Equal(t, git, identity, p)
+	}
+
+	other, err := l.FileIdentity("/usr/bin/other")
+	require.NoError(t, err)
+	assert.Equal(t, 1, other.LinkCount)
+	assert.NotEqual(t, git.ID, other.ID)
+
+	_, err = l.FileIdentity("/usr/bin/missing")
+	assert.ErrorIs(t, err, ErrFileNotFound)
+
+	groups := l.HardlinkGroups()
+	require.Len(t, groups, 1)
+	assert.Equal(t, git, groups[0].FileIdentity)
+	assert.Equal(t, []file.Path{"/usr/bin/git", "/usr/bin/git-upload-pack", "/usr/libexec/git-core/git"}, groups[0].Paths)
+}
+
+func TestImage_HardlinkContentResolution(t *testing.T) {
+	img := newTestImageFromLayers(t, []v1.Layer{
+		newTestTarLayer(t,
+			testTarEntry{name: "usr/bin/tool", contents: "original"},
+			testTarEntry{name: "usr/bin/tool-alias", linkname: "usr/bin/tool", typeflag: tar.TypeLink},
+		),
+		newTestTarLayer(t,
+			// links to a file from a lower layer
+			testTarEntry{name: "opt/tool", linkname: "usr/bin/tool", typeflag: tar.TypeLink},
+			// links to a hardlink from a lower layer
+			testTarEntry{name: "opt/tool-alias", linkname: "usr/bin/tool-alias", typeflag: tar.TypeLink},
+		),
+		newTestTarLayer(t,
+			// the original name is replaced, which must not affect existing hardlinks
+			testTarEntry{name: "usr/bin/tool", contents: "replaced"},
+			testTarEntry{name: "usr/bin/.wh.tool-alias"},
+		),
+	})
+
+	readAll := func(r io.ReadCloser, err error) string {
+		t.Helper()
+		require.NoError(t, err)
+		defer r.Close()
+		b, err := ioutil.ReadAll(r)
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	assert.Equal(t, "original", readAll(img.Layers[0].FileContents("/usr/bin/tool-alias")))
+	assert.Equal(t, "original", readAll(img.Layers[1].FileContentsFromSquash("/opt/tool")))
+	assert.Equal(t, "original", readAll(img.FileContentsFromSquash("/opt/tool")))
+	assert.Equal(t, "original", readAll(img.FileContentsFromSquash("/opt/tool-alias")))
+	assert.Equal(t, "replaced", readAll(img.FileContentsFromSquash("/usr/bin/tool")))
+
+	_, ref, err := img.SquashedTree().File("/opt/tool-alias")
+	require.NoError(t, err)
+	require.NotNil(t, ref)
+	assert.Equal(t, "original", readAll(img.FileContentsByRef(*ref)))
+
+	entry, err := img.FileCatalog.Get(*ref)
+	require.NoError(t, err)
+	require.NotNil(t, entry.HardlinkTarget)
+	_, original, err := img.Layers[0].Tree.File("/usr/bin/tool")
+	require.NoError(t, err)
+	assert.Equal(t, original.ID(), entry.HardlinkTarget.ID())
+}
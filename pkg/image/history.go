@@ -0,0 +1,68 @@
+package image
+
+import (
+	"fmt"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// HistoryEntry aligns a single image config history entry with the layer it produced (if any).
+type HistoryEntry struct {
+	// Index is the position of the entry within the image config history
+	Index int
+	// History is the raw config history entry (creation time, created_by command, author, comment)
+	History v1.History
+	// Layer is the layer produced by the history entry (nil for empty layer entries, e.g. ENV or LABEL instructions,
+	// or when the history describes more layers than the image has)
+	Layer *Layer
+}
+
+// CreatedBy returns the command that created the history entry (e.g. the Dockerfile instruction).
+func (e HistoryEntry) CreatedBy() string {
+	return e.History.CreatedBy
+}
+
+// History returns all image config history entries aligned with the layers they produced, in config order. Entries
+// marked as empty layers do not consume a layer, all other entries are matched to layers in order.
+func (i *Image) History() []HistoryEntry {
+	entries := make([]HistoryEntry, 0, len(i.Metadata.Config.History))
+	layerIdx := 0
+	for idx, h := range i.Metadata.Config.History {
+		entry := HistoryEntry{
+			Index:   idx,
+			History: h,
+		}
+		if !h.EmptyLayer {
+			if layerIdx < len(i.Layers) {
+				entry.Layer = i.Layers[layerIdx]
+			}
+			layerIdx++
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// LayerForHistoryEntry returns the layer produced by the config history entry at the given index (nil without error
+// if the entry did not produce a layer).
+func (i *Image) LayerForHistoryEntry(idx int) (*Layer, error) {
+	history := i.History()
+	if idx < 0 || idx >= len(history) {
+		return nil, fmt.Errorf("history entry index=%d out of range (image has %d entries)", idx, len(history))
+	}
+	return history[idx].Layer, nil
+}
+
+// HistoryForLayer returns the config history entry that produced the layer at the given index, which can be used to
+// attribute the files within the layer to the instruction that added them.
+func (i *Image) HistoryForLayer(layerIdx int) (*HistoryEntry, error) {
+	if layerIdx < 0 || layerIdx >= len(i.Layers) {
+		return nil, fmt.Errorf("layer index=%d out of range (image has %d layers)", layerIdx, len(i.Layers))
+	}
+	for _, entry := range i.History() {
+		if entry.Layer == i.Layers[layerIdx] {
+			return &entry, nil
+		}
+	}
+	return nil, fmt.Errorf("no history entry for layer index=%d", layerIdx)
+}
@@ -0,0 +1,59 @@
+package image
+
+import (
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImage_History(t *testing.T) {
+	v1Image, err := mutate.AppendLayers(empty.Image,
+		newTestTarLayer(t, testTarEntry{name: "bin/sh", contents: "shell"}),
+		newTestTarLayer(t, testTarEntry{name: "app/run", contents: "app"}),
+	)
+	require.NoError(t, err)
+	cfg, err := v1Image.ConfigFile()
+	require.NoError(t, err)
+	cfg = cfg.DeepCopy()
+	cfg.History = []v1.History{
+		{CreatedBy: "ADD rootfs.tar /"},
+		{CreatedBy: "ENV PATH=/bin", EmptyLayer: true},
+		{CreatedBy: "COPY run /app/run"},
+		{CreatedBy: "CMD [\"/app/run\"]", EmptyLayer: true},
+	}
+	v1Image, err = mutate.ConfigFile(v1Image, cfg)
+	require.NoError(t, err)
+
+	img := NewImage(v1Image, t.TempDir())
+	require.NoError(t, img.Read())
+
+	history := img.History()
+	require.Len(t, history, 4)
+	assert.Equal(t, img.Layers[0], history[0].Layer)
+	assert.Nil(t, history[1].Layer)
+	assert.Equal(t, img.Layers[1], history[2].Layer)
+	assert.Nil(t, history[3].Layer)
+	assert.Equal(t, "COPY run /app/run", history[2].CreatedBy())
+
+	layer, err := img.LayerForHistoryEntry(2)
+	require.NoError(t, err)
+	assert.Equal(t, img.Layers[1], layer)
+
+	layer, err = img.LayerForHistoryEntry(1)
+	require.NoError(t, err)
+	assert.Nil(t, layer)
+
+	_, err = img.LayerForHistoryEntry(4)
+	assert.Error(t, err)
+
+	entry, err := img.HistoryForLayer(1)
+	require.NoError(t, err)
+	assert.Equal(t, 2, entry.Index)
+
+	_, err = img.HistoryForLayer(2)
+	assert.Error(t, err)
+}
@@ -0,0 +1,154 @@
+package httparchive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/anchore/stereoscope/internal/log"
+)
+
+// maxDownloadAttempts is the number of times a download is attempted (resuming from the last received byte when the
+// server supports range requests) before giving up.
+const maxDownloadAttempts = 5
+
+// errNotResumable is returned when an interrupted download cannot be resumed (the server does not support range
+// requests or the content changed since the download started).
+var errNotResumable = errors.New("download cannot be resumed")
+
+// download streams the content at the given URL into the file at the given path. When the connection is interrupted
+// the download is resumed from the last received byte using a range request (conditional on the content not changing,
+// via If-Range), otherwise the download is restarted.
+func download(ctx context.Context, client *http.Client, url, dest string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("unable to create archive request for %q: %w", url, err)
+	}
+
+	fh, err := os.Create(dest)
+	if err != nil {
+		return fmt.Errorf("unable to create archive file=%q: %w", dest, err)
+	}
+	defer fh.Close()
+
+	var state downloadState
+	var lastErr error
+	for attempt := 1; attempt <= maxDownloadAttempts; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		lastErr = state.fetch(client, req.Clone(ctx), fh)
+		if lastErr == nil {
+			return fh.Close()
+		}
+		var statusErr *statusError
+		if errors.As(lastErr, &statusErr) || ctx.Err() != nil {
+			// the server rejected the request, there is no reason to retry
+			return lastErr
+		}
+		log.Debugf("archive download attempt=%d of %q interrupted after %d bytes: %+v", attempt, url, state.written, lastErr)
+	}
+	return fmt.Errorf("unable to download archive from %q after %d attempts: %w", url, maxDownloadAttempts, lastErr)
+}
+
+// statusError is an unexpected HTTP response status.
+type statusError struct {
+	url    string
+	status string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected response status from %q: %s", e.url, e.status)
+}
+
+// downloadState is the progress of a download across attempts.
+type downloadState struct {
+	// written is the number of bytes already written to the destination file
+	written int64
+	// validator is the ETag (or Last-Modified time) of the content being downloaded, used to resume
+	validator string
+	// resumable indicates that the server supports range requests for the content
+	resumable bool
+}
+
+func (s *downloadState) fetch(client *http.Client, req *http.Request, fh *os.File) error {
+	url := req.URL.String()
+	resuming := s.written > 0 && s.resumable
+	if resuming {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", s.written))
+		if s.validator != "" {
+			req.Header.Set("If-Range", s.validator)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resuming && resp.StatusCode == http.StatusPartialContent:
+		if start, ok := contentRangeStart(resp.Header.Get("Content-Range")); !ok || start != s.written {
+			// restart from the beginning on the next attempt
+			s.resumable = false
+			return fmt.Errorf("%w: unexpected content range=%q", errNotResumable, resp.Header.Get("Content-Range"))
+		}
+	case resp.StatusCode == http.StatusOK:
+		// either the first attempt, or the server could not resume (restart from the beginning)
+		if s.written > 0 {
+			log.Debugf("restarting archive download of %q from the beginning", url)
+		}
+		if err := s.restart(fh); err != nil {
+			return err
+		}
+		s.resumable = strings.EqualFold(resp.Header.Get("Accept-Ranges"), "bytes")
+		s.validator = resp.Header.Get("ETag")
+		if s.validator == "" || strings.HasPrefix(s.validator, "W/") {
+			// weak validators cannot be used with If-Range
+			s.validator = resp.Header.Get("Last-Modified")
+		}
+	default:
+		return &statusError{url: url, status: resp.Status}
+	}
+
+	n, err := io.Copy(fh, resp.Body)
+	s.written += n
+	if err != nil {
+		return err
+	}
+	if resp.ContentLength >= 0 && n != resp.ContentLength {
+		return fmt.Errorf("received %d of %d bytes: %w", n, resp.ContentLength, io.ErrUnexpectedEOF)
+	}
+	return nil
+}
+
+func (s *downloadState) restart(fh *os.File) error {
+	s.written = 0
+	if err := fh.Truncate(0); err != nil {
+		return err
+	}
+	_, err := fh.Seek(0, io.SeekStart)
+	return err
+}
+
+// contentRangeStart returns the first byte position of a "bytes <start>-<end>/<size>" Content-Range header.
+func contentRangeStart(contentRange string) (int64, bool) {
+	if !strings.HasPrefix(contentRange, "bytes ") {
+		return 0, false
+	}
+	fields := strings.SplitN(strings.TrimPrefix(contentRange, "bytes "), "-", 2)
+	if len(fields) != 2 {
+		return 0, false
+	}
+	start, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return start, true
+}
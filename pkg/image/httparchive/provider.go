@@ -0,0 +1,75 @@
+package httparchive
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/anchore/stereoscope/pkg/image/archive"
+)
+
+// ArchiveImageProvider is an image.Provider for a docker archive, OCI archive, or Singularity image served over
+// HTTP(S) (e.g. "https://example.com/image.tar"). The archive is streamed into the temp dir of the provider (resuming
+// with range requests when the connection is interrupted) and then provided based on the archive format (see
+// archive.ImageProvider).
+type ArchiveImageProvider struct {
+	url       string
+	tmpDirGen *file.TempDirGenerator
+	client    *http.Client
+	platform  *image.Platform
+}
+
+// NewProviderFromURL creates a new provider instance for the image archive at the given HTTP(S) URL. The given client
+// is used for all requests (http.DefaultClient when nil).
+func NewProviderFromURL(archiveURL string, tmpDirGen *file.TempDirGenerator, client *http.Client, platform *image.Platform) *ArchiveImageProvider {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &ArchiveImageProvider{
+		url:       archiveURL,
+		tmpDirGen: tmpDirGen,
+		client:    client,
+		platform:  platform,
+	}
+}
+
+// Provide an image object that represents the image archive at the configured URL.
+func (p *ArchiveImageProvider) Provide(ctx context.Context, metadata ...image.AdditionalMetadata) (*image.Image, error) {
+	u, err := url.Parse(p.url)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse archive URL=%q: %w", p.url, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported archive URL scheme=%q (only http and https are supported)", u.Scheme)
+	}
+
+	tempDir, err := p.tmpDirGen.NewDirectory("http-archive")
+	if err != nil {
+		return nil, err
+	}
+
+	archivePath := filepath.Join(tempDir, archiveFileName(u))
+	if err := download(ctx, p.client, p.url, archivePath); err != nil {
+		return nil, err
+	}
+
+	img, err := archive.NewProviderFromPath(archivePath, p.tmpDirGen, p.platform).Provide(ctx, metadata...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to provide image from URL=%q: %w", p.url, err)
+	}
+	return img, nil
+}
+
+// archiveFileName returns a filesystem-safe name for the downloaded archive based on the URL path.
+func archiveFileName(u *url.URL) string {
+	name := path.Base(u.Path)
+	if name == "." || name == "/" || name == "" {
+		return "archive"
+	}
+	return name
+}
@@ -0,0 +1,134 @@
+package httparchive
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+func TestArchiveImageProvider_Provide(t *testing.T) {
+	img, err := random.Image(1024, 2)
+	require.NoError(t, err)
+	tag, err := name.NewTag("example.com/repo:latest")
+	require.NoError(t, err)
+	archive := &bytes.Buffer{}
+	require.NoError(t, tarball.Write(tag, img, archive))
+	content := archive.Bytes()
+
+	expectedID, err := img.ConfigName()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		interrupt    bool
+		etag         string
+		wantRequests int
+		wantRanges   []string
+	}{
+		{
+			name:         "single request",
+			wantRequests: 1,
+			wantRanges:   []string{""},
+		},
+		{
+			name:         "interrupted download is resumed",
+			interrupt:    true,
+			etag:         `"v1"`,
+			wantRequests: 2,
+			wantRanges:   []string{"", "bytes=" + strconv.Itoa(len(content)/2) + "-"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var lock sync.Mutex
+			var ranges []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				lock.Lock()
+				ranges = append(ranges, r.Header.Get("Range"))
+				first := len(ranges) == 1
+				lock.Unlock()
+
+				if test.etag != "" {
+					w.Header().Set("ETag", test.etag)
+				}
+				if test.interrupt && first {
+					w.Header().Set("Accept-Ranges", "bytes")
+					w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+					_, _ = w.Write(content[:len(content)/2])
+					w.(http.Flusher).Flush()
+					// drop the connection mid-transfer
+					panic(http.ErrAbortHandler)
+				}
+				http.ServeContent(w, r, "image.tar", time.Time{}, bytes.NewReader(content))
+			}))
+			defer server.Close()
+
+			generator := file.NewTempDirGenerator("stereoscope-http-archive-test")
+			defer generator.Cleanup()
+
+			provided, err := NewProviderFromURL(server.URL+"/images/image.tar", generator, nil, nil).Provide(context.Background())
+			require.NoError(t, err)
+			require.NoError(t, provided.Read())
+
+			assert.Equal(t, expectedID.String(), provided.Metadata.ID)
+			assert.Len(t, provided.Layers, 2)
+			assert.Len(t, ranges, test.wantRequests)
+			assert.Equal(t, test.wantRanges, ranges)
+		})
+	}
+}
+
+func TestArchiveImageProvider_Provide_Errors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing.tar" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("not an archive"))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		url     string
+		wantErr string
+	}{
+		{name: "missing archive", url: server.URL + "/missing.tar", wantErr: "404"},
+		{name: "not an archive", url: server.URL + "/image.txt", wantErr: "unable to detect archive format"},
+		{name: "unsupported scheme", url: "ftp://example.com/image.tar", wantErr: "unsupported archive URL scheme"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			generator := file.NewTempDirGenerator("stereoscope-http-archive-test")
+			defer generator.Cleanup()
+
+			_, err := NewProviderFromURL(test.url, generator, nil, nil).Provide(context.Background())
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.wantErr)
+		})
+	}
+}
+
+func TestContentRangeStart(t *testing.T) {
+	start, ok := contentRangeStart("bytes 100-199/200")
+	assert.True(t, ok)
+	assert.Equal(t, int64(100), start)
+
+	for _, invalid := range []string{"", "bytes */200", "items 1-2/3", "bytes x-2/3"} {
+		_, ok := contentRangeStart(invalid)
+		assert.False(t, ok, invalid)
+	}
+}
@@ -1,10 +1,12 @@
 package image
 
 import (
+	"context"
 	"crypto/sha256"
 	"fmt"
 	"io"
 	"os"
+	"sync"
 
 	"github.com/scylladb/go-set/strset"
 
@@ -33,6 +35,29 @@ type Image struct {
 	FileCatalog FileCatalog
 
 	overrideMetadata []AdditionalMetadata
+	// squashCache is an optional cache of squash trees shared with other images
+	squashCache SquashCacheBackend
+	// metadataOnlyChanges indicates that metadata-only file changes should be detected while squashing
+	metadataOnlyChanges bool
+	// typeChangeWarnings indicates that paths replaced by a different type of file are reported while squashing
+	typeChangeWarnings bool
+	// mergeStrategy is the union semantics used while squashing (see WithMergeStrategy)
+	mergeStrategy MergeStrategy
+	// pathIndex indicates that the image squash tree index is built while squashing (see WithPathIndex)
+	pathIndex bool
+	// sbomFetcher is an optional source of pre-existing SBOM documents for the image
+	sbomFetcher SBOMFetcher
+	// signatureFetcher and attestationFetcher are optional sources of provenance for the image
+	signatureFetcher   SignatureFetcher
+	attestationFetcher AttestationFetcher
+	// referrerFetcher is an optional source of artifacts attached to the image (see Image.Referrers)
+	referrerFetcher ReferrerFetcher
+	// blobRangeReader is an optional source of random access to the layer blobs (see WithBlobRangeReader)
+	blobRangeReader BlobRangeReader
+	// warnings are the non-fatal issues encountered while reading the image (not specific to the content of a layer)
+	warnings []Warning
+	// squashLock guards generating the layer squash trees (which may be deferred until first requested)
+	squashLock sync.Mutex
 }
 
 type AdditionalMetadata func(*Image) error
@@ -47,6 +72,7 @@ func WithTags(tags ...string) AdditionalMetadata {
 			tagObj, err := name.NewTag(t)
 			if err != nil {
 				log.Warnf("unable to parse additional image tag to add %q: %+v", t, err)
+				image.warn(WarningInvalidTag, -1, "unable to parse additional image tag %q: %v", t, err)
 				continue
 			}
 			if !existingTags.Has(tagObj.String()) {
@@ -162,6 +188,20 @@ func (i *Image) trackReadProgress(metadata Metadata) *progress.Manual {
 	return prog
 }
 
+func (i *Image) trackSquashProgress(layers int) *progress.Manual {
+	prog := &progress.Manual{
+		Total: int64(layers),
+	}
+
+	bus.Publish(partybus.Event{
+		Type:   event.SquashImage,
+		Source: i.Metadata,
+		Value:  progress.Progressable(prog),
+	})
+
+	return prog
+}
+
 func (i *Image) applyOverrideMetadata() error {
 	for _, optionFn := range i.overrideMetadata {
 		if err := optionFn(i); err != nil {
@@ -173,9 +213,22 @@ func (i *Image) applyOverrideMetadata() error {
 
 // Read parses information from the underlying image tar into this struct. This includes image metadata, layer
 // metadata, layer file trees, and layer squash trees (which implies the image squash tree).
-func (i *Image) Read() error {
-	var layers = make([]*Layer, 0)
+func (i *Image) Read(options ...ReadOption) error {
+	return i.ReadWithContext(context.Background(), options...)
+}
+
+// ReadWithContext is the same as Read, however, fetching layer content, indexing layer tars, and squashing are all
+// stopped once the given context is done. Progress published to the event bus up to that point is marked with the
+// cancellation error.
+func (i *Image) ReadWithContext(ctx context.Context, options ...ReadOption) error {
 	var err error
+	// never append to the caller's slice (which may be shared)
+	options = append(options[:len(options):len(options)], withContext(ctx))
+	cfg := newReadConfig(options...)
+	if err = i.requireImageContent(); err != nil {
+		return fmt.Errorf("unable to read image: %w", err)
+	}
+	i.warnings = nil
 	i.Metadata, err = readImageMetadata(i.image)
 	if err != nil {
 		return err
@@ -185,6 +238,14 @@ func (i *Image) Read() error {
 	if err = i.applyOverrideMetadata(); err != nil {
 		return err
 	}
+	i.Metadata.Annotations = manifestAnnotations(i.Metadata)
+	if i.blobRangeReader != nil {
+		options = append(options, withBlobRangeReader(i.blobRangeReader))
+	}
+
+	if err = i.checkPlatform(cfg); err != nil {
+		return err
+	}
 
 	log.Debugf("image metadata: digest=%+v mediaType=%+v tags=%+v",
 		i.Metadata.ID,
@@ -195,61 +256,204 @@ func (i *Image) Read() error {
 	if err != nil {
 		return err
 	}
+	// the layer digests are taken from the config, which must describe every layer (however crafted the config is)
+	if diffIDs := len(i.Metadata.Config.RootFS.DiffIDs); diffIDs != len(v1Layers) {
+		return fmt.Errorf("image config has %d diff IDs for %d layers", diffIDs, len(v1Layers))
+	}
 
 	// let consumers know of a monitorable event (image save + copy stages)
 	readProg := i.trackReadProgress(i.Metadata)
 
-	for idx, v1Layer := range v1Layers {
-		layer := NewLayer(v1Layer)
-		err := layer.Read(&i.FileCatalog, i.Metadata, idx, i.contentCacheDir)
-		if err != nil {
-			return err
-		}
-		i.Metadata.Size += layer.Metadata.Size
-		layers = append(layers, layer)
-
-		readProg.N++
+	layers, err := i.readLayers(ctx, cfg, v1Layers, readProg, options...)
+	if err != nil {
+		return err
 	}
 
 	i.Layers = layers
+	i.bindSquashTrees()
+	i.checkHistory()
+
+	i.squashCache = cfg.squashCache
+	i.metadataOnlyChanges = cfg.metadataOnlyChanges
+	i.typeChangeWarnings = cfg.typeChangeWarnings
+	i.mergeStrategy = cfg.mergeStrategy
+	i.pathIndex = cfg.pathIndex
+	i.FileCatalog.setReadAudit(cfg.readAudit)
+
+	if cfg.deferSquash {
+		readProg.SetCompleted()
+		return nil
+	}
 
 	// in order to resolve symlinks all squashed trees must be available
-	return i.squash(readProg)
+	return i.squash(ctx, readProg)
+}
+
+// Squash generates the squash tree for each layer in the image, replacing any previously generated squash trees. This
+// only needs to be called explicitly when the image was read with WithDeferredSquash or when the set of layers has
+// been modified since the read.
+func (i *Image) Squash(ctx context.Context) error {
+	return i.squash(ctx, &progress.Manual{Total: int64(len(i.Layers))})
+}
+
+// IsSquashed indicates if the squash trees for all image layers have been generated.
+func (i *Image) IsSquashed() bool {
+	i.squashLock.Lock()
+	defer i.squashLock.Unlock()
+
+	for _, layer := range i.Layers {
+		if layer.SquashedTree == nil {
+			return false
+		}
+	}
+	return true
 }
 
 // squash generates a squash tree for each layer in the image. For instance, layer 2 squash =
 // squash(layer 0, layer 1, layer 2), layer 3 squash = squash(layer 0, layer 1, layer 2, layer 3), and so on.
-func (i *Image) squash(prog *progress.Manual) error {
-	var lastSquashTree *filetree.FileTree
+func (i *Image) squash(ctx context.Context, prog *progress.Manual) error {
+	i.squashLock.Lock()
+	defer i.squashLock.Unlock()
 
+	if err := i.squashLayers(ctx, prog, 0, len(i.Layers)-1); err != nil {
+		return err
+	}
+	if i.pathIndex && len(i.Layers) > 0 {
+		i.Layers[len(i.Layers)-1].SquashedTree.Index()
+	}
+	return nil
+}
+
+// bindSquashTrees sets the source of the squash tree of each layer to this image, so squash trees that have not yet
+// been generated are generated when requested through the layer (see Layer.FileContentsFromSquash).
+func (i *Image) bindSquashTrees() {
 	for idx, layer := range i.Layers {
+		idx := idx
+		layer.squashTree = func() (*filetree.FileTree, error) {
+			return i.FilesystemAt(idx)
+		}
+	}
+}
+
+// squashLayers generates the squash trees for the layers with indexes within [from, through], which requires the
+// squash tree of the layer below from (if any) to already be generated.
+func (i *Image) squashLayers(ctx context.Context, prog *progress.Manual, from, through int) error {
+	squashProg := i.trackSquashProgress(through - from + 1)
+	var lastSquashTree *filetree.FileTree
+	if from > 0 {
+		lastSquashTree = i.Layers[from-1].SquashedTree
+	}
+	var chainIDs []string
+	var origins map[file.ID]int
+	if i.squashCache != nil {
+		chainIDs = i.mergeStrategy.chainIDs(layerChainIDs(i.Layers))
+		origins = make(map[file.ID]int)
+	}
+
+	for idx := 0; idx <= through; idx++ {
+		layer := i.Layers[idx]
+		if origins != nil {
+			for _, ref := range layer.Tree.AllFiles(file.AllTypes...) {
+				origins[ref.ID()] = idx
+			}
+		}
+		if idx < from {
+			continue
+		}
+
+		if err := ctx.Err(); err != nil {
+			prog.Err = err
+			squashProg.Err = err
+			return fmt.Errorf("squash canceled: %w", err)
+		}
+
 		if idx == 0 {
 			lastSquashTree = layer.Tree
 			layer.SquashedTree = layer.Tree
+			squashProg.N++
 			continue
 		}
 
-		var unionTree = filetree.NewUnionFileTree()
-		unionTree.PushTree(lastSquashTree)
-		unionTree.PushTree(layer.Tree)
-
-		squashedTree, err := unionTree.Squash()
+		squashedTree, err := i.squashLayer(ctx, idx, lastSquashTree, chainIDs, origins)
 		if err != nil {
+			squashProg.Err = err
 			return fmt.Errorf("failed to squash tree %d: %w", idx, err)
 		}
 
+		layer.bindHardlinks(lastSquashTree)
+		if i.metadataOnlyChanges {
+			i.attributeMetadataOnlyChanges(layer, lastSquashTree)
+		}
+		if i.typeChangeWarnings {
+			i.reportTypeChanges(layer, lastSquashTree)
+		}
+
 		layer.SquashedTree = squashedTree
 		lastSquashTree = squashedTree
 
 		prog.N++
+		squashProg.N++
 	}
 
 	prog.SetCompleted()
+	squashProg.SetCompleted()
 
 	return nil
 }
 
-// SquashedTree returns the pre-computed image squash file tree.
+// squashLayer generates the squash tree for the layer at the given index from the squash tree of the layer below it,
+// preferring a previously cached squash tree for the same layer chain (if a squash cache is configured).
+func (i *Image) squashLayer(ctx context.Context, idx int, lowerSquashTree *filetree.FileTree, chainIDs []string, origins map[file.ID]int) (*filetree.FileTree, error) {
+	var chainID string
+	if i.squashCache != nil {
+		chainID = chainIDs[idx]
+	}
+
+	if chainID != "" {
+		cached, err := i.cachedSquashTree(ctx, chainID)
+		if err != nil {
+			log.Warnf("unable to use cached squash tree for layer=%d: %+v", idx, err)
+			i.warn(WarningInvalidCache, idx, "unable to use cached squash tree: %v", err)
+		} else if cached != nil {
+			return cached, nil
+		}
+	}
+
+	var unionTree = filetree.NewUnionFileTreeWithStrategy(i.mergeStrategy.filetreeStrategy(&i.FileCatalog))
+	unionTree.PushTree(lowerSquashTree)
+	unionTree.PushTree(i.Layers[idx].Tree)
+
+	squashedTree, err := unionTree.Squash()
+	if err != nil {
+		return nil, err
+	}
+
+	if chainID != "" {
+		entry, err := newSquashCacheEntry(squashedTree, origins)
+		if err == nil {
+			err = i.squashCache.Put(ctx, chainID, entry)
+		}
+		if err != nil {
+			// the cache is only an optimization, the squash is still valid
+			log.Warnf("unable to cache squash tree for layer=%d: %+v", idx, err)
+			i.warn(WarningInvalidCache, idx, "unable to cache squash tree: %v", err)
+		}
+	}
+
+	return squashedTree, nil
+}
+
+// cachedSquashTree returns the squash tree for the given layer chain from the squash cache (nil if not cached).
+func (i *Image) cachedSquashTree(ctx context.Context, chainID string) (*filetree.FileTree, error) {
+	entry, err := i.squashCache.Get(ctx, chainID)
+	if err != nil || entry == nil {
+		return nil, err
+	}
+	return entry.tree(i.Layers)
+}
+
+// SquashedTree returns the pre-computed image squash file tree. If the squash has not yet been generated (see
+// WithDeferredSquash) it is generated now, and an empty tree is returned if that fails (see SquashedSearchContext).
 func (i *Image) SquashedTree() *filetree.FileTree {
 	layerCount := len(i.Layers)
 
@@ -257,21 +461,78 @@ func (i *Image) SquashedTree() *filetree.FileTree {
 		return filetree.NewFileTree()
 	}
 
-	topLayer := i.Layers[layerCount-1]
-	return topLayer.SquashedTree
+	tree, err := i.FilesystemAt(layerCount - 1)
+	if err != nil {
+		log.Errorf("unable to squash image: %+v", err)
+		return filetree.NewFileTree()
+	}
+	return tree
+}
+
+// SquashedSearchContext returns the image squash tree to search (e.g. with FilesByGlob), generating it now when the
+// squash was deferred (see WithDeferredSquash). Unlike SquashedTree, any error generating the squash tree is returned
+// rather than an empty tree.
+func (i *Image) SquashedSearchContext() (*filetree.FileTree, error) {
+	return i.imageSquashTree()
+}
+
+// FilesystemAt returns the squash tree as of the layer at the given index (in build order), that is the cumulative
+// view of the filesystem after the layer was applied (see Layer.SquashedTree), for instance to scrub through the
+// image history layer by layer. Squash trees that have not yet been generated (see WithDeferredSquash) are generated
+// for that layer and the layers below it only, and are kept for later calls.
+func (i *Image) FilesystemAt(layerIndex int) (*filetree.FileTree, error) {
+	if layerIndex < 0 || layerIndex >= len(i.Layers) {
+		return nil, fmt.Errorf("invalid layer index=%d (image has %d layers)", layerIndex, len(i.Layers))
+	}
+
+	i.squashLock.Lock()
+	defer i.squashLock.Unlock()
+
+	layer := i.Layers[layerIndex]
+	if layer.SquashedTree != nil {
+		return layer.SquashedTree, nil
+	}
+
+	// resume from the highest layer below that is already squashed
+	from := layerIndex
+	for from > 0 && i.Layers[from-1].SquashedTree == nil {
+		from--
+	}
+	prog := &progress.Manual{Total: int64(layerIndex - from + 1)}
+	if err := i.squashLayers(context.Background(), prog, from, layerIndex); err != nil {
+		return nil, fmt.Errorf("unable to squash layers through layer=%d: %w", layerIndex, err)
+	}
+	return layer.SquashedTree, nil
+}
+
+// imageSquashTree returns the image squash tree (the same as SquashedTree), however, any error generating a deferred
+// squash is returned.
+func (i *Image) imageSquashTree() (*filetree.FileTree, error) {
+	if len(i.Layers) == 0 {
+		return filetree.NewFileTree(), nil
+	}
+	return i.FilesystemAt(len(i.Layers) - 1)
 }
 
 // FileContentsFromSquash fetches file contents for a single path, relative to the image squash tree.
 // If the path does not exist an error is returned.
 func (i *Image) FileContentsFromSquash(path file.Path) (io.ReadCloser, error) {
-	return fetchFileContentsByPath(i.SquashedTree(), &i.FileCatalog, path)
+	tree, err := i.imageSquashTree()
+	if err != nil {
+		return nil, err
+	}
+	return fetchFileContentsByPath(tree, &i.FileCatalog, path)
 }
 
 // FilesByMIMETypeFromSquash returns file references for files that match at least one of the given MIME types.
 func (i *Image) FilesByMIMETypeFromSquash(mimeTypes ...string) ([]file.Reference, error) {
+	tree, err := i.imageSquashTree()
+	if err != nil {
+		return nil, err
+	}
 	var refs []file.Reference
 	for _, ty := range mimeTypes {
-		refsForType, err := fetchFilesByMIMEType(i.SquashedTree(), &i.FileCatalog, ty)
+		refsForType, err := fetchFilesByMIMEType(tree, &i.FileCatalog, ty)
 		if err != nil {
 			return nil, err
 		}
@@ -286,20 +547,69 @@ func (i *Image) FileContentsByRef(ref file.Reference) (io.ReadCloser, error) {
 	return i.FileCatalog.FileContents(ref)
 }
 
+// FileContentsVerified fetches file contents for a single file reference (the same as FileContentsByRef), however, all
+// content read is verified against the digest recorded for the file (see WithFileDigests). Once the content has been
+// read in full, an error wrapping file.ErrDigestMismatch is returned on any discrepancy. If no digest has been
+// recorded, the digest is computed from the current content and recorded for future reads.
+func (i *Image) FileContentsVerified(ref file.Reference) (io.ReadCloser, error) {
+	entry, err := i.FileCatalog.Get(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	digest, err := i.fileDigest(ref, entry)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := i.FileCatalog.FileContents(ref)
+	if err != nil {
+		return nil, err
+	}
+	return file.NewDigestVerifyingReadCloser(reader, digest), nil
+}
+
+// fileDigest returns the content digest recorded for the given catalog entry, computing (and recording) the digest
+// from the file contents when it was not recorded during indexing.
+func (i *Image) fileDigest(ref file.Reference, entry FileCatalogEntry) (string, error) {
+	if entry.Metadata.Digest != "" {
+		return entry.Metadata.Digest, nil
+	}
+	reader, err := i.FileCatalog.FileContents(ref)
+	if err != nil {
+		return "", err
+	}
+	digest, err := file.Digest(reader)
+	_ = reader.Close()
+	if err != nil {
+		return "", fmt.Errorf("unable to digest path=%q: %w", ref.RealPath, err)
+	}
+	i.FileCatalog.setDigest(ref, digest)
+	return digest, nil
+}
+
 // ResolveLinkByLayerSquash resolves a symlink or hardlink for the given file reference relative to the result from
 // the layer squash of the given layer index argument.
 // If the given file reference is not a link type, or is a unresolvable (dead) link, then the given file reference is returned.
 func (i *Image) ResolveLinkByLayerSquash(ref file.Reference, layer int, options ...filetree.LinkResolutionOption) (*file.Reference, error) {
+	tree, err := i.FilesystemAt(layer)
+	if err != nil {
+		return nil, err
+	}
 	allOptions := append([]filetree.LinkResolutionOption{filetree.FollowBasenameLinks}, options...)
-	_, resolvedRef, err := i.Layers[layer].SquashedTree.File(ref.RealPath, allOptions...)
+	_, resolvedRef, err := tree.File(ref.RealPath, allOptions...)
 	return resolvedRef, err
 }
 
 // ResolveLinkByImageSquash resolves a symlink or hardlink for the given file reference relative to the result from the image squash.
 // If the given file reference is not a link type, or is a unresolvable (dead) link, then the given file reference is returned.
 func (i *Image) ResolveLinkByImageSquash(ref file.Reference, options ...filetree.LinkResolutionOption) (*file.Reference, error) {
+	tree, err := i.FilesystemAt(len(i.Layers) - 1)
+	if err != nil {
+		return nil, err
+	}
 	allOptions := append([]filetree.LinkResolutionOption{filetree.FollowBasenameLinks}, options...)
-	_, resolvedRef, err := i.Layers[len(i.Layers)-1].SquashedTree.File(ref.RealPath, allOptions...)
+	_, resolvedRef, err := tree.File(ref.RealPath, allOptions...)
 	return resolvedRef, err
 }
 
@@ -313,5 +623,8 @@ func (i *Image) Cleanup() error {
 			return err
 		}
 	}
+	for _, layer := range i.Layers {
+		layer.releaseCacheBudget()
+	}
 	return nil
 }
@@ -0,0 +1,99 @@
+package image
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// runtimeConfig returns the execution parameters of the image config. Images built by early docker versions only
+// describe these within "container_config" (the config of the build container) and leave "config" empty, in which case
+// the "container_config" is used instead.
+func (i *Image) runtimeConfig() v1.Config {
+	config := i.Metadata.Config.Config
+	if !reflect.DeepEqual(config, v1.Config{}) || len(i.Metadata.RawConfig) == 0 {
+		return config
+	}
+	var legacy struct {
+		ContainerConfig v1.Config `json:"container_config"`
+	}
+	if err := json.Unmarshal(i.Metadata.RawConfig, &legacy); err != nil {
+		return config
+	}
+	return legacy.ContainerConfig
+}
+
+// Env returns the environment variables of the image config by name. Variables given without a value (no "=") have
+// an empty value, and the last definition of a repeated variable is used (as with a container runtime).
+func (i *Image) Env() map[string]string {
+	env := make(map[string]string)
+	for _, entry := range i.runtimeConfig().Env {
+		if entry == "" {
+			continue
+		}
+		key, value := entry, ""
+		if idx := strings.Index(entry, "="); idx >= 0 {
+			key, value = entry[:idx], entry[idx+1:]
+		}
+		env[key] = value
+	}
+	return env
+}
+
+// Entrypoint returns the entrypoint of the image config (empty if not set).
+func (i *Image) Entrypoint() []string {
+	return append([]string{}, i.runtimeConfig().Entrypoint...)
+}
+
+// Cmd returns the default arguments of the image config (to the entrypoint, if any), empty if not set.
+func (i *Image) Cmd() []string {
+	return append([]string{}, i.runtimeConfig().Cmd...)
+}
+
+// Labels returns the labels of the image config (empty if not set).
+func (i *Image) Labels() map[string]string {
+	labels := make(map[string]string)
+	for key, value := range i.runtimeConfig().Labels {
+		labels[key] = value
+	}
+	return labels
+}
+
+// ExposedPorts returns the ports exposed by the image config as "<port>/<protocol>" (sorted). The protocol is
+// normalized to lowercase and ports without a protocol (allowed by the OCI image spec) are given the default "tcp"
+// protocol.
+func (i *Image) ExposedPorts() []string {
+	seen := make(map[string]struct{})
+	ports := []string{}
+	for port := range i.runtimeConfig().ExposedPorts {
+		port = strings.ToLower(strings.TrimSpace(port))
+		if port == "" {
+			continue
+		}
+		if !strings.Contains(port, "/") {
+			port += "/tcp"
+		}
+		if _, ok := seen[port]; ok {
+			continue
+		}
+		seen[port] = struct{}{}
+		ports = append(ports, port)
+	}
+	sort.Strings(ports)
+	return ports
+}
+
+// User returns the user (and optionally the group, as "user:group") that the image config runs as. Either may be a
+// name or numeric ID. Empty means the default user of the container runtime (typically root).
+func (i *Image) User() string {
+	return i.runtimeConfig().User
+}
+
+// WorkingDir returns the working directory of the image config. Empty means the default of the container runtime
+// (typically "/").
+func (i *Image) WorkingDir() string {
+	return i.runtimeConfig().WorkingDir
+}
@@ -0,0 +1,106 @@
+package image
+
+import (
+	"bytes"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestImageWithConfig(t *testing.T, rawConfig string) *Image {
+	t.Helper()
+	config, err := v1.ParseConfigFile(bytes.NewReader([]byte(rawConfig)))
+	require.NoError(t, err)
+	return &Image{
+		Metadata: Metadata{
+			Config:    *config,
+			RawConfig: []byte(rawConfig),
+		},
+	}
+}
+
+func TestImage_ConfigAccessors(t *testing.T) {
+	tests := []struct {
+		name               string
+		rawConfig          string
+		expectedEnv        map[string]string
+		expectedEntrypoint []string
+		expectedCmd        []string
+		expectedLabels     map[string]string
+		expectedPorts      []string
+		expectedUser       string
+		expectedWorkingDir string
+	}{
+		{
+			name: "docker config",
+			rawConfig: `{
+				"architecture": "amd64", "os": "linux",
+				"config": {
+					"Env": ["PATH=/usr/bin:/bin", "EMPTY=", "NOVALUE", "A=1", "A=2", "EQ=a=b"],
+					"Entrypoint": ["/docker-entrypoint.sh"],
+					"Cmd": ["nginx", "-g", "daemon off;"],
+					"Labels": {"maintainer": "someone"},
+					"ExposedPorts": {"80/tcp": {}, "53/UDP": {}},
+					"User": "nginx:nginx",
+					"WorkingDir": "/app"
+				},
+				"container_config": {"Cmd": ["/bin/sh", "-c", "#(nop) CMD [\"nginx\"]"]}
+			}`,
+			expectedEnv:        map[string]string{"PATH": "/usr/bin:/bin", "EMPTY": "", "NOVALUE": "", "A": "2", "EQ": "a=b"},
+			expectedEntrypoint: []string{"/docker-entrypoint.sh"},
+			expectedCmd:        []string{"nginx", "-g", "daemon off;"},
+			expectedLabels:     map[string]string{"maintainer": "someone"},
+			expectedPorts:      []string{"53/udp", "80/tcp"},
+			expectedUser:       "nginx:nginx",
+			expectedWorkingDir: "/app",
+		},
+		{
+			name: "OCI config with ports without a protocol",
+			rawConfig: `{
+				"architecture": "arm64", "os": "linux",
+				"config": {"ExposedPorts": {"8080": {}, "8080/tcp": {}}, "User": "1000"}
+			}`,
+			expectedEnv:        map[string]string{},
+			expectedEntrypoint: []string{},
+			expectedCmd:        []string{},
+			expectedLabels:     map[string]string{},
+			expectedPorts:      []string{"8080/tcp"},
+			expectedUser:       "1000",
+		},
+		{
+			name: "legacy config described only by the container config",
+			rawConfig: `{
+				"architecture": "amd64", "os": "linux",
+				"container_config": {"Env": ["HOME=/root"], "Cmd": ["/bin/bash"], "WorkingDir": "/root"}
+			}`,
+			expectedEnv:        map[string]string{"HOME": "/root"},
+			expectedEntrypoint: []string{},
+			expectedCmd:        []string{"/bin/bash"},
+			expectedLabels:     map[string]string{},
+			expectedPorts:      []string{},
+			expectedWorkingDir: "/root",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			img := newTestImageWithConfig(t, test.rawConfig)
+			assert.Equal(t, test.expectedEnv, img.Env())
+			assert.Equal(t, test.expectedEntrypoint, img.Entrypoint())
+			assert.Equal(t, test.expectedCmd, img.Cmd())
+			assert.Equal(t, test.expectedLabels, img.Labels())
+			assert.Equal(t, test.expectedPorts, img.ExposedPorts())
+			assert.Equal(t, test.expectedUser, img.User())
+			assert.Equal(t, test.expectedWorkingDir, img.WorkingDir())
+		})
+	}
+}
+
+func TestImage_ConfigAccessors_ReturnCopies(t *testing.T) {
+	img := newTestImageWithConfig(t, `{"config": {"Cmd": ["a"], "Labels": {"k": "v"}}}`)
+	img.Cmd()[0] = "changed"
+	img.Labels()["k"] = "changed"
+	assert.Equal(t, []string{"a"}, img.Cmd())
+	assert.Equal(t, map[string]string{"k": "v"}, img.Labels())
+}
@@ -0,0 +1,327 @@
+package image
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree"
+)
+
+// basic interface assertions
+var _ fs.StatFS = (*imageFS)(nil)
+var _ fs.ReadDirFS = (*imageFS)(nil)
+var _ fs.ReadDirFile = (*imageFSFile)(nil)
+var _ io.ReadSeeker = (*imageFSFile)(nil)
+var _ io.ReaderAt = (*imageFSFile)(nil)
+var _ fs.FileInfo = (*imageFSFileInfo)(nil)
+var _ fs.DirEntry = (*imageFSFileInfo)(nil)
+
+// imageFS is a read-only fs.FS view of an image squash tree, where file contents are read from the file catalog.
+type imageFS struct {
+	tree    *filetree.FileTree
+	catalog *FileCatalog
+}
+
+// FS returns the image squash tree as a read-only fs.FS, which can be used with the standard library (e.g. fs.ReadFile,
+// fs.WalkDir, or fs.Glob). Paths are relative to the image root (e.g. "etc/os-release"), symlinks are followed when
+// opening or stating a path (and dead links do not exist), and ReadDir reports entries without following links.
+// Note: mod times are not available and are always reported as the zero time.
+func (i *Image) FS() fs.FS {
+	return &imageFS{
+		tree:    i.SquashedTree(),
+		catalog: &i.FileCatalog,
+	}
+}
+
+// Open opens the named file (following symlinks).
+func (f *imageFS) Open(name string) (fs.File, error) {
+	ref, metadata, err := f.resolve("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return &imageFSFile{
+		fsys: f,
+		name: name,
+		ref:  ref,
+		info: newImageFSFileInfo(name, metadata),
+	}, nil
+}
+
+// Stat returns a FileInfo describing the named file (following symlinks).
+func (f *imageFS) Stat(name string) (fs.FileInfo, error) {
+	_, metadata, err := f.resolve("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return newImageFSFileInfo(name, metadata), nil
+}
+
+// ReadDir reads the named directory, returning all entries sorted by filename (entries for links describe the link).
+func (f *imageFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	_, metadata, err := f.resolve("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if !metadata.IsDir {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+
+	children, err := f.tree.ListPaths(imageFSPath(name))
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	entries := make([]fs.DirEntry, 0, len(children))
+	for _, child := range children {
+		childName := strings.TrimPrefix(string(child), file.DirSeparator)
+		_, childMetadata, err := f.resolve("readdir", childName, false)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, newImageFSFileInfo(childName, childMetadata))
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+// resolve returns the file reference (nil for implicit directories) and metadata for the given fs.FS path, optionally
+// following symlinks (see Image.Lstat).
+func (f *imageFS) resolve(op, name string, follow bool) (*file.Reference, file.Metadata, error) {
+	if !fs.ValidPath(name) {
+		return nil, file.Metadata{}, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	ref, metadata, err := statSquashPath(f.tree, f.catalog, imageFSPath(name), follow)
+	if err != nil {
+		if errors.Is(err, ErrFileNotFound) || errors.Is(err, ErrDeadLink) {
+			err = fs.ErrNotExist
+		}
+		return nil, file.Metadata{}, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	return ref, metadata, nil
+}
+
+// imageFSPath returns the absolute tree path for the given (valid) fs.FS path.
+func imageFSPath(name string) file.Path {
+	if name == "." {
+		return file.DirSeparator
+	}
+	return file.Path(file.DirSeparator + name)
+}
+
+// imageFSName returns the fs.FS path (relative to the image root) for the given absolute or relative OS-style path.
+func imageFSName(name string) string {
+	cleaned := path.Clean(file.DirSeparator + filepath.ToSlash(name))
+	if cleaned == file.DirSeparator {
+		return "."
+	}
+	return cleaned[1:]
+}
+
+// isWriteFlag indicates if the given os.OpenFile flags would modify the file.
+func isWriteFlag(flag int) bool {
+	return flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0
+}
+
+// imageFSFile is an open file within an imageFS. File contents are not fetched until the first read, and are streamed
+// unless random access is needed (Seek or ReadAt), at which point the contents are buffered in memory.
+type imageFSFile struct {
+	fsys   *imageFS
+	name   string
+	ref    *file.Reference
+	info   *imageFSFileInfo
+	reader io.ReadCloser
+	// offset is the number of bytes read from the (streamed) reader
+	offset     int64
+	buffered   *bytes.Reader
+	dirEntries []fs.DirEntry
+	dirOffset  int
+	closed     bool
+}
+
+func (f *imageFSFile) Stat() (fs.FileInfo, error) {
+	if f.closed {
+		return nil, &fs.PathError{Op: "stat", Path: f.name, Err: fs.ErrClosed}
+	}
+	return f.info, nil
+}
+
+func (f *imageFSFile) Read(b []byte) (int, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrClosed}
+	}
+	if f.info.IsDir() {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: errors.New("is a directory")}
+	}
+	if f.buffered != nil {
+		return f.buffered.Read(b)
+	}
+	if f.reader == nil {
+		reader, err := f.open("read")
+		if err != nil {
+			return 0, err
+		}
+		f.reader = reader
+	}
+	n, err := f.reader.Read(b)
+	f.offset += int64(n)
+	return n, err
+}
+
+// Seek sets the offset for the next read (buffering the file contents in memory).
+func (f *imageFSFile) Seek(offset int64, whence int) (int64, error) {
+	if err := f.buffer("seek"); err != nil {
+		return 0, err
+	}
+	return f.buffered.Seek(offset, whence)
+}
+
+// ReadAt reads from the given offset (buffering the file contents in memory), without changing the offset for the
+// next read.
+func (f *imageFSFile) ReadAt(b []byte, off int64) (int, error) {
+	if err := f.buffer("read"); err != nil {
+		return 0, err
+	}
+	return f.buffered.ReadAt(b, off)
+}
+
+// open returns a reader for the file contents (empty for implicit directories).
+func (f *imageFSFile) open(op string) (io.ReadCloser, error) {
+	if f.ref == nil {
+		return ioutil.NopCloser(bytes.NewReader(nil)), nil
+	}
+	reader, err := f.fsys.catalog.FileContents(*f.ref)
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: f.name, Err: err}
+	}
+	return reader, nil
+}
+
+// buffer reads all file contents into memory (keeping the offset of any reads so far) to allow for random access.
+func (f *imageFSFile) buffer(op string) error {
+	if f.closed {
+		return &fs.PathError{Op: op, Path: f.name, Err: fs.ErrClosed}
+	}
+	if f.info.IsDir() {
+		return &fs.PathError{Op: op, Path: f.name, Err: errors.New("is a directory")}
+	}
+	if f.buffered != nil {
+		return nil
+	}
+	reader, err := f.open(op)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	contents, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return &fs.PathError{Op: op, Path: f.name, Err: err}
+	}
+	if f.reader != nil {
+		_ = f.reader.Close()
+		f.reader = nil
+	}
+	f.buffered = bytes.NewReader(contents)
+	if _, err := f.buffered.Seek(f.offset, io.SeekStart); err != nil {
+		return &fs.PathError{Op: op, Path: f.name, Err: err}
+	}
+	return nil
+}
+
+// ReadDir reads the contents of the directory, following the fs.ReadDirFile semantics (at most n entries for n > 0,
+// returning io.EOF at the end of the directory, otherwise all remaining entries).
+func (f *imageFSFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if f.closed {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: fs.ErrClosed}
+	}
+	if f.dirEntries == nil {
+		entries, err := f.fsys.ReadDir(f.name)
+		if err != nil {
+			return nil, err
+		}
+		f.dirEntries = entries
+	}
+	remaining := f.dirEntries[f.dirOffset:]
+	if n <= 0 {
+		f.dirOffset = len(f.dirEntries)
+		return remaining, nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(remaining) {
+		n = len(remaining)
+	}
+	f.dirOffset += n
+	return remaining[:n], nil
+}
+
+func (f *imageFSFile) Close() error {
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.closed = true
+	if f.reader != nil {
+		return f.reader.Close()
+	}
+	return nil
+}
+
+// imageFSFileInfo describes a file within an imageFS (the underlying file.Metadata is available from Sys).
+type imageFSFileInfo struct {
+	name     string
+	metadata file.Metadata
+}
+
+func newImageFSFileInfo(name string, metadata file.Metadata) *imageFSFileInfo {
+	base := name
+	if idx := strings.LastIndex(name, file.DirSeparator); idx >= 0 {
+		base = name[idx+1:]
+	}
+	return &imageFSFileInfo{
+		name:     base,
+		metadata: metadata,
+	}
+}
+
+func (i *imageFSFileInfo) Name() string {
+	return i.name
+}
+
+func (i *imageFSFileInfo) Size() int64 {
+	return i.metadata.Size
+}
+
+func (i *imageFSFileInfo) Mode() fs.FileMode {
+	return i.metadata.Mode
+}
+
+func (i *imageFSFileInfo) ModTime() time.Time {
+	return time.Time{}
+}
+
+func (i *imageFSFileInfo) IsDir() bool {
+	return i.metadata.IsDir
+}
+
+func (i *imageFSFileInfo) Sys() interface{} {
+	return i.metadata
+}
+
+func (i *imageFSFileInfo) Type() fs.FileMode {
+	return i.Mode().Type()
+}
+
+func (i *imageFSFileInfo) Info() (fs.FileInfo, error) {
+	return i, nil
+}
@@ -0,0 +1,85 @@
+package image
+
+import (
+	"archive/tar"
+	"errors"
+	"io/fs"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+func TestImage_FS(t *testing.T) {
+	img := newTestImageFromLayers(t, []v1.Layer{
+		newTestTarLayer(t,
+			testTarEntry{name: "etc/", typeflag: tar.TypeDir, mode: 0755},
+			testTarEntry{name: "etc/os-release", contents: "ID=test"},
+			testTarEntry{name: "etc/shadow", contents: "root:*", mode: 0600},
+			testTarEntry{name: "bin/", typeflag: tar.TypeDir, mode: 0755},
+			testTarEntry{name: "bin/busybox", contents: "busybox", mode: 04755},
+			testTarEntry{name: "bin/sh", linkname: "bin/busybox", typeflag: tar.TypeLink},
+			// implicit parent directories
+			testTarEntry{name: "usr/lib/os-release", linkname: "../../etc/os-release", typeflag: tar.TypeSymlink},
+		),
+		newTestTarLayer(t,
+			testTarEntry{name: "etc/.wh.shadow"},
+			testTarEntry{name: "etc/hostname", contents: "upper"},
+		),
+	})
+
+	fsys := img.FS()
+	require.NoError(t, fstest.TestFS(fsys, "etc/os-release", "etc/hostname", "bin/busybox", "bin/sh", "usr/lib/os-release"))
+
+	contents, err := fs.ReadFile(fsys, "usr/lib/os-release")
+	require.NoError(t, err)
+	assert.Equal(t, "ID=test", string(contents))
+
+	contents, err = fs.ReadFile(fsys, "bin/sh")
+	require.NoError(t, err)
+	assert.Equal(t, "busybox", string(contents))
+
+	info, err := fs.Stat(fsys, "bin/sh")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len("busybox")), info.Size())
+	assert.NotZero(t, info.Mode()&os.ModeSetuid)
+	metadata, ok := info.Sys().(file.Metadata)
+	require.True(t, ok)
+	assert.Equal(t, "/bin/busybox", metadata.Path)
+
+	info, err = fs.Stat(fsys, "usr")
+	require.NoError(t, err)
+	assert.True(t, info.IsDir())
+
+	for _, name := range []string{"etc/shadow", "missing"} {
+		_, err = fsys.Open(name)
+		assert.True(t, errors.Is(err, fs.ErrNotExist), "expected %q to not exist: %v", name, err)
+	}
+
+	_, err = fsys.Open("/etc/os-release")
+	assert.True(t, errors.Is(err, fs.ErrInvalid))
+}
+
+func TestImage_FS_DeadLinks(t *testing.T) {
+	img := newTestImageFromLayers(t, []v1.Layer{newTestTarLayer(t,
+		testTarEntry{name: "usr/lib/libc.so", contents: "libc"},
+		testTarEntry{name: "usr/lib/dead", linkname: "/missing", typeflag: tar.TypeSymlink},
+	)})
+	fsys := img.FS()
+
+	// dead links are listed (describing the link), but do not exist
+	entries, err := fs.ReadDir(fsys, "usr/lib")
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "dead", entries[0].Name())
+	assert.Equal(t, fs.ModeSymlink, entries[0].Type())
+	assert.Equal(t, "libc.so", entries[1].Name())
+
+	_, err = fsys.Open("usr/lib/dead")
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+}
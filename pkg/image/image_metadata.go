@@ -1,11 +1,21 @@
 package image
 
 import (
+	"bytes"
+
 	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	v1Types "github.com/google/go-containerregistry/pkg/v1/types"
 )
 
+// Annotation keys of the OCI image spec describing the image a manifest was built from. These are found on the image
+// manifest (see Metadata.Annotations), though some tools record them on layer descriptors instead (see
+// LayerMetadata.Annotations).
+const (
+	AnnotationBaseImageName   = "org.opencontainers.image.base.name"
+	AnnotationBaseImageDigest = "org.opencontainers.image.base.digest"
+)
+
 // Metadata represents container image metadata.
 type Metadata struct {
 	// ID is the sha256 of this image config json (not manifest)
@@ -23,6 +33,11 @@ type Metadata struct {
 	Architecture   string
 	Variant        string
 	OS             string
+	// Annotations are the annotations of the image manifest (e.g. base image hints, see AnnotationBaseImageName), nil
+	// when there are none or no manifest is available
+	Annotations map[string]string `json:",omitempty"`
+	// PlatformMismatch is set when the image platform differs from the expected platform (see WithExpectedPlatform)
+	PlatformMismatch *PlatformMismatch `json:",omitempty"`
 }
 
 // readImageMetadata extracts the most pertinent information from the underlying image tar.
@@ -54,3 +69,15 @@ func readImageMetadata(img v1.Image) (Metadata, error) {
 		RawConfig: rawConfig,
 	}, nil
 }
+
+// manifestAnnotations returns the annotations of the raw image manifest (nil if there are none).
+func manifestAnnotations(metadata Metadata) map[string]string {
+	if len(metadata.RawManifest) == 0 {
+		return nil
+	}
+	manifest, err := v1.ParseManifest(bytes.NewReader(metadata.RawManifest))
+	if err != nil || len(manifest.Annotations) == 0 {
+		return nil
+	}
+	return manifest.Annotations
+}
@@ -1,14 +1,34 @@
 package image
 
 import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/md5"
+	"crypto/sha1"
 	"crypto/sha256"
+	"crypto/sha512"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
 
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree"
 	"github.com/go-test/deep"
 	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestImageAdditionalMetadata(t *testing.T) {
@@ -88,7 +108,8 @@ func TestImageAdditionalMetadata(t *testing.T) {
 		},
 	}
 
-	for _, test := range tests {
+	for idx := range tests {
+		test := &tests[idx]
 		t.Run(test.name, func(t *testing.T) {
 			tempFile, err := ioutil.TempFile("", "")
 			if err != nil {
@@ -131,3 +152,377 @@ func TestImage_SquashedTree(t *testing.T) {
 		}
 	})
 }
+
+func TestImage_Read_MissingLayers(t *testing.T) {
+	dir := t.TempDir()
+	layoutPath, err := layout.Write(dir, empty.Index)
+	require.NoError(t, err)
+
+	randomImage, err := random.Image(10, 3)
+	require.NoError(t, err)
+	require.NoError(t, layoutPath.AppendImage(randomImage))
+
+	manifest, err := randomImage.Manifest()
+	require.NoError(t, err)
+
+	// simulate a partial mirror by removing the middle layer blob
+	missing := manifest.Layers[1].Digest
+	require.NoError(t, os.Remove(filepath.Join(dir, "blobs", missing.Algorithm, missing.Hex)))
+
+	imageDigest, err := randomImage.Digest()
+	require.NoError(t, err)
+
+	newImage := func() *Image {
+		img, err := layoutPath.Image(imageDigest)
+		require.NoError(t, err)
+		return NewImage(img, t.TempDir())
+	}
+
+	t.Run("missing layers are an error by default", func(t *testing.T) {
+		err := newImage().Read()
+		assert.ErrorIs(t, err, ErrLayerUnavailable)
+	})
+
+	t.Run("missing layers are skipped when allowed", func(t *testing.T) {
+		img := newImage()
+		require.NoError(t, img.Read(WithMissingLayersAllowed()))
+		require.Len(t, img.Layers, 3)
+
+		assert.False(t, img.Layers[0].Unavailable)
+		assert.True(t, img.Layers[1].Unavailable)
+		assert.False(t, img.Layers[2].Unavailable)
+
+		assert.Empty(t, img.Layers[1].Tree.AllFiles())
+		assert.Len(t, img.SquashedTree().AllFiles(), len(img.Layers[0].Tree.AllFiles())+len(img.Layers[2].Tree.AllFiles()))
+	})
+}
+
+func TestImage_Read_LazyLayerContent(t *testing.T) {
+	randomImage, err := random.Image(64, 2)
+	require.NoError(t, err)
+
+	cacheDir := t.TempDir()
+	lazy := NewImage(randomImage, cacheDir)
+	require.NoError(t, lazy.Read(WithLazyLayerContent()))
+
+	// no uncompressed layer tars should have been cached
+	entries, err := os.ReadDir(cacheDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	eager := NewImage(randomImage, t.TempDir())
+	require.NoError(t, eager.Read())
+
+	lazyRefs := lazy.SquashedTree().AllFiles()
+	eagerRefs := eager.SquashedTree().AllFiles()
+	require.Len(t, lazyRefs, len(eagerRefs))
+	require.NotEmpty(t, lazyRefs)
+
+	for _, ref := range lazyRefs {
+		lazyReader, err := lazy.FileContentsFromSquash(ref.RealPath)
+		require.NoError(t, err)
+		lazyContents, err := ioutil.ReadAll(lazyReader)
+		require.NoError(t, err)
+		require.NoError(t, lazyReader.Close())
+
+		eagerReader, err := eager.FileContentsFromSquash(ref.RealPath)
+		require.NoError(t, err)
+		eagerContents, err := ioutil.ReadAll(eagerReader)
+		require.NoError(t, err)
+
+		assert.Equal(t, eagerContents, lazyContents)
+	}
+}
+
+func TestImage_Read_LazyLayerContent_CachedAfterFirstRead(t *testing.T) {
+	entries := []testTarEntry{
+		{name: "etc/a", contents: "a"},
+		{name: "etc/b", contents: "b"},
+		{name: "etc/c", contents: "c"},
+	}
+	content := newTestTar(t, entries...)
+	var opens int32
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		atomic.AddInt32(&opens, 1)
+		return ioutil.NopCloser(bytes.NewReader(content)), nil
+	})
+	require.NoError(t, err)
+	v1Image, err := mutate.AppendLayers(empty.Image, layer)
+	require.NoError(t, err)
+
+	img := NewImage(v1Image, t.TempDir())
+	require.NoError(t, img.Read(WithLazyLayerContent()))
+	afterRead := atomic.LoadInt32(&opens)
+
+	for i := 0; i < 3; i++ {
+		for _, entry := range entries {
+			reader, err := img.FileContentsFromSquash(file.Path("/" + entry.name))
+			require.NoError(t, err)
+			contents, err := ioutil.ReadAll(reader)
+			require.NoError(t, err)
+			require.NoError(t, reader.Close())
+			assert.Equal(t, entry.contents, string(contents))
+		}
+	}
+
+	// the first read is streamed and the second caches the layer tar, every other read is served from the cache
+	assert.LessOrEqual(t, atomic.LoadInt32(&opens)-afterRead, int32(2))
+}
+
+func TestImage_Read_DeferredSquash(t *testing.T) {
+	randomImage, err := random.Image(64, 3)
+	require.NoError(t, err)
+
+	img := NewImage(randomImage, t.TempDir())
+	require.NoError(t, img.Read(WithDeferredSquash()))
+	assert.False(t, img.IsSquashed())
+	for _, layer := range img.Layers {
+		assert.Nil(t, layer.SquashedTree)
+	}
+
+	// only squash a subset of the layers
+	img.Layers = img.Layers[:2]
+	require.NoError(t, img.Squash(context.Background()))
+	assert.True(t, img.IsSquashed())
+
+	var expected []file.Reference
+	for _, layer := range img.Layers {
+		expected = append(expected, layer.Tree.AllFiles()...)
+	}
+	assert.ElementsMatch(t, expected, img.SquashedTree().AllFiles())
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, img.Squash(canceled), context.Canceled)
+}
+
+func TestImage_SquashedTree_SquashesOnDemand(t *testing.T) {
+	randomImage, err := random.Image(64, 2)
+	require.NoError(t, err)
+
+	img := NewImage(randomImage, t.TempDir())
+	require.NoError(t, img.Read(WithDeferredSquash()))
+	require.False(t, img.IsSquashed())
+
+	assert.NotEmpty(t, img.SquashedTree().AllFiles())
+	assert.True(t, img.IsSquashed())
+}
+
+func TestImage_SquashedSearchContext(t *testing.T) {
+	img := newTestImageFromLayers(t, []v1.Layer{
+		newTestTarLayer(t, testTarEntry{name: "etc/base.conf", contents: "base"}),
+		newTestTarLayer(t, testTarEntry{name: "etc/top.conf", contents: "top"}),
+	}, WithDeferredSquash())
+	require.False(t, img.IsSquashed())
+
+	// only the squash trees through the searched layer are generated
+	layerTree, err := img.Layers[0].SquashedSearchContext()
+	require.NoError(t, err)
+	assert.False(t, img.IsSquashed())
+	results, err := layerTree.FilesByGlob("/etc/*.conf")
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, file.Path("/etc/base.conf"), results[0].MatchPath)
+
+	tree, err := img.SquashedSearchContext()
+	require.NoError(t, err)
+	assert.True(t, img.IsSquashed())
+	assert.Same(t, img.SquashedTree(), tree)
+	results, err = tree.FilesByGlob("/etc/*.conf")
+	require.NoError(t, err)
+	assert.Len(t, results, 2)
+
+	// unlike SquashedTree, failing to generate the squash tree is reported
+	unsquashable := newTestUnsquashableImage(t)
+	_, err = unsquashable.SquashedSearchContext()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unable to squash layers")
+	_, err = unsquashable.Layers[1].SquashedSearchContext()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unable to squash layers")
+	_, err = unsquashable.Layers[0].SquashedSearchContext()
+	assert.NoError(t, err)
+}
+
+func TestImage_ReadWithContext_Canceled(t *testing.T) {
+	randomImage, err := random.Image(64, 2)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	img := NewImage(randomImage, t.TempDir())
+	err = img.ReadWithContext(ctx)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, img.Layers)
+}
+
+func TestImage_FileContentsVerified(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []ReadOption
+		wantErr bool
+	}{
+		{
+			name:    "digest recorded while reading detects corruption",
+			options: []ReadOption{WithFileDigests()},
+			wantErr: true,
+		},
+		{
+			name: "digest computed upon first read",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v1Image, err := mutate.AppendLayers(empty.Image, newTestTarLayer(t, testTarEntry{name: "etc/hello.txt", contents: "hello world"}))
+			require.NoError(t, err)
+			cacheDir := t.TempDir()
+			img := NewImage(v1Image, cacheDir)
+			require.NoError(t, img.Read(test.options...))
+
+			_, ref, err := img.SquashedTree().File("/etc/hello.txt")
+			require.NoError(t, err)
+			require.NotNil(t, ref)
+
+			entry, err := img.FileCatalog.Get(*ref)
+			require.NoError(t, err)
+			if len(test.options) > 0 {
+				assert.Equal(t, fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("hello world"))), entry.Metadata.Digest)
+			} else {
+				assert.Empty(t, entry.Metadata.Digest)
+			}
+
+			// corrupt the layer cache in place after the tree has been built
+			cachePath := filepath.Join(cacheDir, layerCacheFileName(img.Layers[0].Metadata.Digest))
+			content, err := os.ReadFile(cachePath)
+			require.NoError(t, err)
+			offset := bytes.Index(content, []byte("hello world"))
+			require.True(t, offset >= 0)
+			fh, err := os.OpenFile(cachePath, os.O_WRONLY, 0)
+			require.NoError(t, err)
+			_, err = fh.WriteAt([]byte("HELLO"), int64(offset))
+			require.NoError(t, err)
+			require.NoError(t, fh.Close())
+
+			reader, err := img.FileContentsVerified(*ref)
+			require.NoError(t, err)
+			contents, err := ioutil.ReadAll(reader)
+			require.NoError(t, reader.Close())
+			if test.wantErr {
+				assert.ErrorIs(t, err, file.ErrDigestMismatch)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "HELLO world", string(contents))
+
+			entry, err = img.FileCatalog.Get(*ref)
+			require.NoError(t, err)
+			assert.NotEmpty(t, entry.Metadata.Digest)
+		})
+	}
+}
+
+func TestImage_Read_DuplicateLayers(t *testing.T) {
+	base := newTestTarLayer(t, testTarEntry{name: "etc/hello.txt", contents: "hello"})
+	middle := newTestTarLayer(t, testTarEntry{name: "etc/hello.txt", contents: "goodbye"})
+	v1Image, err := mutate.AppendLayers(empty.Image, base, middle, base)
+	require.NoError(t, err)
+
+	img := NewImage(v1Image, t.TempDir())
+	require.NoError(t, img.Read())
+	require.Len(t, img.Layers, 3)
+
+	assert.Nil(t, img.Layers[0].DuplicateOf())
+	assert.Nil(t, img.Layers[1].DuplicateOf())
+	assert.Same(t, img.Layers[0], img.Layers[2].DuplicateOf())
+	assert.Same(t, img.Layers[0].Tree, img.Layers[2].Tree)
+	assert.Equal(t, uint(2), img.Layers[2].Metadata.Index)
+	assert.Equal(t, img.Layers[0].Metadata.Digest, img.Layers[2].Metadata.Digest)
+
+	// the duplicate layer content is only accounted for once
+	assert.Equal(t, int64(len("hello")+len("goodbye")), img.Metadata.Size)
+
+	reader, err := img.FileContentsFromSquash("/etc/hello.txt")
+	require.NoError(t, err)
+	contents, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	assert.Equal(t, "hello", string(contents))
+}
+
+func TestImage_FileDigests_MultipleAlgorithms(t *testing.T) {
+	contents := []byte("hello world")
+	tests := []struct {
+		name     string
+		hashes   []file.DigestHash
+		expected map[string]string
+		digest   string
+	}{
+		{
+			name:     "sha256 by default",
+			expected: map[string]string{"sha256": fmt.Sprintf("sha256:%x", sha256.Sum256(contents))},
+			digest:   fmt.Sprintf("sha256:%x", sha256.Sum256(contents)),
+		},
+		{
+			name:   "multiple algorithms",
+			hashes: []file.DigestHash{crypto.SHA256, crypto.SHA1, crypto.MD5, crypto.SHA1},
+			expected: map[string]string{
+				"sha256": fmt.Sprintf("sha256:%x", sha256.Sum256(contents)),
+				"sha1":   fmt.Sprintf("sha1:%x", sha1.Sum(contents)),
+				"md5":    fmt.Sprintf("md5:%x", md5.Sum(contents)),
+			},
+			digest: fmt.Sprintf("sha256:%x", sha256.Sum256(contents)),
+		},
+		{
+			name:     "without sha256",
+			hashes:   []file.DigestHash{crypto.SHA512},
+			expected: map[string]string{"sha512": fmt.Sprintf("sha512:%x", sha512.Sum512(contents))},
+		},
+		{
+			name:   "with xxh64",
+			hashes: []file.DigestHash{crypto.SHA256, file.XXH64},
+			expected: map[string]string{
+				"sha256": fmt.Sprintf("sha256:%x", sha256.Sum256(contents)),
+				"xxh64":  "xxh64:45ab6734b21e6968",
+			},
+			digest: fmt.Sprintf("sha256:%x", sha256.Sum256(contents)),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v1Image, err := mutate.AppendLayers(empty.Image, newTestTarLayer(t,
+				testTarEntry{name: "etc/hello.txt", contents: string(contents)},
+				testTarEntry{name: "etc/link", linkname: "hello.txt", typeflag: tar.TypeSymlink},
+			))
+			require.NoError(t, err)
+			img := NewImage(v1Image, t.TempDir())
+			require.NoError(t, img.Read(WithFileDigests(test.hashes...)))
+
+			_, ref, err := img.SquashedTree().File("/etc/hello.txt")
+			require.NoError(t, err)
+			require.NotNil(t, ref)
+			entry, err := img.FileCatalog.Get(*ref)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, entry.Metadata.Digests)
+			assert.Equal(t, test.digest, entry.Metadata.Digest)
+
+			// only regular files are digested
+			_, ref, err = img.SquashedTree().File("/etc/link", filetree.DoNotFollowDeadBasenameLinks)
+			require.NoError(t, err)
+			require.NotNil(t, ref)
+			entry, err = img.FileCatalog.Get(*ref)
+			require.NoError(t, err)
+			assert.Empty(t, entry.Metadata.Digests)
+		})
+	}
+}
+
+func TestImage_FileDigests_UnavailableAlgorithm(t *testing.T) {
+	v1Image, err := mutate.AppendLayers(empty.Image, newTestTarLayer(t, testTarEntry{name: "etc/hello.txt", contents: "hello"}))
+	require.NoError(t, err)
+	img := NewImage(v1Image, t.TempDir())
+	err = img.Read(WithFileDigests(crypto.BLAKE2b_256))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unavailable digest algorithm")
+}
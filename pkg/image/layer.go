@@ -3,12 +3,17 @@ package image
 import (
 	"archive/tar"
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"os"
 	"path"
+	"strings"
+	"sync/atomic"
 
 	"github.com/anchore/stereoscope/internal/bus"
 	"github.com/anchore/stereoscope/internal/log"
@@ -24,6 +29,19 @@ import (
 
 const SingularitySquashFSLayer = "application/vnd.sylabs.sif.layer.v1.squashfs"
 
+// OCI layer media types for zstd compressed layers (not yet described by the GCR lib).
+const (
+	OCILayerZstd           types.MediaType = "application/vnd.oci.image.layer.v1.tar+zstd"
+	OCIRestrictedLayerZstd types.MediaType = "application/vnd.oci.image.layer.nondistributable.v1.tar+zstd"
+)
+
+// ErrLayerUnavailable indicates that the content blob for a layer could not be found.
+var ErrLayerUnavailable = errors.New("layer content is unavailable")
+
+// ErrCompressionMismatch indicates that the compression of the layer content differs from what the layer media type
+// declares (see WithStrictLayerCompression).
+var ErrCompressionMismatch = errors.New("layer compression does not match the media type")
+
 // Layer represents a single layer within a container image.
 type Layer struct {
 	// layer is the raw layer metadata and content provider from the GCR lib
@@ -39,6 +57,52 @@ type Layer struct {
 	SquashedTree *filetree.FileTree
 	// fileCatalog contains all file metadata for all files in all layers (not just this layer)
 	fileCatalog *FileCatalog
+	// Unavailable indicates that the layer content was not read and the layer tree is empty, either because the content
+	// could not be found (see WithMissingLayersAllowed) or because the layer was skipped (e.g. see WithTopLayers).
+	Unavailable bool
+	// hardlinks maps each hardlink path to the path of the original file it refers to (see FileIdentity)
+	hardlinks map[file.Path]file.Path
+	// whiteouts are the lower-layer paths deleted by this layer (see Whiteouts)
+	whiteouts []file.Path
+	// opaqueDirs are the directories whose lower-layer contents are hidden by this layer (see OpaqueDirs)
+	opaqueDirs []file.Path
+	// fileDigests are the digest algorithms recorded for file contents while indexing (see WithFileDigests)
+	fileDigests []file.DigestHash
+	// mimeTypeDetector classifies regular files while indexing (see WithMIMETypeDetector)
+	mimeTypeDetector file.MIMETypeDetector
+	// mimeTypeSniffSize is the number of leading bytes given to the mimeTypeDetector
+	mimeTypeSniffSize int
+	// contentHooks are invoked with the contents of every regular file while indexing (see WithContentHooks)
+	contentHooks []ContentHook
+	// typeChangeWarnings indicates that paths replaced by a different type of file are reported as warnings
+	typeChangeWarnings bool
+	// strictCompression indicates that a layer compression mismatch fails the read (see WithStrictLayerCompression)
+	strictCompression bool
+	// windowsPaths indicates that tar entry names are normalized as Windows layer paths (see WithWindowsLayerPaths)
+	windowsPaths bool
+	// compressionMismatchReported is set (atomically) once the compression mismatch warning is recorded, since the
+	// layer content may be decompressed many times (e.g. for lazily read file contents)
+	compressionMismatchReported int32
+	// mergeStrategy determines which entries are whiteouts or opaque directory markers (see WithMergeStrategy)
+	mergeStrategy MergeStrategy
+	// cacheBudget accounts for the cached layer tar on disk (see WithLayerCacheBudget)
+	cacheBudget *LayerCacheBudget
+	// cachedTarPath is the cached layer tar accounted for by the cacheBudget (until released)
+	cachedTarPath string
+	// duplicateOf is the lower layer with the same digest within the image that this layer shares all content with
+	duplicateOf *Layer
+	// warnings are the non-fatal issues encountered while reading the layer (see Warnings)
+	warnings []Warning
+	// limitState tracks the layer content against the read limits while indexing (nil without read limits)
+	limitState *layerLimitState
+	// limitViolations are the read limits violated by the layer content (see LimitViolations)
+	limitViolations []LimitViolation
+	// checkpointEntries are the details derived from each tar entry (by sequence) while indexing, which are recorded
+	// within the layer checkpoint (nil without checkpoints, see WithCatalogCheckpoints)
+	checkpointEntries map[int64]layerCheckpointEntry
+	// squashTree returns the squash tree of the layer from the image the layer was read within, generating it when
+	// deferred (nil when the layer was read on its own, see SquashedTree)
+	squashTree func() (*filetree.FileTree, error)
 }
 
 // NewLayer provides a new, unread layer object.
@@ -48,39 +112,225 @@ func NewLayer(layer v1.Layer) *Layer {
 	}
 }
 
-func (l *Layer) uncompressedTarCache(uncompressedLayersCacheDir string) (string, error) {
-	if uncompressedLayersCacheDir == "" {
-		return "", fmt.Errorf("no cache directory given")
+// uncompressed returns a reader for the uncompressed layer tar. The GCR lib assumes all compressed layers are gzip
+// compressed, so the compression is instead detected from the magic bytes of the layer content (gzip, zstd, xz, or a
+// plain tar) regardless of what the media type declares, and any mismatch is reported (see checkCompression).
+func (l *Layer) uncompressed() (io.ReadCloser, error) {
+	if l.Metadata.MediaType == SingularitySquashFSLayer {
+		return l.layer.Uncompressed()
+	}
+
+	declared := declaredCompression(l.Metadata.MediaType)
+	if declared != file.CompressionZstd {
+		rawReader, err := l.layer.Uncompressed()
+		switch {
+		case err == nil:
+			// the content may still be compressed (e.g. a compressed blob declared as an uncompressed tar)
+			reader, detected, err := file.NewDecompressingReadCloser(rawReader)
+			if err != nil {
+				return nil, err
+			}
+			if detected == file.CompressionNone {
+				detected = declared
+			}
+			return l.checkCompression(reader, declared, detected)
+		case !errors.Is(err, gzip.ErrHeader):
+			return nil, err
+		}
+		// the GCR lib could not gunzip the blob, which is sniffed as-is below instead
 	}
 
-	tarPath := path.Join(uncompressedLayersCacheDir, l.Metadata.Digest+".tar")
+	compressed, err := l.layer.Compressed()
+	if err != nil {
+		return nil, err
+	}
+	reader, detected, err := file.NewDecompressingReadCloser(compressed)
+	if err != nil {
+		return nil, err
+	}
+	return l.checkCompression(reader, declared, detected)
+}
 
-	if _, err := os.Stat(tarPath); !os.IsNotExist(err) {
-		return tarPath, nil
+// checkCompression reports when the detected compression of the layer content differs from the compression declared
+// by the layer media type: the read fails when reading with WithStrictLayerCompression, otherwise a
+// WarningCompressionMismatch is recorded (once per layer) and the given reader is returned.
+func (l *Layer) checkCompression(reader io.ReadCloser, declared, detected file.Compression) (io.ReadCloser, error) {
+	if declared == detected {
+		return reader, nil
+	}
+	if l.strictCompression {
+		_ = reader.Close()
+		return nil, fmt.Errorf("%w: layer=%q media type=%q declares %s, however, the content is %s",
+			ErrCompressionMismatch, l.Metadata.Digest, l.Metadata.MediaType, declared, detected)
+	}
+	if atomic.CompareAndSwapInt32(&l.compressionMismatchReported, 0, 1) {
+		log.Warnf("layer=%q media type=%q declares %s compression, however, the content is %s",
+			l.Metadata.Digest, l.Metadata.MediaType, declared, detected)
+		l.warn(WarningCompressionMismatch, "", "media type=%q declares %s compression, however, the content is %s",
+			l.Metadata.MediaType, declared, detected)
 	}
+	return reader, nil
+}
+
+// declaredCompression returns the compression of the layer content as described by the given layer media type.
+func declaredCompression(mediaType types.MediaType) file.Compression {
+	switch mediaType {
+	case OCILayerZstd, OCIRestrictedLayerZstd:
+		return file.CompressionZstd
+	case types.OCIUncompressedLayer, types.OCIUncompressedRestrictedLayer, types.DockerUncompressedLayer:
+		return file.CompressionNone
+	}
+	return file.CompressionGzip
+}
 
-	rawReader, err := l.layer.Uncompressed()
+func (l *Layer) uncompressedTarCache(ctx context.Context, tarPath string, verify bool) (string, error) {
+	if _, err := os.Stat(tarPath); err == nil {
+		// the cache may have been populated by another process (or a prior run), only use it if it is intact
+		if err := file.VerifyDigest(tarPath, l.verifiableDigest()); err == nil {
+			log.Debugf("reusing layer cache=%q", tarPath)
+			return tarPath, l.acquireCacheBudget(tarPath)
+		}
+		log.Warnf("ignoring invalid layer cache=%q: %+v", tarPath, err)
+		l.warn(WarningInvalidCache, "", "ignoring invalid layer cache=%q: %v", tarPath, err)
+	}
+
+	if l.cacheBudget != nil {
+		// the compressed size is a lower bound of the uncompressed tar, which allows failing before fetching anything
+		if size, err := l.layer.Size(); err == nil {
+			if err := l.cacheBudget.check(tarPath, size); err != nil {
+				return "", fmt.Errorf("unable to cache layer=%q: %w", l.Metadata.Digest, err)
+			}
+		}
+	}
+
+	rawReader, err := l.uncompressed()
 	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("%w: %v", ErrLayerUnavailable, err)
+		}
 		return "", err
 	}
+	defer rawReader.Close()
+
+	reader, completeDownload := trackLayerDownload(ctx, l.Metadata, rawReader)
 
-	fh, err := os.Create(tarPath)
+	// write to a process-scoped partial file and atomically move it into place once the content has been verified,
+	// so concurrent (or crashed) readers of the same cache directory never observe a partially written layer tar.
+	err = file.WriteVerified(tarPath, l.verifiableDigest(), reader)
+	completeDownload(err)
 	if err != nil {
-		return "", fmt.Errorf("unable to create layer cache dir=%q : %w", tarPath, err)
+		return "", fmt.Errorf("unable to populate layer cache=%q : %w", tarPath, err)
 	}
 
-	if _, err := io.Copy(fh, rawReader); err != nil {
-		return "", fmt.Errorf("unable to populate layer cache dir=%q : %w", tarPath, err)
+	if verify {
+		// the content was verified in-flight, however, this re-reads what actually landed on disk
+		if err := file.VerifyDigest(tarPath, l.verifiableDigest()); err != nil {
+			_ = os.Remove(tarPath)
+			return "", fmt.Errorf("layer cache=%q failed verification after write: %w", tarPath, err)
+		}
 	}
 
-	return tarPath, nil
+	return tarPath, l.acquireCacheBudget(tarPath)
+}
+
+// acquireCacheBudget accounts for the given cached layer tar within the layer cache budget (if any), evicting unused
+// layer tars as needed. The layer tar is removed if it does not fit within a budget that fails when exceeded.
+func (l *Layer) acquireCacheBudget(tarPath string) error {
+	if l.cacheBudget == nil {
+		return nil
+	}
+	info, err := os.Stat(tarPath)
+	if err != nil {
+		return fmt.Errorf("unable to stat layer cache=%q: %w", tarPath, err)
+	}
+	warning, err := l.cacheBudget.acquire(tarPath, info.Size())
+	if err != nil {
+		_ = os.Remove(tarPath)
+		return fmt.Errorf("unable to cache layer=%q: %w", l.Metadata.Digest, err)
+	}
+	l.cachedTarPath = tarPath
+	if warning != "" {
+		log.Warnf("%s (layer=%q)", warning, l.Metadata.Digest)
+		l.warn(WarningCacheBudget, "", "%s", warning)
+	}
+	return nil
+}
+
+// releaseCacheBudget makes the cached layer tar (if any) a candidate for eviction from the layer cache budget.
+func (l *Layer) releaseCacheBudget() {
+	if l.cacheBudget == nil || l.cachedTarPath == "" || l.duplicateOf != nil {
+		return
+	}
+	l.cacheBudget.release(l.cachedTarPath)
+	l.cachedTarPath = ""
+}
+
+// layerCachePath returns where the uncompressed layer tar is cached: within the persistent blob cache (see
+// WithBlobCache, which is never used for reconstructed layers), the checkpoint directory (see WithCatalogCheckpoints), or otherwise the image cache directory.
+func (l *Layer) layerCachePath(cfg readConfig, uncompressedLayersCacheDir string) (string, error) {
+	if cfg.blobCacheDir != "" && !isReconstructed(l.layer) {
+		tarPath, err := blobCachePath(cfg.blobCacheDir, l.Metadata.Digest)
+		if err == nil {
+			return tarPath, nil
+		}
+		log.Warnf("not using blob cache for layer=%q: %+v", l.Metadata.Digest, err)
+		l.warn(WarningInvalidCache, "", "not using blob cache for layer=%q: %v", l.Metadata.Digest, err)
+	}
+
+	cacheDir := uncompressedLayersCacheDir
+	if cfg.checkpointDir != "" {
+		// the layer tar must outlive the image for the checkpoint to be useful
+		cacheDir = cfg.checkpointDir
+	}
+	if cacheDir == "" {
+		return "", fmt.Errorf("no cache directory given")
+	}
+	return path.Join(cacheDir, layerCacheFileName(l.Metadata.Digest)), nil
+}
+
+// layerCacheFileName returns a filesystem-safe cache file name derived from the given layer digest.
+func layerCacheFileName(digest string) string {
+	return strings.ReplaceAll(digest, ":", "-") + ".tar"
 }
 
 // Read parses information from the underlying layer tar into this struct. This includes layer metadata, the layer
 // file tree, and the layer squash tree.
-func (l *Layer) Read(catalog *FileCatalog, imgMetadata Metadata, idx int, uncompressedLayersCacheDir string) error {
-	var err error
+func (l *Layer) Read(catalog *FileCatalog, imgMetadata Metadata, idx int, uncompressedLayersCacheDir string, options ...ReadOption) error {
+	return l.ReadWithContext(context.Background(), catalog, imgMetadata, idx, uncompressedLayersCacheDir, options...)
+}
+
+// ReadWithContext is the same as Read, however, the read (both fetching layer content and indexing the layer tar) is
+// stopped once the given context is done.
+func (l *Layer) ReadWithContext(ctx context.Context, catalog *FileCatalog, imgMetadata Metadata, idx int, uncompressedLayersCacheDir string, options ...ReadOption) (err error) {
+	// the options are shared by all concurrently read layers, so are never appended to in place
+	cfg := newReadConfig(append(options[:len(options):len(options)], withContext(ctx))...)
+	l.releaseCacheBudget()
 	l.Tree = filetree.NewFileTree()
+	l.hardlinks = nil
+	l.whiteouts = nil
+	l.opaqueDirs = nil
+	l.warnings = nil
+	l.limitViolations = nil
+	l.limitState = nil
+	if cfg.readLimits != nil {
+		l.limitState = &layerLimitState{limits: *cfg.readLimits}
+	}
+	defer func() {
+		// the totals are only needed while indexing
+		l.limitState = nil
+	}()
+	if _, err := file.NewMultiDigester(cfg.fileDigests...); err != nil {
+		return err
+	}
+	l.fileDigests = cfg.fileDigests
+	l.mimeTypeDetector = cfg.mimeTypeDetector
+	l.mimeTypeSniffSize = cfg.mimeTypeSniffSize
+	l.contentHooks = cfg.contentHooks
+	l.typeChangeWarnings = cfg.typeChangeWarnings
+	l.strictCompression = cfg.strictCompression
+	l.windowsPaths = cfg.windowsLayerPaths
+	l.cacheBudget = cfg.layerCacheBudget
+	l.mergeStrategy = cfg.mergeStrategy
 	l.fileCatalog = catalog
 	l.Metadata, err = newLayerMetadata(imgMetadata, l.layer, idx)
 	if err != nil {
@@ -93,6 +343,12 @@ func (l *Layer) Read(catalog *FileCatalog, imgMetadata Metadata, idx int, uncomp
 		l.Metadata.MediaType)
 
 	monitor := trackReadProgress(l.Metadata)
+	defer func() {
+		// surface partial progress (e.g. due to cancellation) to anyone monitoring the read
+		if err != nil {
+			monitor.Err = err
+		}
+	}()
 
 	switch l.Metadata.MediaType {
 	case types.OCILayer,
@@ -101,20 +357,63 @@ func (l *Layer) Read(catalog *FileCatalog, imgMetadata Metadata, idx int, uncomp
 		types.OCIUncompressedRestrictedLayer,
 		types.DockerLayer,
 		types.DockerForeignLayer,
-		types.DockerUncompressedLayer:
+		types.DockerUncompressedLayer,
+		OCILayerZstd,
+		OCIRestrictedLayerZstd:
 
-		tarFilePath, err := l.uncompressedTarCache(uncompressedLayersCacheDir)
+		seekable, err := l.readSeekable(cfg, imgMetadata, idx, monitor)
+		if err != nil {
+			return fmt.Errorf("failed to read layer=%q table of contents : %w", l.Metadata.Digest, err)
+		}
+		if seekable {
+			break
+		}
+
+		if cfg.lazyLayerContent {
+			if err := l.readLazily(cfg.ctx, cfg, uncompressedLayersCacheDir, monitor); err != nil {
+				return fmt.Errorf("failed to read layer=%q tar : %w", l.Metadata.Digest, err)
+			}
+			break
+		}
+
+		tarFilePath, err := l.layerCachePath(cfg, uncompressedLayersCacheDir)
+		if err != nil {
+			return err
+		}
+		tarFilePath, err = l.uncompressedTarCache(cfg.ctx, tarFilePath, cfg.verifyCache)
 		if err != nil {
 			return err
 		}
 
-		l.indexedContent, err = file.NewTarIndex(tarFilePath, l.indexer(monitor))
+		settings, checkpoints := newLayerCheckpointSettings(cfg)
+		if checkpoints {
+			restored, err := l.restoreCheckpoint(cfg.checkpointDir, tarFilePath, settings, monitor)
+			if err != nil {
+				return err
+			}
+			if restored {
+				break
+			}
+			l.checkpointEntries = make(map[int64]layerCheckpointEntry)
+			defer func() {
+				l.checkpointEntries = nil
+			}()
+		}
+
+		l.indexedContent, err = file.NewTarIndex(tarFilePath, l.indexer(cfg.ctx, monitor))
 		if err != nil {
 			return fmt.Errorf("failed to read layer=%q tar : %w", l.Metadata.Digest, err)
 		}
 
+		if checkpoints {
+			if err := l.writeCheckpoint(cfg.checkpointDir, settings); err != nil {
+				log.Warnf("unable to checkpoint layer=%q: %+v", l.Metadata.Digest, err)
+				l.warn(WarningInvalidCache, "", "unable to checkpoint layer=%q: %v", l.Metadata.Digest, err)
+			}
+		}
+
 	case SingularitySquashFSLayer:
-		r, err := l.layer.Uncompressed()
+		r, err := l.uncompressed()
 		if err != nil {
 			return fmt.Errorf("failed to read layer=%q: %w", l.Metadata.Digest, err)
 		}
@@ -134,11 +433,75 @@ func (l *Layer) Read(catalog *FileCatalog, imgMetadata Metadata, idx int, uncomp
 		return fmt.Errorf("unknown layer media type: %+v", l.Metadata.MediaType)
 	}
 
+	// hardlinks to files in lower layers are resolved while squashing
+	l.bindHardlinks(nil)
+
 	monitor.SetCompleted()
 
 	return nil
 }
 
+// readAsDuplicate populates this layer from an already read layer with the same digest (at a lower index within the
+// same image). The layer tree, file catalog entries, and cached content are all shared with the original layer, so the
+// layer content is not fetched, unpacked, or indexed again.
+func (l *Layer) readAsDuplicate(original *Layer, imgMetadata Metadata, idx int) error {
+	metadata, err := newLayerMetadata(imgMetadata, l.layer, idx)
+	if err != nil {
+		return err
+	}
+	metadata.Size = original.Metadata.Size
+
+	l.Metadata = metadata
+	l.Tree = original.Tree
+	l.indexedContent = original.indexedContent
+	l.fileCatalog = original.fileCatalog
+	l.hardlinks = original.hardlinks
+	l.whiteouts = original.whiteouts
+	l.opaqueDirs = original.opaqueDirs
+	l.limitViolations = original.limitViolations
+	l.fileDigests = original.fileDigests
+	l.Unavailable = original.Unavailable
+	l.duplicateOf = original
+	return nil
+}
+
+// readOverLimit populates this layer as unavailable (with an empty tree) without fetching any content, since the layer
+// is above the maximum number of layers that may be read (see ReadLimits.MaxLayers).
+func (l *Layer) readOverLimit(catalog *FileCatalog, imgMetadata Metadata, idx int, maxLayers int) error {
+	metadata, err := newLayerMetadata(imgMetadata, l.layer, idx)
+	if err != nil {
+		return err
+	}
+	l.Metadata = metadata
+	l.Tree = filetree.NewFileTree()
+	l.fileCatalog = catalog
+	l.Unavailable = true
+	l.violation(LimitViolation{Limit: LimitLayers, Value: int64(idx + 1), Max: int64(maxLayers)})
+	return nil
+}
+
+// readBelowTop populates this layer as unavailable (with an empty tree) without fetching any content, since the layer
+// is below the top-most layers that are read (see WithTopLayers).
+func (l *Layer) readBelowTop(catalog *FileCatalog, imgMetadata Metadata, idx int) error {
+	metadata, err := newLayerMetadata(imgMetadata, l.layer, idx)
+	if err != nil {
+		return err
+	}
+	l.Metadata = metadata
+	l.Tree = filetree.NewFileTree()
+	l.fileCatalog = catalog
+	l.Unavailable = true
+	log.Debugf("skipping layer=%q below the top-most layers", metadata.Digest)
+	return nil
+}
+
+// DuplicateOf returns the lower layer within the image with the same digest as this layer, which all content is shared
+// with (nil if this layer is not a duplicate). Note that catalog entries for files within a duplicate layer refer to
+// the original layer.
+func (l *Layer) DuplicateOf() *Layer {
+	return l.duplicateOf
+}
+
 // FetchContents reads the file contents for the given path from the underlying layer blob, relative to the layers "diff tree".
 // An error is returned if there is no file at the given path and layer or the read operation cannot continue.
 func (l *Layer) FileContents(path file.Path) (io.ReadCloser, error) {
@@ -148,7 +511,11 @@ func (l *Layer) FileContents(path file.Path) (io.ReadCloser, error) {
 // FileContentsFromSquash reads the file contents for the given path from the underlying layer blob, relative to the layers squashed file tree.
 // An error is returned if there is no file at the given path and layer or the read operation cannot continue.
 func (l *Layer) FileContentsFromSquash(path file.Path) (io.ReadCloser, error) {
-	return fetchFileContentsByPath(l.SquashedTree, l.fileCatalog, path)
+	tree, err := l.squashedTree()
+	if err != nil {
+		return nil, err
+	}
+	return fetchFileContentsByPath(tree, l.fileCatalog, path)
 }
 
 // FilesByMIMEType returns file references for files that match at least one of the given MIME types relative to each layer tree.
@@ -166,9 +533,13 @@ func (l *Layer) FilesByMIMEType(mimeTypes ...string) ([]file.Reference, error) {
 
 // FilesByMIMETypeFromSquash returns file references for files that match at least one of the given MIME types relative to the squashed file tree representation.
 func (l *Layer) FilesByMIMETypeFromSquash(mimeTypes ...string) ([]file.Reference, error) {
+	tree, err := l.squashedTree()
+	if err != nil {
+		return nil, err
+	}
 	var refs []file.Reference
 	for _, ty := range mimeTypes {
-		refsForType, err := fetchFilesByMIMEType(l.SquashedTree, l.fileCatalog, ty)
+		refsForType, err := fetchFilesByMIMEType(tree, l.fileCatalog, ty)
 		if err != nil {
 			return nil, err
 		}
@@ -177,9 +548,59 @@ func (l *Layer) FilesByMIMETypeFromSquash(mimeTypes ...string) ([]file.Reference
 	return refs, nil
 }
 
-func (l *Layer) indexer(monitor *progress.Manual) file.TarIndexVisitor {
+// SquashedSearchContext returns the squash tree of the layer to search (e.g. with FilesByGlob), generating it now when
+// the squash was deferred (see WithDeferredSquash). Unlike the SquashedTree field, this is never nil when there is no
+// error.
+func (l *Layer) SquashedSearchContext() (*filetree.FileTree, error) {
+	return l.squashedTree()
+}
+
+// squashedTree returns the squash tree of the layer, which is generated by the image when it was deferred (see
+// WithDeferredSquash).
+func (l *Layer) squashedTree() (*filetree.FileTree, error) {
+	if l.squashTree != nil {
+		return l.squashTree()
+	}
+	if l.SquashedTree == nil {
+		return nil, fmt.Errorf("layer has not been squashed")
+	}
+	return l.SquashedTree, nil
+}
+
+// readLazily builds the layer tree from the tar headers streamed directly from the layer blob (without caching the
+// uncompressed tar to disk). File contents are only fetched again when they are requested (see lazyLayerContent).
+func (l *Layer) readLazily(ctx context.Context, cfg readConfig, uncompressedLayersCacheDir string, monitor *progress.Manual) error {
+	tarPath, err := l.layerCachePath(cfg, uncompressedLayersCacheDir)
+	if err != nil {
+		// all contents are streamed from the layer blob instead
+		log.Debugf("unable to cache contents of lazily read layer=%q: %+v", l.Metadata.Digest, err)
+		tarPath = ""
+	}
+	content := newLazyLayerContent(l, tarPath)
+
+	rawReader, err := l.uncompressed()
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("%w: %v", ErrLayerUnavailable, err)
+		}
+		return err
+	}
+	defer rawReader.Close()
+
+	reader, completeDownload := trackLayerDownload(ctx, l.Metadata, rawReader)
+
+	err = file.IterateTarWithContext(ctx, reader, func(entry file.TarFileEntry) error {
+		return l.addTarEntry(entry.Header, entry.Sequence, entry.Reader, content.opener(entry.Sequence), monitor)
+	})
+	completeDownload(err)
+	return err
+}
+
+func (l *Layer) indexer(ctx context.Context, monitor *progress.Manual) file.TarIndexVisitor {
 	return func(index file.TarIndexEntry) error {
-		var err error
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		var entry = index.ToTarFileEntry()
 
 		var contents = index.Open()
@@ -188,53 +609,138 @@ func (l *Layer) indexer(monitor *progress.Manual) file.TarIndexVisitor {
 				log.Warnf("unable to close file while indexing layer: %+v", err)
 			}
 		}()
-		metadata := file.NewMetadata(entry.Header, entry.Sequence, contents)
-
-		// note: the tar header name is independent of surrounding structure, for example, there may be a tar header entry
-		// for /some/path/to/file.txt without any entries to constituent paths (/some, /some/path, /some/path/to ).
-		// This is ok, and the FileTree will account for this by automatically adding directories for non-existing
-		// constituent paths. If later there happens to be a tar header entry for an already added constituent path
-		// the FileNode will be updated with the new file.Reference. If there is no tar header entry for constituent
-		// paths the FileTree is still structurally consistent (all paths can be iterated even though there may not have
-		// been a tar header entry for part of the given path).
-		//
-		// In summary: the set of all FileTrees can have NON-leaf nodes that don't exist in the FileCatalog, but
-		// the FileCatalog should NEVER have entries that don't appear in one (or more) FileTree(s).
-		var fileReference *file.Reference
-		switch metadata.TypeFlag {
-		case tar.TypeSymlink:
-			fileReference, err = l.Tree.AddSymLink(file.Path(metadata.Path), file.Path(metadata.Linkname))
-			if err != nil {
-				return err
-			}
-		case tar.TypeLink:
-			fileReference, err = l.Tree.AddHardLink(file.Path(metadata.Path), file.Path(metadata.Linkname))
-			if err != nil {
-				return err
-			}
-		case tar.TypeDir:
-			fileReference, err = l.Tree.AddDir(file.Path(metadata.Path))
-			if err != nil {
-				return err
-			}
-		default:
-			fileReference, err = l.Tree.AddFile(file.Path(metadata.Path))
-			if err != nil {
-				return err
+		return l.addTarEntry(entry.Header, entry.Sequence, contents, index.Open, monitor)
+	}
+}
+
+// addTarEntry adds a single tar entry to the layer tree and file catalog.
+func (l *Layer) addTarEntry(header tar.Header, sequence int64, contents io.Reader, opener file.Opener, monitor *progress.Manual) error {
+	if skip, stop := l.checkReadLimits(header); skip {
+		if stop {
+			return file.ErrTarStopIteration
+		}
+		return nil
+	}
+
+	var digester *file.MultiDigester
+	if len(l.fileDigests) > 0 && file.Type(header.Typeflag) == file.TypeReg && contents != nil {
+		var err error
+		if digester, err = file.NewMultiDigester(l.fileDigests...); err != nil {
+			return err
+		}
+		contents = io.TeeReader(contents, digester)
+	}
+
+	metadata := file.NewMetadata(header, sequence, nil)
+
+	var hooks *contentHookRun
+	if len(l.contentHooks) > 0 && file.Type(header.Typeflag) == file.TypeReg && contents != nil {
+		hooks = startContentHooks(l.contentHooks, l.Metadata, metadata)
+		contents = io.TeeReader(contents, hooks)
+	}
+
+	metadata.MIMEType = file.DetectMIMEType(contents, l.mimeTypeDetector, l.mimeTypeSniffSize)
+
+	if digester != nil || hooks != nil {
+		// only part of the contents may have been read to determine the MIME type
+		_, err := io.Copy(io.Discard, contents)
+		if hooks != nil {
+			if hookErr := hooks.finish(err); hookErr != nil {
+				return hookErr
 			}
 		}
-		if fileReference == nil {
-			return fmt.Errorf("could not add path=%q link=%q during tar iteration", metadata.Path, metadata.Linkname)
+		if err != nil {
+			return fmt.Errorf("unable to digest path=%q: %w", metadata.Path, err)
 		}
+	}
+	if digester != nil {
+		metadata.Digests = digester.Digests()
+		metadata.Digest = metadata.Digests[file.DigestAlgorithm(crypto.SHA256)]
+	}
+
+	if l.checkpointEntries != nil {
+		l.checkpointEntries[sequence] = layerCheckpointEntry{MIMEType: metadata.MIMEType, Digests: metadata.Digests}
+	}
+	return l.addEntryMetadata(metadata, opener, monitor)
+}
+
+// addEntryMetadata adds the tar entry described by the given metadata to the layer tree and file catalog.
+func (l *Layer) addEntryMetadata(metadata file.Metadata, opener file.Opener, monitor *progress.Manual) error {
+	// note: the tar header name is independent of surrounding structure, for example, there may be a tar header entry
+	// for /some/path/to/file.txt without any entries to constituent paths (/some, /some/path, /some/path/to ).
+	// This is ok, and the FileTree will account for this by automatically adding directories for non-existing
+	// constituent paths. If later there happens to be a tar header entry for an already added constituent path
+	// the FileNode will be updated with the new file.Reference. If there is no tar header entry for constituent
+	// paths the FileTree is still structurally consistent (all paths can be iterated even though there may not have
+	// been a tar header entry for part of the given path).
+	//
+	// In summary: the set of all FileTrees can have NON-leaf nodes that don't exist in the FileCatalog, but
+	// the FileCatalog should NEVER have entries that don't appear in one (or more) FileTree(s).
+	if l.windowsPaths {
+		metadata = windowsLayerMetadata(metadata)
+	}
+	l.checkTarEntry(metadata)
+	if err := l.replaceTypeChange(metadata); err != nil {
+		return err
+	}
+	fileReference, err := addTreePath(l.Tree, file.Type(metadata.TypeFlag), file.Path(metadata.Path), file.Path(metadata.Linkname))
+	if err != nil {
+		return err
+	}
+	if fileReference == nil {
+		return fmt.Errorf("could not add path=%q link=%q during tar iteration", metadata.Path, metadata.Linkname)
+	}
 
+	// hardlinks share the content of the original entry, so the content is only accounted for once
+	if file.Type(metadata.TypeFlag) != file.TypeHardLink {
 		l.Metadata.Size += metadata.Size
-		l.fileCatalog.Add(*fileReference, metadata, l, index.Open)
+	}
+	l.trackHardlink(metadata)
+	l.trackWhiteout(metadata)
+	l.fileCatalog.Add(*fileReference, metadata, l, opener)
 
-		monitor.N++
-		return nil
+	monitor.N++
+	return nil
+}
+
+// addTreePath adds the given path to the tree as the given file type (anything that is not a link or directory is
+// added as a regular file).
+func addTreePath(tree *filetree.FileTree, fileType file.Type, p, linkPath file.Path) (*file.Reference, error) {
+	switch fileType {
+	case file.TypeSymlink:
+		return tree.AddSymLink(p, linkPath)
+	case file.TypeHardLink:
+		return tree.AddHardLink(p, linkPath)
+	case file.TypeDir:
+		return tree.AddDir(p)
+	default:
+		return tree.AddFile(p)
 	}
 }
 
+// squashfsMIMEType detects the MIME type of the squashfs file at the given path with the given detector.
+func squashfsMIMEType(fsys fs.FS, path string, detector file.MIMETypeDetector, sniffSize int) string {
+	if detector == nil {
+		return ""
+	}
+	f, err := fsys.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	return file.DetectMIMEType(f, detector, sniffSize)
+}
+
+// squashfsContentHooks invokes the layer content hooks with the contents of the squashfs file at the given path.
+func (l *Layer) squashfsContentHooks(fsys fs.FS, path string, metadata file.Metadata) error {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return l.runContentHooks(metadata, f)
+}
+
 func (l *Layer) squashfsVisitor(monitor *progress.Manual) file.SquashFSVisitor {
 	return func(fsys fs.FS, path string, d fs.DirEntry) error {
 		ff, err := fsys.Open(path)
@@ -252,6 +758,16 @@ func (l *Layer) squashfsVisitor(monitor *progress.Manual) file.SquashFSVisitor {
 		if err != nil {
 			return err
 		}
+		if f.IsRegular() && (l.mimeTypeDetector != file.DefaultMIMETypeDetector || l.mimeTypeSniffSize != file.DefaultMIMETypeSniffSize) {
+			// the metadata was populated with the default detection, which has already consumed part of the file
+			metadata.MIMEType = squashfsMIMEType(fsys, path, l.mimeTypeDetector, l.mimeTypeSniffSize)
+		}
+		if f.IsRegular() && len(l.contentHooks) > 0 {
+			// the metadata was populated with the default detection, so the contents are read again from the start
+			if err := l.squashfsContentHooks(fsys, path, metadata); err != nil {
+				return err
+			}
+		}
 
 		var fileReference *file.Reference
 
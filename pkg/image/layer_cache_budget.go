@@ -0,0 +1,172 @@
+package image
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/anchore/stereoscope/internal/log"
+)
+
+// ErrLayerCacheBudgetExceeded indicates that caching a layer tar would exceed the on-disk budget of the layer cache
+// (see NewLayerCacheBudget).
+var ErrLayerCacheBudgetExceeded = errors.New("layer cache budget exceeded")
+
+// LayerCacheBudget bounds the combined on-disk size of the uncompressed layer tars cached while reading images. When a
+// new layer tar would exceed the budget, the least recently used layer tars that are no longer in use (e.g. belonging
+// to images that have been cleaned up, or left within a shared checkpoint directory) are evicted to make room. A
+// single budget may be shared across many image reads to enforce a global (or per-session) limit.
+type LayerCacheBudget struct {
+	lock     sync.Mutex
+	maxBytes int64
+	// failWhenExceeded indicates that reads fail instead of exceeding the budget when nothing more can be evicted
+	failWhenExceeded bool
+	used             int64
+	clock            uint64
+	entries          map[string]*layerCacheBudgetEntry
+}
+
+// layerCacheBudgetEntry is a single cached layer tar accounted for by the budget.
+type layerCacheBudgetEntry struct {
+	path     string
+	size     int64
+	pins     int
+	lastUsed uint64
+}
+
+// NewLayerCacheBudget creates a budget allowing up to the given number of bytes of cached layer tars. When the budget
+// cannot be honored after evicting all unused layer tars the read either continues over budget (with a warning) or,
+// when failWhenExceeded is set, fails with ErrLayerCacheBudgetExceeded. A non-positive size disables the budget (nil
+// is returned).
+func NewLayerCacheBudget(maxBytes int64, failWhenExceeded bool) *LayerCacheBudget {
+	if maxBytes <= 0 {
+		return nil
+	}
+	return &LayerCacheBudget{
+		maxBytes:         maxBytes,
+		failWhenExceeded: failWhenExceeded,
+		entries:          make(map[string]*layerCacheBudgetEntry),
+	}
+}
+
+// Used returns the number of bytes of cached layer tars currently accounted for by the budget.
+func (b *LayerCacheBudget) Used() int64 {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.used
+}
+
+// check returns an error if the given number of bytes can never fit within the budget (even after evicting all unused
+// layer tars) and the budget fails when exceeded. This allows failing before fetching layer content at all.
+func (b *LayerCacheBudget) check(path string, size int64) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if !b.failWhenExceeded {
+		return nil
+	}
+	pinned := b.pinnedBytes(path)
+	if pinned+size > b.maxBytes {
+		return fmt.Errorf("%w: caching %d bytes with %d bytes in use (max=%d)", ErrLayerCacheBudgetExceeded, size, pinned, b.maxBytes)
+	}
+	return nil
+}
+
+// acquire accounts for (and pins) the layer tar at the given path with the given on-disk size, evicting the least
+// recently used unpinned layer tars as needed. The returned warning is set when the budget could not be honored.
+func (b *LayerCacheBudget) acquire(path string, size int64) (string, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.clock++
+	entry, ok := b.entries[path]
+	if ok {
+		b.used -= entry.size
+	} else {
+		entry = &layerCacheBudgetEntry{path: path}
+	}
+	entry.size = size
+
+	if overage := b.used + size - b.maxBytes; overage > 0 {
+		b.evict(path, overage)
+	}
+
+	var warning string
+	if b.used+size > b.maxBytes {
+		if b.failWhenExceeded {
+			if ok {
+				// the entry is no longer accounted for (the caller is expected to remove the layer tar)
+				delete(b.entries, path)
+			}
+			return "", fmt.Errorf("%w: caching %d bytes with %d bytes in use (max=%d)", ErrLayerCacheBudgetExceeded, size, b.used, b.maxBytes)
+		}
+		warning = fmt.Sprintf("layer cache exceeds budget: %d bytes in use (max=%d)", b.used+size, b.maxBytes)
+	}
+
+	entry.pins++
+	entry.lastUsed = b.clock
+	b.entries[path] = entry
+	b.used += size
+	return warning, nil
+}
+
+// release unpins the layer tar at the given path, making it a candidate for eviction. Layer tars that no longer exist
+// (e.g. removed when the owning image was cleaned up) are no longer accounted for.
+func (b *LayerCacheBudget) release(path string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	entry, ok := b.entries[path]
+	if !ok {
+		return
+	}
+	if entry.pins > 0 {
+		entry.pins--
+	}
+	if _, err := os.Stat(path); err != nil {
+		delete(b.entries, path)
+		b.used -= entry.size
+	}
+}
+
+// evict removes unpinned layer tars (least recently used first, excluding the given path) until at least the given
+// number of bytes are freed or nothing more can be evicted.
+func (b *LayerCacheBudget) evict(exclude string, bytes int64) {
+	var candidates []*layerCacheBudgetEntry
+	for _, entry := range b.entries {
+		if entry.pins == 0 && entry.path != exclude {
+			candidates = append(candidates, entry)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].lastUsed < candidates[j].lastUsed
+	})
+
+	var freed int64
+	for _, entry := range candidates {
+		if freed >= bytes {
+			break
+		}
+		if err := os.Remove(entry.path); err != nil && !os.IsNotExist(err) {
+			log.Warnf("unable to evict layer cache=%q: %+v", entry.path, err)
+			continue
+		}
+		log.Debugf("evicted layer cache=%q (%d bytes)", entry.path, entry.size)
+		delete(b.entries, entry.path)
+		b.used -= entry.size
+		freed += entry.size
+	}
+}
+
+// pinnedBytes returns the number of bytes of layer tars in use (excluding the given path), which cannot be evicted.
+func (b *LayerCacheBudget) pinnedBytes(exclude string) int64 {
+	var pinned int64
+	for _, entry := range b.entries {
+		if entry.pins > 0 && entry.path != exclude {
+			pinned += entry.size
+		}
+	}
+	return pinned
+}
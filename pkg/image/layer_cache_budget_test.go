@@ -0,0 +1,147 @@
+package image
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeBudgetTestFile(t *testing.T, dir, name string, size int) string {
+	t.Helper()
+	p := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(p, []byte(strings.Repeat("x", size)), 0600))
+	return p
+}
+
+func TestLayerCacheBudget(t *testing.T) {
+	assert.Nil(t, NewLayerCacheBudget(0, false))
+
+	dir := t.TempDir()
+	budget := NewLayerCacheBudget(100, false)
+
+	a := writeBudgetTestFile(t, dir, "a", 40)
+	b := writeBudgetTestFile(t, dir, "b", 40)
+	c := writeBudgetTestFile(t, dir, "c", 40)
+
+	for _, p := range []string{a, b} {
+		warning, err := budget.acquire(p, 40)
+		require.NoError(t, err)
+		assert.Empty(t, warning)
+	}
+	assert.Equal(t, int64(80), budget.Used())
+
+	// b is used more recently than a, so a is evicted first
+	budget.release(b)
+	budget.release(a)
+	warning, err := budget.acquire(b, 40)
+	require.NoError(t, err)
+	assert.Empty(t, warning)
+	budget.release(b)
+
+	warning, err = budget.acquire(c, 40)
+	require.NoError(t, err)
+	assert.Empty(t, warning)
+	assert.NoFileExists(t, a)
+	assert.FileExists(t, b)
+	assert.Equal(t, int64(80), budget.Used())
+
+	// nothing more can be evicted while in use, so the budget is exceeded
+	_, err = budget.acquire(b, 40)
+	require.NoError(t, err)
+	d := writeBudgetTestFile(t, dir, "d", 40)
+	warning, err = budget.acquire(d, 40)
+	require.NoError(t, err)
+	assert.NotEmpty(t, warning)
+	assert.Equal(t, int64(120), budget.Used())
+
+	// removed files are no longer accounted for once released
+	require.NoError(t, os.Remove(d))
+	budget.release(d)
+	assert.Equal(t, int64(80), budget.Used())
+}
+
+func TestLayerCacheBudget_FailWhenExceeded(t *testing.T) {
+	dir := t.TempDir()
+	budget := NewLayerCacheBudget(100, true)
+
+	a := writeBudgetTestFile(t, dir, "a", 60)
+	_, err := budget.acquire(a, 60)
+	require.NoError(t, err)
+
+	assert.True(t, errors.Is(budget.check("b", 50), ErrLayerCacheBudgetExceeded))
+	assert.NoError(t, budget.check("b", 40))
+
+	b := writeBudgetTestFile(t, dir, "b", 50)
+	_, err = budget.acquire(b, 50)
+	assert.True(t, errors.Is(err, ErrLayerCacheBudgetExceeded))
+	assert.Equal(t, int64(60), budget.Used())
+
+	// once released, the unused layer tar is evicted to make room
+	budget.release(a)
+	_, err = budget.acquire(b, 50)
+	require.NoError(t, err)
+	assert.NoFileExists(t, a)
+	assert.Equal(t, int64(50), budget.Used())
+}
+
+func TestImage_Read_LayerCacheBudget(t *testing.T) {
+	first, err := mutate.AppendLayers(empty.Image, newTestTarLayer(t, testTarEntry{name: "etc/first", contents: strings.Repeat("a", 4096)}))
+	require.NoError(t, err)
+	second, err := mutate.AppendLayers(empty.Image, newTestTarLayer(t, testTarEntry{name: "etc/second", contents: strings.Repeat("b", 4096)}))
+	require.NoError(t, err)
+
+	// the layer tars within a checkpoint directory outlive the image, and may be evicted once the image is cleaned up
+	checkpoints := t.TempDir()
+	budget := NewLayerCacheBudget(8*1024, true)
+
+	img := NewImage(first, t.TempDir())
+	require.NoError(t, img.Read(WithCatalogCheckpoints(checkpoints), WithLayerCacheBudget(budget)))
+	firstTar := filepath.Join(checkpoints, layerCacheFileName(img.Layers[0].Metadata.Digest))
+	assert.FileExists(t, firstTar)
+	used := budget.Used()
+	assert.Greater(t, used, int64(0))
+
+	// while the first image is in use, the second layer tar can not fit
+	failed := NewImage(second, t.TempDir())
+	err = failed.Read(WithCatalogCheckpoints(checkpoints), WithLayerCacheBudget(budget))
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrLayerCacheBudgetExceeded))
+	assert.FileExists(t, firstTar)
+	assert.Equal(t, used, budget.Used())
+
+	require.NoError(t, img.Cleanup())
+	img = NewImage(second, t.TempDir())
+	require.NoError(t, img.Read(WithCatalogCheckpoints(checkpoints), WithLayerCacheBudget(budget)))
+	t.Cleanup(func() { _ = img.Cleanup() })
+	assert.NoFileExists(t, firstTar)
+	assert.FileExists(t, filepath.Join(checkpoints, layerCacheFileName(img.Layers[0].Metadata.Digest)))
+
+	contents, err := img.FileContentsFromSquash("/etc/second")
+	require.NoError(t, err)
+	b, err := ioutil.ReadAll(contents)
+	require.NoError(t, err)
+	assert.Len(t, b, 4096)
+}
+
+func TestImage_Read_LayerCacheBudget_Exceeded(t *testing.T) {
+	v1Image, err := mutate.AppendLayers(empty.Image, newTestTarLayer(t, testTarEntry{name: "etc/large", contents: strings.Repeat("a", 4096)}))
+	require.NoError(t, err)
+
+	img := NewImage(v1Image, t.TempDir())
+	require.NoError(t, img.Read(WithLayerCacheBudget(NewLayerCacheBudget(1024, false))))
+	t.Cleanup(func() { _ = img.Cleanup() })
+
+	var kinds []WarningKind
+	for _, w := range img.Warnings() {
+		kinds = append(kinds, w.Kind)
+	}
+	assert.Contains(t, kinds, WarningCacheBudget)
+}
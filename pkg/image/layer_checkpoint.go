@@ -0,0 +1,215 @@
+package image
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/anchore/stereoscope/internal/log"
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/wagoodman/go-progress"
+)
+
+// layerCheckpointVersion is the schema version of layer checkpoints, incremented on any breaking change.
+const layerCheckpointVersion = 1
+
+// layerCheckpoint is the completion marker for a fully indexed layer tar, persisted alongside the layer tar cache so
+// that a later read (e.g. after a crash or cancellation) can restore the layer without indexing it again (see
+// WithCatalogCheckpoints).
+type layerCheckpoint struct {
+	Version  int                     `json:"version"`
+	Digest   string                  `json:"digest"`
+	Settings layerCheckpointSettings `json:"settings"`
+	Entries  []layerCheckpointEntry  `json:"entries"`
+}
+
+// layerCheckpointSettings are the read options that affect the result of indexing a layer, checkpoints written with
+// different settings are not used.
+type layerCheckpointSettings struct {
+	FileDigests       string     `json:"fileDigests"`
+	MIMETypes         bool       `json:"mimeTypes"`
+	MIMETypeSniffSize int        `json:"mimeTypeSniffSize"`
+	Limited           bool       `json:"limited"`
+	ReadLimits        ReadLimits `json:"readLimits"`
+}
+
+// layerCheckpointEntry is a single tar index entry along with the details derived from the entry contents.
+type layerCheckpointEntry struct {
+	Sequence int64             `json:"sequence"`
+	Header   tar.Header        `json:"header"`
+	Offset   int64             `json:"offset"`
+	MIMEType string            `json:"mimeType,omitempty"`
+	Digests  map[string]string `json:"digests,omitempty"`
+}
+
+// digestAlgorithms returns the comma separated names of the given digest algorithms.
+func digestAlgorithms(hashes []file.DigestHash) string {
+	names := make([]string, len(hashes))
+	for i, h := range hashes {
+		names[i] = file.DigestAlgorithm(h)
+	}
+	return strings.Join(names, ",")
+}
+
+// newLayerCheckpointSettings returns the settings to record within (and match against) layer checkpoints. Checkpoints
+// cannot be used when a custom MIME type detector is configured, since the detector results cannot be compared.
+func newLayerCheckpointSettings(cfg readConfig) (layerCheckpointSettings, bool) {
+	if cfg.checkpointDir == "" {
+		return layerCheckpointSettings{}, false
+	}
+	if cfg.mimeTypeDetector != nil && cfg.mimeTypeDetector != file.DefaultMIMETypeDetector {
+		return layerCheckpointSettings{}, false
+	}
+	settings := layerCheckpointSettings{
+		FileDigests: digestAlgorithms(cfg.fileDigests),
+		MIMETypes:   cfg.mimeTypeDetector != nil,
+	}
+	if settings.MIMETypes {
+		settings.MIMETypeSniffSize = cfg.mimeTypeSniffSize
+	}
+	if cfg.readLimits != nil {
+		settings.Limited = true
+		settings.ReadLimits = *cfg.readLimits
+	}
+	return settings, true
+}
+
+// layerCheckpointPath returns the path of the checkpoint for the layer with the given digest.
+func layerCheckpointPath(dir, digest string) string {
+	return path.Join(dir, strings.ReplaceAll(digest, ":", "-")+".checkpoint.json.gz")
+}
+
+// restoreCheckpoint populates the layer from a checkpoint within the given directory, indicating if the layer was
+// restored. A missing, stale, or invalid checkpoint is not an error, the layer should be indexed instead.
+func (l *Layer) restoreCheckpoint(dir, tarFilePath string, settings layerCheckpointSettings, monitor *progress.Manual) (bool, error) {
+	checkpointPath := layerCheckpointPath(dir, l.Metadata.Digest)
+	checkpoint, err := readLayerCheckpoint(checkpointPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("ignoring invalid layer checkpoint=%q: %+v", checkpointPath, err)
+			l.warn(WarningInvalidCache, "", "ignoring invalid layer checkpoint=%q: %v", checkpointPath, err)
+		}
+		return false, nil
+	}
+	if err := checkpoint.validate(l.Metadata.Digest, tarFilePath); err != nil {
+		log.Warnf("ignoring invalid layer checkpoint=%q: %+v", checkpointPath, err)
+		l.warn(WarningInvalidCache, "", "ignoring invalid layer checkpoint=%q: %v", checkpointPath, err)
+		return false, nil
+	}
+	if checkpoint.Settings != settings {
+		log.Debugf("ignoring layer checkpoint=%q written with different read options", checkpointPath)
+		return false, nil
+	}
+
+	entries := make([]file.TarIndexEntry, 0, len(checkpoint.Entries))
+	for _, e := range checkpoint.Entries {
+		entry := file.NewTarIndexEntry(tarFilePath, e.Sequence, e.Header, e.Offset)
+		entries = append(entries, entry)
+
+		// replay the limits for the entry, which are not recorded within the checkpoint
+		if skip, stop := l.checkReadLimits(e.Header); skip {
+			if stop {
+				break
+			}
+			continue
+		}
+
+		metadata := file.NewMetadata(e.Header, e.Sequence, nil)
+		metadata.MIMEType = e.MIMEType
+		metadata.Digests = e.Digests
+		metadata.Digest = e.Digests[file.DigestAlgorithm(crypto.SHA256)]
+		if err := l.addEntryMetadata(metadata, entry.Open, monitor); err != nil {
+			return false, fmt.Errorf("unable to restore layer checkpoint=%q: %w", checkpointPath, err)
+		}
+	}
+	l.indexedContent = file.NewTarIndexFromEntries(entries)
+	log.Debugf("restored layer=%q from checkpoint=%q", l.Metadata.Digest, checkpointPath)
+	return true, nil
+}
+
+// validate ensures the checkpoint describes the layer with the given digest and that all entries are within the tar.
+func (c layerCheckpoint) validate(digest, tarFilePath string) error {
+	if c.Version != layerCheckpointVersion {
+		return fmt.Errorf("unsupported checkpoint version: %d", c.Version)
+	}
+	if c.Digest != digest {
+		return fmt.Errorf("checkpoint is for layer=%q", c.Digest)
+	}
+	info, err := os.Stat(tarFilePath)
+	if err != nil {
+		return err
+	}
+	for _, e := range c.Entries {
+		if e.Offset < 0 || e.Header.Size < 0 || e.Offset+e.Header.Size > info.Size() {
+			return fmt.Errorf("entry=%q is outside of the layer tar", e.Header.Name)
+		}
+	}
+	return nil
+}
+
+// writeCheckpoint persists a checkpoint for the (fully indexed) layer within the given directory. The checkpoint is
+// written to a partial file and atomically moved into place, so a crash never leaves a partially written checkpoint.
+func (l *Layer) writeCheckpoint(dir string, settings layerCheckpointSettings) error {
+	if l.indexedContent == nil {
+		return fmt.Errorf("layer has no tar index")
+	}
+
+	checkpoint := layerCheckpoint{
+		Version:  layerCheckpointVersion,
+		Digest:   l.Metadata.Digest,
+		Settings: settings,
+	}
+	for _, entry := range l.indexedContent.Entries() {
+		e := l.checkpointEntries[entry.Sequence()]
+		e.Sequence = entry.Sequence()
+		e.Header = entry.Header()
+		e.Offset = entry.Offset()
+		checkpoint.Entries = append(checkpoint.Entries, e)
+	}
+
+	checkpointPath := layerCheckpointPath(dir, l.Metadata.Digest)
+	fh, err := ioutil.TempFile(dir, path.Base(checkpointPath)+".partial-*")
+	if err != nil {
+		return fmt.Errorf("unable to create layer checkpoint=%q: %w", checkpointPath, err)
+	}
+	defer os.Remove(fh.Name())
+	defer fh.Close()
+
+	gw := gzip.NewWriter(fh)
+	if err := json.NewEncoder(gw).Encode(checkpoint); err != nil {
+		return fmt.Errorf("unable to encode layer checkpoint=%q: %w", checkpointPath, err)
+	}
+	if err := gw.Close(); err != nil {
+		return fmt.Errorf("unable to write layer checkpoint=%q: %w", checkpointPath, err)
+	}
+	if err := fh.Close(); err != nil {
+		return fmt.Errorf("unable to write layer checkpoint=%q: %w", checkpointPath, err)
+	}
+	return os.Rename(fh.Name(), checkpointPath)
+}
+
+func readLayerCheckpoint(checkpointPath string) (*layerCheckpoint, error) {
+	fh, err := os.Open(checkpointPath)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	gr, err := gzip.NewReader(fh)
+	if err != nil {
+		return nil, err
+	}
+	defer gr.Close()
+
+	var checkpoint layerCheckpoint
+	if err := json.NewDecoder(gr).Decode(&checkpoint); err != nil {
+		return nil, err
+	}
+	return &checkpoint, nil
+}
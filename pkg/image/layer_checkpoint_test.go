@@ -0,0 +1,123 @@
+package image
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+func readCheckpointTestImage(t *testing.T, layers []v1.Layer, options ...ReadOption) *Image {
+	t.Helper()
+	v1Image, err := mutate.AppendLayers(empty.Image, layers...)
+	require.NoError(t, err)
+	img := NewImage(v1Image, t.TempDir())
+	require.NoError(t, img.Read(options...))
+	t.Cleanup(func() {
+		_ = img.Cleanup()
+	})
+	return img
+}
+
+// tamperCheckpointMIMEType rewrites the MIME type of every regular file within all checkpoints in the given directory,
+// so a read that restores layers from checkpoints (instead of indexing them again) can be observed.
+func tamperCheckpointMIMEType(t *testing.T, dir, mimeType string) {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(dir, "*.checkpoint.json.gz"))
+	require.NoError(t, err)
+	require.NotEmpty(t, paths)
+	for _, p := range paths {
+		checkpoint, err := readLayerCheckpoint(p)
+		require.NoError(t, err)
+		for i := range checkpoint.Entries {
+			if checkpoint.Entries[i].MIMEType != "" {
+				checkpoint.Entries[i].MIMEType = mimeType
+			}
+		}
+		fh, err := os.Create(p)
+		require.NoError(t, err)
+		gw := gzip.NewWriter(fh)
+		require.NoError(t, json.NewEncoder(gw).Encode(checkpoint))
+		require.NoError(t, gw.Close())
+		require.NoError(t, fh.Close())
+	}
+}
+
+func squashMIMEType(t *testing.T, img *Image, p file.Path) string {
+	t.Helper()
+	_, ref, err := img.SquashedTree().File(p)
+	require.NoError(t, err)
+	require.NotNil(t, ref)
+	entry, err := img.FileCatalog.Get(*ref)
+	require.NoError(t, err)
+	return entry.Metadata.MIMEType
+}
+
+func TestImage_CatalogCheckpoints(t *testing.T) {
+	layers := []v1.Layer{
+		newTestTarLayer(t, testTarEntry{name: "etc/hello.txt", contents: "hello"}),
+		newTestTarLayer(t,
+			testTarEntry{name: "etc/.wh.hello.txt"},
+			testTarEntry{name: "usr/bin/tool", contents: "tool"},
+			testTarEntry{name: "usr/bin/alias", linkname: "tool", typeflag: tar.TypeSymlink},
+		),
+	}
+	dir := t.TempDir()
+
+	original := readCheckpointTestImage(t, layers, WithCatalogCheckpoints(dir))
+	for _, layer := range original.Layers {
+		assert.FileExists(t, layerCheckpointPath(dir, layer.Metadata.Digest))
+		assert.FileExists(t, filepath.Join(dir, layerCacheFileName(layer.Metadata.Digest)))
+	}
+
+	tamperCheckpointMIMEType(t, dir, "application/x-restored")
+
+	t.Run("resumes from checkpoints", func(t *testing.T) {
+		restored := readCheckpointTestImage(t, layers, WithCatalogCheckpoints(dir))
+		assert.Empty(t, restored.Warnings())
+		assert.Equal(t, "application/x-restored", squashMIMEType(t, restored, "/usr/bin/tool"))
+		assert.False(t, restored.SquashedTree().HasPath("/etc/hello.txt"))
+		assert.ElementsMatch(t, original.SquashedTree().AllRealPaths(), restored.SquashedTree().AllRealPaths())
+		for idx := range original.Layers {
+			assert.Equal(t, original.Layers[idx].Metadata.Size, restored.Layers[idx].Metadata.Size)
+		}
+
+		contents, err := restored.FileContentsFromSquash("/usr/bin/alias")
+		require.NoError(t, err)
+		defer contents.Close()
+		b, err := ioutil.ReadAll(contents)
+		require.NoError(t, err)
+		assert.Equal(t, "tool", string(b))
+	})
+
+	t.Run("ignores checkpoints with different read options", func(t *testing.T) {
+		indexed := readCheckpointTestImage(t, layers, WithCatalogCheckpoints(dir), WithMIMETypeDetector(file.DefaultMIMETypeDetector, 16))
+		assert.Equal(t, "text/plain", squashMIMEType(t, indexed, "/usr/bin/tool"))
+	})
+
+	t.Run("ignores invalid checkpoints", func(t *testing.T) {
+		invalidDir := t.TempDir()
+		readCheckpointTestImage(t, layers, WithCatalogCheckpoints(invalidDir))
+		require.NoError(t, ioutil.WriteFile(layerCheckpointPath(invalidDir, original.Layers[1].Metadata.Digest), []byte("garbage"), 0600))
+
+		indexed := readCheckpointTestImage(t, layers, WithCatalogCheckpoints(invalidDir))
+		assert.Equal(t, "text/plain", squashMIMEType(t, indexed, "/usr/bin/tool"))
+		require.Len(t, indexed.Warnings(), 1)
+		assert.Equal(t, WarningInvalidCache, indexed.Warnings()[0].Kind)
+
+		// the invalid checkpoint is replaced after the layer is indexed again
+		_, err := readLayerCheckpoint(layerCheckpointPath(invalidDir, original.Layers[1].Metadata.Digest))
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,65 @@
+package image
+
+import (
+	"context"
+	"io"
+
+	"github.com/anchore/stereoscope/internal/bus"
+	"github.com/anchore/stereoscope/pkg/event"
+	"github.com/wagoodman/go-partybus"
+	"github.com/wagoodman/go-progress"
+)
+
+// LayerDownload is the payload for the event.LayerDownloadStarted and event.LayerDownloadCompleted events.
+type LayerDownload struct {
+	Metadata LayerMetadata
+	// Bytes counts the uncompressed layer bytes fetched so far. Upon completion the error is either
+	// progress.ErrCompleted or the reason the download failed (e.g. context cancellation).
+	Bytes *progress.Manual
+}
+
+// trackLayerDownload publishes the start of a layer download, returning a reader that counts all bytes read from the
+// given reader (stopping on context cancellation) and a function to call once the download has finished.
+func trackLayerDownload(ctx context.Context, metadata LayerMetadata, reader io.Reader) (io.Reader, func(error)) {
+	download := LayerDownload{
+		Metadata: metadata,
+		Bytes:    &progress.Manual{},
+	}
+
+	bus.Publish(partybus.Event{
+		Type:   event.LayerDownloadStarted,
+		Source: metadata,
+		Value:  download,
+	})
+
+	complete := func(err error) {
+		if err != nil {
+			download.Bytes.Err = err
+		} else {
+			download.Bytes.SetCompleted()
+		}
+		bus.Publish(partybus.Event{
+			Type:   event.LayerDownloadCompleted,
+			Source: metadata,
+			Value:  download,
+		})
+	}
+
+	return &countingReader{ctx: ctx, reader: reader, counter: download.Bytes}, complete
+}
+
+// countingReader counts all bytes read into the given progress, refusing to read further once the context is done.
+type countingReader struct {
+	ctx     context.Context
+	reader  io.Reader
+	counter *progress.Manual
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := r.reader.Read(p)
+	r.counter.N += int64(n)
+	return n, err
+}
@@ -1,6 +1,9 @@
 package image
 
 import (
+	"bytes"
+	"fmt"
+
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	v1Types "github.com/google/go-containerregistry/pkg/v1/types"
 )
@@ -13,6 +16,9 @@ type LayerMetadata struct {
 	MediaType v1Types.MediaType
 	// Size in bytes of the layer content size
 	Size int64
+	// Annotations are the annotations of the layer descriptor within the image manifest (e.g. build cache details),
+	// nil when there are none or no manifest is available
+	Annotations map[string]string `json:",omitempty"`
 }
 
 // newLayerMetadata aggregates pertinent layer metadata information.
@@ -23,10 +29,34 @@ func newLayerMetadata(imgMetadata Metadata, layer v1.Layer, idx int) (LayerMetad
 	}
 
 	// digest = diff-id = a digest of the uncompressed layer content
-	diffIDHash := imgMetadata.Config.RootFS.DiffIDs[idx]
-	return LayerMetadata{
+	diffIDs := imgMetadata.Config.RootFS.DiffIDs
+	if idx < 0 || idx >= len(diffIDs) {
+		return LayerMetadata{}, fmt.Errorf("image config has no diff ID for layer=%d (has %d diff IDs)", idx, len(diffIDs))
+	}
+	diffIDHash := diffIDs[idx]
+	metadata := LayerMetadata{
 		Index:     uint(idx),
 		Digest:    diffIDHash.String(),
 		MediaType: mediaType,
-	}, nil
+	}
+	if desc, ok := manifestLayerDescriptor(imgMetadata, idx); ok && len(desc.Annotations) > 0 {
+		metadata.Annotations = make(map[string]string, len(desc.Annotations))
+		for key, value := range desc.Annotations {
+			metadata.Annotations[key] = value
+		}
+	}
+	return metadata, nil
+}
+
+// manifestLayerDescriptor returns the descriptor of the layer at the given index within the image manifest (false if
+// there is no manifest or no such layer).
+func manifestLayerDescriptor(imgMetadata Metadata, idx int) (v1.Descriptor, bool) {
+	if len(imgMetadata.RawManifest) == 0 {
+		return v1.Descriptor{}, false
+	}
+	manifest, err := v1.ParseManifest(bytes.NewReader(imgMetadata.RawManifest))
+	if err != nil || idx >= len(manifest.Layers) {
+		return v1.Descriptor{}, false
+	}
+	return manifest.Layers[idx], true
 }
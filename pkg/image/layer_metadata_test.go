@@ -0,0 +1,44 @@
+package image
+
+import (
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImage_Read_Annotations(t *testing.T) {
+	base := newTestTarLayer(t, testTarEntry{name: "base", contents: "base"})
+	app := newTestTarLayer(t, testTarEntry{name: "app", contents: "app"})
+
+	v1Image, err := mutate.Append(empty.Image,
+		mutate.Addendum{Layer: base, Annotations: map[string]string{"moby.buildkit.cache.v0": "cached"}},
+		mutate.Addendum{Layer: app},
+	)
+	require.NoError(t, err)
+	v1Image = mutate.Annotations(v1Image, map[string]string{
+		AnnotationBaseImageName:   "docker.io/library/alpine:3.14",
+		AnnotationBaseImageDigest: "sha256:0000000000000000000000000000000000000000000000000000000000000000",
+	}).(v1.Image)
+
+	rawManifest, err := v1Image.RawManifest()
+	require.NoError(t, err)
+
+	img := NewImage(v1Image, t.TempDir(), WithManifest(rawManifest))
+	require.NoError(t, img.Read())
+
+	assert.Equal(t, "docker.io/library/alpine:3.14", img.Metadata.Annotations[AnnotationBaseImageName])
+	require.Len(t, img.Layers, 2)
+	assert.Equal(t, map[string]string{"moby.buildkit.cache.v0": "cached"}, img.Layers[0].Metadata.Annotations)
+	assert.Nil(t, img.Layers[1].Metadata.Annotations)
+}
+
+func TestImage_Read_AnnotationsWithoutManifest(t *testing.T) {
+	img := newTestImageFromLayers(t, []v1.Layer{newTestTarLayer(t, testTarEntry{name: "base", contents: "base"})})
+
+	assert.Nil(t, img.Metadata.Annotations)
+	assert.Nil(t, img.Layers[0].Metadata.Annotations)
+}
@@ -0,0 +1,143 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/anchore/stereoscope/internal/log"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/wagoodman/go-progress"
+)
+
+// readLayers reads all given layers (fetching content and building each layer tree) using up to the configured number
+// of concurrent workers (see WithLayerReadConcurrency). Layers that are referenced multiple times within the image are
+// only read once, all other references are populated from the first (lowest) reference once all reads have completed.
+func (i *Image) readLayers(ctx context.Context, cfg readConfig, v1Layers []v1.Layer, readProg *progress.Manual, options ...ReadOption) ([]*Layer, error) {
+	layers := make([]*Layer, len(v1Layers))
+	duplicateOf := make(map[int]int)
+	firstByDigest := make(map[string]int)
+	var toRead []int
+	for idx, v1Layer := range v1Layers {
+		layers[idx] = NewLayer(v1Layer)
+		if cfg.belowTopLayers(idx, len(layers)) {
+			// skipped layers are never the original of a duplicate, otherwise an upper layer would be empty as well
+			toRead = append(toRead, idx)
+			continue
+		}
+		digest := i.Metadata.Config.RootFS.DiffIDs[idx].String()
+		if original, ok := firstByDigest[digest]; ok {
+			duplicateOf[idx] = original
+			continue
+		}
+		firstByDigest[digest] = idx
+		toRead = append(toRead, idx)
+	}
+
+	workers := cfg.layerConcurrency
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(toRead) {
+		workers = len(toRead)
+	}
+
+	readCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		errOnce  sync.Once
+		firstErr error
+		wg       sync.WaitGroup
+		queue    = make(chan int)
+	)
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			// stop all other layer reads, there is no need to continue
+			cancel()
+		})
+	}
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range queue {
+				if err := i.readLayer(readCtx, cfg, layers[idx], idx, len(layers), options...); err != nil {
+					fail(err)
+					continue
+				}
+				atomic.AddInt64(&readProg.N, 1)
+			}
+		}()
+	}
+
+enqueue:
+	for _, idx := range toRead {
+		select {
+		case <-readCtx.Done():
+			break enqueue
+		case queue <- idx:
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		readProg.Err = err
+		return nil, fmt.Errorf("read canceled: %w", err)
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	for idx, layer := range layers {
+		original, ok := duplicateOf[idx]
+		if !ok {
+			i.Metadata.Size += layer.Metadata.Size
+			continue
+		}
+		if err := layer.readAsDuplicate(layers[original], i.Metadata, idx); err != nil {
+			return nil, err
+		}
+		log.Debugf("layer=%d is a duplicate of layer=%d (digest=%q)", idx, original, layer.Metadata.Digest)
+		readProg.N++
+	}
+	return layers, nil
+}
+
+// readLayer reads a single layer (of the given number of image layers), marking the layer as unavailable (instead of
+// failing) when the layer content is missing and missing layers are allowed.
+func (i *Image) readLayer(ctx context.Context, cfg readConfig, layer *Layer, idx, layerCount int, options ...ReadOption) error {
+	if cfg.readLimits != nil && cfg.readLimits.MaxLayers > 0 && idx >= cfg.readLimits.MaxLayers {
+		return layer.readOverLimit(&i.FileCatalog, i.Metadata, idx, cfg.readLimits.MaxLayers)
+	}
+
+	if cfg.belowTopLayers(idx, layerCount) {
+		return layer.readBelowTop(&i.FileCatalog, i.Metadata, idx)
+	}
+
+	if cfg.skipForeignLayers {
+		if skipped, err := layer.readSkippedForeign(&i.FileCatalog, i.Metadata, idx); skipped || err != nil {
+			return err
+		}
+	}
+
+	err := layer.ReadWithContext(ctx, &i.FileCatalog, i.Metadata, idx, i.contentCacheDir, options...)
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return err
+	}
+	if !cfg.allowMissingLayers || !errors.Is(err, ErrLayerUnavailable) {
+		return err
+	}
+	log.Warnf("skipping unavailable layer=%q: %+v", layer.Metadata.Digest, err)
+	layer.Unavailable = true
+	layer.warn(WarningUnavailableLayer, "", "skipping unavailable layer=%q: %v", layer.Metadata.Digest, err)
+	return nil
+}
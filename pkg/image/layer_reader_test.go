@@ -0,0 +1,166 @@
+package image
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync/atomic"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImage_Read_LayerReadConcurrency(t *testing.T) {
+	var layers []v1.Layer
+	for idx := 0; idx < 12; idx++ {
+		layers = append(layers, newTestTarLayer(t,
+			testTarEntry{name: fmt.Sprintf("layer-%d/file.txt", idx), contents: fmt.Sprintf("contents %d", idx)},
+			testTarEntry{name: "shared/last.txt", contents: fmt.Sprintf("written by %d", idx)},
+		))
+	}
+	// repeated layers are still only read once
+	layers = append(layers, layers[3])
+
+	v1Image, err := mutate.AppendLayers(empty.Image, layers...)
+	require.NoError(t, err)
+
+	sequential := NewImage(v1Image, t.TempDir())
+	require.NoError(t, sequential.Read())
+
+	for _, workers := range []int{2, 4, 50} {
+		t.Run(fmt.Sprintf("workers=%d", workers), func(t *testing.T) {
+			img := NewImage(v1Image, t.TempDir())
+			require.NoError(t, img.Read(WithLayerReadConcurrency(workers)))
+
+			require.Len(t, img.Layers, len(layers))
+			for idx, layer := range img.Layers {
+				assert.Equal(t, uint(idx), layer.Metadata.Index)
+				assert.Equal(t, sequential.Layers[idx].Metadata, layer.Metadata)
+			}
+			assert.Equal(t, img.Layers[3], img.Layers[len(layers)-1].DuplicateOf())
+			assert.Equal(t, sequential.Metadata.Size, img.Metadata.Size)
+			assert.ElementsMatch(t, sequential.SquashedTree().AllRealPaths(), img.SquashedTree().AllRealPaths())
+
+			contents, err := img.FileContentsFromSquash("/shared/last.txt")
+			require.NoError(t, err)
+			defer contents.Close()
+			b := make([]byte, 64)
+			n, _ := contents.Read(b)
+			assert.Equal(t, "written by 3", string(b[:n]))
+		})
+	}
+}
+
+func TestImage_Read_LayerReadConcurrency_Error(t *testing.T) {
+	var layers []v1.Layer
+	for idx := 0; idx < 6; idx++ {
+		layers = append(layers, newTestTarLayer(t, testTarEntry{name: fmt.Sprintf("file-%d", idx), contents: "x"}))
+	}
+	v1Image, err := mutate.AppendLayers(empty.Image, layers...)
+	require.NoError(t, err)
+
+	img := NewImage(v1Image, t.TempDir())
+	// a cache directory that cannot be created fails every layer read
+	img.contentCacheDir = "/dev/null/not-a-dir"
+	assert.Error(t, img.Read(WithLayerReadConcurrency(3)))
+}
+
+func TestImage_Read_WithTopLayers(t *testing.T) {
+	var baseOpens int64
+	baseContent := newTestTar(t,
+		testTarEntry{name: "etc/base.txt", contents: "base"},
+		testTarEntry{name: "etc/os-release", contents: "golden"},
+	)
+	base, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		atomic.AddInt64(&baseOpens, 1)
+		return ioutil.NopCloser(bytes.NewReader(baseContent)), nil
+	})
+	require.NoError(t, err)
+
+	app := newTestTarLayer(t,
+		testTarEntry{name: "app/main", contents: "app"},
+		// deleting a file from a layer that is not read is harmless
+		testTarEntry{name: "etc/.wh.base.txt"},
+	)
+	config := newTestTarLayer(t, testTarEntry{name: "app/config.json", contents: "{}"})
+
+	tests := []struct {
+		name        string
+		layers      []v1.Layer
+		top         int
+		unavailable []bool
+		expected    []file.Path
+	}{
+		{
+			name:        "only the top layers are read",
+			layers:      []v1.Layer{base, app, config},
+			top:         2,
+			unavailable: []bool{true, false, false},
+			expected:    []file.Path{"/", "/app", "/app/main", "/app/config.json", "/etc"},
+		},
+		{
+			name:        "all layers are read when n covers the image",
+			layers:      []v1.Layer{base, app},
+			top:         5,
+			unavailable: []bool{false, false},
+			expected:    []file.Path{"/", "/app", "/app/main", "/etc", "/etc/os-release"},
+		},
+		{
+			name:        "a top layer is read even if it repeats a skipped layer",
+			layers:      []v1.Layer{base, app, base},
+			top:         1,
+			unavailable: []bool{true, true, false},
+			expected:    []file.Path{"/", "/etc", "/etc/base.txt", "/etc/os-release"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v1Image, err := mutate.AppendLayers(empty.Image, test.layers...)
+			require.NoError(t, err)
+
+			img := NewImage(v1Image, t.TempDir())
+			atomic.StoreInt64(&baseOpens, 0)
+			require.NoError(t, img.Read(WithTopLayers(test.top)))
+			require.Len(t, img.Layers, len(test.layers))
+
+			var expectedOpens bool
+			for idx, layer := range img.Layers {
+				assert.Equal(t, test.unavailable[idx], layer.Unavailable, "layer %d", idx)
+				assert.Nil(t, layer.DuplicateOf(), "layer %d", idx)
+				if layer.Unavailable {
+					assert.Empty(t, layer.Tree.AllFiles(), "layer %d", idx)
+				} else if test.layers[idx] == base {
+					expectedOpens = true
+				}
+			}
+			assert.Equal(t, expectedOpens, atomic.LoadInt64(&baseOpens) > 0)
+			assert.ElementsMatch(t, test.expected, img.SquashedTree().AllRealPaths())
+		})
+	}
+}
+
+func TestImage_Read_LayerReadConcurrency_SharedOptions(t *testing.T) {
+	var layers []v1.Layer
+	for idx := 0; idx < 8; idx++ {
+		layers = append(layers, newTestTarLayer(t, testTarEntry{name: fmt.Sprintf("file-%d", idx), contents: "x"}))
+	}
+
+	// the options given to every layer read must never be modified in place (run with -race)
+	img := newTestImageFromLayers(t, layers,
+		WithLayerReadConcurrency(4),
+		WithMetadataOnlyChangeDetection(),
+		WithTypeChangeWarnings(),
+	)
+	require.Len(t, img.Layers, len(layers))
+	for idx := range layers {
+		assert.True(t, img.SquashedTree().HasPath(file.Path(fmt.Sprintf("/file-%d", idx))))
+	}
+}
@@ -0,0 +1,83 @@
+package image
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/wagoodman/go-progress"
+)
+
+// WithLayers returns a view of this (already read) image restricted to the layers at the given indexes (in build
+// order), for instance to compare the base image layers against the full image. The view shares the layer trees,
+// cached layer content, and file metadata with this image, only the squash trees (and the file catalog entries, which
+// are restricted to the selected layers) are derived for the view. When the selected layers are the lowest layers of
+// the image the existing squash trees are reused as well.
+//
+// Each layer within the view keeps the metadata (including the index) of the layer within this image, and the image
+// metadata still describes the full image. The view must not be read again, and cleaning up the view does not remove
+// any content (see Image.Cleanup on this image instead).
+func (i *Image) WithLayers(indexes ...int) (*Image, error) {
+	if len(indexes) == 0 {
+		return nil, fmt.Errorf("no layers selected")
+	}
+	if len(i.Layers) == 0 {
+		return nil, fmt.Errorf("image has not been read")
+	}
+
+	view := &Image{
+		image:               i.image,
+		Metadata:            i.Metadata,
+		FileCatalog:         NewFileCatalog(),
+		overrideMetadata:    i.overrideMetadata,
+		metadataOnlyChanges: i.metadataOnlyChanges,
+		typeChangeWarnings:  i.typeChangeWarnings,
+		mergeStrategy:       i.mergeStrategy,
+		sbomFetcher:         i.sbomFetcher,
+		signatureFetcher:    i.signatureFetcher,
+		attestationFetcher:  i.attestationFetcher,
+		referrerFetcher:     i.referrerFetcher,
+		blobRangeReader:     i.blobRangeReader,
+		warnings:            append([]Warning(nil), i.warnings...),
+	}
+
+	mapping := make(map[*Layer]*Layer, len(indexes))
+	prefix := true
+	for pos, idx := range indexes {
+		if idx < 0 || idx >= len(i.Layers) {
+			return nil, fmt.Errorf("invalid layer index=%d (image has %d layers)", idx, len(i.Layers))
+		}
+		if pos > 0 && idx <= indexes[pos-1] {
+			return nil, fmt.Errorf("layer indexes must be unique and in build order (given %v)", indexes)
+		}
+		prefix = prefix && idx == pos
+
+		original := i.Layers[idx]
+		layer := *original
+		layer.fileCatalog = &view.FileCatalog
+		layer.warnings = append([]Warning(nil), original.warnings...)
+		// the cached content is owned (and released) by this image
+		layer.cacheBudget = nil
+		layer.cachedTarPath = ""
+		mapping[original] = &layer
+		view.Layers = append(view.Layers, &layer)
+	}
+	for _, layer := range view.Layers {
+		if layer.duplicateOf != nil {
+			layer.duplicateOf = mapping[layer.duplicateOf]
+		}
+	}
+	i.FileCatalog.addSubsetTo(&view.FileCatalog, mapping)
+	view.bindSquashTrees()
+
+	if prefix && i.IsSquashed() {
+		// the squash trees of the lowest layers do not depend on any upper layer
+		return view, nil
+	}
+	for _, layer := range view.Layers {
+		layer.SquashedTree = nil
+	}
+	if err := view.squash(context.Background(), &progress.Manual{Total: int64(len(view.Layers))}); err != nil {
+		return nil, fmt.Errorf("unable to squash layers: %w", err)
+	}
+	return view, nil
+}
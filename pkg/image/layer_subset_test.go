@@ -0,0 +1,87 @@
+package image
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+func TestImage_WithLayers(t *testing.T) {
+	img := newTestImageFromLayers(t, []v1.Layer{
+		newTestTarLayer(t,
+			testTarEntry{name: "etc/os-release", contents: "ID=base"},
+			testTarEntry{name: "etc/hosts", contents: "hosts"},
+		),
+		newTestTarLayer(t,
+			testTarEntry{name: "etc/.wh.hosts"},
+			testTarEntry{name: "usr/bin/app", contents: "app"},
+		),
+		newTestTarLayer(t,
+			testTarEntry{name: "etc/os-release", contents: "ID=final"},
+			testTarEntry{name: "usr/bin/link", linkname: "usr/bin/app", typeflag: tar.TypeLink},
+		),
+	})
+
+	readSquash := func(t *testing.T, view *Image, p file.Path) string {
+		t.Helper()
+		reader, err := view.FileContentsFromSquash(p)
+		require.NoError(t, err)
+		b, err := ioutil.ReadAll(reader)
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	t.Run("base layers", func(t *testing.T) {
+		base, err := img.WithLayers(0)
+		require.NoError(t, err)
+		require.Len(t, base.Layers, 1)
+		assert.Same(t, img.Layers[0].Tree, base.Layers[0].Tree)
+		assert.Same(t, img.Layers[0].SquashedTree, base.SquashedTree())
+
+		assert.Equal(t, "ID=base", readSquash(t, base, "/etc/os-release"))
+		assert.True(t, base.SquashedTree().HasPath("/etc/hosts"))
+		assert.False(t, base.SquashedTree().HasPath("/usr/bin/app"))
+
+		// the catalog only describes the selected layers
+		assert.Len(t, base.FileCatalog.GetByPath("/etc/os-release"), 1)
+		assert.Empty(t, base.FileCatalog.GetByPath("/usr/bin/app"))
+		for _, entry := range base.FileCatalog.GetByPath("/etc/os-release") {
+			assert.Same(t, base.Layers[0], entry.Layer)
+		}
+	})
+
+	t.Run("non-contiguous layers", func(t *testing.T) {
+		view, err := img.WithLayers(0, 2)
+		require.NoError(t, err)
+		require.Len(t, view.Layers, 2)
+		assert.Equal(t, uint(2), view.Layers[1].Metadata.Index)
+
+		// the whiteout from the excluded layer does not apply
+		assert.True(t, view.SquashedTree().HasPath("/etc/hosts"))
+		assert.Equal(t, "ID=final", readSquash(t, view, "/etc/os-release"))
+		assert.Len(t, view.FileCatalog.GetByPath("/etc/os-release"), 2)
+		assert.Empty(t, view.FileCatalog.GetByPath("/usr/bin/app"))
+
+		// the original image is unaffected
+		assert.False(t, img.SquashedTree().HasPath("/etc/hosts"))
+		assert.Len(t, img.FileCatalog.GetByPath("/etc/os-release"), 2)
+		assert.Equal(t, "app", readSquash(t, img, "/usr/bin/link"))
+
+		// cleaning up the view does not remove shared content
+		require.NoError(t, view.Cleanup())
+		assert.Equal(t, "ID=final", readSquash(t, img, "/etc/os-release"))
+	})
+
+	t.Run("invalid indexes", func(t *testing.T) {
+		for _, indexes := range [][]int{nil, {3}, {-1}, {1, 0}, {1, 1}} {
+			_, err := img.WithLayers(indexes...)
+			assert.Error(t, err, "indexes=%v", indexes)
+		}
+	})
+}
@@ -0,0 +1,352 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ulikunitz/xz"
+)
+
+// zstdTestLayer is a minimal v1.Layer backed by an in-memory zstd compressed tar.
+type zstdTestLayer struct {
+	compressed []byte
+}
+
+func (z *zstdTestLayer) Digest() (v1.Hash, error) {
+	h, _, err := v1.SHA256(bytes.NewReader(z.compressed))
+	return h, err
+}
+
+func (z *zstdTestLayer) DiffID() (v1.Hash, error) {
+	panic("not implemented")
+}
+
+func (z *zstdTestLayer) Compressed() (io.ReadCloser, error) {
+	return ioutil.NopCloser(bytes.NewReader(z.compressed)), nil
+}
+
+func (z *zstdTestLayer) Uncompressed() (io.ReadCloser, error) {
+	panic("the GCR lib cannot uncompress zstd layers")
+}
+
+func (z *zstdTestLayer) Size() (int64, error) {
+	return int64(len(z.compressed)), nil
+}
+
+func (z *zstdTestLayer) MediaType() (types.MediaType, error) {
+	return OCILayerZstd, nil
+}
+
+func newZstdTestLayer(t *testing.T, files map[string]string) (*zstdTestLayer, v1.Hash) {
+	t.Helper()
+	tarBuf := &bytes.Buffer{}
+	tw := tar.NewWriter(tarBuf)
+	for name, contents := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Size: int64(len(contents)), Mode: 0644, Typeflag: tar.TypeReg}))
+		_, err := tw.Write([]byte(contents))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+
+	diffID, _, err := v1.SHA256(bytes.NewReader(tarBuf.Bytes()))
+	require.NoError(t, err)
+
+	zstdBuf := &bytes.Buffer{}
+	zw, err := zstd.NewWriter(zstdBuf)
+	require.NoError(t, err)
+	_, err = zw.Write(tarBuf.Bytes())
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	return &zstdTestLayer{compressed: zstdBuf.Bytes()}, diffID
+}
+
+func TestLayer_Read_Zstd(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []ReadOption
+	}{
+		{
+			name: "cached layer content",
+		},
+		{
+			name:    "lazy layer content",
+			options: []ReadOption{WithLazyLayerContent()},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			content, diffID := newZstdTestLayer(t, map[string]string{"etc/hello.txt": "hello zstd!"})
+			imgMetadata := Metadata{
+				Config: v1.ConfigFile{RootFS: v1.RootFS{DiffIDs: []v1.Hash{diffID}}},
+			}
+
+			catalog := NewFileCatalog()
+			l := NewLayer(content)
+			require.NoError(t, l.Read(&catalog, imgMetadata, 0, t.TempDir(), test.options...))
+			assert.Equal(t, OCILayerZstd, l.Metadata.MediaType)
+
+			reader, err := l.FileContents(file.Path("/etc/hello.txt"))
+			require.NoError(t, err)
+			defer reader.Close()
+			contents, err := ioutil.ReadAll(reader)
+			require.NoError(t, err)
+			assert.Equal(t, "hello zstd!", string(contents))
+		})
+	}
+}
+
+// blobTestLayer is a minimal partial.CompressedLayer backed by an in-memory blob with an arbitrary media type (as a
+// registry or OCI layout would provide, where the GCR lib gunzips the blob for the uncompressed content).
+type blobTestLayer struct {
+	blob      []byte
+	mediaType types.MediaType
+}
+
+func (b *blobTestLayer) Digest() (v1.Hash, error) {
+	h, _, err := v1.SHA256(bytes.NewReader(b.blob))
+	return h, err
+}
+
+func (b *blobTestLayer) Compressed() (io.ReadCloser, error) {
+	return ioutil.NopCloser(bytes.NewReader(b.blob)), nil
+}
+
+func (b *blobTestLayer) Size() (int64, error) {
+	return int64(len(b.blob)), nil
+}
+
+func (b *blobTestLayer) MediaType() (types.MediaType, error) {
+	return b.mediaType, nil
+}
+
+func TestLayer_Read_DetectsCompression(t *testing.T) {
+	content := newTestTar(t, testTarEntry{name: "etc/hello.txt", contents: "hello!"})
+	diffID, _, err := v1.SHA256(bytes.NewReader(content))
+	require.NoError(t, err)
+
+	compress := func(t *testing.T, compression file.Compression) []byte {
+		buf := &bytes.Buffer{}
+		var w io.WriteCloser
+		switch compression {
+		case file.CompressionGzip:
+			w = gzip.NewWriter(buf)
+		case file.CompressionZstd:
+			w, err = zstd.NewWriter(buf)
+		case file.CompressionXz:
+			w, err = xz.NewWriter(buf)
+		default:
+			return content
+		}
+		require.NoError(t, err)
+		_, err = w.Write(content)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		return buf.Bytes()
+	}
+
+	tests := []struct {
+		name        string
+		mediaType   types.MediaType
+		compression file.Compression
+		mismatch    bool
+	}{
+		{
+			name:        "gzip layer",
+			mediaType:   types.OCILayer,
+			compression: file.CompressionGzip,
+		},
+		{
+			name:        "uncompressed layer",
+			mediaType:   types.OCIUncompressedLayer,
+			compression: file.CompressionNone,
+		},
+		{
+			name:        "zstd layer",
+			mediaType:   OCILayerZstd,
+			compression: file.CompressionZstd,
+		},
+		{
+			name:        "plain tar declared as gzip",
+			mediaType:   types.DockerLayer,
+			compression: file.CompressionNone,
+			mismatch:    true,
+		},
+		{
+			name:        "zstd declared as gzip",
+			mediaType:   types.OCILayer,
+			compression: file.CompressionZstd,
+			mismatch:    true,
+		},
+		{
+			name:        "xz declared as uncompressed",
+			mediaType:   types.DockerUncompressedLayer,
+			compression: file.CompressionXz,
+			mismatch:    true,
+		},
+		{
+			name:        "gzip declared as zstd",
+			mediaType:   OCILayerZstd,
+			compression: file.CompressionGzip,
+			mismatch:    true,
+		},
+	}
+	for _, test := range tests {
+		for _, lazy := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s lazy=%t", test.name, lazy), func(t *testing.T) {
+				imgMetadata := Metadata{
+					Config: v1.ConfigFile{RootFS: v1.RootFS{DiffIDs: []v1.Hash{diffID}}},
+				}
+				layer, err := partial.CompressedToLayer(&blobTestLayer{
+					blob:      compress(t, test.compression),
+					mediaType: test.mediaType,
+				})
+				require.NoError(t, err)
+
+				var options []ReadOption
+				if lazy {
+					options = append(options, WithLazyLayerContent())
+				}
+
+				catalog := NewFileCatalog()
+				l := NewLayer(layer)
+				require.NoError(t, l.Read(&catalog, imgMetadata, 0, t.TempDir(), options...))
+
+				reader, err := l.FileContents("/etc/hello.txt")
+				require.NoError(t, err)
+				defer reader.Close()
+				contents, err := ioutil.ReadAll(reader)
+				require.NoError(t, err)
+				assert.Equal(t, "hello!", string(contents))
+
+				var mismatches int
+				for _, w := range l.Warnings() {
+					if w.Kind == WarningCompressionMismatch {
+						mismatches++
+					}
+				}
+				if test.mismatch {
+					assert.Equal(t, 1, mismatches)
+				} else {
+					assert.Zero(t, mismatches)
+				}
+
+				strict := NewLayer(layer)
+				catalog = NewFileCatalog()
+				err = strict.Read(&catalog, imgMetadata, 0, t.TempDir(), append(options, WithStrictLayerCompression())...)
+				if test.mismatch {
+					assert.True(t, errors.Is(err, ErrCompressionMismatch), "unexpected error: %v", err)
+				} else {
+					assert.NoError(t, err)
+				}
+			})
+		}
+	}
+}
+
+func TestLayer_Read_ReplacesInvalidCache(t *testing.T) {
+	content, diffID := newZstdTestLayer(t, map[string]string{"etc/hello.txt": "hello zstd!"})
+	imgMetadata := Metadata{
+		Config: v1.ConfigFile{RootFS: v1.RootFS{DiffIDs: []v1.Hash{diffID}}},
+	}
+
+	// simulate a partially written cache left behind by a crashed or concurrent process
+	cacheDir := t.TempDir()
+	cachePath := filepath.Join(cacheDir, layerCacheFileName(diffID.String()))
+	require.NoError(t, os.WriteFile(cachePath, []byte("truncated"), 0600))
+
+	catalog := NewFileCatalog()
+	l := NewLayer(content)
+	require.NoError(t, l.Read(&catalog, imgMetadata, 0, cacheDir))
+	assert.NoError(t, file.VerifyDigest(cachePath, diffID.String()))
+
+	reader, err := l.FileContents("/etc/hello.txt")
+	require.NoError(t, err)
+	defer reader.Close()
+	contents, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello zstd!", string(contents))
+}
+
+func TestLayer_Read_CacheVerification(t *testing.T) {
+	content, diffID := newZstdTestLayer(t, map[string]string{"etc/hello.txt": "hello zstd!"})
+	imgMetadata := Metadata{
+		Config: v1.ConfigFile{RootFS: v1.RootFS{DiffIDs: []v1.Hash{diffID}}},
+	}
+
+	cacheDir := t.TempDir()
+	catalog := NewFileCatalog()
+	l := NewLayer(content)
+	require.NoError(t, l.Read(&catalog, imgMetadata, 0, cacheDir, WithCacheVerification()))
+	assert.NoError(t, file.VerifyDigest(filepath.Join(cacheDir, layerCacheFileName(diffID.String())), diffID.String()))
+}
+
+func TestLayer_ReadWithContext_Canceled(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []ReadOption
+	}{
+		{
+			name: "cached layer content",
+		},
+		{
+			name:    "lazy layer content",
+			options: []ReadOption{WithLazyLayerContent()},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			content, diffID := newZstdTestLayer(t, map[string]string{"etc/hello.txt": "hello zstd!"})
+			imgMetadata := Metadata{
+				Config: v1.ConfigFile{RootFS: v1.RootFS{DiffIDs: []v1.Hash{diffID}}},
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			cacheDir := t.TempDir()
+			catalog := NewFileCatalog()
+			l := NewLayer(content)
+			err := l.ReadWithContext(ctx, &catalog, imgMetadata, 0, cacheDir, test.options...)
+			assert.ErrorIs(t, err, context.Canceled)
+
+			// nothing should be left behind in the cache
+			entries, err := os.ReadDir(cacheDir)
+			require.NoError(t, err)
+			assert.Empty(t, entries)
+		})
+	}
+}
+
+func TestCountingReader(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	reader, complete := trackLayerDownload(ctx, LayerMetadata{}, bytes.NewReader([]byte("some layer content")))
+
+	buf := make([]byte, 4)
+	n, err := reader.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, 4, n)
+	assert.Equal(t, int64(4), reader.(*countingReader).counter.N)
+
+	cancel()
+	_, err = reader.Read(buf)
+	assert.ErrorIs(t, err, context.Canceled)
+	complete(err)
+	assert.ErrorIs(t, reader.(*countingReader).counter.Error(), context.Canceled)
+}
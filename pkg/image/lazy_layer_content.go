@@ -0,0 +1,122 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/anchore/stereoscope/internal/log"
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+var _ io.ReadCloser = (*lazyLayerEntry)(nil)
+
+// lazyLayerContent provides the file contents of a lazily read layer (see WithLazyLayerContent). Every content read
+// streamed from the layer blob fetches (and decompresses) the layer from the start up to the entry, so only the first
+// content read is streamed. Any later read caches the uncompressed layer tar to disk once (as when the layer is not read
+// lazily), from then on all contents are read from the cached tar.
+type lazyLayerContent struct {
+	layer *Layer
+	// tarPath is where the uncompressed layer tar is cached (empty if the layer tar cannot be cached)
+	tarPath string
+
+	lock sync.Mutex
+	// streamed indicates that file contents have already been streamed from the layer blob
+	streamed bool
+	// entries are the entries of the cached layer tar by sequence (nil until the layer tar is cached)
+	entries map[int64]file.TarIndexEntry
+	// err is the error caching the layer tar, after which all contents are streamed from the layer blob
+	err error
+}
+
+func newLazyLayerContent(layer *Layer, tarPath string) *lazyLayerContent {
+	return &lazyLayerContent{
+		layer:   layer,
+		tarPath: tarPath,
+	}
+}
+
+// opener returns the opener for the contents of the tar entry with the given sequence, where the contents are only
+// fetched upon the first read.
+func (c *lazyLayerContent) opener(sequence int64) file.Opener {
+	return func() io.ReadCloser {
+		return &lazyLayerEntry{
+			content:  c,
+			sequence: sequence,
+		}
+	}
+}
+
+// open returns the contents of the tar entry with the given sequence, either streamed from the layer blob or read from
+// the cached layer tar.
+func (c *lazyLayerContent) open(sequence int64) (io.ReadCloser, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if !c.streamed || c.tarPath == "" {
+		c.streamed = true
+		return file.NewLazyTarEntryReadCloser(c.layer.uncompressed, sequence), nil
+	}
+
+	if c.entries == nil && c.err == nil {
+		c.entries, c.err = c.cache()
+		if c.err != nil {
+			log.Warnf("unable to cache lazily read layer=%q, streaming contents instead: %+v", c.layer.Metadata.Digest, c.err)
+			c.layer.warn(WarningInvalidCache, "", "unable to cache lazily read layer=%q: %v", c.layer.Metadata.Digest, c.err)
+		}
+	}
+	if c.err != nil {
+		return file.NewLazyTarEntryReadCloser(c.layer.uncompressed, sequence), nil
+	}
+
+	entry, ok := c.entries[sequence]
+	if !ok {
+		return nil, fmt.Errorf("tar entry sequence=%d not found", sequence)
+	}
+	return entry.Open(), nil
+}
+
+// cache writes the uncompressed layer tar to disk and indexes where the contents of each entry are.
+func (c *lazyLayerContent) cache() (map[int64]file.TarIndexEntry, error) {
+	tarPath, err := c.layer.uncompressedTarCache(context.Background(), c.tarPath, false)
+	if err != nil {
+		return nil, err
+	}
+	index, err := file.NewTarIndex(tarPath, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to index layer cache=%q: %w", tarPath, err)
+	}
+	entries := make(map[int64]file.TarIndexEntry)
+	for _, entry := range index.Entries() {
+		entries[entry.Sequence()] = entry
+	}
+	return entries, nil
+}
+
+// lazyLayerEntry is the contents of a single tar entry within a lazily read layer, opened upon the first read.
+type lazyLayerEntry struct {
+	content  *lazyLayerContent
+	sequence int64
+	reader   io.ReadCloser
+}
+
+func (e *lazyLayerEntry) Read(b []byte) (int, error) {
+	if e.reader == nil {
+		reader, err := e.content.open(e.sequence)
+		if err != nil {
+			return 0, err
+		}
+		e.reader = reader
+	}
+	return e.reader.Read(b)
+}
+
+func (e *lazyLayerEntry) Close() error {
+	if e.reader == nil {
+		return nil
+	}
+	err := e.reader.Close()
+	e.reader = nil
+	return err
+}
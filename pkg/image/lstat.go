@@ -0,0 +1,87 @@
+package image
+
+import (
+	"archive/tar"
+	"os"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree"
+)
+
+// Lstat returns the file reference and metadata presented at the given path of the image squash tree without following
+// a symlink at the path (as with os.Lstat), which is how the squash tree is presented as a filesystem (see FS,
+// BillyFS, AferoFS, and the fuse package). A hardlink is presented as the file it shares content with, and parent
+// directories that are implied by the layer tars (with no entry of their own) are presented as directories without a
+// file reference. ErrFileNotFound is returned if there is no such path (including whiteouts).
+func (i *Image) Lstat(p file.Path) (*file.Reference, file.Metadata, error) {
+	tree, err := i.imageSquashTree()
+	if err != nil {
+		return nil, file.Metadata{}, err
+	}
+	return statSquashPath(tree, &i.FileCatalog, p, false)
+}
+
+// statSquashPath returns the file reference and metadata presented at the given path of the squash tree (see
+// Image.Lstat), optionally following symlinks. Links that cannot be resolved are described as the link itself, unless
+// following links, where ErrDeadLink is returned instead.
+func statSquashPath(tree *filetree.FileTree, catalog *FileCatalog, p file.Path, follow bool) (*file.Reference, file.Metadata, error) {
+	if p.IsWhiteout() {
+		return nil, file.Metadata{}, ErrFileNotFound
+	}
+
+	var options []filetree.LinkResolutionOption
+	if follow {
+		// hardlinks are bound to the content of the file they were linked to (see fetchFileContentsByPath)
+		options = append(options, filetree.FollowBasenameLinks, filetree.DoNotFollowHardLinks)
+	}
+	exists, ref, err := tree.File(p, options...)
+	if err != nil {
+		return nil, file.Metadata{}, err
+	}
+	if !exists {
+		return nil, file.Metadata{}, ErrFileNotFound
+	}
+	if ref == nil {
+		// parent directories that are implied by the layer tars have no entry of their own
+		return nil, file.Metadata{
+			Path:     string(p),
+			TypeFlag: tar.TypeDir,
+			IsDir:    true,
+			Mode:     os.ModeDir | 0755,
+		}, nil
+	}
+
+	entry, err := catalog.Get(*ref)
+	if err != nil {
+		return nil, file.Metadata{}, err
+	}
+	switch file.Type(entry.Metadata.TypeFlag) {
+	case file.TypeHardLink:
+		target := entry.HardlinkTarget
+		if target == nil {
+			// the hardlink could not be bound to any content, fallback to resolving the link path
+			_, target, err = tree.File(p, filetree.FollowBasenameLinks)
+			if err != nil {
+				return nil, file.Metadata{}, err
+			}
+			if target == nil || target.ID() == ref.ID() {
+				if follow {
+					return nil, file.Metadata{}, ErrDeadLink
+				}
+				return ref, entry.Metadata, nil
+			}
+		}
+		// the link is indistinguishable from the file it shares content with
+		targetEntry, err := catalog.Get(*target)
+		if err != nil {
+			return nil, file.Metadata{}, err
+		}
+		return target, targetEntry.Metadata, nil
+	case file.TypeSymlink:
+		if follow {
+			// the link could not be resolved
+			return nil, file.Metadata{}, ErrDeadLink
+		}
+	}
+	return ref, entry.Metadata, nil
+}
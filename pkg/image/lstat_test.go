@@ -0,0 +1,50 @@
+package image
+
+import (
+	"archive/tar"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+func TestImage_Lstat(t *testing.T) {
+	img := newTestImageFromLayers(t, []v1.Layer{
+		newTestTarLayer(t,
+			testTarEntry{name: "bin/busybox", contents: "busybox", mode: 0755},
+			testTarEntry{name: "bin/sh", linkname: "bin/busybox", typeflag: tar.TypeLink},
+			testTarEntry{name: "bin/ash", linkname: "/bin/busybox", typeflag: tar.TypeSymlink},
+			testTarEntry{name: "etc/removed", contents: "removed"},
+		),
+		newTestTarLayer(t,
+			testTarEntry{name: "etc/.wh.removed"},
+		),
+	})
+
+	// hardlinks are presented as the file they share content with
+	busybox, busyboxMetadata, err := img.Lstat("/bin/busybox")
+	require.NoError(t, err)
+	ref, metadata, err := img.Lstat("/bin/sh")
+	require.NoError(t, err)
+	assert.Equal(t, busybox.ID(), ref.ID())
+	assert.Equal(t, busyboxMetadata, metadata)
+
+	// symlinks are not followed
+	_, metadata, err = img.Lstat("/bin/ash")
+	require.NoError(t, err)
+	assert.Equal(t, file.TypeSymlink, file.Type(metadata.TypeFlag))
+
+	// implied directories have no entry of their own
+	ref, metadata, err = img.Lstat("/bin")
+	require.NoError(t, err)
+	assert.Nil(t, ref)
+	assert.True(t, metadata.IsDir)
+
+	for _, p := range []file.Path{"/etc/removed", "/etc/.wh.removed", "/missing"} {
+		_, _, err = img.Lstat(p)
+		assert.ErrorIs(t, err, ErrFileNotFound, p)
+	}
+}
@@ -0,0 +1,124 @@
+package image
+
+import (
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree"
+	"github.com/anchore/stereoscope/pkg/filetree/filenode"
+)
+
+// MergeStrategy selects the union semantics used when squashing layers (how deletions within a layer are represented),
+// which should match the conventions of the storage driver that produced the layer tars.
+type MergeStrategy string
+
+const (
+	// AUFSMergeStrategy interprets ".wh.<name>" whiteout files and ".wh..wh..opq" opaque directory markers, as
+	// described by the OCI image spec and used by all docker and OCI image tars. This is the default.
+	AUFSMergeStrategy MergeStrategy = "aufs"
+	// OverlayMergeStrategy interprets character devices with the device number 0/0 as whiteouts and directories with the
+	// "trusted.overlay.opaque" (or "user.overlay.opaque") xattr set to "y" as opaque directories, as found within an
+	// overlayfs upper directory (e.g. layers archived directly from overlay2 storage).
+	OverlayMergeStrategy MergeStrategy = "overlayfs"
+	// VFSMergeStrategy uses plain copy-up semantics: upper files replace lower files at the same path and nothing is
+	// ever deleted (as with the vfs storage driver, where every layer is a full copy of the filesystem).
+	VFSMergeStrategy MergeStrategy = "vfs"
+)
+
+// overlayOpaqueXattrs are the extended attributes that mark an overlayfs directory as opaque.
+var overlayOpaqueXattrs = []string{"trusted.overlay.opaque", "user.overlay.opaque"}
+
+// MergeStrategies returns all supported merge strategies.
+func MergeStrategies() []MergeStrategy {
+	return []MergeStrategy{AUFSMergeStrategy, OverlayMergeStrategy, VFSMergeStrategy}
+}
+
+// ParseMergeStrategy returns the merge strategy with the given name (e.g. "aufs", "overlayfs", or "vfs").
+func ParseMergeStrategy(name string) (MergeStrategy, error) {
+	for _, s := range MergeStrategies() {
+		if string(s) == name {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("unknown merge strategy %q (supported: %v)", name, MergeStrategies())
+}
+
+// filetreeStrategy returns the filetree merge strategy implementing these semantics, consulting the given catalog for
+// the file metadata of each layer tree node as needed.
+func (s MergeStrategy) filetreeStrategy(catalog *FileCatalog) filetree.MergeStrategy {
+	switch s {
+	case OverlayMergeStrategy:
+		return overlayMergeStrategy{catalog: catalog}
+	case VFSMergeStrategy:
+		return filetree.CopyUpMergeStrategy()
+	default:
+		return filetree.AUFSMergeStrategy()
+	}
+}
+
+// chainIDs salts the given layer chain IDs with this strategy (for anything but the default), so cached squash trees
+// are never shared between squashes with different semantics.
+func (s MergeStrategy) chainIDs(ids []string) []string {
+	if s == "" || s == AUFSMergeStrategy {
+		return ids
+	}
+	for idx, id := range ids {
+		if id != "" {
+			ids[idx] = fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(string(s)+" "+id)))
+		}
+	}
+	return ids
+}
+
+// isOverlayWhiteout indicates if the given entry is an overlayfs whiteout (a character device with device number 0/0).
+func isOverlayWhiteout(metadata file.Metadata) bool {
+	return file.Type(metadata.TypeFlag) == file.TypeCharacterDevice && metadata.Devmajor == 0 && metadata.Devminor == 0
+}
+
+// isOverlayOpaque indicates if the given entry is an overlayfs opaque directory.
+func isOverlayOpaque(metadata file.Metadata) bool {
+	if file.Type(metadata.TypeFlag) != file.TypeDir {
+		return false
+	}
+	for _, key := range overlayOpaqueXattrs {
+		if string(metadata.Xattrs[key]) == "y" {
+			return true
+		}
+	}
+	return false
+}
+
+// overlayMergeStrategy implements OverlayMergeStrategy, which relies on file metadata that is only available within
+// the file catalog (the tree nodes only describe paths and basic file types).
+type overlayMergeStrategy struct {
+	catalog *FileCatalog
+}
+
+func (s overlayMergeStrategy) metadata(n *filenode.FileNode) (file.Metadata, bool) {
+	if n.Reference == nil || s.catalog == nil {
+		return file.Metadata{}, false
+	}
+	entry, err := s.catalog.Get(*n.Reference)
+	if err != nil {
+		return file.Metadata{}, false
+	}
+	return entry.Metadata, true
+}
+
+func (s overlayMergeStrategy) Whiteout(_ *filetree.FileTree, n *filenode.FileNode) (file.Path, bool) {
+	metadata, ok := s.metadata(n)
+	if !ok || !isOverlayWhiteout(metadata) {
+		return "", false
+	}
+	return n.RealPath, true
+}
+
+func (s overlayMergeStrategy) Opaque(_ *filetree.FileTree, n *filenode.FileNode) bool {
+	metadata, ok := s.metadata(n)
+	return ok && isOverlayOpaque(metadata)
+}
+
+func (s overlayMergeStrategy) Marker(*filetree.FileTree, *filenode.FileNode) bool {
+	return false
+}
@@ -0,0 +1,99 @@
+package image
+
+import (
+	"archive/tar"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+func TestImage_Read_MergeStrategy(t *testing.T) {
+	v1Image, err := mutate.AppendLayers(empty.Image,
+		newTestTarLayer(t,
+			testTarEntry{name: "etc/removed", contents: "removed"},
+			testTarEntry{name: "etc/kept", contents: "kept"},
+			testTarEntry{name: "opt/app/old", contents: "old"},
+			testTarEntry{name: "var/lib/old", contents: "old"},
+		),
+		newTestTarLayer(t,
+			// overlayfs conventions
+			testTarEntry{name: "etc/removed", typeflag: tar.TypeChar},
+			testTarEntry{name: "opt/app/", typeflag: tar.TypeDir, mode: 0755, xattrs: map[string]string{"trusted.overlay.opaque": "y"}},
+			testTarEntry{name: "opt/app/new", contents: "new"},
+			testTarEntry{name: "dev/null", typeflag: tar.TypeChar, devmajor: 1, devminor: 3},
+			// aufs conventions
+			testTarEntry{name: "etc/.wh.kept"},
+			testTarEntry{name: "var/lib/.wh..wh..opq"},
+		),
+	)
+	require.NoError(t, err)
+
+	tests := []struct {
+		strategy       MergeStrategy
+		present        []file.Path
+		absent         []file.Path
+		wantWhiteouts  []file.Path
+		wantOpaqueDirs []file.Path
+	}{
+		{
+			strategy:       AUFSMergeStrategy,
+			present:        []file.Path{"/etc/removed", "/opt/app/old", "/opt/app/new", "/dev/null"},
+			absent:         []file.Path{"/etc/kept", "/etc/.wh.kept", "/var/lib/old", "/var/lib/.wh..wh..opq"},
+			wantWhiteouts:  []file.Path{"/etc/kept"},
+			wantOpaqueDirs: []file.Path{"/var/lib"},
+		},
+		{
+			strategy:       OverlayMergeStrategy,
+			present:        []file.Path{"/etc/kept", "/etc/.wh.kept", "/opt/app/new", "/dev/null", "/var/lib/old", "/var/lib/.wh..wh..opq"},
+			absent:         []file.Path{"/etc/removed", "/opt/app/old"},
+			wantWhiteouts:  []file.Path{"/etc/removed"},
+			wantOpaqueDirs: []file.Path{"/opt/app"},
+		},
+		{
+			strategy: VFSMergeStrategy,
+			present:  []file.Path{"/etc/removed", "/etc/kept", "/etc/.wh.kept", "/opt/app/old", "/opt/app/new", "/var/lib/old", "/var/lib/.wh..wh..opq"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(string(test.strategy), func(t *testing.T) {
+			img := NewImage(v1Image, t.TempDir())
+			require.NoError(t, img.Read(WithMergeStrategy(test.strategy)))
+			squash := img.SquashedTree()
+			for _, p := range test.present {
+				assert.True(t, squash.HasPath(p), "expected %q", p)
+			}
+			for _, p := range test.absent {
+				assert.False(t, squash.HasPath(p), "unexpected %q", p)
+			}
+			assert.Equal(t, test.wantWhiteouts, img.Layers[1].Whiteouts())
+			assert.Equal(t, test.wantOpaqueDirs, img.Layers[1].OpaqueDirs())
+		})
+	}
+}
+
+func TestMergeStrategy_chainIDs(t *testing.T) {
+	ids := []string{"sha256:a", "sha256:b", ""}
+	assert.Equal(t, ids, AUFSMergeStrategy.chainIDs(append([]string(nil), ids...)))
+	assert.Equal(t, ids, MergeStrategy("").chainIDs(append([]string(nil), ids...)))
+
+	overlay := OverlayMergeStrategy.chainIDs(append([]string(nil), ids...))
+	vfs := VFSMergeStrategy.chainIDs(append([]string(nil), ids...))
+	assert.NotEqual(t, ids[0], overlay[0])
+	assert.NotEqual(t, overlay[0], vfs[0])
+	assert.Empty(t, overlay[2])
+}
+
+func TestParseMergeStrategy(t *testing.T) {
+	for _, s := range MergeStrategies() {
+		actual, err := ParseMergeStrategy(string(s))
+		require.NoError(t, err)
+		assert.Equal(t, s, actual)
+	}
+	_, err := ParseMergeStrategy("btrfs")
+	assert.Error(t, err)
+}
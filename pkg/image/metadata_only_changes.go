@@ -0,0 +1,32 @@
+package image
+
+import (
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree"
+)
+
+// attributeMetadataOnlyChanges finds all regular files within the given layer that replace a regular file from the
+// lower squash tree with identical content, attributing the content of each to the layer that introduced it.
+func (i *Image) attributeMetadataOnlyChanges(layer *Layer, lowerSquashTree *filetree.FileTree) {
+	for _, upperRef := range layer.Tree.AllFiles(file.TypeReg) {
+		upper, err := i.FileCatalog.Get(upperRef)
+		if err != nil || upper.Metadata.Digest == "" {
+			continue
+		}
+
+		_, lowerRef, err := lowerSquashTree.File(upperRef.RealPath)
+		if err != nil || lowerRef == nil || lowerRef.ID() == upperRef.ID() {
+			continue
+		}
+		lower, err := i.FileCatalog.Get(*lowerRef)
+		if err != nil || file.Type(lower.Metadata.TypeFlag) != file.TypeReg {
+			continue
+		}
+
+		if lower.Metadata.Digest != upper.Metadata.Digest {
+			continue
+		}
+		// the lower file may itself be a metadata-only change, so always refer to the layer that added the content
+		i.FileCatalog.setContentOrigin(upperRef, lower.ContentLayer())
+	}
+}
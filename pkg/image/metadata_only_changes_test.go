@@ -0,0 +1,75 @@
+package image
+
+import (
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImage_MetadataOnlyChangeDetection(t *testing.T) {
+	v1Image, err := mutate.AppendLayers(empty.Image,
+		newTestTarLayer(t,
+			testTarEntry{name: "app/run", contents: "binary"},
+			testTarEntry{name: "app/config", contents: "original"},
+		),
+		newTestTarLayer(t,
+			// chmod only
+			testTarEntry{name: "app/run", contents: "binary", mode: 0755},
+			testTarEntry{name: "app/config", contents: "changed"},
+		),
+		newTestTarLayer(t,
+			// chown only, on top of a metadata-only change
+			testTarEntry{name: "app/run", contents: "binary", mode: 0700},
+		),
+	)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		options        []ReadOption
+		runLayer       int
+		runContentFrom int
+	}{
+		{
+			name:           "disabled by default",
+			runLayer:       2,
+			runContentFrom: 2,
+		},
+		{
+			name:           "content attributed to original layer",
+			options:        []ReadOption{WithMetadataOnlyChangeDetection()},
+			runLayer:       2,
+			runContentFrom: 0,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			img := NewImage(v1Image, t.TempDir())
+			require.NoError(t, img.Read(test.options...))
+
+			entry := squashEntry(t, img, "/app/run")
+			assert.Equal(t, img.Layers[test.runLayer], entry.Layer)
+			assert.Equal(t, img.Layers[test.runContentFrom], entry.ContentLayer())
+			// the upper metadata is always kept
+			assert.Equal(t, int64(0700), int64(entry.Metadata.Mode.Perm()))
+
+			// content changes are never attributed to a lower layer
+			entry = squashEntry(t, img, "/app/config")
+			assert.Equal(t, img.Layers[1], entry.ContentLayer())
+		})
+	}
+}
+
+func squashEntry(t *testing.T, img *Image, p file.Path) FileCatalogEntry {
+	t.Helper()
+	_, ref, err := img.SquashedTree().File(p)
+	require.NoError(t, err)
+	require.NotNil(t, ref)
+	entry, err := img.FileCatalog.Get(*ref)
+	require.NoError(t, err)
+	return entry
+}
@@ -0,0 +1,69 @@
+package image
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+func TestImage_MIMETypeDetector(t *testing.T) {
+	elf := testTarEntry{name: "bin/app", contents: "\x7fELF" + string(bytes.Repeat([]byte{0}, 60))}
+	text := testTarEntry{name: "etc/motd", contents: "hello world"}
+
+	var sniffed []string
+	detector := file.MIMETypeDetectorFunc(func(prefix []byte) string {
+		sniffed = append(sniffed, string(prefix))
+		if bytes.HasPrefix(prefix, []byte("\x7fELF")) {
+			return "application/x-custom-elf"
+		}
+		return "text/x-custom"
+	})
+
+	tests := []struct {
+		name     string
+		option   ReadOption
+		expected map[file.Path]string
+	}{
+		{
+			name:     "default detector",
+			expected: map[file.Path]string{"/bin/app": "application/x-elf", "/etc/motd": "text/plain"},
+		},
+		{
+			name:     "custom detector",
+			option:   WithMIMETypeDetector(detector, 4),
+			expected: map[file.Path]string{"/bin/app": "application/x-custom-elf", "/etc/motd": "text/x-custom"},
+		},
+		{
+			name:     "detection disabled",
+			option:   WithMIMETypeDetector(nil, 0),
+			expected: map[file.Path]string{"/bin/app": "", "/etc/motd": ""},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sniffed = nil
+			v1Image, err := mutate.AppendLayers(empty.Image, newTestTarLayer(t, elf, text))
+			require.NoError(t, err)
+			img := NewImage(v1Image, t.TempDir())
+			require.NoError(t, img.Read(test.option))
+
+			for p, expected := range test.expected {
+				_, ref, err := img.SquashedTree().File(p)
+				require.NoError(t, err)
+				require.NotNil(t, ref)
+				entry, err := img.FileCatalog.Get(*ref)
+				require.NoError(t, err)
+				assert.Equal(t, expected, entry.Metadata.MIMEType, p)
+			}
+			for _, prefix := range sniffed {
+				assert.LessOrEqual(t, len(prefix), 4, "detector should only be given the sniff size")
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package objectstore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/anchore/stereoscope/pkg/image/archive"
+)
+
+// Client fetches objects from a cloud object store (e.g. S3, GCS, or Azure blob storage). No implementations are
+// provided by this library, which keeps the (substantial) object store SDK dependencies out of it: callers bring their
+// own client, typically wrapping the SDK of the object store and its standard credential chain, and register it for a
+// URL scheme with stereoscope.WithObjectStore.
+type Client interface {
+	// Open returns a reader for the content of the object with the given key within the given bucket (or container).
+	Open(ctx context.Context, bucket, key string) (io.ReadCloser, error)
+}
+
+// ClientFunc adapts a function to the Client interface.
+type ClientFunc func(ctx context.Context, bucket, key string) (io.ReadCloser, error)
+
+// Open implements Client.
+func (f ClientFunc) Open(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	return f(ctx, bucket, key)
+}
+
+// ArchiveImageProvider is an image.Provider for a docker archive, OCI archive, or Singularity image stored within an
+// object store (e.g. "s3://bucket/path/to/image.tar"), fetched with the Client registered for the URL scheme. Since
+// archives require random access to be read, the object is not read directly from the object store: it is first
+// downloaded in full into the temp dir of the provider and then provided based on the archive format (see
+// archive.ImageProvider).
+type ArchiveImageProvider struct {
+	url       string
+	tmpDirGen *file.TempDirGenerator
+	clients   map[string]Client
+	platform  *image.Platform
+}
+
+// NewProviderFromURL creates a new provider instance for the object at the given URL, where the URL scheme selects
+// the client used to fetch the object (e.g. "s3", "gs", or "azblob", see image.ObjectStoreSchemes) and the URL host is
+// the bucket. Providing an image fails for any scheme without a client.
+func NewProviderFromURL(objectURL string, tmpDirGen *file.TempDirGenerator, clients map[string]Client, platform *image.Platform) *ArchiveImageProvider {
+	return &ArchiveImageProvider{
+		url:       objectURL,
+		tmpDirGen: tmpDirGen,
+		clients:   clients,
+		platform:  platform,
+	}
+}
+
+// Provide an image object that represents the image archive at the configured object URL.
+func (p *ArchiveImageProvider) Provide(ctx context.Context, metadata ...image.AdditionalMetadata) (*image.Image, error) {
+	u, err := url.Parse(p.url)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse object URL=%q: %w", p.url, err)
+	}
+	bucket, key := u.Host, strings.TrimPrefix(u.Path, "/")
+	if bucket == "" || key == "" {
+		return nil, fmt.Errorf("object URL=%q must include a bucket and key (e.g. %s://bucket/path/to/image.tar)", p.url, u.Scheme)
+	}
+
+	client, ok := p.clients[u.Scheme]
+	if !ok || client == nil {
+		return nil, fmt.Errorf("no object store client configured for scheme=%q (no clients are built in, one must be provided with stereoscope.WithObjectStore)", u.Scheme)
+	}
+
+	tempDir, err := p.tmpDirGen.NewDirectory("object-store-archive")
+	if err != nil {
+		return nil, err
+	}
+
+	archivePath := filepath.Join(tempDir, path.Base(key))
+	if err := fetch(ctx, client, bucket, key, archivePath); err != nil {
+		return nil, fmt.Errorf("unable to fetch object URL=%q: %w", p.url, err)
+	}
+
+	img, err := archive.NewProviderFromPath(archivePath, p.tmpDirGen, p.platform).Provide(ctx, metadata...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to provide image from object URL=%q: %w", p.url, err)
+	}
+	return img, nil
+}
+
+func fetch(ctx context.Context, client Client, bucket, key, dest string) error {
+	reader, err := client.Open(ctx, bucket, key)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	fh, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	if _, err := io.Copy(fh, contextReader{ctx: ctx, reader: reader}); err != nil {
+		return err
+	}
+	return fh.Close()
+}
+
+// contextReader stops reading once the context is done (not all clients honor the context after opening the object).
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.reader.Read(p)
+}
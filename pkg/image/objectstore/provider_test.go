@@ -0,0 +1,93 @@
+package objectstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+)
+
+func TestArchiveImageProvider_Provide(t *testing.T) {
+	img, err := random.Image(1024, 2)
+	require.NoError(t, err)
+	tag, err := name.NewTag("example.com/repo:latest")
+	require.NoError(t, err)
+	archive := &bytes.Buffer{}
+	require.NoError(t, tarball.Write(tag, img, archive))
+	content := archive.Bytes()
+
+	expectedID, err := img.ConfigName()
+	require.NoError(t, err)
+
+	var opened []string
+	client := ClientFunc(func(_ context.Context, bucket, key string) (io.ReadCloser, error) {
+		opened = append(opened, bucket+"/"+key)
+		if key != "images/app.tar" {
+			return nil, errors.New("no such key")
+		}
+		return ioutil.NopCloser(bytes.NewReader(content)), nil
+	})
+	clients := map[string]Client{"s3": client}
+
+	tests := []struct {
+		name    string
+		url     string
+		clients map[string]Client
+		wantErr string
+	}{
+		{name: "docker archive", url: "s3://bucket/images/app.tar", clients: clients},
+		{name: "missing object", url: "s3://bucket/images/missing.tar", clients: clients, wantErr: "no such key"},
+		{name: "no client for scheme", url: "gs://bucket/images/app.tar", clients: clients, wantErr: `no object store client configured for scheme="gs"`},
+		{name: "no key", url: "s3://bucket/", clients: clients, wantErr: "must include a bucket and key"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			generator := file.NewTempDirGenerator("stereoscope-object-store-test")
+			defer generator.Cleanup()
+
+			provided, err := NewProviderFromURL(test.url, generator, test.clients, nil).Provide(context.Background())
+			if test.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.NoError(t, provided.Read())
+			assert.Equal(t, expectedID.String(), provided.Metadata.ID)
+		})
+	}
+	assert.Equal(t, []string{"bucket/images/app.tar", "bucket/images/missing.tar"}, opened)
+}
+
+func TestArchiveImageProvider_Provide_PlatformUnsupported(t *testing.T) {
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	tag, err := name.NewTag("example.com/repo:latest")
+	require.NoError(t, err)
+	archive := &bytes.Buffer{}
+	require.NoError(t, tarball.Write(tag, img, archive))
+
+	client := ClientFunc(func(context.Context, string, string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(archive.Bytes())), nil
+	})
+
+	generator := file.NewTempDirGenerator("stereoscope-object-store-test")
+	defer generator.Cleanup()
+
+	platform, err := image.NewPlatform("linux/arm64")
+	require.NoError(t, err)
+	_, err = NewProviderFromURL("azblob://container/image.tar", generator, map[string]Client{"azblob": client}, platform).Provide(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "docker archives do not support selecting platform")
+}
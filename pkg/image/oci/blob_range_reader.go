@@ -0,0 +1,87 @@
+package oci
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/google/go-containerregistry/pkg/name"
+	containerregistryV1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+// newRegistryBlobRangeReader returns an image.BlobRangeReader that fetches parts of the blobs within the repository of
+// the given reference with HTTP range requests. The authenticated transport is prepared by the first read and shared
+// by all following reads.
+func newRegistryBlobRangeReader(ref name.Reference, registryOptions image.RegistryOptions) image.BlobRangeReader {
+	var (
+		once    sync.Once
+		client  *http.Client
+		initErr error
+	)
+	return func(ctx context.Context, digest containerregistryV1.Hash, offset, length int64) (io.ReadCloser, error) {
+		once.Do(func() {
+			client, initErr = newRegistryClient(ctx, ref, registryOptions)
+		})
+		if initErr != nil {
+			return nil, initErr
+		}
+		return fetchBlobRange(ctx, client, ref.Context(), digest, offset, length)
+	}
+}
+
+// newRegistryClient returns an HTTP client authorized to pull from the repository of the given reference.
+func newRegistryClient(ctx context.Context, ref name.Reference, registryOptions image.RegistryOptions) (*http.Client, error) {
+	authenticator, t, err := prepareTransport(ctx, ref, registryOptions)
+	if err != nil {
+		return nil, err
+	}
+	repo := ref.Context()
+	t, err = transport.NewWithContext(ctx, repo.Registry, authenticator, t, []string{repo.Scope(transport.PullScope)})
+	if err != nil {
+		return nil, fmt.Errorf("unable to authorize with registry=%q: %w", repo.RegistryStr(), err)
+	}
+	return &http.Client{Transport: t}, nil
+}
+
+func fetchBlobRange(ctx context.Context, client *http.Client, repo name.Repository, digest containerregistryV1.Hash, offset, length int64) (io.ReadCloser, error) {
+	u := url.URL{
+		Scheme: repo.Registry.Scheme(),
+		Host:   repo.RegistryStr(),
+		Path:   fmt.Sprintf("/v2/%s/blobs/%s", repo.RepositoryStr(), digest),
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		return readCloser{Reader: io.LimitReader(resp.Body, length), Closer: resp.Body}, nil
+	case http.StatusOK:
+		// the registry does not support range requests, skip to the requested range of the whole blob
+		if _, err := io.CopyN(ioutil.Discard, resp.Body, offset); err != nil {
+			_ = resp.Body.Close()
+			return nil, fmt.Errorf("unable to read blob=%q: %w", digest, err)
+		}
+		return readCloser{Reader: io.LimitReader(resp.Body, length), Closer: resp.Body}, nil
+	default:
+		defer resp.Body.Close()
+		return nil, transport.CheckError(resp, http.StatusPartialContent, http.StatusOK)
+	}
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
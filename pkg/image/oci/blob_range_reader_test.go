@@ -0,0 +1,103 @@
+package oci
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anchore/stereoscope/pkg/image"
+)
+
+// rangeHandler serves range requests from the complete responses of the given handler.
+func rangeHandler(t *testing.T, handler http.Handler, ranges *int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested := r.Header.Get("Range")
+		if requested == "" {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		*ranges++
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, r)
+		var start, end int
+		_, err := fmt.Sscanf(requested, "bytes=%d-%d", &start, &end)
+		require.NoError(t, err)
+		body := recorder.Body.Bytes()
+		if start >= len(body) || end >= len(body) {
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(body)))
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write(body[start : end+1])
+	})
+}
+
+func Test_RegistryBlobRangeReader(t *testing.T) {
+	tests := []struct {
+		name          string
+		rangeRequests bool
+	}{
+		{
+			name:          "registry with range requests",
+			rangeRequests: true,
+		},
+		{
+			name:          "registry without range requests",
+			rangeRequests: false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var ranges int
+			var handler = registry.New()
+			if test.rangeRequests {
+				handler = rangeHandler(t, handler, &ranges)
+			}
+			server := httptest.NewServer(handler)
+			t.Cleanup(server.Close)
+			u, err := url.Parse(server.URL)
+			require.NoError(t, err)
+
+			ref, err := name.ParseReference(u.Host + "/anchore/example:latest")
+			require.NoError(t, err)
+			img, err := random.Image(1024, 1)
+			require.NoError(t, err)
+			require.NoError(t, remote.Write(ref, img))
+
+			layers, err := img.Layers()
+			require.NoError(t, err)
+			digest, err := layers[0].Digest()
+			require.NoError(t, err)
+			compressed, err := layers[0].Compressed()
+			require.NoError(t, err)
+			blob, err := ioutil.ReadAll(compressed)
+			require.NoError(t, err)
+
+			read := newRegistryBlobRangeReader(ref, image.RegistryOptions{})
+			reader, err := read(context.Background(), digest, 10, 20)
+			require.NoError(t, err)
+			actual, err := ioutil.ReadAll(reader)
+			require.NoError(t, err)
+			require.NoError(t, reader.Close())
+			assert.Equal(t, blob[10:30], actual)
+			if test.rangeRequests {
+				assert.Equal(t, 1, ranges)
+			}
+
+			_, err = read(context.Background(), digest, int64(len(blob))+10, 20)
+			require.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package oci
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anchore/stereoscope/pkg/image"
+)
+
+// tokenRegistry fronts a registry with a token server that only accepts the current password, where all issued
+// tokens are revoked when the password is rotated (mimicking short-lived registry credentials).
+type tokenRegistry struct {
+	lock     sync.Mutex
+	handler  http.Handler
+	realm    string
+	password string
+	token    string
+	issued   int
+}
+
+func (r *tokenRegistry) rotate(password string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.password = password
+	r.token = ""
+}
+
+func (r *tokenRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.lock.Lock()
+	if req.URL.Path == "/token" {
+		defer r.lock.Unlock()
+		if _, password, ok := req.BasicAuth(); !ok || password != r.password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		r.issued++
+		r.token = fmt.Sprintf("token-%d", r.issued)
+		_, _ = fmt.Fprintf(w, `{"token": %q}`, r.token)
+		return
+	}
+	authorized := r.token != "" && req.Header.Get("Authorization") == "Bearer "+r.token
+	r.lock.Unlock()
+
+	if !authorized {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm=%q,service="test"`, r.realm))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	r.handler.ServeHTTP(w, req)
+}
+
+func TestCredentialProvider_RefreshesRejectedCredentials(t *testing.T) {
+	backend := registry.New()
+	pushServer := httptest.NewServer(backend)
+	defer pushServer.Close()
+
+	tokens := &tokenRegistry{handler: backend, password: "first"}
+	server := httptest.NewServer(tokens)
+	defer server.Close()
+	tokens.realm = server.URL + "/token"
+
+	pushURL, err := url.Parse(pushServer.URL)
+	require.NoError(t, err)
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	img, err := random.Image(64, 1)
+	require.NoError(t, err)
+	pushRef, err := name.ParseReference(pushURL.Host + "/repo:latest")
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(pushRef, img))
+
+	ref, err := name.ParseReference(serverURL.Host + "/repo:latest")
+	require.NoError(t, err)
+
+	var providerCalls int
+	registryOptions := image.RegistryOptions{
+		Credentials: []image.RegistryCredentials{
+			{Authority: serverURL.Host, Username: "user", Password: "first"},
+		},
+		CredentialProvider: func(_ context.Context, registry string) (image.RegistryCredentials, error) {
+			providerCalls++
+			assert.Equal(t, serverURL.Host, registry)
+			return image.RegistryCredentials{Username: "user", Password: "second"}, nil
+		},
+	}
+
+	remoteOptions, err := prepareRemoteOptions(context.Background(), ref, registryOptions, nil)
+	require.NoError(t, err)
+	fetched, err := remote.Image(ref, remoteOptions...)
+	require.NoError(t, err)
+	assert.Equal(t, 0, providerCalls)
+
+	// the credentials expire in the middle of the pull
+	tokens.rotate("second")
+
+	layers, err := fetched.Layers()
+	require.NoError(t, err)
+	require.Len(t, layers, 1)
+	reader, err := layers[0].Compressed()
+	require.NoError(t, err)
+	_, err = ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	assert.Equal(t, 1, providerCalls)
+}
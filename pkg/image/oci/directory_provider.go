@@ -6,20 +6,30 @@ import (
 
 	"github.com/anchore/stereoscope/pkg/file"
 	"github.com/anchore/stereoscope/pkg/image"
+	containerregistryV1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/types"
 )
 
 // DirectoryImageProvider is an image.Provider for an OCI image (V1) for an existing tar on disk (from a buildah push <img> oci:<img> command).
 type DirectoryImageProvider struct {
 	path      string
 	tmpDirGen *file.TempDirGenerator
+	platform  *image.Platform
 }
 
 // NewProviderFromPath creates a new provider instance for the specific image already at the given path.
 func NewProviderFromPath(path string, tmpDirGen *file.TempDirGenerator) *DirectoryImageProvider {
+	return NewProviderFromPathWithPlatform(path, tmpDirGen, nil)
+}
+
+// NewProviderFromPathWithPlatform creates a new provider instance for the specific image already at the given path. If a
+// platform is given then the matching image is selected from a multi-platform index.
+func NewProviderFromPathWithPlatform(path string, tmpDirGen *file.TempDirGenerator, platform *image.Platform) *DirectoryImageProvider {
 	return &DirectoryImageProvider{
 		path:      path,
 		tmpDirGen: tmpDirGen,
+		platform:  platform,
 	}
 }
 
@@ -35,17 +45,11 @@ func (p *DirectoryImageProvider) Provide(_ context.Context, userMetadata ...imag
 		return nil, fmt.Errorf("unable to parse OCI directory index: %w", err)
 	}
 
-	indexManifest, err := index.IndexManifest()
+	manifest, err := selectManifest(index, p.platform)
 	if err != nil {
-		return nil, fmt.Errorf("unable to parse OCI directory indexManifest: %w", err)
-	}
-
-	// for now, lets only support one image indexManifest (it is not clear how to handle multiple manifests)
-	if len(indexManifest.Manifests) != 1 {
-		return nil, fmt.Errorf("unexpected number of OCI directory manifests (found %d)", len(indexManifest.Manifests))
+		return nil, err
 	}
 
-	manifest := indexManifest.Manifests[0]
 	img, err := pathObj.Image(manifest.Digest)
 	if err != nil {
 		return nil, fmt.Errorf("unable to parse OCI directory as an image: %w", err)
@@ -61,6 +65,13 @@ func (p *DirectoryImageProvider) Provide(_ context.Context, userMetadata ...imag
 		metadata = append(metadata, image.WithManifest(rawManifest))
 	}
 
+	if p.platform != nil {
+		metadata = append(metadata,
+			image.WithArchitecture(p.platform.Architecture, p.platform.Variant),
+			image.WithOS(p.platform.OS),
+		)
+	}
+
 	// apply user-supplied metadata last to override any default behavior
 	metadata = append(metadata, userMetadata...)
 
@@ -71,3 +82,68 @@ func (p *DirectoryImageProvider) Provide(_ context.Context, userMetadata ...imag
 
 	return image.NewImage(img, contentTempDir, metadata...), nil
 }
+
+// selectManifest finds the image manifest descriptor to use from the given index. Nested indexes (multi-platform
+// manifest lists referenced from the top level index.json) are expanded. When no platform is given there must be
+// exactly one image to choose from.
+func selectManifest(index containerregistryV1.ImageIndex, platform *image.Platform) (*containerregistryV1.Descriptor, error) {
+	manifests, err := imageManifests(index)
+	if err != nil {
+		return nil, err
+	}
+
+	if platform == nil {
+		// for now, lets only support one image indexManifest (it is not clear how to handle multiple manifests)
+		if len(manifests) != 1 {
+			return nil, fmt.Errorf("unexpected number of OCI directory manifests (found %d)", len(manifests))
+		}
+		return &manifests[0], nil
+	}
+
+	for idx, m := range manifests {
+		if platformMatches(m.Platform, platform) {
+			return &manifests[idx], nil
+		}
+	}
+
+	return nil, fmt.Errorf("no OCI directory manifest found for platform=%q (found %d manifests)", platform.String(), len(manifests))
+}
+
+// imageManifests returns all image manifest descriptors from the given index, recursively expanding nested indexes.
+func imageManifests(index containerregistryV1.ImageIndex) ([]containerregistryV1.Descriptor, error) {
+	indexManifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse OCI directory indexManifest: %w", err)
+	}
+
+	var manifests []containerregistryV1.Descriptor
+	for _, m := range indexManifest.Manifests {
+		switch m.MediaType {
+		case types.OCIImageIndex, types.DockerManifestList:
+			child, err := index.ImageIndex(m.Digest)
+			if err != nil {
+				return nil, fmt.Errorf("unable to parse nested OCI index %q: %w", m.Digest, err)
+			}
+			childManifests, err := imageManifests(child)
+			if err != nil {
+				return nil, err
+			}
+			manifests = append(manifests, childManifests...)
+		default:
+			manifests = append(manifests, m)
+		}
+	}
+	return manifests, nil
+}
+
+// platformMatches indicates if the platform described on an index descriptor satisfies the user requested platform.
+// The variant is only considered when the user has specified one.
+func platformMatches(candidate *containerregistryV1.Platform, requested *image.Platform) bool {
+	if candidate == nil {
+		return false
+	}
+	if candidate.OS != requested.OS || candidate.Architecture != requested.Architecture {
+		return false
+	}
+	return requested.Variant == "" || candidate.Variant == requested.Variant
+}
@@ -4,7 +4,13 @@ import (
 	"testing"
 
 	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+	containerregistryV1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/random"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func Test_NewProviderFromPath(t *testing.T) {
@@ -51,3 +57,63 @@ func Test_Directory_Provide(t *testing.T) {
 		})
 	}
 }
+
+func Test_Directory_Provide_Platform(t *testing.T) {
+	dir := t.TempDir()
+	layoutPath, err := layout.Write(dir, empty.Index)
+	require.NoError(t, err)
+
+	amd64Image, err := random.Image(10, 1)
+	require.NoError(t, err)
+	arm64Image, err := random.Image(10, 1)
+	require.NoError(t, err)
+
+	require.NoError(t, layoutPath.AppendImage(amd64Image, layout.WithPlatform(containerregistryV1.Platform{OS: "linux", Architecture: "amd64"})))
+	require.NoError(t, layoutPath.AppendImage(arm64Image, layout.WithPlatform(containerregistryV1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"})))
+
+	arm64Digest, err := arm64Image.Digest()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		platform       string
+		expectedDigest string
+		expectedErr    bool
+	}{
+		{
+			name:        "multiple manifests without platform",
+			expectedErr: true,
+		},
+		{
+			name:           "select by os and architecture",
+			platform:       "linux/arm64",
+			expectedDigest: arm64Digest.String(),
+		},
+		{
+			name:        "no matching platform",
+			platform:    "linux/s390x",
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var platform *image.Platform
+			if tc.platform != "" {
+				platform, err = image.NewPlatform(tc.platform)
+				require.NoError(t, err)
+			}
+
+			provider := NewProviderFromPathWithPlatform(dir, file.NewTempDirGenerator("tempDir"), platform)
+			img, err := provider.Provide(nil)
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.NoError(t, img.Read())
+			assert.Equal(t, tc.expectedDigest, img.Metadata.ManifestDigest)
+			assert.Equal(t, "arm64", img.Metadata.Architecture)
+		})
+	}
+}
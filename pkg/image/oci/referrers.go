@@ -0,0 +1,319 @@
+package oci
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/anchore/stereoscope/internal/log"
+	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/google/go-containerregistry/pkg/name"
+	containerregistryV1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// referrerManifest captures the OCI image manifest fields that describe an artifact relationship to another manifest.
+type referrerManifest struct {
+	ArtifactType string                          `json:"artifactType,omitempty"`
+	Config       containerregistryV1.Descriptor  `json:"config"`
+	Subject      *containerregistryV1.Descriptor `json:"subject,omitempty"`
+}
+
+// referrersTag returns the tag used by the OCI referrers tag schema to index all referrers to the given digest.
+func referrersTag(repo name.Repository, digest containerregistryV1.Hash) name.Tag {
+	return repo.Tag(fmt.Sprintf("%s-%s", digest.Algorithm, digest.Hex))
+}
+
+// isNotFound indicates if the given error is a registry response for a manifest (or blob) that does not exist.
+func isNotFound(err error) bool {
+	var terr *transport.Error
+	return errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound
+}
+
+// newReferrerSBOMFetcher returns an image.SBOMFetcher that discovers SPDX/CycloneDX SBOM layers from all referrer
+// artifacts (whose subject is one of the given manifest digests, see listReferrers).
+func newReferrerSBOMFetcher(ref name.Reference, registryOptions image.RegistryOptions, digests ...containerregistryV1.Hash) image.SBOMFetcher {
+	return func(ctx context.Context) ([]image.SBOM, error) {
+		client, err := newRegistryClient(ctx, ref, registryOptions)
+		if err != nil {
+			return nil, err
+		}
+		options, err := prepareRemoteOptions(ctx, ref, registryOptions, nil)
+		if err != nil {
+			return nil, err
+		}
+		var sboms []image.SBOM
+		seen := make(map[containerregistryV1.Hash]struct{})
+		for _, digest := range digests {
+			if _, ok := seen[digest]; ok {
+				continue
+			}
+			seen[digest] = struct{}{}
+
+			found, err := fetchReferrerSBOMs(ctx, client, ref.Context(), digest, options...)
+			if err != nil {
+				return nil, err
+			}
+			sboms = append(sboms, found...)
+		}
+		return sboms, nil
+	}
+}
+
+func fetchReferrerSBOMs(ctx context.Context, client *http.Client, repo name.Repository, subject containerregistryV1.Hash, options ...remote.Option) ([]image.SBOM, error) {
+	descriptors, err := listReferrers(ctx, client, repo, subject, "", options...)
+	if err != nil {
+		return nil, err
+	}
+
+	var sboms []image.SBOM
+	for _, desc := range descriptors {
+		artifactSBOMs, err := fetchArtifactSBOMs(repo.Digest(desc.Digest.String()), subject, options...)
+		if err != nil {
+			log.Warnf("unable to fetch SBOMs from referrer artifact=%q: %+v", desc.Digest, err)
+			continue
+		}
+		sboms = append(sboms, artifactSBOMs...)
+	}
+	return sboms, nil
+}
+
+func fetchArtifactSBOMs(ref name.Digest, subject containerregistryV1.Hash, options ...remote.Option) ([]image.SBOM, error) {
+	artifact, err := remote.Image(ref, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	rawManifest, err := artifact.RawManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest referrerManifest
+	if err := json.Unmarshal(rawManifest, &manifest); err != nil {
+		return nil, fmt.Errorf("unable to parse artifact manifest: %w", err)
+	}
+
+	if manifest.Subject != nil && manifest.Subject.Digest != subject {
+		log.Debugf("skipping referrer artifact=%q with unrelated subject=%q", ref.DigestStr(), manifest.Subject.Digest)
+		return nil, nil
+	}
+
+	// the artifact type may describe the SBOM format when the layer media type is generic
+	artifactType := manifest.ArtifactType
+	if artifactType == "" {
+		artifactType = string(manifest.Config.MediaType)
+	}
+
+	layers, err := artifact.Layers()
+	if err != nil {
+		return nil, err
+	}
+
+	var sboms []image.SBOM
+	for _, layer := range layers {
+		mediaType, err := layer.MediaType()
+		if err != nil {
+			return nil, err
+		}
+
+		sbomMediaType := string(mediaType)
+		if !image.IsSBOMMediaType(sbomMediaType) {
+			if !image.IsSBOMMediaType(artifactType) {
+				continue
+			}
+			sbomMediaType = artifactType
+		}
+
+		digest, err := layer.Digest()
+		if err != nil {
+			return nil, err
+		}
+
+		reader, err := layer.Compressed()
+		if err != nil {
+			return nil, fmt.Errorf("unable to fetch SBOM blob=%q: %w", digest, err)
+		}
+		content, err := ioutil.ReadAll(reader)
+		_ = reader.Close()
+		if err != nil {
+			return nil, fmt.Errorf("unable to read SBOM blob=%q: %w", digest, err)
+		}
+
+		sboms = append(sboms, image.SBOM{
+			MediaType:      strings.TrimSpace(sbomMediaType),
+			Digest:         digest.String(),
+			ArtifactDigest: ref.DigestStr(),
+			Content:        content,
+		})
+	}
+	return sboms, nil
+}
+
+// referrersIndex is an image index listing referrers, where each descriptor may describe the artifact type.
+type referrersIndex struct {
+	Manifests []referrerDescriptor `json:"manifests"`
+}
+
+// referrerDescriptor is a descriptor within a referrers index (the GCR lib does not yet model the artifact type).
+type referrerDescriptor struct {
+	containerregistryV1.Descriptor
+	ArtifactType string `json:"artifactType,omitempty"`
+}
+
+// newReferrerFetcher returns an image.ReferrerFetcher that lists all referrer artifacts whose subject is one of the
+// given manifest digests, using the OCI referrers API when the registry supports it, otherwise the referrers tag
+// schema.
+func newReferrerFetcher(ref name.Reference, registryOptions image.RegistryOptions, digests ...containerregistryV1.Hash) image.ReferrerFetcher {
+	return func(ctx context.Context, artifactType string) ([]image.Referrer, error) {
+		client, err := newRegistryClient(ctx, ref, registryOptions)
+		if err != nil {
+			return nil, err
+		}
+		options, err := prepareRemoteOptions(ctx, ref, registryOptions, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var referrers []image.Referrer
+		seen := make(map[containerregistryV1.Hash]struct{})
+		for _, subject := range digests {
+			if _, ok := seen[subject]; ok {
+				continue
+			}
+			seen[subject] = struct{}{}
+
+			descriptors, err := listReferrers(ctx, client, ref.Context(), subject, artifactType, options...)
+			if err != nil {
+				return nil, err
+			}
+			for _, desc := range descriptors {
+				// filtering by the registry is optional, so always filter
+				if artifactType != "" && desc.ArtifactType != artifactType {
+					continue
+				}
+				referrers = append(referrers, image.Referrer{
+					ArtifactType: desc.ArtifactType,
+					MediaType:    string(desc.MediaType),
+					Digest:       desc.Digest.String(),
+					Size:         desc.Size,
+					Annotations:  desc.Annotations,
+					Subject:      subject.String(),
+				})
+			}
+		}
+		return referrers, nil
+	}
+}
+
+// listReferrers returns the descriptors of all referrers to the given subject (where the artifact type of each is
+// resolved from the artifact manifest if the registry did not list it).
+func listReferrers(ctx context.Context, client *http.Client, repo name.Repository, subject containerregistryV1.Hash, artifactType string, options ...remote.Option) ([]referrerDescriptor, error) {
+	descriptors, supported, err := fetchReferrersAPI(ctx, client, repo, subject, artifactType)
+	if err != nil {
+		return nil, err
+	}
+	if !supported {
+		if descriptors, err = fetchReferrersTagSchema(repo, subject, options...); err != nil {
+			return nil, err
+		}
+	}
+
+	var resolved []referrerDescriptor
+	for _, desc := range descriptors {
+		if desc.ArtifactType == "" {
+			manifest, err := fetchReferrerManifest(repo.Digest(desc.Digest.String()), options...)
+			if err != nil {
+				log.Warnf("unable to fetch referrer artifact=%q: %+v", desc.Digest, err)
+				continue
+			}
+			if manifest.Subject != nil && manifest.Subject.Digest != subject {
+				log.Debugf("skipping referrer artifact=%q with unrelated subject=%q", desc.Digest, manifest.Subject.Digest)
+				continue
+			}
+			desc.ArtifactType = manifest.ArtifactType
+			if desc.ArtifactType == "" {
+				desc.ArtifactType = string(manifest.Config.MediaType)
+			}
+		}
+		resolved = append(resolved, desc)
+	}
+	return resolved, nil
+}
+
+// fetchReferrersAPI lists the referrers to the given subject with the OCI referrers API, indicating if the registry
+// supports the API at all.
+func fetchReferrersAPI(ctx context.Context, client *http.Client, repo name.Repository, subject containerregistryV1.Hash, artifactType string) ([]referrerDescriptor, bool, error) {
+	u := url.URL{
+		Scheme: repo.Registry.Scheme(),
+		Host:   repo.RegistryStr(),
+		Path:   fmt.Sprintf("/v2/%s/referrers/%s", repo.RepositoryStr(), subject),
+	}
+	if artifactType != "" {
+		u.RawQuery = url.Values{"artifactType": []string{artifactType}}.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, false, err
+	}
+	req.Header.Set("Accept", string(types.OCIImageIndex))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		// registries supporting the API respond with an empty index for subjects without referrers
+		return nil, false, nil
+	}
+	if err := transport.CheckError(resp, http.StatusOK); err != nil {
+		return nil, false, fmt.Errorf("unable to fetch referrers for digest=%q: %w", subject, err)
+	}
+
+	var index referrersIndex
+	if err := json.NewDecoder(resp.Body).Decode(&index); err != nil {
+		return nil, false, fmt.Errorf("unable to read referrers for digest=%q: %w", subject, err)
+	}
+	return index.Manifests, true, nil
+}
+
+// fetchReferrersTagSchema lists the referrers to the given subject from the index tagged with the referrers tag schema.
+func fetchReferrersTagSchema(repo name.Repository, subject containerregistryV1.Hash, options ...remote.Option) ([]referrerDescriptor, error) {
+	index, err := remote.Index(referrersTag(repo, subject), options...)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unable to fetch referrers for digest=%q: %w", subject, err)
+	}
+	raw, err := index.RawManifest()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read referrers index for digest=%q: %w", subject, err)
+	}
+	var parsed referrersIndex
+	if err := json.Unmarshal(raw, &parsed); err != nil {
+		return nil, fmt.Errorf("unable to parse referrers index for digest=%q: %w", subject, err)
+	}
+	return parsed.Manifests, nil
+}
+
+func fetchReferrerManifest(ref name.Digest, options ...remote.Option) (*referrerManifest, error) {
+	desc, err := remote.Get(ref, options...)
+	if err != nil {
+		return nil, err
+	}
+	var manifest referrerManifest
+	if err := json.Unmarshal(desc.Manifest, &manifest); err != nil {
+		return nil, fmt.Errorf("unable to parse artifact manifest: %w", err)
+	}
+	return &manifest, nil
+}
@@ -0,0 +1,195 @@
+package oci
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+)
+
+func readTestRegistryImage(t *testing.T, imageStr string) *image.Image {
+	t.Helper()
+	provider := NewProviderFromRegistry(imageStr, file.NewTempDirGenerator("test"), image.RegistryOptions{InsecureUseHTTP: true}, nil)
+	result, err := provider.Provide(context.Background())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = result.Cleanup() })
+	require.NoError(t, result.Read())
+	return result
+}
+
+func Test_RegistryReferrers_TagSchema(t *testing.T) {
+	host := newTestRegistry(t)
+	imageStr := host + "/anchore/example:latest"
+	ref, err := name.ParseReference(imageStr)
+	require.NoError(t, err)
+
+	img, err := random.Image(64, 1)
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(ref, img))
+	digest, err := img.Digest()
+	require.NoError(t, err)
+	subject := v1.Descriptor{MediaType: types.DockerManifestSchema2, Digest: digest}
+	unrelated := v1.Descriptor{MediaType: types.DockerManifestSchema2, Digest: v1.Hash{Algorithm: "sha256", Hex: strings.Repeat("0", 64)}}
+
+	// artifacts without an explicit artifact type are described by the config media type
+	spdx := newSBOMArtifact(t, subject, `{"spdxVersion":"SPDX-2.3"}`, "application/spdx+json")
+	pushReferrers(t, ref.Context(), subject,
+		spdx,
+		newSBOMArtifact(t, unrelated, `{"spdxVersion":"SPDX-2.2"}`, "application/spdx+json"),
+	)
+
+	result := readTestRegistryImage(t, imageStr)
+
+	referrers, err := result.Referrers(context.Background(), "")
+	require.NoError(t, err)
+	require.Len(t, referrers, 1)
+	spdxDigest, err := spdx.Digest()
+	require.NoError(t, err)
+	assert.Equal(t, spdxDigest.String(), referrers[0].Digest)
+	assert.Equal(t, digest.String(), referrers[0].Subject)
+	assert.Equal(t, "application/vnd.oci.empty.v1+json", referrers[0].ArtifactType)
+	assert.Equal(t, string(types.OCIManifestSchema1), referrers[0].MediaType)
+	assert.NotZero(t, referrers[0].Size)
+
+	referrers, err = result.Referrers(context.Background(), "application/spdx+json")
+	require.NoError(t, err)
+	assert.Empty(t, referrers)
+}
+
+func Test_RegistryReferrers_API(t *testing.T) {
+	var queries []string
+	var index referrersIndex
+	handler := registry.New()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.URL.Path, "/referrers/") {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		queries = append(queries, r.URL.Query().Get("artifactType"))
+		w.Header().Set("Content-Type", string(types.OCIImageIndex))
+		require.NoError(t, json.NewEncoder(w).Encode(index))
+	}))
+	t.Cleanup(server.Close)
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	imageStr := u.Host + "/anchore/example:latest"
+	ref, err := name.ParseReference(imageStr)
+	require.NoError(t, err)
+	img, err := random.Image(64, 1)
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(ref, img))
+
+	sbomDigest := v1.Hash{Algorithm: "sha256", Hex: strings.Repeat("1", 64)}
+	index.Manifests = []referrerDescriptor{
+		{
+			Descriptor: v1.Descriptor{
+				MediaType:   types.OCIManifestSchema1,
+				Digest:      sbomDigest,
+				Size:        512,
+				Annotations: map[string]string{"org.opencontainers.image.created": "2022-01-01T00:00:00Z"},
+			},
+			ArtifactType: "application/vnd.cyclonedx+json",
+		},
+		{
+			Descriptor: v1.Descriptor{
+				MediaType: types.OCIManifestSchema1,
+				Digest:    v1.Hash{Algorithm: "sha256", Hex: strings.Repeat("2", 64)},
+				Size:      256,
+			},
+			ArtifactType: "application/vnd.dev.sigstore.bundle.v0.3+json",
+		},
+	}
+
+	result := readTestRegistryImage(t, imageStr)
+
+	referrers, err := result.Referrers(context.Background(), "application/vnd.cyclonedx+json")
+	require.NoError(t, err)
+	require.NotEmpty(t, queries)
+	assert.Equal(t, "application/vnd.cyclonedx+json", queries[0])
+
+	// the registry did not filter, which is done by the client instead (and the same subject is listed once)
+	require.Len(t, referrers, 1)
+	assert.Equal(t, sbomDigest.String(), referrers[0].Digest)
+	assert.Equal(t, int64(512), referrers[0].Size)
+	assert.Equal(t, "2022-01-01T00:00:00Z", referrers[0].Annotations["org.opencontainers.image.created"])
+	assert.True(t, referrers[0].IsSBOM())
+
+	referrers, err = result.Referrers(context.Background(), "")
+	require.NoError(t, err)
+	assert.Len(t, referrers, 2)
+}
+
+func Test_RegistryReferrers_API_SBOMsAndSignatures(t *testing.T) {
+	var index referrersIndex
+	handler := registry.New()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.URL.Path, "/referrers/") {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", string(types.OCIImageIndex))
+		require.NoError(t, json.NewEncoder(w).Encode(index))
+	}))
+	t.Cleanup(server.Close)
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	imageStr := u.Host + "/anchore/example:latest"
+	ref, err := name.ParseReference(imageStr)
+	require.NoError(t, err)
+	img, err := random.Image(64, 1)
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(ref, img))
+	digest, err := img.Digest()
+	require.NoError(t, err)
+	subject := v1.Descriptor{MediaType: types.DockerManifestSchema2, Digest: digest}
+
+	// the artifacts are only listed by the referrers API (there is no referrers tag schema index)
+	sbom := newSBOMArtifact(t, subject, `{"bomFormat":"CycloneDX"}`, "application/vnd.cyclonedx+json")
+	signature := &subjectArtifact{
+		Image:   newProvenanceArtifact(t, `{"critical":{}}`, image.CosignSignatureMediaType, nil),
+		subject: subject,
+	}
+	for _, artifact := range []v1.Image{sbom, signature} {
+		artifactDigest, err := artifact.Digest()
+		require.NoError(t, err)
+		require.NoError(t, remote.Write(ref.Context().Digest(artifactDigest.String()), artifact))
+		size, err := artifact.Size()
+		require.NoError(t, err)
+		index.Manifests = append(index.Manifests, referrerDescriptor{
+			Descriptor: v1.Descriptor{MediaType: types.OCIManifestSchema1, Digest: artifactDigest, Size: size},
+		})
+	}
+
+	result := readTestRegistryImage(t, imageStr)
+
+	referrers, err := result.Referrers(context.Background(), "")
+	require.NoError(t, err)
+	assert.Len(t, referrers, 2)
+
+	sboms, err := result.SBOMs(context.Background())
+	require.NoError(t, err)
+	require.Len(t, sboms, 1)
+	assert.Equal(t, `{"bomFormat":"CycloneDX"}`, string(sboms[0].Content))
+
+	signatures, err := result.Signatures(context.Background())
+	require.NoError(t, err)
+	require.Len(t, signatures, 1)
+	assert.Equal(t, image.CosignSignatureMediaType, signatures[0].MediaType)
+}
@@ -0,0 +1,183 @@
+package oci
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+)
+
+// blobLayer is an uncompressed, arbitrary blob used as an artifact layer.
+type blobLayer struct {
+	content   []byte
+	mediaType types.MediaType
+}
+
+func (b *blobLayer) Digest() (v1.Hash, error) {
+	h, _, err := v1.SHA256(bytes.NewReader(b.content))
+	return h, err
+}
+
+func (b *blobLayer) DiffID() (v1.Hash, error) {
+	return b.Digest()
+}
+
+func (b *blobLayer) Compressed() (io.ReadCloser, error) {
+	return ioutil.NopCloser(bytes.NewReader(b.content)), nil
+}
+
+func (b *blobLayer) Uncompressed() (io.ReadCloser, error) {
+	return b.Compressed()
+}
+
+func (b *blobLayer) Size() (int64, error) {
+	return int64(len(b.content)), nil
+}
+
+func (b *blobLayer) MediaType() (types.MediaType, error) {
+	return b.mediaType, nil
+}
+
+// subjectArtifact is an artifact manifest with a subject (which the GCR lib does not yet model).
+type subjectArtifact struct {
+	v1.Image
+	subject v1.Descriptor
+}
+
+func (s *subjectArtifact) RawManifest() ([]byte, error) {
+	raw, err := s.Image.RawManifest()
+	if err != nil {
+		return nil, err
+	}
+	var manifest map[string]interface{}
+	if err := json.Unmarshal(raw, &manifest); err != nil {
+		return nil, err
+	}
+	manifest["subject"] = s.subject
+	return json.Marshal(manifest)
+}
+
+func (s *subjectArtifact) Digest() (v1.Hash, error) {
+	raw, err := s.RawManifest()
+	if err != nil {
+		return v1.Hash{}, err
+	}
+	h, _, err := v1.SHA256(bytes.NewReader(raw))
+	return h, err
+}
+
+func newSBOMArtifact(t *testing.T, subject v1.Descriptor, content string, mediaType types.MediaType) v1.Image {
+	t.Helper()
+	artifact := mutate.MediaType(empty.Image, types.OCIManifestSchema1)
+	artifact = mutate.ConfigMediaType(artifact, "application/vnd.oci.empty.v1+json")
+	artifact, err := mutate.Append(artifact, mutate.Addendum{
+		Layer:     &blobLayer{content: []byte(content), mediaType: mediaType},
+		MediaType: mediaType,
+	})
+	require.NoError(t, err)
+	return &subjectArtifact{Image: artifact, subject: subject}
+}
+
+func pushReferrers(t *testing.T, repo name.Repository, subject v1.Descriptor, artifacts ...v1.Image) {
+	t.Helper()
+	var index v1.ImageIndex = empty.Index
+	for _, artifact := range artifacts {
+		digest, err := artifact.Digest()
+		require.NoError(t, err)
+		require.NoError(t, remote.Write(repo.Digest(digest.String()), artifact))
+		index = mutate.AppendManifests(index, mutate.IndexAddendum{Add: artifact})
+	}
+	require.NoError(t, remote.WriteIndex(referrersTag(repo, subject.Digest), index))
+}
+
+func newTestRegistry(t *testing.T) string {
+	t.Helper()
+	server := httptest.NewServer(registry.New())
+	t.Cleanup(server.Close)
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	return u.Host
+}
+
+func Test_RegistryReferrerSBOMs(t *testing.T) {
+	host := newTestRegistry(t)
+	imageStr := host + "/anchore/example:latest"
+	ref, err := name.ParseReference(imageStr)
+	require.NoError(t, err)
+
+	img, err := random.Image(64, 1)
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(ref, img))
+
+	digest, err := img.Digest()
+	require.NoError(t, err)
+	subject := v1.Descriptor{MediaType: types.DockerManifestSchema2, Digest: digest}
+
+	unrelated := v1.Descriptor{MediaType: types.DockerManifestSchema2, Digest: v1.Hash{Algorithm: "sha256", Hex: "0000000000000000000000000000000000000000000000000000000000000000"}}
+
+	pushReferrers(t, ref.Context(), subject,
+		newSBOMArtifact(t, subject, `{"spdxVersion":"SPDX-2.3"}`, "application/spdx+json"),
+		newSBOMArtifact(t, subject, `{"bomFormat":"CycloneDX"}`, "application/vnd.cyclonedx+json"),
+		newSBOMArtifact(t, subject, `not an sbom`, "application/vnd.example.signature"),
+		newSBOMArtifact(t, unrelated, `{"spdxVersion":"SPDX-2.2"}`, "application/spdx+json"),
+	)
+
+	provider := NewProviderFromRegistry(imageStr, file.NewTempDirGenerator("test"), image.RegistryOptions{InsecureUseHTTP: true}, nil)
+	result, err := provider.Provide(context.Background())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = result.Cleanup() })
+	require.NoError(t, result.Read())
+
+	sboms, err := result.SBOMs(context.Background())
+	require.NoError(t, err)
+
+	contents := make(map[string]string)
+	for _, sbom := range sboms {
+		contents[sbom.MediaType] = string(sbom.Content)
+		assert.NotEmpty(t, sbom.Digest)
+		assert.NotEmpty(t, sbom.ArtifactDigest)
+	}
+	assert.Equal(t, map[string]string{
+		"application/spdx+json":          `{"spdxVersion":"SPDX-2.3"}`,
+		"application/vnd.cyclonedx+json": `{"bomFormat":"CycloneDX"}`,
+	}, contents)
+}
+
+func Test_RegistryReferrerSBOMs_NoReferrers(t *testing.T) {
+	host := newTestRegistry(t)
+	imageStr := host + "/anchore/example:latest"
+	ref, err := name.ParseReference(imageStr)
+	require.NoError(t, err)
+
+	img, err := random.Image(64, 1)
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(ref, img))
+
+	provider := NewProviderFromRegistry(imageStr, file.NewTempDirGenerator("test"), image.RegistryOptions{InsecureUseHTTP: true}, nil)
+	result, err := provider.Provide(context.Background())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = result.Cleanup() })
+	require.NoError(t, result.Read())
+
+	sboms, err := result.SBOMs(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, sboms)
+}
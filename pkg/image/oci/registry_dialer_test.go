@@ -0,0 +1,61 @@
+package oci
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+)
+
+func TestRegistryImageProvider_CustomDialer(t *testing.T) {
+	server := httptest.NewServer(registry.New(registry.Logger(log.New(ioutil.Discard, "", 0))))
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	_, port, err := net.SplitHostPort(serverURL.Host)
+	require.NoError(t, err)
+
+	img, err := random.Image(64, 1)
+	require.NoError(t, err)
+	pushRef, err := name.ParseReference(serverURL.Host + "/repo:latest")
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(pushRef, img))
+
+	// this host cannot be resolved by the system resolver
+	imageStr := net.JoinHostPort("registry.invalid", port) + "/repo:latest"
+
+	generator := file.NewTempDirGenerator("stereoscope-dialer-test")
+	defer generator.Cleanup()
+
+	var dialed []string
+	staticDialer := image.NewStaticHostDialer(map[string]string{"registry.invalid": "127.0.0.1"})
+	options := image.RegistryOptions{
+		InsecureUseHTTP: true,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dialed = append(dialed, addr)
+			return staticDialer(ctx, network, addr)
+		},
+	}
+
+	provided, err := NewProviderFromRegistry(imageStr, generator, options, nil).Provide(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, provided.Read())
+
+	expectedID, err := img.ConfigName()
+	require.NoError(t, err)
+	assert.Equal(t, expectedID.String(), provided.Metadata.ID)
+	assert.Contains(t, dialed, net.JoinHostPort("registry.invalid", port))
+}
@@ -2,7 +2,6 @@ package oci
 
 import (
 	"context"
-	"crypto/tls"
 	"fmt"
 	"net/http"
 
@@ -47,7 +46,12 @@ func (p *RegistryImageProvider) Provide(ctx context.Context, userMetadata ...ima
 		return nil, fmt.Errorf("unable to parse registry reference=%q: %+v", p.imageStr, err)
 	}
 
-	descriptor, err := remote.Get(ref, prepareRemoteOptions(ctx, ref, p.registryOptions, p.platform)...)
+	remoteOptions, err := prepareRemoteOptions(ctx, ref, p.registryOptions, p.platform)
+	if err != nil {
+		return nil, err
+	}
+
+	descriptor, err := remote.Get(ref, remoteOptions...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get image descriptor from registry: %+v", err)
 	}
@@ -65,6 +69,25 @@ func (p *RegistryImageProvider) Provide(ctx context.Context, userMetadata ...ima
 		image.WithRepoDigests(repoDigest),
 	}
 
+	// SBOM referrers may be attached to either the platform specific image manifest or the index
+	sbomSubjects := []containerregistryV1.Hash{descriptor.Digest}
+	if imgDigest, err := img.Digest(); err == nil {
+		sbomSubjects = append([]containerregistryV1.Hash{imgDigest}, sbomSubjects...)
+	}
+	metadata = append(metadata,
+		image.WithSBOMFetcher(newReferrerSBOMFetcher(ref, p.registryOptions, sbomSubjects...)),
+		image.WithReferrerFetcher(newReferrerFetcher(ref, p.registryOptions, sbomSubjects...)),
+	)
+
+	// signatures and attestations are discovered the same way (in addition to the cosign tag conventions)
+	metadata = append(metadata,
+		image.WithSignatureFetcher(newSignatureFetcher(ref, p.registryOptions, sbomSubjects...)),
+		image.WithAttestationFetcher(newAttestationFetcher(ref, p.registryOptions, sbomSubjects...)),
+	)
+
+	// seekable (eStargz) layers are read with range requests instead of fetching the whole layer blob
+	metadata = append(metadata, image.WithBlobRangeReader(newRegistryBlobRangeReader(ref, p.registryOptions)))
+
 	// make a best effort to get the manifest, should not block getting an image though if it fails
 	if manifestBytes, err := img.RawManifest(); err == nil {
 		metadata = append(metadata, image.WithManifest(manifestBytes))
@@ -91,16 +114,14 @@ func prepareReferenceOptions(registryOptions image.RegistryOptions) []name.Optio
 	return options
 }
 
-func prepareRemoteOptions(ctx context.Context, ref name.Reference, registryOptions image.RegistryOptions, p *image.Platform) (options []remote.Option) {
-	options = append(options, remote.WithContext(ctx))
+func prepareRemoteOptions(ctx context.Context, ref name.Reference, registryOptions image.RegistryOptions, p *image.Platform) ([]remote.Option, error) {
+	options := []remote.Option{remote.WithContext(ctx)}
 
-	if registryOptions.InsecureSkipTLSVerify {
-		t := &http.Transport{
-			// nolint: gosec
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		}
-		options = append(options, remote.WithTransport(t))
+	authenticator, t, err := prepareTransport(ctx, ref, registryOptions)
+	if err != nil {
+		return nil, err
 	}
+	options = append(options, remote.WithAuth(authenticator), remote.WithTransport(t))
 
 	if p != nil {
 		options = append(options, remote.WithPlatform(containerregistryV1.Platform{
@@ -110,16 +131,24 @@ func prepareRemoteOptions(ctx context.Context, ref name.Reference, registryOptio
 		}))
 	}
 
-	// note: the authn.Authenticator and authn.Keychain options are mutually exclusive, only one may be provided.
-	// If no explicit authenticator can be found, then fallback to the keychain.
-	authenticator := registryOptions.Authenticator(ref.Context().RegistryStr())
-	if authenticator != nil {
-		options = append(options, remote.WithAuth(authenticator))
-	} else {
-		// use the Keychain specified from a docker config file.
-		log.Debugf("no registry credentials configured, using the default keychain")
-		options = append(options, remote.WithAuthFromKeychain(authn.DefaultKeychain))
+	return options, nil
+}
+
+// prepareTransport returns the registry authenticator and the (unauthenticated) transport to use for all requests to
+// the registry of the given reference.
+func prepareTransport(ctx context.Context, ref name.Reference, registryOptions image.RegistryOptions) (authn.Authenticator, http.RoundTripper, error) {
+	// the transport carries the TLS options, dialer, and connection pooling settings (and may be shared between
+	// fetches, see image.RegistryTransportPool)
+	t, err := registryOptions.HTTPTransport()
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return options
+	// credentials are resolved from explicit options, then the environment, then the docker config (see
+	// image.RegistryOptions.ResolveCredentials)
+	authenticator, t, err := registryOptions.RefreshableAuthenticator(ctx, ref.Context().RegistryStr(), t)
+	if err != nil {
+		return nil, nil, err
+	}
+	return authenticator, registryOptions.Transport(t), nil
 }
@@ -0,0 +1,182 @@
+package oci
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+)
+
+func TestRegistryImageProvider_TLS(t *testing.T) {
+	dir := t.TempDir()
+	clientCert, clientCertFile, clientKeyFile := writeTestClientCertificate(t, dir)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+
+	server := httptest.NewUnstartedServer(registry.New(registry.Logger(log.New(ioutil.Discard, "", 0))))
+	server.TLS = &tls.Config{
+		ClientAuth: tls.VerifyClientCertIfGiven,
+		ClientCAs:  clientCAs,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	_, port, err := net.SplitHostPort(serverURL.Host)
+	require.NoError(t, err)
+
+	img, err := random.Image(64, 1)
+	require.NoError(t, err)
+	pushRef, err := name.ParseReference(serverURL.Host + "/repo:latest")
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(pushRef, img, remote.WithTransport(server.Client().Transport)))
+
+	// now require client certificates for all pulls
+	server.TLS.ClientAuth = tls.RequireAndVerifyClientCert
+
+	caFile := filepath.Join(dir, "ca.pem")
+	require.NoError(t, ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600))
+
+	// the httptest certificate is valid for example.com, which is mapped to the test server
+	imageStr := net.JoinHostPort("example.com", port) + "/repo:latest"
+	dialer := image.NewStaticHostDialer(map[string]string{"example.com": "127.0.0.1"})
+
+	expectedID, err := img.ConfigName()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		options image.RegistryOptions
+		wantErr bool
+	}{
+		{
+			name: "custom CA with client certificate",
+			options: image.RegistryOptions{
+				CAFile:         caFile,
+				ClientCertFile: clientCertFile,
+				ClientKeyFile:  clientKeyFile,
+			},
+		},
+		{
+			name: "skip verification with client certificate",
+			options: image.RegistryOptions{
+				InsecureSkipTLSVerify: true,
+				ClientCertFile:        clientCertFile,
+				ClientKeyFile:         clientKeyFile,
+			},
+		},
+		{
+			name:    "unknown CA",
+			options: image.RegistryOptions{ClientCertFile: clientCertFile, ClientKeyFile: clientKeyFile},
+			wantErr: true,
+		},
+		{
+			name:    "missing client certificate",
+			options: image.RegistryOptions{CAFile: caFile},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			generator := file.NewTempDirGenerator("stereoscope-tls-test")
+			defer generator.Cleanup()
+
+			test.options.DialContext = dialer
+			provided, err := NewProviderFromRegistry(imageStr, generator, test.options, nil).Provide(context.Background())
+			if test.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.NoError(t, provided.Read())
+			assert.Equal(t, expectedID.String(), provided.Metadata.ID)
+		})
+	}
+}
+
+func TestRegistryOptions_TLSConfig_Errors(t *testing.T) {
+	dir := t.TempDir()
+	_, certFile, keyFile := writeTestClientCertificate(t, dir)
+	notPEM := filepath.Join(dir, "not-pem")
+	require.NoError(t, ioutil.WriteFile(notPEM, []byte("nope"), 0600))
+
+	tests := []struct {
+		name    string
+		options image.RegistryOptions
+		wantErr string
+	}{
+		{name: "missing CA file", options: image.RegistryOptions{CAFile: filepath.Join(dir, "missing")}, wantErr: "unable to read registry CA file"},
+		{name: "CA file without certificates", options: image.RegistryOptions{CAFile: notPEM}, wantErr: "no PEM encoded certificates"},
+		{name: "cert without key", options: image.RegistryOptions{ClientCertFile: certFile}, wantErr: "both a client certificate and key are required"},
+		{name: "invalid key", options: image.RegistryOptions{ClientCertFile: certFile, ClientKeyFile: notPEM}, wantErr: "unable to load registry client certificate"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.True(t, test.options.RequiresTLSConfig())
+			_, err := test.options.TLSConfig()
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.wantErr)
+		})
+	}
+
+	cfg, err := image.RegistryOptions{ClientCertFile: certFile, ClientKeyFile: keyFile}.TLSConfig()
+	require.NoError(t, err)
+	assert.Len(t, cfg.Certificates, 1)
+	assert.False(t, image.RegistryOptions{}.RequiresTLSConfig())
+}
+
+// writeTestClientCertificate writes a self-signed client certificate and key (PEM encoded) into the given directory.
+func writeTestClientCertificate(t *testing.T, dir string) (*x509.Certificate, string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "stereoscope-test-client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	raw, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(raw)
+	require.NoError(t, err)
+
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, "client.pem")
+	keyFile := filepath.Join(dir, "client-key.pem")
+	require.NoError(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: raw}), 0600))
+	require.NoError(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}), 0600))
+	return cert, certFile, keyFile
+}
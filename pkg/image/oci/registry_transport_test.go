@@ -0,0 +1,79 @@
+package oci
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+)
+
+func TestRegistryImageProvider_TransportPool(t *testing.T) {
+	var connections int64
+	server := httptest.NewUnstartedServer(registry.New(registry.Logger(log.New(ioutil.Discard, "", 0))))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt64(&connections, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	var imageStrs []string
+	for _, repo := range []string{"first", "second", "third"} {
+		img, err := random.Image(64, 8)
+		require.NoError(t, err)
+		imageStr := serverURL.Host + "/" + repo + ":latest"
+		ref, err := name.ParseReference(imageStr)
+		require.NoError(t, err)
+		require.NoError(t, remote.Write(ref, img))
+		imageStrs = append(imageStrs, imageStr)
+	}
+
+	generator := file.NewTempDirGenerator("stereoscope-transport-test")
+	defer generator.Cleanup()
+
+	fetchAll := func(options image.RegistryOptions) int64 {
+		atomic.StoreInt64(&connections, 0)
+		for _, imageStr := range imageStrs {
+			provided, err := NewProviderFromRegistry(imageStr, generator, options, nil).Provide(context.Background())
+			require.NoError(t, err)
+			require.NoError(t, provided.Read(image.WithLayerReadConcurrency(4)))
+			require.Len(t, provided.Layers, 8)
+		}
+		return atomic.LoadInt64(&connections)
+	}
+
+	options := image.RegistryOptions{
+		InsecureUseHTTP: true,
+		TransportSettings: image.RegistryTransportSettings{
+			MaxConnsPerHost:     2,
+			MaxIdleConnsPerHost: 2,
+		},
+	}
+	dedicated := fetchAll(options)
+
+	pool := image.NewRegistryTransportPool()
+	defer pool.CloseIdleConnections()
+	options.TransportPool = pool
+	pooled := fetchAll(options)
+
+	// with a pool all fetches reuse the connections of a single transport instead of each dialing their own
+	assert.Less(t, pooled, dedicated)
+}
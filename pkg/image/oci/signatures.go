@@ -0,0 +1,188 @@
+package oci
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/anchore/stereoscope/internal/log"
+	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/google/go-containerregistry/pkg/name"
+	containerregistryV1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+const (
+	// cosign tag suffixes for the signature and attestation manifests of an image
+	signatureTagSuffix   = "sig"
+	attestationTagSuffix = "att"
+)
+
+// provenanceLayer is a single signature or attestation layer from an artifact attached to an image.
+type provenanceLayer struct {
+	artifact   name.Digest
+	descriptor containerregistryV1.Descriptor
+	content    []byte
+}
+
+// cosignTag returns the tag used by cosign to store signatures (or attestations) for the given digest.
+func cosignTag(repo name.Repository, digest containerregistryV1.Hash, suffix string) name.Tag {
+	return repo.Tag(fmt.Sprintf("%s-%s.%s", digest.Algorithm, digest.Hex, suffix))
+}
+
+// newSignatureFetcher returns an image.SignatureFetcher that discovers cosign signatures for the given manifest
+// digests, both from the cosign tag convention and from referrer artifacts (see listReferrers).
+func newSignatureFetcher(ref name.Reference, registryOptions image.RegistryOptions, digests ...containerregistryV1.Hash) image.SignatureFetcher {
+	return func(ctx context.Context) ([]image.Signature, error) {
+		layers, err := fetchProvenanceLayers(ctx, ref, registryOptions, signatureTagSuffix, image.IsSignatureMediaType, digests...)
+		if err != nil {
+			return nil, err
+		}
+		var signatures []image.Signature
+		for _, layer := range layers {
+			signature := image.NewSignature(string(layer.descriptor.MediaType), layer.content, layer.descriptor.Annotations)
+			signature.Digest = layer.descriptor.Digest.String()
+			signature.ArtifactDigest = layer.artifact.DigestStr()
+			signatures = append(signatures, signature)
+		}
+		return signatures, nil
+	}
+}
+
+// newAttestationFetcher returns an image.AttestationFetcher that discovers in-toto attestations for the given manifest
+// digests, both from the cosign tag convention and from referrer artifacts (see listReferrers).
+func newAttestationFetcher(ref name.Reference, registryOptions image.RegistryOptions, digests ...containerregistryV1.Hash) image.AttestationFetcher {
+	return func(ctx context.Context) ([]image.Attestation, error) {
+		layers, err := fetchProvenanceLayers(ctx, ref, registryOptions, attestationTagSuffix, image.IsAttestationMediaType, digests...)
+		if err != nil {
+			return nil, err
+		}
+		var attestations []image.Attestation
+		for _, layer := range layers {
+			attestation := image.NewAttestation(string(layer.descriptor.MediaType), layer.content, layer.descriptor.Annotations)
+			attestation.Digest = layer.descriptor.Digest.String()
+			attestation.ArtifactDigest = layer.artifact.DigestStr()
+			attestations = append(attestations, attestation)
+		}
+		return attestations, nil
+	}
+}
+
+// fetchProvenanceLayers returns all layers with an accepted media type from all artifacts attached to any of the given
+// subject digests (each artifact is only considered once, even if it is both tagged and listed as a referrer).
+func fetchProvenanceLayers(ctx context.Context, ref name.Reference, registryOptions image.RegistryOptions, tagSuffix string, accept func(string) bool, digests ...containerregistryV1.Hash) ([]provenanceLayer, error) {
+	client, err := newRegistryClient(ctx, ref, registryOptions)
+	if err != nil {
+		return nil, err
+	}
+	options, err := prepareRemoteOptions(ctx, ref, registryOptions, nil)
+	if err != nil {
+		return nil, err
+	}
+	repo := ref.Context()
+
+	var layers []provenanceLayer
+	seenSubjects := make(map[containerregistryV1.Hash]struct{})
+	seenArtifacts := make(map[containerregistryV1.Hash]struct{})
+	for _, subject := range digests {
+		if _, ok := seenSubjects[subject]; ok {
+			continue
+		}
+		seenSubjects[subject] = struct{}{}
+
+		artifacts, err := provenanceArtifacts(ctx, client, repo, subject, tagSuffix, options...)
+		if err != nil {
+			return nil, err
+		}
+		for _, artifact := range artifacts {
+			if _, ok := seenArtifacts[artifact]; ok {
+				continue
+			}
+			seenArtifacts[artifact] = struct{}{}
+
+			found, err := fetchArtifactProvenanceLayers(repo.Digest(artifact.String()), subject, accept, options...)
+			if err != nil {
+				log.Warnf("unable to fetch provenance from artifact=%q: %+v", artifact, err)
+				continue
+			}
+			layers = append(layers, found...)
+		}
+	}
+	return layers, nil
+}
+
+// provenanceArtifacts returns the digests of the artifact tagged with the cosign convention for the given subject and
+// all referrer artifacts of the subject.
+func provenanceArtifacts(ctx context.Context, client *http.Client, repo name.Repository, subject containerregistryV1.Hash, tagSuffix string, options ...remote.Option) ([]containerregistryV1.Hash, error) {
+	var artifacts []containerregistryV1.Hash
+
+	desc, err := remote.Head(cosignTag(repo, subject, tagSuffix), options...)
+	switch {
+	case err == nil:
+		artifacts = append(artifacts, desc.Digest)
+	case !isNotFound(err):
+		return nil, fmt.Errorf("unable to fetch %q artifact for digest=%q: %w", tagSuffix, subject, err)
+	}
+
+	referrers, err := listReferrers(ctx, client, repo, subject, "", options...)
+	if err != nil {
+		return nil, err
+	}
+	for _, referrer := range referrers {
+		artifacts = append(artifacts, referrer.Digest)
+	}
+	return artifacts, nil
+}
+
+func fetchArtifactProvenanceLayers(ref name.Digest, subject containerregistryV1.Hash, accept func(string) bool, options ...remote.Option) ([]provenanceLayer, error) {
+	artifact, err := remote.Image(ref, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	rawManifest, err := artifact.RawManifest()
+	if err != nil {
+		return nil, err
+	}
+	var relationship referrerManifest
+	if err := json.Unmarshal(rawManifest, &relationship); err != nil {
+		return nil, fmt.Errorf("unable to parse artifact manifest: %w", err)
+	}
+	if relationship.Subject != nil && relationship.Subject.Digest != subject {
+		log.Debugf("skipping artifact=%q with unrelated subject=%q", ref.DigestStr(), relationship.Subject.Digest)
+		return nil, nil
+	}
+
+	manifest, err := artifact.Manifest()
+	if err != nil {
+		return nil, err
+	}
+
+	var layers []provenanceLayer
+	for _, desc := range manifest.Layers {
+		if !accept(string(desc.MediaType)) {
+			continue
+		}
+		layer, err := artifact.LayerByDigest(desc.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("unable to find blob=%q: %w", desc.Digest, err)
+		}
+		reader, err := layer.Compressed()
+		if err != nil {
+			return nil, fmt.Errorf("unable to fetch blob=%q: %w", desc.Digest, err)
+		}
+		content, err := ioutil.ReadAll(reader)
+		_ = reader.Close()
+		if err != nil {
+			return nil, fmt.Errorf("unable to read blob=%q: %w", desc.Digest, err)
+		}
+		layers = append(layers, provenanceLayer{
+			artifact:   ref,
+			descriptor: desc,
+			content:    content,
+		})
+	}
+	return layers, nil
+}
@@ -0,0 +1,126 @@
+package oci
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+)
+
+func newProvenanceArtifact(t *testing.T, content string, mediaType types.MediaType, annotations map[string]string) v1.Image {
+	t.Helper()
+	artifact := mutate.MediaType(empty.Image, types.OCIManifestSchema1)
+	artifact, err := mutate.Append(artifact, mutate.Addendum{
+		Layer:       &blobLayer{content: []byte(content), mediaType: mediaType},
+		MediaType:   mediaType,
+		Annotations: annotations,
+	})
+	require.NoError(t, err)
+	return artifact
+}
+
+func Test_RegistrySignaturesAndAttestations(t *testing.T) {
+	host := newTestRegistry(t)
+	imageStr := host + "/anchore/example:latest"
+	ref, err := name.ParseReference(imageStr)
+	require.NoError(t, err)
+
+	img, err := random.Image(64, 1)
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(ref, img))
+	digest, err := img.Digest()
+	require.NoError(t, err)
+	subject := v1.Descriptor{MediaType: types.DockerManifestSchema2, Digest: digest}
+
+	// a cosign signature (tag convention)
+	payload := fmt.Sprintf(`{"critical":{"image":{"docker-manifest-digest":%q}}}`, digest)
+	signature := newProvenanceArtifact(t, payload, image.CosignSignatureMediaType, map[string]string{
+		"dev.cosignproject.cosign/signature": "c2lnbmF0dXJl",
+		"dev.sigstore.cosign/certificate":    "-----BEGIN CERTIFICATE-----",
+	})
+	require.NoError(t, remote.Write(cosignTag(ref.Context(), digest, signatureTagSuffix), signature))
+
+	// a cosign attestation (tag convention)
+	statement := fmt.Sprintf(`{"_type":"https://in-toto.io/Statement/v0.1","predicateType":"https://slsa.dev/provenance/v0.2","subject":[{"name":"example","digest":{"sha256":%q}}],"predicate":{"builder":{"id":"ci"}}}`, digest.Hex)
+	envelope := fmt.Sprintf(`{"payloadType":"application/vnd.in-toto+json","payload":%q,"signatures":[]}`, base64.StdEncoding.EncodeToString([]byte(statement)))
+	attestation := newProvenanceArtifact(t, envelope, image.DSSEEnvelopeMediaType, map[string]string{
+		"predicateType": "https://slsa.dev/provenance/v0.2",
+	})
+	require.NoError(t, remote.Write(cosignTag(ref.Context(), digest, attestationTagSuffix), attestation))
+
+	// an unsigned attestation referrer (tagged the same as well, which should only be reported once)
+	referrer := &subjectArtifact{
+		Image: newProvenanceArtifact(t, `{"_type":"https://in-toto.io/Statement/v0.1","predicateType":"https://spdx.dev/Document"}`, image.InTotoMediaType, map[string]string{
+			"in-toto.io/predicate-type": "https://spdx.dev/Document",
+		}),
+		subject: subject,
+	}
+	pushReferrers(t, ref.Context(), subject, referrer, attestation)
+
+	provider := NewProviderFromRegistry(imageStr, file.NewTempDirGenerator("test"), image.RegistryOptions{InsecureUseHTTP: true}, nil)
+	result, err := provider.Provide(context.Background())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = result.Cleanup() })
+	require.NoError(t, result.Read())
+
+	signatures, err := result.Signatures(context.Background())
+	require.NoError(t, err)
+	require.Len(t, signatures, 1)
+	signatureDigest, err := signature.Digest()
+	require.NoError(t, err)
+	assert.Equal(t, signatureDigest.String(), signatures[0].ArtifactDigest)
+	assert.Equal(t, payload, string(signatures[0].Payload))
+	assert.Equal(t, "c2lnbmF0dXJl", signatures[0].Signature)
+	assert.Equal(t, "-----BEGIN CERTIFICATE-----", signatures[0].Certificate)
+	assert.NotEmpty(t, signatures[0].Digest)
+
+	attestations, err := result.Attestations(context.Background())
+	require.NoError(t, err)
+	require.Len(t, attestations, 2)
+	assert.Equal(t, "https://slsa.dev/provenance/v0.2", attestations[0].PredicateType)
+	assert.Equal(t, image.DSSEEnvelopeMediaType, attestations[0].MediaType)
+	decoded, err := attestations[0].Statement()
+	require.NoError(t, err)
+	require.Len(t, decoded.Subject, 1)
+	assert.Equal(t, digest.Hex, decoded.Subject[0].Digest["sha256"])
+	assert.Equal(t, "https://spdx.dev/Document", attestations[1].PredicateType)
+	assert.Equal(t, image.InTotoMediaType, attestations[1].MediaType)
+}
+
+func Test_RegistrySignatures_Unsigned(t *testing.T) {
+	host := newTestRegistry(t)
+	imageStr := host + "/anchore/example:latest"
+	ref, err := name.ParseReference(imageStr)
+	require.NoError(t, err)
+
+	img, err := random.Image(64, 1)
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(ref, img))
+
+	provider := NewProviderFromRegistry(imageStr, file.NewTempDirGenerator("test"), image.RegistryOptions{InsecureUseHTTP: true}, nil)
+	result, err := provider.Provide(context.Background())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = result.Cleanup() })
+	require.NoError(t, result.Read())
+
+	signatures, err := result.Signatures(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, signatures)
+
+	attestations, err := result.Attestations(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, attestations)
+}
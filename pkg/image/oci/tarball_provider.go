@@ -13,13 +13,21 @@ import (
 type TarballImageProvider struct {
 	path      string
 	tmpDirGen *file.TempDirGenerator
+	platform  *image.Platform
 }
 
 // NewProviderFromTarball creates a new provider instance for the specific image tarball already at the given path.
 func NewProviderFromTarball(path string, tmpDirGen *file.TempDirGenerator) *TarballImageProvider {
+	return NewProviderFromTarballWithPlatform(path, tmpDirGen, nil)
+}
+
+// NewProviderFromTarballWithPlatform creates a new provider instance for the specific image tarball already at the given
+// path. If a platform is given then the matching image is selected from a multi-platform index.
+func NewProviderFromTarballWithPlatform(path string, tmpDirGen *file.TempDirGenerator, platform *image.Platform) *TarballImageProvider {
 	return &TarballImageProvider{
 		path:      path,
 		tmpDirGen: tmpDirGen,
+		platform:  platform,
 	}
 }
 
@@ -41,5 +49,5 @@ func (p *TarballImageProvider) Provide(ctx context.Context, metadata ...image.Ad
 		return nil, err
 	}
 
-	return NewProviderFromPath(tempDir, p.tmpDirGen).Provide(ctx, metadata...)
+	return NewProviderFromPathWithPlatform(tempDir, p.tmpDirGen, p.platform).Provide(ctx, metadata...)
 }
@@ -0,0 +1,62 @@
+package image
+
+import (
+	"fmt"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+)
+
+const (
+	// ociRefNameAnnotation is the OCI image layout annotation for the reference name (tag) of a manifest.
+	ociRefNameAnnotation = "org.opencontainers.image.ref.name"
+	// containerdImageNameAnnotation is the (widely used) annotation for the fully qualified image name of a manifest.
+	containerdImageNameAnnotation = "io.containerd.image.name"
+)
+
+// WriteOCILayout exports the image manifest, config, and layer blobs to an OCI image layout at the given directory.
+// If the directory already contains an OCI image layout, the image is appended to the existing index, otherwise a new
+// layout is created. A manifest entry is added to the index for each image tag.
+func (i *Image) WriteOCILayout(dir string) error {
+	if err := i.requireImageContent(); err != nil {
+		return fmt.Errorf("unable to write image: %w", err)
+	}
+
+	layoutPath, err := layout.FromPath(dir)
+	if err != nil {
+		layoutPath, err = layout.Write(dir, empty.Index)
+		if err != nil {
+			return fmt.Errorf("unable to create OCI layout dir=%q: %w", dir, err)
+		}
+	}
+
+	var options []layout.Option
+	if i.Metadata.OS != "" && i.Metadata.Architecture != "" {
+		options = append(options, layout.WithPlatform(v1.Platform{
+			OS:           i.Metadata.OS,
+			Architecture: i.Metadata.Architecture,
+			Variant:      i.Metadata.Variant,
+		}))
+	}
+
+	if len(i.Metadata.Tags) == 0 {
+		if err := layoutPath.AppendImage(i.image, options...); err != nil {
+			return fmt.Errorf("unable to write image to OCI layout dir=%q: %w", dir, err)
+		}
+		return nil
+	}
+
+	for _, tag := range i.Metadata.Tags {
+		tagOptions := append([]layout.Option{
+			layout.WithAnnotations(map[string]string{
+				ociRefNameAnnotation:          tag.TagStr(),
+				containerdImageNameAnnotation: tag.Name(),
+			}),
+		}, options...)
+		if err := layoutPath.AppendImage(i.image, tagOptions...); err != nil {
+			return fmt.Errorf("unable to write image tag=%q to OCI layout dir=%q: %w", tag.Name(), dir, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package image
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImage_WriteOCILayout(t *testing.T) {
+	randomImage, err := random.Image(64, 2)
+	require.NoError(t, err)
+
+	img := NewImage(randomImage, t.TempDir(), WithTags("anchore/example:1.0", "anchore/example:latest"), WithOS("linux"), WithArchitecture("amd64", ""))
+	require.NoError(t, img.Read())
+
+	dir := filepath.Join(t.TempDir(), "layout")
+	require.NoError(t, img.WriteOCILayout(dir))
+
+	assert.FileExists(t, filepath.Join(dir, "oci-layout"))
+	assert.FileExists(t, filepath.Join(dir, "index.json"))
+
+	index, err := layout.ImageIndexFromPath(dir)
+	require.NoError(t, err)
+	indexManifest, err := index.IndexManifest()
+	require.NoError(t, err)
+
+	expectedDigest, err := randomImage.Digest()
+	require.NoError(t, err)
+
+	var refNames []string
+	for _, desc := range indexManifest.Manifests {
+		assert.Equal(t, expectedDigest, desc.Digest)
+		require.NotNil(t, desc.Platform)
+		assert.Equal(t, "linux", desc.Platform.OS)
+		assert.Equal(t, "amd64", desc.Platform.Architecture)
+		refNames = append(refNames, desc.Annotations[ociRefNameAnnotation])
+	}
+	assert.ElementsMatch(t, []string{"1.0", "latest"}, refNames)
+
+	// the written layout should be readable with the same content
+	written, err := index.Image(expectedDigest)
+	require.NoError(t, err)
+	roundTrip := NewImage(written, t.TempDir())
+	require.NoError(t, roundTrip.Read())
+	assert.Equal(t, img.Metadata.ID, roundTrip.Metadata.ID)
+	assert.True(t, img.SquashedTree().Equal(roundTrip.SquashedTree()))
+
+	// writing to an existing layout appends to the index
+	other, err := random.Image(64, 1)
+	require.NoError(t, err)
+	otherImg := NewImage(other, t.TempDir())
+	require.NoError(t, otherImg.Read())
+	require.NoError(t, otherImg.WriteOCILayout(dir))
+
+	index, err = layout.ImageIndexFromPath(dir)
+	require.NoError(t, err)
+	indexManifest, err = index.IndexManifest()
+	require.NoError(t, err)
+	assert.Len(t, indexManifest.Manifests, 3)
+}
+
+func TestImage_WriteOCILayout_NoContent(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "layout")
+	img := &Image{}
+	assert.Error(t, img.WriteOCILayout(dir))
+	_, statErr := os.Stat(dir)
+	assert.True(t, os.IsNotExist(statErr))
+}
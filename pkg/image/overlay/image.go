@@ -0,0 +1,101 @@
+package overlay
+
+import (
+	"bytes"
+	"fmt"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// diffDirImage is an image with layers backed by overlay layer directories (see NewImage).
+type diffDirImage struct {
+	rawConfig []byte
+	layers    map[v1.Hash]*diffDirLayer
+}
+
+// NewImage returns an image with the given (raw) image config and the overlay layer directory for each layer, ordered
+// the same as the diff IDs within the image config (lowest layer first). No manifest is associated with the image,
+// so one is generated on demand (which requires compressing every layer).
+func NewImage(rawConfig []byte, layerDirs []string) (v1.Image, error) {
+	config, err := v1.ParseConfigFile(bytes.NewReader(rawConfig))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse image config: %w", err)
+	}
+	diffIDs := config.RootFS.DiffIDs
+	if len(diffIDs) != len(layerDirs) {
+		return nil, fmt.Errorf("image config describes %d layers, however, %d layer directories were given", len(diffIDs), len(layerDirs))
+	}
+
+	img := &diffDirImage{
+		rawConfig: rawConfig,
+		layers:    make(map[v1.Hash]*diffDirLayer),
+	}
+	for idx, diffID := range diffIDs {
+		if _, ok := img.layers[diffID]; ok {
+			// a repeated layer has the same content as the first reference
+			continue
+		}
+		img.layers[diffID] = &diffDirLayer{dir: layerDirs[idx], diffID: diffID}
+	}
+	base, err := partial.UncompressedToImage(img)
+	if err != nil {
+		return nil, err
+	}
+	return &reconstructedImage{Image: base, layers: img.layers}, nil
+}
+
+func (i *diffDirImage) RawConfigFile() ([]byte, error) {
+	return i.rawConfig, nil
+}
+
+func (i *diffDirImage) MediaType() (types.MediaType, error) {
+	return types.DockerManifestSchema2, nil
+}
+
+func (i *diffDirImage) LayerByDiffID(h v1.Hash) (partial.UncompressedLayer, error) {
+	layer, ok := i.layers[h]
+	if !ok {
+		return nil, fmt.Errorf("no layer directory for diff ID=%q", h)
+	}
+	return layer, nil
+}
+
+// reconstructedImage provides the layers of an image as reconstructed layers (see image.ReconstructedLayer).
+type reconstructedImage struct {
+	v1.Image
+	layers map[v1.Hash]*diffDirLayer
+}
+
+func (i *reconstructedImage) Layers() ([]v1.Layer, error) {
+	config, err := i.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	layers := make([]v1.Layer, 0, len(config.RootFS.DiffIDs))
+	for _, diffID := range config.RootFS.DiffIDs {
+		layer, err := i.LayerByDiffID(diffID)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, layer)
+	}
+	return layers, nil
+}
+
+func (i *reconstructedImage) LayerByDiffID(h v1.Hash) (v1.Layer, error) {
+	layer, ok := i.layers[h]
+	if !ok {
+		return nil, fmt.Errorf("no layer directory for diff ID=%q", h)
+	}
+	return layer.layer()
+}
+
+func (i *reconstructedImage) LayerByDigest(h v1.Hash) (v1.Layer, error) {
+	diffID, err := partial.BlobToDiffID(i, h)
+	if err != nil {
+		return nil, err
+	}
+	return i.LayerByDiffID(diffID)
+}
@@ -0,0 +1,192 @@
+package overlay
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+)
+
+// basic interface assertions
+var _ image.ReconstructedLayer = (*reconstructedLayer)(nil)
+
+// opaqueXattrs are the extended attributes that mark a directory as opaque within an overlay layer directory
+// ("user." is used by rootless overlay mounts).
+var opaqueXattrs = []string{"trusted.overlay.opaque", "user.overlay.opaque"}
+
+// diffDirLayer is a layer backed by an (unpacked) overlay layer directory, such as the "diff" directory of an overlay2
+// layer within the docker data root or containers-storage.
+type diffDirLayer struct {
+	dir    string
+	diffID v1.Hash
+}
+
+// NewLayer returns a layer for the given overlay layer directory. The layer tar is generated from the directory every
+// time the content is read, with overlay whiteouts (0/0 character devices) and opaque directories (marked with the
+// "overlay.opaque" extended attribute) translated to the whiteout files described by the OCI image spec. The given
+// diff ID is the digest of the original layer tar (e.g. from the image config), which is not verified since the
+// generated tar is not byte-for-byte identical to the original (see image.ReconstructedLayer).
+func NewLayer(dir string, diffID v1.Hash) (v1.Layer, error) {
+	return (&diffDirLayer{dir: dir, diffID: diffID}).layer()
+}
+
+// reconstructedLayer marks the layer content as regenerated (see image.ReconstructedLayer).
+type reconstructedLayer struct {
+	v1.Layer
+}
+
+func (l reconstructedLayer) Reconstructed() bool {
+	return true
+}
+
+func (l *diffDirLayer) layer() (v1.Layer, error) {
+	layer, err := partial.UncompressedToLayer(l)
+	if err != nil {
+		return nil, err
+	}
+	return reconstructedLayer{Layer: layer}, nil
+}
+
+func (l *diffDirLayer) DiffID() (v1.Hash, error) {
+	return l.diffID, nil
+}
+
+func (l *diffDirLayer) MediaType() (types.MediaType, error) {
+	return types.DockerUncompressedLayer, nil
+}
+
+// Uncompressed streams the tar generated from the layer directory.
+func (l *diffDirLayer) Uncompressed() (io.ReadCloser, error) {
+	info, err := os.Stat(l.dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read overlay layer directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("overlay layer path=%q is not a directory", l.dir)
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		_ = writer.CloseWithError(writeDiffDirTar(l.dir, writer))
+	}()
+	return reader, nil
+}
+
+// writeDiffDirTar writes all entries within the given layer directory (in lexical order) as a tar to the given writer.
+func writeDiffDirTar(dir string, w io.Writer) error {
+	tw := tar.NewWriter(w)
+	// hardlinks are recorded as links to the first path seen for each inode
+	inodes := make(map[uint64]string)
+
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		name := filepath.ToSlash(rel)
+
+		if info.Mode()&os.ModeSocket != 0 {
+			// sockets cannot be represented within a tar (and are never part of an image)
+			return nil
+		}
+
+		if isWhiteout(info) {
+			parent, base := path.Split(name)
+			return tw.WriteHeader(&tar.Header{
+				Typeflag: tar.TypeReg,
+				Name:     parent + file.WhiteoutPrefix + base,
+				Mode:     0600,
+				ModTime:  info.ModTime(),
+			})
+		}
+
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return fmt.Errorf("unable to read link=%q: %w", p, err)
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return fmt.Errorf("unable to create tar header for %q: %w", p, err)
+		}
+		header.Name = name
+		// user and group names are looked up on the host (which is not where the layer came from)
+		header.Uname, header.Gname = "", ""
+		if info.IsDir() {
+			header.Name += "/"
+		}
+
+		if info.Mode().IsRegular() {
+			if ino, ok := inode(info); ok {
+				if original, ok := inodes[ino]; ok {
+					header.Typeflag = tar.TypeLink
+					header.Linkname = original
+					header.Size = 0
+					return tw.WriteHeader(header)
+				}
+				inodes[ino] = name
+			}
+		}
+
+		if err := tw.WriteHeader(header); err != nil {
+			return fmt.Errorf("unable to write tar header for %q: %w", p, err)
+		}
+
+		switch {
+		case info.IsDir() && isOpaque(p):
+			return tw.WriteHeader(&tar.Header{
+				Typeflag: tar.TypeReg,
+				Name:     strings.TrimSuffix(header.Name, "/") + "/" + file.OpaqueWhiteout,
+				Mode:     0600,
+				ModTime:  info.ModTime(),
+			})
+		case header.Typeflag == tar.TypeReg:
+			return copyFile(tw, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+func copyFile(w io.Writer, p string) error {
+	fh, err := os.Open(p)
+	if err != nil {
+		return fmt.Errorf("unable to open %q: %w", p, err)
+	}
+	defer fh.Close()
+
+	if _, err := io.Copy(w, fh); err != nil {
+		return fmt.Errorf("unable to copy %q: %w", p, err)
+	}
+	return nil
+}
+
+// isOpaque indicates if the given directory is marked as opaque (hiding all content from lower layers).
+func isOpaque(p string) bool {
+	for _, name := range opaqueXattrs {
+		if value, ok := getXattr(p, name); ok && string(value) == "y" {
+			return true
+		}
+	}
+	return false
+}
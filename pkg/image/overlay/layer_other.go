@@ -0,0 +1,21 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package overlay
+
+import "os"
+
+// isWhiteout is not supported on this platform (overlay layer directories only exist on unix hosts).
+func isWhiteout(os.FileInfo) bool {
+	return false
+}
+
+// inode is not supported on this platform.
+func inode(os.FileInfo) (uint64, bool) {
+	return 0, false
+}
+
+// getXattr is not supported on this platform.
+func getXattr(string, string) ([]byte, bool) {
+	return nil, false
+}
@@ -0,0 +1,93 @@
+//go:build linux
+// +build linux
+
+package overlay
+
+import (
+	"archive/tar"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+
+	"github.com/anchore/stereoscope/pkg/image"
+)
+
+func layerHeaders(t *testing.T, layer v1.Layer) map[string]*tar.Header {
+	t.Helper()
+	reader, err := layer.Uncompressed()
+	require.NoError(t, err)
+	defer reader.Close()
+
+	headers := make(map[string]*tar.Header)
+	tr := tar.NewReader(reader)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return headers
+		}
+		require.NoError(t, err)
+		headers[header.Name] = header
+	}
+}
+
+func TestNewLayer(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "etc", "app"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "etc", "app", "config"), []byte("contents"), 0644))
+	require.NoError(t, os.Symlink("app/config", filepath.Join(dir, "etc", "link")))
+	require.NoError(t, os.Link(filepath.Join(dir, "etc", "app", "config"), filepath.Join(dir, "etc", "z-hardlink")))
+
+	// whiteouts and opaque directories require privileges (or filesystem support) that may be missing
+	whiteouts := unix.Mknod(filepath.Join(dir, "etc", "deleted"), unix.S_IFCHR, 0) == nil
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "opaque"), 0755))
+	opaque := unix.Lsetxattr(filepath.Join(dir, "opaque"), "trusted.overlay.opaque", []byte("y"), 0) == nil
+
+	diffID, err := v1.NewHash("sha256:a1b2c3d4e5f60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8f90")
+	require.NoError(t, err)
+	layer, err := NewLayer(dir, diffID)
+	require.NoError(t, err)
+
+	assert.Implements(t, (*image.ReconstructedLayer)(nil), layer)
+
+	actualDiffID, err := layer.DiffID()
+	require.NoError(t, err)
+	assert.Equal(t, diffID, actualDiffID)
+
+	headers := layerHeaders(t, layer)
+	require.Contains(t, headers, "etc/")
+	assert.Equal(t, byte(tar.TypeDir), headers["etc/"].Typeflag)
+	require.Contains(t, headers, "etc/app/config")
+	assert.Equal(t, int64(len("contents")), headers["etc/app/config"].Size)
+	require.Contains(t, headers, "etc/link")
+	assert.Equal(t, "app/config", headers["etc/link"].Linkname)
+	require.Contains(t, headers, "etc/z-hardlink")
+	assert.Equal(t, byte(tar.TypeLink), headers["etc/z-hardlink"].Typeflag)
+	assert.Equal(t, "etc/app/config", headers["etc/z-hardlink"].Linkname)
+
+	if whiteouts {
+		assert.NotContains(t, headers, "etc/deleted")
+		require.Contains(t, headers, "etc/.wh.deleted")
+		assert.Equal(t, byte(tar.TypeReg), headers["etc/.wh.deleted"].Typeflag)
+	} else {
+		t.Log("unable to create overlay whiteouts, skipping whiteout assertions")
+	}
+	if opaque {
+		assert.Contains(t, headers, "opaque/.wh..wh..opq")
+	} else {
+		t.Log("unable to mark directories as opaque, skipping opaque directory assertions")
+	}
+}
+
+func TestNewLayer_MissingDirectory(t *testing.T) {
+	layer, err := NewLayer(filepath.Join(t.TempDir(), "missing"), v1.Hash{Algorithm: "sha256", Hex: "abc"})
+	require.NoError(t, err)
+	_, err = layer.Uncompressed()
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
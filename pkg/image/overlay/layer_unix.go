@@ -0,0 +1,39 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package overlay
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// isWhiteout indicates if the given file is an overlay whiteout (a character device with device number 0/0).
+func isWhiteout(info os.FileInfo) bool {
+	if info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	return ok && uint64(st.Rdev) == 0
+}
+
+// inode returns the inode of the given file when the file has multiple hardlinks.
+func inode(info os.FileInfo) (uint64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || uint64(st.Nlink) < 2 {
+		return 0, false
+	}
+	return uint64(st.Ino), true
+}
+
+// getXattr returns the value of a single extended attribute of the given path (without following symlinks).
+func getXattr(path, name string) ([]byte, bool) {
+	buf := make([]byte, 64)
+	n, err := unix.Lgetxattr(path, name, buf)
+	if err != nil || n > len(buf) {
+		return nil, false
+	}
+	return buf[:n], true
+}
@@ -0,0 +1,90 @@
+package image
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+)
+
+// ErrPlatformMismatch is returned when reading an image with WithStrictPlatform and the image config platform differs
+// from the expected platform.
+var ErrPlatformMismatch = errors.New("image platform does not match the expected platform")
+
+// PlatformMismatch describes an image whose config platform differs from the platform that was expected (either the
+// requested platform or the host platform, see WithExpectedPlatform).
+type PlatformMismatch struct {
+	Expected Platform `json:"expected"`
+	Actual   Platform `json:"actual"`
+}
+
+func (m PlatformMismatch) String() string {
+	return fmt.Sprintf("expected platform=%q but image platform is %q", m.Expected.String(), m.Actual.String())
+}
+
+// HostPlatform returns the platform images are expected to be for when no platform is requested: linux (or windows on
+// windows hosts) on the host CPU architecture, which is what container engines select by default.
+func HostPlatform() Platform {
+	os := "linux"
+	if runtime.GOOS == "windows" {
+		os = runtime.GOOS
+	}
+	arch, variant := normalizeArch(runtime.GOARCH, "")
+	return Platform{OS: os, Architecture: arch, Variant: variant}
+}
+
+// imagePlatform returns the platform of the image, preferring any platform metadata provided by the image source over
+// the image config.
+func (i *Image) imagePlatform() Platform {
+	p := Platform{
+		OS:           i.Metadata.OS,
+		Architecture: i.Metadata.Architecture,
+		Variant:      i.Metadata.Variant,
+	}
+	if p.OS == "" {
+		p.OS = i.Metadata.Config.OS
+	}
+	if p.Architecture == "" {
+		p.Architecture = i.Metadata.Config.Architecture
+	}
+	return p
+}
+
+// checkPlatform records (or fails the read with, when strict) any mismatch between the image platform and the
+// expected platform.
+func (i *Image) checkPlatform(cfg readConfig) error {
+	i.Metadata.PlatformMismatch = nil
+
+	expected := HostPlatform()
+	if cfg.expectedPlatform != nil {
+		expected = *cfg.expectedPlatform
+	}
+	actual := i.imagePlatform()
+	if platformMatches(expected, actual) {
+		return nil
+	}
+
+	mismatch := PlatformMismatch{Expected: expected, Actual: actual}
+	if cfg.strictPlatform {
+		return fmt.Errorf("%w: %s", ErrPlatformMismatch, mismatch)
+	}
+	i.Metadata.PlatformMismatch = &mismatch
+	i.warn(WarningPlatformMismatch, -1, "%s", mismatch)
+	return nil
+}
+
+// platformMatches indicates if the actual platform satisfies the expected platform. Only fields present on both
+// platforms are compared (images without platform information match any platform).
+func platformMatches(expected, actual Platform) bool {
+	if expected.OS != "" && actual.OS != "" && normalizeOS(expected.OS) != normalizeOS(actual.OS) {
+		return false
+	}
+	if expected.Architecture == "" || actual.Architecture == "" {
+		return true
+	}
+	expectedArch, expectedVariant := normalizeArch(expected.Architecture, expected.Variant)
+	actualArch, actualVariant := normalizeArch(actual.Architecture, actual.Variant)
+	if expectedArch != actualArch {
+		return false
+	}
+	return expectedVariant == "" || actualVariant == "" || expectedVariant == actualVariant
+}
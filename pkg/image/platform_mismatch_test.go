@@ -0,0 +1,138 @@
+package image
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestPlatformImage returns an unread image with the given platform within the image config.
+func newTestPlatformImage(t *testing.T, os, arch string, metadata ...AdditionalMetadata) *Image {
+	t.Helper()
+	v1Image := newTestV1Image(t, newTestTarLayer(t, testTarEntry{name: "etc/hello.txt", contents: "hello"}))
+	cfg, err := v1Image.ConfigFile()
+	require.NoError(t, err)
+	cfg.OS = os
+	cfg.Architecture = arch
+	v1Image, err = mutate.ConfigFile(v1Image, cfg)
+	require.NoError(t, err)
+	return NewImage(v1Image, t.TempDir(), metadata...)
+}
+
+func TestImage_PlatformMismatch(t *testing.T) {
+	host := HostPlatform()
+	otherArch := "arm64"
+	if host.Architecture == otherArch {
+		otherArch = "amd64"
+	}
+
+	tests := []struct {
+		name         string
+		img          *Image
+		options      []ReadOption
+		wantMismatch *PlatformMismatch
+		wantErr      bool
+	}{
+		{
+			name: "matches the host platform",
+			img:  newTestPlatformImage(t, host.OS, host.Architecture),
+		},
+		{
+			name:         "differs from the host platform",
+			img:          newTestPlatformImage(t, "linux", otherArch),
+			wantMismatch: &PlatformMismatch{Expected: host, Actual: Platform{OS: "linux", Architecture: otherArch}},
+		},
+		{
+			name:    "matches the expected platform",
+			img:     newTestPlatformImage(t, "linux", otherArch),
+			options: []ReadOption{WithExpectedPlatform(Platform{OS: "linux", Architecture: otherArch})},
+		},
+		{
+			name:    "expected platform without an OS",
+			img:     newTestPlatformImage(t, "windows", "amd64"),
+			options: []ReadOption{WithExpectedPlatform(Platform{Architecture: "x86_64"})},
+		},
+		{
+			name:    "differs from the expected platform",
+			img:     newTestPlatformImage(t, "linux", "amd64"),
+			options: []ReadOption{WithExpectedPlatform(Platform{OS: "linux", Architecture: "arm", Variant: "v7"})},
+			wantMismatch: &PlatformMismatch{
+				Expected: Platform{OS: "linux", Architecture: "arm", Variant: "v7"},
+				Actual:   Platform{OS: "linux", Architecture: "amd64"},
+			},
+		},
+		{
+			name:    "source metadata is preferred over the image config",
+			img:     newTestPlatformImage(t, "linux", "amd64", WithArchitecture("arm64", "")),
+			options: []ReadOption{WithExpectedPlatform(Platform{OS: "linux", Architecture: "amd64"})},
+			wantMismatch: &PlatformMismatch{
+				Expected: Platform{OS: "linux", Architecture: "amd64"},
+				Actual:   Platform{OS: "linux", Architecture: "arm64"},
+			},
+		},
+		{
+			name:    "strict mismatch",
+			img:     newTestPlatformImage(t, "linux", otherArch),
+			options: []ReadOption{WithStrictPlatform()},
+			wantErr: true,
+		},
+		{
+			name:    "strict match",
+			img:     newTestPlatformImage(t, host.OS, host.Architecture),
+			options: []ReadOption{WithStrictPlatform()},
+		},
+		{
+			name:    "no platform in the image config",
+			img:     newTestPlatformImage(t, "", ""),
+			options: []ReadOption{WithStrictPlatform()},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.img.Read(test.options...)
+			if test.wantErr {
+				require.Error(t, err)
+				assert.True(t, errors.Is(err, ErrPlatformMismatch))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.wantMismatch, test.img.Metadata.PlatformMismatch)
+
+			var warnings []Warning
+			for _, w := range test.img.Warnings() {
+				if w.Kind == WarningPlatformMismatch {
+					warnings = append(warnings, w)
+				}
+			}
+			if test.wantMismatch == nil {
+				assert.Empty(t, warnings)
+			} else {
+				require.Len(t, warnings, 1)
+				assert.Equal(t, test.wantMismatch.String(), warnings[0].Message)
+			}
+		})
+	}
+}
+
+func TestPlatformMatches(t *testing.T) {
+	tests := []struct {
+		expected Platform
+		actual   Platform
+		want     bool
+	}{
+		{expected: Platform{OS: "linux", Architecture: "amd64"}, actual: Platform{OS: "linux", Architecture: "x86_64"}, want: true},
+		{expected: Platform{OS: "linux", Architecture: "arm64"}, actual: Platform{OS: "linux", Architecture: "aarch64", Variant: "v8"}, want: true},
+		{expected: Platform{OS: "linux", Architecture: "arm"}, actual: Platform{OS: "linux", Architecture: "arm", Variant: "v6"}, want: false},
+		{expected: Platform{OS: "linux", Architecture: "arm", Variant: "v6"}, actual: Platform{OS: "linux", Architecture: "armel"}, want: true},
+		{expected: Platform{OS: "linux"}, actual: Platform{OS: "windows", Architecture: "amd64"}, want: false},
+		{expected: Platform{OS: "linux", Architecture: "amd64"}, actual: Platform{}, want: true},
+	}
+	for _, test := range tests {
+		t.Run(test.expected.String()+"_"+test.actual.String(), func(t *testing.T) {
+			assert.Equal(t, test.want, platformMatches(test.expected, test.actual))
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package image
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+// ErrReadBudgetExceeded is returned when a read is denied by a ReadAuditLog since the byte budget for the caller tag
+// has been spent.
+var ErrReadBudgetExceeded = errors.New("read budget exceeded")
+
+// ReadAuditRecord describes a single read of file contents performed through the file catalog.
+type ReadAuditRecord struct {
+	// Path is the real path of the file that was read
+	Path file.Path
+	// Layer is the layer containing the file that was read
+	Layer LayerMetadata
+	// Bytes is the number of content bytes read (always zero when the read begins)
+	Bytes int64
+	// Tag is the caller tag given to WithReadAudit
+	Tag string
+	// Err is the first error (other than io.EOF) encountered while reading
+	Err error
+}
+
+// ReadAuditor is notified of every read of file contents performed through the file catalog of an image (see
+// WithReadAudit), including reads made through any of the image and layer helpers (FileContentsByRef, the fs.FS and
+// afero views, flattening, etc). This allows embedding services to account for (and limit) data access per analysis
+// job. Both methods may be called concurrently.
+type ReadAuditor interface {
+	// BeginRead is called before the contents are opened. Returning an error denies the read (the error is returned
+	// to the caller, wrapped, instead of a reader).
+	BeginRead(record ReadAuditRecord) error
+	// EndRead is called once the reader is closed, with the number of bytes read.
+	EndRead(record ReadAuditRecord)
+}
+
+// readAudit is the auditor and caller tag applied to every read from a file catalog.
+type readAudit struct {
+	auditor ReadAuditor
+	tag     string
+}
+
+// open audits the read of the given entry, returning a reader that reports the read to the auditor on close.
+func (a *readAudit) open(ref file.Reference, layer *Layer, opener file.Opener) (io.ReadCloser, error) {
+	record := ReadAuditRecord{
+		Path: ref.RealPath,
+		Tag:  a.tag,
+	}
+	if layer != nil {
+		record.Layer = layer.Metadata
+	}
+	if err := a.auditor.BeginRead(record); err != nil {
+		return nil, fmt.Errorf("read of path=%q denied: %w", ref.RealPath, err)
+	}
+	return &auditedReadCloser{
+		ReadCloser: opener(),
+		auditor:    a.auditor,
+		record:     record,
+	}, nil
+}
+
+// auditedReadCloser counts the bytes read, reporting the completed read once closed.
+type auditedReadCloser struct {
+	io.ReadCloser
+	auditor ReadAuditor
+	record  ReadAuditRecord
+	closed  bool
+}
+
+func (r *auditedReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.record.Bytes += int64(n)
+	if err != nil && err != io.EOF && r.record.Err == nil {
+		r.record.Err = err
+	}
+	return n, err
+}
+
+func (r *auditedReadCloser) Close() error {
+	err := r.ReadCloser.Close()
+	if !r.closed {
+		r.closed = true
+		r.auditor.EndRead(r.record)
+	}
+	return err
+}
+
+// ReadAuditLog is a ReadAuditor that keeps every completed read along with the number of bytes read per caller tag,
+// optionally denying new reads for a tag once MaxBytesPerTag bytes have been read for that tag. Note that reads which
+// already began may complete beyond the budget.
+type ReadAuditLog struct {
+	// MaxBytesPerTag is the number of bytes that may be read for each caller tag (unlimited when zero)
+	MaxBytesPerTag int64
+
+	lock    sync.Mutex
+	records []ReadAuditRecord
+	totals  map[string]int64
+}
+
+// NewReadAuditLog returns an empty audit log with the given byte budget per caller tag (unlimited when zero).
+func NewReadAuditLog(maxBytesPerTag int64) *ReadAuditLog {
+	return &ReadAuditLog{
+		MaxBytesPerTag: maxBytesPerTag,
+		totals:         make(map[string]int64),
+	}
+}
+
+// BeginRead denies the read when the budget of the caller tag has been spent.
+func (l *ReadAuditLog) BeginRead(record ReadAuditRecord) error {
+	if l.MaxBytesPerTag <= 0 {
+		return nil
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if total := l.totals[record.Tag]; total >= l.MaxBytesPerTag {
+		return fmt.Errorf("%w: tag=%q has read %d of %d bytes", ErrReadBudgetExceeded, record.Tag, total, l.MaxBytesPerTag)
+	}
+	return nil
+}
+
+// EndRead records the completed read.
+func (l *ReadAuditLog) EndRead(record ReadAuditRecord) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.totals == nil {
+		l.totals = make(map[string]int64)
+	}
+	l.records = append(l.records, record)
+	l.totals[record.Tag] += record.Bytes
+}
+
+// Records returns every completed read (in the order completed).
+func (l *ReadAuditLog) Records() []ReadAuditRecord {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return append([]ReadAuditRecord(nil), l.records...)
+}
+
+// BytesRead returns the number of bytes read for the given caller tag.
+func (l *ReadAuditLog) BytesRead(tag string) int64 {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.totals[tag]
+}
@@ -0,0 +1,72 @@
+package image
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+func TestImage_Read_WithReadAudit(t *testing.T) {
+	v1Image, err := mutate.AppendLayers(empty.Image,
+		newTestTarLayer(t, testTarEntry{name: "etc/base", contents: "base contents"}),
+		newTestTarLayer(t, testTarEntry{name: "etc/top", contents: "top"}),
+	)
+	require.NoError(t, err)
+
+	log := NewReadAuditLog(16)
+	img := NewImage(v1Image, t.TempDir())
+	require.NoError(t, img.Read(WithReadAudit(log, "job-1")))
+
+	read := func(p string) error {
+		reader, err := img.FileContentsFromSquash(file.Path(p))
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		_, err = ioutil.ReadAll(reader)
+		return err
+	}
+
+	require.NoError(t, read("/etc/base"))
+	require.NoError(t, read("/etc/top"))
+
+	records := log.Records()
+	require.Len(t, records, 2)
+	assert.Equal(t, file.Path("/etc/base"), records[0].Path)
+	assert.Equal(t, int64(len("base contents")), records[0].Bytes)
+	assert.Equal(t, uint(0), records[0].Layer.Index)
+	assert.Equal(t, "job-1", records[0].Tag)
+	assert.NoError(t, records[0].Err)
+	assert.Equal(t, file.Path("/etc/top"), records[1].Path)
+	assert.Equal(t, uint(1), records[1].Layer.Index)
+	assert.Equal(t, int64(16), log.BytesRead("job-1"))
+
+	// the budget for the tag has been spent
+	err = read("/etc/top")
+	assert.True(t, errors.Is(err, ErrReadBudgetExceeded))
+	assert.Len(t, log.Records(), 2)
+
+	// views of the image are audited the same
+	view, err := img.WithLayers(0)
+	require.NoError(t, err)
+	_, err = view.FileContentsFromSquash("/etc/base")
+	assert.True(t, errors.Is(err, ErrReadBudgetExceeded))
+}
+
+func TestImage_Read_WithoutReadAudit(t *testing.T) {
+	img := newTestImageFromLayers(t, []v1.Layer{newTestTarLayer(t, testTarEntry{name: "etc/base", contents: "base contents"})})
+
+	reader, err := img.FileContentsFromSquash("/etc/base")
+	require.NoError(t, err)
+	defer reader.Close()
+	_, ok := reader.(*auditedReadCloser)
+	assert.False(t, ok)
+}
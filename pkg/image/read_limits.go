@@ -0,0 +1,187 @@
+package image
+
+import (
+	"archive/tar"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/file/tarutil"
+)
+
+// ReadLimits are upper bounds enforced while reading an image (see WithReadLimits), intended for reading untrusted
+// images (e.g. user uploads within a multi-tenant service) where a crafted image should not be able to exhaust memory
+// or disk. A zero value for any limit disables that limit. The tar limits apply to each layer individually.
+type ReadLimits struct {
+	// TarLimits are the limits on the entries of each layer tar
+	TarLimits tarutil.Limits
+	// MaxLayers is the maximum number of layers that are read (layers above the limit are marked as unavailable)
+	MaxLayers int
+	// MaxPathLength is the maximum length in bytes of an entry path
+	MaxPathLength int
+	// MaxPathDepth is the maximum number of path elements of an entry path
+	MaxPathDepth int
+	// MaxNameLength is the maximum length in bytes of a single path element
+	MaxNameLength int
+	// MaxLinkLength is the maximum length in bytes of a symlink or hardlink target
+	MaxLinkLength int
+	// MaxXattrSize is the maximum combined size in bytes of all extended attribute names and values of an entry
+	MaxXattrSize int
+}
+
+// HardenedReadLimits returns limits suitable for reading untrusted images: generous enough for real-world images while
+// bounding the resources any single image may consume.
+func HardenedReadLimits() ReadLimits {
+	return ReadLimits{
+		TarLimits: tarutil.Limits{
+			MaxEntries:   1 << 20,
+			MaxEntrySize: 8 << 30,
+			MaxTotalSize: 32 << 30,
+		},
+		MaxLayers:     256,
+		MaxPathLength: 4096,
+		MaxPathDepth:  256,
+		MaxNameLength: 255,
+		MaxLinkLength: 4096,
+		MaxXattrSize:  64 << 10,
+	}
+}
+
+// LimitKind describes which read limit was violated.
+type LimitKind string
+
+// Each limit kind corresponds to a ReadLimits field, except for LimitInvalidName (entry paths that are not valid UTF-8
+// or contain NUL bytes), which is always enforced when read limits are configured.
+const (
+	LimitLayers      LimitKind = "layers"
+	LimitEntries     LimitKind = "entries"
+	LimitEntrySize   LimitKind = "entry-size"
+	LimitTotalSize   LimitKind = "total-size"
+	LimitPathLength  LimitKind = "path-length"
+	LimitPathDepth   LimitKind = "path-depth"
+	LimitNameLength  LimitKind = "name-length"
+	LimitLinkLength  LimitKind = "link-length"
+	LimitXattrSize   LimitKind = "xattr-size"
+	LimitInvalidName LimitKind = "invalid-name"
+)
+
+// LimitViolation describes content that was skipped since it violated a read limit. Violations for layer-wide limits
+// (layers, entries, and total size) mean that all remaining content for the layer (or image) was skipped, all other
+// violations only skip a single entry.
+type LimitViolation struct {
+	Limit LimitKind
+	// Layer is the index of the layer with the violating content
+	Layer int
+	// Path is the path of the violating entry (empty for layer-wide limits)
+	Path file.Path
+	// Value is the size or count that violated the limit
+	Value int64
+	// Max is the configured limit
+	Max int64
+}
+
+func (v LimitViolation) Error() string {
+	if v.Limit == LimitInvalidName {
+		return fmt.Sprintf("read limit exceeded (%s) for layer=%d path=%q", v.Limit, v.Layer, v.Path)
+	}
+	if v.Path == "" {
+		return fmt.Sprintf("read limit exceeded (%s=%d, max=%d) for layer=%d", v.Limit, v.Value, v.Max, v.Layer)
+	}
+	return fmt.Sprintf("read limit exceeded (%s=%d, max=%d) for layer=%d path=%q", v.Limit, v.Value, v.Max, v.Layer, v.Path)
+}
+
+// LimitViolations returns all read limit violations for the image, in layer order (see WithReadLimits).
+func (i *Image) LimitViolations() []LimitViolation {
+	var violations []LimitViolation
+	for _, layer := range i.Layers {
+		violations = append(violations, layer.limitViolations...)
+	}
+	return violations
+}
+
+// LimitViolations returns all read limit violations for the layer (see WithReadLimits).
+func (l *Layer) LimitViolations() []LimitViolation {
+	return append([]LimitViolation(nil), l.limitViolations...)
+}
+
+// layerLimitState tracks layer-wide totals while indexing a single layer.
+type layerLimitState struct {
+	limits    ReadLimits
+	entries   int64
+	totalSize int64
+}
+
+// violation records the given violation on the layer (also as a warning).
+func (l *Layer) violation(v LimitViolation) {
+	v.Layer = int(l.Metadata.Index)
+	l.limitViolations = append(l.limitViolations, v)
+	l.warn(WarningLimitExceeded, v.Path, "%s", v.Error())
+}
+
+// checkReadLimits indicates if the given tar entry is within the configured limits. Entries violating the limits for a
+// single entry are skipped (skip=true), violations of the layer-wide limits stop indexing the layer (stop=true).
+func (l *Layer) checkReadLimits(header tar.Header) (skip, stop bool) {
+	s := l.limitState
+	if s == nil {
+		return false, false
+	}
+	limits := s.limits
+
+	s.entries++
+	s.totalSize += header.Size
+	switch {
+	case limits.TarLimits.MaxEntries > 0 && s.entries > limits.TarLimits.MaxEntries:
+		l.violation(LimitViolation{Limit: LimitEntries, Value: s.entries, Max: limits.TarLimits.MaxEntries})
+		return true, true
+	case limits.TarLimits.MaxTotalSize > 0 && s.totalSize > limits.TarLimits.MaxTotalSize:
+		l.violation(LimitViolation{Limit: LimitTotalSize, Value: s.totalSize, Max: limits.TarLimits.MaxTotalSize})
+		return true, true
+	}
+
+	p := file.Path(tarutil.CleanPath(header.Name))
+	if v, ok := entryLimitViolation(limits, p, header); ok {
+		v.Path = p
+		l.violation(v)
+		// the entry content does not count towards the layer total
+		s.totalSize -= header.Size
+		return true, false
+	}
+	return false, false
+}
+
+func entryLimitViolation(limits ReadLimits, p file.Path, header tar.Header) (LimitViolation, bool) {
+	var xattrSize int
+	for name, value := range file.XattrsFromHeader(header) {
+		xattrSize += len(name) + len(value)
+	}
+
+	if !utf8.ValidString(header.Name) || strings.ContainsRune(header.Name, 0) {
+		return LimitViolation{Limit: LimitInvalidName}, true
+	}
+	if limits.TarLimits.MaxEntrySize > 0 && header.Size > limits.TarLimits.MaxEntrySize {
+		return LimitViolation{Limit: LimitEntrySize, Value: header.Size, Max: limits.TarLimits.MaxEntrySize}, true
+	}
+	if limits.MaxPathLength > 0 && len(header.Name) > limits.MaxPathLength {
+		return LimitViolation{Limit: LimitPathLength, Value: int64(len(header.Name)), Max: int64(limits.MaxPathLength)}, true
+	}
+	if limits.MaxLinkLength > 0 && len(header.Linkname) > limits.MaxLinkLength {
+		return LimitViolation{Limit: LimitLinkLength, Value: int64(len(header.Linkname)), Max: int64(limits.MaxLinkLength)}, true
+	}
+	if limits.MaxXattrSize > 0 && xattrSize > limits.MaxXattrSize {
+		return LimitViolation{Limit: LimitXattrSize, Value: int64(xattrSize), Max: int64(limits.MaxXattrSize)}, true
+	}
+
+	elements := strings.Split(strings.TrimPrefix(string(p), file.DirSeparator), file.DirSeparator)
+	if limits.MaxPathDepth > 0 && len(elements) > limits.MaxPathDepth {
+		return LimitViolation{Limit: LimitPathDepth, Value: int64(len(elements)), Max: int64(limits.MaxPathDepth)}, true
+	}
+	if limits.MaxNameLength > 0 {
+		for _, element := range elements {
+			if len(element) > limits.MaxNameLength {
+				return LimitViolation{Limit: LimitNameLength, Value: int64(len(element)), Max: int64(limits.MaxNameLength)}, true
+			}
+		}
+	}
+	return LimitViolation{}, false
+}
@@ -0,0 +1,82 @@
+//go:build go1.18
+// +build go1.18
+
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+// FuzzImageRead reads arbitrary (possibly malformed) layer tars with hardened read limits, which must never panic.
+func FuzzImageRead(f *testing.F) {
+	seeds := [][]testTarEntry{
+		{{name: "etc/hello.txt", contents: "hello"}},
+		{{name: "etc", typeflag: tar.TypeDir, mode: 0755}, {name: "etc/link", linkname: "../../../etc/passwd", typeflag: tar.TypeSymlink}},
+		{{name: "a/.wh..wh..opq"}, {name: "a/.wh.b"}, {name: "hard", linkname: "a/missing", typeflag: tar.TypeLink}},
+		{{name: "caps", xattrs: map[string]string{"security.capability": "\x00\x01"}}},
+	}
+	for _, entries := range seeds {
+		f.Add(tarBytes(f, entries...))
+	}
+	f.Add([]byte("not a tar"))
+
+	f.Fuzz(func(t *testing.T, contents []byte) {
+		layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(contents)), nil
+		})
+		if err != nil {
+			return
+		}
+		v1Image, err := mutate.AppendLayers(empty.Image, layer)
+		if err != nil {
+			return
+		}
+		img := NewImage(v1Image, t.TempDir())
+		// errors are expected for malformed content, only panics (or unbounded resource use) are failures
+		_ = img.Read(WithReadLimits(HardenedReadLimits()))
+		_ = img.Cleanup()
+	})
+}
+
+func tarBytes(f *testing.F, entries ...testTarEntry) []byte {
+	f.Helper()
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, entry := range entries {
+		typeflag := entry.typeflag
+		if typeflag == 0 {
+			typeflag = tar.TypeReg
+		}
+		hdr := &tar.Header{
+			Name:     entry.name,
+			Linkname: entry.linkname,
+			Typeflag: typeflag,
+			Mode:     0644,
+			Size:     int64(len(entry.contents)),
+		}
+		for name, value := range entry.xattrs {
+			if hdr.PAXRecords == nil {
+				hdr.PAXRecords = map[string]string{}
+			}
+			hdr.PAXRecords["SCHILY.xattr."+name] = value
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			f.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(entry.contents)); err != nil {
+			f.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		f.Fatal(err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,165 @@
+package image
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/file/tarutil"
+)
+
+func TestImage_ReadLimits_EntryViolations(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits ReadLimits
+		entry  testTarEntry
+		want   LimitViolation
+	}{
+		{
+			name:   "entry size",
+			limits: ReadLimits{TarLimits: tarutil.Limits{MaxEntrySize: 4}},
+			entry:  testTarEntry{name: "big.txt", contents: "too big"},
+			want:   LimitViolation{Limit: LimitEntrySize, Path: "/big.txt", Value: 7, Max: 4},
+		},
+		{
+			name:   "path length",
+			limits: ReadLimits{MaxPathLength: 10},
+			entry:  testTarEntry{name: "a/very/long/path.txt"},
+			want:   LimitViolation{Limit: LimitPathLength, Path: "/a/very/long/path.txt", Value: 20, Max: 10},
+		},
+		{
+			name:   "path depth",
+			limits: ReadLimits{MaxPathDepth: 2},
+			entry:  testTarEntry{name: "a/b/c.txt"},
+			want:   LimitViolation{Limit: LimitPathDepth, Path: "/a/b/c.txt", Value: 3, Max: 2},
+		},
+		{
+			name:   "name length",
+			limits: ReadLimits{MaxNameLength: 7},
+			entry:  testTarEntry{name: "etc/toolong.txt"},
+			want:   LimitViolation{Limit: LimitNameLength, Path: "/etc/toolong.txt", Value: 11, Max: 7},
+		},
+		{
+			name:   "link length",
+			limits: ReadLimits{MaxLinkLength: 5},
+			entry:  testTarEntry{name: "link", linkname: "/etc/target", typeflag: tar.TypeSymlink},
+			want:   LimitViolation{Limit: LimitLinkLength, Path: "/link", Value: 11, Max: 5},
+		},
+		{
+			name:   "xattr size",
+			limits: ReadLimits{MaxXattrSize: 8},
+			entry:  testTarEntry{name: "caps", xattrs: map[string]string{"security.capability": "value"}},
+			want:   LimitViolation{Limit: LimitXattrSize, Path: "/caps", Value: 24, Max: 8},
+		},
+		{
+			name:   "invalid name",
+			limits: ReadLimits{},
+			entry:  testTarEntry{name: "bad\xffname"},
+			want:   LimitViolation{Limit: LimitInvalidName, Path: "/bad\xffname"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ok := testTarEntry{name: "ok.txt", contents: "ok"}
+			img := newTestImageFromLayers(t, []v1.Layer{newTestTarLayer(t, ok, test.entry)}, WithReadLimits(test.limits))
+
+			assert.Equal(t, []LimitViolation{test.want}, img.LimitViolations())
+			assert.True(t, img.SquashedTree().HasPath("/ok.txt"))
+			assert.False(t, img.SquashedTree().HasPath(test.want.Path), "violating entry should be skipped")
+
+			var kinds []WarningKind
+			for _, w := range img.Warnings() {
+				kinds = append(kinds, w.Kind)
+			}
+			assert.Contains(t, kinds, WarningLimitExceeded)
+		})
+	}
+}
+
+func TestImage_ReadLimits_LayerViolations(t *testing.T) {
+	entries := []testTarEntry{
+		{name: "a.txt", contents: "aaaa"},
+		{name: "b.txt", contents: "bbbb"},
+		{name: "c.txt", contents: "cccc"},
+	}
+
+	t.Run("entries", func(t *testing.T) {
+		img := newTestImageFromLayers(t, []v1.Layer{newTestTarLayer(t, entries...)}, WithReadLimits(ReadLimits{TarLimits: tarutil.Limits{MaxEntries: 2}}))
+		assert.Equal(t, []LimitViolation{{Limit: LimitEntries, Value: 3, Max: 2}}, img.LimitViolations())
+		assert.True(t, img.SquashedTree().HasPath("/b.txt"))
+		assert.False(t, img.SquashedTree().HasPath("/c.txt"))
+	})
+
+	t.Run("total size", func(t *testing.T) {
+		img := newTestImageFromLayers(t, []v1.Layer{newTestTarLayer(t, entries...)}, WithReadLimits(ReadLimits{TarLimits: tarutil.Limits{MaxTotalSize: 6}}))
+		assert.Equal(t, []LimitViolation{{Limit: LimitTotalSize, Value: 8, Max: 6}}, img.LimitViolations())
+		assert.True(t, img.SquashedTree().HasPath("/a.txt"))
+		assert.False(t, img.SquashedTree().HasPath("/b.txt"))
+	})
+
+	t.Run("layers", func(t *testing.T) {
+		img := newTestImageFromLayers(t, []v1.Layer{
+			newTestTarLayer(t, entries[0]),
+			newTestTarLayer(t, entries[1]),
+		}, WithReadLimits(ReadLimits{MaxLayers: 1}))
+		require.Len(t, img.Layers, 2)
+		assert.False(t, img.Layers[0].Unavailable)
+		assert.True(t, img.Layers[1].Unavailable)
+		assert.Equal(t, []LimitViolation{{Limit: LimitLayers, Layer: 1, Value: 2, Max: 1}}, img.LimitViolations())
+		assert.True(t, img.SquashedTree().HasPath("/a.txt"))
+		assert.False(t, img.SquashedTree().HasPath("/b.txt"))
+	})
+}
+
+func TestImage_ReadLimits_Unlimited(t *testing.T) {
+	img := newTestImageFromLayers(t, []v1.Layer{newTestTarLayer(t, testTarEntry{name: "bad\xffname"}, testTarEntry{name: strings.Repeat("a", 300)})})
+	assert.Empty(t, img.LimitViolations())
+	assert.True(t, img.SquashedTree().HasPath(file.Path("/"+strings.Repeat("a", 300))))
+}
+
+func TestLimitViolation_Error(t *testing.T) {
+	assert.Equal(t, `read limit exceeded (entries=3, max=2) for layer=1`, LimitViolation{Limit: LimitEntries, Layer: 1, Value: 3, Max: 2}.Error())
+	assert.Equal(t, `read limit exceeded (path-depth=3, max=2) for layer=0 path="/a/b/c"`, LimitViolation{Limit: LimitPathDepth, Path: "/a/b/c", Value: 3, Max: 2}.Error())
+	assert.Equal(t, `read limit exceeded (invalid-name) for layer=0 path="/a"`, LimitViolation{Limit: LimitInvalidName, Path: "/a"}.Error())
+}
+
+// craftedConfigImage presents the given config, regardless of the image layers.
+type craftedConfigImage struct {
+	v1.Image
+	config *v1.ConfigFile
+}
+
+func (c craftedConfigImage) ConfigFile() (*v1.ConfigFile, error) {
+	return c.config, nil
+}
+
+func (c craftedConfigImage) RawConfigFile() ([]byte, error) {
+	return json.Marshal(c.config)
+}
+
+func TestImage_Read_DiffIDMismatch(t *testing.T) {
+	v1Image, err := mutate.AppendLayers(empty.Image,
+		newTestTarLayer(t, testTarEntry{name: "etc/base", contents: "base"}),
+		newTestTarLayer(t, testTarEntry{name: "etc/top", contents: "top"}),
+	)
+	require.NoError(t, err)
+	cfg, err := v1Image.ConfigFile()
+	require.NoError(t, err)
+
+	// a crafted config describing fewer layers than the manifest
+	cfg = cfg.DeepCopy()
+	cfg.RootFS.DiffIDs = cfg.RootFS.DiffIDs[:1]
+
+	img := NewImage(craftedConfigImage{Image: v1Image, config: cfg}, t.TempDir())
+	err = img.Read(WithReadLimits(ReadLimits{MaxLayers: 1}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "1 diff IDs for 2 layers")
+}
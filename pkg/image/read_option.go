@@ -0,0 +1,370 @@
+package image
+
+import (
+	"context"
+	"crypto"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+// ReadOption is a configuration option that controls how image content is read (see Image.Read).
+type ReadOption func(*readConfig)
+
+// readConfig is the collection of all read options that have been applied.
+type readConfig struct {
+	// allowMissingLayers indicates that layers without available content should be skipped instead of failing the read.
+	allowMissingLayers bool
+	// lazyLayerContent indicates that layer tars should be streamed instead of cached to disk.
+	lazyLayerContent bool
+	// deferSquash indicates that layer squash trees should not be generated during the read (see Image.Squash).
+	deferSquash bool
+	// squashCache is used to share squash trees between images with common layers.
+	squashCache SquashCacheBackend
+	// verifyCache indicates that layer caches should be re-hashed from disk after being written.
+	verifyCache bool
+	// layerCacheBudget bounds the on-disk size of the cached layer tars (unbounded when nil).
+	layerCacheBudget *LayerCacheBudget
+	// fileDigests are the digest algorithms used for each regular file while indexing (no digests when empty).
+	fileDigests []file.DigestHash
+	// metadataOnlyChanges indicates that upper layer files with the same content as the lower file they replace should
+	// have their content attributed to the lower layer.
+	metadataOnlyChanges bool
+	// typeChangeWarnings indicates that paths replaced by a different type of file should be reported as warnings.
+	typeChangeWarnings bool
+	// strictCompression indicates that a layer compression mismatch should fail the read.
+	strictCompression bool
+	// windowsLayerPaths indicates that layer tar entry names should be normalized as Windows layer paths.
+	windowsLayerPaths bool
+	// skipForeignLayers indicates that foreign layers should not be fetched (they are marked as unavailable instead).
+	skipForeignLayers bool
+	// topLayers is the number of top-most layers that are read (all layers when zero).
+	topLayers int
+	// mergeStrategy is the union semantics used when squashing layers (AUFSMergeStrategy when empty).
+	mergeStrategy MergeStrategy
+	// pathIndex indicates that the basename and extension index of the image squash tree should be built while squashing.
+	pathIndex bool
+	// layerConcurrency is the maximum number of layers read at the same time.
+	layerConcurrency int
+	// expectedPlatform is the platform the image is expected to be for (the host platform when nil).
+	expectedPlatform *Platform
+	// strictPlatform indicates that a platform mismatch should fail the read.
+	strictPlatform bool
+	// mimeTypeDetector classifies regular files while indexing (no MIME types are recorded when nil).
+	mimeTypeDetector file.MIMETypeDetector
+	// mimeTypeSniffSize is the number of leading bytes of each regular file given to the mimeTypeDetector.
+	mimeTypeSniffSize int
+	// contentHooks are invoked with the contents of every regular file while indexing.
+	contentHooks []ContentHook
+	// readAudit is notified of every read of file contents from the image (no auditing when nil).
+	readAudit *readAudit
+	// checkpointDir is where layer tars and per-layer completion markers are persisted so reads can be resumed.
+	checkpointDir string
+	// blobCacheDir is where uncompressed layer tars are persisted (by digest) to be reused across reads.
+	blobCacheDir string
+	// readLimits are the bounds enforced on the image content (no limits when nil).
+	readLimits *ReadLimits
+	// blobRangeReader provides random access to layer blobs, used to read seekable layers (see WithBlobRangeReader).
+	blobRangeReader BlobRangeReader
+	// ctx is used to cancel the read (see Image.ReadWithContext).
+	ctx context.Context
+}
+
+// WithMissingLayersAllowed allows an image to be read even when some layer blobs are absent (e.g. a partially mirrored
+// OCI layout). Each missing layer is marked as unavailable, has an empty tree, and is excluded from the squash.
+func WithMissingLayersAllowed() ReadOption {
+	return func(c *readConfig) {
+		c.allowMissingLayers = true
+	}
+}
+
+// WithLazyLayerContent builds each layer tree from tar headers streamed directly from the layer blob instead of first
+// caching the uncompressed layer tar to disk, which is most useful for registry sourced images where only a handful of
+// files will be read. File contents are fetched again only when they are read: streaming the contents of an entry
+// fetches and decompresses the layer blob from the start up to that entry (a network fetch for registry images), so
+// only the first content read for each layer is streamed. Any later read caches the uncompressed layer tar to disk once
+// and all contents are read from the cached tar from then on, so reading many files (e.g. Image.Extract or walking
+// Image.FS) costs at most one additional fetch of each layer blob.
+func WithLazyLayerContent() ReadOption {
+	return func(c *readConfig) {
+		c.lazyLayerContent = true
+	}
+}
+
+// WithDeferredSquash skips generating the layer squash trees during the read. The caller is responsible for calling
+// Image.Squash when ready (e.g. after filtering layers), otherwise the squash is generated upon first use.
+func WithDeferredSquash() ReadOption {
+	return func(c *readConfig) {
+		c.deferSquash = true
+	}
+}
+
+// WithSquashCache shares layer squash trees between all images read with the same cache. This is most useful when
+// analyzing many images with common base layers, where only the first image to be read needs to squash the shared
+// layer prefix.
+func WithSquashCache(cache SquashCacheBackend) ReadOption {
+	return func(c *readConfig) {
+		c.squashCache = cache
+	}
+}
+
+// WithBlobCache persists every uncompressed layer tar within the given directory keyed by the layer digest (e.g.
+// "<dir>/sha256/<hex>", see DefaultBlobCacheDir), so reading images that share layers (within or across process runs)
+// skips fetching and decompressing the shared layers entirely. Cached layer tars are verified against the layer digest
+// before being reused, and are fetched again if invalid. The directory may be shared by multiple processes and is not
+// removed by Image.Cleanup. Layers read lazily (see WithLazyLayerContent) or from a seekable source are not cached.
+func WithBlobCache(dir string) ReadOption {
+	return func(c *readConfig) {
+		c.blobCacheDir = dir
+	}
+}
+
+// WithCacheVerification re-reads each layer cache from disk after it has been written and compares it against the
+// layer digest, failing the read on any discrepancy. This protects long-lived cache directories from disk-level
+// corruption at the cost of reading each layer tar an additional time.
+func WithCacheVerification() ReadOption {
+	return func(c *readConfig) {
+		c.verifyCache = true
+	}
+}
+
+// WithLayerCacheBudget accounts for every uncompressed layer tar cached on disk within the given budget (see
+// NewLayerCacheBudget), evicting the least recently used layer tars that are no longer in use to make room. Layer
+// tars are in use until the image they belong to is cleaned up (see Image.Cleanup). Layers read lazily (see
+// WithLazyLayerContent) or from a seekable source are not cached on disk and are not accounted for.
+func WithLayerCacheBudget(budget *LayerCacheBudget) ReadOption {
+	return func(c *readConfig) {
+		c.layerCacheBudget = budget
+	}
+}
+
+// WithFileDigests records the digest of every regular file within the file catalog for each of the given hash
+// algorithms (any crypto.Hash or file.XXH64, sha256 when none are given) while building the layer trees, all computed
+// in a single streaming pass over the file contents (see file.Metadata.Digests). When sha256 is included, the sha256
+// digest is also recorded as file.Metadata.Digest, which is required to detect content that has changed (e.g. a
+// corrupted layer cache) between the tree build and a later read with Image.FileContentsVerified.
+func WithFileDigests(hashes ...file.DigestHash) ReadOption {
+	return func(c *readConfig) {
+		if len(hashes) == 0 {
+			hashes = []file.DigestHash{crypto.SHA256}
+		}
+		for _, h := range hashes {
+			c.addFileDigest(h)
+		}
+	}
+}
+
+// WithMIMETypeDetector classifies every regular file with the given detector while building the layer trees, giving
+// the detector the first sniffSize bytes of each file (file.DefaultMIMETypeSniffSize if not positive). The result is
+// recorded within the file catalog (see file.Metadata.MIMEType) so files can be found by MIME type without reading
+// their contents again. A nil detector disables MIME type detection altogether, which avoids reading the contents of
+// files that are never used. By default, file.DefaultMIMETypeDetector is used.
+func WithMIMETypeDetector(detector file.MIMETypeDetector, sniffSize int) ReadOption {
+	return func(c *readConfig) {
+		c.mimeTypeDetector = detector
+		c.mimeTypeSniffSize = sniffSize
+		if sniffSize <= 0 {
+			c.mimeTypeSniffSize = file.DefaultMIMETypeSniffSize
+		}
+	}
+}
+
+// WithContentHooks invokes each of the given hooks with the contents of every regular file while building the layer
+// trees, sharing the single pass over the layer contents (see ContentHook). Hooks accumulate across options. Note:
+// layers restored from catalog checkpoints (see WithCatalogCheckpoints) are not read again, so hooks are not invoked
+// for files within those layers.
+func WithContentHooks(hooks ...ContentHook) ReadOption {
+	return func(c *readConfig) {
+		for _, hook := range hooks {
+			if hook != nil {
+				c.contentHooks = append(c.contentHooks, hook)
+			}
+		}
+	}
+}
+
+// WithReadAudit notifies the given auditor of every read of file contents from the read image (see ReadAuditor), with
+// each read recorded with the given caller tag (e.g. the ID of the analysis job). Reads from views of the image (see
+// Image.WithLayers) are audited the same. Layer tars are not read through the catalog while indexing, so content hooks
+// (see WithContentHooks) are not audited.
+func WithReadAudit(auditor ReadAuditor, tag string) ReadOption {
+	return func(c *readConfig) {
+		if auditor == nil {
+			c.readAudit = nil
+			return
+		}
+		c.readAudit = &readAudit{auditor: auditor, tag: tag}
+	}
+}
+
+// WithCatalogCheckpoints persists every layer tar along with a checkpoint (a completion marker describing the fully
+// indexed layer) within the given directory. When an image is read again with the same directory (e.g. after a crashed
+// or cancelled read of a large image) each layer with a checkpoint is restored without fetching or indexing the layer
+// again, so the read resumes from the remaining layers. Checkpoints are not used for lazily read layers (see
+// WithLazyLayerContent) or with a custom MIME type detector, and are ignored when written with different read options.
+// The directory is not removed by Image.Cleanup.
+func WithCatalogCheckpoints(dir string) ReadOption {
+	return func(c *readConfig) {
+		c.checkpointDir = dir
+	}
+}
+
+// WithMetadataOnlyChangeDetection detects files replaced by an upper layer with identical content (e.g. only the
+// permissions or ownership changed, as with a "COPY --chmod" instruction) while squashing. The squash tree still
+// refers to the upper file (and metadata), however, the content is attributed to the layer that originally introduced
+// it (see FileCatalogEntry.ContentLayer). This implies WithFileDigests, since the digests are used for comparison.
+func WithMetadataOnlyChangeDetection() ReadOption {
+	return func(c *readConfig) {
+		c.metadataOnlyChanges = true
+		c.addFileDigest(crypto.SHA256)
+	}
+}
+
+// WithTypeChangeWarnings reports every path that is replaced by a different type of file as a WarningTypeChange (see
+// Image.Warnings): a directory from a lower layer replaced by a file, symlink, or hardlink (which implicitly removes
+// everything below the directory from the squash tree), any other type of lower file replaced by a directory, and any
+// path replaced by a different type of file within the same layer tar.
+func WithTypeChangeWarnings() ReadOption {
+	return func(c *readConfig) {
+		c.typeChangeWarnings = true
+	}
+}
+
+// WithStrictLayerCompression fails the read with ErrCompressionMismatch when the compression of a layer blob (as
+// detected from the magic bytes of the content) differs from what the layer media type declares, such as a plain tar
+// declared as a gzip compressed layer. By default the layer is read according to the detected compression and a
+// WarningCompressionMismatch is recorded instead.
+func WithStrictLayerCompression() ReadOption {
+	return func(c *readConfig) {
+		c.strictCompression = true
+	}
+}
+
+// WithWindowsLayerPaths normalizes the tar entry names of Windows container image layers into the layer trees: the
+// container filesystem is stored within the top-level "Files" directory of each layer tar (possibly with backslash
+// separators), so "Files\Windows\System32" is added as "/Windows/System32". Entries outside of the "Files" directory
+// (e.g. the registry hives) are kept at their original path. The security descriptor and attributes of each file are
+// available through file.Metadata.Windows regardless of this option.
+func WithWindowsLayerPaths() ReadOption {
+	return func(c *readConfig) {
+		c.windowsLayerPaths = true
+	}
+}
+
+// WithForeignLayersSkipped does not fetch the content of foreign (non-distributable) layers, such as Windows base
+// layers, which are typically served from a location other than the registry (as described by the URLs within the
+// layer descriptor). Each foreign layer is marked as unavailable, has an empty tree, is excluded from the squash, and is
+// reported as a WarningForeignLayer. By default, foreign layers are fetched like any other layer.
+func WithForeignLayersSkipped() ReadOption {
+	return func(c *readConfig) {
+		c.skipForeignLayers = true
+	}
+}
+
+// WithTopLayers only fetches and catalogs the top-most n layers of the image, such as the layers added on top of a known
+// base image. All lower layers are marked as unavailable, have an empty tree, and are excluded from the squash, so the
+// squash tree (and any whiteouts within the top-most layers) reflects only the content of the top-most layers. Squash
+// trees are not cached when lower layers are skipped. By default (and when n is not positive or is at least the number
+// of layers), all layers are read.
+func WithTopLayers(n int) ReadOption {
+	return func(c *readConfig) {
+		c.topLayers = n
+	}
+}
+
+// belowTopLayers indicates if the layer at the given index is below the top-most layers that are read (see
+// WithTopLayers), given the total number of layers within the image.
+func (c readConfig) belowTopLayers(idx, count int) bool {
+	return c.topLayers > 0 && idx < count-c.topLayers
+}
+
+// WithMergeStrategy squashes layers with the given union semantics (see MergeStrategy), which should match how
+// deletions are represented within the layer tars. By default (and for any unknown strategy) whiteouts are
+// interpreted as described by the OCI image spec (see AUFSMergeStrategy). This also determines which entries are
+// reported as whiteouts and opaque directories for each layer (see Layer.Whiteouts and Layer.OpaqueDirs).
+func WithMergeStrategy(strategy MergeStrategy) ReadOption {
+	return func(c *readConfig) {
+		c.mergeStrategy = strategy
+	}
+}
+
+// WithPathIndex builds the basename and extension index of the image squash tree (see filetree.FileTree.Index) as part
+// of squashing, instead of on first use, so that the cost is paid up front along with the rest of the read.
+func WithPathIndex() ReadOption {
+	return func(c *readConfig) {
+		c.pathIndex = true
+	}
+}
+
+// WithLayerReadConcurrency reads (fetches, unpacks, and indexes) up to the given number of layers at the same time.
+// Each layer tree is built independently, so only the squash step is serialized, which can substantially speed up
+// reading images with many layers from fast storage. By default layers are read one at a time (in order).
+func WithLayerReadConcurrency(workers int) ReadOption {
+	return func(c *readConfig) {
+		c.layerConcurrency = workers
+	}
+}
+
+// WithExpectedPlatform sets the platform the image is expected to be for (e.g. the platform requested from the
+// source), which otherwise defaults to the host platform (see HostPlatform). When the image config platform differs
+// the mismatch is recorded on the image metadata (see Metadata.PlatformMismatch) and as a warning.
+func WithExpectedPlatform(platform Platform) ReadOption {
+	return func(c *readConfig) {
+		c.expectedPlatform = &platform
+	}
+}
+
+// WithStrictPlatform fails the read with ErrPlatformMismatch when the image platform differs from the expected
+// platform (see WithExpectedPlatform), preventing the analysis of an image for the wrong architecture.
+func WithStrictPlatform() ReadOption {
+	return func(c *readConfig) {
+		c.strictPlatform = true
+	}
+}
+
+// WithReadLimits enforces the given limits while reading the image (see HardenedReadLimits for limits suitable for
+// untrusted images). Content violating a limit is skipped instead of failing the read, and each violation is reported
+// by Image.LimitViolations (and as a warning).
+func WithReadLimits(limits ReadLimits) ReadOption {
+	return func(c *readConfig) {
+		c.readLimits = &limits
+	}
+}
+
+// withContext sets the context used to cancel the read.
+func withContext(ctx context.Context) ReadOption {
+	return func(c *readConfig) {
+		c.ctx = ctx
+	}
+}
+
+func withBlobRangeReader(reader BlobRangeReader) ReadOption {
+	return func(c *readConfig) {
+		c.blobRangeReader = reader
+	}
+}
+
+// addFileDigest adds the given digest algorithm to the file digests (if not already present).
+func (c *readConfig) addFileDigest(h file.DigestHash) {
+	for _, existing := range c.fileDigests {
+		if existing == h {
+			return
+		}
+	}
+	c.fileDigests = append(c.fileDigests, h)
+}
+
+func newReadConfig(options ...ReadOption) readConfig {
+	cfg := readConfig{
+		layerConcurrency:  1,
+		mimeTypeDetector:  file.DefaultMIMETypeDetector,
+		mimeTypeSniffSize: file.DefaultMIMETypeSniffSize,
+		ctx:               context.Background(),
+	}
+	for _, option := range options {
+		if option == nil {
+			continue
+		}
+		option(&cfg)
+	}
+	return cfg
+}
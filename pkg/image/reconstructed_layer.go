@@ -0,0 +1,30 @@
+package image
+
+import (
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// ReconstructedLayer is implemented by layers with content that is regenerated from an unpacked form of the layer (e.g.
+// an overlay layer directory, see the overlay package) instead of read from the original layer blob. Such content is
+// equivalent to the original layer tar but not byte-for-byte identical, so it is never verified against the layer
+// diff ID nor shared with other reads through the blob cache (see WithBlobCache).
+type ReconstructedLayer interface {
+	v1.Layer
+	// Reconstructed indicates that the layer content is regenerated (see ReconstructedLayer).
+	Reconstructed() bool
+}
+
+// isReconstructed indicates if the given layer content is regenerated (see ReconstructedLayer).
+func isReconstructed(layer v1.Layer) bool {
+	reconstructed, ok := layer.(ReconstructedLayer)
+	return ok && reconstructed.Reconstructed()
+}
+
+// verifiableDigest returns the digest that the uncompressed layer tar is verified against, which is empty (nothing is
+// verified) for reconstructed layers since their content can never match.
+func (l *Layer) verifiableDigest() string {
+	if isReconstructed(l.layer) {
+		return ""
+	}
+	return l.Metadata.Digest
+}
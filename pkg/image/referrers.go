@@ -0,0 +1,49 @@
+package image
+
+import "context"
+
+// Referrer describes an artifact attached to an image through the OCI referrers relationship (e.g. an SBOM, signature,
+// or attestation pushed with the image as its subject). Only the artifact descriptor is described, the artifact
+// contents are not fetched.
+type Referrer struct {
+	// ArtifactType is the type of the artifact (e.g. "application/spdx+json"), which is the config media type for
+	// artifacts without an explicit artifact type
+	ArtifactType string
+	// MediaType of the artifact manifest
+	MediaType string
+	// Digest of the artifact manifest
+	Digest string
+	// Size of the artifact manifest in bytes
+	Size int64
+	// Annotations of the artifact manifest (as listed by the registry)
+	Annotations map[string]string
+	// Subject is the digest of the image manifest (or index) that the artifact refers to
+	Subject string
+}
+
+// ReferrerFetcher lists all referrers of an image with the given artifact type (all referrers when empty).
+type ReferrerFetcher func(ctx context.Context, artifactType string) ([]Referrer, error)
+
+// IsSBOM indicates if the referrer artifact is an SPDX or CycloneDX document (see IsSBOMMediaType).
+func (r Referrer) IsSBOM() bool {
+	return IsSBOMMediaType(r.ArtifactType)
+}
+
+// WithReferrerFetcher associates a source of referrer artifacts with the image (see Image.Referrers).
+func WithReferrerFetcher(fetcher ReferrerFetcher) AdditionalMetadata {
+	return func(image *Image) error {
+		image.referrerFetcher = fetcher
+		return nil
+	}
+}
+
+// Referrers lists all artifacts attached to the image with the given artifact type (e.g. "application/spdx+json"), or
+// all attached artifacts when the artifact type is empty. This allows discovering an existing SBOM for the image before
+// deciding to analyze the image filesystem (the documents themselves can be fetched with Image.SBOMs). Only some image
+// sources support this (e.g. images fetched from a registry), otherwise no referrers are returned.
+func (i *Image) Referrers(ctx context.Context, artifactType string) ([]Referrer, error) {
+	if i.referrerFetcher == nil {
+		return nil, nil
+	}
+	return i.referrerFetcher(ctx, artifactType)
+}
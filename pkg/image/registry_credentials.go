@@ -2,6 +2,7 @@ package image
 
 import (
 	"github.com/anchore/stereoscope/internal/log"
+	"github.com/anchore/stereoscope/pkg/redact"
 	"github.com/google/go-containerregistry/pkg/authn"
 )
 
@@ -18,6 +19,7 @@ type RegistryCredentials struct {
 // Authentication methods are attempted in the following order until a viable method is found: (1) basic auth,
 // (2) bearer token. If no viable authentication method is found, authenticator returns nil.
 func (c RegistryCredentials) authenticator() authn.Authenticator {
+	redact.AddValues(c.Password, c.Token)
 	if c.Username != "" && c.Password != "" {
 		log.Debugf("using basic auth for registry %q", c.Authority)
 		return &authn.Basic{
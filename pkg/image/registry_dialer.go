@@ -0,0 +1,35 @@
+package image
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// DialContextFunc establishes network connections to registry hosts (the same signature as net.Dialer.DialContext).
+type DialContextFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// NewStaticHostDialer returns a DialContextFunc that connects to the address mapped for each host (e.g.
+// "registry.example.com" -> "10.0.0.5") instead of resolving the host with the system resolver. Hosts without a
+// mapping are dialed as-is. Only the host portion is replaced, the original port is kept unless the mapped address
+// specifies one.
+func NewStaticHostDialer(hosts map[string]string) DialContextFunc {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		if mapped, ok := hosts[host]; ok {
+			if _, _, err := net.SplitHostPort(mapped); err == nil {
+				addr = mapped
+			} else {
+				addr = net.JoinHostPort(mapped, port)
+			}
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}
+}
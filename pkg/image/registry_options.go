@@ -1,6 +1,9 @@
 package image
 
 import (
+	"context"
+	"net/http"
+
 	"github.com/anchore/stereoscope/internal/log"
 	"github.com/google/go-containerregistry/pkg/authn"
 )
@@ -9,8 +12,68 @@ import (
 type RegistryOptions struct {
 	InsecureSkipTLSVerify bool
 	InsecureUseHTTP       bool
-	Credentials           []RegistryCredentials
-	Platform              string
+	// CAFile is an optional PEM encoded CA bundle to trust (in addition to the system CAs) for registry connections,
+	// e.g. for on-prem registries with a private CA (see TLSConfig)
+	CAFile string
+	// ClientCertFile and ClientKeyFile are an optional PEM encoded client certificate and key presented to registries
+	// requiring mutual TLS (both must be provided)
+	ClientCertFile string
+	ClientKeyFile  string
+	Credentials    []RegistryCredentials
+	Platform       string
+	// BandwidthLimit is the maximum rate (in bytes per second) at which content is downloaded for a single image
+	// fetch (no limit when zero)
+	BandwidthLimit int64
+	// BandwidthLimiter is an optional limiter that may be shared between image fetches to limit the combined download
+	// rate (e.g. for all fetches within a session or process). This is applied in addition to BandwidthLimit.
+	BandwidthLimiter *BandwidthLimiter
+	// DialContext is an optional function used to establish all registry connections (e.g. to apply static host
+	// mappings, see NewStaticHostDialer, or to connect through a SOCKS proxy or sidecar)
+	DialContext DialContextFunc
+	// TransportSettings tunes the connection pooling of registry connections (e.g. connections per host, idle timeouts,
+	// and HTTP/2), see RegistryTransportSettings
+	TransportSettings RegistryTransportSettings
+	// TransportPool is an optional pool that may be shared between image fetches so that all fetches reuse the same
+	// registry connections (see RegistryTransportPool)
+	TransportPool *RegistryTransportPool
+	// DockerConfigDir is the directory containing the docker config.json to source credentials from (the default
+	// docker config directory is used when empty, see ResolveCredentials)
+	DockerConfigDir string
+	// CredentialProvider is an optional callback to (re)fetch credentials when the registry rejects the current
+	// credentials, or when no other credentials could be resolved (see CredentialProvider).
+	CredentialProvider CredentialProvider
+	// Keychain is an optional go-containerregistry keychain to resolve credentials from (e.g. a cloud provider keychain,
+	// or a keychain with programmatically injected credentials), see ResolveCredentials.
+	Keychain authn.Keychain
+}
+
+// Transport wraps the given round tripper with all configured bandwidth limits.
+func (r RegistryOptions) Transport(base http.RoundTripper) http.RoundTripper {
+	transport := r.BandwidthLimiter.Transport(base)
+	return NewBandwidthLimiter(r.BandwidthLimit).Transport(transport)
+}
+
+// RefreshableAuthenticator returns the resolved authenticator for the given registry (see ResolveCredentials). If a
+// CredentialProvider is configured the authenticator invokes the provider whenever the registry rejects the current
+// credentials, in which case the given round tripper is wrapped to observe such rejections.
+func (r RegistryOptions) RefreshableAuthenticator(ctx context.Context, registry string, base http.RoundTripper) (authn.Authenticator, http.RoundTripper, error) {
+	resolution, err := r.ResolveCredentials(registry)
+	if err != nil {
+		return nil, nil, err
+	}
+	log.Debugf("using %s registry credentials for %q %s", resolution.Source, registry, resolution.Detail)
+
+	if r.CredentialProvider == nil {
+		return resolution.Authenticator, base, nil
+	}
+
+	initial := resolution.Authenticator
+	if resolution.Source == CredentialSourceAnonymous {
+		// defer to the provider for initial credentials
+		initial = nil
+	}
+	refreshing := newRefreshingAuthenticator(ctx, registry, initial, r.CredentialProvider)
+	return refreshing, refreshing.transport(base), nil
 }
 
 // Authenticator returns an object capable of authenticating against the given registry. If no credentials match the
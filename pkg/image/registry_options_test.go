@@ -1,9 +1,15 @@
 package image
 
 import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestRegistryOptions_Authenticator(t *testing.T) {
@@ -163,3 +169,126 @@ func TestRegistryOptions_Authenticator(t *testing.T) {
 		})
 	}
 }
+
+func TestRegistryOptions_ResolveCredentials(t *testing.T) {
+	configDir := t.TempDir()
+	auth := base64.StdEncoding.EncodeToString([]byte("config-user:config-pass"))
+	require.NoError(t, os.WriteFile(filepath.Join(configDir, "config.json"), []byte(fmt.Sprintf(`{"auths": {"config.io": {"auth": %q}}}`, auth)), 0600))
+
+	tests := []struct {
+		name       string
+		registry   string
+		options    RegistryOptions
+		env        map[string]string
+		wantSource CredentialSource
+		wantAuth   authn.AuthConfig
+	}{
+		{
+			name:     "explicit options are preferred",
+			registry: "config.io",
+			options: RegistryOptions{
+				DockerConfigDir: configDir,
+				Credentials:     []RegistryCredentials{{Authority: "config.io", Username: "option-user", Password: "option-pass"}},
+			},
+			env:        map[string]string{RegistryUsernameEnv: "env-user", RegistryPasswordEnv: "env-pass"},
+			wantSource: CredentialSourceOptions,
+			wantAuth:   authn.AuthConfig{Username: "option-user", Password: "option-pass"},
+		},
+		{
+			name:     "explicit options are preferred over the keychain",
+			registry: "config.io",
+			options: RegistryOptions{
+				Credentials: []RegistryCredentials{{Authority: "config.io", Token: "option-token"}},
+				Keychain:    staticKeychain{"config.io": &authn.Basic{Username: "keychain-user", Password: "keychain-pass"}},
+			},
+			wantSource: CredentialSourceOptions,
+			wantAuth:   authn.AuthConfig{},
+		},
+		{
+			name:     "keychain is preferred over the environment",
+			registry: "config.io",
+			options: RegistryOptions{
+				DockerConfigDir: configDir,
+				Keychain:        staticKeychain{"config.io": &authn.Basic{Username: "keychain-user", Password: "keychain-pass"}},
+			},
+			env:        map[string]string{RegistryUsernameEnv: "env-user", RegistryPasswordEnv: "env-pass"},
+			wantSource: CredentialSourceKeychain,
+			wantAuth:   authn.AuthConfig{Username: "keychain-user", Password: "keychain-pass"},
+		},
+		{
+			name:     "keychain without credentials for the registry",
+			registry: "config.io",
+			options: RegistryOptions{
+				DockerConfigDir: configDir,
+				Keychain:        staticKeychain{"other.io": &authn.Basic{Username: "keychain-user", Password: "keychain-pass"}},
+			},
+			wantSource: CredentialSourceDockerConfig,
+			wantAuth:   authn.AuthConfig{Username: "config-user", Password: "config-pass"},
+		},
+		{
+			name:       "environment is preferred over the docker config",
+			registry:   "config.io",
+			options:    RegistryOptions{DockerConfigDir: configDir},
+			env:        map[string]string{RegistryUsernameEnv: "env-user", RegistryPasswordEnv: "env-pass"},
+			wantSource: CredentialSourceEnvironment,
+			wantAuth:   authn.AuthConfig{Username: "env-user", Password: "env-pass"},
+		},
+		{
+			name:     "environment restricted to another registry",
+			registry: "config.io",
+			options:  RegistryOptions{DockerConfigDir: configDir},
+			env: map[string]string{
+				RegistryAuthorityEnv: "other.io",
+				RegistryTokenEnv:     "env-token",
+			},
+			wantSource: CredentialSourceDockerConfig,
+			wantAuth:   authn.AuthConfig{Username: "config-user", Password: "config-pass"},
+		},
+		{
+			name:       "docker config",
+			registry:   "config.io",
+			options:    RegistryOptions{DockerConfigDir: configDir},
+			wantSource: CredentialSourceDockerConfig,
+			wantAuth:   authn.AuthConfig{Username: "config-user", Password: "config-pass"},
+		},
+		{
+			name:       "anonymous",
+			registry:   "anonymous.io",
+			options:    RegistryOptions{DockerConfigDir: configDir},
+			wantSource: CredentialSourceAnonymous,
+			wantAuth:   authn.AuthConfig{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lookupEnv = func(key string) (string, bool) {
+				value, ok := test.env[key]
+				return value, ok
+			}
+			defer func() { lookupEnv = os.LookupEnv }()
+
+			resolution, err := test.options.ResolveCredentials(test.registry)
+			require.NoError(t, err)
+			assert.Equal(t, test.wantSource, resolution.Source)
+			assert.Equal(t, test.registry, resolution.Registry)
+			if test.wantSource == CredentialSourceDockerConfig {
+				assert.Equal(t, filepath.Join(configDir, "config.json"), resolution.Detail)
+			}
+
+			actual, err := resolution.Authenticator.Authorization()
+			require.NoError(t, err)
+			assert.Equal(t, test.wantAuth.Username, actual.Username)
+			assert.Equal(t, test.wantAuth.Password, actual.Password)
+		})
+	}
+}
+
+// staticKeychain resolves fixed authenticators by registry (anonymous for all other registries).
+type staticKeychain map[string]authn.Authenticator
+
+func (k staticKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	if authenticator, ok := k[target.RegistryStr()]; ok {
+		return authenticator, nil
+	}
+	return authn.Anonymous, nil
+}
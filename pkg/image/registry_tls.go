@@ -0,0 +1,51 @@
+package image
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+// RequiresTLSConfig indicates if any TLS option (skipping verification, a custom CA bundle, or a client certificate)
+// is configured, in which case TLSConfig should be used for registry connections.
+func (r RegistryOptions) RequiresTLSConfig() bool {
+	return r.InsecureSkipTLSVerify || r.CAFile != "" || r.ClientCertFile != "" || r.ClientKeyFile != ""
+}
+
+// TLSConfig returns the TLS configuration for registry connections. CA certificates from CAFile are trusted in
+// addition to the system certificate pool, and the client certificate (from ClientCertFile and ClientKeyFile) is
+// presented to registries that request one (e.g. for mutual TLS).
+func (r RegistryOptions) TLSConfig() (*tls.Config, error) {
+	// nolint: gosec
+	cfg := &tls.Config{InsecureSkipVerify: r.InsecureSkipTLSVerify}
+
+	if r.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			// the system pool is unavailable on some platforms, fall back to only the given CAs
+			pool = x509.NewCertPool()
+		}
+		contents, err := ioutil.ReadFile(r.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read registry CA file=%q: %w", r.CAFile, err)
+		}
+		if !pool.AppendCertsFromPEM(contents) {
+			return nil, fmt.Errorf("no PEM encoded certificates found in registry CA file=%q", r.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if r.ClientCertFile != "" || r.ClientKeyFile != "" {
+		if r.ClientCertFile == "" || r.ClientKeyFile == "" {
+			return nil, fmt.Errorf("both a client certificate and key are required for registry client authentication (cert=%q key=%q)", r.ClientCertFile, r.ClientKeyFile)
+		}
+		cert, err := tls.LoadX509KeyPair(r.ClientCertFile, r.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load registry client certificate=%q: %w", r.ClientCertFile, err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
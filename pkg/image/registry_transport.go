@@ -0,0 +1,138 @@
+package image
+
+import (
+	"crypto/tls"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// RegistryTransportSettings tunes the connection pooling of the transport used for registry requests. Zero values keep
+// the defaults of the go-containerregistry transport.
+type RegistryTransportSettings struct {
+	// MaxConnsPerHost limits the number of connections (in any state) to each registry host (no limit when zero)
+	MaxConnsPerHost int
+	// MaxIdleConnsPerHost is the number of idle connections kept open to each registry host for reuse
+	// (http.DefaultMaxIdleConnsPerHost when zero), raising this helps images with many small layers
+	MaxIdleConnsPerHost int
+	// IdleConnTimeout is how long an idle connection is kept open before being closed (90 seconds when zero)
+	IdleConnTimeout time.Duration
+	// DisableHTTP2 restricts registry connections to HTTP/1.1 (HTTP/2 is attempted by default)
+	DisableHTTP2 bool
+}
+
+func (s RegistryTransportSettings) isZero() bool {
+	return s == RegistryTransportSettings{}
+}
+
+func (s RegistryTransportSettings) apply(t *http.Transport) {
+	if s.MaxConnsPerHost > 0 {
+		t.MaxConnsPerHost = s.MaxConnsPerHost
+	}
+	if s.MaxIdleConnsPerHost > 0 {
+		t.MaxIdleConnsPerHost = s.MaxIdleConnsPerHost
+		if t.MaxIdleConns > 0 && t.MaxIdleConns < s.MaxIdleConnsPerHost {
+			t.MaxIdleConns = s.MaxIdleConnsPerHost
+		}
+	}
+	if s.IdleConnTimeout > 0 {
+		t.IdleConnTimeout = s.IdleConnTimeout
+	}
+	if s.DisableHTTP2 {
+		t.ForceAttemptHTTP2 = false
+		// a non-nil (empty) map prevents the transport from upgrading TLS connections to HTTP/2
+		t.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+}
+
+// RegistryTransportPool shares registry transports (and with them, any open connections) between image fetches, such
+// that all fetches within a session (e.g. many images from the same registry) reuse the same connection pool instead
+// of each fetch dialing its own connections. A transport is shared between all fetches with the same TLS options and
+// transport settings. Fetches using a custom DialContext are always given a dedicated transport, since the dialer of
+// each fetch cannot be told apart.
+type RegistryTransportPool struct {
+	lock       sync.Mutex
+	transports map[registryTransportKey]*http.Transport
+}
+
+// registryTransportKey describes every option that determines how a transport is built (other than a custom dialer).
+type registryTransportKey struct {
+	settings              RegistryTransportSettings
+	insecureSkipTLSVerify bool
+	caFile                string
+	clientCertFile        string
+	clientKeyFile         string
+}
+
+// NewRegistryTransportPool creates an empty pool, which may be shared between image fetches (see
+// RegistryOptions.TransportPool).
+func NewRegistryTransportPool() *RegistryTransportPool {
+	return &RegistryTransportPool{
+		transports: make(map[registryTransportKey]*http.Transport),
+	}
+}
+
+// transport returns the pooled transport for the given options, building the transport on first use.
+func (p *RegistryTransportPool) transport(r RegistryOptions) (*http.Transport, error) {
+	key := registryTransportKey{
+		settings:              r.TransportSettings,
+		insecureSkipTLSVerify: r.InsecureSkipTLSVerify,
+		caFile:                r.CAFile,
+		clientCertFile:        r.ClientCertFile,
+		clientKeyFile:         r.ClientKeyFile,
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if t, ok := p.transports[key]; ok {
+		return t, nil
+	}
+	t, err := r.newHTTPTransport()
+	if err != nil {
+		return nil, err
+	}
+	p.transports[key] = t
+	return t, nil
+}
+
+// CloseIdleConnections closes all idle connections of all pooled transports (e.g. at the end of a session).
+func (p *RegistryTransportPool) CloseIdleConnections() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for _, t := range p.transports {
+		t.CloseIdleConnections()
+	}
+}
+
+// HTTPTransport returns the (unauthenticated and unlimited) transport for registry connections, with the configured TLS
+// options, dialer, and transport settings applied. The transport is taken from the TransportPool when one is
+// configured, otherwise the shared go-containerregistry transport is used unless any option requires a dedicated one.
+func (r RegistryOptions) HTTPTransport() (http.RoundTripper, error) {
+	if r.TransportPool != nil && r.DialContext == nil {
+		return r.TransportPool.transport(r)
+	}
+	if !r.RequiresTLSConfig() && r.DialContext == nil && r.TransportSettings.isZero() {
+		return remote.DefaultTransport, nil
+	}
+	return r.newHTTPTransport()
+}
+
+func (r RegistryOptions) newHTTPTransport() (*http.Transport, error) {
+	t := remote.DefaultTransport.Clone()
+	if r.RequiresTLSConfig() {
+		tlsConfig, err := r.TLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		t.TLSClientConfig = tlsConfig
+	}
+	if r.DialContext != nil {
+		t.DialContext = r.DialContext
+	}
+	r.TransportSettings.apply(t)
+	return t, nil
+}
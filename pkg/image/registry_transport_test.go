@@ -0,0 +1,74 @@
+package image
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryOptions_HTTPTransport(t *testing.T) {
+	t.Run("the shared default transport is used without any options", func(t *testing.T) {
+		transport, err := RegistryOptions{}.HTTPTransport()
+		require.NoError(t, err)
+		assert.Same(t, remote.DefaultTransport, transport)
+	})
+
+	t.Run("settings are applied to a dedicated transport", func(t *testing.T) {
+		transport, err := RegistryOptions{
+			TransportSettings: RegistryTransportSettings{
+				MaxConnsPerHost:     8,
+				MaxIdleConnsPerHost: 200,
+				IdleConnTimeout:     time.Minute,
+				DisableHTTP2:        true,
+			},
+		}.HTTPTransport()
+		require.NoError(t, err)
+		require.IsType(t, &http.Transport{}, transport)
+		httpTransport := transport.(*http.Transport)
+
+		assert.NotSame(t, remote.DefaultTransport, httpTransport)
+		assert.Equal(t, 8, httpTransport.MaxConnsPerHost)
+		assert.Equal(t, 200, httpTransport.MaxIdleConnsPerHost)
+		assert.Equal(t, 200, httpTransport.MaxIdleConns)
+		assert.Equal(t, time.Minute, httpTransport.IdleConnTimeout)
+		assert.False(t, httpTransport.ForceAttemptHTTP2)
+		assert.NotNil(t, httpTransport.TLSNextProto)
+		assert.Empty(t, httpTransport.TLSNextProto)
+
+		// the default transport is never modified
+		assert.True(t, remote.DefaultTransport.ForceAttemptHTTP2)
+		assert.Zero(t, remote.DefaultTransport.MaxConnsPerHost)
+	})
+
+	t.Run("pooled transports are shared between equivalent options", func(t *testing.T) {
+		pool := NewRegistryTransportPool()
+		options := RegistryOptions{
+			TransportPool:     pool,
+			TransportSettings: RegistryTransportSettings{MaxIdleConnsPerHost: 20},
+		}
+
+		first, err := options.HTTPTransport()
+		require.NoError(t, err)
+		second, err := options.HTTPTransport()
+		require.NoError(t, err)
+		assert.Same(t, first, second)
+
+		insecure := options
+		insecure.InsecureSkipTLSVerify = true
+		other, err := insecure.HTTPTransport()
+		require.NoError(t, err)
+		assert.NotSame(t, first, other)
+		assert.True(t, other.(*http.Transport).TLSClientConfig.InsecureSkipVerify)
+
+		withDialer := options
+		withDialer.DialContext = NewStaticHostDialer(nil)
+		dedicated, err := withDialer.HTTPTransport()
+		require.NoError(t, err)
+		assert.NotSame(t, first, dedicated)
+		assert.Len(t, pool.transports, 2)
+	})
+}
@@ -0,0 +1,58 @@
+package image
+
+import (
+	"context"
+	"strings"
+)
+
+// sbomMediaTypes are the known layer (or artifact) media types for SPDX and CycloneDX documents.
+var sbomMediaTypes = []string{
+	"application/spdx+json",
+	"text/spdx",
+	"application/vnd.cyclonedx",
+	"application/vnd.cyclonedx+json",
+	"application/vnd.cyclonedx+xml",
+}
+
+// SBOM is a pre-existing SBOM document associated with an image (e.g. a referrer artifact attached by the image producer).
+type SBOM struct {
+	// MediaType of the SBOM document (e.g. "application/spdx+json")
+	MediaType string
+	// Digest of the SBOM document blob
+	Digest string
+	// ArtifactDigest is the digest of the artifact manifest that contained the SBOM document
+	ArtifactDigest string
+	// Content is the raw SBOM document
+	Content []byte
+}
+
+// SBOMFetcher fetches all SBOM documents associated with an image.
+type SBOMFetcher func(ctx context.Context) ([]SBOM, error)
+
+// IsSBOMMediaType indicates if the given media type describes a SPDX or CycloneDX document (ignoring any parameters).
+func IsSBOMMediaType(mediaType string) bool {
+	mediaType = strings.TrimSpace(strings.SplitN(mediaType, ";", 2)[0])
+	for _, ty := range sbomMediaTypes {
+		if strings.EqualFold(mediaType, ty) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithSBOMFetcher associates a source of pre-existing SBOM documents with the image (see Image.SBOMs).
+func WithSBOMFetcher(fetcher SBOMFetcher) AdditionalMetadata {
+	return func(image *Image) error {
+		image.sbomFetcher = fetcher
+		return nil
+	}
+}
+
+// SBOMs fetches all pre-existing SBOM documents associated with the image. Only some image sources support this
+// (e.g. images fetched from a registry with SBOM referrer artifacts attached), otherwise no SBOMs are returned.
+func (i *Image) SBOMs(ctx context.Context) ([]SBOM, error) {
+	if i.sbomFetcher == nil {
+		return nil, nil
+	}
+	return i.sbomFetcher(ctx)
+}
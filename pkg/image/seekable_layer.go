@@ -0,0 +1,437 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/anchore/stereoscope/internal/log"
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/containerd/stargz-snapshotter/estargz"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/opencontainers/go-digest"
+	"github.com/wagoodman/go-progress"
+)
+
+// BlobRangeReader reads length bytes of the (compressed) blob with the given digest starting at the given offset (e.g.
+// with HTTP range requests to a registry).
+type BlobRangeReader func(ctx context.Context, digest v1.Hash, offset, length int64) (io.ReadCloser, error)
+
+// WithBlobRangeReader associates random access to the layer blobs with the image. Layers in the eStargz format (where
+// the manifest layer descriptor has a table of contents digest annotation) are then read from the layer table of
+// contents, and file contents are fetched individually when they are read, instead of fetching the whole layer blob.
+// The table of contents is verified against the manifest annotation and all file contents are verified against the
+// table of contents. Layers are fetched in full as usual if the table of contents cannot be read.
+func WithBlobRangeReader(reader BlobRangeReader) AdditionalMetadata {
+	return func(image *Image) error {
+		image.blobRangeReader = reader
+		return nil
+	}
+}
+
+const (
+	// seekableLayerFetchSize is the minimum number of bytes fetched by a single range read, so the (typically many)
+	// small files stored next to each other in the layer blob are fetched together.
+	seekableLayerFetchSize = 1 << 20
+	// seekableLayerWindows is the number of fetched ranges kept in memory for each layer blob.
+	seekableLayerWindows = 2
+	// maxSeekableTOCSize is the largest table of contents that will be read (uncompressed).
+	maxSeekableTOCSize = 512 << 20
+)
+
+// isSeekableLayerMediaType indicates if layers with the given media type may be in the eStargz format.
+func isSeekableLayerMediaType(mediaType types.MediaType) bool {
+	switch mediaType {
+	case types.OCILayer, types.OCIRestrictedLayer, types.DockerLayer, types.DockerForeignLayer:
+		return true
+	}
+	return false
+}
+
+// seekableLayerTOCDigest returns the eStargz table of contents digest annotated on the manifest descriptor of the layer
+// at the given index (false if the layer is not annotated as an eStargz layer).
+func seekableLayerTOCDigest(imgMetadata Metadata, idx int) (string, bool) {
+	desc, ok := manifestLayerDescriptor(imgMetadata, idx)
+	if !ok {
+		return "", false
+	}
+	tocDigest := desc.Annotations[estargz.TOCJSONDigestAnnotation]
+	return tocDigest, tocDigest != ""
+}
+
+// readSeekable builds the layer tree from the eStargz table of contents of the layer blob (see WithBlobRangeReader),
+// indicating if the layer was read. Failing to read the table of contents is not an error, the layer should be read
+// in full instead.
+func (l *Layer) readSeekable(cfg readConfig, imgMetadata Metadata, idx int, monitor *progress.Manual) (bool, error) {
+	if cfg.blobRangeReader == nil || cfg.checkpointDir != "" || !isSeekableLayerMediaType(l.Metadata.MediaType) {
+		return false, nil
+	}
+	tocDigest, ok := seekableLayerTOCDigest(imgMetadata, idx)
+	if !ok {
+		return false, nil
+	}
+
+	seekable, err := l.openSeekable(cfg.ctx, cfg.blobRangeReader, tocDigest)
+	if err != nil {
+		if cfg.ctx.Err() != nil {
+			return false, err
+		}
+		log.Warnf("unable to read table of contents for layer=%q, fetching the whole layer instead: %+v", l.Metadata.Digest, err)
+		return false, nil
+	}
+
+	var sequence int64
+	for _, entry := range seekable.entries {
+		if err := cfg.ctx.Err(); err != nil {
+			return false, err
+		}
+		header, ok := seekableTarHeader(entry)
+		if !ok {
+			continue
+		}
+		entry := entry
+		opener := func() io.ReadCloser {
+			return seekable.open(entry)
+		}
+		// contents are only fetched if they are needed while indexing (e.g. for MIME types or file digests)
+		contents := opener()
+		err := l.addTarEntry(header, sequence, contents, opener, monitor)
+		_ = contents.Close()
+		if errors.Is(err, file.ErrTarStopIteration) {
+			break
+		}
+		if err != nil {
+			return false, err
+		}
+		sequence++
+	}
+
+	// file contents may be read long after the read has completed
+	seekable.blob.setContext(context.Background())
+	log.Debugf("read layer=%q from table of contents (%d entries)", l.Metadata.Digest, sequence)
+	return true, nil
+}
+
+// seekableLayer is an eStargz layer blob along with the (verified) table of contents.
+type seekableLayer struct {
+	blob     *blobReaderAt
+	reader   *estargz.Reader
+	verifier estargz.TOCEntryVerifier
+	// entries are all table of contents entries, in layer tar order
+	entries []*estargz.TOCEntry
+	// chunks are the content chunks of each regular file entry (keyed by entry name)
+	chunks map[string][]*estargz.TOCEntry
+}
+
+func (l *Layer) openSeekable(ctx context.Context, read BlobRangeReader, tocDigest string) (*seekableLayer, error) {
+	blobDigest, err := l.layer.Digest()
+	if err != nil {
+		return nil, err
+	}
+	size, err := l.layer.Size()
+	if err != nil {
+		return nil, err
+	}
+	blob := &blobReaderAt{
+		ctx:    ctx,
+		read:   read,
+		digest: blobDigest,
+		size:   size,
+	}
+	sr := io.NewSectionReader(blob, 0, size)
+
+	tocOffset, footerSize, err := estargz.OpenFooter(sr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read footer: %w", err)
+	}
+	toc, err := readSeekableTOC(io.NewSectionReader(blob, tocOffset, size-footerSize-tocOffset), tocDigest)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := estargz.Open(sr, estargz.WithTOCOffset(tocOffset))
+	if err != nil {
+		return nil, fmt.Errorf("unable to open layer: %w", err)
+	}
+	verifier, err := reader.VerifyTOC(digest.Digest(tocDigest))
+	if err != nil {
+		return nil, fmt.Errorf("unable to verify table of contents: %w", err)
+	}
+
+	seekable := &seekableLayer{
+		blob:     blob,
+		reader:   reader,
+		verifier: verifier,
+		entries:  toc.Entries,
+		chunks:   make(map[string][]*estargz.TOCEntry),
+	}
+	var lastReg *estargz.TOCEntry
+	for _, entry := range toc.Entries {
+		switch entry.Type {
+		case "reg":
+			if entry.ChunkSize == 0 {
+				entry.ChunkSize = entry.Size
+			}
+			lastReg = entry
+			seekable.chunks[entry.Name] = []*estargz.TOCEntry{entry}
+		case "chunk":
+			if lastReg == nil {
+				return nil, fmt.Errorf("chunk at offset=%d without a regular file", entry.Offset)
+			}
+			if entry.ChunkSize == 0 {
+				entry.ChunkSize = lastReg.Size - entry.ChunkOffset
+			}
+			seekable.chunks[lastReg.Name] = append(seekable.chunks[lastReg.Name], entry)
+		}
+	}
+	return seekable, nil
+}
+
+// readSeekableTOC reads the table of contents (a gzip compressed tar with a single JSON entry) from the given section of
+// the layer blob, ensuring the table of contents matches the given digest.
+func readSeekableTOC(sr *io.SectionReader, tocDigest string) (*estargz.JTOC, error) {
+	gr, err := gzip.NewReader(sr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read table of contents: %w", err)
+	}
+	defer gr.Close()
+
+	tr := tar.NewReader(gr)
+	header, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read table of contents: %w", err)
+	}
+	if header.Name != estargz.TOCTarName {
+		return nil, fmt.Errorf("unexpected table of contents entry=%q", header.Name)
+	}
+	if header.Size > maxSeekableTOCSize {
+		return nil, fmt.Errorf("table of contents is too large: %d bytes", header.Size)
+	}
+	content, err := ioutil.ReadAll(tr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read table of contents: %w", err)
+	}
+	if actual := fmt.Sprintf("sha256:%x", sha256.Sum256(content)); actual != tocDigest {
+		return nil, fmt.Errorf("%w: table of contents expected=%q actual=%q", file.ErrDigestMismatch, tocDigest, actual)
+	}
+
+	var toc estargz.JTOC
+	if err := json.Unmarshal(content, &toc); err != nil {
+		return nil, fmt.Errorf("unable to parse table of contents: %w", err)
+	}
+	return &toc, nil
+}
+
+// seekableTarHeader returns the tar header described by the given table of contents entry (false for content chunks,
+// which are not tar entries).
+func seekableTarHeader(entry *estargz.TOCEntry) (tar.Header, bool) {
+	header := tar.Header{
+		Name:     entry.Name,
+		Linkname: entry.LinkName,
+		Mode:     entry.Mode,
+		Uid:      entry.UID,
+		Gid:      entry.GID,
+		Uname:    entry.Uname,
+		Gname:    entry.Gname,
+		Devmajor: int64(entry.DevMajor),
+		Devminor: int64(entry.DevMinor),
+		Format:   tar.FormatPAX,
+	}
+	switch entry.Type {
+	case "dir":
+		header.Typeflag = tar.TypeDir
+	case "reg":
+		header.Typeflag = tar.TypeReg
+		header.Size = entry.Size
+	case "symlink":
+		header.Typeflag = tar.TypeSymlink
+	case "hardlink":
+		header.Typeflag = tar.TypeLink
+	case "char":
+		header.Typeflag = tar.TypeChar
+	case "block":
+		header.Typeflag = tar.TypeBlock
+	case "fifo":
+		header.Typeflag = tar.TypeFifo
+	default:
+		return tar.Header{}, false
+	}
+	if entry.ModTime3339 != "" {
+		header.ModTime, _ = time.Parse(time.RFC3339, entry.ModTime3339)
+	}
+	for name, value := range entry.Xattrs {
+		if header.PAXRecords == nil {
+			header.PAXRecords = make(map[string]string)
+		}
+		header.PAXRecords["SCHILY.xattr."+name] = string(value)
+	}
+	return header, true
+}
+
+// open returns a reader for the contents of the given entry. Nothing is fetched until the first read, and each content
+// chunk is verified against the table of contents before it is returned.
+func (s *seekableLayer) open(entry *estargz.TOCEntry) io.ReadCloser {
+	if entry.Type != "reg" {
+		return ioutil.NopCloser(bytes.NewReader(nil))
+	}
+	return &seekableFileReader{
+		layer:  s,
+		entry:  entry,
+		chunks: s.chunks[entry.Name],
+	}
+}
+
+// seekableFileReader reads the contents of a single regular file within a seekable layer, one chunk at a time.
+type seekableFileReader struct {
+	layer   *seekableLayer
+	entry   *estargz.TOCEntry
+	content *io.SectionReader
+	chunks  []*estargz.TOCEntry
+	buf     []byte
+	err     error
+}
+
+func (r *seekableFileReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if len(r.chunks) == 0 {
+			return 0, io.EOF
+		}
+		chunk := r.chunks[0]
+		r.chunks = r.chunks[1:]
+		if chunk.ChunkSize == 0 {
+			continue
+		}
+		r.buf, r.err = r.readChunk(chunk)
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *seekableFileReader) readChunk(chunk *estargz.TOCEntry) ([]byte, error) {
+	if r.content == nil {
+		content, err := r.layer.reader.OpenFile(r.entry.Name)
+		if err != nil {
+			return nil, err
+		}
+		r.content = content
+	}
+	data := make([]byte, chunk.ChunkSize)
+	if n, err := r.content.ReadAt(data, chunk.ChunkOffset); n != len(data) {
+		return nil, fmt.Errorf("unable to read path=%q at offset=%d: %w", r.entry.Name, chunk.ChunkOffset, err)
+	}
+	verifier, err := r.layer.verifier.Verifier(chunk)
+	if err != nil {
+		return nil, err
+	}
+	_, _ = verifier.Write(data)
+	if !verifier.Verified() {
+		return nil, fmt.Errorf("%w: path=%q chunk at offset=%d", file.ErrDigestMismatch, r.entry.Name, chunk.ChunkOffset)
+	}
+	return data, nil
+}
+
+func (r *seekableFileReader) Close() error {
+	return nil
+}
+
+// blobReaderAt provides random access to a layer blob with a BlobRangeReader. Every fetch is at least
+// seekableLayerFetchSize bytes, and recently fetched ranges are kept in memory to serve subsequent nearby reads.
+type blobReaderAt struct {
+	lock    sync.Mutex
+	ctx     context.Context
+	read    BlobRangeReader
+	digest  v1.Hash
+	size    int64
+	windows []blobWindow
+}
+
+// blobWindow is a fetched range of a layer blob.
+type blobWindow struct {
+	offset int64
+	data   []byte
+}
+
+func (b *blobReaderAt) setContext(ctx context.Context) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.ctx = ctx
+}
+
+func (b *blobReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("invalid offset: %d", off)
+	}
+	if off >= b.size {
+		return 0, io.EOF
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	data, ok := b.cached(off, len(p))
+	if !ok {
+		length := int64(len(p))
+		if length < seekableLayerFetchSize {
+			length = seekableLayerFetchSize
+		}
+		if off+length > b.size {
+			length = b.size - off
+		}
+		fetched, err := b.fetch(off, length)
+		if err != nil {
+			return 0, err
+		}
+		b.windows = append([]blobWindow{{offset: off, data: fetched}}, b.windows...)
+		if len(b.windows) > seekableLayerWindows {
+			b.windows = b.windows[:seekableLayerWindows]
+		}
+		data = fetched
+	}
+
+	n := copy(p, data)
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// cached returns the already fetched content at the given offset (up to the given length or the end of the blob).
+func (b *blobReaderAt) cached(off int64, length int) ([]byte, bool) {
+	end := off + int64(length)
+	if end > b.size {
+		end = b.size
+	}
+	for _, w := range b.windows {
+		if off >= w.offset && end <= w.offset+int64(len(w.data)) {
+			return w.data[off-w.offset : end-w.offset], true
+		}
+	}
+	return nil, false
+}
+
+func (b *blobReaderAt) fetch(off, length int64) ([]byte, error) {
+	reader, err := b.read(b.ctx, b.digest, off, length)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch blob=%q range=%d-%d: %w", b.digest, off, off+length-1, err)
+	}
+	defer reader.Close()
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return nil, fmt.Errorf("unable to fetch blob=%q range=%d-%d: %w", b.digest, off, off+length-1, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,304 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+// testSeekableLayer is an eStargz layer that records how often the whole layer blob is fetched.
+type testSeekableLayer struct {
+	blob        []byte
+	diffID      v1.Hash
+	fullFetches int
+}
+
+func newTestSeekableLayer(t *testing.T, entries ...testTarEntry) (*testSeekableLayer, string) {
+	t.Helper()
+	blob, tocDigest := newTestSeekableBlob(t, 8, entries...)
+	gr, err := gzip.NewReader(bytes.NewReader(blob))
+	require.NoError(t, err)
+	uncompressed, err := ioutil.ReadAll(gr)
+	require.NoError(t, err)
+	diffID := v1.Hash{Algorithm: "sha256", Hex: fmt.Sprintf("%x", sha256.Sum256(uncompressed))}
+	return &testSeekableLayer{blob: blob, diffID: diffID}, tocDigest
+}
+
+// testMemberWriter writes each gzip member of the blob, where a new member may be started at any point.
+type testMemberWriter struct {
+	blob *bytes.Buffer
+	gw   *gzip.Writer
+}
+
+func (w *testMemberWriter) Write(p []byte) (int, error) {
+	return w.gw.Write(p)
+}
+
+// next closes the current gzip member and starts a new one, returning the offset of the new member.
+func (w *testMemberWriter) next(t *testing.T) int64 {
+	if w.gw != nil {
+		require.NoError(t, w.gw.Close())
+	}
+	w.gw = gzip.NewWriter(w.blob)
+	return int64(w.blob.Len())
+}
+
+// newTestSeekableBlob builds an eStargz blob for the given entries, where file contents are split into chunks of the
+// given size (each within a separate gzip member), returning the blob and the table of contents digest.
+func newTestSeekableBlob(t *testing.T, chunkSize int, entries ...testTarEntry) ([]byte, string) {
+	t.Helper()
+	w := &testMemberWriter{blob: &bytes.Buffer{}}
+	w.next(t)
+	tw := tar.NewWriter(w)
+	var toc estargz.JTOC
+	toc.Version = 1
+	for _, entry := range entries {
+		typeflag := entry.typeflag
+		if typeflag == 0 {
+			typeflag = tar.TypeReg
+		}
+		mode := entry.mode
+		if mode == 0 {
+			mode = 0644
+		}
+		var pax map[string]string
+		xattrs := make(map[string][]byte)
+		for name, value := range entry.xattrs {
+			if pax == nil {
+				pax = make(map[string]string)
+			}
+			pax["SCHILY.xattr."+name] = value
+			xattrs[name] = []byte(value)
+		}
+		require.NoError(t, tw.WriteHeader(&tar.Header{
+			Name:       entry.name,
+			PAXRecords: pax,
+			Linkname:   entry.linkname,
+			Size:       int64(len(entry.contents)),
+			Mode:       mode,
+			Typeflag:   typeflag,
+		}))
+
+		tocEntry := &estargz.TOCEntry{
+			Name:     entry.name,
+			LinkName: entry.linkname,
+			Mode:     mode,
+			Size:     int64(len(entry.contents)),
+			Xattrs:   xattrs,
+		}
+		switch typeflag {
+		case tar.TypeDir:
+			tocEntry.Type = "dir"
+		case tar.TypeSymlink:
+			tocEntry.Type = "symlink"
+		case tar.TypeLink:
+			tocEntry.Type = "hardlink"
+		default:
+			tocEntry.Type = "reg"
+			tocEntry.Digest = fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(entry.contents)))
+		}
+		toc.Entries = append(toc.Entries, tocEntry)
+
+		for offset := 0; offset < len(entry.contents); offset += chunkSize {
+			end := offset + chunkSize
+			if end > len(entry.contents) {
+				end = len(entry.contents)
+			}
+			chunk := &estargz.TOCEntry{
+				Name:        entry.name,
+				Type:        "chunk",
+				Offset:      w.next(t),
+				ChunkOffset: int64(offset),
+				ChunkSize:   int64(end - offset),
+				ChunkDigest: fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(entry.contents[offset:end]))),
+			}
+			if offset == 0 {
+				tocEntry.Offset, tocEntry.ChunkSize, tocEntry.ChunkDigest = chunk.Offset, chunk.ChunkSize, chunk.ChunkDigest
+			} else {
+				toc.Entries = append(toc.Entries, chunk)
+			}
+			_, err := tw.Write([]byte(entry.contents[offset:end]))
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, tw.Close())
+
+	tocJSON, err := json.Marshal(toc)
+	require.NoError(t, err)
+	tocOffset := w.next(t)
+	tocWriter := tar.NewWriter(w)
+	require.NoError(t, tocWriter.WriteHeader(&tar.Header{Name: estargz.TOCTarName, Size: int64(len(tocJSON)), Typeflag: tar.TypeReg}))
+	_, err = tocWriter.Write(tocJSON)
+	require.NoError(t, err)
+	require.NoError(t, tocWriter.Close())
+	require.NoError(t, w.gw.Close())
+
+	// the footer is an empty gzip member with the table of contents offset in the extra field (RFC 1952)
+	subfield := fmt.Sprintf("%016xSTARGZ", tocOffset)
+	footer := []byte{0x1f, 0x8b, 0x08, 0x04, 0, 0, 0, 0, 0, 0xff, byte(len(subfield) + 4), 0, 'S', 'G', byte(len(subfield)), 0}
+	footer = append(footer, subfield...)
+	// an empty stored deflate block, followed by the (zero) checksum and size
+	footer = append(footer, 0x01, 0x00, 0x00, 0xff, 0xff, 0, 0, 0, 0, 0, 0, 0, 0)
+	require.Len(t, footer, estargz.FooterSize)
+	w.blob.Write(footer)
+
+	return w.blob.Bytes(), fmt.Sprintf("sha256:%x", sha256.Sum256(tocJSON))
+}
+
+func (l *testSeekableLayer) Digest() (v1.Hash, error) {
+	return v1.Hash{Algorithm: "sha256", Hex: fmt.Sprintf("%x", sha256.Sum256(l.blob))}, nil
+}
+
+func (l *testSeekableLayer) DiffID() (v1.Hash, error) {
+	return l.diffID, nil
+}
+
+func (l *testSeekableLayer) Compressed() (io.ReadCloser, error) {
+	l.fullFetches++
+	return ioutil.NopCloser(bytes.NewReader(l.blob)), nil
+}
+
+func (l *testSeekableLayer) Uncompressed() (io.ReadCloser, error) {
+	l.fullFetches++
+	return gzip.NewReader(bytes.NewReader(l.blob))
+}
+
+func (l *testSeekableLayer) Size() (int64, error) {
+	return int64(len(l.blob)), nil
+}
+
+func (l *testSeekableLayer) MediaType() (types.MediaType, error) {
+	return types.OCILayer, nil
+}
+
+func (l *testSeekableLayer) rangeReader(ranges *int) BlobRangeReader {
+	return func(_ context.Context, digest v1.Hash, offset, length int64) (io.ReadCloser, error) {
+		if expected, _ := l.Digest(); digest != expected {
+			return nil, fmt.Errorf("unexpected blob=%q", digest)
+		}
+		*ranges++
+		return ioutil.NopCloser(bytes.NewReader(l.blob[offset : offset+length])), nil
+	}
+}
+
+// newTestSeekableImage returns the image of the given layer (annotated with the given table of contents digest) read
+// with the given options, where the layer blob is read with the given range reader.
+func newTestSeekableImage(t *testing.T, layer v1.Layer, tocDigest string, rangeReader BlobRangeReader, options ...ReadOption) *Image {
+	t.Helper()
+	v1Image, err := mutate.Append(empty.Image, mutate.Addendum{
+		Layer:       layer,
+		Annotations: map[string]string{estargz.TOCJSONDigestAnnotation: tocDigest},
+	})
+	require.NoError(t, err)
+	manifest, err := v1Image.RawManifest()
+	require.NoError(t, err)
+	img := NewImage(v1Image, t.TempDir(), WithManifest(manifest), WithBlobRangeReader(rangeReader))
+	require.NoError(t, img.Read(options...))
+	return img
+}
+
+func TestImage_SeekableLayers(t *testing.T) {
+	large := strings.Repeat("0123456789", 10)
+	layer, tocDigest := newTestSeekableLayer(t,
+		testTarEntry{name: "etc/", typeflag: tar.TypeDir, mode: 0755},
+		testTarEntry{name: "etc/os-release", contents: "ID=test"},
+		testTarEntry{name: "usr/bin/tool", contents: large, mode: 04755, xattrs: map[string]string{"security.capability": "cap"}},
+		testTarEntry{name: "usr/bin/alias", linkname: "usr/bin/tool", typeflag: tar.TypeLink},
+		testTarEntry{name: "usr/lib/os-release", linkname: "../../etc/os-release", typeflag: tar.TypeSymlink},
+		testTarEntry{name: "var/empty", contents: ""},
+	)
+	var ranges int
+	img := newTestSeekableImage(t, layer, tocDigest, layer.rangeReader(&ranges))
+
+	// the layer is read from the table of contents without fetching the whole blob
+	assert.Zero(t, layer.fullFetches)
+	assert.NotZero(t, ranges)
+	assert.Equal(t, layer.diffID.String(), img.Layers[0].Metadata.Digest)
+
+	for p, expected := range map[file.Path]string{
+		"/etc/os-release":     "ID=test",
+		"/usr/bin/tool":       large,
+		"/usr/bin/alias":      large,
+		"/usr/lib/os-release": "ID=test",
+		"/var/empty":          "",
+	} {
+		reader, err := img.FileContentsFromSquash(p)
+		require.NoError(t, err, p)
+		contents, err := ioutil.ReadAll(reader)
+		require.NoError(t, err, p)
+		assert.Equal(t, expected, string(contents), p)
+	}
+
+	exists, ref, err := img.SquashedTree().File("/usr/bin/tool")
+	require.NoError(t, err)
+	require.True(t, exists)
+	entry, err := img.FileCatalog.Get(*ref)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(large)), entry.Metadata.Size)
+	assert.NotZero(t, entry.Metadata.Mode&os.ModeSetuid)
+	assert.Equal(t, []byte("cap"), entry.Metadata.Xattrs["security.capability"])
+	assert.Equal(t, "text/plain", entry.Metadata.MIMEType)
+	assert.Zero(t, layer.fullFetches)
+}
+
+func TestImage_SeekableLayers_Verification(t *testing.T) {
+	contents := strings.Repeat("a", 64)
+	layer, tocDigest := newTestSeekableLayer(t, testTarEntry{name: "data", contents: contents})
+
+	t.Run("table of contents mismatch falls back to the whole blob", func(t *testing.T) {
+		var ranges int
+		mismatch := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("other")))
+		img := newTestSeekableImage(t, layer, mismatch, layer.rangeReader(&ranges))
+		assert.NotZero(t, layer.fullFetches)
+
+		reader, err := img.FileContentsFromSquash("/data")
+		require.NoError(t, err)
+		actual, err := ioutil.ReadAll(reader)
+		require.NoError(t, err)
+		assert.Equal(t, contents, string(actual))
+	})
+
+	t.Run("tampered content is not returned", func(t *testing.T) {
+		// same sized content results in the same blob layout, so the table of contents is spliced onto other content
+		other, _ := newTestSeekableLayer(t, testTarEntry{name: "data", contents: strings.Repeat("b", 64)})
+		tocOffset, _, err := estargz.OpenFooter(io.NewSectionReader(bytes.NewReader(layer.blob), 0, int64(len(layer.blob))))
+		require.NoError(t, err)
+		otherTOCOffset, _, err := estargz.OpenFooter(io.NewSectionReader(bytes.NewReader(other.blob), 0, int64(len(other.blob))))
+		require.NoError(t, err)
+		require.Equal(t, tocOffset, otherTOCOffset)
+		tampered := &testSeekableLayer{
+			blob:   append(append([]byte(nil), other.blob[:tocOffset]...), layer.blob[tocOffset:]...),
+			diffID: layer.diffID,
+		}
+
+		var ranges int
+		img := newTestSeekableImage(t, tampered, tocDigest, tampered.rangeReader(&ranges), WithMIMETypeDetector(nil, 0))
+		assert.Zero(t, tampered.fullFetches)
+
+		reader, err := img.FileContentsFromSquash("/data")
+		require.NoError(t, err)
+		_, err = ioutil.ReadAll(reader)
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, file.ErrDigestMismatch), err.Error())
+	})
+}
@@ -0,0 +1,113 @@
+package image
+
+import (
+	"fmt"
+)
+
+// SharedBaseReport describes how the layers of a set of images overlap (see SharedBase), e.g. for fleet-level storage
+// and patching analyses. Layers are compared by chain ID (the layer and every layer below it), so the same layer
+// content on top of a different base is not considered shared.
+type SharedBaseReport struct {
+	// BaseLayers are the layers of the longest layer prefix common to all images (lowest layer first)
+	BaseLayers []LayerMetadata `json:"baseLayers"`
+	// BaseBytes is the combined size of the shared base layers
+	BaseBytes int64 `json:"baseBytes"`
+	// Images describe the layers of each image above the shared base (in the order given)
+	Images []SharedBaseImage `json:"images"`
+	// UniqueBytes is the combined size of all distinct layers over all images (each layer counted once regardless of
+	// how many images include it), which is the storage needed for all images
+	UniqueBytes int64 `json:"uniqueBytes"`
+	// TotalBytes is the combined size of the layers of every image (each layer counted once per image including it)
+	TotalBytes int64 `json:"totalBytes"`
+}
+
+// SharedBaseImage describes the layers of a single image above the shared base.
+type SharedBaseImage struct {
+	ImageID string `json:"imageID"`
+	// SharedLayers are the layers above the shared base that are also within some (but not all) other images
+	SharedLayers []LayerMetadata `json:"sharedLayers"`
+	// UniqueLayers are the layers that are not within any other image
+	UniqueLayers []LayerMetadata `json:"uniqueLayers"`
+	// UniqueBytes is the combined size of the unique layers (the storage reclaimed by removing only this image)
+	UniqueBytes int64 `json:"uniqueBytes"`
+}
+
+// SharedBase computes the common layer prefix (shared base) of the given images, the layers of each image beyond the
+// shared base, and the aggregate size of all distinct layers. Only layer metadata is used (so the images may have been
+// read with unavailable layers, see WithMissingLayersAllowed), however, every layer must have a digest.
+func SharedBase(images ...*Image) (*SharedBaseReport, error) {
+	if len(images) == 0 {
+		return nil, fmt.Errorf("no images given")
+	}
+
+	chains := make([][]string, len(images))
+	// imageCounts is the number of images including each layer (by chain ID)
+	imageCounts := make(map[string]int)
+	report := &SharedBaseReport{
+		BaseLayers: []LayerMetadata{},
+		Images:     make([]SharedBaseImage, 0, len(images)),
+	}
+	for idx, img := range images {
+		if img == nil {
+			return nil, fmt.Errorf("no image at position=%d", idx)
+		}
+		var last string
+		for _, layer := range img.Layers {
+			if layer.Metadata.Digest == "" {
+				return nil, fmt.Errorf("image=%q has a layer without a digest", img.Metadata.ID)
+			}
+			last = nextChainID(last, layer.Metadata.Digest)
+			chains[idx] = append(chains[idx], last)
+			report.TotalBytes += layer.Metadata.Size
+		}
+		// a repeated layer has a different chain ID at each position, so every chain ID is only counted once per image
+		for _, chainID := range chains[idx] {
+			imageCounts[chainID]++
+		}
+	}
+
+	base := len(chains[0])
+	for _, chain := range chains[1:] {
+		base = sharedPrefix(chains[0][:base], chain)
+	}
+	for _, layer := range images[0].Layers[:base] {
+		report.BaseLayers = append(report.BaseLayers, layer.Metadata)
+		report.BaseBytes += layer.Metadata.Size
+	}
+
+	distinct := make(map[string]struct{})
+	for idx, img := range images {
+		summary := SharedBaseImage{
+			ImageID:      img.Metadata.ID,
+			SharedLayers: []LayerMetadata{},
+			UniqueLayers: []LayerMetadata{},
+		}
+		for pos, layer := range img.Layers {
+			chainID := chains[idx][pos]
+			if _, ok := distinct[chainID]; !ok {
+				distinct[chainID] = struct{}{}
+				report.UniqueBytes += layer.Metadata.Size
+			}
+			if pos < base {
+				continue
+			}
+			if imageCounts[chainID] > 1 {
+				summary.SharedLayers = append(summary.SharedLayers, layer.Metadata)
+			} else {
+				summary.UniqueLayers = append(summary.UniqueLayers, layer.Metadata)
+				summary.UniqueBytes += layer.Metadata.Size
+			}
+		}
+		report.Images = append(report.Images, summary)
+	}
+	return report, nil
+}
+
+// sharedPrefix returns the number of leading chain IDs that are the same within both chains.
+func sharedPrefix(a, b []string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
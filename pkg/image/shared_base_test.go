@@ -0,0 +1,78 @@
+package image
+
+import (
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSharedBase(t *testing.T) {
+	layer := func(name string) v1.Layer {
+		return newTestTarLayer(t, testTarEntry{name: name, contents: name + " contents"})
+	}
+	base1, base2 := layer("base-1"), layer("base-2")
+	app, web, tool := layer("app"), layer("web"), layer("tool")
+
+	appImg := newTestImageFromLayers(t, []v1.Layer{base1, base2, app})
+	webImg := newTestImageFromLayers(t, []v1.Layer{base1, base2, web, tool})
+	// the same layer with a different base is not shared
+	toolImg := newTestImageFromLayers(t, []v1.Layer{base1, base2, web, app})
+
+	size := func(img *Image, idx int) int64 {
+		return img.Layers[idx].Metadata.Size
+	}
+	digests := func(layers []LayerMetadata) []string {
+		var result []string
+		for _, l := range layers {
+			result = append(result, l.Digest)
+		}
+		return result
+	}
+
+	report, err := SharedBase(appImg, webImg, toolImg)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{appImg.Layers[0].Metadata.Digest, appImg.Layers[1].Metadata.Digest}, digests(report.BaseLayers))
+	assert.Equal(t, size(appImg, 0)+size(appImg, 1), report.BaseBytes)
+	require.Len(t, report.Images, 3)
+
+	assert.Equal(t, appImg.Metadata.ID, report.Images[0].ImageID)
+	assert.Empty(t, report.Images[0].SharedLayers)
+	assert.Equal(t, []string{appImg.Layers[2].Metadata.Digest}, digests(report.Images[0].UniqueLayers))
+	assert.Equal(t, size(appImg, 2), report.Images[0].UniqueBytes)
+
+	// the web layer is shared with the tool image (on the same base)
+	assert.Equal(t, []string{webImg.Layers[2].Metadata.Digest}, digests(report.Images[1].SharedLayers))
+	assert.Equal(t, []string{webImg.Layers[3].Metadata.Digest}, digests(report.Images[1].UniqueLayers))
+	assert.Equal(t, []string{toolImg.Layers[2].Metadata.Digest}, digests(report.Images[2].SharedLayers))
+	assert.Equal(t, []string{toolImg.Layers[3].Metadata.Digest}, digests(report.Images[2].UniqueLayers))
+
+	// base (2) + app + web + tool + app (above web)
+	expectedUnique := report.BaseBytes + size(appImg, 2) + size(webImg, 2) + size(webImg, 3) + size(toolImg, 3)
+	assert.Equal(t, expectedUnique, report.UniqueBytes)
+	assert.Equal(t, report.BaseBytes*3+size(appImg, 2)+size(webImg, 2)+size(webImg, 3)+size(toolImg, 2)+size(toolImg, 3), report.TotalBytes)
+}
+
+func TestSharedBase_NoCommonBase(t *testing.T) {
+	a := newTestImageFromLayers(t, []v1.Layer{newTestTarLayer(t, testTarEntry{name: "a", contents: "a"})})
+	b := newTestImageFromLayers(t, []v1.Layer{newTestTarLayer(t, testTarEntry{name: "b", contents: "b"})})
+
+	report, err := SharedBase(a, b)
+	require.NoError(t, err)
+	assert.Empty(t, report.BaseLayers)
+	assert.Zero(t, report.BaseBytes)
+	assert.Len(t, report.Images[0].UniqueLayers, 1)
+	assert.Len(t, report.Images[1].UniqueLayers, 1)
+	assert.Equal(t, report.TotalBytes, report.UniqueBytes)
+
+	// a single image is its own base
+	report, err = SharedBase(a)
+	require.NoError(t, err)
+	assert.Len(t, report.BaseLayers, 1)
+	assert.Empty(t, report.Images[0].UniqueLayers)
+
+	_, err = SharedBase()
+	assert.Error(t, err)
+}
@@ -0,0 +1,191 @@
+package image
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	// CosignSignatureMediaType is the layer media type of a cosign "simple signing" payload, the signature over the
+	// payload is stored in the layer annotations.
+	CosignSignatureMediaType = "application/vnd.dev.cosign.simplesigning.v1+json"
+	// DSSEEnvelopeMediaType is the layer media type of a DSSE envelope wrapping an in-toto statement (as attached by
+	// `cosign attest`).
+	DSSEEnvelopeMediaType = "application/vnd.dsse.envelope.v1+json"
+	// InTotoMediaType is the layer media type of an unsigned in-toto statement.
+	InTotoMediaType = "application/vnd.in-toto+json"
+
+	// annotations describing cosign signatures and attestations
+	cosignSignatureAnnotation   = "dev.cosignproject.cosign/signature"
+	cosignCertificateAnnotation = "dev.sigstore.cosign/certificate"
+	cosignChainAnnotation       = "dev.sigstore.cosign/chain"
+	cosignBundleAnnotation      = "dev.sigstore.cosign/bundle"
+	predicateTypeAnnotation     = "predicateType"
+	inTotoPredicateAnnotation   = "in-toto.io/predicate-type"
+)
+
+// Signature is a cosign-style signature attached to an image (e.g. pushed with `cosign sign`). Signatures are only
+// retrieved, they are not verified.
+type Signature struct {
+	// MediaType of the signed payload (e.g. CosignSignatureMediaType)
+	MediaType string
+	// Digest of the signed payload blob
+	Digest string
+	// ArtifactDigest is the digest of the artifact manifest that contained the signature
+	ArtifactDigest string
+	// Payload is the raw signed payload (for cosign, a "simple signing" JSON document naming the image digest)
+	Payload []byte
+	// Signature is the base64 encoded signature over the payload
+	Signature string
+	// Certificate is the PEM encoded signing certificate (empty for key-based signatures)
+	Certificate string
+	// Chain is the PEM encoded certificate chain of the signing certificate (empty for key-based signatures)
+	Chain string
+	// Bundle is the raw transparency log bundle (empty when the signature was not uploaded to a transparency log)
+	Bundle string
+	// Annotations are all annotations of the signature layer
+	Annotations map[string]string
+}
+
+// Attestation is an in-toto attestation attached to an image (e.g. pushed with `cosign attest`), either wrapped within
+// a DSSE envelope or as an unsigned statement. Attestations are only retrieved, they are not verified.
+type Attestation struct {
+	// MediaType of the attestation (e.g. DSSEEnvelopeMediaType or InTotoMediaType)
+	MediaType string
+	// Digest of the attestation blob
+	Digest string
+	// ArtifactDigest is the digest of the artifact manifest that contained the attestation
+	ArtifactDigest string
+	// PredicateType is the type of the attested predicate (e.g. "https://slsa.dev/provenance/v0.2"), when it is known
+	// from the layer annotations
+	PredicateType string
+	// Content is the raw attestation (the DSSE envelope or the in-toto statement)
+	Content []byte
+	// Annotations are all annotations of the attestation layer
+	Annotations map[string]string
+}
+
+// InTotoStatement is an in-toto attestation statement (see https://github.com/in-toto/attestation).
+type InTotoStatement struct {
+	Type          string          `json:"_type"`
+	PredicateType string          `json:"predicateType"`
+	Subject       []InTotoSubject `json:"subject"`
+	// Predicate is the raw predicate document, interpreted according to the predicate type
+	Predicate json.RawMessage `json:"predicate"`
+}
+
+// InTotoSubject is an artifact an in-toto statement applies to.
+type InTotoSubject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// dsseEnvelope is a DSSE envelope, the signatures are not needed to read the statement.
+type dsseEnvelope struct {
+	PayloadType string `json:"payloadType"`
+	Payload     string `json:"payload"`
+}
+
+// SignatureFetcher fetches all signatures associated with an image.
+type SignatureFetcher func(ctx context.Context) ([]Signature, error)
+
+// AttestationFetcher fetches all attestations associated with an image.
+type AttestationFetcher func(ctx context.Context) ([]Attestation, error)
+
+// NewSignature returns the signature described by the given signature layer media type, content, and annotations.
+func NewSignature(mediaType string, content []byte, annotations map[string]string) Signature {
+	return Signature{
+		MediaType:   mediaType,
+		Payload:     content,
+		Signature:   annotations[cosignSignatureAnnotation],
+		Certificate: annotations[cosignCertificateAnnotation],
+		Chain:       annotations[cosignChainAnnotation],
+		Bundle:      annotations[cosignBundleAnnotation],
+		Annotations: annotations,
+	}
+}
+
+// NewAttestation returns the attestation described by the given attestation layer media type, content, and
+// annotations.
+func NewAttestation(mediaType string, content []byte, annotations map[string]string) Attestation {
+	predicateType := annotations[predicateTypeAnnotation]
+	if predicateType == "" {
+		predicateType = annotations[inTotoPredicateAnnotation]
+	}
+	return Attestation{
+		MediaType:     mediaType,
+		PredicateType: predicateType,
+		Content:       content,
+		Annotations:   annotations,
+	}
+}
+
+// IsSignatureMediaType indicates if the given layer media type describes a cosign signature payload.
+func IsSignatureMediaType(mediaType string) bool {
+	return strings.EqualFold(strings.TrimSpace(mediaType), CosignSignatureMediaType)
+}
+
+// IsAttestationMediaType indicates if the given layer media type describes an in-toto attestation (signed or not).
+func IsAttestationMediaType(mediaType string) bool {
+	mediaType = strings.TrimSpace(mediaType)
+	return strings.EqualFold(mediaType, DSSEEnvelopeMediaType) || strings.EqualFold(mediaType, InTotoMediaType)
+}
+
+// Statement decodes the in-toto statement of the attestation (unwrapping the DSSE envelope if needed).
+func (a Attestation) Statement() (InTotoStatement, error) {
+	content := a.Content
+	if strings.EqualFold(a.MediaType, DSSEEnvelopeMediaType) {
+		var envelope dsseEnvelope
+		if err := json.Unmarshal(a.Content, &envelope); err != nil {
+			return InTotoStatement{}, fmt.Errorf("unable to parse DSSE envelope: %w", err)
+		}
+		payload, err := base64.StdEncoding.DecodeString(envelope.Payload)
+		if err != nil {
+			return InTotoStatement{}, fmt.Errorf("unable to decode DSSE payload: %w", err)
+		}
+		content = payload
+	}
+
+	var statement InTotoStatement
+	if err := json.Unmarshal(content, &statement); err != nil {
+		return InTotoStatement{}, fmt.Errorf("unable to parse in-toto statement: %w", err)
+	}
+	return statement, nil
+}
+
+// WithSignatureFetcher associates a source of signatures with the image (see Image.Signatures).
+func WithSignatureFetcher(fetcher SignatureFetcher) AdditionalMetadata {
+	return func(image *Image) error {
+		image.signatureFetcher = fetcher
+		return nil
+	}
+}
+
+// WithAttestationFetcher associates a source of attestations with the image (see Image.Attestations).
+func WithAttestationFetcher(fetcher AttestationFetcher) AdditionalMetadata {
+	return func(image *Image) error {
+		image.attestationFetcher = fetcher
+		return nil
+	}
+}
+
+// Signatures fetches all signatures associated with the image. Only some image sources support this (e.g. images
+// fetched from a registry with cosign signatures attached), otherwise no signatures are returned.
+func (i *Image) Signatures(ctx context.Context) ([]Signature, error) {
+	if i.signatureFetcher == nil {
+		return nil, nil
+	}
+	return i.signatureFetcher(ctx)
+}
+
+// Attestations fetches all attestations associated with the image. Only some image sources support this (e.g. images
+// fetched from a registry with in-toto attestations attached), otherwise no attestations are returned.
+func (i *Image) Attestations(ctx context.Context) ([]Attestation, error) {
+	if i.attestationFetcher == nil {
+		return nil, nil
+	}
+	return i.attestationFetcher(ctx)
+}
@@ -0,0 +1,72 @@
+package image
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAttestation_Statement(t *testing.T) {
+	statement := `{"_type":"https://in-toto.io/Statement/v0.1","predicateType":"https://slsa.dev/provenance/v0.2","subject":[{"name":"example","digest":{"sha256":"abc"}}],"predicate":{"builder":{"id":"ci"}}}`
+	tests := []struct {
+		name        string
+		attestation Attestation
+		wantErr     bool
+	}{
+		{
+			name:        "unsigned statement",
+			attestation: NewAttestation(InTotoMediaType, []byte(statement), nil),
+		},
+		{
+			name:        "DSSE envelope",
+			attestation: NewAttestation(DSSEEnvelopeMediaType, []byte(`{"payloadType":"application/vnd.in-toto+json","payload":"`+base64.StdEncoding.EncodeToString([]byte(statement))+`"}`), nil),
+		},
+		{
+			name:        "DSSE envelope with an invalid payload",
+			attestation: NewAttestation(DSSEEnvelopeMediaType, []byte(`{"payload":"not base64!"}`), nil),
+			wantErr:     true,
+		},
+		{
+			name:        "invalid statement",
+			attestation: NewAttestation(InTotoMediaType, []byte(`not json`), nil),
+			wantErr:     true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := test.attestation.Statement()
+			if test.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "https://slsa.dev/provenance/v0.2", actual.PredicateType)
+			require.Len(t, actual.Subject, 1)
+			assert.Equal(t, map[string]string{"sha256": "abc"}, actual.Subject[0].Digest)
+			assert.JSONEq(t, `{"builder":{"id":"ci"}}`, string(actual.Predicate))
+		})
+	}
+}
+
+func TestNewSignatureAndAttestation(t *testing.T) {
+	signature := NewSignature(CosignSignatureMediaType, []byte("payload"), map[string]string{
+		"dev.cosignproject.cosign/signature": "sig",
+		"dev.sigstore.cosign/chain":          "chain",
+		"dev.sigstore.cosign/bundle":         "bundle",
+	})
+	assert.Equal(t, "sig", signature.Signature)
+	assert.Equal(t, "chain", signature.Chain)
+	assert.Equal(t, "bundle", signature.Bundle)
+	assert.Empty(t, signature.Certificate)
+
+	assert.Equal(t, "https://spdx.dev/Document", NewAttestation(InTotoMediaType, nil, map[string]string{"in-toto.io/predicate-type": "https://spdx.dev/Document"}).PredicateType)
+	assert.Equal(t, "https://slsa.dev/provenance/v0.2", NewAttestation(DSSEEnvelopeMediaType, nil, map[string]string{"predicateType": "https://slsa.dev/provenance/v0.2"}).PredicateType)
+
+	assert.True(t, IsSignatureMediaType(CosignSignatureMediaType))
+	assert.False(t, IsSignatureMediaType(DSSEEnvelopeMediaType))
+	assert.True(t, IsAttestationMediaType(DSSEEnvelopeMediaType))
+	assert.True(t, IsAttestationMediaType(InTotoMediaType))
+	assert.False(t, IsAttestationMediaType("application/spdx+json"))
+}
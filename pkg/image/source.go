@@ -5,8 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"path"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -28,10 +30,24 @@ const (
 	OciRegistrySource
 	PodmanDaemonSource
 	SingularitySource
+	HTTPTarballSource
+	ObjectStoreSource
+	DockerStorageSource
+	ContainerdStoreSource
+	ContainersStorageSource
 )
 
 const SchemeSeparator = ":"
 
+// ObjectStoreSchemes are the URI schemes for image archives within cloud object stores (e.g. "s3://bucket/image.tar"),
+// following the conventions of gocloud.dev: "s3" for AWS S3, "gs" for Google Cloud Storage, and "azblob" for Azure
+// blob storage. Fetching from these requires an object store client for the scheme (see stereoscope.WithObjectStore).
+var ObjectStoreSchemes = []string{"s3", "gs", "azblob"}
+
+// FileURIScheme is the URI scheme for local image archives and directories (e.g. "file:///path/to/image.tar"), where
+// the source is determined from the content found at the path.
+const FileURIScheme = "file"
+
 var sourceStr = [...]string{
 	"UnknownSource",
 	"DockerTarball",
@@ -41,6 +57,11 @@ var sourceStr = [...]string{
 	"OciRegistry",
 	"PodmanDaemon",
 	"Singularity",
+	"HTTPTarball",
+	"ObjectStore",
+	"DockerStorage",
+	"ContainerdStore",
+	"ContainersStorage",
 }
 
 var AllSources = []Source{
@@ -51,6 +72,11 @@ var AllSources = []Source{
 	OciRegistrySource,
 	PodmanDaemonSource,
 	SingularitySource,
+	HTTPTarballSource,
+	ObjectStoreSource,
+	DockerStorageSource,
+	ContainerdStoreSource,
+	ContainersStorageSource,
 }
 
 // Source is a concrete a selection of valid concrete image providers.
@@ -82,6 +108,12 @@ func ParseSourceScheme(source string) Source {
 		return OciRegistrySource
 	case "singularity":
 		return SingularitySource
+	case "docker-storage":
+		return DockerStorageSource
+	case "containerd-store":
+		return ContainerdStoreSource
+	case "containers-storage":
+		return ContainersStorageSource
 	}
 	return UnknownSource
 }
@@ -95,6 +127,18 @@ func DetectSource(userInput string) (Source, string, error) {
 // DetectSource takes a user string and determines the image source (e.g. the docker daemon, a tar file, etc.) returning the string subset representing the image (or nothing if it is unknown).
 // note: parsing is done relative to the given string and environmental evidence (i.e. the given filesystem) to determine the actual source.
 func detectSource(fs afero.Fs, userInput string) (Source, string, error) {
+	if isFileURI(userInput) {
+		return detectSourceFromFileURI(fs, userInput)
+	}
+	if isObjectStoreURL(userInput) {
+		// the archive format is determined once the object has been fetched
+		return ObjectStoreSource, userInput, nil
+	}
+	if isHTTPURL(userInput) {
+		// the archive format is determined once the archive has been fetched
+		return HTTPTarballSource, userInput, nil
+	}
+
 	candidates := strings.SplitN(userInput, SchemeSeparator, 2)
 
 	var source = UnknownSource
@@ -131,6 +175,62 @@ func detectSource(fs afero.Fs, userInput string) (Source, string, error) {
 	return source, location, nil
 }
 
+// isFileURI indicates if the given user input is a file URI (e.g. "file:///path/to/image.tar").
+func isFileURI(userInput string) bool {
+	prefix := FileURIScheme + "://"
+	return len(userInput) >= len(prefix) && strings.EqualFold(userInput[:len(prefix)], prefix)
+}
+
+// isHTTPURL indicates if the given user input is an HTTP(S) URL (e.g. "https://example.com/image.tar").
+func isHTTPURL(userInput string) bool {
+	for _, prefix := range []string{"http://", "https://"} {
+		if len(userInput) >= len(prefix) && strings.EqualFold(userInput[:len(prefix)], prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isObjectStoreURL indicates if the given user input is an object store URL (see ObjectStoreSchemes).
+func isObjectStoreURL(userInput string) bool {
+	for _, scheme := range ObjectStoreSchemes {
+		prefix := scheme + "://"
+		if len(userInput) >= len(prefix) && strings.EqualFold(userInput[:len(prefix)], prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// detectSourceFromFileURI determines the image source from the content found at the (percent-decoded) path of the
+// given file URI. Since a file URI always refers to local content, a path that does not exist or that is not a
+// supported image archive or directory is an error.
+func detectSourceFromFileURI(fs afero.Fs, uri string) (Source, string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return UnknownSource, "", fmt.Errorf("unable to parse file URI=%q: %w", uri, err)
+	}
+	if u.Host != "" && !strings.EqualFold(u.Host, "localhost") {
+		return UnknownSource, "", fmt.Errorf("file URI=%q refers to a remote host=%q, only local paths are supported", uri, u.Host)
+	}
+	if u.Path == "" {
+		return UnknownSource, "", fmt.Errorf("file URI=%q has no path", uri)
+	}
+	location := filepath.FromSlash(u.Path)
+
+	if _, err := fs.Stat(location); err != nil {
+		return UnknownSource, "", fmt.Errorf("unable to find path=%q from file URI=%q: %w", location, uri, err)
+	}
+	source, err := detectSourceFromPath(fs, location)
+	if err != nil {
+		return UnknownSource, "", err
+	}
+	if source == UnknownSource {
+		return UnknownSource, "", fmt.Errorf("path=%q from file URI=%q is not a supported image archive or directory", location, uri)
+	}
+	return source, location, nil
+}
+
 // DetermineDefaultImagePullSource takes an image reference string as input, and
 // determines a Source to use to pull the image. If the input doesn't specify an
 // image reference (i.e. an image that can be _pulled_), UnknownSource is
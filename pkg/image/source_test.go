@@ -159,6 +159,64 @@ func TestDetectSource(t *testing.T) {
 			source:           SingularitySource,
 			expectedLocation: "~/a-potential/path.sif",
 		},
+		{
+			name:             "s3-archive",
+			input:            "s3://bucket/images/image.tar",
+			source:           ObjectStoreSource,
+			expectedLocation: "s3://bucket/images/image.tar",
+		},
+		{
+			name:             "gcs-archive",
+			input:            "gs://bucket/image.tar",
+			source:           ObjectStoreSource,
+			expectedLocation: "gs://bucket/image.tar",
+		},
+		{
+			name:             "azure-archive",
+			input:            "azblob://container/image.tar",
+			source:           ObjectStoreSource,
+			expectedLocation: "azblob://container/image.tar",
+		},
+		{
+			name:             "https-archive",
+			input:            "https://example.com/images/image.tar",
+			source:           HTTPTarballSource,
+			expectedLocation: "https://example.com/images/image.tar",
+		},
+		{
+			name:             "http-archive",
+			input:            "HTTP://example.com:8080/image.tar?token=abc",
+			source:           HTTPTarballSource,
+			expectedLocation: "HTTP://example.com:8080/image.tar?token=abc",
+		},
+		{
+			name:             "file-uri-docker-archive",
+			input:            "file:///some/image%20archive.tar",
+			fs:               getDummyTar(t, "/some/image archive.tar", "manifest.json"),
+			source:           DockerTarballSource,
+			expectedLocation: "/some/image archive.tar",
+		},
+		{
+			name:             "file-uri-oci-archive",
+			input:            "FILE://localhost/some/image.tar",
+			fs:               getDummyTar(t, "/some/image.tar", "oci-layout"),
+			source:           OciTarballSource,
+			expectedLocation: "/some/image.tar",
+		},
+		{
+			name:             "file-uri-oci-directory",
+			input:            "file:///some/oci%2Dlayout%20dir",
+			fs:               getDummyDir(t, "/some/oci-layout dir", "oci-layout"),
+			source:           OciDirectorySource,
+			expectedLocation: "/some/oci-layout dir",
+		},
+		{
+			name:             "file-uri-singularity",
+			input:            "file:///some/image.sif",
+			fs:               getDummySIF(t, "/some/image.sif"),
+			source:           SingularitySource,
+			expectedLocation: "/some/image.sif",
+		},
 	}
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
@@ -272,6 +330,18 @@ func TestParseScheme(t *testing.T) {
 			source:   "oci-directory",
 			expected: UnknownSource,
 		},
+		{
+			source:   "docker-storage",
+			expected: DockerStorageSource,
+		},
+		{
+			source:   "containerd-store",
+			expected: ContainerdStoreSource,
+		},
+		{
+			source:   "containers-storage",
+			expected: ContainersStorageSource,
+		},
 		{
 			source:   "",
 			expected: UnknownSource,
@@ -289,6 +359,61 @@ func TestParseScheme(t *testing.T) {
 	}
 }
 
+func TestDetectSource_FileURIErrors(t *testing.T) {
+	cases := []struct {
+		name    string
+		fs      afero.Fs
+		input   string
+		wantErr string
+	}{
+		{
+			name:    "missing path",
+			input:   "file:///does-not-exist.tar",
+			wantErr: "unable to find path",
+		},
+		{
+			name:    "remote host",
+			input:   "file://somehost/image.tar",
+			wantErr: "only local paths are supported",
+		},
+		{
+			name:    "no path",
+			input:   "file://",
+			wantErr: "has no path",
+		},
+		{
+			name:    "invalid escape",
+			input:   "file:///image%zz.tar",
+			wantErr: "unable to parse file URI",
+		},
+		{
+			name:    "unsupported directory",
+			input:   "file:///some/dir",
+			fs:      getDummyDir(t, "/some/dir", "rootfs"),
+			wantErr: "not a supported image archive or directory",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fs := c.fs
+			if c.fs == nil {
+				fs = afero.NewMemMapFs()
+			}
+
+			source, location, err := detectSource(fs, c.input)
+			if err == nil {
+				t.Fatalf("expected an error, got source=%q location=%q", source, location)
+			}
+			if !strings.Contains(err.Error(), c.wantErr) {
+				t.Errorf("expected error containing %q, got: %+v", c.wantErr, err)
+			}
+			if source != UnknownSource {
+				t.Errorf("expected unknown source, got: %q", source)
+			}
+		})
+	}
+}
+
 func TestDetectSourceFromPath(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -0,0 +1,185 @@
+package image
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree"
+	"github.com/anchore/stereoscope/pkg/filetree/filenode"
+)
+
+// sqliteSchema is the schema written by ExportSQLite. Files are recorded once per layer tree they appear in, with
+// in_squash indicating if the file is visible within the image squash tree.
+var sqliteSchema = []string{
+	`CREATE TABLE image (
+		id TEXT NOT NULL,
+		manifest_digest TEXT,
+		media_type TEXT,
+		size INTEGER NOT NULL,
+		os TEXT,
+		architecture TEXT,
+		variant TEXT
+	)`,
+	`CREATE TABLE layers (
+		idx INTEGER PRIMARY KEY,
+		digest TEXT NOT NULL,
+		media_type TEXT,
+		size INTEGER NOT NULL,
+		unavailable INTEGER NOT NULL,
+		duplicate_of INTEGER REFERENCES layers(idx)
+	)`,
+	`CREATE TABLE files (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		layer_idx INTEGER NOT NULL REFERENCES layers(idx),
+		path TEXT NOT NULL,
+		type TEXT NOT NULL,
+		link_path TEXT,
+		size INTEGER NOT NULL,
+		mode INTEGER NOT NULL,
+		uid INTEGER NOT NULL,
+		gid INTEGER NOT NULL,
+		mime_type TEXT,
+		digest TEXT,
+		content_layer_idx INTEGER REFERENCES layers(idx),
+		in_squash INTEGER NOT NULL
+	)`,
+	`CREATE INDEX files_path ON files(path)`,
+	`CREATE INDEX files_digest ON files(digest)`,
+	`CREATE INDEX files_layer ON files(layer_idx)`,
+	`CREATE INDEX files_squash_path ON files(in_squash, path)`,
+	`CREATE INDEX files_mime_type ON files(mime_type)`,
+}
+
+// ExportSQLite writes the image metadata, all layer trees, and all file catalog entries (paths, metadata, digests, and
+// layer provenance) into the given SQLite database (all within a single transaction), so the image contents can be
+// queried with SQL without reading the image again. The database must not already contain the exported tables. The
+// caller is responsible for opening the database with a SQLite driver of their choosing. Note: digests are only
+// included when they have been recorded (see WithFileDigests), and file contents are never exported.
+func ExportSQLite(ctx context.Context, img *Image, db *sql.DB) error {
+	if img.Metadata.ID == "" {
+		return fmt.Errorf("image has not been read")
+	}
+	// the squash tree is generated before anything is written
+	squash, err := img.imageSquashTree()
+	if err != nil {
+		return fmt.Errorf("unable to export image: %w", err)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("unable to start export transaction: %w", err)
+	}
+	if err := exportSQLite(ctx, tx, img, squash); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("unable to commit export transaction: %w", err)
+	}
+	return nil
+}
+
+func exportSQLite(ctx context.Context, tx *sql.Tx, img *Image, squash *filetree.FileTree) error {
+	for _, statement := range sqliteSchema {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("unable to create export schema: %w", err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO image (id, manifest_digest, media_type, size, os, architecture, variant) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		img.Metadata.ID, img.Metadata.ManifestDigest, string(img.Metadata.MediaType), img.Metadata.Size,
+		img.Metadata.OS, img.Metadata.Architecture, img.Metadata.Variant,
+	); err != nil {
+		return fmt.Errorf("unable to export image metadata: %w", err)
+	}
+
+	layerIndexes := make(map[*Layer]int)
+	for idx, layer := range img.Layers {
+		layerIndexes[layer] = idx
+	}
+
+	for idx, layer := range img.Layers {
+		var duplicateOf interface{}
+		if original := layer.DuplicateOf(); original != nil {
+			duplicateOf = layerIndexes[original]
+		}
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO layers (idx, digest, media_type, size, unavailable, duplicate_of) VALUES (?, ?, ?, ?, ?, ?)`,
+			idx, layer.Metadata.Digest, string(layer.Metadata.MediaType), layer.Metadata.Size, layer.Unavailable, duplicateOf,
+		); err != nil {
+			return fmt.Errorf("unable to export layer=%d: %w", idx, err)
+		}
+	}
+
+	squashed := make(map[file.ID]struct{})
+	for _, ref := range squash.AllFiles(file.AllTypes...) {
+		squashed[ref.ID()] = struct{}{}
+	}
+
+	insert, err := tx.PrepareContext(ctx,
+		`INSERT INTO files (layer_idx, path, type, link_path, size, mode, uid, gid, mime_type, digest, content_layer_idx, in_squash) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+	)
+	if err != nil {
+		return fmt.Errorf("unable to prepare file export: %w", err)
+	}
+	defer insert.Close()
+
+	for idx, layer := range img.Layers {
+		if layer.Tree == nil {
+			continue
+		}
+		for _, n := range layer.Tree.Reader().Nodes() {
+			fn, ok := n.(*filenode.FileNode)
+			if !ok || fn.Reference == nil {
+				continue
+			}
+			entry, err := img.FileCatalog.Get(*fn.Reference)
+			if err != nil {
+				// implicitly added parent directories have no catalog entry
+				continue
+			}
+
+			contentLayerIdx := idx
+			if origin, ok := layerIndexes[entry.ContentOrigin]; ok {
+				contentLayerIdx = origin
+			}
+			_, inSquash := squashed[fn.Reference.ID()]
+
+			if _, err := insert.ExecContext(ctx,
+				idx, string(fn.RealPath), sqliteFileType(file.Type(entry.Metadata.TypeFlag)), nullString(string(fn.LinkPath)),
+				entry.Metadata.Size, uint32(entry.Metadata.Mode), entry.Metadata.UserID, entry.Metadata.GroupID,
+				nullString(entry.Metadata.MIMEType), nullString(entry.Metadata.Digest), contentLayerIdx, inSquash,
+			); err != nil {
+				return fmt.Errorf("unable to export path=%q from layer=%d: %w", fn.RealPath, idx, err)
+			}
+		}
+	}
+	return nil
+}
+
+// sqliteFileTypes are the human readable names for each file type stored in the files table.
+var sqliteFileTypes = map[file.Type]string{
+	file.TypeReg:             "file",
+	file.TypeDir:             "dir",
+	file.TypeSymlink:         "symlink",
+	file.TypeHardLink:        "hardlink",
+	file.TypeCharacterDevice: "char-device",
+	file.TypeBlockDevice:     "block-device",
+	file.TypeFifo:            "fifo",
+}
+
+func sqliteFileType(t file.Type) string {
+	if name, ok := sqliteFileTypes[t]; ok {
+		return name
+	}
+	// unknown tar type flags are kept as-is
+	return string(t)
+}
+
+// nullString stores empty strings as NULL, which keeps optional columns simple to query (e.g. "digest IS NULL").
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,93 @@
+package image
+
+import (
+	"archive/tar"
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportSQLite(t *testing.T) {
+	layer := newTestTarLayer(t,
+		testTarEntry{name: "etc/", typeflag: tar.TypeDir},
+		testTarEntry{name: "etc/os-release", contents: "ID=test"},
+		testTarEntry{name: "etc/removed", contents: "gone"},
+	)
+	img := newTestImageFromLayers(t, []v1.Layer{
+		layer,
+		newTestTarLayer(t,
+			testTarEntry{name: "etc/.wh.removed"},
+			testTarEntry{name: "etc/os-release", contents: "ID=test"},
+			testTarEntry{name: "bin/sh", linkname: "/bin/busybox", typeflag: tar.TypeSymlink},
+		),
+		layer,
+	})
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "image.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, ExportSQLite(context.Background(), img, db))
+
+	var id string
+	require.NoError(t, db.QueryRow(`SELECT id FROM image`).Scan(&id))
+	assert.Equal(t, img.Metadata.ID, id)
+
+	var duplicateOf sql.NullInt64
+	require.NoError(t, db.QueryRow(`SELECT duplicate_of FROM layers WHERE idx = 2`).Scan(&duplicateOf))
+	assert.Equal(t, sql.NullInt64{Int64: 0, Valid: true}, duplicateOf)
+
+	rows, err := db.Query(`SELECT layer_idx, type FROM files WHERE path = '/etc/os-release' AND in_squash ORDER BY layer_idx`)
+	require.NoError(t, err)
+	var visible []int
+	for rows.Next() {
+		var idx int
+		var fileType string
+		require.NoError(t, rows.Scan(&idx, &fileType))
+		assert.Equal(t, "file", fileType)
+		visible = append(visible, idx)
+	}
+	require.NoError(t, rows.Err())
+	// the 3rd layer is a duplicate of the 1st, so it shares the same (squash visible) files
+	assert.Equal(t, []int{0, 2}, visible)
+
+	var linkPath string
+	require.NoError(t, db.QueryRow(`SELECT link_path FROM files WHERE path = '/bin/sh' AND type = 'symlink'`).Scan(&linkPath))
+	assert.Equal(t, "/bin/busybox", linkPath)
+
+	var whiteouts int
+	require.NoError(t, db.QueryRow(`SELECT count(*) FROM files WHERE path = '/etc/.wh.removed' AND layer_idx = 1`).Scan(&whiteouts))
+	assert.Equal(t, 1, whiteouts)
+
+	// exporting twice into the same database is an error (and does not leave partial results)
+	assert.Error(t, ExportSQLite(context.Background(), img, db))
+}
+
+func TestExportSQLite_UnreadImage(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "image.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	assert.Error(t, ExportSQLite(context.Background(), &Image{}, db))
+}
+
+func TestExportSQLite_SquashFailure(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "image.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = ExportSQLite(context.Background(), newTestUnsquashableImage(t), db)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unable to squash layers")
+
+	// nothing is written
+	var tables int
+	require.NoError(t, db.QueryRow(`SELECT count(*) FROM sqlite_master`).Scan(&tables))
+	assert.Zero(t, tables)
+}
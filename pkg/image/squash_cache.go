@@ -0,0 +1,176 @@
+package image
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree"
+	"github.com/anchore/stereoscope/pkg/filetree/filenode"
+)
+
+// SquashCacheBackend stores squash trees keyed by layer chain ID (a digest of the digests of a layer and all layers
+// below it), so images built from a common base (e.g. the same distro layers) only squash the shared layer prefix once.
+// Entries only describe which layer each path of the squash originates from (not any image specific file references),
+// so they may be shared between images, processes, and hosts (e.g. an on-disk or networked key-value store shared by
+// many scanning workers). Implementations must be safe for concurrent use.
+type SquashCacheBackend interface {
+	// Get returns the entry for the given chain ID (nil without error if there is no entry).
+	Get(ctx context.Context, chainID string) (*SquashCacheEntry, error)
+	// Put stores the entry for the given chain ID (existing entries for the same chain ID are equivalent).
+	Put(ctx context.Context, chainID string, entry SquashCacheEntry) error
+}
+
+// SquashCacheEntry is a serializable squash tree: every path with a file reference in the squash tree along with the
+// index of the layer (within the layer chain) that the path was sourced from.
+type SquashCacheEntry struct {
+	Paths []SquashCachePath `json:"paths"`
+}
+
+// SquashCachePath is a single path within a cached squash tree.
+type SquashCachePath struct {
+	Path  file.Path `json:"path"`
+	Layer int       `json:"layer"`
+}
+
+// newSquashCacheEntry describes the given squash tree by the layer index that owns each file reference within it.
+func newSquashCacheEntry(tree *filetree.FileTree, origins map[file.ID]int) (SquashCacheEntry, error) {
+	var entry SquashCacheEntry
+	for _, n := range tree.Reader().Nodes() {
+		fn, ok := n.(*filenode.FileNode)
+		if !ok || fn.Reference == nil {
+			continue
+		}
+		idx, ok := origins[fn.Reference.ID()]
+		if !ok {
+			return SquashCacheEntry{}, fmt.Errorf("no originating layer for squash path=%q", fn.RealPath)
+		}
+		entry.Paths = append(entry.Paths, SquashCachePath{Path: fn.RealPath, Layer: idx})
+	}
+	// parents must be added before children when the tree is rebuilt
+	sort.Slice(entry.Paths, func(i, j int) bool {
+		return entry.Paths[i].Path < entry.Paths[j].Path
+	})
+	return entry, nil
+}
+
+// tree rebuilds the squash tree from the nodes of the given layers, so all references belong to the image being read.
+func (e SquashCacheEntry) tree(layers []*Layer) (*filetree.FileTree, error) {
+	tree := filetree.NewFileTree()
+	for _, p := range e.Paths {
+		if p.Layer < 0 || p.Layer >= len(layers) {
+			return nil, fmt.Errorf("no originating layer for cached path=%q", p.Path)
+		}
+		n := layers[p.Layer].Tree.Reader().Node(filenode.IDByPath(p.Path))
+		fn, ok := n.(*filenode.FileNode)
+		if !ok || fn == nil || fn.Reference == nil {
+			return nil, fmt.Errorf("cached path=%q not found in layer=%d", p.Path, p.Layer)
+		}
+		if err := tree.AddFileNode(*fn); err != nil {
+			return nil, fmt.Errorf("unable to add cached path=%q: %w", p.Path, err)
+		}
+	}
+	return tree, nil
+}
+
+// SquashCache is an in-memory SquashCacheBackend, optionally bounded to a maximum number of entries (evicting the least
+// recently used entry first). SquashCache is safe for concurrent use.
+type SquashCache struct {
+	lock       sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	recency    *list.List
+}
+
+type squashCacheItem struct {
+	chainID string
+	entry   SquashCacheEntry
+}
+
+// NewSquashCache returns an empty, unbounded in-memory SquashCache.
+func NewSquashCache() *SquashCache {
+	return NewLRUSquashCache(0)
+}
+
+// NewLRUSquashCache returns an empty in-memory SquashCache holding at most the given number of entries (unbounded if
+// not positive), evicting the least recently used entry when full.
+func NewLRUSquashCache(maxEntries int) *SquashCache {
+	return &SquashCache{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		recency:    list.New(),
+	}
+}
+
+// Len returns the number of cached squash trees.
+func (c *SquashCache) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.entries)
+}
+
+// Get returns the entry for the given chain ID (nil if there is no entry).
+func (c *SquashCache) Get(_ context.Context, chainID string) (*SquashCacheEntry, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	element, ok := c.entries[chainID]
+	if !ok {
+		return nil, nil
+	}
+	c.recency.MoveToFront(element)
+	entry := element.Value.(*squashCacheItem).entry
+	return &entry, nil
+}
+
+// Put stores the entry for the given chain ID, evicting the least recently used entry if the cache is full.
+func (c *SquashCache) Put(_ context.Context, chainID string, entry SquashCacheEntry) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if element, exists := c.entries[chainID]; exists {
+		c.recency.MoveToFront(element)
+		return nil
+	}
+	c.entries[chainID] = c.recency.PushFront(&squashCacheItem{chainID: chainID, entry: entry})
+	if c.maxEntries > 0 && c.recency.Len() > c.maxEntries {
+		oldest := c.recency.Back()
+		c.recency.Remove(oldest)
+		delete(c.entries, oldest.Value.(*squashCacheItem).chainID)
+	}
+	return nil
+}
+
+// layerChainIDs returns the chain ID for each layer (a digest of the digests of the layer and all layers below it).
+// If a layer tree does not describe the full layer content there is no meaningful chain ID for that layer or any layer
+// above it (empty string), otherwise a partial squash would be shared with other reads of the same layer chain. This is
+// the case for unavailable layers (see WithMissingLayersAllowed, WithTopLayers, and WithForeignLayersSkipped) and layers
+// with content skipped by the read limits (see WithReadLimits).
+func layerChainIDs(layers []*Layer) []string {
+	ids := make([]string, len(layers))
+	var last string
+	for idx, layer := range layers {
+		if layer.Unavailable || len(layer.limitViolations) > 0 || layer.Metadata.Digest == "" {
+			break
+		}
+		digest := layer.Metadata.Digest
+		if layer.windowsPaths {
+			// the layer tree paths depend on how the tar entry names are normalized
+			digest += " windows"
+		}
+		last = nextChainID(last, digest)
+		ids[idx] = last
+	}
+	return ids
+}
+
+// nextChainID returns the chain ID of a layer with the given digest above the layer with the given chain ID (empty for
+// the lowest layer, for which the chain ID is the layer digest).
+func nextChainID(parent, digest string) string {
+	if parent == "" {
+		return digest
+	}
+	return fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(parent+" "+digest)))
+}
@@ -0,0 +1,81 @@
+package image
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DirectorySquashCache is an on-disk SquashCacheBackend storing each entry as a gzipped JSON file within a single
+// directory, which may be shared by multiple processes (entries are written atomically).
+type DirectorySquashCache struct {
+	dir string
+}
+
+// NewDirectorySquashCache returns a SquashCacheBackend persisting entries within the given directory (which is created
+// if it does not exist).
+func NewDirectorySquashCache(dir string) (*DirectorySquashCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("unable to create squash cache directory=%q: %w", dir, err)
+	}
+	return &DirectorySquashCache{dir: dir}, nil
+}
+
+func (c *DirectorySquashCache) path(chainID string) string {
+	// chain IDs are digests (e.g. "sha256:abc..."), which are not valid file names on all platforms
+	return filepath.Join(c.dir, strings.ReplaceAll(chainID, ":", "-")+".json.gz")
+}
+
+// Get returns the entry for the given chain ID (nil if there is no entry).
+func (c *DirectorySquashCache) Get(_ context.Context, chainID string) (*SquashCacheEntry, error) {
+	fh, err := os.Open(c.path(chainID))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer fh.Close()
+
+	gr, err := gzip.NewReader(fh)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read squash cache entry=%q: %w", chainID, err)
+	}
+	defer gr.Close()
+
+	var entry SquashCacheEntry
+	if err := json.NewDecoder(gr).Decode(&entry); err != nil {
+		return nil, fmt.Errorf("unable to decode squash cache entry=%q: %w", chainID, err)
+	}
+	return &entry, nil
+}
+
+// Put stores the entry for the given chain ID.
+func (c *DirectorySquashCache) Put(_ context.Context, chainID string, entry SquashCacheEntry) error {
+	fh, err := ioutil.TempFile(c.dir, ".entry-*")
+	if err != nil {
+		return fmt.Errorf("unable to create squash cache entry=%q: %w", chainID, err)
+	}
+	// this is a no-op once the entry has been renamed
+	defer os.Remove(fh.Name())
+
+	gw := gzip.NewWriter(fh)
+	if err := json.NewEncoder(gw).Encode(entry); err != nil {
+		_ = fh.Close()
+		return fmt.Errorf("unable to encode squash cache entry=%q: %w", chainID, err)
+	}
+	if err := gw.Close(); err != nil {
+		_ = fh.Close()
+		return fmt.Errorf("unable to write squash cache entry=%q: %w", chainID, err)
+	}
+	if err := fh.Close(); err != nil {
+		return fmt.Errorf("unable to write squash cache entry=%q: %w", chainID, err)
+	}
+	return os.Rename(fh.Name(), c.path(chainID))
+}
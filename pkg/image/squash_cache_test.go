@@ -0,0 +1,188 @@
+package image
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/file/tarutil"
+)
+
+func TestSquashCache_SharedBaseLayers(t *testing.T) {
+	base, err := random.Image(64, 3)
+	require.NoError(t, err)
+
+	topA, err := random.Layer(64, types.DockerLayer)
+	require.NoError(t, err)
+	imageA, err := mutate.AppendLayers(base, topA)
+	require.NoError(t, err)
+
+	topB, err := random.Layer(64, types.DockerLayer)
+	require.NoError(t, err)
+	imageB, err := mutate.AppendLayers(base, topB)
+	require.NoError(t, err)
+
+	cache := NewSquashCache()
+
+	imgA := NewImage(imageA, t.TempDir())
+	require.NoError(t, imgA.Read(WithSquashCache(cache)))
+	// every layer above the first has a squash tree
+	assert.Equal(t, 3, cache.Len())
+
+	imgB := NewImage(imageB, t.TempDir())
+	require.NoError(t, imgB.Read(WithSquashCache(cache)))
+	// only the top layer squash tree differs
+	assert.Equal(t, 4, cache.Len())
+
+	uncached := NewImage(imageB, t.TempDir())
+	require.NoError(t, uncached.Read())
+
+	require.Len(t, imgB.Layers, len(uncached.Layers))
+	for idx, layer := range imgB.Layers {
+		assert.True(t, layer.SquashedTree.Equal(uncached.Layers[idx].SquashedTree), "layer %d squash tree differs", idx)
+
+		// all references in the squash must originate from this image (not the image that populated the cache)
+		for _, ref := range layer.SquashedTree.AllFiles(file.AllTypes...) {
+			_, err := imgB.FileCatalog.Get(ref)
+			assert.NoError(t, err, "layer %d squash reference=%+v", idx, ref)
+		}
+	}
+
+	for _, ref := range imgB.SquashedTree().AllFiles() {
+		_, err := imgB.FileContentsFromSquash(ref.RealPath)
+		assert.NoError(t, err)
+	}
+}
+
+func TestSquashCache_PartialLayers(t *testing.T) {
+	v1Image, err := mutate.AppendLayers(empty.Image,
+		newTestTarLayer(t, testTarEntry{name: "etc/base", contents: "base"}),
+		newTestTarLayer(t, testTarEntry{name: "etc/a", contents: "a"}, testTarEntry{name: "etc/b", contents: "b"}),
+	)
+	require.NoError(t, err)
+
+	cache := NewSquashCache()
+	limited := NewImage(v1Image, t.TempDir())
+	require.NoError(t, limited.Read(WithSquashCache(cache), WithReadLimits(ReadLimits{TarLimits: tarutil.Limits{MaxEntries: 1}})))
+	require.NotEmpty(t, limited.LimitViolations())
+	// the truncated layer squash is never cached
+	assert.Zero(t, cache.Len())
+
+	img := NewImage(v1Image, t.TempDir())
+	require.NoError(t, img.Read(WithSquashCache(cache)))
+	for _, p := range []file.Path{"/etc/base", "/etc/a", "/etc/b"} {
+		assert.True(t, img.SquashedTree().HasPath(p), p)
+	}
+}
+
+func TestLayerChainIDs(t *testing.T) {
+	layers := []*Layer{
+		{Metadata: LayerMetadata{Digest: "sha256:a"}},
+		{Metadata: LayerMetadata{Digest: "sha256:b"}},
+		{Metadata: LayerMetadata{Digest: "sha256:c"}, Unavailable: true},
+		{Metadata: LayerMetadata{Digest: "sha256:d"}},
+	}
+
+	ids := layerChainIDs(layers)
+	require.Len(t, ids, 4)
+	assert.Equal(t, "sha256:a", ids[0])
+	assert.NotEmpty(t, ids[1])
+	assert.NotEqual(t, ids[0], ids[1])
+	// nothing above an unavailable layer can be cached
+	assert.Empty(t, ids[2])
+	assert.Empty(t, ids[3])
+
+	assert.Equal(t, ids[:2], layerChainIDs(layers[:2]))
+
+	// layers with content skipped by the read limits are not the full layer content
+	limited := []*Layer{
+		{Metadata: LayerMetadata{Digest: "sha256:a"}},
+		{Metadata: LayerMetadata{Digest: "sha256:b"}, limitViolations: []LimitViolation{{Limit: LimitEntries}}},
+	}
+	assert.Equal(t, []string{"sha256:a", ""}, layerChainIDs(limited))
+
+	// layer trees with differently normalized paths are never shared
+	windows := []*Layer{
+		{Metadata: LayerMetadata{Digest: "sha256:a"}, windowsPaths: true},
+	}
+	assert.NotEqual(t, ids[0], layerChainIDs(windows)[0])
+}
+
+func TestDirectorySquashCache_SharedBaseLayers(t *testing.T) {
+	base, err := random.Image(64, 3)
+	require.NoError(t, err)
+	top, err := random.Layer(64, types.DockerLayer)
+	require.NoError(t, err)
+	v1Image, err := mutate.AppendLayers(base, top)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	populate, err := NewDirectorySquashCache(dir)
+	require.NoError(t, err)
+	require.NoError(t, NewImage(base, t.TempDir()).Read(WithSquashCache(populate)))
+
+	entries, err := filepath.Glob(filepath.Join(dir, "*.json.gz"))
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	// a separate cache instance (e.g. another worker) over the same directory
+	shared, err := NewDirectorySquashCache(dir)
+	require.NoError(t, err)
+	img := NewImage(v1Image, t.TempDir())
+	require.NoError(t, img.Read(WithSquashCache(shared)))
+
+	uncached := NewImage(v1Image, t.TempDir())
+	require.NoError(t, uncached.Read())
+	for idx, layer := range img.Layers {
+		assert.True(t, layer.SquashedTree.Equal(uncached.Layers[idx].SquashedTree), "layer %d squash tree differs", idx)
+		for _, ref := range layer.SquashedTree.AllFiles(file.AllTypes...) {
+			_, err := img.FileCatalog.Get(ref)
+			assert.NoError(t, err, "layer %d squash reference=%+v", idx, ref)
+		}
+	}
+
+	entries, err = filepath.Glob(filepath.Join(dir, "*.json.gz"))
+	require.NoError(t, err)
+	assert.Len(t, entries, 3)
+
+	missing, err := shared.Get(context.Background(), "sha256:missing")
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+}
+
+func TestSquashCache_LRU(t *testing.T) {
+	ctx := context.Background()
+	cache := NewLRUSquashCache(2)
+	entry := func(p file.Path) SquashCacheEntry {
+		return SquashCacheEntry{Paths: []SquashCachePath{{Path: p}}}
+	}
+
+	require.NoError(t, cache.Put(ctx, "a", entry("/a")))
+	require.NoError(t, cache.Put(ctx, "b", entry("/b")))
+
+	// touch "a" so that "b" is the least recently used entry
+	got, err := cache.Get(ctx, "a")
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	assert.Equal(t, entry("/a"), *got)
+
+	require.NoError(t, cache.Put(ctx, "c", entry("/c")))
+	assert.Equal(t, 2, cache.Len())
+
+	got, err = cache.Get(ctx, "b")
+	require.NoError(t, err)
+	assert.Nil(t, got)
+	for _, chainID := range []string{"a", "c"} {
+		got, err = cache.Get(ctx, chainID)
+		require.NoError(t, err)
+		assert.NotNil(t, got, chainID)
+	}
+}
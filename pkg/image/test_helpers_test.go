@@ -0,0 +1,100 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/stretchr/testify/require"
+)
+
+// testTarEntry describes a single entry written by newTestTar (regular files with mode 0644 by default).
+type testTarEntry struct {
+	name     string
+	contents string
+	linkname string
+	typeflag byte
+	mode     int64
+	xattrs   map[string]string
+	devmajor int64
+	devminor int64
+}
+
+func newTestTarLayer(t *testing.T, entries ...testTarEntry) v1.Layer {
+	t.Helper()
+	content := newTestTar(t, entries...)
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(content)), nil
+	})
+	require.NoError(t, err)
+	return layer
+}
+
+func newTestTar(t *testing.T, entries ...testTarEntry) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, entry := range entries {
+		typeflag := entry.typeflag
+		if typeflag == 0 {
+			typeflag = tar.TypeReg
+		}
+		mode := entry.mode
+		if mode == 0 {
+			mode = 0644
+		}
+		var pax map[string]string
+		for name, value := range entry.xattrs {
+			if pax == nil {
+				pax = make(map[string]string)
+			}
+			pax["SCHILY.xattr."+name] = value
+		}
+		require.NoError(t, tw.WriteHeader(&tar.Header{
+			Name:       entry.name,
+			PAXRecords: pax,
+			Linkname:   entry.linkname,
+			Size:       int64(len(entry.contents)),
+			Mode:       mode,
+			Typeflag:   typeflag,
+			Devmajor:   entry.devmajor,
+			Devminor:   entry.devminor,
+		}))
+		_, err := tw.Write([]byte(entry.contents))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+// newTestV1Image returns an image of the given layers on top of an empty image.
+func newTestV1Image(t *testing.T, layers ...v1.Layer) v1.Image {
+	t.Helper()
+	v1Image, err := mutate.AppendLayers(empty.Image, layers...)
+	require.NoError(t, err)
+	return v1Image
+}
+
+// newTestImageFromLayers returns the image of the given layers, read with the given options.
+func newTestImageFromLayers(t *testing.T, layers []v1.Layer, options ...ReadOption) *Image {
+	t.Helper()
+	img := NewImage(newTestV1Image(t, layers...), t.TempDir())
+	require.NoError(t, img.Read(options...))
+	return img
+}
+
+// newTestUnsquashableImage returns a read image where generating the (deferred) squash tree fails, since the top layer
+// whites out the root directory.
+func newTestUnsquashableImage(t *testing.T) *Image {
+	t.Helper()
+	return newTestImageFromLayers(t, []v1.Layer{
+		newTestTarLayer(t, testTarEntry{name: "etc/hello.txt", contents: "hello"}),
+		newTestTarLayer(t, testTarEntry{name: ".wh.."}),
+	}, WithDeferredSquash())
+}
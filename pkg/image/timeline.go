@@ -0,0 +1,175 @@
+package image
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree"
+)
+
+// Timeline describes how each build step changed the image filesystem (see Image.Timeline).
+type Timeline struct {
+	ImageID string `json:"imageID"`
+	// Entries are in config history order, followed by any layers without a history entry
+	Entries []TimelineEntry `json:"entries"`
+	// TotalBytes is the combined size of all layers
+	TotalBytes int64 `json:"totalBytes"`
+}
+
+// TimelineEntry describes a single build step: the config history entry and the changes of the layer it produced
+// relative to the squash of all layers below it.
+type TimelineEntry struct {
+	// HistoryIndex is the position of the entry within the image config history (-1 if the layer has no history entry)
+	HistoryIndex int `json:"historyIndex"`
+	// LayerIndex is the index of the layer produced by the build step (-1 for empty layer entries, e.g. ENV or LABEL
+	// instructions, which have no changes)
+	LayerIndex  int        `json:"layerIndex"`
+	LayerDigest string     `json:"layerDigest,omitempty"`
+	CreatedBy   string     `json:"createdBy,omitempty"`
+	Created     *time.Time `json:"created,omitempty"`
+	Comment     string     `json:"comment,omitempty"`
+
+	// the number of non-directory paths added, modified (including paths that changed type), and deleted by the layer
+	FilesAdded    int `json:"filesAdded"`
+	FilesModified int `json:"filesModified"`
+	FilesDeleted  int `json:"filesDeleted"`
+
+	// LayerBytes is the size of the layer content
+	LayerBytes int64 `json:"layerBytes"`
+	// AddedBytes and ModifiedBytes are the sizes of the regular files added or modified by the layer
+	AddedBytes    int64 `json:"addedBytes"`
+	ModifiedBytes int64 `json:"modifiedBytes"`
+	// ReplacedBytes is the size of the lower layer files that were modified or deleted by the layer, which are still
+	// stored in the image (and are candidates for build optimization)
+	ReplacedBytes int64 `json:"replacedBytes"`
+	// CumulativeBytes is the combined size of this layer and all layers below it
+	CumulativeBytes int64 `json:"cumulativeBytes"`
+}
+
+// Timeline combines the config history, the changes of each layer, and the layer sizes into a single report across
+// the whole image (e.g. for build-optimization tooling). The squash trees of all layers are generated if needed.
+func (i *Image) Timeline() (*Timeline, error) {
+	timeline := &Timeline{
+		ImageID: i.Metadata.ID,
+		Entries: []TimelineEntry{},
+	}
+
+	covered := make(map[*Layer]bool)
+	for _, h := range i.History() {
+		entry := TimelineEntry{
+			HistoryIndex: h.Index,
+			LayerIndex:   -1,
+			CreatedBy:    h.History.CreatedBy,
+			Comment:      h.History.Comment,
+		}
+		if !h.History.Created.IsZero() {
+			created := h.History.Created.Time
+			entry.Created = &created
+		}
+		if h.Layer != nil {
+			covered[h.Layer] = true
+			if err := i.addLayerChanges(&entry, h.Layer); err != nil {
+				return nil, err
+			}
+		}
+		timeline.Entries = append(timeline.Entries, entry)
+	}
+	for _, layer := range i.Layers {
+		if covered[layer] {
+			continue
+		}
+		entry := TimelineEntry{HistoryIndex: -1}
+		if err := i.addLayerChanges(&entry, layer); err != nil {
+			return nil, err
+		}
+		timeline.Entries = append(timeline.Entries, entry)
+	}
+
+	for idx := range timeline.Entries {
+		timeline.TotalBytes += timeline.Entries[idx].LayerBytes
+		timeline.Entries[idx].CumulativeBytes = timeline.TotalBytes
+	}
+	return timeline, nil
+}
+
+// WriteTimeline writes the timeline of the image (see Image.Timeline) as JSON to the given writer.
+func (i *Image) WriteTimeline(w io.Writer) error {
+	timeline, err := i.Timeline()
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(timeline)
+}
+
+// addLayerChanges summarizes the changes of the given layer relative to the squash of all layers below it.
+func (i *Image) addLayerChanges(entry *TimelineEntry, layer *Layer) error {
+	idx := int(layer.Metadata.Index)
+	entry.LayerIndex = idx
+	entry.LayerDigest = layer.Metadata.Digest
+	entry.LayerBytes = layer.Metadata.Size
+
+	upper, err := i.FilesystemAt(idx)
+	if err != nil {
+		return err
+	}
+	var lower *filetree.FileTree
+	if idx > 0 {
+		if lower, err = i.FilesystemAt(idx - 1); err != nil {
+			return err
+		}
+	}
+
+	for _, change := range filetree.Diff(lower, upper) {
+		if change.Type != filetree.TypeChanged && i.isDirectory(change.Old, change.New) {
+			continue
+		}
+		switch change.Type {
+		case filetree.Added:
+			entry.FilesAdded++
+			entry.AddedBytes += i.regularFileSize(change.New)
+		case filetree.Modified, filetree.TypeChanged:
+			entry.FilesModified++
+			entry.ModifiedBytes += i.regularFileSize(change.New)
+			entry.ReplacedBytes += i.regularFileSize(change.Old)
+		case filetree.Removed:
+			entry.FilesDeleted++
+			entry.ReplacedBytes += i.regularFileSize(change.Old)
+		default:
+			return fmt.Errorf("unexpected change type=%q for path=%q", change.Type, change.Path)
+		}
+	}
+	return nil
+}
+
+// isDirectory indicates if the given change references describe a directory (implicitly added directories have no
+// reference at all).
+func (i *Image) isDirectory(refs ...*file.Reference) bool {
+	for _, ref := range refs {
+		if ref == nil {
+			continue
+		}
+		entry, err := i.FileCatalog.Get(*ref)
+		if err != nil {
+			return false
+		}
+		return file.Type(entry.Metadata.TypeFlag) == file.TypeDir
+	}
+	return true
+}
+
+// regularFileSize returns the size of the given reference if it is a regular file (zero otherwise).
+func (i *Image) regularFileSize(ref *file.Reference) int64 {
+	if ref == nil {
+		return 0
+	}
+	entry, err := i.FileCatalog.Get(*ref)
+	if err != nil || file.Type(entry.Metadata.TypeFlag) != file.TypeReg {
+		return 0
+	}
+	return entry.Metadata.Size
+}
@@ -0,0 +1,85 @@
+package image
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImage_Timeline(t *testing.T) {
+	v1Image, err := mutate.AppendLayers(empty.Image,
+		newTestTarLayer(t,
+			testTarEntry{name: "bin/sh", contents: "shell"},
+			testTarEntry{name: "etc/config", contents: "config"},
+			testTarEntry{name: "tmp/cache", contents: "cached-data"},
+		),
+		newTestTarLayer(t,
+			testTarEntry{name: "etc/config", contents: "new-config"},
+			testTarEntry{name: "tmp/.wh.cache"},
+			testTarEntry{name: "app/run", contents: "app"},
+		),
+	)
+	require.NoError(t, err)
+	cfg, err := v1Image.ConfigFile()
+	require.NoError(t, err)
+	cfg = cfg.DeepCopy()
+	cfg.History = []v1.History{
+		{CreatedBy: "ADD rootfs.tar /"},
+		{CreatedBy: "ENV PATH=/bin", EmptyLayer: true},
+		{CreatedBy: "RUN make install", Comment: "buildkit"},
+	}
+	v1Image, err = mutate.ConfigFile(v1Image, cfg)
+	require.NoError(t, err)
+
+	img := NewImage(v1Image, t.TempDir())
+	require.NoError(t, img.Read(WithDeferredSquash()))
+	t.Cleanup(func() { _ = img.Cleanup() })
+
+	timeline, err := img.Timeline()
+	require.NoError(t, err)
+	require.Len(t, timeline.Entries, 3)
+
+	base := timeline.Entries[0]
+	assert.Equal(t, 0, base.HistoryIndex)
+	assert.Equal(t, 0, base.LayerIndex)
+	assert.Equal(t, img.Layers[0].Metadata.Digest, base.LayerDigest)
+	assert.Equal(t, "ADD rootfs.tar /", base.CreatedBy)
+	assert.Equal(t, 3, base.FilesAdded)
+	assert.Equal(t, 0, base.FilesModified)
+	assert.Equal(t, 0, base.FilesDeleted)
+	assert.Equal(t, int64(len("shell")+len("config")+len("cached-data")), base.AddedBytes)
+	assert.Equal(t, img.Layers[0].Metadata.Size, base.LayerBytes)
+
+	env := timeline.Entries[1]
+	assert.Equal(t, 1, env.HistoryIndex)
+	assert.Equal(t, -1, env.LayerIndex)
+	assert.Equal(t, "ENV PATH=/bin", env.CreatedBy)
+	assert.Zero(t, env.FilesAdded+env.FilesModified+env.FilesDeleted)
+	assert.Equal(t, base.CumulativeBytes, env.CumulativeBytes)
+
+	run := timeline.Entries[2]
+	assert.Equal(t, 2, run.HistoryIndex)
+	assert.Equal(t, 1, run.LayerIndex)
+	assert.Equal(t, "buildkit", run.Comment)
+	assert.Equal(t, 1, run.FilesAdded)
+	assert.Equal(t, 1, run.FilesModified)
+	assert.Equal(t, 1, run.FilesDeleted)
+	assert.Equal(t, int64(len("app")), run.AddedBytes)
+	assert.Equal(t, int64(len("new-config")), run.ModifiedBytes)
+	assert.Equal(t, int64(len("config")+len("cached-data")), run.ReplacedBytes)
+	assert.Equal(t, img.Layers[0].Metadata.Size+img.Layers[1].Metadata.Size, run.CumulativeBytes)
+	assert.Equal(t, run.CumulativeBytes, timeline.TotalBytes)
+
+	var buf bytes.Buffer
+	require.NoError(t, img.WriteTimeline(&buf))
+	var decoded Timeline
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, timeline.Entries, decoded.Entries)
+	assert.Contains(t, buf.String(), `"filesDeleted": 1`)
+}
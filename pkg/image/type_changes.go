@@ -0,0 +1,89 @@
+package image
+
+import (
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree"
+	"github.com/anchore/stereoscope/pkg/filetree/filenode"
+)
+
+// replaceTypeChange removes the existing path (along with everything below it) for the given tar entry from the layer
+// tree when the entry is a different type of file (e.g. a regular file replacing a directory), which is the same as
+// extracting the layer tar where the later entry replaces the earlier one. Note: catalog entries for the removed paths
+// are kept (they still describe content within the layer blob), however, they are no longer reachable from any tree.
+func (l *Layer) replaceTypeChange(metadata file.Metadata) error {
+	p := file.Path(metadata.Path)
+	if p == file.DirSeparator {
+		return nil
+	}
+	existing, ok := treeNodeType(l.Tree, p)
+	if !ok {
+		return nil
+	}
+	replacement := treeFileType(file.Type(metadata.TypeFlag))
+	if existing == replacement {
+		return nil
+	}
+	if l.typeChangeWarnings {
+		l.warn(WarningTypeChange, p, "%s replaced by %s within the same layer (sequence=%d)", fileTypeDescription(existing), fileTypeDescription(replacement), metadata.TarSequence)
+	}
+	return l.Tree.RemovePath(p)
+}
+
+// reportTypeChanges warns about every path within the layer tree that replaces a lower directory with any other type of
+// file (implicitly removing everything below the lower directory while squashing) or replaces any other type of lower
+// file with a directory. Paths that are explicitly deleted by the layer first (with a whiteout) are not reported.
+func (i *Image) reportTypeChanges(layer *Layer, lowerSquashTree *filetree.FileTree) {
+	deleted := make(map[file.Path]struct{})
+	for _, p := range layer.whiteouts {
+		deleted[p] = struct{}{}
+	}
+	for _, p := range sortedPaths(layer.Tree.AllRealPaths()) {
+		if p.IsWhiteout() {
+			continue
+		}
+		if _, ok := deleted[p]; ok {
+			continue
+		}
+		upper, ok := treeNodeType(layer.Tree, p)
+		if !ok {
+			continue
+		}
+		lower, ok := treeNodeType(lowerSquashTree, p)
+		if !ok || (upper == file.TypeDir) == (lower == file.TypeDir) {
+			continue
+		}
+		layer.warn(WarningTypeChange, p, "%s from a lower layer replaced by %s", fileTypeDescription(lower), fileTypeDescription(upper))
+	}
+}
+
+// treeNodeType returns the file type of the node at the given real path (without resolving any links).
+func treeNodeType(t *filetree.FileTree, p file.Path) (file.Type, bool) {
+	n, ok := t.Reader().Node(filenode.IDByPath(p)).(*filenode.FileNode)
+	if !ok || n == nil {
+		return 0, false
+	}
+	return n.FileType, true
+}
+
+// treeFileType returns the file type a tar entry of the given type is added to a tree as (see addTreePath).
+func treeFileType(t file.Type) file.Type {
+	switch t {
+	case file.TypeSymlink, file.TypeHardLink, file.TypeDir:
+		return t
+	default:
+		return file.TypeReg
+	}
+}
+
+func fileTypeDescription(t file.Type) string {
+	switch t {
+	case file.TypeDir:
+		return "directory"
+	case file.TypeSymlink:
+		return "symlink"
+	case file.TypeHardLink:
+		return "hardlink"
+	default:
+		return "regular file"
+	}
+}
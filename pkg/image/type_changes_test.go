@@ -0,0 +1,117 @@
+package image
+
+import (
+	"archive/tar"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+func typeChangeWarnings(img *Image) []Warning {
+	var warnings []Warning
+	for _, w := range img.Warnings() {
+		if w.Kind == WarningTypeChange {
+			warnings = append(warnings, w)
+		}
+	}
+	return warnings
+}
+
+func TestImage_Squash_DirectoryTypeChanges(t *testing.T) {
+	v1Image, err := mutate.AppendLayers(empty.Image,
+		newTestTarLayer(t,
+			testTarEntry{name: "opt/app/", typeflag: tar.TypeDir, mode: 0755},
+			testTarEntry{name: "opt/app/bin/run", contents: "run"},
+			testTarEntry{name: "opt/app/config", contents: "config"},
+			testTarEntry{name: "srv/data/", typeflag: tar.TypeDir, mode: 0755},
+			testTarEntry{name: "srv/data/db", contents: "db"},
+			testTarEntry{name: "var/target/", typeflag: tar.TypeDir, mode: 0755},
+			testTarEntry{name: "var/target/keep", contents: "keep"},
+			testTarEntry{name: "etc/conf", contents: "file"},
+			testTarEntry{name: "usr/share/doc/", typeflag: tar.TypeDir, mode: 0755},
+			testTarEntry{name: "usr/share/doc/readme", contents: "readme"},
+		),
+		newTestTarLayer(t,
+			// a directory replaced by a regular file
+			testTarEntry{name: "opt/app", contents: "now a file"},
+			// a directory replaced by a symlink
+			testTarEntry{name: "srv/data", linkname: "/var/target", typeflag: tar.TypeSymlink},
+			// a regular file replaced by an implicit directory
+			testTarEntry{name: "etc/conf/new", contents: "new"},
+			// an explicit deletion of the directory before replacing it
+			testTarEntry{name: "usr/share/.wh.doc"},
+			testTarEntry{name: "usr/share/doc", contents: "doc"},
+		),
+	)
+	require.NoError(t, err)
+
+	for _, warn := range []bool{false, true} {
+		img := NewImage(v1Image, t.TempDir())
+		var options []ReadOption
+		if warn {
+			options = append(options, WithTypeChangeWarnings())
+		}
+		require.NoError(t, img.Read(options...))
+		squash := img.SquashedTree()
+
+		// everything below a replaced directory is implicitly removed
+		for _, p := range []file.Path{"/opt/app/bin/run", "/opt/app/bin", "/opt/app/config", "/srv/data/db", "/usr/share/doc/readme"} {
+			assert.False(t, squash.HasPath(p), "expected %q to be removed", p)
+		}
+		_, ref, err := squash.File("/opt/app")
+		require.NoError(t, err)
+		require.NotNil(t, ref)
+		entry, err := img.FileCatalog.Get(*ref)
+		require.NoError(t, err)
+		assert.Equal(t, file.TypeReg, file.Type(entry.Metadata.TypeFlag))
+
+		contents, err := img.FileContentsFromSquash("/srv/data/keep")
+		require.NoError(t, err)
+		require.NoError(t, contents.Close())
+		assert.True(t, squash.HasPath("/etc/conf/new"))
+
+		if !warn {
+			assert.Empty(t, typeChangeWarnings(img))
+			continue
+		}
+		assert.Equal(t, []Warning{
+			{Kind: WarningTypeChange, Layer: 1, Path: "/etc/conf", Message: "regular file from a lower layer replaced by directory"},
+			{Kind: WarningTypeChange, Layer: 1, Path: "/opt/app", Message: "directory from a lower layer replaced by regular file"},
+			{Kind: WarningTypeChange, Layer: 1, Path: "/srv/data", Message: "directory from a lower layer replaced by symlink"},
+		}, typeChangeWarnings(img))
+	}
+}
+
+func TestImage_Read_TypeChangeWithinLayer(t *testing.T) {
+	v1Image, err := mutate.AppendLayers(empty.Image, newTestTarLayer(t,
+		testTarEntry{name: "opt/app/", typeflag: tar.TypeDir, mode: 0755},
+		testTarEntry{name: "opt/app/config", contents: "config"},
+		testTarEntry{name: "opt/app", contents: "now a file"},
+		testTarEntry{name: "etc/link", linkname: "/etc/target", typeflag: tar.TypeSymlink},
+		testTarEntry{name: "etc/link/", typeflag: tar.TypeDir, mode: 0755},
+	))
+	require.NoError(t, err)
+
+	img := NewImage(v1Image, t.TempDir())
+	require.NoError(t, img.Read(WithTypeChangeWarnings()))
+
+	tree := img.Layers[0].Tree
+	assert.False(t, tree.HasPath("/opt/app/config"))
+	contents, err := img.FileContentsFromSquash("/opt/app")
+	require.NoError(t, err)
+	require.NoError(t, contents.Close())
+
+	upper, ok := treeNodeType(tree, "/etc/link")
+	require.True(t, ok)
+	assert.Equal(t, file.TypeDir, upper)
+
+	assert.Equal(t, []Warning{
+		{Kind: WarningTypeChange, Layer: 0, Path: "/opt/app", Message: "directory replaced by regular file within the same layer (sequence=2)"},
+		{Kind: WarningTypeChange, Layer: 0, Path: "/etc/link", Message: "symlink replaced by directory within the same layer (sequence=4)"},
+	}, typeChangeWarnings(img))
+}
@@ -0,0 +1,162 @@
+package image
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree/filenode"
+)
+
+// WarningKind describes the category of a non-fatal issue encountered while reading an image.
+type WarningKind string
+
+const (
+	// WarningDuplicatePath indicates that a layer tar has multiple entries for the same path (the last entry wins)
+	WarningDuplicatePath WarningKind = "duplicate-path"
+	// WarningUnsupportedXattr indicates that a file has an extended attribute outside of the namespaces supported by
+	// linux (security, system, trusted, and user), which could not be applied to an extracted file
+	WarningUnsupportedXattr WarningKind = "unsupported-xattr"
+	// WarningUnavailableLayer indicates that a layer was skipped since the layer content could not be found (see
+	// WithMissingLayersAllowed)
+	WarningUnavailableLayer WarningKind = "unavailable-layer"
+	// WarningInvalidTag indicates that an additional image tag could not be parsed and was skipped (see WithTags)
+	WarningInvalidTag WarningKind = "invalid-tag"
+	// WarningInvalidCache indicates that cached data (layer tars or squash trees) could not be used or stored, and was
+	// recomputed instead
+	WarningInvalidCache WarningKind = "invalid-cache"
+	// WarningHistoryMismatch indicates that the image config history does not describe the same number of layers as
+	// the image has (history entries can not be reliably attributed to layers, see History)
+	WarningHistoryMismatch WarningKind = "history-mismatch"
+	// WarningPlatformMismatch indicates that the image platform differs from the expected platform (see
+	// WithExpectedPlatform)
+	WarningPlatformMismatch WarningKind = "platform-mismatch"
+	// WarningLimitExceeded indicates that content was skipped since it violated a read limit (see WithReadLimits and
+	// Image.LimitViolations)
+	WarningLimitExceeded WarningKind = "limit-exceeded"
+	// WarningTypeChange indicates that a path was replaced by a different type of file, such as a directory replaced by
+	// a regular file, which removes everything below the directory (see WithTypeChangeWarnings)
+	WarningTypeChange WarningKind = "type-change"
+	// WarningCacheBudget indicates that the cached layer tars exceed the layer cache budget since nothing more could be
+	// evicted (see WithLayerCacheBudget)
+	WarningCacheBudget WarningKind = "cache-budget"
+	// WarningCompressionMismatch indicates that the compression of the layer content differs from what the layer media
+	// type declares, which is tolerated unless reading with WithStrictLayerCompression
+	WarningCompressionMismatch WarningKind = "compression-mismatch"
+	// WarningForeignLayer indicates that a foreign (non-distributable) layer was skipped without fetching the layer
+	// content (see WithForeignLayersSkipped)
+	WarningForeignLayer WarningKind = "foreign-layer"
+)
+
+// Warning is a non-fatal issue encountered while reading an image, which may affect the quality (but not validity) of
+// the results derived from the image.
+type Warning struct {
+	Kind WarningKind
+	// Layer is the index of the layer the warning applies to (-1 if not specific to a single layer)
+	Layer int
+	// Path is the file path the warning applies to (empty if not specific to a single path)
+	Path file.Path
+	// Message describes the issue
+	Message string
+}
+
+func (w Warning) String() string {
+	var b strings.Builder
+	b.WriteString(string(w.Kind))
+	if w.Layer >= 0 {
+		fmt.Fprintf(&b, " layer=%d", w.Layer)
+	}
+	if w.Path != "" {
+		fmt.Fprintf(&b, " path=%q", w.Path)
+	}
+	b.WriteString(": ")
+	b.WriteString(w.Message)
+	return b.String()
+}
+
+// linuxXattrNamespaces are the extended attribute namespaces that may be set on linux.
+var linuxXattrNamespaces = []string{"security.", "system.", "trusted.", "user."}
+
+// Warnings returns all non-fatal issues encountered while reading the image (image issues first, followed by issues
+// for each layer in layer order). Layers that are duplicates of a lower layer do not repeat the warnings of the
+// original layer.
+func (i *Image) Warnings() []Warning {
+	warnings := append([]Warning(nil), i.warnings...)
+	for _, layer := range i.Layers {
+		warnings = append(warnings, layer.warnings...)
+	}
+	return warnings
+}
+
+// Warnings returns all non-fatal issues encountered while reading the layer.
+func (l *Layer) Warnings() []Warning {
+	return append([]Warning(nil), l.warnings...)
+}
+
+func (i *Image) warn(kind WarningKind, layer int, format string, args ...interface{}) {
+	i.warnings = append(i.warnings, Warning{
+		Kind:    kind,
+		Layer:   layer,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (l *Layer) warn(kind WarningKind, p file.Path, format string, args ...interface{}) {
+	l.warnings = append(l.warnings, Warning{
+		Kind:    kind,
+		Layer:   int(l.Metadata.Index),
+		Path:    p,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// checkTarEntry records warnings for a tar entry that is about to be added to the layer tree.
+func (l *Layer) checkTarEntry(metadata file.Metadata) {
+	p := file.Path(metadata.Path)
+	if n := l.Tree.Reader().Node(filenode.IDByPath(p)); n != nil {
+		if fn, ok := n.(*filenode.FileNode); ok && fn.Reference != nil {
+			// implicitly added parent directories have no catalog entry, and are not duplicates
+			if entry, err := l.fileCatalog.Get(*fn.Reference); err == nil && entry.Layer == l {
+				l.warn(WarningDuplicatePath, p, "multiple tar entries for the same path (sequence=%d replaces sequence=%d)", metadata.TarSequence, entry.Metadata.TarSequence)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(metadata.Xattrs))
+	for name := range metadata.Xattrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !hasXattrNamespace(name) {
+			l.warn(WarningUnsupportedXattr, p, "unsupported extended attribute %q", name)
+		}
+	}
+}
+
+func hasXattrNamespace(name string) bool {
+	for _, namespace := range linuxXattrNamespaces {
+		if strings.HasPrefix(name, namespace) && len(name) > len(namespace) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkHistory records a warning when the config history does not align with the image layers.
+func (i *Image) checkHistory() {
+	if len(i.Metadata.Config.History) == 0 {
+		// history is optional
+		return
+	}
+	var historyLayers int
+	for _, h := range i.Metadata.Config.History {
+		if !h.EmptyLayer {
+			historyLayers++
+		}
+	}
+	if historyLayers != len(i.Layers) {
+		i.warn(WarningHistoryMismatch, -1, "config history describes %d layers, however, the image has %d layers", historyLayers, len(i.Layers))
+	}
+}
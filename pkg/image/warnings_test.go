@@ -0,0 +1,70 @@
+package image
+
+import (
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImage_Warnings(t *testing.T) {
+	base := newTestTarLayer(t,
+		testTarEntry{name: "etc/hello.txt", contents: "hello"},
+		testTarEntry{name: "etc/hello.txt", contents: "goodbye"},
+	)
+	top := newTestTarLayer(t,
+		testTarEntry{name: "usr/bin/app", contents: "app", xattrs: map[string]string{
+			"security.capability":  "cap",
+			"com.apple.quarantine": "quarantined",
+		}},
+	)
+
+	v1Image, err := mutate.AppendLayers(empty.Image, base, top)
+	require.NoError(t, err)
+	// the history only accounts for a single layer
+	cfg, err := v1Image.ConfigFile()
+	require.NoError(t, err)
+	cfg.History = []v1.History{{CreatedBy: "ADD base"}}
+	v1Image, err = mutate.ConfigFile(v1Image, cfg)
+	require.NoError(t, err)
+
+	img := NewImage(v1Image, t.TempDir(), WithTags("not a valid tag!"))
+	require.NoError(t, img.Read())
+
+	var kinds []WarningKind
+	for _, w := range img.Warnings() {
+		kinds = append(kinds, w.Kind)
+	}
+	assert.Equal(t, []WarningKind{WarningInvalidTag, WarningHistoryMismatch, WarningDuplicatePath, WarningUnsupportedXattr}, kinds)
+
+	warnings := img.Warnings()
+	assert.Equal(t, -1, warnings[0].Layer)
+	assert.Equal(t, Warning{
+		Kind:    WarningDuplicatePath,
+		Layer:   0,
+		Path:    "/etc/hello.txt",
+		Message: "multiple tar entries for the same path (sequence=1 replaces sequence=0)",
+	}, warnings[2])
+	assert.Equal(t, file.Path("/usr/bin/app"), warnings[3].Path)
+	assert.Equal(t, 1, warnings[3].Layer)
+	assert.Contains(t, warnings[3].Message, "com.apple.quarantine")
+	assert.Equal(t, warnings[3:], img.Layers[1].Warnings())
+
+	// warnings are not carried over between reads
+	require.NoError(t, img.Read())
+	assert.Len(t, img.Warnings(), 4)
+}
+
+func TestImage_Warnings_NoneForCleanImage(t *testing.T) {
+	img := newTestImageFromLayers(t, []v1.Layer{newTestTarLayer(t, testTarEntry{name: "etc/hello.txt", contents: "hello"})})
+	assert.Empty(t, img.Warnings())
+}
+
+func TestWarning_String(t *testing.T) {
+	assert.Equal(t, `duplicate-path layer=2 path="/etc/hello.txt": oops`, Warning{Kind: WarningDuplicatePath, Layer: 2, Path: "/etc/hello.txt", Message: "oops"}.String())
+	assert.Equal(t, `history-mismatch: oops`, Warning{Kind: WarningHistoryMismatch, Layer: -1, Message: "oops"}.String())
+}
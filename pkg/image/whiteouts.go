@@ -0,0 +1,62 @@
+package image
+
+import (
+	"sort"
+
+	"github.com/anchore/stereoscope/pkg/file"
+)
+
+// trackWhiteout records the lower-layer path deleted by the given entry (if it is a whiteout or opaque directory
+// marker according to the layer merge strategy), so callers do not need to re-parse the layer tar to find deletions.
+func (l *Layer) trackWhiteout(metadata file.Metadata) {
+	switch l.mergeStrategy {
+	case OverlayMergeStrategy:
+		p := file.Path(metadata.Path)
+		if isOverlayWhiteout(metadata) {
+			l.whiteouts = append(l.whiteouts, p)
+		} else if isOverlayOpaque(metadata) {
+			l.opaqueDirs = append(l.opaqueDirs, p)
+		}
+		return
+	case VFSMergeStrategy:
+		return
+	}
+
+	p := file.Path(metadata.Path)
+	if !p.IsWhiteout() {
+		return
+	}
+	deleted, err := p.UnWhiteoutPath()
+	if err != nil {
+		return
+	}
+	if p.IsDirWhiteout() {
+		l.opaqueDirs = append(l.opaqueDirs, deleted)
+		return
+	}
+	l.whiteouts = append(l.whiteouts, deleted)
+}
+
+// Whiteouts returns all paths from lower layers that are deleted by this layer (the whiteout entry paths without the
+// whiteout prefix), sorted by path. Opaque directory markers are not included (see OpaqueDirs).
+func (l *Layer) Whiteouts() []file.Path {
+	return sortedPaths(l.whiteouts)
+}
+
+// OpaqueDirs returns all directories whose lower-layer contents are hidden by this layer (directories with an opaque
+// whiteout marker), sorted by path.
+func (l *Layer) OpaqueDirs() []file.Path {
+	return sortedPaths(l.opaqueDirs)
+}
+
+func sortedPaths(paths []file.Path) []file.Path {
+	if len(paths) == 0 {
+		return nil
+	}
+	result := make([]file.Path, len(paths))
+	copy(result, paths)
+	sort.Slice(result, func(i, j int) bool {
+		return result[i] < result[j]
+	})
+	return result
+}
@@ -0,0 +1,33 @@
+package image
+
+import (
+	"archive/tar"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLayer_WhiteoutsAndOpaqueDirs(t *testing.T) {
+	img := newTestImageFromLayers(t, []v1.Layer{
+		newTestTarLayer(t,
+			testTarEntry{name: "etc/", typeflag: tar.TypeDir},
+			testTarEntry{name: "etc/passwd", contents: "root"},
+			testTarEntry{name: "etc/shadow", contents: "secret"},
+			testTarEntry{name: "var/cache/apk/index", contents: "index"},
+		),
+		newTestTarLayer(t,
+			testTarEntry{name: "etc/.wh.shadow"},
+			testTarEntry{name: "var/cache/apk/.wh..wh..opq"},
+			testTarEntry{name: "etc/.wh.passwd"},
+			testTarEntry{name: "etc/group", contents: "root"},
+		),
+	})
+
+	assert.Nil(t, img.Layers[0].Whiteouts())
+	assert.Nil(t, img.Layers[0].OpaqueDirs())
+
+	assert.Equal(t, []file.Path{"/etc/passwd", "/etc/shadow"}, img.Layers[1].Whiteouts())
+	assert.Equal(t, []file.Path{"/var/cache/apk"}, img.Layers[1].OpaqueDirs())
+}
@@ -0,0 +1,56 @@
+package image
+
+import (
+	"strings"
+
+	"github.com/anchore/stereoscope/internal/log"
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/filetree"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// isForeignLayer indicates if the given media type describes a foreign (non-distributable) layer, such as a Windows
+// base layer, whose content is typically not served by the registry but fetched from the URLs within the layer
+// descriptor instead.
+func isForeignLayer(mediaType types.MediaType) bool {
+	switch mediaType {
+	case types.DockerForeignLayer, types.OCIRestrictedLayer, types.OCIUncompressedRestrictedLayer, OCIRestrictedLayerZstd:
+		return true
+	}
+	return false
+}
+
+// readSkippedForeign populates this layer as unavailable (with an empty tree) without fetching any content when the
+// layer is a foreign layer (see WithForeignLayersSkipped), returning false if the layer is not a foreign layer.
+func (l *Layer) readSkippedForeign(catalog *FileCatalog, imgMetadata Metadata, idx int) (bool, error) {
+	metadata, err := newLayerMetadata(imgMetadata, l.layer, idx)
+	if err != nil {
+		return false, err
+	}
+	if !isForeignLayer(metadata.MediaType) {
+		return false, nil
+	}
+	l.Metadata = metadata
+	l.Tree = filetree.NewFileTree()
+	l.fileCatalog = catalog
+	l.Unavailable = true
+	log.Debugf("skipping foreign layer=%q mediaType=%q", metadata.Digest, metadata.MediaType)
+	l.warn(WarningForeignLayer, "", "skipping foreign layer=%q (media type=%q)", metadata.Digest, metadata.MediaType)
+	return true, nil
+}
+
+// windowsLayerMetadata returns the given tar entry metadata with the path (and link) normalized for a Windows layer
+// tar (see file.NormalizeWindowsLayerPath).
+func windowsLayerMetadata(metadata file.Metadata) file.Metadata {
+	metadata.Path = file.NormalizeWindowsLayerPath(metadata.TarHeaderName)
+	switch file.Type(metadata.TypeFlag) {
+	case file.TypeHardLink:
+		// hardlink targets are tar entry names as well
+		if metadata.Linkname != "" {
+			metadata.Linkname = file.NormalizeWindowsLayerPath(metadata.Linkname)
+		}
+	case file.TypeSymlink:
+		metadata.Linkname = strings.ReplaceAll(metadata.Linkname, `\`, "/")
+	}
+	return metadata
+}
@@ -0,0 +1,103 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImage_Read_WindowsLayerPaths(t *testing.T) {
+	base := newTestTarLayer(t,
+		testTarEntry{name: "Files", typeflag: tar.TypeDir},
+		testTarEntry{name: `Files\Windows`, typeflag: tar.TypeDir},
+		testTarEntry{name: `Files\Windows\hello.txt`, contents: "hello windows"},
+		testTarEntry{name: `Files\Windows\old.txt`, contents: "old"},
+		testTarEntry{name: `Files\Windows\link.txt`, linkname: `Files\Windows\hello.txt`, typeflag: tar.TypeLink},
+		testTarEntry{name: `Hives\Software_Delta`, contents: "hive"},
+	)
+	upper := newTestTarLayer(t,
+		testTarEntry{name: `Files\Windows\.wh.old.txt`},
+	)
+	v1Image, err := mutate.AppendLayers(empty.Image, base, upper)
+	require.NoError(t, err)
+
+	img := NewImage(v1Image, t.TempDir())
+	require.NoError(t, img.Read(WithWindowsLayerPaths()))
+
+	tree := img.SquashedTree()
+	for _, p := range []file.Path{"/Windows/hello.txt", "/Windows/link.txt", "/Hives/Software_Delta"} {
+		assert.True(t, tree.HasPath(p), "missing path=%q", p)
+	}
+	for _, p := range []file.Path{"/Windows/old.txt", "/Files", `/Files\Windows\hello.txt`} {
+		assert.False(t, tree.HasPath(p), "unexpected path=%q", p)
+	}
+
+	for _, p := range []file.Path{"/Windows/hello.txt", "/Windows/link.txt"} {
+		reader, err := img.FileContentsFromSquash(p)
+		require.NoError(t, err)
+		contents, err := ioutil.ReadAll(reader)
+		require.NoError(t, reader.Close())
+		require.NoError(t, err)
+		assert.Equal(t, "hello windows", string(contents))
+	}
+}
+
+func TestImage_Read_ForeignLayersSkipped(t *testing.T) {
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	_, err := gw.Write(newTestTar(t, testTarEntry{name: "Files/Windows/base.txt", contents: "base"}))
+	require.NoError(t, err)
+	require.NoError(t, gw.Close())
+
+	foreign, err := partial.CompressedToLayer(&blobTestLayer{blob: buf.Bytes(), mediaType: types.DockerForeignLayer})
+	require.NoError(t, err)
+	app := newTestTarLayer(t, testTarEntry{name: "Files/app/app.exe", contents: "app"})
+
+	tests := []struct {
+		name        string
+		options     []ReadOption
+		unavailable bool
+	}{
+		{
+			name: "fetched by default",
+		},
+		{
+			name:        "skipped",
+			options:     []ReadOption{WithForeignLayersSkipped()},
+			unavailable: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v1Image, err := mutate.AppendLayers(empty.Image, foreign, app)
+			require.NoError(t, err)
+			img := NewImage(v1Image, t.TempDir())
+			require.NoError(t, img.Read(append(test.options, WithWindowsLayerPaths())...))
+
+			require.Len(t, img.Layers, 2)
+			assert.Equal(t, types.DockerForeignLayer, img.Layers[0].Metadata.MediaType)
+			assert.Equal(t, test.unavailable, img.Layers[0].Unavailable)
+			assert.False(t, img.Layers[1].Unavailable)
+
+			tree := img.SquashedTree()
+			assert.True(t, tree.HasPath("/app/app.exe"))
+			assert.Equal(t, !test.unavailable, tree.HasPath("/Windows/base.txt"))
+
+			var warned bool
+			for _, w := range img.Warnings() {
+				warned = warned || w.Kind == WarningForeignLayer
+			}
+			assert.Equal(t, test.unavailable, warned)
+		})
+	}
+}
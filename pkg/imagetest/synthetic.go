@@ -0,0 +1,232 @@
+package imagetest
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/anchore/stereoscope/pkg/image"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/stretchr/testify/require"
+)
+
+// SyntheticImageTag is the tag of saved synthetic images (see SaveSyntheticImage).
+const SyntheticImageTag = "stereoscope-synthetic:latest"
+
+// syntheticExtensions are the file extensions used for regular files, so that typical glob patterns (e.g. "**/*.so")
+// have matches.
+var syntheticExtensions = []string{".so", ".txt", ".py", ".json", ".conf", ""}
+
+// SyntheticImageConfig describes the shape of a procedurally generated image (see NewSyntheticImage). The same config
+// always generates the same image, so a config is all that is needed to reproduce a workload. Zero values select the
+// defaults noted for each field.
+type SyntheticImageConfig struct {
+	// Layers is the number of layers (default 1)
+	Layers int
+	// FilesPerLayer is the number of files (regular files and symlinks) added by each layer (default 100)
+	FilesPerLayer int
+	// MaxDepth is the maximum number of directories between the root and a file (default 4)
+	MaxDepth int
+	// DirFanout is the number of distinct directory names at each depth (default 4)
+	DirFanout int
+	// FileSize is the size (in bytes) of each regular file (default 64)
+	FileSize int
+	// SymlinkRatio is the fraction (0-1) of the files added by each layer that are symlinks to existing files
+	SymlinkRatio float64
+	// WhiteoutRatio is the fraction (0-1) of the files from lower layers that are deleted (whited out) by each layer
+	WhiteoutRatio float64
+	// Seed seeds the pseudo-random generator, so different seeds generate different images with the same shape
+	Seed int64
+}
+
+func (c SyntheticImageConfig) withDefaults() SyntheticImageConfig {
+	if c.Layers <= 0 {
+		c.Layers = 1
+	}
+	if c.FilesPerLayer <= 0 {
+		c.FilesPerLayer = 100
+	}
+	if c.MaxDepth <= 0 {
+		c.MaxDepth = 4
+	}
+	if c.DirFanout <= 0 {
+		c.DirFanout = 4
+	}
+	if c.FileSize <= 0 {
+		c.FileSize = 64
+	}
+	return c
+}
+
+// NewSyntheticLayerTars returns the (uncompressed) tar of each layer of the synthetic image for the given config.
+func NewSyntheticLayerTars(t testing.TB, cfg SyntheticImageConfig) [][]byte {
+	t.Helper()
+
+	g := &syntheticGenerator{
+		cfg:  cfg.withDefaults(),
+		rng:  rand.New(rand.NewSource(cfg.Seed)),
+		dirs: make(map[string]struct{}),
+	}
+
+	var tars [][]byte
+	for idx := 0; idx < g.cfg.Layers; idx++ {
+		content, err := g.layer(idx)
+		require.NoError(t, err)
+		tars = append(tars, content)
+	}
+	return tars
+}
+
+// NewSyntheticV1Image returns the (unread) synthetic image for the given config.
+func NewSyntheticV1Image(t testing.TB, cfg SyntheticImageConfig) v1.Image {
+	t.Helper()
+
+	var layers []v1.Layer
+	for _, content := range NewSyntheticLayerTars(t, cfg) {
+		content := content
+		layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(content)), nil
+		})
+		require.NoError(t, err)
+		layers = append(layers, layer)
+	}
+
+	img, err := mutate.AppendLayers(empty.Image, layers...)
+	require.NoError(t, err)
+	return img
+}
+
+// NewSyntheticImage returns the synthetic image for the given config, already read (and cleaned up once the test
+// completes), which is useful for benchmarking operations against a fully indexed image.
+func NewSyntheticImage(t testing.TB, cfg SyntheticImageConfig, options ...image.ReadOption) *image.Image {
+	t.Helper()
+
+	img := image.NewImage(NewSyntheticV1Image(t, cfg), t.TempDir())
+	require.NoError(t, img.Read(options...))
+	t.Cleanup(func() {
+		if err := img.Cleanup(); err != nil {
+			t.Errorf("could not cleanup synthetic image: %+v", err)
+		}
+	})
+	return img
+}
+
+// SaveSyntheticImage writes the synthetic image for the given config as a docker archive (tagged SyntheticImageTag) to
+// the given path, which is useful for benchmarking the entire image fetch (e.g. stereoscope.GetImage with a
+// "docker-archive:" source).
+func SaveSyntheticImage(t testing.TB, cfg SyntheticImageConfig, path string) {
+	t.Helper()
+
+	tag, err := name.NewTag(SyntheticImageTag)
+	require.NoError(t, err)
+	require.NoError(t, tarball.WriteToFile(path, tag, NewSyntheticV1Image(t, cfg)))
+}
+
+// syntheticGenerator generates the layers of a synthetic image in order, keeping track of the files visible to later
+// layers.
+type syntheticGenerator struct {
+	cfg SyntheticImageConfig
+	rng *rand.Rand
+	// dirs are all directories added by any layer so far
+	dirs map[string]struct{}
+	// live are all files (not deleted by a whiteout) added by any layer so far, in the order added (which keeps the
+	// generation reproducible, unlike map iteration)
+	live []string
+}
+
+func (g *syntheticGenerator) layer(idx int) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+
+	// whiteouts only apply to files from lower layers, so they are decided before anything is added by this layer
+	var kept []string
+	for _, p := range g.live {
+		if g.rng.Float64() >= g.cfg.WhiteoutRatio {
+			kept = append(kept, p)
+			continue
+		}
+		dir, base := path.Split(p)
+		if err := writeSyntheticEntry(tw, &tar.Header{Typeflag: tar.TypeReg, Name: dir + file.WhiteoutPrefix + base, Mode: 0644}, nil); err != nil {
+			return nil, err
+		}
+	}
+	g.live = kept
+
+	for i := 0; i < g.cfg.FilesPerLayer; i++ {
+		dir := g.dir()
+		for _, d := range missingDirs(dir, g.dirs) {
+			if err := writeSyntheticEntry(tw, &tar.Header{Typeflag: tar.TypeDir, Name: d + "/", Mode: 0755}, nil); err != nil {
+				return nil, err
+			}
+			g.dirs[d] = struct{}{}
+		}
+
+		if len(g.live) > 0 && g.rng.Float64() < g.cfg.SymlinkRatio {
+			p := path.Join(dir, fmt.Sprintf("layer%d-link%d", idx, i))
+			header := &tar.Header{Typeflag: tar.TypeSymlink, Name: p, Linkname: g.live[g.rng.Intn(len(g.live))], Mode: 0777}
+			if err := writeSyntheticEntry(tw, header, nil); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		p := path.Join(dir, fmt.Sprintf("layer%d-file%d%s", idx, i, syntheticExtensions[g.rng.Intn(len(syntheticExtensions))]))
+		contents := make([]byte, g.cfg.FileSize)
+		_, _ = g.rng.Read(contents)
+		if err := writeSyntheticEntry(tw, &tar.Header{Typeflag: tar.TypeReg, Name: p, Mode: 0644}, contents); err != nil {
+			return nil, err
+		}
+		g.live = append(g.live, p)
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("unable to close layer tar: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// dir returns a random directory path between one and MaxDepth directories deep (e.g. "/dir2/dir0/dir3").
+func (g *syntheticGenerator) dir() string {
+	depth := 1 + g.rng.Intn(g.cfg.MaxDepth)
+	elements := make([]string, depth)
+	for i := range elements {
+		elements[i] = fmt.Sprintf("dir%d", g.rng.Intn(g.cfg.DirFanout))
+	}
+	return "/" + strings.Join(elements, "/")
+}
+
+// missingDirs returns the given directory and all of its parents that are not within the given set, parents first.
+func missingDirs(dir string, existing map[string]struct{}) []string {
+	var missing []string
+	for d := dir; d != "/"; d = path.Dir(d) {
+		if _, ok := existing[d]; ok {
+			break
+		}
+		missing = append([]string{d}, missing...)
+	}
+	return missing
+}
+
+func writeSyntheticEntry(tw *tar.Writer, header *tar.Header, contents []byte) error {
+	// tar entries within layers are relative to the root
+	header.Name = strings.TrimPrefix(header.Name, "/")
+	header.Size = int64(len(contents))
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("unable to write tar header for %q: %w", header.Name, err)
+	}
+	if _, err := tw.Write(contents); err != nil {
+		return fmt.Errorf("unable to write tar contents for %q: %w", header.Name, err)
+	}
+	return nil
+}
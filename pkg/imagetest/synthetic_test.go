@@ -0,0 +1,105 @@
+package imagetest
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/anchore/stereoscope/pkg/file"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func syntheticTarHeaders(t *testing.T, content []byte) []*tar.Header {
+	t.Helper()
+	var headers []*tar.Header
+	tr := tar.NewReader(bytes.NewReader(content))
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return headers
+		}
+		require.NoError(t, err)
+		headers = append(headers, header)
+	}
+}
+
+func TestNewSyntheticLayerTars(t *testing.T) {
+	cfg := SyntheticImageConfig{
+		Layers:        3,
+		FilesPerLayer: 50,
+		MaxDepth:      3,
+		SymlinkRatio:  0.2,
+		WhiteoutRatio: 0.1,
+		Seed:          42,
+	}
+
+	tars := NewSyntheticLayerTars(t, cfg)
+	require.Len(t, tars, 3)
+	// the same config always generates the same layers
+	assert.Equal(t, tars, NewSyntheticLayerTars(t, cfg))
+
+	other := cfg
+	other.Seed = 7
+	assert.NotEqual(t, tars, NewSyntheticLayerTars(t, other))
+
+	var files, links, whiteouts int
+	for idx, content := range tars {
+		for _, header := range syntheticTarHeaders(t, content) {
+			assert.LessOrEqual(t, strings.Count(strings.TrimSuffix(header.Name, "/"), "/"), cfg.MaxDepth)
+			switch {
+			case strings.HasPrefix(path.Base(header.Name), file.WhiteoutPrefix):
+				assert.NotZero(t, idx, "the first layer should have no whiteouts")
+				whiteouts++
+			case header.Typeflag == tar.TypeSymlink:
+				links++
+			case header.Typeflag == tar.TypeReg:
+				assert.Equal(t, int64(64), header.Size)
+				files++
+			}
+		}
+	}
+	assert.Equal(t, cfg.Layers*cfg.FilesPerLayer, files+links)
+	assert.NotZero(t, links)
+	assert.NotZero(t, whiteouts)
+}
+
+func TestNewSyntheticImage(t *testing.T) {
+	cfg := SyntheticImageConfig{
+		Layers:        2,
+		FilesPerLayer: 20,
+		WhiteoutRatio: 1,
+	}
+
+	img := NewSyntheticImage(t, cfg)
+	require.Len(t, img.Layers, 2)
+
+	// every file from the first layer is deleted by the second layer
+	results, err := img.SquashedTree().FilesByGlob("**/layer*")
+	require.NoError(t, err)
+	assert.Len(t, results, cfg.FilesPerLayer)
+	for _, result := range results {
+		assert.True(t, strings.HasPrefix(path.Base(string(result.RealPath)), "layer1-"), result.RealPath)
+	}
+}
+
+func BenchmarkSyntheticImage_FilesByGlob(b *testing.B) {
+	img := NewSyntheticImage(b, SyntheticImageConfig{
+		Layers:        5,
+		FilesPerLayer: 2000,
+		MaxDepth:      6,
+		SymlinkRatio:  0.1,
+		WhiteoutRatio: 0.05,
+	})
+	tree := img.SquashedTree()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := tree.FilesByGlob("**/*.so"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
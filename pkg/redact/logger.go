@@ -0,0 +1,54 @@
+package redact
+
+import (
+	"fmt"
+
+	"github.com/anchore/stereoscope/pkg/logger"
+)
+
+// Logger returns a logger that redacts all messages (see Redact) before handing them to the given logger.
+func Logger(l logger.Logger) logger.Logger {
+	if l == nil {
+		return nil
+	}
+	if _, ok := l.(*redactingLogger); ok {
+		return l
+	}
+	return &redactingLogger{log: l}
+}
+
+type redactingLogger struct {
+	log logger.Logger
+}
+
+func (l *redactingLogger) Errorf(format string, args ...interface{}) {
+	l.log.Errorf("%s", Redact(fmt.Sprintf(format, args...)))
+}
+
+func (l *redactingLogger) Error(args ...interface{}) {
+	l.log.Error(Redact(fmt.Sprint(args...)))
+}
+
+func (l *redactingLogger) Warnf(format string, args ...interface{}) {
+	l.log.Warnf("%s", Redact(fmt.Sprintf(format, args...)))
+}
+
+func (l *redactingLogger) Warn(args ...interface{}) {
+	l.log.Warn(Redact(fmt.Sprint(args...)))
+}
+
+func (l *redactingLogger) Infof(format string, args ...interface{}) {
+	l.log.Infof("%s", Redact(fmt.Sprintf(format, args...)))
+}
+
+func (l *redactingLogger) Info(args ...interface{}) {
+	l.log.Info(Redact(fmt.Sprint(args...)))
+}
+
+func (l *redactingLogger) Debugf(format string, args ...interface{}) {
+	l.log.Debugf("%s", Redact(fmt.Sprintf(format, args...)))
+}
+
+func (l *redactingLogger) Debug(args ...interface{}) {
+	l.log.Debug(Redact(fmt.Sprint(args...)))
+}
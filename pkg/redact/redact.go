@@ -0,0 +1,184 @@
+package redact
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Marker replaces all redacted content.
+const Marker = "[REDACTED]"
+
+// minValueLength is the shortest secret value redacted verbatim (redacting shorter values would mangle unrelated text).
+const minValueLength = 4
+
+// DefaultAllowlist are the URL query parameters that are not redacted by default (registry pagination and token
+// scope parameters, which never contain credentials).
+var DefaultAllowlist = []string{"scope", "service", "n", "last", "digest", "mount", "from"}
+
+var (
+	urlPattern = regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.-]*://[^\s"'<>]+`)
+	// authorization header values (e.g. within dumped requests or error responses)
+	authHeaderPattern = regexp.MustCompile(`(?i)\b((?:proxy-)?authorization:\s*\[?(?:bearer\s+|basic\s+)?)[^\s"',\]]+`)
+	// token fields within JSON (e.g. registry token responses or docker config files)
+	tokenFieldPattern = regexp.MustCompile(`(?i)("(?:access_token|token|refresh_token|identitytoken|registrytoken|password|auth)"\s*:\s*")[^"]*`)
+)
+
+var defaultRedactor = NewRedactor()
+
+// Redactor removes credentials from text (such as log lines, event values, and error strings) before it leaves the
+// process. All stereoscope logs, events, and errors returned by the top-level API are redacted with the process-wide
+// redactor (see AddValues and SetAllowlist to configure it). Besides known secret values (see AddValues), URL user
+// info, the values of URL query parameters not within the allowlist (which covers signed blob URLs and token URLs),
+// authorization header values, and JSON token fields are always redacted. A Redactor is safe for concurrent use.
+type Redactor struct {
+	lock      sync.RWMutex
+	allowlist map[string]struct{}
+	values    map[string]struct{}
+}
+
+// NewRedactor creates a Redactor with the given allowlist of URL query parameter names (case-insensitive) whose
+// values are kept. The DefaultAllowlist is used when no names are given.
+func NewRedactor(allowlist ...string) *Redactor {
+	r := &Redactor{
+		values: make(map[string]struct{}),
+	}
+	r.SetAllowlist(allowlist...)
+	return r
+}
+
+// SetAllowlist replaces the URL query parameter names (case-insensitive) whose values are kept. The DefaultAllowlist
+// is used when no names are given.
+func (r *Redactor) SetAllowlist(names ...string) {
+	if len(names) == 0 {
+		names = DefaultAllowlist
+	}
+	allowlist := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		allowlist[strings.ToLower(name)] = struct{}{}
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.allowlist = allowlist
+}
+
+// AddValues registers secret values (e.g. passwords or tokens) that are redacted wherever they appear. Values shorter
+// than four characters are ignored.
+func (r *Redactor) AddValues(values ...string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, v := range values {
+		if len(v) >= minValueLength {
+			r.values[v] = struct{}{}
+		}
+	}
+}
+
+// Redact returns the given text with all credentials replaced by the Marker.
+func (r *Redactor) Redact(s string) string {
+	if s == "" {
+		return s
+	}
+
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	// known values first, since the other patterns may only partially cover a value
+	for v := range r.values {
+		s = strings.ReplaceAll(s, v, Marker)
+	}
+	s = urlPattern.ReplaceAllStringFunc(s, r.redactURL)
+	s = authHeaderPattern.ReplaceAllString(s, "${1}"+Marker)
+	s = tokenFieldPattern.ReplaceAllString(s, "${1}"+Marker)
+	return s
+}
+
+// redactURL removes the user info and the values of all query parameters not within the allowlist from the given URL
+// (preserving the remainder of the URL as given, since the URL may not be well-formed).
+func (r *Redactor) redactURL(u string) string {
+	schemeEnd := strings.Index(u, "://") + len("://")
+	rest := u[schemeEnd:]
+
+	// the authority ends at the first path, query, or fragment delimiter
+	authorityEnd := strings.IndexAny(rest, "/?#")
+	if authorityEnd < 0 {
+		authorityEnd = len(rest)
+	}
+	if at := strings.LastIndex(rest[:authorityEnd], "@"); at >= 0 {
+		rest = Marker + rest[at:]
+	}
+
+	queryStart := strings.Index(rest, "?")
+	if queryStart < 0 {
+		return u[:schemeEnd] + rest
+	}
+	query := rest[queryStart+1:]
+	fragment := ""
+	if idx := strings.Index(query, "#"); idx >= 0 {
+		query, fragment = query[:idx], query[idx:]
+	}
+
+	params := strings.Split(query, "&")
+	for idx, param := range params {
+		eq := strings.Index(param, "=")
+		if eq < 0 {
+			continue
+		}
+		name := param[:eq]
+		if _, ok := r.allowlist[strings.ToLower(name)]; ok {
+			continue
+		}
+		params[idx] = name + "=" + Marker
+	}
+	return u[:schemeEnd] + rest[:queryStart+1] + strings.Join(params, "&") + fragment
+}
+
+// Error returns an error whose message is redacted (see Redact). The original error is still available through
+// errors.Unwrap (for use with errors.Is and errors.As), so the redacted error should be the only error surfaced
+// outside of the process. A nil error is returned as nil.
+func (r *Redactor) Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	if redacted, ok := err.(*redactedError); ok {
+		err = redacted.err
+	}
+	return &redactedError{
+		err: err,
+		msg: r.Redact(err.Error()),
+	}
+}
+
+type redactedError struct {
+	err error
+	msg string
+}
+
+func (e *redactedError) Error() string {
+	return e.msg
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// SetAllowlist replaces the URL query parameter allowlist of the process-wide redactor (see Redactor.SetAllowlist).
+func SetAllowlist(names ...string) {
+	defaultRedactor.SetAllowlist(names...)
+}
+
+// AddValues registers secret values with the process-wide redactor (see Redactor.AddValues).
+func AddValues(values ...string) {
+	defaultRedactor.AddValues(values...)
+}
+
+// Redact redacts the given text with the process-wide redactor (see Redactor.Redact).
+func Redact(s string) string {
+	return defaultRedactor.Redact(s)
+}
+
+// Error redacts the message of the given error with the process-wide redactor (see Redactor.Error).
+func Error(err error) error {
+	return defaultRedactor.Error(err)
+}
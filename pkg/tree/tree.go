@@ -2,117 +2,247 @@ package tree
 
 import (
 	"fmt"
+	"sync/atomic"
 
 	"github.com/anchore/stereoscope/pkg/tree/node"
 )
 
-// Tree represents a simple Tree data structure.
+// maxLayers is the number of layers a Tree may be composed of before the layers are flattened into one, which bounds
+// the cost of a lookup.
+const maxLayers = 16
+
+// Tree represents a simple Tree data structure. Copies of a Tree share all structure (copy-on-write): the contents are
+// stored as a stack of layers, where only the top layer of a Tree is ever modified, and every lower layer is frozen and
+// may be shared between any number of trees.
 type Tree struct {
-	nodes    map[node.ID]node.Node
-	children map[node.ID]map[node.ID]node.Node
-	parent   map[node.ID]node.Node
+	// top holds all entries that were added or modified since the Tree was last copied
+	top *layer
+	// length is the number of nodes within the Tree
+	length int
+}
+
+// layer is a set of entries that take precedence over the entries of the lower (base) layers.
+type layer struct {
+	entries map[node.ID]*entry
+	// removed are the IDs of the entries within the lower layers that have been removed
+	removed map[node.ID]struct{}
+	base    *layer
+	// depth is the number of layers, including this one
+	depth int
+	// frozen is set (atomically) once the layer is shared with a copy, after which the layer is never modified
+	frozen int32
+}
+
+// entry is a node along with its relationships within the Tree. Entries within a frozen layer are never modified,
+// instead they are cloned into the top layer first (see Tree.mutable).
+type entry struct {
+	node      node.Node
+	parent    node.ID
+	hasParent bool
+	children  map[node.ID]struct{}
+	// sharedChildren indicates that the children are shared with the entry this entry was cloned from (and must be
+	// cloned before being modified)
+	sharedChildren bool
 }
 
 // NewTree returns an instance of a Tree.
 func NewTree() *Tree {
 	return &Tree{
-		nodes:    make(map[node.ID]node.Node),
-		children: make(map[node.ID]map[node.ID]node.Node),
-		parent:   make(map[node.ID]node.Node),
+		top: newLayer(nil),
+	}
+}
+
+func newLayer(base *layer) *layer {
+	depth := 1
+	if base != nil {
+		depth = base.depth + 1
+	}
+	return &layer{
+		entries: make(map[node.ID]*entry),
+		removed: make(map[node.ID]struct{}),
+		base:    base,
+		depth:   depth,
 	}
 }
 
+// Copy returns a copy of the Tree in constant time. The copy shares all nodes and structure with the original Tree
+// until either is modified, at which point only the modified entries are cloned. Note: nodes are shared between
+// copies, so nodes within a Tree should be replaced (see Replace) instead of modified in place.
 func (t *Tree) Copy() *Tree {
-	ct := NewTree()
-	for k, v := range t.nodes {
-		if v == nil {
-			ct.nodes[k] = nil
-			continue
-		}
-		ct.nodes[k] = v.Copy()
+	base := t.top
+	if len(base.entries) == 0 && len(base.removed) == 0 {
+		// nothing has been modified since the last copy, so the (already frozen) base can be shared as-is
+		base = base.base
+	} else {
+		atomic.StoreInt32(&base.frozen, 1)
 	}
-	for k, v := range t.parent {
-		if v == nil {
-			ct.parent[k] = nil
-			continue
+	if base != nil && base.depth >= maxLayers {
+		base = base.flatten()
+	}
+	return &Tree{
+		top:    newLayer(base),
+		length: t.length,
+	}
+}
+
+// writable ensures the top layer is not shared with any copy before the Tree is modified.
+func (t *Tree) writable() {
+	if atomic.LoadInt32(&t.top.frozen) == 0 {
+		return
+	}
+	base := t.top
+	if base.depth >= maxLayers {
+		base = base.flatten()
+	}
+	t.top = newLayer(base)
+}
+
+// lookup returns the entry for the given node ID across all layers (nil if there is no such node).
+func (l *layer) lookup(id node.ID) *entry {
+	for cur := l; cur != nil; cur = cur.base {
+		if e, ok := cur.entries[id]; ok {
+			return e
+		}
+		if _, ok := cur.removed[id]; ok {
+			return nil
 		}
-		ct.parent[k] = v.Copy()
 	}
-	for from, lookup := range t.children {
-		if _, exists := ct.children[from]; !exists {
-			ct.children[from] = make(map[node.ID]node.Node)
+	return nil
+}
+
+// each invokes the given function for every entry across all layers (once per node ID).
+func (l *layer) each(fn func(id node.ID, e *entry)) {
+	if l.base == nil {
+		for id, e := range l.entries {
+			fn(id, e)
 		}
-		for to, v := range lookup {
-			if v == nil {
-				ct.children[from][to] = nil
+		return
+	}
+	hidden := make(map[node.ID]struct{})
+	for cur := l; cur != nil; cur = cur.base {
+		for id, e := range cur.entries {
+			if _, ok := hidden[id]; ok {
 				continue
 			}
-			ct.children[from][to] = v.Copy()
+			hidden[id] = struct{}{}
+			fn(id, e)
+		}
+		for id := range cur.removed {
+			hidden[id] = struct{}{}
 		}
 	}
-	return ct
+}
+
+// flatten returns a single (frozen) layer with the same entries as all of the given layers.
+func (l *layer) flatten() *layer {
+	flat := newLayer(nil)
+	l.each(func(id node.ID, e *entry) {
+		flat.entries[id] = e
+	})
+	flat.frozen = 1
+	return flat
+}
+
+// mutable returns the entry for the given node ID within the top layer, cloning the entry from a lower layer if needed
+// (nil if there is no such node). The Tree must be writable.
+func (t *Tree) mutable(id node.ID) *entry {
+	if e, ok := t.top.entries[id]; ok {
+		return e
+	}
+	e := t.top.lookup(id)
+	if e == nil {
+		return nil
+	}
+	clone := *e
+	clone.sharedChildren = true
+	t.top.entries[id] = &clone
+	return &clone
+}
+
+// ownChildren returns the children of the entry, cloning them first if they are shared with another entry.
+func (e *entry) ownChildren() map[node.ID]struct{} {
+	if e.sharedChildren {
+		children := make(map[node.ID]struct{}, len(e.children))
+		for id := range e.children {
+			children[id] = struct{}{}
+		}
+		e.children = children
+		e.sharedChildren = false
+	}
+	return e.children
+}
+
+// remove deletes the entry for the given node ID from the Tree. The Tree must be writable.
+func (t *Tree) remove(id node.ID) {
+	delete(t.top.entries, id)
+	if t.top.base != nil && t.top.base.lookup(id) != nil {
+		t.top.removed[id] = struct{}{}
+	}
+	t.length--
 }
 
 // Roots is all of the nodes with no parents.
 func (t *Tree) Roots() node.Nodes {
 	var nodes = make([]node.Node, 0)
-	for _, n := range t.nodes {
-		if parent := t.parent[n.ID()]; parent == nil {
-			nodes = append(nodes, n)
+	t.top.each(func(_ node.ID, e *entry) {
+		if !e.hasParent {
+			nodes = append(nodes, e.node)
 		}
-	}
+	})
 	return nodes
 }
 
 // HasNode indicates is the given node ID exists in the Tree.
 func (t *Tree) HasNode(id node.ID) bool {
-	if _, exists := t.nodes[id]; exists {
-		return true
-	}
-	return false
+	return t.top.lookup(id) != nil
 }
 
 // Node returns a node object for the given ID.
 func (t *Tree) Node(id node.ID) node.Node {
-	return t.nodes[id]
+	if e := t.top.lookup(id); e != nil {
+		return e.node
+	}
+	return nil
 }
 
 // Nodes returns all nodes in the Tree.
 func (t *Tree) Nodes() node.Nodes {
-	if len(t.nodes) == 0 {
+	if t.length == 0 {
 		return nil
 	}
-	nodes := make([]node.Node, len(t.nodes))
-	i := 0
-	for _, n := range t.nodes {
-		nodes[i] = n
-		i++
-	}
-
+	nodes := make([]node.Node, 0, t.length)
+	t.top.each(func(_ node.ID, e *entry) {
+		nodes = append(nodes, e.node)
+	})
 	return nodes
 }
 
-// addNode adds the node to the Tree; returns an error on node ID collisions.
+// addNode adds the node to the Tree; returns an error on node ID collisions. The Tree must be writable.
 func (t *Tree) addNode(n node.Node) error {
-	if _, exists := t.nodes[n.ID()]; exists {
+	if t.HasNode(n.ID()) {
 		return fmt.Errorf("node ID collision: %+v", n.ID())
 	}
-	t.nodes[n.ID()] = n
-	t.children[n.ID()] = make(map[node.ID]node.Node)
-	t.parent[n.ID()] = nil
+	t.top.entries[n.ID()] = &entry{
+		node:     n,
+		children: make(map[node.ID]struct{}),
+	}
+	delete(t.top.removed, n.ID())
+	t.length++
 	return nil
 }
 
 // Replace takes the given old node and replaces it with the given new one.
 func (t *Tree) Replace(old node.Node, new node.Node) error {
-	if !t.HasNode(old.ID()) {
+	oldEntry := t.top.lookup(old.ID())
+	if oldEntry == nil {
 		return fmt.Errorf("cannot replace node not in the Tree")
 	}
+	t.writable()
 
 	if old.ID() == new.ID() {
 		// the underlying objects may be different, but the ID's match. Simply track the new [already existing] node
 		// and keep all existing relationships.
-		t.nodes[new.ID()] = new
+		t.mutable(new.ID()).node = new
 		return nil
 	}
 
@@ -123,32 +253,36 @@ func (t *Tree) Replace(old node.Node, new node.Node) error {
 	}
 
 	// set the new node parent to the old node parent
-	t.parent[new.ID()] = t.parent[old.ID()]
+	newEntry := t.top.entries[new.ID()]
+	newEntry.parent, newEntry.hasParent = oldEntry.parent, oldEntry.hasParent
 
-	for cid := range t.children[old.ID()] {
+	for cid := range oldEntry.children {
 		// replace the parent entry for each child
-		t.parent[cid] = new
+		if child := t.mutable(cid); child != nil {
+			child.parent = new.ID()
+		}
 
 		// add child entries to the new node
-		t.children[new.ID()][cid] = t.nodes[cid]
+		newEntry.children[cid] = struct{}{}
 	}
 
 	// replace the child entry for the old parents node
-	delete(t.children[t.parent[old.ID()].ID()], old.ID())
-	t.children[t.parent[old.ID()].ID()][new.ID()] = new
-
-	// remove the old node (if not already overwritten)
-	if old.ID() != new.ID() {
-		delete(t.children, old.ID())
-		delete(t.nodes, old.ID())
-		delete(t.parent, old.ID())
+	if oldEntry.hasParent {
+		if parent := t.mutable(oldEntry.parent); parent != nil {
+			children := parent.ownChildren()
+			delete(children, old.ID())
+			children[new.ID()] = struct{}{}
+		}
 	}
 
+	// remove the old node
+	t.remove(old.ID())
 	return nil
 }
 
 // AddRoot adds a node to the Tree (with no parent).
 func (t *Tree) AddRoot(n node.Node) error {
+	t.writable()
 	return t.addNode(n)
 }
 
@@ -157,32 +291,26 @@ func (t *Tree) AddChild(from, to node.Node) error {
 	var (
 		fid = from.ID()
 		tid = to.ID()
-		err error
 	)
 
 	if fid == tid {
 		return fmt.Errorf("should not add self edge")
 	}
+	t.writable()
 
-	if _, ok := t.nodes[fid]; !ok {
-		err = t.addNode(from)
-		if err != nil {
-			return err
+	for _, n := range []node.Node{from, to} {
+		if e := t.mutable(n.ID()); e != nil {
+			e.node = n
+			continue
 		}
-	} else {
-		t.nodes[fid] = from
-	}
-	if _, ok := t.nodes[tid]; !ok {
-		err = t.addNode(to)
-		if err != nil {
+		if err := t.addNode(n); err != nil {
 			return err
 		}
-	} else {
-		t.nodes[tid] = to
 	}
 
-	t.children[fid][tid] = to
-	t.parent[tid] = from
+	t.top.entries[fid].ownChildren()[tid] = struct{}{}
+	child := t.top.entries[tid]
+	child.parent, child.hasParent = fid, true
 	return nil
 }
 
@@ -190,46 +318,45 @@ func (t *Tree) AddChild(from, to node.Node) error {
 func (t *Tree) RemoveNode(n node.Node) (node.Nodes, error) {
 	removedNodes := make([]node.Node, 0)
 	nid := n.ID()
-	if _, ok := t.nodes[nid]; !ok {
+	e := t.top.lookup(nid)
+	if e == nil {
 		return nil, fmt.Errorf("unable to remove node: %+v", nid)
 	}
-	for _, child := range t.children[nid] {
-		subNodes, err := t.RemoveNode(child)
-		for _, sn := range subNodes {
-			removedNodes = append(removedNodes, sn)
+	t.writable()
+
+	for cid := range e.children {
+		child := t.top.lookup(cid)
+		if child == nil {
+			return nil, fmt.Errorf("unable to remove node: %+v", cid)
 		}
+		subNodes, err := t.RemoveNode(child.node)
+		removedNodes = append(removedNodes, subNodes...)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	removedNodes = append(removedNodes, t.nodes[nid])
+	removedNodes = append(removedNodes, e.node)
 
-	delete(t.children, nid)
-	if t.parent[nid] != nil {
-		delete(t.children[t.parent[nid].ID()], nid)
+	if e.hasParent {
+		if parent := t.mutable(e.parent); parent != nil {
+			delete(parent.ownChildren(), nid)
+		}
 	}
-	delete(t.parent, nid)
-	delete(t.nodes, nid)
+	t.remove(nid)
 	return removedNodes, nil
 }
 
 // Children returns all children of the given node.
 func (t *Tree) Children(n node.Node) node.Nodes {
-	nid := n.ID()
-	if _, ok := t.children[nid]; !ok {
-		return nil
-	}
-
-	if len(t.children) == 0 {
+	e := t.top.lookup(n.ID())
+	if e == nil {
 		return nil
 	}
 
-	from := make([]node.Node, len(t.children[nid]))
-	i := 0
-	for vid := range t.children[nid] {
-		from[i] = t.nodes[vid]
-		i++
+	from := make([]node.Node, 0, len(e.children))
+	for vid := range e.children {
+		from = append(from, t.Node(vid))
 	}
 
 	return from
@@ -237,12 +364,12 @@ func (t *Tree) Children(n node.Node) node.Nodes {
 
 // Parent returns the parent of the given node (or nil if it is a root)
 func (t *Tree) Parent(n node.Node) node.Node {
-	if parent, ok := t.parent[n.ID()]; ok {
-		return parent
+	if e := t.top.lookup(n.ID()); e != nil && e.hasParent {
+		return t.Node(e.parent)
 	}
 	return nil
 }
 
 func (t *Tree) Length() int {
-	return len(t.nodes)
+	return t.length
 }
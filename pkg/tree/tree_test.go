@@ -298,7 +298,7 @@ func TestTree_Replace(t *testing.T) {
 }
 
 func TestTree(t *testing.T) {
-	zero, one, two, three, four := newTestNode(0), newTestNode(1), newTestNode(2), newTestNode(3), newTestNode(4)
+	zero, one, two, three := newTestNode(0), newTestNode(1), newTestNode(2), newTestNode(3)
 
 	tests := []struct {
 		name     string
@@ -315,20 +315,20 @@ func TestTree(t *testing.T) {
 		{
 			name: "has nodes-children-parent",
 			fields: &Tree{
-				nodes: map[node.ID]node.Node{
-					zero.ID(): zero,
-					one.ID():  one,
-				},
-				children: map[node.ID]map[node.ID]node.Node{
-					one.ID(): {
-						two.ID():   two,
-						three.ID(): nil,
+				top: &layer{
+					entries: map[node.ID]*entry{
+						zero.ID(): {node: zero, children: map[node.ID]struct{}{}},
+						one.ID(): {
+							node:      one,
+							parent:    one.ID(),
+							hasParent: true,
+							children:  map[node.ID]struct{}{two.ID(): {}, three.ID(): {}},
+						},
 					},
+					removed: map[node.ID]struct{}{},
+					depth:   1,
 				},
-				parent: map[node.ID]node.Node{
-					four.ID(): nil,
-					one.ID():  one,
-				},
+				length: 2,
 			},
 			roots:    node.Nodes{zero},
 			id:       zero.ID(),
@@ -337,8 +337,9 @@ func TestTree(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			assert.Equal(t, tt.fields, tt.fields.Copy())
+			assert.ElementsMatch(t, tt.fields.Nodes(), tt.fields.Copy().Nodes())
 			assert.Equal(t, tt.roots, tt.fields.Roots())
+			assert.Equal(t, tt.roots, tt.fields.Copy().Roots())
 
 			if tt.id != "" {
 				assert.True(t, tt.fields.HasNode(tt.id))
@@ -350,3 +351,70 @@ func TestTree(t *testing.T) {
 		})
 	}
 }
+
+func TestTree_Copy_IsCopyOnWrite(t *testing.T) {
+	zero, one, two, three := newTestNode(0), newTestNode(1), newTestNode(2), newTestNode(3)
+
+	original := NewTree()
+	assert.NoError(t, original.AddRoot(zero))
+	assert.NoError(t, original.AddChild(zero, one))
+	assert.NoError(t, original.AddChild(one, two))
+
+	cp := original.Copy()
+	assert.NoError(t, cp.AddChild(zero, three))
+	_, err := cp.RemoveNode(one)
+	assert.NoError(t, err)
+
+	// the original is unaffected by changes to the copy
+	assert.Equal(t, 3, original.Length())
+	assert.True(t, original.HasNode(two.ID()))
+	assert.False(t, original.HasNode(three.ID()))
+	assert.True(t, node.Nodes{one}.Equal(original.Children(zero)))
+	assert.Equal(t, one, original.Parent(two))
+
+	assert.Equal(t, 2, cp.Length())
+	assert.False(t, cp.HasNode(one.ID()))
+	assert.False(t, cp.HasNode(two.ID()))
+	assert.True(t, node.Nodes{three}.Equal(cp.Children(zero)))
+
+	// and the copy is unaffected by changes to the original
+	four := newTestNode(4)
+	assert.NoError(t, original.Replace(two, four))
+	assert.False(t, cp.HasNode(four.ID()))
+	assert.True(t, node.Nodes{four}.Equal(original.Children(one)))
+	assert.Equal(t, one, original.Parent(four))
+
+	// a removed node can be added back to a copy
+	assert.NoError(t, cp.AddChild(zero, one))
+	assert.True(t, cp.HasNode(one.ID()))
+	assert.Empty(t, cp.Children(one))
+}
+
+func TestTree_Copy_ManyGenerations(t *testing.T) {
+	root := newTestNode("root")
+	tr := NewTree()
+	assert.NoError(t, tr.AddRoot(root))
+
+	// build a chain of copies deeper than the number of layers a tree may be composed of
+	var generations []*Tree
+	for i := 0; i < 3*maxLayers; i++ {
+		assert.NoError(t, tr.AddChild(root, newTestNode(i)))
+		generations = append(generations, tr)
+		tr = tr.Copy()
+		if i%2 == 1 {
+			// removals across layers
+			_, err := tr.RemoveNode(newTestNode(i - 1))
+			assert.NoError(t, err)
+		}
+	}
+
+	for idx, g := range generations {
+		assert.LessOrEqual(t, g.top.depth, maxLayers+1)
+		// every generation has the root and one node per generation, less the removed nodes of prior generations
+		expected := 1 + idx + 1 - idx/2
+		assert.Equal(t, expected, g.Length(), "generation %d", idx)
+		assert.Len(t, g.Nodes(), expected, "generation %d", idx)
+		assert.Len(t, g.Children(root), expected-1, "generation %d", idx)
+		assert.True(t, g.HasNode(toId(idx)), "generation %d", idx)
+	}
+}
@@ -116,6 +116,13 @@ func TestSimpleImage(t *testing.T) {
 		expectedSet.Add(int(src))
 	}
 	expectedSet.Remove(int(image.OciRegistrySource))
+	// archives served over HTTP or from object stores are provided by the archive providers already covered
+	expectedSet.Remove(int(image.HTTPTarballSource))
+	expectedSet.Remove(int(image.ObjectStoreSource))
+	// the local storage of a stopped docker daemon, containerd, or CRI-O/Podman cannot be produced from the fixtures
+	expectedSet.Remove(int(image.DockerStorageSource))
+	expectedSet.Remove(int(image.ContainerdStoreSource))
+	expectedSet.Remove(int(image.ContainersStorageSource))
 
 	for _, c := range simpleImageTestCases {
 		t.Run(c.source, func(t *testing.T) {